@@ -0,0 +1,84 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	_ "embed"
+)
+
+// APIVersion is the current version of the Request and Response schemas. All
+// changes to either schema within a version are backwards-compatible: fields
+// may be added, but are never removed, renamed, or given new meanings.
+const APIVersion = "v1alpha1"
+
+//go:embed api-schema.json
+var apiSchemaBytes []byte
+
+var (
+	requestSchema  *gojsonschema.Schema
+	responseSchema *gojsonschema.Schema
+)
+
+func init() {
+	var err error
+	if requestSchema, err = compileAPISchema("request"); err != nil {
+		panic(fmt.Sprintf("error compiling request schema: %s", err))
+	}
+	if responseSchema, err = compileAPISchema("response"); err != nil {
+		panic(fmt.Sprintf("error compiling response schema: %s", err))
+	}
+}
+
+// compileAPISchema compiles the named definition from the API schema.
+func compileAPISchema(definition string) (*gojsonschema.Schema, error) {
+	sl := gojsonschema.NewSchemaLoader()
+	if err := sl.AddSchema(
+		"kargo-render-api-schema.json",
+		gojsonschema.NewBytesLoader(apiSchemaBytes),
+	); err != nil {
+		return nil, err
+	}
+	return sl.Compile(
+		gojsonschema.NewStringLoader(
+			fmt.Sprintf(
+				`{"$ref": "kargo-render-api-schema.json#/definitions/%s"}`,
+				definition,
+			),
+		),
+	)
+}
+
+// UnmarshalRequest validates the provided JSON against the published Request
+// schema and, if it is valid, unmarshals it into a Request. This is useful for
+// servers that accept rendering requests from clients not written in Go.
+func UnmarshalRequest(data []byte) (*Request, error) {
+	if err := validateAgainstSchema(requestSchema, data); err != nil {
+		return nil, fmt.Errorf("error validating request: %w", err)
+	}
+	req := &Request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("error unmarshaling request: %w", err)
+	}
+	return req, nil
+}
+
+// validateAgainstSchema validates the provided JSON against the provided
+// schema, returning an error describing all violations, if any.
+func validateAgainstSchema(schema *gojsonschema.Schema, data []byte) error {
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		verrStrs := make([]string, len(result.Errors()))
+		for i, verr := range result.Errors() {
+			verrStrs[i] = verr.String()
+		}
+		return fmt.Errorf("%s", strings.Join(verrStrs, "; "))
+	}
+	return nil
+}
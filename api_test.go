@@ -0,0 +1,150 @@
+package render
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalRequest(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		assertions func(*testing.T, *Request, error)
+	}{
+		{
+			name: "invalid JSON",
+			data: "bogus",
+			assertions: func(t *testing.T, _ *Request, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "unknown field",
+			data: `{"targetBranch": "env/dev", "bogus": true}`,
+			assertions: func(t *testing.T, _ *Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "error validating request")
+			},
+		},
+		{
+			name: "unsupported API version",
+			data: `{"apiVersion": "v0", "targetBranch": "env/dev"}`,
+			assertions: func(t *testing.T, _ *Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "apiVersion")
+			},
+		},
+		{
+			name: "missing target branch",
+			data: `{"repoURL": "https://github.com/akuity/foobar"}`,
+			assertions: func(t *testing.T, _ *Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "targetBranch")
+			},
+		},
+		{
+			name: "success",
+			data: `{
+				"apiVersion": "v1alpha1",
+				"repoURL": "https://github.com/akuity/foobar",
+				"repoCreds": {"username": "foo", "password": "bar"},
+				"targetBranch": "env/dev",
+				"images": ["akuity/some-image:v1.0.0"],
+				"vars": {"region": "us-east-1"}
+			}`,
+			assertions: func(t *testing.T, req *Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, APIVersion, req.APIVersion)
+				require.Equal(t, "env/dev", req.TargetBranch)
+				require.Equal(t, "bar", req.RepoCreds.Password)
+				require.Equal(t, "us-east-1", req.Vars["region"])
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req, err := UnmarshalRequest([]byte(testCase.data))
+			testCase.assertions(t, req, err)
+		})
+	}
+}
+
+// TestAPISchemaCoversTypes guards against fields being added to the API types
+// without also being added to the published schema.
+func TestAPISchemaCoversTypes(t *testing.T) {
+	schema := struct {
+		Definitions map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"definitions"`
+	}{}
+	require.NoError(t, json.Unmarshal(apiSchemaBytes, &schema))
+	for definition, obj := range map[string]any{
+		"request":                 Request{},
+		"repoCredentials":         RepoCredentials{},
+		"commitAuthor":            CommitAuthor{},
+		"pullRequestOptions":      PullRequestOptions{},
+		"response":                Response{},
+		"prunedApp":               PrunedApp{},
+		"relocatedApp":            RelocatedApp{},
+		"resourcePolicyViolation": ResourcePolicyViolation{},
+		"duplicateResource":       DuplicateResource{},
+		"lintFinding":             LintFinding{},
+		"sourceHistory":           SourceHistory{},
+		"stageTiming":             StageTiming{},
+		"diagnostics":             Diagnostics{},
+		"executedCommand":         ExecutedCommand{},
+	} {
+		props := schema.Definitions[definition].Properties
+		require.NotEmpty(t, props, "schema has no definition %q", definition)
+		objType := reflect.TypeOf(obj)
+		for i := 0; i < objType.NumField(); i++ {
+			field := objType.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			// Fields that are never marshaled are not part of the API
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			require.Contains(
+				t,
+				props,
+				name,
+				"schema definition %q is missing field %q",
+				definition,
+				name,
+			)
+		}
+		require.Len(t, props, countExportedFields(objType))
+	}
+}
+
+func TestResponseConformsToSchema(t *testing.T) {
+	res := Response{
+		APIVersion:     APIVersion,
+		ActionTaken:    ActionTakenOpenedPR,
+		CommitID:       "1abcdef2",
+		PullRequestURL: "https://github.com/akuity/foobar/pull/1",
+		LocalPath:      "/tmp/foo",
+		Manifests:      map[string][]byte{"app": []byte("kind: ConfigMap")},
+		PrunedApps:     []PrunedApp{{App: "foo", Path: "foo"}},
+		Timings:        []StageTiming{{Stage: StageClone, Duration: time.Second}},
+	}
+	resBytes, err := json.Marshal(res)
+	require.NoError(t, err)
+	require.NoError(t, validateAgainstSchema(responseSchema, resBytes))
+}
+
+func countExportedFields(t reflect.Type) int {
+	var count int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && field.Tag.Get("json") != "-" {
+			count++
+		}
+	}
+	return count
+}
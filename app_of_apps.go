@@ -0,0 +1,192 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/manifests"
+)
+
+// maxApplicationDepth is the maximum depth to which Argo CD Applications
+// nested within an app's manifests are flattened.
+const maxApplicationDepth = 10
+
+// flattenApplications replaces every Argo CD Application in the provided
+// manifests, which were pre-rendered for the named app, with the manifests
+// rendered from the Application's source, which must be in the repository
+// being rendered. Applications found in those manifests are replaced in the
+// same way, recursively, so that an app-of-apps tree is flattened into
+// concrete manifests. Sources are always rendered from the workspace, so the
+// target revisions of Applications are disregarded.
+func (s *service) flattenApplications(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+	appName string,
+	appManifests []byte,
+) ([]byte, error) {
+	return s.flattenNestedApplications(
+		ctx,
+		rc,
+		repoRoot,
+		appManifests,
+		[]string{appName},
+	)
+}
+
+// flattenNestedApplications does the work of flattenApplications. The
+// provided path lists the names of the app and of the Applications within
+// which the provided manifests are nested, outermost first.
+func (s *service) flattenNestedApplications(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+	appManifests []byte,
+	path []string,
+) ([]byte, error) {
+	resources, err := manifests.SplitYAMLResources(appManifests)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([][]byte, 0, len(resources))
+	for _, resource := range resources {
+		if resource.Kind != "Application" ||
+			!strings.HasPrefix(resource.APIVersion, "argoproj.io/") {
+			docs = append(docs, resource.Manifest)
+			continue
+		}
+		nestedPath := append(slices.Clone(path), resource.Name)
+		if slices.Contains(path, resource.Name) {
+			return nil, fmt.Errorf(
+				"Application %q is nested within itself: %s",
+				resource.Name,
+				strings.Join(nestedPath, " -> "),
+			)
+		}
+		if len(path) > maxApplicationDepth {
+			return nil, fmt.Errorf(
+				"Applications are nested more than %d levels deep: %s",
+				maxApplicationDepth,
+				strings.Join(nestedPath, " -> "),
+			)
+		}
+		cfg, err := applicationConfigManagement(rc, resource.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error flattening Application %q: %w",
+				resource.Name,
+				err,
+			)
+		}
+		if err = s.checkConfigManagementPolicy(
+			ctx,
+			repoRoot,
+			map[string]appConfig{
+				strings.Join(nestedPath, "/"): {ConfigManagement: cfg},
+			},
+		); err != nil {
+			return nil, err
+		}
+		nestedManifests, err := s.renderFn(ctx, repoRoot, cfg, rc.commands)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error rendering Application %q: %w",
+				resource.Name,
+				err,
+			)
+		}
+		if nestedManifests, err = s.flattenNestedApplications(
+			ctx,
+			rc,
+			repoRoot,
+			nestedManifests,
+			nestedPath,
+		); err != nil {
+			return nil, err
+		}
+		if len(nestedManifests) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(nestedManifests, []byte("\n")) {
+			nestedManifests = append(nestedManifests, '\n')
+		}
+		docs = append(docs, nestedManifests)
+	}
+	return manifests.CombineYAML(docs), nil
+}
+
+// applicationConfigManagement returns configuration for rendering the source
+// of the Argo CD Application described by the provided manifest. An error is
+// returned if the source is not a path within the repository being rendered.
+func applicationConfigManagement(
+	rc requestContext,
+	manifest []byte,
+) (argocd.ConfigManagementConfig, error) {
+	app := argoappv1.Application{}
+	if err := yaml.Unmarshal(manifest, &app); err != nil {
+		return argocd.ConfigManagementConfig{},
+			fmt.Errorf("error parsing Application: %w", err)
+	}
+	if len(app.Spec.Sources) > 0 {
+		return argocd.ConfigManagementConfig{},
+			fmt.Errorf("Applications with multiple sources are not supported")
+	}
+	source := app.Spec.Source
+	if source == nil || source.Chart != "" || source.Path == "" {
+		return argocd.ConfigManagementConfig{}, fmt.Errorf(
+			"the Application's source is not a path within a git repository",
+		)
+	}
+	if !isRenderedRepo(rc, source.RepoURL) {
+		return argocd.ConfigManagementConfig{}, fmt.Errorf(
+			"the Application's source is in repository %q, which is not the "+
+				"repository being rendered",
+			source.RepoURL,
+		)
+	}
+	cfg := argocd.ConfigManagementConfig{
+		Path:      source.Path,
+		Directory: source.Directory,
+		Plugin:    source.Plugin,
+	}
+	if source.Helm != nil {
+		cfg.Helm = &argocd.ApplicationSourceHelm{
+			ApplicationSourceHelm: *source.Helm,
+			Namespace:             app.Spec.Destination.Namespace,
+		}
+	}
+	if source.Kustomize != nil {
+		cfg.Kustomize = &argocd.ApplicationSourceKustomize{
+			ApplicationSourceKustomize: *source.Kustomize,
+		}
+	}
+	return cfg, nil
+}
+
+// isRenderedRepo returns true if the provided URL refers to the repository
+// being rendered. URLs differing only in case, a trailing slash, or a .git
+// suffix are considered to refer to the same repository.
+func isRenderedRepo(rc requestContext, repoURL string) bool {
+	normalize := func(url string) string {
+		url = strings.ToLower(strings.TrimSpace(url))
+		url = strings.TrimSuffix(url, "/")
+		return strings.TrimSuffix(url, ".git")
+	}
+	renderedURLs := []string{rc.request.RepoURL, rc.request.PushURL}
+	if rc.repo != nil {
+		renderedURLs = append(renderedURLs, rc.repo.URL())
+	}
+	for _, renderedURL := range renderedURLs {
+		if renderedURL != "" && normalize(renderedURL) == normalize(repoURL) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestFlattenApplications(t *testing.T) {
+	const testRepoURL = "https://github.com/akuity/gitops"
+	application := func(name, repoURL, path string) string {
+		return fmt.Sprintf(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: %s
+spec:
+  destination:
+    namespace: %s
+  source:
+    repoURL: %s
+    path: %s
+    helm:
+      releaseName: %s
+`, name, name, repoURL, path, name)
+	}
+	configMap := func(name string) string {
+		return fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+`, name)
+	}
+	testCases := []struct {
+		name       string
+		sources    map[string]string
+		manifests  string
+		assertions func(*testing.T, []byte, error)
+	}{
+		{
+			name:      "no Applications",
+			manifests: configMap("foo"),
+			assertions: func(t *testing.T, manifests []byte, err error) {
+				require.NoError(t, err)
+				require.Equal(t, configMap("foo"), string(manifests))
+			},
+		},
+		{
+			name: "nested Applications",
+			sources: map[string]string{
+				"apps/bar": application("baz", testRepoURL+".git", "apps/baz") +
+					"---\n" + configMap("bar"),
+				"apps/baz": configMap("baz"),
+			},
+			manifests: configMap("foo") + "---\n" +
+				application("bar", testRepoURL+"/", "apps/bar"),
+			assertions: func(t *testing.T, manifests []byte, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					configMap("foo")+"---\n"+configMap("baz")+"---\n"+configMap("bar"),
+					string(manifests),
+				)
+			},
+		},
+		{
+			name: "Application nested within itself",
+			sources: map[string]string{
+				"apps/bar": application("foo", testRepoURL, "apps/foo"),
+			},
+			manifests: application("bar", testRepoURL, "apps/bar"),
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "foo -> bar -> foo")
+			},
+		},
+		{
+			name:      "source in another repository",
+			manifests: application("bar", "https://github.com/akuity/other", "apps/bar"),
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "error flattening Application \"bar\"")
+				require.ErrorContains(t, err, "not the repository being rendered")
+			},
+		},
+		{
+			name: "source is a Helm chart repository",
+			manifests: `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: bar
+spec:
+  source:
+    repoURL: https://charts.example.com
+    chart: bar
+    targetRevision: 1.0.0
+`,
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "not a path within a git repository")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := &service{
+				renderFn: func(
+					_ context.Context,
+					_ string,
+					cfg argocd.ConfigManagementConfig,
+					_ *commandTrace,
+				) ([]byte, error) {
+					require.NotNil(t, cfg.Helm)
+					require.Equal(t, cfg.Helm.ReleaseName, cfg.Helm.Namespace)
+					manifests, ok := testCase.sources[cfg.Path]
+					require.True(t, ok)
+					return []byte(manifests), nil
+				},
+			}
+			rc := requestContext{
+				request: &Request{RepoURL: testRepoURL},
+			}
+			manifests, err := s.flattenApplications(
+				context.Background(),
+				rc,
+				t.TempDir(),
+				"foo",
+				[]byte(testCase.manifests),
+			)
+			testCase.assertions(t, manifests, err)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Artifacts are the rendered manifests, and the diff they introduced, of a
+// rendering request that resulted in a commit. They are persisted when the
+// Service is configured with an ArtifactsDir, so that what was pushed can be
+// displayed later without cloning the repository.
+type Artifacts struct {
+	// ID is the ID of the request. It is the same as the ArtifactsID field of
+	// the request's Response.
+	ID string `json:"id"`
+	// Tenant is the tenant of the request, if any, to which the artifacts are
+	// scoped.
+	Tenant string `json:"tenant,omitempty"`
+	// RepoURL is the URL of the repository the manifests were rendered from.
+	RepoURL string `json:"repoURL"`
+	// TargetBranch is the environment-specific branch the manifests were
+	// rendered into.
+	TargetBranch string `json:"targetBranch"`
+	// CommitID is the ID of the commit containing the rendered manifests.
+	CommitID string `json:"commitID,omitempty"`
+	// PullRequestURL is the URL of the pull request containing the rendered
+	// manifests, if one was opened or updated.
+	PullRequestURL string `json:"pullRequestURL,omitempty"`
+	// Manifests are the rendered manifests, indexed by app name.
+	Manifests map[string]string `json:"manifests"`
+	// Diff is a unified diff of the changes made by the commit containing the
+	// rendered manifests.
+	Diff string `json:"diff,omitempty"`
+	// Created is when the artifacts were persisted.
+	Created time.Time `json:"created"`
+}
+
+// artifactsPath returns the location, within the specified directory, of the
+// artifacts of the request with the specified tenant and ID. The artifacts of
+// each tenant are kept in a subdirectory named after it. Those of requests
+// without a tenant are kept in the directory itself.
+func artifactsPath(dir, tenant, id string) string {
+	return filepath.Join(dir, tenant, fmt.Sprintf("%s.json", id))
+}
+
+// saveArtifacts persists the provided artifacts to the specified directory,
+// replacing any previously persisted for the same tenant and request ID.
+func saveArtifacts(dir string, artifacts Artifacts) error {
+	artifactsBytes, err := json.Marshal(artifacts)
+	if err != nil {
+		return fmt.Errorf("error marshaling artifacts: %w", err)
+	}
+	dir = filepath.Join(dir, artifacts.Tenant)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating artifacts directory %q: %w", dir, err)
+	}
+	// Write to a temporary file first so that readers never observe partially
+	// written artifacts
+	tmp, err := os.CreateTemp(dir, ".artifacts-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(artifactsBytes); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing artifacts: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error writing artifacts: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.json", artifacts.ID))
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing artifacts to %q: %w", path, err)
+	}
+	return nil
+}
+
+// LoadArtifacts returns the artifacts of the request with the specified tenant
+// and ID that a Service configured with the specified ArtifactsDir persisted.
+// The tenant is empty for requests that did not specify one. If no such
+// artifacts exist, the returned error wraps fs.ErrNotExist.
+func LoadArtifacts(dir, tenant, id string) (Artifacts, error) {
+	artifacts := Artifacts{}
+	if tenant != "" && !requestIDRegex.MatchString(tenant) {
+		return artifacts, fmt.Errorf("tenant %q is invalid: %w", tenant, fs.ErrNotExist)
+	}
+	if !requestIDRegex.MatchString(id) {
+		return artifacts, fmt.Errorf("request ID %q is invalid: %w", id, fs.ErrNotExist)
+	}
+	artifactsBytes, err := os.ReadFile(artifactsPath(dir, tenant, id))
+	if err != nil {
+		return artifacts, fmt.Errorf("error reading artifacts of request %q: %w", id, err)
+	}
+	if err = json.Unmarshal(artifactsBytes, &artifacts); err != nil {
+		return artifacts, fmt.Errorf("error unmarshaling artifacts of request %q: %w", id, err)
+	}
+	return artifacts, nil
+}
+
+// PruneArtifacts removes, from the specified directory, the artifacts of every
+// tenant that were persisted longer ago than the specified retention period.
+// The subdirectories of tenants are left in place, so that they never vanish
+// while artifacts are being persisted to them. It returns the number of
+// artifacts removed.
+func PruneArtifacts(dir string, retention time.Duration) (int, error) {
+	cutoff := time.Now().Add(-retention)
+	var removed int
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading %q: %w", path, err))
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("error removing %q: %w", path, err))
+			return nil
+		}
+		if filepath.Ext(path) == ".json" {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error reading artifacts directory %q: %w", dir, err))
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package render
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	artifacts := Artifacts{
+		ID:           "fake-id",
+		RepoURL:      "https://github.com/akuity/foobar",
+		TargetBranch: "env/dev",
+		CommitID:     "fake-commit-id",
+		Manifests:    map[string]string{"my-app": "kind: ConfigMap\n"},
+		Diff:         "fake diff",
+		Created:      time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, saveArtifacts(dir, artifacts))
+
+	loaded, err := LoadArtifacts(dir, "", "fake-id")
+	require.NoError(t, err)
+	require.Equal(t, artifacts, loaded)
+
+	// Artifacts persisted again for the same request replace the originals
+	artifacts.CommitID = "another-fake-commit-id"
+	require.NoError(t, saveArtifacts(dir, artifacts))
+	loaded, err = LoadArtifacts(dir, "", "fake-id")
+	require.NoError(t, err)
+	require.Equal(t, "another-fake-commit-id", loaded.CommitID)
+
+	_, err = LoadArtifacts(dir, "", "nonexistent-id")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = LoadArtifacts(dir, "", "../fake-id")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.ErrorContains(t, err, "is invalid")
+
+	// Artifacts of a tenant can only be loaded by the same tenant
+	artifacts.Tenant = "fake-tenant"
+	artifacts.ID = "fake-tenant-id"
+	require.NoError(t, saveArtifacts(dir, artifacts))
+	loaded, err = LoadArtifacts(dir, "fake-tenant", "fake-tenant-id")
+	require.NoError(t, err)
+	require.Equal(t, artifacts, loaded)
+	_, err = LoadArtifacts(dir, "", "fake-tenant-id")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = LoadArtifacts(dir, "another-fake-tenant", "fake-tenant-id")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = LoadArtifacts(dir, "..", "fake-id")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.ErrorContains(t, err, "is invalid")
+}
+
+func TestPruneArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	for _, artifacts := range []Artifacts{
+		{ID: "old-id"},
+		{ID: "new-id"},
+		{ID: "old-id", Tenant: "fake-tenant"},
+		{ID: "new-id", Tenant: "fake-tenant"},
+	} {
+		require.NoError(t, saveArtifacts(dir, artifacts))
+		if artifacts.ID == "old-id" {
+			old := time.Now().Add(-2 * time.Hour)
+			path := artifactsPath(dir, artifacts.Tenant, artifacts.ID)
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+
+	removed, err := PruneArtifacts(dir, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	for _, tenant := range []string{"", "fake-tenant"} {
+		_, err = LoadArtifacts(dir, tenant, "old-id")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = LoadArtifacts(dir, tenant, "new-id")
+		require.NoError(t, err)
+	}
+
+	// A directory that doesn't exist has nothing to prune
+	removed, err = PruneArtifacts(filepath.Join(dir, "nonexistent"), time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+}
@@ -0,0 +1,187 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// batchingService is a Service implementation that decorates another Service,
+// coalescing rendering requests for the same repository and target branch that
+// arrive within a configurable window into a single rendering request.
+type batchingService struct {
+	svc     Service
+	window  time.Duration
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+// batch represents a set of coalesced rendering requests.
+type batch struct {
+	// req is the request that is rendered on behalf of every coalesced request.
+	// It is the most recently received request, with the images and variables
+	// of all the coalesced requests merged into it.
+	req  *Request
+	done chan struct{}
+	res  Response
+	err  error
+}
+
+// NewBatchingService returns an implementation of the Service interface that
+// decorates the provided Service. Rendering requests for the same repository
+// and target branch that arrive within the specified window of the first such
+// request are coalesced into a single rendering request, using the most
+// recently received request. Only requests that differ in nothing but their
+// Ref, Source, ID, IdempotencyKey, Priority, Images, and Vars are coalesced.
+// The images and variables of all coalesced requests are merged, in the order
+// the requests were received, so an image or variable specified by a later
+// request replaces one of the same name specified by an earlier request. All
+// callers whose requests were coalesced receive the same Response. This is
+// useful for reducing pull request spam and CI churn when many commits are
+// merged to a repository's default branch in quick succession. Requests that
+// do not write to a remote repository are never coalesced.
+func NewBatchingService(svc Service, window time.Duration) Service {
+	return &batchingService{
+		svc:     svc,
+		window:  window,
+		batches: map[string]*batch{},
+	}
+}
+
+// Plan creates a plan using the decorated Service. Plans are never coalesced,
+// since each must describe the changes for one specific request.
+func (b *batchingService) Plan(ctx context.Context, req *Request) (Plan, error) {
+	return b.svc.Plan(ctx, req)
+}
+
+// Apply applies a plan using the decorated Service. Plans are never coalesced.
+func (b *batchingService) Apply(
+	ctx context.Context,
+	req *ApplyRequest,
+) (Response, error) {
+	return b.svc.Apply(ctx, req)
+}
+
+// WarmUp warms up the decorated Service. Warm-up requests are never
+// coalesced.
+func (b *batchingService) WarmUp(
+	ctx context.Context,
+	req *WarmUpRequest,
+) (WarmUpResponse, error) {
+	return b.svc.WarmUp(ctx, req)
+}
+
+// RenderWorkspace renders a workspace using the decorated Service. Workspace
+// rendering requests are never coalesced.
+func (b *batchingService) RenderWorkspace(
+	ctx context.Context,
+	req *WorkspaceRequest,
+) (WorkspaceResponse, error) {
+	return b.svc.RenderWorkspace(ctx, req)
+}
+
+// NewPipeline returns a Pipeline from the decorated Service. The caller decides
+// when each stage runs, so requests handled by a Pipeline are never coalesced.
+func (b *batchingService) NewPipeline(req *Request) (*Pipeline, error) {
+	return b.svc.NewPipeline(req)
+}
+
+func (b *batchingService) RenderManifests(
+	ctx context.Context,
+	req *Request,
+) (Response, error) {
+	if b.window <= 0 || req.LocalInPath != "" || !req.writesToRemote() {
+		return b.svc.RenderManifests(ctx, req)
+	}
+
+	key := batchKey(req)
+	b.mu.Lock()
+	bt, ok := b.batches[key]
+	if ok {
+		bt.req = mergeRequests(bt.req, req)
+	} else {
+		bt = &batch{
+			req:  req,
+			done: make(chan struct{}),
+		}
+		b.batches[key] = bt
+		// The render proceeds even if the context of the request that started
+		// the batch is canceled, since other requests may have been coalesced
+		// into it.
+		go b.render(context.WithoutCancel(ctx), key, bt)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-bt.done:
+		return bt.res, bt.err
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+// render waits for the batching window to elapse, closes the batch to new
+// requests, and then renders using the most recently received request.
+func (b *batchingService) render(ctx context.Context, key string, bt *batch) {
+	time.Sleep(b.window)
+	b.mu.Lock()
+	delete(b.batches, key)
+	req := bt.req
+	b.mu.Unlock()
+	bt.res, bt.err = b.svc.RenderManifests(ctx, req)
+	close(bt.done)
+}
+
+// batchKey returns a key identifying the repository and target branch of the
+// provided request and every other detail of it that must be identical for
+// requests to be coalesced.
+func batchKey(req *Request) string {
+	r := *req
+	r.Ref = ""
+	r.Source = nil
+	r.ID = ""
+	r.IdempotencyKey = ""
+	r.Priority = ""
+	r.Images = nil
+	r.Vars = nil
+	// Requests are hashed since they may contain credentials. The tenant isn't
+	// marshaled, so it is appended, which keeps the requests of different
+	// tenants apart.
+	reqBytes, _ := json.Marshal(r)
+	sum := sha256.Sum256(append(reqBytes, req.Tenant...))
+	return branchKey(req.RepoURL, req.TargetBranch) + ":" + hex.EncodeToString(sum[:])
+}
+
+// mergeRequests returns a copy of the newer of the provided requests, which
+// must have the same batchKey, with the images and variables of the older
+// merged into it. Where both specify an image or a variable of the same name,
+// the newer request's is used.
+func mergeRequests(older, newer *Request) *Request {
+	merged := *newer
+	images := map[string]string{}
+	for _, image := range older.Images {
+		images[imageName(image)] = image
+	}
+	for _, image := range newer.Images {
+		images[imageName(image)] = image
+	}
+	merged.Images = make([]string, 0, len(images))
+	for _, image := range images {
+		merged.Images = append(merged.Images, image)
+	}
+	sort.Strings(merged.Images)
+	if len(older.Vars) > 0 || len(newer.Vars) > 0 {
+		merged.Vars = make(map[string]string, len(older.Vars)+len(newer.Vars))
+		for name, value := range older.Vars {
+			merged.Vars[name] = value
+		}
+		for name, value := range newer.Vars {
+			merged.Vars[name] = value
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,218 @@
+package render
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockService struct {
+	renderFn func(context.Context, *Request) (Response, error)
+}
+
+func (m *mockService) RenderManifests(
+	ctx context.Context,
+	req *Request,
+) (Response, error) {
+	return m.renderFn(ctx, req)
+}
+
+func (m *mockService) Plan(context.Context, *Request) (Plan, error) {
+	return Plan{}, nil
+}
+
+func (m *mockService) Apply(context.Context, *ApplyRequest) (Response, error) {
+	return Response{}, nil
+}
+
+func (m *mockService) WarmUp(context.Context, *WarmUpRequest) (WarmUpResponse, error) {
+	return WarmUpResponse{}, nil
+}
+
+func (m *mockService) RenderWorkspace(
+	context.Context,
+	*WorkspaceRequest,
+) (WorkspaceResponse, error) {
+	return WorkspaceResponse{}, nil
+}
+
+func (m *mockService) NewPipeline(*Request) (*Pipeline, error) {
+	return nil, nil
+}
+
+func TestBatchingService(t *testing.T) {
+	var calls atomic.Int32
+	svc := NewBatchingService(
+		&mockService{
+			renderFn: func(_ context.Context, req *Request) (Response, error) {
+				calls.Add(1)
+				return Response{CommitID: req.Ref}, nil
+			},
+		},
+		100*time.Millisecond,
+	)
+
+	t.Run("requests for the same branch are coalesced", func(t *testing.T) {
+		calls.Store(0)
+		refs := []string{"a", "b", "c"}
+		results := make([]Response, len(refs))
+		wg := sync.WaitGroup{}
+		for i, ref := range refs {
+			wg.Add(1)
+			go func(i int, ref string) {
+				defer wg.Done()
+				res, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						RepoURL:      "https://github.com/akuity/foobar",
+						TargetBranch: "env/dev",
+						Ref:          ref,
+					},
+				)
+				require.NoError(t, err)
+				results[i] = res
+			}(i, ref)
+			// Ensure requests arrive in order
+			time.Sleep(10 * time.Millisecond)
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), calls.Load())
+		for _, res := range results {
+			require.Equal(t, "c", res.CommitID)
+		}
+	})
+
+	t.Run("images and vars of coalesced requests are merged", func(t *testing.T) {
+		calls.Store(0)
+		var rendered *Request
+		svc := NewBatchingService(
+			&mockService{
+				renderFn: func(_ context.Context, req *Request) (Response, error) {
+					calls.Add(1)
+					rendered = req
+					return Response{}, nil
+				},
+			},
+			100*time.Millisecond,
+		)
+		reqs := []*Request{
+			{
+				Ref:    "a",
+				Images: []string{"nginx:1.24.0", "redis:7.0"},
+				Vars:   map[string]string{"region": "us-east-1", "tier": "web"},
+			},
+			{
+				Ref:    "b",
+				Images: []string{"nginx:1.25.3"},
+				Vars:   map[string]string{"region": "eu-west-1"},
+			},
+		}
+		wg := sync.WaitGroup{}
+		for _, req := range reqs {
+			req.RepoURL = "https://github.com/akuity/foobar"
+			req.TargetBranch = "env/dev"
+			wg.Add(1)
+			go func(req *Request) {
+				defer wg.Done()
+				_, err := svc.RenderManifests(context.Background(), req)
+				require.NoError(t, err)
+			}(req)
+			// Ensure requests arrive in order
+			time.Sleep(10 * time.Millisecond)
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), calls.Load())
+		require.Equal(t, "b", rendered.Ref)
+		require.Equal(t, []string{"nginx:1.25.3", "redis:7.0"}, rendered.Images)
+		require.Equal(
+			t,
+			map[string]string{"region": "eu-west-1", "tier": "web"},
+			rendered.Vars,
+		)
+	})
+
+	t.Run("requests that differ otherwise are not coalesced", func(t *testing.T) {
+		calls.Store(0)
+		wg := sync.WaitGroup{}
+		for _, msg := range []string{"foo", "bar"} {
+			wg.Add(1)
+			go func(msg string) {
+				defer wg.Done()
+				_, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						RepoURL:       "https://github.com/akuity/foobar",
+						TargetBranch:  "env/dev",
+						CommitMessage: msg,
+					},
+				)
+				require.NoError(t, err)
+			}(msg)
+		}
+		wg.Wait()
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("requests of different tenants are not coalesced", func(t *testing.T) {
+		calls.Store(0)
+		wg := sync.WaitGroup{}
+		for _, tenant := range []string{"foo", "bar"} {
+			wg.Add(1)
+			go func(tenant string) {
+				defer wg.Done()
+				_, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						RepoURL:      "https://github.com/akuity/foobar",
+						TargetBranch: "env/dev",
+						Tenant:       tenant,
+					},
+				)
+				require.NoError(t, err)
+			}(tenant)
+		}
+		wg.Wait()
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("requests for different branches are not coalesced", func(t *testing.T) {
+		calls.Store(0)
+		wg := sync.WaitGroup{}
+		for _, branch := range []string{"env/dev", "env/prod"} {
+			wg.Add(1)
+			go func(branch string) {
+				defer wg.Done()
+				_, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						RepoURL:      "https://github.com/akuity/foobar",
+						TargetBranch: branch,
+					},
+				)
+				require.NoError(t, err)
+			}(branch)
+		}
+		wg.Wait()
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("requests that don't write to a remote are not coalesced", func(t *testing.T) {
+		calls.Store(0)
+		for i := 0; i < 2; i++ {
+			_, err := svc.RenderManifests(
+				context.Background(),
+				&Request{
+					RepoURL:      "https://github.com/akuity/foobar",
+					TargetBranch: "env/dev",
+					Stdout:       true,
+				},
+			)
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
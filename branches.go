@@ -1,11 +1,16 @@
 package render
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"sigs.k8s.io/yaml"
 
@@ -24,6 +29,39 @@ type branchMetadata struct {
 	// ImageSubstitutions is a list of new images that were used in rendering this
 	// branch.
 	ImageSubstitutions []string `json:"imageSubstitutions,omitempty"`
+	// AppImageSubstitutions records, for every app rendered into this branch,
+	// the image references in its pre-rendered manifests for which images from
+	// ImageSubstitutions were substituted, including references held by fields
+	// identified by the branch's imageFields rules.
+	AppImageSubstitutions []ImageSubstitution `json:"appImageSubstitutions,omitempty"`
+	// AppOutputPaths maps the name of every app rendered into this branch to
+	// the path, relative to the root of the branch, where that app's rendered
+	// manifests are stored. This records which paths are owned by Kargo Render
+	// so that output for apps that are later removed from configuration can be
+	// pruned.
+	AppOutputPaths map[string]string `json:"appOutputPaths,omitempty"`
+	// AppOutputLayouts maps the name of every app rendered into this branch to
+	// the layout of that app's rendered manifests: split, combined, or
+	// contentAddressable, followed by the subdirectories, if any, to which
+	// resources of particular kinds are routed. This records how each app's
+	// output was written so that changes to it can be detected.
+	AppOutputLayouts map[string]string `json:"appOutputLayouts,omitempty"`
+	// MergedFileContributions maps the path of every file in this branch to
+	// which content was appended using the "append" merge strategy to the
+	// content that was appended. This permits that content to be replaced,
+	// rather than appended again, the next time the branch is rendered.
+	MergedFileContributions map[string]string `json:"mergedFileContributions,omitempty"`
+	// Source describes where SourceCommit came from and what triggered its
+	// rendering into this branch, if the request that rendered it said.
+	Source *SourceContext `json:"source,omitempty"`
+	// RemoteBases records the remote bases referenced by the kustomizations of
+	// apps rendered into this branch, along with the commits they were fetched
+	// at, so that what was fetched over the network is known.
+	RemoteBases []RemoteBase `json:"remoteBases,omitempty"`
+	// RenderTimings records how long rendering the manifests in this branch
+	// took, so that rendering performance can be tracked over time. Changes to
+	// it alone are never committed.
+	RenderTimings *RenderTimings `json:"renderTimings,omitempty"`
 }
 
 // loadBranchMetadata attempts to load BranchMetadata from a
@@ -76,76 +114,153 @@ func writeBranchMetadata(md branchMetadata, repoPath string) error {
 	return nil
 }
 
-func switchToTargetBranch(rc requestContext) error {
+// branchIsEmpty returns true if the specified directory, which is the working
+// tree of a branch, contains nothing but, optionally, a .git directory or file.
+// A directory that does not exist, as when a working tree has yet to be
+// created, is empty too.
+func branchIsEmpty(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading contents of %q: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != ".git" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// removeBranchMetadata removes any .kargo-render/metadata.yaml file relative
+// to the specified directory, along with the .kargo-render directory if
+// nothing else is left in it. This is for branches whose metadata is stored
+// elsewhere, but may once have been stored in the branch itself.
+func removeBranchMetadata(repoPath string) error {
+	bkDir := filepath.Join(repoPath, ".kargo-render")
+	if err := os.Remove(
+		filepath.Join(bkDir, "metadata.yaml"),
+	); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing branch metadata: %w", err)
+	}
+	if entries, err := os.ReadDir(bkDir); err == nil && len(entries) == 0 {
+		if err = os.Remove(bkDir); err != nil {
+			return fmt.Errorf("error removing directory %q: %w", bkDir, err)
+		}
+	}
+	return nil
+}
+
+// switchToTargetBranch checks out the target branch, creating it if it does
+// not exist. A new target branch is normally given an empty initial commit
+// that is pushed to the remote right away, but when skipsInitialCommit returns
+// true, it is left without any commit so that the rendered manifests become
+// its first commit and are pushed along with it. The bool returned indicates
+// whether the target branch was left without any commit.
+func switchToTargetBranch(ctx context.Context, rc requestContext) (bool, error) {
 	logger := rc.logger.WithField("targetBranch", rc.request.TargetBranch)
 
 	// Check if the target branch exists on the remote
-	remoteTargetBranchExists, err := rc.repo.RemoteBranchExists(rc.request.TargetBranch)
+	remoteTargetBranchExists, err := rc.repo.RemoteBranchExists(ctx, rc.request.TargetBranch)
 	if err != nil {
-		return fmt.Errorf("error checking for existence of remote target branch: %w", err)
+		return false,
+			fmt.Errorf("error checking for existence of remote target branch: %w", err)
 	}
 
 	if remoteTargetBranchExists {
 		logger.Debug("target branch exists on remote")
-		if err = rc.repo.Fetch(); err != nil {
-			return fmt.Errorf("error fetching from remote: %w", err)
+		if err = rc.repo.Fetch(ctx); err != nil {
+			return false, fmt.Errorf("error fetching from remote: %w", err)
 		}
 		logger.Debug("fetched from remote")
-		if err = rc.repo.Checkout(rc.request.TargetBranch); err != nil {
-			return fmt.Errorf("error checking out target branch: %w", err)
+		if err = rc.repo.Checkout(ctx, rc.request.TargetBranch); err != nil {
+			return false, fmt.Errorf("error checking out target branch: %w", err)
 		}
 		logger.Debug("checked out target branch")
-		if err = rc.repo.Pull(rc.request.TargetBranch); err != nil {
-			return fmt.Errorf("error pulling from remote: %w", err)
+		if err = rc.repo.Pull(ctx, rc.request.TargetBranch); err != nil {
+			return false, fmt.Errorf("error pulling from remote: %w", err)
 		}
 		logger.Debug("pulled from remote")
-		return nil
+		if rc.plan != nil {
+			if rc.plan.TargetCommit, err = rc.repo.LastCommitID(ctx); err != nil {
+				return false, fmt.Errorf(
+					"error getting last commit ID from the target branch: %w",
+					err,
+				)
+			}
+		}
+		return false, nil
 	}
 
 	logger.Debug("target branch does not exist on remote")
 
 	// Check if the target branch exists locally
-	localTargetBranchExists, err := rc.repo.LocalBranchExists(rc.request.TargetBranch)
+	localTargetBranchExists, err := rc.repo.LocalBranchExists(ctx, rc.request.TargetBranch)
 	if err != nil {
-		return fmt.Errorf("error checking for existence of local target branch: %w", err)
+		return false, fmt.Errorf("error checking for existence of local target branch: %w", err)
 	}
 
 	if localTargetBranchExists {
 		logger.Debug("target branch exists locally")
-		if err = rc.repo.Checkout(rc.request.TargetBranch); err != nil {
-			return fmt.Errorf("error checking out target branch: %w", err)
+		if err = rc.repo.Checkout(ctx, rc.request.TargetBranch); err != nil {
+			return false, fmt.Errorf("error checking out target branch: %w", err)
 		}
 		logger.Debug("checked out target branch")
 	} else {
 		logger.Debug("target branch does not exist locally")
-		if err = rc.repo.CreateOrphanedBranch(rc.request.TargetBranch); err != nil {
-			return fmt.Errorf("error creating new target branch: %w", err)
+		if err = rc.repo.CreateOrphanedBranch(ctx, rc.request.TargetBranch); err != nil {
+			return false, fmt.Errorf("error creating new target branch: %w", err)
 		}
 		logger.Debug("created target branch locally")
 	}
 
-	if rc.request.LocalOutPath != "" {
-		return nil // There's no need to push the new branch to the remote
+	if !rc.request.writesToRemote() {
+		return false, nil // There's no need to push the new branch to the remote
+	}
+	if !localTargetBranchExists && skipsInitialCommit(rc) {
+		logger.Debug("skipped initial commit to new target branch")
+		return true, nil
 	}
 
 	if err = rc.repo.Commit(
+		ctx,
 		"Initial commit",
 		&git.CommitOptions{
 			AllowEmpty: true,
 		},
 	); err != nil {
-		return fmt.Errorf("error making initial commit to new target branch: %w", err)
+		return false, fmt.Errorf("error making initial commit to new target branch: %w", err)
 	}
 	logger.Debug("made initial commit to new target branch")
-	if err = rc.repo.Push(); err != nil {
-		return fmt.Errorf("error pushing new target branch to remote: %w", err)
+	if rc.plan != nil {
+		return false, nil // Nothing is pushed to the remote when planning
+	}
+	if err = rc.repo.Push(ctx); err != nil {
+		return false, fmt.Errorf("error pushing new target branch to remote: %w", err)
 	}
 	logger.Debug("pushed new target branch to remote")
 
-	return nil
+	return false, nil
 }
 
-func switchToCommitBranch(rc requestContext) (string, error) {
+// skipsInitialCommit returns true if a new target branch should be left
+// without an initial commit. This is only the case when the request enables
+// the OptionSkipInitialCommit option and the rendered manifests are to be
+// pushed directly to the target branch using git, since a pull request needs
+// an existing branch to target and pushing via the git provider's API needs an
+// existing commit to build upon.
+func skipsInitialCommit(rc requestContext) bool {
+	return rc.request.boolOption(OptionSkipInitialCommit) &&
+		!rc.target.branchConfig.PRs.Enabled &&
+		!rc.request.boolOption(OptionPushViaAPI)
+}
+
+func switchToCommitBranch(
+	ctx context.Context,
+	rc requestContext,
+) (string, error) {
 	logger := rc.logger.WithField("targetBranch", rc.request.TargetBranch)
 
 	var commitBranch string
@@ -155,26 +270,39 @@ func switchToCommitBranch(rc requestContext) (string, error) {
 			"changes will be written directly to the target branch",
 		)
 	} else {
-		if rc.target.branchConfig.PRs.UseUniqueBranchNames {
-			commitBranch = fmt.Sprintf("prs/kargo-render/%s", rc.request.id)
+		if rc.target.commit.reusedPR != nil {
+			commitBranch = rc.target.commit.reusedPR.HeadBranch
 		} else {
-			commitBranch = fmt.Sprintf("prs/kargo-render/%s", rc.request.TargetBranch)
+			commitBranch = commitBranchName(
+				rc,
+				rc.target.branchConfig.PRs.UseUniqueBranchNames,
+				time.Now(),
+			)
 		}
 		logger = logger.WithField("commitBranch", commitBranch)
 		logger.Debug("changes will be PR'ed to the target branch")
-		commitBranchExists, err := rc.repo.RemoteBranchExists(commitBranch)
+		commitBranchExists, err := rc.repo.RemoteBranchExists(ctx, commitBranch)
 		if err != nil {
 			return "",
 				fmt.Errorf("error checking for existence of commit branch: %w", err)
 		}
 		if commitBranchExists {
 			logger.Debug("commit branch exists on remote")
-			if err = rc.repo.Checkout(commitBranch); err != nil {
+			if err = rc.repo.Checkout(ctx, commitBranch); err != nil {
 				return "", fmt.Errorf("error checking out commit branch: %w", err)
 			}
 			logger.Debug("checked out commit branch")
+			if rc.plan != nil {
+				if rc.plan.CommitBranchCommit, err =
+					rc.repo.LastCommitID(ctx); err != nil {
+					return "", fmt.Errorf(
+						"error getting last commit ID from the commit branch: %w",
+						err,
+					)
+				}
+			}
 		} else {
-			if err := rc.repo.CreateChildBranch(commitBranch); err != nil {
+			if err := rc.repo.CreateChildBranch(ctx, commitBranch); err != nil {
 				return "", fmt.Errorf("error creating child of target branch: %w", err)
 			}
 			logger.Debug("created commit branch")
@@ -184,7 +312,8 @@ func switchToCommitBranch(rc requestContext) (string, error) {
 	// Clean the branch so we can replace its contents wholesale
 	if err := cleanCommitBranch(
 		rc.repo.WorkingDir(),
-		rc.target.branchConfig.PreservedPaths,
+		commitBranchPreservedPaths(rc),
+		rc.target.symlinks,
 	); err != nil {
 		return "", fmt.Errorf("error cleaning commit branch: %w", err)
 	}
@@ -193,25 +322,283 @@ func switchToCommitBranch(rc requestContext) (string, error) {
 	return commitBranch, nil
 }
 
+// defaultCommitBranchPrefix is the prefix of the names of the branches PRs are
+// opened from when the target branch's configuration does not specify a
+// template for them.
+const defaultCommitBranchPrefix = "prs/kargo-render/"
+
+// branchNamePlaceholderRegex matches placeholders in a BranchNameTemplate,
+// capturing their names.
+var branchNamePlaceholderRegex = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// branchNamePlaceholders is the set of names of placeholders, other than
+// request variables, that may appear in a BranchNameTemplate.
+var branchNamePlaceholders = map[string]struct{}{
+	"branch":      {},
+	"requestID":   {},
+	"date":        {},
+	"shortCommit": {},
+}
+
+// commitBranchName returns the name of the branch changes to the target branch
+// are committed to so that a PR can be opened from it. If the target branch's
+// configuration specifies a BranchNameTemplate, the name is expanded from it
+// by commitBranchPrefix and then by replacing ${requestID}, ${date}, and
+// ${shortCommit} with the ID of the request, the provided time's date in UTC,
+// formatted as YYYY-MM-DD, and the abbreviated ID of the source commit.
+// Otherwise, the name is defaultCommitBranchPrefix followed by the request ID
+// if the branch is to be unique to the request, or by the name of the target
+// branch if it is not.
+func commitBranchName(rc requestContext, unique bool, now time.Time) string {
+	if rc.target.branchConfig.PRs.BranchNameTemplate == "" {
+		if unique {
+			return defaultCommitBranchPrefix + rc.request.id
+		}
+		return defaultCommitBranchPrefix + rc.request.TargetBranch
+	}
+	shortCommit := rc.source.commit
+	if len(shortCommit) > 7 {
+		shortCommit = shortCommit[:7]
+	}
+	return strings.NewReplacer(
+		"${requestID}", rc.request.id,
+		"${date}", now.UTC().Format(time.DateOnly),
+		"${shortCommit}", shortCommit,
+	).Replace(expandBranchNameTemplate(rc))
+}
+
+// commitBranchPrefix returns the prefix shared by the names of every branch
+// PRs to the target branch are opened from. If the target branch's
+// configuration specifies a BranchNameTemplate, this is the part of the
+// template, with ${branch} placeholders replaced with the name of the target
+// branch, that precedes any placeholder that differs between requests. Otherwise, it is defaultCommitBranchPrefix.
+func commitBranchPrefix(rc requestContext) string {
+	if rc.target.branchConfig.PRs.BranchNameTemplate == "" {
+		return defaultCommitBranchPrefix
+	}
+	prefix := expandBranchNameTemplate(rc)
+	if i := strings.Index(prefix, "${"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return prefix
+}
+
+// expandBranchNameTemplate returns the target branch's BranchNameTemplate with
+// its ${branch} placeholders, which are the same for every request, replaced
+// with the name of the target branch. Its ${var:name} placeholders were already
+// replaced with request variables when the branch's configuration was loaded.
+func expandBranchNameTemplate(rc requestContext) string {
+	return strings.ReplaceAll(
+		rc.target.branchConfig.PRs.BranchNameTemplate,
+		"${branch}",
+		rc.request.TargetBranch,
+	)
+}
+
+// pushToPRBranch creates a new, uniquely named commit branch from the current
+// branch and pushes it to the remote repository so that a PR can be opened
+// from it. This is used when a direct push to the target branch has been
+// rejected. The name of the commit branch is returned.
+func pushToPRBranch(ctx context.Context, rc requestContext) (string, error) {
+	commitBranch := commitBranchName(rc, true, time.Now())
+	if err := rc.repo.CreateChildBranch(ctx, commitBranch); err != nil {
+		return "", fmt.Errorf("error creating commit branch: %w", err)
+	}
+	if err := rc.repo.Push(ctx); err != nil {
+		return "", fmt.Errorf("error pushing commit branch to remote: %w", err)
+	}
+	return commitBranch, nil
+}
+
+// commitBranchPreservedPaths returns the paths that should be exempted from
+// cleaning of the commit branch. The changelog, if any, accumulates across
+// renders, so it is preserved along with any paths the branch's configuration
+// says to preserve, says are owned by other tools, or says are to be merged.
+func commitBranchPreservedPaths(rc requestContext) []string {
+	preservedPaths := append(
+		[]string{},
+		rc.target.branchConfig.PreservedPaths...,
+	)
+	preservedPaths =
+		append(preservedPaths, rc.target.branchConfig.ExternalPaths...)
+	for _, mergedFile := range rc.target.branchConfig.MergedFiles {
+		preservedPaths = append(preservedPaths, mergedFile.Path)
+	}
+	if cfg := rc.target.branchConfig.Changelog; cfg != nil {
+		preservedPaths = append(preservedPaths, cfg.path())
+	}
+	return preservedPaths
+}
+
+// checkPreservedPaths returns, in the order they are configured, the paths the
+// target branch's configuration says to preserve that do not exist in the
+// specified directory. Cleaning proceeds regardless, so such a path, having
+// been renamed or deleted manually, protects nothing. If the branch's
+// configuration says to fail when there are missing paths, a
+// MissingPreservedPathsError is returned instead.
+func checkPreservedPaths(rc requestContext, dir string) ([]string, error) {
+	var missing []string
+	for _, path := range rc.target.branchConfig.PreservedPaths {
+		_, err := os.Lstat(filepath.Join(dir, path))
+		if os.IsNotExist(err) {
+			missing = append(missing, path)
+		} else if err != nil {
+			return nil, fmt.Errorf("error checking preserved path %q: %w", path, err)
+		}
+	}
+	if len(missing) > 0 &&
+		rc.target.branchConfig.OnMissingPreservedPaths == violationActionFail {
+		return nil, &MissingPreservedPathsError{
+			TargetBranch: rc.request.TargetBranch,
+			Paths:        missing,
+		}
+	}
+	return missing, nil
+}
+
 // cleanCommitBranch deletes the entire contents of the specified directory
-// EXCEPT for the paths specified by preservedPaths.
-func cleanCommitBranch(dir string, preservedPaths []string) error {
-	_, err := cleanDir(
+// EXCEPT for the paths specified by preservedPaths and any paths matched by the
+// branch's ignore file. Symbolic links are removed without anything they point
+// to being touched, unless the provided policy rejects them, in which case a
+// *SymlinkError is returned and nothing is deleted.
+func cleanCommitBranch(
+	dir string,
+	preservedPaths []string,
+	policy symlinkPolicy,
+) error {
+	if policy == symlinkPolicyReject {
+		if err := checkSymlinks(dir, policy); err != nil {
+			return err
+		}
+	}
+	ignore, err := loadIgnoreRules(dir)
+	if err != nil {
+		return fmt.Errorf("error loading %s: %w", ignoreFilePath, err)
+	}
+	_, err = cleanDir(
 		dir,
 		normalizePreservedPaths(
 			dir,
 			append(preservedPaths, ".git", ".kargo-render"),
 		),
+		ignore,
 	)
 	return err
 }
 
+// listCleanablePaths returns, in order, the paths, relative to the specified
+// directory, of every file that cleanCommitBranch would delete from it, given
+// the same preservedPaths. Nothing is deleted.
+func listCleanablePaths(dir string, preservedPaths []string) ([]string, error) {
+	ignore, err := loadIgnoreRules(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", ignoreFilePath, err)
+	}
+	preservedPaths = normalizePreservedPaths(
+		dir,
+		append(preservedPaths, ".git", ".kargo-render"),
+	)
+	var paths []string
+	err = filepath.WalkDir(
+		dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir {
+				return nil
+			}
+			if isPathPreserved(path, preservedPaths) ||
+				ignore.matches(path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.IsDir() {
+				relPath, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				paths = append(paths, relPath)
+			}
+			return nil
+		},
+	)
+	return paths, err
+}
+
+// pruneOrphanedApps deletes, from the specified directory, the output of every
+// app recorded in oldMetadata whose output path is no longer owned by any app
+// recorded in newMetadata. Orphaned output is deleted even if it lies within a
+// preserved path, since it was written by Kargo Render and not maintained
+// manually, but an ExternalPathCollisionError is returned if it overlaps any
+// of the specified external paths. Details of every pruned app are returned, sorted by app name.
+func pruneOrphanedApps(
+	dir string,
+	oldMetadata branchMetadata,
+	newMetadata branchMetadata,
+	externalPaths []string,
+) ([]PrunedApp, error) {
+	ownedPaths := make(map[string]struct{}, len(newMetadata.AppOutputPaths))
+	for _, path := range newMetadata.AppOutputPaths {
+		ownedPaths[filepath.Clean(path)] = struct{}{}
+	}
+	var prunedApps []PrunedApp
+	for appName, path := range oldMetadata.AppOutputPaths {
+		path = filepath.Clean(path)
+		if _, ok := ownedPaths[path]; ok {
+			continue
+		}
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf(
+				"output path %q for app %q is not a local path; refusing to prune it",
+				path,
+				appName,
+			)
+		}
+		if err := checkExternalPaths(appName, path, externalPaths); err != nil {
+			return nil, err
+		}
+		if err := os.RemoveAll(filepath.Join(dir, path)); err != nil {
+			return nil, fmt.Errorf(
+				"error pruning output path %q for app %q: %w",
+				path,
+				appName,
+				err,
+			)
+		}
+		prunedApps = append(prunedApps, PrunedApp{App: appName, Path: path})
+	}
+	sort.Slice(prunedApps, func(i, j int) bool {
+		return prunedApps[i].App < prunedApps[j].App
+	})
+	return prunedApps, nil
+}
+
 // copyBranchContents copies the entire contents of the source directory to the
-// destination directory, except for .git.
-func copyBranchContents(srcDir, dstDir string) error {
-	// nolint: gosec
+// destination directory, except for .git. Symbolic links are copied as links
+// or as what they point to, or refused, according to the provided policy. The
+// copy command is recorded by the provided commandTrace, if it is non-nil.
+func copyBranchContents(
+	ctx context.Context,
+	srcDir string,
+	dstDir string,
+	policy symlinkPolicy,
+	trace *commandTrace,
+) error {
+	if err := checkSymlinks(srcDir, policy); err != nil {
+		return err
+	}
+	derefFlag := "-P"
+	if policy == symlinkPolicyFollow {
+		derefFlag = "-L"
+	}
+	cmd := exec.Command("cp", "-R", derefFlag, srcDir, dstDir) // nolint: gosec
 	if _, err := libExec.Exec(
-		exec.Command("cp", "-r", srcDir, dstDir),
+		ctx,
+		cmd,
+		&libExec.Options{Observer: trace.observeResult},
 	); err != nil {
 		return err
 	}
@@ -237,21 +624,27 @@ func normalizePreservedPaths(
 
 // cleanDir recursively deletes the entire contents of the directory specified
 // by the absolute path dir EXCEPT for any paths specified by the preservedPaths
-// argument. The function returns true if dir is left empty afterwards and false
-// otherwise.
-func cleanDir(dir string, preservedPaths []string) (bool, error) {
+// argument or matched by the ignore argument, which may be nil. Symbolic links
+// are removed without anything they point to being touched. The function
+// returns true if dir is left empty afterwards and false otherwise.
+func cleanDir(
+	dir string,
+	preservedPaths []string,
+	ignore *ignoreRules,
+) (bool, error) {
 	items, err := os.ReadDir(dir)
 	if err != nil {
 		return false, err
 	}
 	for _, item := range items {
 		path := filepath.Join(dir, item.Name())
-		if isPathPreserved(path, preservedPaths) {
+		if isPathPreserved(path, preservedPaths) ||
+			ignore.matches(path, item.IsDir()) {
 			continue
 		}
 		if item.IsDir() {
 			var isEmpty bool
-			if isEmpty, err = cleanDir(path, preservedPaths); err != nil {
+			if isEmpty, err = cleanDir(path, preservedPaths, ignore); err != nil {
 				return false, err
 			}
 			if isEmpty {
@@ -280,3 +673,61 @@ func isPathPreserved(path string, preservedPaths []string) bool {
 	}
 	return false
 }
+
+// checkExternalPaths returns an ExternalPathCollisionError if the specified
+// output path of the named app overlaps any of the specified external paths.
+func checkExternalPaths(
+	appName string,
+	outputPath string,
+	externalPaths []string,
+) error {
+	for _, externalPath := range externalPaths {
+		if pathsOverlap(outputPath, externalPath) {
+			return &ExternalPathCollisionError{
+				App:          appName,
+				OutputPath:   outputPath,
+				ExternalPath: externalPath,
+			}
+		}
+	}
+	return nil
+}
+
+// checkAppOutputPaths returns an ExternalPathCollisionError if the output path
+// of any app in the provided branch configuration overlaps any external path
+// specified by the configuration. Apps are checked in order by name so that
+// the result is deterministic.
+func checkAppOutputPaths(cfg branchConfig) error {
+	if len(cfg.ExternalPaths) == 0 {
+		return nil
+	}
+	appNames := make([]string, 0, len(cfg.AppConfigs))
+	for appName := range cfg.AppConfigs {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		if err := checkExternalPaths(
+			appName,
+			appOutputPath(appName, cfg.AppConfigs[appName]),
+			cfg.ExternalPaths,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathsOverlap returns a bool indicating whether the specified paths, relative
+// to the same directory, are the same path or one contains the other.
+func pathsOverlap(path1, path2 string) bool {
+	path1 = filepath.Clean(path1)
+	path2 = filepath.Clean(path2)
+	if path1 == "." || path2 == "." {
+		return true
+	}
+	sep := string(os.PathSeparator)
+	return path1 == path2 ||
+		strings.HasPrefix(path1, path2+sep) ||
+		strings.HasPrefix(path2, path1+sep)
+}
@@ -1,14 +1,17 @@
 package render
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/akuity/kargo-render/internal/file"
+	"github.com/akuity/kargo-render/pkg/git"
 )
 
 func TestLoadBranchMetadata(t *testing.T) {
@@ -90,6 +93,54 @@ func TestWriteBranchMetadata(t *testing.T) {
 	require.True(t, exists)
 }
 
+func TestBranchIsEmpty(t *testing.T) {
+	testCases := []struct {
+		name  string
+		paths []string
+		empty bool
+	}{
+		{
+			name:  "empty",
+			empty: true,
+		},
+		{
+			name:  ".git only",
+			paths: []string{".git/HEAD"},
+			empty: true,
+		},
+		{
+			name:  "metadata only",
+			paths: []string{".git/HEAD", ".kargo-render/metadata.yaml"},
+		},
+		{
+			name:  "single file without .git",
+			paths: []string{"README.md"},
+		},
+		{
+			name:  "populated",
+			paths: []string{".git/HEAD", "README.md", "env/dev/manifests.yaml"},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, path := range testCase.paths {
+				path = filepath.Join(dir, path)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, nil, 0600))
+			}
+			empty, err := branchIsEmpty(dir)
+			require.NoError(t, err)
+			require.Equal(t, testCase.empty, empty)
+		})
+	}
+
+	// A working tree that doesn't exist yet is empty
+	empty, err := branchIsEmpty(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.True(t, empty)
+}
+
 func TestCleanCommitBranch(t *testing.T) {
 	const subdirCount = 50
 	const fileCount = 50
@@ -101,7 +152,7 @@ func TestCleanCommitBranch(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, dirEntries, subdirCount+fileCount+2)
 	// Delete
-	err = cleanCommitBranch(dir, []string{})
+	err = cleanCommitBranch(dir, []string{}, symlinkPolicyPreserve)
 	require.NoError(t, err)
 	// .git should not have been deleted
 	_, err = os.Stat(filepath.Join(dir, ".git"))
@@ -115,6 +166,215 @@ func TestCleanCommitBranch(t *testing.T) {
 	require.Len(t, dirEntries, 2)
 }
 
+func TestCleanCommitBranchWithIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		".kargo-render/ignore",
+		"docs/README.md",
+		"apps/foo/deployment.yaml",
+		"apps/foo/NOTES.md",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), nil, 0600))
+	}
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(dir, ignoreFilePath),
+			[]byte("docs/\n*.md\n"),
+			0600,
+		),
+	)
+	require.NoError(t, cleanCommitBranch(dir, nil, symlinkPolicyPreserve))
+	for _, path := range []string{"docs/README.md", "apps/foo/NOTES.md"} {
+		_, err := os.Stat(filepath.Join(dir, path))
+		require.NoError(t, err)
+	}
+	_, err := os.Stat(filepath.Join(dir, "apps/foo/deployment.yaml"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestListCleanablePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		".git/config",
+		".kargo-render/ignore",
+		"CODEOWNERS",
+		"docs/README.md",
+		"apps/foo/deployment.yaml",
+		"apps/foo/NOTES.md",
+		"apps/bar/service.yaml",
+		"kustomization.yaml",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), nil, 0600))
+	}
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, ignoreFilePath), []byte("docs/\n*.md\n"), 0600),
+	)
+	preservedPaths := []string{"CODEOWNERS", "apps/bar/"}
+	paths, err := listCleanablePaths(dir, preservedPaths)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]string{"apps/foo/deployment.yaml", "kustomization.yaml"},
+		paths,
+	)
+	// Nothing was deleted, and cleaning deletes exactly what was listed
+	for _, path := range paths {
+		_, err = os.Stat(filepath.Join(dir, path))
+		require.NoError(t, err)
+	}
+	require.NoError(t, cleanCommitBranch(dir, preservedPaths, symlinkPolicyPreserve))
+	for _, path := range paths {
+		_, err = os.Stat(filepath.Join(dir, path))
+		require.True(t, os.IsNotExist(err))
+	}
+	paths, err = listCleanablePaths(dir, preservedPaths)
+	require.NoError(t, err)
+	require.Empty(t, paths)
+}
+
+func TestCheckPreservedPaths(t *testing.T) {
+	testCases := []struct {
+		name       string
+		onMissing  string
+		assertions func(t *testing.T, missing []string, err error)
+	}{
+		{
+			name: "warn by default",
+			assertions: func(t *testing.T, missing []string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []string{"OWNERS", "docs/"}, missing)
+			},
+		},
+		{
+			name:      "fail",
+			onMissing: violationActionFail,
+			assertions: func(t *testing.T, _ []string, err error) {
+				var missingErr *MissingPreservedPathsError
+				require.ErrorAs(t, err, &missingErr)
+				require.Equal(t, "env/prod", missingErr.TargetBranch)
+				require.Equal(t, []string{"OWNERS", "docs/"}, missingErr.Paths)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "config"), 0755))
+			require.NoError(
+				t,
+				os.WriteFile(filepath.Join(dir, "CODEOWNERS"), nil, 0600),
+			)
+			rc := requestContext{
+				request: &Request{TargetBranch: "env/prod"},
+			}
+			rc.target.branchConfig = branchConfig{
+				PreservedPaths:          []string{"CODEOWNERS", "OWNERS", "config/", "docs/"},
+				OnMissingPreservedPaths: testCase.onMissing,
+			}
+			missing, err := checkPreservedPaths(rc, dir)
+			testCase.assertions(t, missing, err)
+		})
+	}
+}
+
+func TestPruneOrphanedApps(t *testing.T) {
+	testCases := []struct {
+		name          string
+		oldMetadata   branchMetadata
+		newMetadata   branchMetadata
+		externalPaths []string
+		assertions    func(t *testing.T, dir string, prunedApps []PrunedApp, err error)
+	}{
+		{
+			name: "non-local output path",
+			oldMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{"foo": "../foo"},
+			},
+			assertions: func(t *testing.T, _ string, _ []PrunedApp, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "refusing to prune")
+			},
+		},
+		{
+			name: "no orphaned apps",
+			oldMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{"foo": "foo"},
+			},
+			newMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{"foo": "foo/"},
+			},
+			assertions: func(t *testing.T, dir string, prunedApps []PrunedApp, err error) {
+				require.NoError(t, err)
+				require.Empty(t, prunedApps)
+				require.DirExists(t, filepath.Join(dir, "foo"))
+			},
+		},
+		{
+			name: "orphaned apps",
+			oldMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{
+					"foo": "foo",
+					"bar": "bar",
+					"baz": "baz",
+				},
+			},
+			newMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{
+					"foo": "foo",
+					"baz": "apps/baz",
+				},
+			},
+			assertions: func(t *testing.T, dir string, prunedApps []PrunedApp, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]PrunedApp{
+						{App: "bar", Path: "bar"},
+						{App: "baz", Path: "baz"},
+					},
+					prunedApps,
+				)
+				require.DirExists(t, filepath.Join(dir, "foo"))
+				require.NoDirExists(t, filepath.Join(dir, "bar"))
+				require.NoDirExists(t, filepath.Join(dir, "baz"))
+			},
+		},
+		{
+			name: "orphaned app overlapping external path",
+			oldMetadata: branchMetadata{
+				AppOutputPaths: map[string]string{"bar": "bar"},
+			},
+			externalPaths: []string{"bar/flux"},
+			assertions: func(t *testing.T, dir string, _ []PrunedApp, err error) {
+				var collisionErr *ExternalPathCollisionError
+				require.ErrorAs(t, err, &collisionErr)
+				require.Equal(t, "bar", collisionErr.App)
+				require.Equal(t, "bar/flux", collisionErr.ExternalPath)
+				require.DirExists(t, filepath.Join(dir, "bar"))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, app := range []string{"foo", "bar", "baz"} {
+				require.NoError(t, os.MkdirAll(filepath.Join(dir, app), 0755))
+			}
+			prunedApps, err := pruneOrphanedApps(
+				dir,
+				testCase.oldMetadata,
+				testCase.newMetadata,
+				testCase.externalPaths,
+			)
+			testCase.assertions(t, dir, prunedApps, err)
+		})
+	}
+}
+
 func TestCopyBranchContents(t *testing.T) {
 	const subdirCount = 50
 	const fileCount = 50
@@ -127,7 +387,13 @@ func TestCopyBranchContents(t *testing.T) {
 	require.Len(t, dirEntries, subdirCount+fileCount+2)
 	dstDir := filepath.Join(t.TempDir(), "dst")
 	// Copy
-	err = copyBranchContents(srcDir, dstDir)
+	err = copyBranchContents(
+		context.Background(),
+		srcDir,
+		dstDir,
+		symlinkPolicyPreserve,
+		nil,
+	)
 	require.NoError(t, err)
 	// .git should not have been included
 	_, err = os.Stat(filepath.Join(dstDir, ".git"))
@@ -201,7 +467,7 @@ func TestCleanDir(t *testing.T) {
 		keepFile,
 	}
 
-	isEmpty, err := cleanDir(dir, preservedPaths)
+	isEmpty, err := cleanDir(dir, preservedPaths, nil)
 	require.NoError(t, err)
 	require.False(t, isEmpty)
 
@@ -270,3 +536,152 @@ func createDummyCommitBranchDir(t *testing.T, dirCount, fileCount int) (string,
 	}
 	return dir, nil
 }
+
+func TestCheckAppOutputPaths(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cfg        branchConfig
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "no external paths",
+			cfg: branchConfig{
+				AppConfigs: map[string]appConfig{"foo": {}},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "no collisions",
+			cfg: branchConfig{
+				AppConfigs: map[string]appConfig{
+					"foo": {},
+					"bar": {OutputPath: "apps/bar"},
+				},
+				ExternalPaths: []string{"flux", "apps/barbaz", "foobar"},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "external path within output path",
+			cfg: branchConfig{
+				AppConfigs: map[string]appConfig{
+					"foo": {OutputPath: "apps"},
+				},
+				ExternalPaths: []string{"apps/flux/"},
+			},
+			assertions: func(t *testing.T, err error) {
+				var collisionErr *ExternalPathCollisionError
+				require.ErrorAs(t, err, &collisionErr)
+				require.Equal(t, "foo", collisionErr.App)
+				require.Equal(t, "apps", collisionErr.OutputPath)
+			},
+		},
+		{
+			name: "output path within external path",
+			cfg: branchConfig{
+				AppConfigs: map[string]appConfig{
+					"foo": {OutputPath: "docs/foo"},
+				},
+				ExternalPaths: []string{"docs"},
+			},
+			assertions: func(t *testing.T, err error) {
+				var collisionErr *ExternalPathCollisionError
+				require.ErrorAs(t, err, &collisionErr)
+				require.Equal(t, "docs", collisionErr.ExternalPath)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.assertions(t, checkAppOutputPaths(testCase.cfg))
+		})
+	}
+}
+
+// fakeBranchingRepo is a git.Repo that records the branches created in it and
+// pushed from it.
+type fakeBranchingRepo struct {
+	git.Repo
+	currentBranch string
+	pushed        []string
+}
+
+func (f *fakeBranchingRepo) CreateChildBranch(_ context.Context, branch string) error {
+	f.currentBranch = branch
+	return nil
+}
+
+func (f *fakeBranchingRepo) Push(context.Context) error {
+	f.pushed = append(f.pushed, f.currentBranch)
+	return nil
+}
+
+func TestPushToPRBranch(t *testing.T) {
+	repo := &fakeBranchingRepo{currentBranch: "env/prod"}
+	rc := requestContext{
+		request: &Request{id: "abc"},
+		repo:    repo,
+	}
+	commitBranch, err := pushToPRBranch(context.Background(), rc)
+	require.NoError(t, err)
+	require.Equal(t, "prs/kargo-render/abc", commitBranch)
+	require.Equal(t, []string{"prs/kargo-render/abc"}, repo.pushed)
+}
+
+func TestCommitBranchName(t *testing.T) {
+	now := time.Date(2026, 3, 14, 23, 30, 0, 0, time.FixedZone("", -5*60*60))
+	testCases := []struct {
+		name           string
+		template       string
+		unique         bool
+		expectedName   string
+		expectedPrefix string
+	}{
+		{
+			name:           "default",
+			expectedName:   "prs/kargo-render/env/prod",
+			expectedPrefix: "prs/kargo-render/",
+		},
+		{
+			name:           "default unique",
+			unique:         true,
+			expectedName:   "prs/kargo-render/abc",
+			expectedPrefix: "prs/kargo-render/",
+		},
+		{
+			name:           "template",
+			template:       "platform/deploy/${branch}",
+			expectedName:   "platform/deploy/env/prod",
+			expectedPrefix: "platform/deploy/env/prod",
+		},
+		{
+			name:           "unique template",
+			template:       "platform/${branch}/${date}-${shortCommit}-${requestID}",
+			unique:         true,
+			expectedName:   "platform/env/prod/2026-03-15-0123456-abc",
+			expectedPrefix: "platform/env/prod/",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				request: &Request{
+					id:           "abc",
+					TargetBranch: "env/prod",
+				},
+			}
+			rc.source.commit = testCommitID
+			rc.target.branchConfig.PRs.BranchNameTemplate = testCase.template
+			require.Equal(
+				t,
+				testCase.expectedName,
+				commitBranchName(rc, testCase.unique, now),
+			)
+			require.Equal(t, testCase.expectedPrefix, commitBranchPrefix(rc))
+		})
+	}
+}
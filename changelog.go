@@ -0,0 +1,135 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// changelogFormatYAML is the format of changelogs maintained in a
+// .kargo-render/changelog.yaml file. Changelogs in any other format are
+// maintained in Markdown.
+const changelogFormatYAML = "yaml"
+
+// changelogHeading is the heading of changelogs maintained in Markdown.
+const changelogHeading = "# Changelog\n"
+
+// changelog is the content of a changelog maintained in YAML.
+type changelog struct {
+	// Entries lists an entry for every commit Kargo Render has made to the
+	// branch, newest first.
+	Entries []changelogEntry `json:"entries"`
+}
+
+// changelogEntry describes a single commit Kargo Render made to an
+// environment-specific branch.
+type changelogEntry struct {
+	// Date is when the commit was made.
+	Date time.Time `json:"date"`
+	// SourceCommit is the ID (sha) of the commit the branch was rendered from.
+	SourceCommit string `json:"sourceCommit"`
+	// Images is a list of new images that were used in rendering the branch.
+	Images []string `json:"images,omitempty"`
+	// PullRequestBranch is the branch from which changes were proposed to the
+	// environment-specific branch by pull request. It is not set if the changes
+	// were committed directly. The pull request's URL is not recorded because
+	// it is not known until after the commit has been pushed.
+	PullRequestBranch string `json:"pullRequestBranch,omitempty"`
+}
+
+// newChangelogEntry returns a changelogEntry describing the commit about to be
+// made on behalf of the provided requestContext.
+func newChangelogEntry(rc requestContext, date time.Time) changelogEntry {
+	entry := changelogEntry{
+		Date:         date.UTC().Truncate(time.Second),
+		SourceCommit: rc.source.commit,
+		Images:       rc.target.newBranchMetadata.ImageSubstitutions,
+	}
+	if rc.target.branchConfig.PRs.Enabled {
+		entry.PullRequestBranch = rc.target.commit.branch
+	}
+	return entry
+}
+
+// updateChangelog adds the provided entry to the top of the changelog, in the
+// specified directory, described by the provided configuration. The changelog
+// is created if it does not already exist.
+func updateChangelog(
+	repoPath string,
+	cfg *changelogConfig,
+	entry changelogEntry,
+) error {
+	path := filepath.Join(repoPath, cfg.path())
+	oldBytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading changelog %q: %w", path, err)
+	}
+	var newBytes []byte
+	if cfg.Format == changelogFormatYAML {
+		if newBytes, err = addYAMLChangelogEntry(oldBytes, entry); err != nil {
+			return err
+		}
+	} else {
+		newBytes = addMarkdownChangelogEntry(oldBytes, entry)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf(
+			"error ensuring existence of directory %q: %w",
+			filepath.Dir(path),
+			err,
+		)
+	}
+	if err = os.WriteFile(path, newBytes, 0644); err != nil { // nolint: gosec
+		return fmt.Errorf("error writing changelog %q: %w", path, err)
+	}
+	return nil
+}
+
+// addYAMLChangelogEntry returns the provided YAML changelog with the provided
+// entry added to the top of it.
+func addYAMLChangelogEntry(
+	oldBytes []byte,
+	entry changelogEntry,
+) ([]byte, error) {
+	cl := changelog{}
+	if err := yaml.Unmarshal(oldBytes, &cl); err != nil {
+		return nil, fmt.Errorf("error unmarshaling changelog: %w", err)
+	}
+	cl.Entries = append([]changelogEntry{entry}, cl.Entries...)
+	newBytes, err := yaml.Marshal(cl)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling changelog: %w", err)
+	}
+	return newBytes, nil
+}
+
+// addMarkdownChangelogEntry returns the provided Markdown changelog with the
+// provided entry added to the top of it, just beneath its heading.
+func addMarkdownChangelogEntry(oldBytes []byte, entry changelogEntry) []byte {
+	sb := &strings.Builder{}
+	sb.WriteString(changelogHeading)
+	fmt.Fprintf(sb, "\n## %s\n\n", entry.Date.Format(time.RFC3339))
+	fmt.Fprintf(sb, "* Source commit: %s\n", entry.SourceCommit)
+	if len(entry.Images) > 0 {
+		sb.WriteString("* Images:\n")
+		for _, image := range entry.Images {
+			fmt.Fprintf(sb, "  * %s\n", image)
+		}
+	}
+	if entry.PullRequestBranch != "" {
+		fmt.Fprintf(sb, "* Pull request from branch: %s\n", entry.PullRequestBranch)
+	}
+	oldEntries := strings.TrimLeft(
+		strings.TrimPrefix(string(oldBytes), changelogHeading),
+		"\n",
+	)
+	if oldEntries != "" {
+		sb.WriteString("\n")
+		sb.WriteString(oldEntries)
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestUpdateChangelog(t *testing.T) {
+	firstEntry := changelogEntry{
+		Date:         time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SourceCommit: "abc",
+		Images:       []string{"nginx:1.25"},
+	}
+	secondEntry := changelogEntry{
+		Date:              time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		SourceCommit:      "def",
+		PullRequestBranch: "prs/kargo-render/env/dev",
+	}
+	testCases := []struct {
+		name       string
+		cfg        *changelogConfig
+		assertions func(*testing.T, string)
+	}{
+		{
+			name: "markdown",
+			cfg:  &changelogConfig{},
+			assertions: func(t *testing.T, repoDir string) {
+				changelogBytes, err :=
+					os.ReadFile(filepath.Join(repoDir, "CHANGELOG.md"))
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					`# Changelog
+
+## 2024-01-02T00:00:00Z
+
+* Source commit: def
+* Pull request from branch: prs/kargo-render/env/dev
+
+## 2024-01-01T00:00:00Z
+
+* Source commit: abc
+* Images:
+  * nginx:1.25
+`,
+					string(changelogBytes),
+				)
+			},
+		},
+		{
+			name: "yaml",
+			cfg:  &changelogConfig{Format: changelogFormatYAML},
+			assertions: func(t *testing.T, repoDir string) {
+				changelogBytes, err := os.ReadFile(
+					filepath.Join(repoDir, ".kargo-render", "changelog.yaml"),
+				)
+				require.NoError(t, err)
+				cl := changelog{}
+				err = yaml.Unmarshal(changelogBytes, &cl)
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]changelogEntry{secondEntry, firstEntry},
+					cl.Entries,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repoDir := t.TempDir()
+			err := updateChangelog(repoDir, testCase.cfg, firstEntry)
+			require.NoError(t, err)
+			err = updateChangelog(repoDir, testCase.cfg, secondEntry)
+			require.NoError(t, err)
+			testCase.assertions(t, repoDir)
+		})
+	}
+}
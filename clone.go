@@ -0,0 +1,95 @@
+package render
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// CloneStrategy determines how much of the history and content of a remote
+// repository is fetched when a Service clones it.
+type CloneStrategy string
+
+const (
+	// CloneStrategyFull fetches the entire history and content of the remote
+	// repository. This is the default.
+	CloneStrategyFull CloneStrategy = "full"
+	// CloneStrategyShallow fetches only the most recent commit of each branch.
+	// This transfers the least, but requests that specify a Ref other than the
+	// tip of a branch cannot be handled, and anything that examines history,
+	// such as SourceHistory, promotion order, and member commits, sees only
+	// the most recent commits.
+	CloneStrategyShallow CloneStrategy = "shallow"
+	// CloneStrategyPartial fetches the entire history of the remote
+	// repository, but defers fetching the content excluded by the Service's
+	// CloneFilter until it is needed. Since Kargo Render reads little besides
+	// the source commit and the target branch, this transfers far less than a
+	// full clone of a large repository with a long history. Remote
+	// repositories that do not support partial clones are cloned in full
+	// instead.
+	CloneStrategyPartial CloneStrategy = "partial"
+	// CloneStrategyAuto picks a strategy for each repository. Repositories
+	// with a mirror in the Service's clone cache, from which objects are
+	// copied rather than fetched, are cloned in full. Other repositories are
+	// cloned in full until a full clone of them is found to exceed the
+	// Service's PartialCloneThreshold, after which they are cloned partially.
+	CloneStrategyAuto CloneStrategy = "auto"
+)
+
+// defaultPartialCloneThreshold is the size, in bytes, of the objects of a
+// repository above which CloneStrategyAuto clones it partially, if the
+// Service's options do not specify otherwise.
+const defaultPartialCloneThreshold int64 = 256 << 20
+
+// cloneStrategy returns the strategy the service should use to clone the
+// specified remote repository. This is never CloneStrategyAuto.
+func (s *service) cloneStrategy(repoURL string) CloneStrategy {
+	switch s.cloneStrategyOpt {
+	case "":
+		return CloneStrategyFull
+	case CloneStrategyAuto:
+		if mirrorDir := s.mirrorDir(repoURL); mirrorDir != "" {
+			if _, err := os.Stat(mirrorDir); err == nil {
+				return CloneStrategyFull
+			}
+		}
+		if size, ok := s.repoSizes.Load(repoURL); ok {
+			if bytes, ok := size.(int64); ok && bytes > s.partialCloneThreshold {
+				return CloneStrategyPartial
+			}
+		}
+		return CloneStrategyFull
+	default:
+		return s.cloneStrategyOpt
+	}
+}
+
+// cloneStats returns statistics describing the provided clone of the
+// specified remote repository, which was made using the specified strategy.
+// The size of full clones is remembered so that CloneStrategyAuto can pick a
+// strategy for later clones of the same repository. Since the statistics are
+// only informational, any error determining them is logged rather than
+// returned.
+func (s *service) cloneStats(
+	ctx context.Context,
+	logger *log.Entry,
+	repo git.Repo,
+	repoURL string,
+	strategy CloneStrategy,
+) *CloneStats {
+	objectBytes, err := repo.ObjectBytes(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("error determining size of clone")
+		return nil
+	}
+	if strategy == CloneStrategyFull {
+		s.repoSizes.Store(repoURL, objectBytes)
+	}
+	return &CloneStats{
+		Strategy:    strategy,
+		ObjectBytes: objectBytes,
+	}
+}
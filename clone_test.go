@@ -0,0 +1,87 @@
+package render
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneStrategy(t *testing.T) {
+	const testRepoURL = "https://github.com/akuity/foobar"
+	testCases := []struct {
+		name     string
+		svc      func(t *testing.T) *service
+		expected CloneStrategy
+	}{
+		{
+			name:     "no strategy specified",
+			svc:      func(*testing.T) *service { return &service{} },
+			expected: CloneStrategyFull,
+		},
+		{
+			name: "strategy specified",
+			svc: func(*testing.T) *service {
+				return &service{cloneStrategyOpt: CloneStrategyShallow}
+			},
+			expected: CloneStrategyShallow,
+		},
+		{
+			name: "auto with repo of unknown size",
+			svc: func(*testing.T) *service {
+				return &service{
+					cloneStrategyOpt:      CloneStrategyAuto,
+					partialCloneThreshold: 1024,
+				}
+			},
+			expected: CloneStrategyFull,
+		},
+		{
+			name: "auto with small repo",
+			svc: func(*testing.T) *service {
+				s := &service{
+					cloneStrategyOpt:      CloneStrategyAuto,
+					partialCloneThreshold: 1024,
+				}
+				s.repoSizes.Store(testRepoURL, int64(512))
+				return s
+			},
+			expected: CloneStrategyFull,
+		},
+		{
+			name: "auto with large repo",
+			svc: func(*testing.T) *service {
+				s := &service{
+					cloneStrategyOpt:      CloneStrategyAuto,
+					partialCloneThreshold: 1024,
+				}
+				s.repoSizes.Store(testRepoURL, int64(2048))
+				return s
+			},
+			expected: CloneStrategyPartial,
+		},
+		{
+			name: "auto with large repo mirrored in clone cache",
+			svc: func(t *testing.T) *service {
+				s := &service{
+					cloneStrategyOpt:      CloneStrategyAuto,
+					partialCloneThreshold: 1024,
+					cloneCacheDir:         t.TempDir(),
+				}
+				s.repoSizes.Store(testRepoURL, int64(2048))
+				require.NoError(t, os.Mkdir(s.mirrorDir(testRepoURL), 0700))
+				return s
+			},
+			expected: CloneStrategyFull,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(
+				t,
+				testCase.expected,
+				testCase.svc(t).cloneStrategy(testRepoURL),
+			)
+		})
+	}
+}
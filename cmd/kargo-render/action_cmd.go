@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 
 	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/internal/github"
 	libLog "github.com/akuity/kargo-render/internal/log"
-	libOS "github.com/akuity/kargo-render/internal/os"
-	"github.com/akuity/kargo-render/internal/version"
+	"github.com/akuity/kargo-render/pkg/git"
 )
 
 type actionOptions struct {
@@ -37,31 +45,198 @@ func newActionCommand() *cobra.Command {
 func (o *actionOptions) run(_ context.Context, out io.Writer) error {
 	logger := o.logger
 
-	ver := version.GetVersion()
+	ver := getVersionInfo()
 	logger.WithFields(log.Fields{
-		"version": ver.Version,
-		"commit":  ver.GitCommit,
+		"version":   ver.Version.Version,
+		"commit":    ver.GitCommit,
+		"git":       ver.GitVersion,
+		"helm":      ver.HelmVersion,
+		"kustomize": ver.KustomizeVersion,
+		"ytt":       ver.YttVersion,
+		"argocd":    ver.ArgoCDVersion,
 	}).Info("Starting Kargo Render Action")
 
-	req, err := request()
-	if err != nil {
+	in := &actionInputs{}
+	reqs := requests(in)
+	svcOpts := serviceOptions(in, render.LogLevel(logger.Level))
+	forceRender := in.getBool("forceRender", false)
+	if err := in.err(); err != nil {
+		var problems actionInputProblems
+		if errors.As(err, &problems) {
+			problems.writeAnnotations(out)
+		}
 		logger.Fatal(err)
 	}
+	if len(reqs) == 0 {
+		fmt.Fprintln(
+			out,
+			"\nNo target branches are mapped to the current branch. No action was "+
+				"taken.",
+		)
+		return nil
+	}
 
-	res, err := render.NewService(
-		&render.ServiceOptions{
-			LogLevel: render.LogLevel(logger.Level),
-		},
-	).RenderManifests(context.Background(), req)
-	if err != nil {
+	// Inputs, which may include tokens, are passed to the action using
+	// environment variables, so every variable the tools it runs mustn't
+	// inherit is removed. This one is needed afterward.
+	outputPath := os.Getenv("GITHUB_OUTPUT")
+	if err := render.RestrictProcessEnv(svcOpts.ToolEnv); err != nil {
+		logger.WithError(err).Warn("error restricting process environment")
+	}
+	prepareHost(logger)
+	svc := render.NewService(svcOpts)
+	results := make([]actionResult, len(reqs))
+	var errs []error
+	for i, req := range reqs {
+		results[i].TargetBranch = req.TargetBranch
+		start := time.Now()
+		if !forceRender && req.LocalInPath == "" {
+			// A re-run of the same workflow needn't clone and render again
+			reflected, err := branchReflectsRequest(context.Background(), req)
+			if err != nil {
+				logger.WithError(err).WithField("targetBranch", req.TargetBranch).
+					Warn("error checking whether the target branch reflects the " +
+						"source commit; rendering it anyway")
+			} else if reflected {
+				results[i].Response = &render.Response{
+					ActionTaken: render.ActionTakenNone,
+				}
+				results[i].duration = time.Since(start)
+				fmt.Fprintf(
+					out,
+					"\nBranch %s already reflects commit %s. No action was taken.\n",
+					req.TargetBranch,
+					req.Ref,
+				)
+				continue
+			}
+		}
+		res, err := svc.RenderManifests(context.Background(), req)
+		results[i].duration = time.Since(start)
+		if err != nil {
+			err = fmt.Errorf("error rendering branch %s: %w", req.TargetBranch, err)
+			fmt.Fprintf(
+				out,
+				"::error title=Rendering failed::%s\n",
+				escapeAnnotationData(err.Error()),
+			)
+			logger.Error(err)
+			results[i].Error = err.Error()
+			errs = append(errs, err)
+			continue
+		}
+		results[i].Response = &res
+		if err = writeActionOutcome(req, res, out); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// Events are delivered in the background, and failures below end the
+	// process at once
+	if asyncSink, ok := svcOpts.EventSink.(*render.AsyncEventSink); ok {
+		flushEvents(logger, asyncSink)
+	}
+
+	summary := summarize(results)
+	fmt.Fprintln(out)
+	if err := writeSummaryTable(summary, out); err != nil {
 		logger.Fatal(err)
 	}
+	if err := writeActionOutputs(outputPath, results, summary); err != nil {
+		logger.Fatal(err)
+	}
+	if len(errs) > 0 {
+		logger.Fatal(errors.Join(errs...))
+	}
+	return nil
+}
+
+// actionResult is the outcome of rendering a single target branch. The
+// outcomes for all target branches are published as the action's "results"
+// output.
+type actionResult struct {
+	TargetBranch string           `json:"targetBranch"`
+	Response     *render.Response `json:"response,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	// duration is how long handling the target branch took. It is published
+	// as part of the action's "summary" output.
+	duration time.Duration
+}
+
+// targetBranchMetadata is the part of the .kargo-render/metadata.yaml file
+// in a target branch that records what the branch was last rendered from.
+type targetBranchMetadata struct {
+	SourceCommit       string   `json:"sourceCommit,omitempty"`
+	ImageSubstitutions []string `json:"imageSubstitutions,omitempty"`
+}
+
+// branchReflectsRequest returns true if the target branch of the provided
+// request was last rendered from the request's source commit using all of the
+// request's images. This is determined from the branch's metadata, which is
+// retrieved using the GitHub API, so nothing has to be cloned.
+func branchReflectsRequest(
+	ctx context.Context,
+	req *render.Request,
+) (bool, error) {
+	metadata, err := github.GetFileContents(
+		ctx,
+		req.RepoURL,
+		req.TargetBranch,
+		".kargo-render/metadata.yaml",
+		git.RepoCredentials{Password: req.RepoCreds.Password},
+		nil,
+	)
+	if err != nil {
+		return false, err
+	}
+	return metadataReflectsRequest(req, metadata)
+}
 
+// metadataReflectsRequest returns true if the provided target branch metadata,
+// which may be nil, records that the branch was rendered from the provided
+// request's source commit using all of the request's images.
+func metadataReflectsRequest(
+	req *render.Request,
+	metadata []byte,
+) (bool, error) {
+	if metadata == nil || req.Ref == "" {
+		return false, nil
+	}
+	md := targetBranchMetadata{}
+	if err := yaml.Unmarshal(metadata, &md); err != nil {
+		return false, fmt.Errorf("error unmarshaling target branch metadata: %w", err)
+	}
+	if md.SourceCommit != req.Ref {
+		return false, nil
+	}
+	rendered := map[string]struct{}{}
+	for _, image := range md.ImageSubstitutions {
+		rendered[image] = struct{}{}
+	}
+	for _, image := range req.Images {
+		if _, ok := rendered[image]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// writeActionOutcome writes a human-readable description of the outcome of
+// the provided request to the provided io.Writer.
+func writeActionOutcome(
+	req *render.Request,
+	res render.Response,
+	out io.Writer,
+) error {
 	switch res.ActionTaken {
 	case render.ActionTakenNone:
-		fmt.Fprintln(
+		if req.Stdout {
+			return manifestsToStdout(res.Manifests, out, flagStdoutFormatText)
+		}
+		fmt.Fprintf(
 			out,
-			"\nThis request would not change any state. No action was taken.",
+			"\nRendering branch %s would not change any state. No action was taken.\n",
+			req.TargetBranch,
 		)
 	case render.ActionTakenOpenedPR:
 		fmt.Fprintf(
@@ -82,30 +257,263 @@ func (o *actionOptions) run(_ context.Context, out io.Writer) error {
 			"\nUpdated an existing PR to %s\n",
 			req.TargetBranch,
 		)
+	case render.ActionTakenWroteToLocalPath:
+		fmt.Fprintf(
+			out,
+			"\nWrote rendered manifests for branch %s to %s\n",
+			req.TargetBranch,
+			req.LocalOutPath,
+		)
 	}
+	return nil
+}
 
+// writeActionOutputs publishes the provided results and summary as the
+// action's "results" and "summary" outputs to the specified file, if GitHub
+// Actions has provided a file to write outputs to.
+func writeActionOutputs(
+	outputPath string,
+	results []actionResult,
+	summary renderSummary,
+) error {
+	if outputPath == "" {
+		return nil
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error marshaling results: %w", err)
+	}
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error marshaling summary: %w", err)
+	}
+	f, err := os.OpenFile(outputPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", outputPath, err)
+	}
+	defer f.Close()
+	if _, err = fmt.Fprintf(
+		f,
+		"results=%s\nsummary=%s\n",
+		resultsJSON,
+		summaryJSON,
+	); err != nil {
+		return fmt.Errorf("error writing to %s: %w", outputPath, err)
+	}
 	return nil
 }
 
-func request() (*render.Request, error) {
+// requests builds one rendering request for each target branch specified by
+// the inputs of the GitHub Action. Problems with any inputs are recorded by
+// the provided actionInputs.
+func requests(in *actionInputs) []*render.Request {
+	baseReq := request(in)
+	branches := targetBranches(in, baseReq.TargetBranch)
+	reqs := make([]*render.Request, len(branches))
+	for i, branch := range branches {
+		req := *baseReq
+		req.TargetBranch = branch
+		if req.LocalOutPath != "" && len(branches) > 1 {
+			// Give each branch its own output directory
+			req.LocalOutPath = filepath.Join(req.LocalOutPath, branch)
+		}
+		reqs[i] = &req
+	}
+	return reqs
+}
+
+// targetBranchMappingSep separates the source branch from the target branch in
+// a mapping expression in the targetBranch input.
+const targetBranchMappingSep = "->"
+
+// targetBranches parses the value of the targetBranch input, which may be a
+// single branch or a comma-delimited list. Each item in the list is either the
+// name of a target branch or a mapping of the form <source>-><target>, which
+// selects the target branch only when the workflow is running for the source
+// branch.
+func targetBranches(in *actionInputs, value string) []string {
+	if value == "" {
+		return nil
+	}
+	var refName *string
+	var branches []string
+	seen := map[string]struct{}{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			in.invalid("targetBranch", "must not contain any empty items")
+			continue
+		}
+		branch := item
+		if source, target, ok := strings.Cut(item, targetBranchMappingSep); ok {
+			source = strings.TrimSpace(source)
+			target = strings.TrimSpace(target)
+			if source == "" || target == "" {
+				in.invalid(
+					"targetBranch",
+					"contains invalid mapping %q; mappings must be of the form "+
+						"<source>%s<target>",
+					item,
+					targetBranchMappingSep,
+				)
+				continue
+			}
+			if refName == nil {
+				name := in.requiredEnv("GITHUB_REF_NAME")
+				refName = &name
+			}
+			if source != *refName {
+				continue
+			}
+			branch = target
+		}
+		if _, ok := seen[branch]; ok {
+			continue
+		}
+		seen[branch] = struct{}{}
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+// request builds a rendering request from the inputs of the GitHub Action.
+// Problems with any inputs are recorded by the provided actionInputs.
+func request(in *actionInputs) *render.Request {
+	if in.getBool("localWorkspace", false) {
+		return localWorkspaceRequest(in)
+	}
 	req := &render.Request{
+		RepoURL: fmt.Sprintf("https://github.com/%s", in.requiredEnv("GITHUB_REPOSITORY")),
 		RepoCreds: render.RepoCredentials{
 			Username: "git",
+			Password: in.getRequired("personalAccessToken"),
 		},
-		Images: libOS.GetStringSliceFromEnvVar("INPUT_IMAGES", nil),
+		Ref:                in.requiredEnv("GITHUB_SHA"),
+		TargetBranch:       in.getRequired("targetBranch"),
+		Images:             in.getStringSlice("images"),
+		SkipPromotionOrder: in.getBool("skipPromotionOrder", false),
+		Source:             actionSource(),
 	}
-	repo, err := libOS.GetRequiredEnvVar("GITHUB_REPOSITORY")
-	if err != nil {
-		return nil, err
+	authorName := in.get("authorName", "")
+	authorEmail := in.get("authorEmail", "")
+	switch {
+	case authorName != "" && authorEmail != "":
+		req.CommitAuthor = &render.CommitAuthor{
+			Name:  authorName,
+			Email: authorEmail,
+		}
+	case authorName != "":
+		in.invalid("authorEmail", "is required when authorName is specified")
+	case authorEmail != "":
+		in.invalid("authorName", "is required when authorEmail is specified")
+	}
+	prOpts := render.PullRequestOptions{
+		TitleTemplate: in.get("prTitleTemplate", ""),
+		BodyTemplate:  in.get("prBodyTemplate", ""),
+		Labels:        in.getStringSlice("prLabels"),
+		Draft:         in.getBool("prDraft", false),
+	}
+	if prOpts.TitleTemplate != "" || prOpts.BodyTemplate != "" ||
+		len(prOpts.Labels) > 0 || prOpts.Draft {
+		req.PullRequest = &prOpts
+	}
+	return req
+}
+
+// actionSource describes the workflow run the action is part of, and the
+// branch or tag it was triggered by, using the default environment variables
+// GitHub Actions sets. If none of them are set, nil is returned.
+func actionSource() *render.SourceContext {
+	src := render.SourceContext{}
+	switch os.Getenv("GITHUB_REF_TYPE") {
+	case "branch":
+		src.Branch = os.Getenv("GITHUB_REF_NAME")
+	case "tag":
+		src.Tag = os.Getenv("GITHUB_REF_NAME")
+	}
+	serverURL := os.Getenv("GITHUB_SERVER_URL")
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	runID := os.Getenv("GITHUB_RUN_ID")
+	if serverURL != "" && repo != "" && runID != "" {
+		src.RunURL = fmt.Sprintf("%s/%s/actions/runs/%s", serverURL, repo, runID)
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			src.RunURL = fmt.Sprintf("%s/attempts/%s", src.RunURL, attempt)
+		}
+	}
+	if src == (render.SourceContext{}) {
+		return nil
+	}
+	return &src
+}
+
+// localWorkspaceRequest builds a request that renders manifests from the
+// repository already checked out into the workflow's workspace instead of
+// cloning it again. Such a request never writes to the remote repository, so
+// no token is required, but rendered manifests must be written to a local
+// path or to stdout.
+func localWorkspaceRequest(in *actionInputs) *render.Request {
+	req := &render.Request{
+		LocalInPath:  in.requiredEnv("GITHUB_WORKSPACE"),
+		LocalOutPath: in.get("outputPath", ""),
+		Stdout:       in.getBool("stdout", false),
+		TargetBranch: in.getRequired("targetBranch"),
+		Images:       in.getStringSlice("images"),
+	}
+	switch {
+	case req.LocalOutPath == "" && !req.Stdout:
+		in.invalid(
+			"outputPath",
+			"or input stdout is required when localWorkspace is true",
+		)
+	case req.LocalOutPath != "" && req.Stdout:
+		in.invalid("outputPath", "and input stdout are mutually exclusive")
+	}
+	return req
+}
+
+// serviceOptions builds options for the rendering service from the inputs of
+// the GitHub Action. Problems with any inputs are recorded by the provided
+// actionInputs.
+func serviceOptions(in *actionInputs, logLevel render.LogLevel) *render.ServiceOptions {
+	opts := &render.ServiceOptions{
+		LogLevel: logLevel,
+		AllowedConfigManagement: configManagementTools(
+			in.getStringSlice("allowedConfigManagement"),
+		),
+	}
+	for _, tool := range opts.AllowedConfigManagement {
+		switch tool {
+		case render.ConfigManagementToolDirectory,
+			render.ConfigManagementToolHelm,
+			render.ConfigManagementToolKustomize,
+			render.ConfigManagementToolPlugin:
+		default:
+			in.invalid(
+				"allowedConfigManagement",
+				"contains unknown tool %q; valid tools are %s, %s, %s, and %s",
+				tool,
+				render.ConfigManagementToolDirectory,
+				render.ConfigManagementToolHelm,
+				render.ConfigManagementToolKustomize,
+				render.ConfigManagementToolPlugin,
+			)
+		}
 	}
-	req.RepoURL = fmt.Sprintf("https://github.com/%s", repo)
-	if req.RepoCreds.Password, err =
-		libOS.GetRequiredEnvVar("INPUT_PERSONALACCESSTOKEN"); err != nil {
-		return nil, err
+	if requiredChecks := in.getStringSlice("requiredChecks"); len(requiredChecks) > 0 {
+		opts.RequiredChecksPolicies = []render.RequiredChecksPolicy{
+			{Checks: requiredChecks},
+		}
 	}
-	if req.Ref, err = libOS.GetRequiredEnvVar("GITHUB_SHA"); err != nil {
-		return nil, err
+	if eventSinkURL := in.get("eventSinkURL", ""); eventSinkURL != "" {
+		if u, err := url.Parse(eventSinkURL); err != nil ||
+			(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			in.invalid("eventSinkURL", "must be an absolute http or https URL")
+		} else {
+			opts.EventSink = render.NewAsyncEventSink(
+				render.NewHTTPEventSink(eventSinkURL, nil),
+				0,
+			)
+		}
 	}
-	req.TargetBranch, err = libOS.GetRequiredEnvVar("INPUT_TARGETBRANCH")
-	return req, err
+	return opts
 }
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -9,14 +12,44 @@ import (
 	render "github.com/akuity/kargo-render"
 )
 
+// clearActionEnv clears all environment variables the Action reads. These are
+// actually set during a GitHub Actions Run -- which means they are sometimes
+// set when these tests run.
+func clearActionEnv(t *testing.T) {
+	for _, name := range []string{
+		"GITHUB_REPOSITORY",
+		"GITHUB_SHA",
+		"GITHUB_WORKSPACE",
+		"GITHUB_REF_NAME",
+		"GITHUB_REF_TYPE",
+		"GITHUB_SERVER_URL",
+		"GITHUB_RUN_ID",
+		"GITHUB_RUN_ATTEMPT",
+		"GITHUB_OUTPUT",
+		"INPUT_PERSONALACCESSTOKEN",
+		"INPUT_TARGETBRANCH",
+		"INPUT_IMAGES",
+		"INPUT_AUTHORNAME",
+		"INPUT_AUTHOREMAIL",
+		"INPUT_PRTITLETEMPLATE",
+		"INPUT_PRBODYTEMPLATE",
+		"INPUT_PRLABELS",
+		"INPUT_PRDRAFT",
+		"INPUT_LOCALWORKSPACE",
+		"INPUT_OUTPUTPATH",
+		"INPUT_STDOUT",
+		"INPUT_ALLOWEDCONFIGMANAGEMENT",
+		"INPUT_EVENTSINKURL",
+		"INPUT_REQUIREDCHECKS",
+		"INPUT_SKIPPROMOTIONORDER",
+		"INPUT_FORCERENDER",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
 func TestRequest(t *testing.T) {
-	// We need to start by clearing these out, because these are all actually set
-	// during a GitHub Actions Run -- which means these are sometimes set when
-	// these tests run.
-	t.Setenv("GITHUB_REPOSITORY", "")
-	t.Setenv("INPUT_PERSONALACCESSTOKEN", "")
-	t.Setenv("GITHUB_SHA", "")
-	t.Setenv("INPUT_TARGETBRANCH", "")
+	clearActionEnv(t)
 	const (
 		testRepo   = "krancour/foo"
 		testImage1 = "krancour/foo:blue"
@@ -38,57 +71,185 @@ func TestRequest(t *testing.T) {
 		assertions func(*testing.T, *render.Request, error)
 	}{
 		{
-			name: "GITHUB_REPOSITORY not specified",
+			name: "all required values missing",
 			assertions: func(t *testing.T, _ *render.Request, err error) {
 				require.Error(t, err)
-				require.Contains(t, err.Error(), "value not found for")
-				require.Contains(t, err.Error(), "GITHUB_REPOSITORY")
+				// All problems are reported at once
+				require.Contains(t, err.Error(), "found 4 missing or invalid input(s)")
+				require.Contains(t, err.Error(), "GITHUB_REPOSITORY is required")
+				require.Contains(t, err.Error(), "GITHUB_SHA is required")
+				require.Contains(
+					t,
+					err.Error(),
+					"input personalAccessToken (INPUT_PERSONALACCESSTOKEN) is required",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"input targetBranch (INPUT_TARGETBRANCH) is required",
+				)
 			},
 		},
 		{
-			name: "INPUT_PERSONALACCESSTOKEN not specified",
+			name: "some required values missing",
 			setup: func() {
 				t.Setenv("GITHUB_REPOSITORY", testRepo)
+				t.Setenv("GITHUB_SHA", testReq.Ref)
 			},
 			assertions: func(t *testing.T, _ *render.Request, err error) {
 				require.Error(t, err)
-				require.Contains(t, err.Error(), "value not found for")
-				require.Contains(t, err.Error(), "INPUT_PERSONALACCESSTOKEN")
+				require.Contains(t, err.Error(), "found 2 missing or invalid input(s)")
+				require.NotContains(t, err.Error(), "GITHUB_REPOSITORY")
+				require.NotContains(t, err.Error(), "GITHUB_SHA")
 			},
 		},
 		{
-			name: "GITHUB_SHA not specified",
+			name: "success",
 			setup: func() {
 				t.Setenv("INPUT_PERSONALACCESSTOKEN", testReq.RepoCreds.Password)
+				t.Setenv("INPUT_TARGETBRANCH", testReq.TargetBranch)
+				t.Setenv(
+					"INPUT_IMAGES",
+					fmt.Sprintf("%s,%s", testImage1, testImage2))
+			},
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, testReq, req)
+			},
+		},
+		{
+			name: "skip promotion order",
+			setup: func() {
+				t.Setenv("INPUT_SKIPPROMOTIONORDER", "true")
+			},
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.True(t, req.SkipPromotionOrder)
+			},
+		},
+		{
+			name: "invalid optional inputs",
+			setup: func() {
+				t.Setenv("INPUT_PRDRAFT", "maybe")
+				t.Setenv("INPUT_AUTHORNAME", "Kargo Bot")
 			},
 			assertions: func(t *testing.T, _ *render.Request, err error) {
 				require.Error(t, err)
-				require.Contains(t, err.Error(), "value not found for")
-				require.Contains(t, err.Error(), "GITHUB_SHA")
+				require.Contains(t, err.Error(), "found 2 missing or invalid input(s)")
+				require.Contains(
+					t,
+					err.Error(),
+					`input prDraft (INPUT_PRDRAFT) must be true or false; got "maybe"`,
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"input authorEmail (INPUT_AUTHOREMAIL) is required when "+
+						"authorName is specified",
+				)
 			},
 		},
 		{
-			name: "INPUT_TARGETBRANCH not specified",
+			name: "success with author and pull request options",
 			setup: func() {
-				t.Setenv("GITHUB_SHA", testReq.Ref)
+				t.Setenv("INPUT_AUTHOREMAIL", "bot@example.com")
+				t.Setenv("INPUT_PRTITLETEMPLATE", "Promote {{ .SourceCommit }}")
+				t.Setenv("INPUT_PRLABELS", "promotion,env/dev")
+				t.Setenv("INPUT_PRDRAFT", "true")
+			},
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					&render.CommitAuthor{
+						Name:  "Kargo Bot",
+						Email: "bot@example.com",
+					},
+					req.CommitAuthor,
+				)
+				require.Equal(
+					t,
+					&render.PullRequestOptions{
+						TitleTemplate: "Promote {{ .SourceCommit }}",
+						Labels:        []string{"promotion", "env/dev"},
+						Draft:         true,
+					},
+					req.PullRequest,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.setup != nil {
+				testCase.setup()
+			}
+			in := &actionInputs{}
+			req := request(in)
+			testCase.assertions(t, req, in.err())
+		})
+	}
+}
+
+func TestLocalWorkspaceRequest(t *testing.T) {
+	clearActionEnv(t)
+	t.Setenv("INPUT_LOCALWORKSPACE", "true")
+	const testWorkspace = "/home/runner/work/foo/foo"
+	testCases := []struct {
+		name       string
+		setup      func()
+		assertions func(*testing.T, *render.Request, error)
+	}{
+		{
+			name: "required values missing",
+			assertions: func(t *testing.T, _ *render.Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "found 3 missing or invalid input(s)")
+				require.Contains(t, err.Error(), "GITHUB_WORKSPACE is required")
+				require.Contains(
+					t,
+					err.Error(),
+					"input targetBranch (INPUT_TARGETBRANCH) is required",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"or input stdout is required when localWorkspace is true",
+				)
+				// Neither a token nor a remote repository is required
+				require.NotContains(t, err.Error(), "INPUT_PERSONALACCESSTOKEN")
+				require.NotContains(t, err.Error(), "GITHUB_REPOSITORY")
+			},
+		},
+		{
+			name: "ambiguous output",
+			setup: func() {
+				t.Setenv("GITHUB_WORKSPACE", testWorkspace)
+				t.Setenv("INPUT_TARGETBRANCH", "env/dev")
+				t.Setenv("INPUT_OUTPUTPATH", "/tmp/rendered")
+				t.Setenv("INPUT_STDOUT", "true")
 			},
 			assertions: func(t *testing.T, _ *render.Request, err error) {
 				require.Error(t, err)
-				require.Contains(t, err.Error(), "value not found for")
-				require.Contains(t, err.Error(), "INPUT_TARGETBRANCH")
+				require.Contains(t, err.Error(), "are mutually exclusive")
 			},
 		},
 		{
 			name: "success",
 			setup: func() {
-				t.Setenv("INPUT_TARGETBRANCH", testReq.TargetBranch)
-				t.Setenv(
-					"INPUT_IMAGES",
-					fmt.Sprintf("%s,%s", testImage1, testImage2))
+				t.Setenv("INPUT_OUTPUTPATH", "")
 			},
 			assertions: func(t *testing.T, req *render.Request, err error) {
 				require.NoError(t, err)
-				require.Equal(t, testReq, req)
+				require.Equal(
+					t,
+					&render.Request{
+						LocalInPath:  testWorkspace,
+						TargetBranch: "env/dev",
+						Stdout:       true,
+					},
+					req,
+				)
 			},
 		},
 	}
@@ -97,8 +258,304 @@ func TestRequest(t *testing.T) {
 			if testCase.setup != nil {
 				testCase.setup()
 			}
-			req, err := request()
-			testCase.assertions(t, req, err)
+			in := &actionInputs{}
+			req := request(in)
+			testCase.assertions(t, req, in.err())
+		})
+	}
+}
+
+func TestRequests(t *testing.T) {
+	clearActionEnv(t)
+	t.Setenv("GITHUB_REPOSITORY", "krancour/foo")
+	t.Setenv("GITHUB_SHA", "1234567")
+	t.Setenv("INPUT_PERSONALACCESSTOKEN", "12345")
+	testCases := []struct {
+		name       string
+		setup      func()
+		assertions func(*testing.T, []*render.Request, error)
+	}{
+		{
+			name: "single target branch",
+			setup: func() {
+				t.Setenv("INPUT_TARGETBRANCH", "env/dev")
+			},
+			assertions: func(t *testing.T, reqs []*render.Request, err error) {
+				require.NoError(t, err)
+				require.Len(t, reqs, 1)
+				require.Equal(t, "env/dev", reqs[0].TargetBranch)
+			},
+		},
+		{
+			name: "list of target branches",
+			setup: func() {
+				t.Setenv("INPUT_TARGETBRANCH", "env/dev, env/staging,env/dev")
+			},
+			assertions: func(t *testing.T, reqs []*render.Request, err error) {
+				require.NoError(t, err)
+				require.Len(t, reqs, 2)
+				require.Equal(t, "env/dev", reqs[0].TargetBranch)
+				require.Equal(t, "env/staging", reqs[1].TargetBranch)
+				// Everything else is shared
+				require.Equal(t, reqs[0].Ref, reqs[1].Ref)
+			},
+		},
+		{
+			name: "mappings without GITHUB_REF_NAME",
+			setup: func() {
+				t.Setenv(
+					"INPUT_TARGETBRANCH",
+					"main->env/dev,release->env/staging",
+				)
+			},
+			assertions: func(t *testing.T, _ []*render.Request, err error) {
+				require.Error(t, err)
+				// Reported only once
+				require.Contains(t, err.Error(), "found 1 missing or invalid input(s)")
+				require.Contains(t, err.Error(), "GITHUB_REF_NAME is required")
+			},
+		},
+		{
+			name: "invalid mapping",
+			setup: func() {
+				t.Setenv("GITHUB_REF_NAME", "main")
+				t.Setenv("INPUT_TARGETBRANCH", "main->")
+			},
+			assertions: func(t *testing.T, _ []*render.Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `contains invalid mapping "main->"`)
+			},
+		},
+		{
+			name: "mappings and branches",
+			setup: func() {
+				t.Setenv(
+					"INPUT_TARGETBRANCH",
+					"main->env/dev, release->env/staging, env/preview",
+				)
+			},
+			assertions: func(t *testing.T, reqs []*render.Request, err error) {
+				require.NoError(t, err)
+				require.Len(t, reqs, 2)
+				require.Equal(t, "env/dev", reqs[0].TargetBranch)
+				require.Equal(t, "env/preview", reqs[1].TargetBranch)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.setup != nil {
+				testCase.setup()
+			}
+			in := &actionInputs{}
+			reqs := requests(in)
+			testCase.assertions(t, reqs, in.err())
+		})
+	}
+}
+
+func TestRequestsWithLocalOutPath(t *testing.T) {
+	clearActionEnv(t)
+	t.Setenv("GITHUB_WORKSPACE", "/home/runner/work/foo/foo")
+	t.Setenv("INPUT_LOCALWORKSPACE", "true")
+	t.Setenv("INPUT_OUTPUTPATH", "/tmp/rendered")
+	t.Run("single target branch", func(t *testing.T) {
+		t.Setenv("INPUT_TARGETBRANCH", "env/dev")
+		in := &actionInputs{}
+		reqs := requests(in)
+		require.NoError(t, in.err())
+		require.Len(t, reqs, 1)
+		require.Equal(t, "/tmp/rendered", reqs[0].LocalOutPath)
+	})
+	t.Run("multiple target branches", func(t *testing.T) {
+		t.Setenv("INPUT_TARGETBRANCH", "env/dev,env/staging")
+		in := &actionInputs{}
+		reqs := requests(in)
+		require.NoError(t, in.err())
+		require.Len(t, reqs, 2)
+		require.Equal(t, "/tmp/rendered/env/dev", reqs[0].LocalOutPath)
+		require.Equal(t, "/tmp/rendered/env/staging", reqs[1].LocalOutPath)
+	})
+}
+
+func TestWriteActionOutputs(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "output")
+	require.NoError(t, os.WriteFile(outputPath, []byte("foo=bar\n"), 0600))
+	results := []actionResult{
+		{
+			TargetBranch: "env/dev",
+			Response: &render.Response{
+				ActionTaken: render.ActionTakenPushedDirectly,
+				CommitID:    "abc",
+			},
+		},
+		{
+			TargetBranch: "env/staging",
+			Error:        "something went wrong",
+		},
+	}
+	err := writeActionOutputs(outputPath, results, summarize(results))
+	require.NoError(t, err)
+	contents, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(contents), "foo=bar\nresults=[{"))
+	require.Contains(t, string(contents), `"targetBranch":"env/staging"`)
+	require.Contains(t, string(contents), `"error":"something went wrong"`)
+	require.Contains(t, string(contents), "\nsummary={")
+	require.Contains(t, string(contents), `"succeeded":1,"failed":1`)
+}
+
+func TestActionSource(t *testing.T) {
+	clearActionEnv(t)
+	require.Nil(t, actionSource())
+	t.Setenv("GITHUB_REF_TYPE", "tag")
+	t.Setenv("GITHUB_REF_NAME", "v1.0.0")
+	t.Setenv("GITHUB_SERVER_URL", "https://github.com")
+	t.Setenv("GITHUB_REPOSITORY", "akuity/gitops")
+	t.Setenv("GITHUB_RUN_ID", "42")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "2")
+	require.Equal(
+		t,
+		&render.SourceContext{
+			Tag:    "v1.0.0",
+			RunURL: "https://github.com/akuity/gitops/actions/runs/42/attempts/2",
+		},
+		actionSource(),
+	)
+}
+
+func TestMetadataReflectsRequest(t *testing.T) {
+	req := &render.Request{
+		Ref:    "abc",
+		Images: []string{"nginx:1.25.3"},
+	}
+	testCases := []struct {
+		name       string
+		metadata   string
+		assertions func(*testing.T, bool, error)
+	}{
+		{
+			name: "no metadata",
+			assertions: func(t *testing.T, reflected bool, err error) {
+				require.NoError(t, err)
+				require.False(t, reflected)
+			},
+		},
+		{
+			name:     "invalid metadata",
+			metadata: "{",
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.ErrorContains(t, err, "error unmarshaling target branch metadata")
+			},
+		},
+		{
+			name:     "different source commit",
+			metadata: "sourceCommit: def\nimageSubstitutions:\n- nginx:1.25.3\n",
+			assertions: func(t *testing.T, reflected bool, err error) {
+				require.NoError(t, err)
+				require.False(t, reflected)
+			},
+		},
+		{
+			name:     "image not rendered",
+			metadata: "sourceCommit: abc\nimageSubstitutions:\n- nginx:1.25.2\n",
+			assertions: func(t *testing.T, reflected bool, err error) {
+				require.NoError(t, err)
+				require.False(t, reflected)
+			},
+		},
+		{
+			name: "reflected",
+			metadata: "sourceCommit: abc\nimageSubstitutions:\n" +
+				"- nginx:1.25.3\n- redis:7.2\n",
+			assertions: func(t *testing.T, reflected bool, err error) {
+				require.NoError(t, err)
+				require.True(t, reflected)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var metadata []byte
+			if testCase.metadata != "" {
+				metadata = []byte(testCase.metadata)
+			}
+			reflected, err := metadataReflectsRequest(req, metadata)
+			testCase.assertions(t, reflected, err)
+		})
+	}
+}
+
+func TestServiceOptions(t *testing.T) {
+	clearActionEnv(t)
+	testCases := []struct {
+		name       string
+		setup      func(*testing.T)
+		assertions func(*testing.T, *render.ServiceOptions, error)
+	}{
+		{
+			name: "defaults",
+			assertions: func(t *testing.T, opts *render.ServiceOptions, err error) {
+				require.NoError(t, err)
+				require.Nil(t, opts.AllowedConfigManagement)
+				require.Nil(t, opts.EventSink)
+				require.Nil(t, opts.RequiredChecksPolicies)
+			},
+		},
+		{
+			name: "invalid inputs",
+			setup: func(t *testing.T) {
+				t.Setenv("INPUT_ALLOWEDCONFIGMANAGEMENT", "helm,jsonnet")
+				t.Setenv("INPUT_EVENTSINKURL", "not-a-url")
+			},
+			assertions: func(t *testing.T, _ *render.ServiceOptions, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "found 2 missing or invalid input(s)")
+				require.Contains(t, err.Error(), `contains unknown tool "jsonnet"`)
+				require.Contains(
+					t,
+					err.Error(),
+					"input eventSinkURL (INPUT_EVENTSINKURL) must be an absolute http "+
+						"or https URL",
+				)
+			},
+		},
+		{
+			name: "success",
+			setup: func(t *testing.T) {
+				t.Setenv("INPUT_ALLOWEDCONFIGMANAGEMENT", "helm,Kustomize")
+				t.Setenv("INPUT_EVENTSINKURL", "https://events.example.com")
+				t.Setenv("INPUT_REQUIREDCHECKS", "build,test")
+			},
+			assertions: func(t *testing.T, opts *render.ServiceOptions, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]render.ConfigManagementTool{
+						render.ConfigManagementToolHelm,
+						render.ConfigManagementToolKustomize,
+					},
+					opts.AllowedConfigManagement,
+				)
+				require.NotNil(t, opts.EventSink)
+				require.Equal(
+					t,
+					[]render.RequiredChecksPolicy{
+						{Checks: []string{"build", "test"}},
+					},
+					opts.RequiredChecksPolicies,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.setup != nil {
+				testCase.setup(t)
+			}
+			in := &actionInputs{}
+			opts := serviceOptions(in, render.LogLevelInfo)
+			testCase.assertions(t, opts, in.err())
 		})
 	}
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/akuity/kargo-render/pkg/env"
+)
+
+// actionInputs reads the inputs of the GitHub Action, and the environment
+// variables GitHub Actions sets for every run, from the environment. Rather
+// than failing on the first missing or invalid input, it records a problem for
+// every such input so that all of them can be reported at once.
+type actionInputs struct {
+	problems actionInputProblems
+}
+
+// actionInputProblem describes a single missing or invalid input.
+type actionInputProblem struct {
+	// name is the name of the input, as it appears in a workflow, or, for
+	// values that aren't inputs, the name of the environment variable.
+	name string
+	// envVar is the name of the environment variable the value was read from.
+	envVar string
+	// msg describes what is wrong with the value.
+	msg string
+}
+
+func (p actionInputProblem) Error() string {
+	if p.name == p.envVar {
+		return fmt.Sprintf("%s %s", p.envVar, p.msg)
+	}
+	return fmt.Sprintf("input %s (%s) %s", p.name, p.envVar, p.msg)
+}
+
+// actionInputProblems is an error describing all missing or invalid inputs.
+type actionInputProblems []actionInputProblem
+
+func (p actionInputProblems) Error() string {
+	msgs := make([]string, len(p))
+	for i, problem := range p {
+		msgs[i] = "  - " + problem.Error()
+	}
+	return fmt.Sprintf(
+		"found %d missing or invalid input(s):\n%s",
+		len(p),
+		strings.Join(msgs, "\n"),
+	)
+}
+
+// writeAnnotations writes an error annotation for each problem using GitHub
+// Actions' workflow command syntax, so that each problem is surfaced in the
+// summary of the workflow run.
+func (p actionInputProblems) writeAnnotations(out io.Writer) {
+	for _, problem := range p {
+		fmt.Fprintf(
+			out,
+			"::error title=%s::%s\n",
+			escapeAnnotationProperty("Invalid input "+problem.name),
+			escapeAnnotationData(problem.Error()),
+		)
+	}
+}
+
+// inputEnvVar returns the name of the environment variable GitHub Actions
+// uses to pass the named input to an action.
+func inputEnvVar(name string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+}
+
+// invalid records a problem with the named input.
+func (a *actionInputs) invalid(name string, format string, args ...any) {
+	a.problems = append(
+		a.problems,
+		actionInputProblem{
+			name:   name,
+			envVar: inputEnvVar(name),
+			msg:    fmt.Sprintf(format, args...),
+		},
+	)
+}
+
+// get returns the value of the named input or, if it was not specified,
+// the provided default value.
+func (a *actionInputs) get(name string, defaultValue string) string {
+	if val := strings.TrimSpace(os.Getenv(inputEnvVar(name))); val != "" {
+		return val
+	}
+	return defaultValue
+}
+
+// getRequired returns the value of the named input, recording a problem if
+// it was not specified.
+func (a *actionInputs) getRequired(name string) string {
+	val := a.get(name, "")
+	if val == "" {
+		a.invalid(name, "is required")
+	}
+	return val
+}
+
+// getBool returns the value of the named input, parsed as a bool, or, if it
+// was not specified, the provided default value. A problem is recorded if the
+// value cannot be parsed.
+func (a *actionInputs) getBool(name string, defaultValue bool) bool {
+	valStr := a.get(name, "")
+	if valStr == "" {
+		return defaultValue
+	}
+	val, err := strconv.ParseBool(valStr)
+	if err != nil {
+		a.invalid(name, "must be true or false; got %q", valStr)
+		return defaultValue
+	}
+	return val
+}
+
+// getStringSlice returns the value of the named input, parsed as a
+// comma-delimited list, or nil if it was not specified.
+func (a *actionInputs) getStringSlice(name string) []string {
+	return env.GetStringSliceFromEnvVar(inputEnvVar(name), nil)
+}
+
+// requiredEnv returns the value of the named environment variable, which
+// GitHub Actions is expected to have set, recording a problem if it was not.
+func (a *actionInputs) requiredEnv(name string) string {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		a.problems = append(
+			a.problems,
+			actionInputProblem{
+				name:   name,
+				envVar: name,
+				msg: "is required, but was not set; this value is set " +
+					"automatically when running in GitHub Actions",
+			},
+		)
+	}
+	return val
+}
+
+// err returns an error describing all problems recorded so far, or nil if
+// there are none.
+func (a *actionInputs) err() error {
+	if len(a.problems) == 0 {
+		return nil
+	}
+	return a.problems
+}
+
+// escapeAnnotationData escapes the message of a workflow command.
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+	).Replace(s)
+}
+
+// escapeAnnotationProperty escapes a property value of a workflow command.
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	).Replace(s)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionInputProblemsWriteAnnotations(t *testing.T) {
+	problems := actionInputProblems{
+		{
+			name:   "targetBranch",
+			envVar: "INPUT_TARGETBRANCH",
+			msg:    "is required",
+		},
+		{
+			name:   "GITHUB_SHA",
+			envVar: "GITHUB_SHA",
+			msg:    "is required\nand 100% missing",
+		},
+	}
+	out := &bytes.Buffer{}
+	problems.writeAnnotations(out)
+	require.Equal(
+		t,
+		"::error title=Invalid input targetBranch::"+
+			"input targetBranch (INPUT_TARGETBRANCH) is required\n"+
+			"::error title=Invalid input GITHUB_SHA::"+
+			"GITHUB_SHA is required%0Aand 100%25 missing\n",
+		out.String(),
+	)
+}
+
+func TestInputEnvVar(t *testing.T) {
+	require.Equal(t, "INPUT_PERSONALACCESSTOKEN", inputEnvVar("personalAccessToken"))
+	require.Equal(t, "INPUT_SOME_INPUT", inputEnvVar("some input"))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// completionTimeout is the maximum amount of time spent reading a remote
+// repository's configuration to complete a flag's value. Shells wait for
+// completions synchronously, so it is better to offer none than to hang.
+const completionTimeout = 10 * time.Second
+
+// branchSource identifies the repository whose Kargo Render configuration
+// names the branches offered as completions of --target-branch.
+type branchSource struct {
+	// repoURL is the URL of a remote repository. It takes precedence over
+	// localPath.
+	repoURL string
+	// ref is the branch of the remote repository to read configuration from.
+	// If empty, or not a branch, the repository's default branch is read.
+	ref string
+	// repoCreds are the credentials for reading from the remote repository.
+	repoCreds render.RepoCredentials
+	// localPath is the path to a local working tree.
+	localPath string
+}
+
+// completeTargetBranches returns a function that completes values of
+// --target-branch using the names of branches, and the literal prefixes of
+// patterns matching branches, in the Kargo Render configuration of the
+// repository identified by the branchSource the provided function returns.
+// The function is called only when completions are requested, once flags have
+// been parsed.
+func completeTargetBranches(
+	source func(*cobra.Command) branchSource,
+) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(
+		cmd *cobra.Command,
+		_ []string,
+		toComplete string,
+	) ([]string, cobra.ShellCompDirective) {
+		src := source(cmd)
+		names, patterns, err := configuredBranches(cmd.Context(), src)
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return branchCompletions(names, patterns, toComplete)
+	}
+}
+
+// configuredBranches returns the names of, and the patterns matching,
+// branches in the Kargo Render configuration of the repository identified by
+// the provided branchSource. A remote repository is cloned shallowly into a
+// temporary directory to read its configuration.
+func configuredBranches(
+	ctx context.Context,
+	src branchSource,
+) ([]string, []string, error) {
+	repoPath := src.localPath
+	if src.repoURL != "" {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+		defer cancel()
+		repo, err := git.Clone(
+			ctx,
+			src.repoURL,
+			git.RepoCredentials{
+				SSHPrivateKey:     src.repoCreds.SSHPrivateKey,
+				Username:          src.repoCreds.Username,
+				Password:          src.repoCreds.Password,
+				ClientCertificate: src.repoCreds.ClientCertificate,
+				ClientKey:         src.repoCreds.ClientKey,
+				ExtraHTTPHeaders:  src.repoCreds.ExtraHTTPHeaders,
+				Netrc:             src.repoCreds.Netrc,
+			},
+			&git.RepoOptions{CloneStrategy: git.CloneStrategyShallow},
+		)
+		if repo != nil {
+			defer repo.Close()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if src.ref != "" {
+			// A commit that is not the tip of a branch cannot be checked out of a
+			// shallow clone, in which case the default branch is close enough
+			_ = repo.Checkout(ctx, src.ref)
+		}
+		repoPath = repo.WorkingDir()
+	}
+	if repoPath == "" {
+		return nil, nil, nil
+	}
+	names, err := render.ConfiguredBranchNames(repoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	patterns, err := render.ConfiguredBranchPatterns(repoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return names, patterns, nil
+}
+
+// branchCompletions returns the completions of the provided partial branch
+// name offered by the provided branch names and patterns. A pattern anchored
+// to the start of branch names offers the literal prefix every matching name
+// begins with, which is completed without a trailing space so that the rest of
+// the name can be typed. Other patterns offer nothing.
+func branchCompletions(
+	names []string,
+	patterns []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	directive := cobra.ShellCompDirectiveNoFileComp
+	completions := []string{}
+	seen := map[string]struct{}{}
+	offer := func(completion string, description string) {
+		if _, ok := seen[completion]; ok ||
+			!strings.HasPrefix(completion, toComplete) {
+			return
+		}
+		seen[completion] = struct{}{}
+		completions = append(completions, completion+"\t"+description)
+	}
+	for _, name := range names {
+		offer(name, "configured branch")
+	}
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "^") {
+			continue
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		prefix, complete := regex.LiteralPrefix()
+		if complete {
+			// The pattern matches exactly one name
+			offer(prefix, "branch matching /"+pattern+"/")
+			continue
+		}
+		if prefix == "" || prefix == toComplete {
+			continue // Nothing would be completed
+		}
+		before := len(completions)
+		offer(prefix, "branches matching /"+pattern+"/")
+		if len(completions) > before {
+			directive |= cobra.ShellCompDirectiveNoSpace
+		}
+	}
+	return completions, directive
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchCompletions(t *testing.T) {
+	names := []string{"env/dev", "env/prod", "preview"}
+	patterns := []string{`^env/(.+)$`, `^qa/[0-9]+$`, `feature-.*`}
+
+	completions, directive := branchCompletions(names, patterns, "env/")
+	require.Equal(
+		t,
+		[]string{"env/dev\tconfigured branch", "env/prod\tconfigured branch"},
+		completions,
+	)
+	require.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	// Anchored patterns offer their literal prefixes; others offer nothing
+	completions, directive = branchCompletions(names, patterns, "")
+	require.Equal(
+		t,
+		[]string{
+			"env/dev\tconfigured branch",
+			"env/prod\tconfigured branch",
+			"preview\tconfigured branch",
+			"env/\tbranches matching /^env/(.+)$/",
+			"qa/\tbranches matching /^qa/[0-9]+$/",
+		},
+		completions,
+	)
+	require.Equal(
+		t,
+		cobra.ShellCompDirectiveNoFileComp|cobra.ShellCompDirectiveNoSpace,
+		directive,
+	)
+}
+
+func TestCompleteTargetBranch(t *testing.T) {
+	repoDir := t.TempDir()
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(repoDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+- name: env/prod
+- pattern: ^preview/.+$
+`),
+			0600,
+		),
+	)
+	cmd := newRootCommand()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{
+		cobra.ShellCompRequestCmd,
+		"--local-in-path", repoDir,
+		"--target-branch", "env/p",
+	})
+	require.NoError(t, cmd.Execute())
+	require.Contains(t, out.String(), "env/prod\tconfigured branch\n")
+	require.NotContains(t, out.String(), "env/dev")
+	require.NotContains(t, out.String(), "preview/")
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/internal/version"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// doctorDialTimeout is the maximum amount of time the doctor command waits
+// when checking whether a remote gitops repository is reachable.
+const doctorDialTimeout = 10 * time.Second
+
+type doctorOptions struct {
+	repoClientCertOptions
+	repoURL      string
+	repoCreds    render.RepoCredentials
+	outputFormat string
+}
+
+// doctorCheck is the result of a single check performed by the doctor
+// command.
+type doctorCheck struct {
+	// Name is a short description of what was checked.
+	Name string `json:"name"`
+	// Passed indicates whether the check passed.
+	Passed bool `json:"passed"`
+	// Message explains the result of the check.
+	Message string `json:"message"`
+}
+
+// doctorReport is the result of all checks performed by the doctor command.
+type doctorReport struct {
+	// Checks are the results of the individual checks, in the order they were
+	// performed.
+	Checks []doctorCheck `json:"checks"`
+	// Passed indicates whether all checks passed.
+	Passed bool `json:"passed"`
+}
+
+func (r *doctorReport) add(name string, err error, message string) {
+	check := doctorCheck{
+		Name:    name,
+		Passed:  err == nil,
+		Message: message,
+	}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+func newDoctorCommand() *cobra.Command {
+	cmdOpts := &doctorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that the runtime environment is suitable for rendering",
+		Long: "Check that the runtime environment is suitable for rendering. " +
+			"This verifies that required binaries are installed and that the " +
+			"temporary directory is writable. If a remote gitops repository is " +
+			"specified, it also verifies that the repository is reachable and " +
+			"that the provided credentials permit reading from and writing to it. " +
+			"Nothing is written to the repository.",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			setRepoCredsFromEnv(cmd)
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmdOpts.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	// Register the option flags on the command.
+	cmdOpts.addFlags(cmd)
+
+	return cmd
+}
+
+// addFlags adds the flags for the doctor options to the provided command.
+func (o *doctorOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&o.outputFormat,
+		flagOutput,
+		"o",
+		"",
+		"Specify a format for command output (json or yaml).",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.repoURL,
+		flagRepo,
+		"r",
+		"",
+		"The URL of a remote gitops repository to check access to. If not "+
+			"specified, no repository access is checked.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.repoCreds.Password,
+		flagRepoPassword,
+		"p",
+		"",
+		"Password or token for reading from and writing to the remote gitops "+
+			"repository. Can alternatively be specified using the "+
+			"KARGO_RENDER_REPO_PASSWORD environment variable.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.repoCreds.Username,
+		flagRepoUsername,
+		"u",
+		"",
+		"Username for reading from and writing to the remote gitops "+
+			"repository. Can alternatively be specified using the "+
+			"KARGO_RENDER_REPO_USERNAME environment variable.",
+	)
+
+	o.repoClientCertOptions.addFlags(cmd)
+}
+
+// run checks the runtime environment and prints a report of the results.
+func (o *doctorOptions) run(ctx context.Context, out io.Writer) error {
+	if err := o.repoClientCertOptions.load(&o.repoCreds); err != nil {
+		return err
+	}
+
+	report := o.check(ctx)
+
+	if o.outputFormat != "" {
+		if err := output(report, out, o.outputFormat); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, check := range report.Checks {
+			result := "PASS"
+			if !check.Passed {
+				result = "FAIL"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", result, check.Name, check.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if !report.Passed {
+		return errors.New("one or more checks failed")
+	}
+	return nil
+}
+
+// check performs all checks and returns a report of the results.
+func (o *doctorOptions) check(ctx context.Context) doctorReport {
+	report := doctorReport{}
+
+	tools := version.GetTools()
+	gitVersion, gitErr := toolVersion("git", tools.GitVersion)
+	report.add("git binary", gitErr, gitVersion)
+	helmVersion, helmErr := toolVersion("helm", tools.HelmVersion)
+	if helmErr == nil && !strings.HasPrefix(helmVersion, "version 3.") {
+		helmErr =
+			fmt.Errorf("found helm %s, but Helm 3 is required", tools.HelmVersion)
+	}
+	report.add("helm binary", helmErr, helmVersion)
+	kustomizeVersion, kustomizeErr :=
+		toolVersion("kustomize", tools.KustomizeVersion)
+	report.add("kustomize binary", kustomizeErr, kustomizeVersion)
+
+	report.add("temporary directory", checkTempDir(), os.TempDir()+" is writable")
+
+	if o.repoURL != "" {
+		o.checkRepo(ctx, &report)
+	}
+
+	report.Passed = true
+	for _, check := range report.Checks {
+		report.Passed = report.Passed && check.Passed
+	}
+	return report
+}
+
+// checkRepo checks that the remote gitops repository is reachable and that
+// the credentials permit reading from and writing to it. Each check is only
+// performed if the previous one passed.
+func (o *doctorOptions) checkRepo(ctx context.Context, report *doctorReport) {
+	const (
+		reachableCheck = "repository reachable"
+		readCheck      = "repository read access"
+		writeCheck     = "repository write access"
+	)
+	addr, err := repoAddress(o.repoURL)
+	message := "repository is local"
+	if err == nil && addr != "" {
+		message = fmt.Sprintf("connected to %s", addr)
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", addr, doctorDialTimeout); err == nil {
+			_ = conn.Close()
+		}
+	}
+	report.add(reachableCheck, err, message)
+	if err != nil {
+		report.add(readCheck, errors.New("skipped; repository is unreachable"), "")
+		report.add(writeCheck, errors.New("skipped; repository is unreachable"), "")
+		return
+	}
+
+	repo, err := git.Clone(
+		ctx,
+		o.repoURL,
+		git.RepoCredentials{
+			SSHPrivateKey:     o.repoCreds.SSHPrivateKey,
+			Username:          o.repoCreds.Username,
+			Password:          o.repoCreds.Password,
+			ClientCertificate: o.repoCreds.ClientCertificate,
+			ClientKey:         o.repoCreds.ClientKey,
+		},
+		nil,
+	)
+	report.add(readCheck, err, fmt.Sprintf("cloned %s", o.repoURL))
+	if err != nil {
+		report.add(writeCheck, errors.New("skipped; repository is unreadable"), "")
+		return
+	}
+	defer repo.Close()
+
+	// Pushing a commit to a new branch is simulated. This works even if the
+	// repository is empty and does not depend on the permissions granted for
+	// any existing branch.
+	branch := fmt.Sprintf("kargo-render-doctor-%s", uuid.NewString())
+	if err = repo.CreateOrphanedBranch(ctx, branch); err == nil {
+		if err = repo.Commit(
+			ctx,
+			"Kargo Render doctor probe",
+			&git.CommitOptions{AllowEmpty: true},
+		); err == nil {
+			err = repo.PushDryRun(ctx)
+		}
+	}
+	report.add(writeCheck, err, "a push would be permitted (dry run)")
+}
+
+// toolVersion returns a message describing the specified version of the named
+// tool or an error if the version is unknown, which indicates the tool is not
+// installed or not functional.
+func toolVersion(name string, ver string) (string, error) {
+	if ver == version.UnknownVersion {
+		return "", fmt.Errorf("%s is not installed or its version is unknown", name)
+	}
+	return fmt.Sprintf("version %s", ver), nil
+}
+
+// checkTempDir returns an error if a file cannot be written to the system's
+// temporary directory.
+func checkTempDir() error {
+	f, err := os.CreateTemp("", "kargo-render-doctor-")
+	if err != nil {
+		return fmt.Errorf("error writing to temporary directory: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString("probe"); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to temporary directory: %w", err)
+	}
+	return f.Close()
+}
+
+// repoAddress returns the network address (host and port) of the remote
+// repository with the specified URL. Both URLs and scp-like SSH addresses
+// (e.g. git@github.com:akuity/kargo-render.git) are supported. An empty
+// address is returned for local repositories.
+func repoAddress(repoURL string) (string, error) {
+	if !strings.Contains(repoURL, "://") {
+		// Possibly an scp-like SSH address
+		if at := strings.Index(repoURL, "@"); at >= 0 {
+			if colon := strings.Index(repoURL[at:], ":"); colon > 0 {
+				return net.JoinHostPort(repoURL[at+1:at+colon], "22"), nil
+			}
+		}
+		return "", fmt.Errorf("repository URL %q is not a valid URL", repoURL)
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository URL %q: %w", repoURL, err)
+	}
+	if u.Scheme == "file" {
+		return "", nil
+	}
+	if port := u.Port(); port != "" {
+		return u.Host, nil
+	}
+	ports := map[string]string{
+		"http":  "80",
+		"https": "443",
+		"ssh":   "22",
+		"git":   "9418",
+	}
+	port, ok := ports[u.Scheme]
+	if !ok {
+		return "", fmt.Errorf("repository URL %q has unsupported scheme", repoURL)
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
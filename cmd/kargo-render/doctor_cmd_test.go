@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sosedoff/gitkit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoAddress(t *testing.T) {
+	testCases := []struct {
+		name       string
+		repoURL    string
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:    "https URL",
+			repoURL: "https://github.com/akuity/kargo-render",
+			assertions: func(t *testing.T, addr string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "github.com:443", addr)
+			},
+		},
+		{
+			name:    "URL with port",
+			repoURL: "http://localhost:8080/test.git",
+			assertions: func(t *testing.T, addr string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "localhost:8080", addr)
+			},
+		},
+		{
+			name:    "ssh URL",
+			repoURL: "ssh://git@github.com/akuity/kargo-render.git",
+			assertions: func(t *testing.T, addr string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "github.com:22", addr)
+			},
+		},
+		{
+			name:    "scp-like address",
+			repoURL: "git@github.com:akuity/kargo-render.git",
+			assertions: func(t *testing.T, addr string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "github.com:22", addr)
+			},
+		},
+		{
+			name:    "file URL",
+			repoURL: "file:///tmp/repo",
+			assertions: func(t *testing.T, addr string, err error) {
+				require.NoError(t, err)
+				require.Empty(t, addr)
+			},
+		},
+		{
+			name:    "unsupported scheme",
+			repoURL: "ftp://example.com/repo",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "unsupported scheme")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			addr, err := repoAddress(testCase.repoURL)
+			testCase.assertions(t, addr, err)
+		})
+	}
+}
+
+func TestDoctorCheckRepo(t *testing.T) {
+	service := gitkit.New(gitkit.Config{Dir: t.TempDir(), AutoCreate: true})
+	require.NoError(t, service.Setup())
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	t.Run("accessible repository", func(t *testing.T) {
+		o := &doctorOptions{repoURL: fmt.Sprintf("%s/test.git", server.URL)}
+		report := doctorReport{}
+		o.checkRepo(context.Background(), &report)
+		require.Len(t, report.Checks, 3)
+		for _, check := range report.Checks {
+			require.True(t, check.Passed, check.Message)
+		}
+	})
+
+	t.Run("unreachable repository", func(t *testing.T) {
+		unreachable := httptest.NewServer(nil)
+		unreachable.Close()
+		o := &doctorOptions{repoURL: fmt.Sprintf("%s/test.git", unreachable.URL)}
+		report := doctorReport{}
+		o.checkRepo(context.Background(), &report)
+		require.Len(t, report.Checks, 3)
+		for _, check := range report.Checks {
+			require.False(t, check.Passed)
+		}
+		require.Contains(t, report.Checks[2].Message, "skipped")
+	})
+}
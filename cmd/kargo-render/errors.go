@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-github/v47/github"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// errorPresentation is an error as it is presented to users of the CLI.
+type errorPresentation struct {
+	// message concisely describes what went wrong.
+	message string
+	// hint, if non-empty, suggests how to remedy it.
+	hint string
+}
+
+// presentError returns a presentation of the provided error, which may wrap
+// many others, that describes only the error that matters most to users, along
+// with a hint as to how to remedy it where one is known. Errors of no known
+// type are presented as they are.
+func presentError(err error) errorPresentation {
+	if p, ok := presentRenderError(err); ok {
+		return p
+	}
+
+	if errors.Is(err, git.ErrPushRejected) {
+		return errorPresentation{
+			message: "the remote repository rejected the push to the target branch",
+			hint: "The branch is probably protected. Enable prs.enabled or " +
+				"prs.openOnRejectedPush in the branch's configuration, or allow the " +
+				"credentials to push to the branch.",
+		}
+	}
+
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		switch ghErr.Response.StatusCode {
+		case http.StatusUnauthorized:
+			return errorPresentation{
+				message: "the git provider's API rejected the credentials",
+				hint: fmt.Sprintf(
+					"Check that the token specified by --%s is valid and has not expired.",
+					flagRepoPassword,
+				),
+			}
+		case http.StatusForbidden:
+			return errorPresentation{
+				message: "token lacks permission to use the git provider's API",
+				hint: "Grant the token the repo scope if it is a classic token, or " +
+					"contents:write and pull_requests:write if it is fine-grained.",
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, git.ErrAuthenticationFailed):
+		return errorPresentation{
+			message: "the remote repository rejected the credentials",
+			hint: fmt.Sprintf(
+				"Specify valid credentials using --%s and --%s, or an SSH key "+
+					"that has been granted access to the repository.",
+				flagRepoUsername,
+				flagRepoPassword,
+			),
+		}
+	case errors.Is(err, git.ErrPermissionDenied):
+		return errorPresentation{
+			message: "credentials lack permission to write to the remote repository",
+			hint: "Grant the token contents:write if it is fine-grained, or the " +
+				"repo scope if it is a classic token.",
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorPresentation{
+			message: "timed out",
+			hint: fmt.Sprintf(
+				"If rendering legitimately takes this long, raise --%s.",
+				flagRenderTimeout,
+			),
+		}
+	}
+
+	return errorPresentation{message: err.Error()}
+}
+
+// presentRenderError returns a presentation of the first of the typed errors
+// returned by Kargo Render that the provided error wraps. Their messages are
+// already concise, so they are presented as they are, without the messages of
+// the errors that wrap them. It returns false if the provided error wraps no
+// such error.
+func presentRenderError(err error) (errorPresentation, bool) {
+	var (
+		invalidRequestErr  *render.InvalidRequestError
+		invalidConfigErr   *render.InvalidConfigError
+		invalidBranchErr   *render.InvalidBranchConfigError
+		duplicateBranchErr *render.DuplicateBranchConfigError
+		unreachableErr     *render.UnreachableBranchConfigError
+		noBranchConfigErr  *render.NoBranchConfigError
+		unmatchedErr       *render.UnmatchedImagesError
+		stalePlanErr       *render.StalePlanError
+		toolErr            *render.ConfigManagementToolNotAllowedError
+		unverifiedErr      *render.UnverifiedCommitError
+		checksErr          *render.RequiredChecksNotPassedError
+		tooManyPRsErr      *render.TooManyOpenPRsError
+		promotionErr       *render.PromotionOrderError
+		policyErr          *render.ResourcePolicyViolationError
+		preservedErr       *render.MissingPreservedPathsError
+		duplicatesErr      *render.DuplicateResourcesError
+		lintErr            *render.LintError
+		collisionErr       *render.ExternalPathCollisionError
+		symlinkErr         *render.SymlinkError
+		unpinnedErr        *render.UnpinnedRemoteBaseError
+		offlineErr         *render.NetworkAccessRequiredError
+		versionErr         *render.UnsupportedVersionError
+		timeoutErr         *render.AppRenderTimeoutError
+		unmanagedErr       *render.UnmanagedBranchError
+	)
+	const fixConfig = "Fix kargo-render.yaml in the source commit."
+	p := errorPresentation{}
+	switch {
+	case errors.As(err, &invalidRequestErr):
+		p = errorPresentation{
+			message: invalidRequestErr.Error(),
+			hint:    "Run kargo-render --help to see how flags may be specified.",
+		}
+	case errors.As(err, &invalidConfigErr):
+		p = errorPresentation{message: invalidConfigErr.Error(), hint: fixConfig}
+	case errors.As(err, &invalidBranchErr):
+		p = errorPresentation{message: invalidBranchErr.Error(), hint: fixConfig}
+	case errors.As(err, &duplicateBranchErr):
+		p = errorPresentation{message: duplicateBranchErr.Error(), hint: fixConfig}
+	case errors.As(err, &unreachableErr):
+		p = errorPresentation{
+			message: unreachableErr.Error(),
+			hint:    "Reorder the branch configurations in kargo-render.yaml.",
+		}
+	case errors.As(err, &noBranchConfigErr):
+		p = errorPresentation{message: noBranchConfigErr.Error()}
+	case errors.As(err, &unmatchedErr):
+		p = errorPresentation{
+			message: unmatchedErr.Error(),
+			hint: fmt.Sprintf(
+				"Check the images specified using --%s for typos, or omit --%s.",
+				flagImage,
+				flagRequireImageMatches,
+			),
+		}
+	case errors.As(err, &stalePlanErr):
+		p = errorPresentation{message: stalePlanErr.Error()}
+	case errors.As(err, &toolErr):
+		p = errorPresentation{
+			message: toolErr.Error(),
+			hint: fmt.Sprintf(
+				"Allow the tool using --%s.",
+				flagAllowedConfigManagement,
+			),
+		}
+	case errors.As(err, &unverifiedErr):
+		p = errorPresentation{
+			message: unverifiedErr.Error(),
+			hint: fmt.Sprintf(
+				"Sign the source commit with a key specified using --%s.",
+				flagTrustedKey,
+			),
+		}
+	case errors.As(err, &checksErr):
+		p = errorPresentation{
+			message: checksErr.Error(),
+			hint:    "Wait for the checks to pass, then render again.",
+		}
+	case errors.As(err, &tooManyPRsErr):
+		p = errorPresentation{
+			message: tooManyPRsErr.Error(),
+			hint:    "Merge or close open pull requests to the branch, then render again.",
+		}
+	case errors.As(err, &promotionErr):
+		p = errorPresentation{
+			message: promotionErr.Error(),
+			hint: fmt.Sprintf(
+				"Render the commit into branch %q first, or specify --%s.",
+				promotionErr.Predecessor,
+				flagSkipPromotionOrder,
+			),
+		}
+	case errors.As(err, &policyErr):
+		p = errorPresentation{
+			message: policyErr.Error(),
+			hint: "Fix the offending resources, or relax the branch's " +
+				"resourcePolicy in kargo-render.yaml.",
+		}
+	case errors.As(err, &preservedErr):
+		p = errorPresentation{
+			message: preservedErr.Error(),
+			hint: "Add the paths to the branch, or remove them from its " +
+				"preservedPaths in kargo-render.yaml.",
+		}
+	case errors.As(err, &duplicatesErr):
+		p = errorPresentation{
+			message: duplicatesErr.Error(),
+			hint:    "Make sure that each resource is rendered by only one app.",
+		}
+	case errors.As(err, &lintErr):
+		p = errorPresentation{
+			message: lintErr.Error(),
+			hint:    "Fix the problems the linter found in the app's input.",
+		}
+	case errors.As(err, &collisionErr):
+		p = errorPresentation{
+			message: collisionErr.Error(),
+			hint: "Change the app's output path, or the branch's externalPaths, " +
+				"in kargo-render.yaml.",
+		}
+	case errors.As(err, &symlinkErr):
+		p = errorPresentation{
+			message: symlinkErr.Error(),
+			hint:    "Remove the link, or change the repository's symlink policy.",
+		}
+	case errors.As(err, &unpinnedErr):
+		p = errorPresentation{
+			message: unpinnedErr.Error(),
+			hint:    "Pin the remote base to a commit using ?ref=<commit ID>.",
+		}
+	case errors.As(err, &offlineErr):
+		p = errorPresentation{
+			message: offlineErr.Error(),
+			hint: fmt.Sprintf(
+				"Vendor the dependencies into the repository, or omit --%s.",
+				flagOffline,
+			),
+		}
+	case errors.As(err, &versionErr):
+		p = errorPresentation{
+			message: versionErr.Error(),
+			hint:    "Upgrade kargo-render.",
+		}
+	case errors.As(err, &timeoutErr):
+		p = errorPresentation{
+			message: timeoutErr.Error(),
+			hint: fmt.Sprintf(
+				"If rendering the app legitimately takes this long, raise its "+
+					"renderTimeout in kargo-render.yaml or --%s.",
+				flagRenderTimeout,
+			),
+		}
+	case errors.As(err, &unmanagedErr):
+		p = errorPresentation{message: unmanagedErr.Error()}
+		if unmanagedErr.Path == "" {
+			p.hint = fmt.Sprintf(
+				"Specify --%s to let Kargo Render take over the branch.",
+				flagAdoptBranch,
+			)
+		}
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+// writeError writes the provided error to the provided io.Writer as it is
+// presented to users of the CLI. Unless debug is true, in which case the error
+// is written in full, only the error that matters most is described.
+func writeError(out io.Writer, err error, debug bool) {
+	p := presentError(err)
+	message := p.message
+	if debug {
+		message = err.Error()
+	}
+	fmt.Fprintf(out, "Error: %s\n", message)
+	if p.hint != "" {
+		fmt.Fprintf(out, "Hint: %s\n", p.hint)
+	}
+	if !debug && message != err.Error() {
+		fmt.Fprintf(out, "Run again with --%s for details.\n", flagDebug)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+	libExec "github.com/akuity/kargo-render/internal/exec"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+func TestPresentError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		err        error
+		assertions func(*testing.T, errorPresentation)
+	}{
+		{
+			name: "typed error is unwrapped",
+			err: fmt.Errorf(
+				"error rendering: %w",
+				fmt.Errorf(
+					"error checking promotion order: %w",
+					&render.PromotionOrderError{
+						Commit:       "abc",
+						TargetBranch: "env/prod",
+						Predecessor:  "env/staging",
+					},
+				),
+			),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.NotContains(t, p.message, "error rendering")
+				require.Contains(t, p.message, "env/prod")
+				require.Contains(t, p.hint, `"env/staging"`)
+				require.Contains(t, p.hint, "--"+flagSkipPromotionOrder)
+			},
+		},
+		{
+			name: "push rejected",
+			err:  fmt.Errorf("error pushing: %w", git.ErrPushRejected),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.Contains(t, p.message, "rejected the push")
+				require.Contains(t, p.hint, "openOnRejectedPush")
+			},
+		},
+		{
+			name: "git authentication failure",
+			err: fmt.Errorf(
+				"error cloning repo: %w: %w",
+				git.ErrAuthenticationFailed,
+				&libExec.ExitError{
+					Command:  "git clone",
+					Output:   []byte("fatal: Authentication failed for 'https://github.com/foo/bar'"),
+					ExitCode: 128,
+				},
+			),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.Equal(t, "the remote repository rejected the credentials", p.message)
+				require.Contains(t, p.hint, "--"+flagRepoPassword)
+			},
+		},
+		{
+			name: "git permission failure",
+			err: fmt.Errorf(
+				"%w: %w",
+				git.ErrPermissionDenied,
+				&libExec.ExitError{
+					Command:  "git push",
+					Output:   []byte("remote: Permission to foo/bar.git denied to baz."),
+					ExitCode: 128,
+				},
+			),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.Contains(t, p.message, "lack permission")
+				require.Contains(t, p.hint, "contents:write")
+			},
+		},
+		{
+			name: "GitHub API forbidden",
+			err: fmt.Errorf(
+				"error opening pull request: %w",
+				&github.ErrorResponse{
+					Response: &http.Response{
+						StatusCode: http.StatusForbidden,
+						Request:    &http.Request{Method: http.MethodPost},
+					},
+				},
+			),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.Contains(t, p.message, "token lacks permission")
+				require.Contains(t, p.hint, "pull_requests:write")
+			},
+		},
+		{
+			name: "unknown error",
+			err:  errors.New("something went wrong"),
+			assertions: func(t *testing.T, p errorPresentation) {
+				require.Equal(t, "something went wrong", p.message)
+				require.Empty(t, p.hint)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.assertions(t, presentError(testCase.err))
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	err := fmt.Errorf("error pushing: %w", git.ErrPushRejected)
+	testCases := []struct {
+		name       string
+		err        error
+		debug      bool
+		assertions func(*testing.T, string)
+	}{
+		{
+			name: "concise",
+			err:  err,
+			assertions: func(t *testing.T, out string) {
+				require.NotContains(t, out, "error pushing")
+				require.Contains(t, out, "\nHint: ")
+				require.Contains(t, out, "--"+flagDebug)
+			},
+		},
+		{
+			name:  "debug",
+			err:   err,
+			debug: true,
+			assertions: func(t *testing.T, out string) {
+				require.Contains(t, out, "Error: "+err.Error()+"\n")
+				require.Contains(t, out, "\nHint: ")
+				require.NotContains(t, out, "--"+flagDebug)
+			},
+		},
+		{
+			name: "nothing to hide",
+			err:  errors.New("something went wrong"),
+			assertions: func(t *testing.T, out string) {
+				require.Equal(t, "Error: something went wrong\n", out)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			writeError(out, testCase.err, testCase.debug)
+			testCase.assertions(t, out.String())
+		})
+	}
+}
@@ -1,19 +1,78 @@
 package main
 
 const (
-	flagAllowEmpty    = "allow-empty"
-	flagCommitMessage = "commit-message"
-	flagDebug         = "debug"
-	flagImage         = "image"
-	flagLocalInPath   = "local-in-path"
-	flagLocalOutPath  = "local-out-path"
-	flagOutput        = "output"
-	flagOutputJSON    = "json"
-	flagOutputYAML    = "yaml"
-	flagRef           = "ref"
-	flagRepo          = "repo"
-	flagRepoPassword  = "repo-password"
-	flagRepoUsername  = "repo-username"
-	flagStdout        = "stdout"
-	flagTargetBranch  = "target-branch"
+	flagAdoptBranch             = "adopt-branch"
+	flagAllowEmpty              = "allow-empty"
+	flagAllowedConfigManagement = "allowed-config-management"
+	flagAnnotation              = "annotation"
+	flagApp                     = "app"
+	flagCloneCacheDir           = "clone-cache-dir"
+	flagCloneFilter             = "clone-filter"
+	flagCloneStrategy           = "clone-strategy"
+	flagCommitMessage           = "commit-message"
+	flagConcurrency             = "concurrency"
+	flagConfig                  = "config"
+	flagConsumer                = "consumer"
+	flagConsumerGroup           = "consumer-group"
+	flagDebug                   = "debug"
+	flagEventSinkURL            = "event-sink-url"
+	flagExpandEnv               = "expand-env"
+	flagGoldenDir               = "golden-dir"
+	flagHTTPHeader              = "http-header"
+	flagIdempotencyTTL          = "idempotency-ttl"
+	flagImage                   = "image"
+	flagKeepWorkspace           = "keep-workspace"
+	flagKubeconfig              = "kubeconfig"
+	flagKustomizeBinary         = "kustomize-binary"
+	flagLabel                   = "label"
+	flagLocalInPath             = "local-in-path"
+	flagLocalOutExcludeMetadata = "local-out-exclude-metadata"
+	flagLocalOutFormat          = "local-out-format"
+	flagLocalOutManifestsOnly   = "local-out-manifests-only"
+	flagLocalOutPath            = "local-out-path"
+	flagNameSuffix              = "name-suffix"
+	flagNamespace               = "namespace"
+	flagNoProgress              = "no-progress"
+	flagOffline                 = "offline"
+	flagOption                  = "option"
+	flagOutput                  = "output"
+	flagOutputJSON              = "json"
+	flagOutputYAML              = "yaml"
+	flagPreRender               = "pre-render"
+	flagPushURL                 = "push-url"
+	flagRedeliveryTimeout       = "redelivery-timeout"
+	flagRedisAddr               = "redis-addr"
+	flagRedisDB                 = "redis-db"
+	flagRedisPassword           = "redis-password"
+	flagRedisUsername           = "redis-username"
+	flagRef                     = "ref"
+	flagRefPath                 = "ref-path"
+	flagRenderTimeout           = "render-timeout"
+	flagRepo                    = "repo"
+	flagRepoAuthHeader          = "repo-auth-header"
+	flagRepoClientCert          = "repo-client-cert"
+	flagRepoClientKey           = "repo-client-key"
+	flagRepoNetrc               = "repo-netrc"
+	flagRepoPassword            = "repo-password"
+	flagRepoUsername            = "repo-username"
+	flagRequestFile             = "request-file"
+	flagRequestsStream          = "requests-stream"
+	flagRequireBranchConfig     = "require-branch-config"
+	flagRequireImageMatches     = "require-image-matches"
+	flagRequiredCheck           = "required-check"
+	flagResultsStream           = "results-stream"
+	flagSkipPromotionOrder      = "skip-promotion-order"
+	flagSourceBranch            = "source-branch"
+	flagSourceRunURL            = "source-run-url"
+	flagSourceTag               = "source-tag"
+	flagSSHAgent                = "ssh-agent"
+	flagStdout                  = "stdout"
+	flagStdoutFormat            = "stdout-format"
+	flagStdoutFormatText        = "text"
+	flagTargetBranch            = "target-branch"
+	flagToolEnv                 = "tool-env"
+	flagTrustedKey              = "trusted-key"
+	flagUpdate                  = "update"
+	flagUserAgent               = "user-agent"
+	flagVar                     = "var"
 )
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// States of a rendering request being tracked by the server.
+const (
+	renderJobStateQueued    = "queued"
+	renderJobStateRunning   = "running"
+	renderJobStateSucceeded = "succeeded"
+	renderJobStateFailed    = "failed"
+	renderJobStateCanceled  = "canceled"
+)
+
+// renderJob is a rendering request that is waiting to be handled or is being
+// handled by the server.
+type renderJob struct {
+	cancel context.CancelFunc
+	// done is closed once the request has been handled, after which state is
+	// final.
+	done chan struct{}
+
+	mu       sync.Mutex
+	state    string
+	canceled bool
+}
+
+// renderJobKey identifies a rendering request being tracked by the server.
+// Request IDs are chosen by clients, so they are scoped to the tenant that
+// made the request.
+type renderJobKey struct {
+	tenant string
+	id     string
+}
+
+// renderJobs tracks, by tenant and request ID, every rendering request that is
+// waiting to be handled or is being handled, so that they can be canceled.
+type renderJobs struct {
+	mu   sync.Mutex
+	jobs map[renderJobKey]*renderJob
+}
+
+// renderJobResponse is the body of responses to requests to cancel a
+// rendering request.
+type renderJobResponse struct {
+	// ID is the ID of the rendering request.
+	ID string `json:"id"`
+	// State is the final state of the rendering request. It is "canceled"
+	// unless the request was handled before it could be canceled, in which
+	// case it is "succeeded" or "failed".
+	State string `json:"state"`
+}
+
+// newRenderJobs returns a renderJobs that is not yet tracking any rendering
+// requests.
+func newRenderJobs() *renderJobs {
+	return &renderJobs{jobs: map[renderJobKey]*renderJob{}}
+}
+
+// start begins tracking a queued rendering request of the specified tenant
+// with the specified ID, which is canceled using the provided function. An
+// error is returned if a request of the same tenant with the same ID is
+// already being tracked.
+func (r *renderJobs) start(
+	tenant string,
+	id string,
+	cancel context.CancelFunc,
+) (*renderJob, error) {
+	key := renderJobKey{tenant: tenant, id: id}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jobs[key]; ok {
+		return nil, fmt.Errorf("a rendering request with ID %q is already queued or running", id)
+	}
+	job := &renderJob{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		state:  renderJobStateQueued,
+	}
+	r.jobs[key] = job
+	return job, nil
+}
+
+// finish stops tracking the rendering request of the specified tenant with the
+// specified ID and records its final state, which is determined by the status
+// code of the response to it.
+func (r *renderJobs) finish(tenant, id string, job *renderJob, code int) {
+	r.mu.Lock()
+	delete(r.jobs, renderJobKey{tenant: tenant, id: id})
+	r.mu.Unlock()
+	job.mu.Lock()
+	switch {
+	case code == http.StatusOK:
+		job.state = renderJobStateSucceeded
+	case job.canceled:
+		job.state = renderJobStateCanceled
+	default:
+		job.state = renderJobStateFailed
+	}
+	job.mu.Unlock()
+	close(job.done)
+}
+
+// get returns the tracked rendering request of the specified tenant with the
+// specified ID, or nil if there is none.
+func (r *renderJobs) get(tenant, id string) *renderJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jobs[renderJobKey{tenant: tenant, id: id}]
+}
+
+// setRunning records that the rendering request has been admitted from the
+// queue.
+func (j *renderJob) setRunning() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = renderJobStateRunning
+}
+
+// requestCancel cancels the rendering request. Requests that are waiting are
+// removed from the queue and requests that are being handled are interrupted,
+// terminating any child processes.
+func (j *renderJob) requestCancel() {
+	j.mu.Lock()
+	j.canceled = true
+	j.mu.Unlock()
+	j.cancel()
+}
+
+// wasCanceled returns true if the rendering request was canceled.
+func (j *renderJob) wasCanceled() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.canceled
+}
+
+// finalState returns the state of the rendering request once it has been
+// handled.
+func (j *renderJob) finalState() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// handleCancel cancels a rendering request that is waiting to be handled or
+// is being handled and, once it has stopped, reports its final state. Only the
+// tenant that made a request can cancel it. To other tenants, it appears not to
+// exist.
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	cfg := s.state.Load().cfg
+	writeError := func(code int, msg string) {
+		writeProblem(w, code, problem{Detail: msg})
+	}
+	if r.Method != http.MethodDelete {
+		writeError(http.StatusMethodNotAllowed, "only DELETE requests are supported")
+		return
+	}
+	if !authenticated(cfg, r) {
+		writeError(http.StatusUnauthorized, "a valid bearer token is required")
+		return
+	}
+	id := r.PathValue("id")
+	job := s.jobs.get(tenant(cfg, r), id)
+	if job == nil {
+		writeError(
+			http.StatusNotFound,
+			fmt.Sprintf("no rendering request with ID %q is queued or running", id),
+		)
+		return
+	}
+	job.requestCancel()
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return
+	}
+	state := job.finalState()
+	s.logger.WithFields(log.Fields{
+		"requestID": id,
+		"state":     state,
+	}).Info("cancellation of rendering request was requested")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(
+		renderJobResponse{ID: id, State: state},
+	)
+}
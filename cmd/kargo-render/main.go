@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -22,7 +24,23 @@ func main() {
 	// output (e.g. JSON) is requested.
 	log.SetOutput(os.Stderr)
 
-	if err := newRootCommand().ExecuteContext(context.Background()); err != nil {
+	// Commands executed while rendering are started in process groups of their
+	// own, so they do not receive signals sent to this one from a terminal.
+	// Canceling the context when such a signal is received kills them.
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	cmd, err := newRootCommand().ExecuteContextC(ctx)
+	stop()
+	if err != nil {
+		// Commands that have no --debug flag have no detail to hide behind it
+		debug := true
+		if flag := cmd.Flags().Lookup(flagDebug); flag != nil {
+			debug = flag.Value.String() == "true"
+		}
+		writeError(os.Stderr, err, debug)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// stageDescriptions describe, for humans, each stage of handling a rendering
+// request.
+var stageDescriptions = map[string]string{
+	render.StageClone:       "Cloning repository",
+	render.StageCopy:        "Copying local repository",
+	render.StageLoadConfig:  "Loading configuration",
+	render.StageLint:        "Linting",
+	render.StagePreRender:   "Rendering",
+	render.StageDeterminism: "Checking determinism of",
+	render.StageLastMile:    "Last-mile rendering",
+	render.StageCommit:      "Committing",
+	render.StagePush:        "Pushing",
+	render.StagePR:          "Opening pull request",
+}
+
+// newProgressPrinter returns a function, suitable for use as
+// render.ServiceOptions.ProgressFn, that writes a line describing each stage
+// of handling a rendering request to the provided writer as the stage begins.
+func newProgressPrinter(out io.Writer) func(render.Progress) {
+	mu := sync.Mutex{}
+	return func(p render.Progress) {
+		desc, ok := stageDescriptions[p.Stage]
+		if !ok {
+			desc = p.Stage
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if p.App == "" {
+			fmt.Fprintf(out, "==> %s\n", desc)
+			return
+		}
+		fmt.Fprintf(
+			out,
+			"==> %s app %s (%d of %d)\n",
+			desc,
+			p.App,
+			p.AppIndex,
+			p.AppCount,
+		)
+	}
+}
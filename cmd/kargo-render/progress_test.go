@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestProgressPrinter(t *testing.T) {
+	out := &bytes.Buffer{}
+	printProgress := newProgressPrinter(out)
+	printProgress(render.Progress{Stage: render.StageClone})
+	printProgress(
+		render.Progress{
+			Stage:    render.StagePreRender,
+			App:      "foo",
+			AppIndex: 1,
+			AppCount: 2,
+		},
+	)
+	printProgress(render.Progress{Stage: "unknown"})
+	require.Equal(
+		t,
+		"==> Cloning repository\n"+
+			"==> Rendering app foo (1 of 2)\n"+
+			"==> unknown\n",
+		out.String(),
+	)
+}
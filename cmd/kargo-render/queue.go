@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// renderQueue limits how many rendering requests the server handles at once,
+// both in total and for any one repository. Requests that cannot be handled
+// immediately wait in a queue of their own repository's, ordered by priority
+// and then by arrival. Whenever capacity becomes available, the waiting request
+// of highest priority is admitted. Among repositories whose next requests are
+// of equal priority, repositories take turns. This prevents a client that
+// submits many requests for one repository from starving clients of other
+// repositories. Requests that would have to wait behind too many others are
+// refused instead.
+type renderQueue struct {
+	// concurrency is the maximum number of requests handled at once. Zero
+	// means there is no limit.
+	concurrency int
+	// perRepoConcurrency is the maximum number of requests for any one
+	// repository handled at once. Zero means there is no limit.
+	perRepoConcurrency int
+	// maxQueued is the maximum number of requests waiting at once. Zero means
+	// there is no limit.
+	maxQueued int
+	// maxQueuedPerRepo is the maximum number of requests for any one repository
+	// waiting at once. Zero means there is no limit.
+	maxQueuedPerRepo int
+
+	mu            sync.Mutex
+	running       int
+	runningByRepo map[string]int
+	waiting       map[string][]*queueWaiter
+	queued        int
+	// turns is the order in which repositories with waiting requests take
+	// turns having requests admitted.
+	turns []string
+	// avgDuration is a moving average of how long requests took to handle once
+	// admitted. It is used to estimate how long refused requests should wait
+	// before being retried.
+	avgDuration time.Duration
+}
+
+// defaultRequestDuration is how long requests are assumed to take to handle
+// until one has been handled.
+const defaultRequestDuration = 10 * time.Second
+
+// queueFullError is returned when a request is refused because too many
+// requests are already waiting.
+type queueFullError struct {
+	// RetryAfter estimates how long it will be until the request could be
+	// admitted without waiting behind as many requests.
+	RetryAfter time.Duration
+	// Reason describes which limit was reached.
+	Reason string
+}
+
+func (q *queueFullError) Error() string {
+	return q.Reason
+}
+
+// queueWaiter is a request waiting to be admitted.
+type queueWaiter struct {
+	rank     int
+	admitted chan struct{}
+}
+
+// repoQueueStats describes the requests for a single repository that are
+// being handled or are waiting to be handled.
+type repoQueueStats struct {
+	// RepoURL is the URL of the repository.
+	RepoURL string `json:"repoURL"`
+	// Running is the number of requests being handled.
+	Running int `json:"running"`
+	// Queued is the number of requests waiting to be handled.
+	Queued int `json:"queued"`
+}
+
+// newRenderQueue returns a renderQueue with the limits specified by the
+// provided configuration.
+func newRenderQueue(cfg serverQueueConfig) *renderQueue {
+	return &renderQueue{
+		concurrency:        cfg.Concurrency,
+		perRepoConcurrency: cfg.PerRepoConcurrency,
+		maxQueued:          cfg.MaxQueued,
+		maxQueuedPerRepo:   cfg.MaxQueuedPerRepo,
+		runningByRepo:      map[string]int{},
+		waiting:            map[string][]*queueWaiter{},
+		avgDuration:        defaultRequestDuration,
+	}
+}
+
+// priorityRank returns a number that is greater for higher priorities.
+func priorityRank(priority render.Priority) int {
+	switch priority {
+	case render.PriorityLow:
+		return 0
+	case render.PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// acquire blocks until a request of the specified priority for the specified
+// repository may be handled or the provided context is canceled. If the
+// request may be handled, the returned function must be called once handling
+// is complete. The queue position of the request, counting from one among
+// requests waiting for the same repository, is reported to the provided
+// function, if it is non-nil, when the request has to wait. If the request
+// would have to wait behind too many others, a *queueFullError is returned
+// instead.
+func (q *renderQueue) acquire(
+	ctx context.Context,
+	repoURL string,
+	priority render.Priority,
+	onQueued func(position int),
+) (func(), error) {
+	w := &queueWaiter{
+		rank:     priorityRank(priority),
+		admitted: make(chan struct{}),
+	}
+	q.mu.Lock()
+	waiting := q.waiting[repoURL]
+	if len(waiting) == 0 {
+		q.turns = append(q.turns, repoURL)
+	}
+	// Wait behind every request of the same or higher priority
+	position := len(waiting)
+	for position > 0 && waiting[position-1].rank < w.rank {
+		position--
+	}
+	waiting = append(waiting, nil)
+	copy(waiting[position+1:], waiting[position:])
+	waiting[position] = w
+	q.waiting[repoURL] = waiting
+	q.queued++
+	q.admit()
+	position = 0
+	for i, other := range q.waiting[repoURL] {
+		if other == w {
+			position = i + 1
+			break
+		}
+	}
+	if position > 0 {
+		if err := q.checkDepth(repoURL); err != nil {
+			q.remove(repoURL, w)
+			q.mu.Unlock()
+			return nil, err
+		}
+	}
+	q.mu.Unlock()
+
+	var admittedAt time.Time
+	release := func() { q.release(repoURL, time.Since(admittedAt)) }
+	select {
+	case <-w.admitted:
+		admittedAt = time.Now()
+		return release, nil
+	default:
+	}
+	if onQueued != nil {
+		onQueued(position)
+	}
+	select {
+	case <-w.admitted:
+		admittedAt = time.Now()
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	select {
+	case <-w.admitted:
+		// The request was admitted after all, so give up its place
+		q.mu.Unlock()
+		q.release(repoURL, 0)
+	default:
+		q.remove(repoURL, w)
+		q.mu.Unlock()
+	}
+	return nil, ctx.Err()
+}
+
+// checkDepth returns a *queueFullError if more requests are waiting, in total
+// or for the specified repository, than the queue's limits allow. The caller
+// must hold the lock.
+func (q *renderQueue) checkDepth(repoURL string) error {
+	if q.maxQueuedPerRepo > 0 && len(q.waiting[repoURL]) > q.maxQueuedPerRepo {
+		return &queueFullError{
+			RetryAfter: q.retryAfter(len(q.waiting[repoURL]), q.repoConcurrency()),
+			Reason: fmt.Sprintf(
+				"too many requests for repository %q are already queued",
+				repoURL,
+			),
+		}
+	}
+	if q.maxQueued > 0 && q.queued > q.maxQueued {
+		return &queueFullError{
+			RetryAfter: q.retryAfter(q.queued, q.concurrency),
+			Reason:     "too many requests are already queued",
+		}
+	}
+	return nil
+}
+
+// repoConcurrency returns the maximum number of requests for any one
+// repository that can be handled at once, taking both limits into account.
+// Zero means there is no limit.
+func (q *renderQueue) repoConcurrency() int {
+	if q.perRepoConcurrency > 0 &&
+		(q.concurrency == 0 || q.perRepoConcurrency < q.concurrency) {
+		return q.perRepoConcurrency
+	}
+	return q.concurrency
+}
+
+// retryAfter estimates how long it will take to handle the specified number of
+// waiting requests, the specified number at a time. Zero means they are
+// handled one at a time. The estimate is never less than one second. The
+// caller must hold the lock.
+func (q *renderQueue) retryAfter(queued, concurrency int) time.Duration {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	rounds := (queued + concurrency - 1) / concurrency
+	return max(time.Duration(rounds)*q.avgDuration, time.Second).Round(time.Second)
+}
+
+// release records that handling of a request for the specified repository is
+// complete after the specified amount of time and admits waiting requests
+// accordingly. A duration of zero means the request was never handled.
+func (q *renderQueue) release(repoURL string, duration time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if duration > 0 {
+		// Weight each request's duration by a fifth
+		q.avgDuration += (duration - q.avgDuration) / 5
+	}
+	q.running--
+	if q.runningByRepo[repoURL]--; q.runningByRepo[repoURL] == 0 {
+		delete(q.runningByRepo, repoURL)
+	}
+	q.admit()
+}
+
+// admit admits as many waiting requests as capacity allows, highest priority
+// first, letting repositories take turns. The caller must hold the lock.
+func (q *renderQueue) admit() {
+	for {
+		if q.concurrency > 0 && q.running >= q.concurrency {
+			return
+		}
+		i := -1
+		for j, repoURL := range q.turns {
+			if q.perRepoConcurrency > 0 &&
+				q.runningByRepo[repoURL] >= q.perRepoConcurrency {
+				continue // This repository has to sit this turn out
+			}
+			if i < 0 || q.waiting[repoURL][0].rank > q.waiting[q.turns[i]][0].rank {
+				i = j
+			}
+		}
+		if i < 0 {
+			return
+		}
+		repoURL := q.turns[i]
+		w := q.waiting[repoURL][0]
+		q.waiting[repoURL] = q.waiting[repoURL][1:]
+		q.queued--
+		q.running++
+		q.runningByRepo[repoURL]++
+		close(w.admitted)
+		// Move this repository to the back of the line, or out of it entirely if
+		// it has no more waiting requests
+		q.turns = append(q.turns[:i], q.turns[i+1:]...)
+		if len(q.waiting[repoURL]) > 0 {
+			q.turns = append(q.turns, repoURL)
+		} else {
+			delete(q.waiting, repoURL)
+		}
+	}
+}
+
+// remove removes the provided waiting request for the specified repository
+// from the queue. The caller must hold the lock.
+func (q *renderQueue) remove(repoURL string, w *queueWaiter) {
+	waiting := q.waiting[repoURL]
+	for i, other := range waiting {
+		if other == w {
+			q.waiting[repoURL] = append(waiting[:i], waiting[i+1:]...)
+			q.queued--
+			break
+		}
+	}
+	if len(q.waiting[repoURL]) > 0 {
+		return
+	}
+	delete(q.waiting, repoURL)
+	for i, other := range q.turns {
+		if other == repoURL {
+			q.turns = append(q.turns[:i], q.turns[i+1:]...)
+			break
+		}
+	}
+}
+
+// stats returns the number of requests being handled and waiting to be
+// handled for every repository that has any, ordered by repository URL.
+func (q *renderQueue) stats() []repoQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	byRepo := map[string]*repoQueueStats{}
+	get := func(repoURL string) *repoQueueStats {
+		if _, ok := byRepo[repoURL]; !ok {
+			byRepo[repoURL] = &repoQueueStats{RepoURL: repoURL}
+		}
+		return byRepo[repoURL]
+	}
+	for repoURL, running := range q.runningByRepo {
+		get(repoURL).Running = running
+	}
+	for repoURL, waiting := range q.waiting {
+		get(repoURL).Queued = len(waiting)
+	}
+	stats := make([]repoQueueStats, 0, len(byRepo))
+	for _, s := range byRepo {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].RepoURL < stats[j].RepoURL
+	})
+	return stats
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestRenderQueue(t *testing.T) {
+	const (
+		busyRepo  = "https://github.com/akuity/busy"
+		quietRepo = "https://github.com/akuity/quiet"
+	)
+
+	t.Run("unlimited", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{})
+		for i := 0; i < 5; i++ {
+			_, err := q.acquire(context.Background(), busyRepo, "", func(int) {
+				require.Fail(t, "request should not have been queued")
+			})
+			require.NoError(t, err)
+		}
+		require.Equal(
+			t,
+			[]repoQueueStats{{RepoURL: busyRepo, Running: 5}},
+			q.stats(),
+		)
+	})
+
+	t.Run("repositories take turns", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{Concurrency: 1})
+		release, err := q.acquire(context.Background(), busyRepo, "", nil)
+		require.NoError(t, err)
+
+		// Queue several requests for the busy repository, then one for the quiet
+		// repository
+		admitted := make(chan string, 4)
+		positions := make(chan int, 4)
+		enqueue := func(repoURL string) {
+			go func() {
+				rel, err := q.acquire(
+					context.Background(),
+					repoURL,
+					"",
+					func(position int) { positions <- position },
+				)
+				if err == nil {
+					admitted <- repoURL
+					rel()
+				}
+			}()
+			<-positions
+		}
+		enqueue(busyRepo)
+		enqueue(busyRepo)
+		enqueue(busyRepo)
+		enqueue(quietRepo)
+		require.Equal(
+			t,
+			[]repoQueueStats{
+				{RepoURL: busyRepo, Running: 1, Queued: 3},
+				{RepoURL: quietRepo, Queued: 1},
+			},
+			q.stats(),
+		)
+
+		// The quiet repository's request is admitted after only one more of the
+		// busy repository's requests, even though it was queued last
+		release()
+		require.Equal(t, busyRepo, <-admitted)
+		require.Equal(t, quietRepo, <-admitted)
+		require.Equal(t, busyRepo, <-admitted)
+		require.Equal(t, busyRepo, <-admitted)
+	})
+
+	t.Run("higher priorities first", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{Concurrency: 1})
+		release, err := q.acquire(context.Background(), busyRepo, "", nil)
+		require.NoError(t, err)
+
+		admitted := make(chan render.Priority, 5)
+		positions := make(chan int, 5)
+		enqueue := func(repoURL string, priority render.Priority) int {
+			go func() {
+				rel, err := q.acquire(
+					context.Background(),
+					repoURL,
+					priority,
+					func(position int) { positions <- position },
+				)
+				if err == nil {
+					admitted <- priority
+					rel()
+				}
+			}()
+			return <-positions
+		}
+		require.Equal(t, 1, enqueue(busyRepo, render.PriorityLow))
+		// Each jumps ahead of waiting requests of lower priority for the same
+		// repository
+		require.Equal(t, 1, enqueue(busyRepo, render.PriorityNormal))
+		require.Equal(t, 1, enqueue(busyRepo, render.PriorityHigh))
+		require.Equal(t, 4, enqueue(busyRepo, render.PriorityLow))
+		require.Equal(t, 1, enqueue(quietRepo, render.PriorityNormal))
+
+		release()
+		require.Equal(t, render.PriorityHigh, <-admitted)
+		require.Equal(t, render.PriorityNormal, <-admitted)
+		require.Equal(t, render.PriorityNormal, <-admitted)
+		require.Equal(t, render.PriorityLow, <-admitted)
+		require.Equal(t, render.PriorityLow, <-admitted)
+	})
+
+	t.Run("per repository limit", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{PerRepoConcurrency: 1})
+		release, err := q.acquire(context.Background(), busyRepo, "", nil)
+		require.NoError(t, err)
+		// Other repositories are unaffected
+		_, err = q.acquire(context.Background(), quietRepo, "", func(int) {
+			require.Fail(t, "request should not have been queued")
+		})
+		require.NoError(t, err)
+		queued := make(chan int, 1)
+		admitted := make(chan struct{})
+		go func() {
+			if _, err := q.acquire(
+				context.Background(),
+				busyRepo,
+				"",
+				func(position int) { queued <- position },
+			); err == nil {
+				close(admitted)
+			}
+		}()
+		require.Equal(t, 1, <-queued)
+		release()
+		select {
+		case <-admitted:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "request was never admitted")
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{
+			Concurrency:      2,
+			MaxQueued:        3,
+			MaxQueuedPerRepo: 2,
+		})
+		for i := 0; i < 2; i++ {
+			_, err := q.acquire(context.Background(), busyRepo, "", nil)
+			require.NoError(t, err)
+		}
+		positions := make(chan int, 3)
+		enqueue := func(repoURL string) {
+			go func() {
+				_, _ = q.acquire(
+					context.Background(),
+					repoURL,
+					"",
+					func(position int) { positions <- position },
+				)
+			}()
+			<-positions
+		}
+		enqueue(busyRepo)
+		enqueue(busyRepo)
+		// Too many requests for the busy repository are waiting
+		_, err := q.acquire(context.Background(), busyRepo, "", nil)
+		fullErr := &queueFullError{}
+		require.ErrorAs(t, err, &fullErr)
+		require.Contains(t, fullErr.Reason, busyRepo)
+		// Three waiting requests, handled two at a time, take two rounds
+		require.Equal(t, 2*defaultRequestDuration, fullErr.RetryAfter)
+		enqueue(quietRepo)
+		// Too many requests are waiting in total
+		_, err = q.acquire(context.Background(), quietRepo, "", nil)
+		require.ErrorAs(t, err, &fullErr)
+		require.Equal(t, "too many requests are already queued", fullErr.Reason)
+		require.Equal(t, 2*defaultRequestDuration, fullErr.RetryAfter)
+		// Refused requests don't remain in the queue
+		require.Equal(
+			t,
+			[]repoQueueStats{
+				{RepoURL: busyRepo, Running: 2, Queued: 2},
+				{RepoURL: quietRepo, Queued: 1},
+			},
+			q.stats(),
+		)
+	})
+
+	t.Run("canceled while queued", func(t *testing.T) {
+		q := newRenderQueue(serverQueueConfig{Concurrency: 1})
+		_, err := q.acquire(context.Background(), busyRepo, "", nil)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = q.acquire(ctx, quietRepo, "", func(int) { cancel() })
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(
+			t,
+			[]repoQueueStats{{RepoURL: busyRepo, Running: 1}},
+			q.stats(),
+		)
+	})
+}
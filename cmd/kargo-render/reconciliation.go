@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// reconcilingService is the render.Service used by the server's
+// render.Reconciler. Reconciliations are handled by the Service from the
+// server's current configuration, so they are locked and batched just as
+// requests are, and wait in the queue, behind requests of higher priority.
+type reconcilingService struct {
+	render.Service
+	srv *server
+}
+
+// newReconciler returns a render.Reconciler that reconciles the targets in the
+// provided configuration using the provided server, or nil if there are none.
+func newReconciler(srv *server, cfg *serverConfig) *render.Reconciler {
+	if len(cfg.Reconciliation.Targets) == 0 {
+		return nil
+	}
+	return render.NewReconciler(
+		&reconcilingService{srv: srv},
+		cfg.Reconciliation.Targets,
+		&render.ServiceOptions{LogLevel: render.LogLevel(srv.logger.Level)},
+	)
+}
+
+func (r *reconcilingService) RenderManifests(
+	ctx context.Context,
+	req *render.Request,
+) (render.Response, error) {
+	state := r.srv.state.Load()
+	if state.ring != nil &&
+		state.ring.Owner(req.RepoURL, req.TargetBranch) != state.cfg.Routing.Replica {
+		// The replica that owns the branch reconciles it
+		return render.Response{ActionTaken: render.ActionTakenNone}, nil
+	}
+	release, err := r.srv.queue.acquire(
+		ctx,
+		req.RepoURL,
+		render.PriorityLow,
+		nil,
+	)
+	if err != nil {
+		return render.Response{}, err
+	}
+	defer release()
+	return state.svc.RenderManifests(ctx, req)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestNewReconciler(t *testing.T) {
+	newSvc := func(opts *render.ServiceOptions) render.Service {
+		return &fakeService{opts: opts}
+	}
+	srv, err := newServer(log.New(), &serverConfig{}, newSvc)
+	require.NoError(t, err)
+	require.Nil(t, newReconciler(srv, &serverConfig{}))
+	require.NotNil(
+		t,
+		newReconciler(
+			srv,
+			&serverConfig{
+				Reconciliation: serverReconciliationConfig{
+					Targets: []render.ReconciliationTarget{{
+						RepoURL:      "https://github.com/akuity/gitops",
+						TargetBranch: "env/dev",
+						Schedule:     "@hourly",
+					}},
+				},
+			},
+		),
+	)
+}
+
+func TestReconcilingService(t *testing.T) {
+	const repoURL = "https://github.com/akuity/gitops"
+	var rendered []string
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{
+			Routing: serverRoutingConfig{
+				Replica: "a",
+				Replicas: map[string]string{
+					"a": "http://a.kargo-render:8080",
+					"b": "http://b.kargo-render:8080",
+				},
+			},
+		},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(_ context.Context, req *render.Request) (render.Response, error) {
+					rendered = append(rendered, req.TargetBranch)
+					return render.Response{ActionTaken: render.ActionTakenPushedDirectly}, nil
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	ring := render.NewHashRing([]string{"a", "b"}, 0)
+	svc := &reconcilingService{srv: srv}
+	var owned []string
+	for _, branch := range []string{"env/dev", "env/test", "env/stage", "env/prod"} {
+		res, err := svc.RenderManifests(
+			context.Background(),
+			&render.Request{RepoURL: repoURL, TargetBranch: branch},
+		)
+		require.NoError(t, err)
+		if ring.Owner(repoURL, branch) == "a" {
+			owned = append(owned, branch)
+			require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+		} else {
+			// Branches owned by other replicas are left to them
+			require.Equal(t, render.ActionTakenNone, res.ActionTaken)
+		}
+	}
+	require.Equal(t, owned, rendered)
+}
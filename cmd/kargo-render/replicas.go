@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// forwardedByHeader is the name of the header that identifies the replica that
+// forwarded a rendering request to its owner. Requests bearing it are never
+// forwarded again, so replicas whose configurations disagree about who owns a
+// branch cannot forward a request back and forth.
+const forwardedByHeader = "X-Kargo-Render-Forwarded-By"
+
+// newLocker returns the render.Locker required by the provided configuration,
+// or nil if branches are not to be locked.
+func newLocker(cfg serverLockingConfig) (render.Locker, error) {
+	switch cfg.Backend {
+	case serverLockingBackendRedis:
+		return render.NewRedisLocker(
+			redis.NewClient(&redis.Options{
+				Addr:     cfg.Redis.Addr,
+				Username: cfg.Redis.Username,
+				Password: cfg.Redis.Password,
+				DB:       cfg.Redis.DB,
+			}),
+			cfg.ttl(),
+		), nil
+	case serverLockingBackendLease:
+		restCfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error loading in-cluster Kubernetes config: %w", err)
+		}
+		clientset, err := kubernetes.NewForConfig(restCfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating Kubernetes client: %w", err)
+		}
+		return render.NewLeaseLocker(
+			clientset.CoordinationV1(),
+			cfg.Lease.Namespace,
+			cfg.ttl(),
+		), nil
+	default:
+		return nil, nil
+	}
+}
+
+// newHashRing returns a render.HashRing that assigns branches to the replicas
+// in the provided configuration, or nil if requests are not to be routed.
+func newHashRing(cfg serverRoutingConfig) *render.HashRing {
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+	replicas := make([]string, 0, len(cfg.Replicas))
+	for replica := range cfg.Replicas {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+	return render.NewHashRing(replicas, 0)
+}
+
+// forward sends the provided rendering request, whose body has already been
+// read, to the specified replica and returns the status code and body of its
+// response. The request is forwarded with the provided request ID, so that the
+// replica handles it under the same ID even if the client did not specify one.
+func (s *server) forward(
+	cfg *serverConfig,
+	r *http.Request,
+	data []byte,
+	replica string,
+	requestID string,
+) (int, any) {
+	u := strings.TrimSuffix(cfg.Routing.Replicas[replica], "/") + r.URL.Path
+	fwdReq, err := http.NewRequestWithContext(
+		r.Context(),
+		http.MethodPost,
+		u,
+		bytes.NewReader(data),
+	)
+	if err != nil {
+		return http.StatusInternalServerError,
+			problem{Detail: fmt.Sprintf("error forwarding request: %s", err)}
+	}
+	for _, header := range []string{"Authorization", "Content-Type"} {
+		if value := r.Header.Get(header); value != "" {
+			fwdReq.Header.Set(header, value)
+		}
+	}
+	fwdReq.Header.Set(requestIDHeader, requestID)
+	fwdReq.Header.Set(forwardedByHeader, cfg.Routing.Replica)
+	res, err := s.client.Do(fwdReq)
+	if err != nil {
+		return http.StatusBadGateway, problem{
+			Detail: fmt.Sprintf(
+				"error forwarding request to replica %q: %s",
+				replica,
+				err,
+			),
+		}
+	}
+	defer res.Body.Close()
+	resData, err := io.ReadAll(res.Body)
+	if err != nil {
+		return http.StatusBadGateway, problem{
+			Detail: fmt.Sprintf(
+				"error reading response from replica %q: %s",
+				replica,
+				err,
+			),
+		}
+	}
+	if res.StatusCode == http.StatusOK {
+		return res.StatusCode, json.RawMessage(resData)
+	}
+	p := problem{}
+	if err = json.Unmarshal(resData, &p); err != nil {
+		return http.StatusBadGateway, problem{
+			Detail: fmt.Sprintf(
+				"error parsing response from replica %q: %s",
+				replica,
+				err,
+			),
+		}
+	}
+	if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		p.retryAfter = time.Duration(secs) * time.Second
+	}
+	return res.StatusCode, p
+}
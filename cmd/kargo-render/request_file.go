@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// loadRequestFile reads a Request from the YAML or JSON document in the
+// specified file, or from the provided reader if the path is "-". If
+// expandEnv is true, references to environment variables of the form $VAR or
+// ${VAR} are replaced with the variables' values before the document is
+// parsed.
+func loadRequestFile(
+	path string,
+	expandEnv bool,
+	stdin io.Reader,
+) (*render.Request, error) {
+	var reqBytes []byte
+	var err error
+	if path == "-" {
+		reqBytes, err = io.ReadAll(stdin)
+	} else {
+		reqBytes, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading request file: %w", err)
+	}
+	if expandEnv {
+		reqBytes = []byte(os.ExpandEnv(string(reqBytes)))
+	}
+	req := &render.Request{}
+	if err = yaml.UnmarshalStrict(reqBytes, req); err != nil {
+		return nil, fmt.Errorf("error parsing request file %s: %w", path, err)
+	}
+	return req, nil
+}
+
+// overrideRequest overwrites fields of the provided Request with every field
+// of the provided overrides that is not a zero value, and returns the
+// resulting Request. Maps and fields of nested structs are merged rather than
+// replaced wholesale.
+func overrideRequest(
+	req *render.Request,
+	overrides *render.Request,
+) (*render.Request, error) {
+	overrideBytes, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request overrides: %w", err)
+	}
+	if err = json.Unmarshal(overrideBytes, req); err != nil {
+		return nil, fmt.Errorf("error applying request overrides: %w", err)
+	}
+	return req, nil
+}
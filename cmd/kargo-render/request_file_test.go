@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestLoadRequestFile(t *testing.T) {
+	const reqYAML = `repoURL: https://github.com/akuity/gitops
+targetBranch: env/${ENV_NAME}
+images:
+- nginx:1.25
+lastMile:
+  namespace: $ENV_NAME
+`
+	t.Setenv("ENV_NAME", "dev")
+	path := filepath.Join(t.TempDir(), "request.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(reqYAML), 0600))
+
+	testCases := []struct {
+		name       string
+		path       string
+		expandEnv  bool
+		stdin      string
+		assertions func(*testing.T, *render.Request, error)
+	}{
+		{
+			name: "file does not exist",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
+			assertions: func(t *testing.T, _ *render.Request, err error) {
+				require.ErrorContains(t, err, "error reading request file")
+			},
+		},
+		{
+			name:  "unknown field",
+			path:  "-",
+			stdin: "bogus: true\n",
+			assertions: func(t *testing.T, _ *render.Request, err error) {
+				require.ErrorContains(t, err, "error parsing request file -")
+				require.ErrorContains(t, err, "bogus")
+			},
+		},
+		{
+			name: "environment variables not expanded",
+			path: path,
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/${ENV_NAME}", req.TargetBranch)
+			},
+		},
+		{
+			name:      "environment variables expanded",
+			path:      path,
+			expandEnv: true,
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "https://github.com/akuity/gitops", req.RepoURL)
+				require.Equal(t, "env/dev", req.TargetBranch)
+				require.Equal(t, []string{"nginx:1.25"}, req.Images)
+				require.Equal(t, "dev", req.LastMile.Namespace)
+			},
+		},
+		{
+			name:  "JSON from stdin",
+			path:  "-",
+			stdin: `{"localInPath": "/tmp/gitops", "targetBranch": "env/dev"}`,
+			assertions: func(t *testing.T, req *render.Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "/tmp/gitops", req.LocalInPath)
+				require.Equal(t, "env/dev", req.TargetBranch)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req, err := loadRequestFile(
+				testCase.path,
+				testCase.expandEnv,
+				strings.NewReader(testCase.stdin),
+			)
+			testCase.assertions(t, req, err)
+		})
+	}
+}
+
+func TestOverrideRequest(t *testing.T) {
+	req, err := overrideRequest(
+		&render.Request{
+			RepoURL:      "https://github.com/akuity/gitops",
+			TargetBranch: "env/dev",
+			Images:       []string{"nginx:1.25"},
+			LastMile: &render.LastMileOptions{
+				Namespace:    "dev",
+				CommonLabels: map[string]string{"team": "platform"},
+			},
+			RepoCreds: render.RepoCredentials{Username: "git"},
+		},
+		&render.Request{
+			TargetBranch: "env/prod",
+			LastMile: &render.LastMileOptions{
+				CommonLabels: map[string]string{"tier": "web"},
+			},
+			RepoCreds: render.RepoCredentials{Password: "token"},
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		&render.Request{
+			RepoURL:      "https://github.com/akuity/gitops",
+			TargetBranch: "env/prod",
+			Images:       []string{"nginx:1.25"},
+			LastMile: &render.LastMileOptions{
+				Namespace: "dev",
+				CommonLabels: map[string]string{
+					"team": "platform",
+					"tier": "web",
+				},
+			},
+			RepoCreds: render.RepoCredentials{
+				Username: "git",
+				Password: "token",
+			},
+		},
+		req,
+	)
+}
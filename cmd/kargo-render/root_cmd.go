@@ -1,59 +1,129 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
 	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/env"
 )
 
 type rootOptions struct {
 	*render.Request
-	commitMessage string
-	debug         bool
-	outputFormat  string
+	repoClientCertOptions
+	allowedConfigManagement []string
+	apps                    []string
+	cloneCacheDir           string
+	cloneFilter             string
+	cloneStrategy           string
+	commitMessage           string
+	debug                   bool
+	eventSinkURL            string
+	expandEnv               bool
+	httpHeaders             map[string]string
+	keepWorkspace           bool
+	kubeconfig              string
+	kustomizeBinary         string
+	lastMile                render.LastMileOptions
+	localOut                render.LocalOutOptions
+	noProgress              bool
+	outputFormat            string
+	renderTimeout           time.Duration
+	requestFile             string
+	requiredChecks          []string
+	source                  render.SourceContext
+	sshAgent                bool
+	stdoutFormat            string
+	toolEnv                 []string
+	trustedKeyPaths         []string
+	userAgent               string
 }
 
 func newRootCommand() *cobra.Command {
+	// Rendering is what the root command does when no subcommand is specified,
+	// so it is built just like the render subcommand is, ensuring the two
+	// never differ
+	cmd := newRenderCommand()
+	cmd.Use = "kargo-render"
+	// Errors are presented by main, concisely unless --debug is specified
+	cmd.SilenceErrors = true
+
+	// Register the subcommands.
+	cmd.AddCommand(newActionCommand())
+	cmd.AddCommand(newDoctorCommand())
+	cmd.AddCommand(newRenderCommand())
+	cmd.AddCommand(newServerCommand())
+	cmd.AddCommand(newTestCommand())
+	cmd.AddCommand(newVersionCommand())
+	cmd.AddCommand(newWarmUpCommand())
+	cmd.AddCommand(newWorkerCommand())
+
+	return cmd
+}
+
+func newRenderCommand() *cobra.Command {
 	cmdOpts := &rootOptions{
 		Request: &render.Request{},
 	}
 
 	cmd := &cobra.Command{
-		Use: "kargo-render",
+		Use: "render",
 		Short: "Render stage-specific manifests into a specific branch of " +
 			"a remote gitops repo",
 		DisableAutoGenTag: true,
 		SilenceUsage:      true,
-		CompletionOptions: cobra.CompletionOptions{
-			DisableDefaultCmd: true,
-		},
-		Args:   cobra.NoArgs,
-		PreRun: cmdOpts.preRun,
+		Args:              cobra.NoArgs,
+		PreRun:            cmdOpts.preRun,
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			return cmdOpts.run(cmd.Context(), cmd.OutOrStdout())
+			return cmdOpts.run(cmd.Context(), cmd.InOrStdin(), cmd.OutOrStdout())
 		},
 	}
 
 	// Register the option flags on the command.
 	cmdOpts.addFlags(cmd)
-
-	// Register the subcommands.
-	cmd.AddCommand(newActionCommand())
-	cmd.AddCommand(newVersionCommand())
+	if err := cmd.RegisterFlagCompletionFunc(
+		flagTargetBranch,
+		completeTargetBranches(func(cmd *cobra.Command) branchSource {
+			setRepoCredsFromEnv(cmd)
+			userConfigPath, required := userConfigPath()
+			_ = applyUserConfig(cmd, userConfigPath, required)
+			_ = cmdOpts.repoClientCertOptions.load(&cmdOpts.RepoCreds)
+			return branchSource{
+				repoURL:   cmdOpts.RepoURL,
+				ref:       cmdOpts.Ref,
+				repoCreds: cmdOpts.RepoCreds,
+				localPath: cmdOpts.LocalInPath,
+			}
+		}),
+	); err != nil {
+		panic(fmt.Errorf("could not register completions of %s flag", flagTargetBranch))
+	}
 
 	return cmd
 }
 
 // addFlags adds the flags for the root options to the provided command.
 func (o *rootOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&o.AdoptBranch,
+		flagAdoptBranch,
+		false,
+		"Take ownership of the target branch if it exists, but is not managed "+
+			"by Kargo Render, deleting any of its contents not preserved by its "+
+			"configuration. Combine with --read-only to list what would be "+
+			"deleted without deleting anything.",
+	)
+
 	cmd.Flags().BoolVar(
 		&o.AllowEmpty,
 		flagAllowEmpty,
@@ -62,6 +132,41 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 			"disallowed as a safeguard.",
 	)
 
+	cmd.Flags().StringSliceVar(
+		&o.allowedConfigManagement,
+		flagAllowedConfigManagement,
+		nil,
+		"A comma-separated list of configuration management tools (directory, "+
+			"helm, kustomize, or plugin) that may be used to render manifests. If "+
+			"not specified, all tools are allowed.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.cloneCacheDir,
+		flagCloneCacheDir,
+		"",
+		"A directory containing mirrors of remote gitops repositories, created "+
+			"using the warm-up command. If it contains a mirror of the remote "+
+			"repository, objects are copied from it instead of being fetched.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.cloneFilter,
+		flagCloneFilter,
+		"",
+		"The filter spec (see git rev-list --filter) used by partial clones. If "+
+			"not specified, the contents of all files are fetched only when they "+
+			"are needed.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.cloneStrategy,
+		flagCloneStrategy,
+		"",
+		"How much of the remote gitops repository to fetch when cloning it "+
+			"(full, shallow, or partial). Defaults to full.",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.commitMessage,
 		flagCommitMessage,
@@ -78,6 +183,40 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 		"Display debug output.",
 	)
 
+	cmd.Flags().StringVar(
+		&o.eventSinkURL,
+		flagEventSinkURL,
+		"",
+		"An HTTP endpoint to which CloudEvents describing the progress and "+
+			"outcome of rendering should be sent.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.expandEnv,
+		flagExpandEnv,
+		false,
+		"Replace references to environment variables, of the form $VAR or "+
+			"${VAR}, in the file specified by --"+flagRequestFile+" with the "+
+			"variables' values.",
+	)
+
+	cmd.Flags().StringToStringVar(
+		&o.httpHeaders,
+		flagHTTPHeader,
+		nil,
+		"An additional header, of the form name=value, to send with every "+
+			"HTTP(S) request made to the git provider, whether by git or to the "+
+			"provider's API. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.userAgent,
+		flagUserAgent,
+		"",
+		"The User-Agent header to send with every HTTP(S) request made to the "+
+			"git provider. Defaults to kargo-render/<version>.",
+	)
+
 	cmd.Flags().StringArrayVarP(
 		&o.Images,
 		flagImage,
@@ -87,6 +226,73 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 			"used more than once.",
 	)
 
+	cmd.Flags().StringToStringVar(
+		&o.lastMile.CommonLabels,
+		flagLabel,
+		nil,
+		"A label, of the form key=value, to be added to all resources during "+
+			"last-mile rendering. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringToStringVar(
+		&o.lastMile.CommonAnnotations,
+		flagAnnotation,
+		nil,
+		"An annotation, of the form key=value, to be added to all resources "+
+			"during last-mile rendering. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.lastMile.Namespace,
+		flagNamespace,
+		"",
+		"A namespace to be set on all namespaced resources during last-mile "+
+			"rendering.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.lastMile.NameSuffix,
+		flagNameSuffix,
+		"",
+		"A suffix to be appended to the names of all resources during "+
+			"last-mile rendering.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.keepWorkspace,
+		flagKeepWorkspace,
+		false,
+		"Preserve temporary working directories when rendering fails so they "+
+			"may be inspected. Their location is included in the error message.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.sshAgent,
+		flagSSHAgent,
+		false,
+		"Hold SSH private keys in memory, in an SSH agent run by this process, "+
+			"instead of writing them to disk.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.kubeconfig,
+		flagKubeconfig,
+		"",
+		"Path to a kubeconfig file containing any contexts referenced by "+
+			"branch configuration for discovering cluster capabilities. If not "+
+			"specified, the KUBECONFIG environment variable or ~/.kube/config is "+
+			"used.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.kustomizeBinary,
+		flagKustomizeBinary,
+		"",
+		"Path to the kustomize binary used to render Kustomize-based apps. If "+
+			"not specified, kustomize is found using the PATH environment "+
+			"variable.",
+	)
+
 	cmd.Flags().StringVar(
 		&o.LocalInPath,
 		flagLocalInPath,
@@ -102,6 +308,30 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 			"gitops repository. The path must NOT already exist.",
 	)
 
+	cmd.Flags().BoolVar(
+		&o.localOut.ExcludeMetadata,
+		flagLocalOutExcludeMetadata,
+		false,
+		"Omit Kargo Render's branch metadata from what is written to the path "+
+			"specified by --"+flagLocalOutPath+".",
+	)
+
+	cmd.Flags().StringVar(
+		(*string)(&o.localOut.Format),
+		flagLocalOutFormat,
+		"",
+		"The form in which rendered manifests are written to the path specified "+
+			"by --"+flagLocalOutPath+" (directory or tar). Defaults to directory.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.localOut.ManifestsOnly,
+		flagLocalOutManifestsOnly,
+		false,
+		"Write only rendered manifests, and none of the target branch's other "+
+			"files, to the path specified by --"+flagLocalOutPath+".",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.outputFormat,
 		flagOutput,
@@ -110,6 +340,31 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 		"Specify a format for command output (json or yaml).",
 	)
 
+	cmd.Flags().BoolVar(
+		&o.noProgress,
+		flagNoProgress,
+		false,
+		"Do not report the progress of rendering to stderr.",
+	)
+
+	cmd.Flags().DurationVar(
+		&o.renderTimeout,
+		flagRenderTimeout,
+		0,
+		"The maximum amount of time, e.g. 2m, rendering the manifests of any "+
+			"single app may take. If not specified, there is no limit.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.requestFile,
+		flagRequestFile,
+		"f",
+		"",
+		"Path to a YAML or JSON file containing a rendering request, or - to "+
+			"read one from stdin. Flags override the corresponding fields of the "+
+			"request.",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.Ref,
 		flagRef,
@@ -119,6 +374,50 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 			"input. If this is not provided, Kargo Render renders from HEAD.",
 	)
 
+	cmd.Flags().StringVar(
+		&o.PushURL,
+		flagPushURL,
+		"",
+		"The URL of the remote gitops repository to push to and open pull "+
+			"requests in, when the repository specified by --"+flagRepo+" is a "+
+			"read-only mirror of it.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.source.Branch,
+		flagSourceBranch,
+		"",
+		"The name of the branch the source commit was taken from, to be "+
+			"recorded in the commit, any pull request, and the target branch's "+
+			"metadata.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.source.Tag,
+		flagSourceTag,
+		"",
+		"The name of a tag pointing to the source commit, to be recorded like "+
+			"--"+flagSourceBranch+".",
+	)
+
+	cmd.Flags().StringVar(
+		&o.source.RunURL,
+		flagSourceRunURL,
+		"",
+		"The URL of the CI run or pipeline that triggered rendering, to be "+
+			"recorded like --"+flagSourceBranch+".",
+	)
+
+	cmd.Flags().StringVar(
+		&o.RefPath,
+		flagRefPath,
+		"",
+		"A path within the input from which to render manifests when the "+
+			"configuration for the target branch does not define any apps. If "+
+			"this is not provided, Kargo Render renders from a path matching the "+
+			"name of the target branch.",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.RepoURL,
 		flagRepo,
@@ -127,6 +426,24 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 		"The URL of a remote gitops repository.",
 	)
 
+	cmd.Flags().StringToStringVar(
+		&o.RepoCreds.ExtraHTTPHeaders,
+		flagRepoAuthHeader,
+		nil,
+		"A header, of the form name=value, to send with every HTTP(S) request "+
+			"git makes to the remote gitops repository, for servers that expect "+
+			"a token in a header (e.g. PRIVATE-TOKEN) instead of basic auth. "+
+			"This flag may be used more than once.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.RepoCreds.Netrc,
+		flagRepoNetrc,
+		false,
+		"Supply the username and password to git using a .netrc file in an "+
+			"isolated home directory instead of git's credential store.",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.RepoCreds.Password,
 		flagRepoPassword,
@@ -147,6 +464,45 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 			"environment variable.",
 	)
 
+	o.repoClientCertOptions.addFlags(cmd)
+
+	cmd.Flags().BoolVar(
+		&o.RequireBranchConfig,
+		flagRequireBranchConfig,
+		false,
+		"Fail if the repository's configuration does not explicitly provide "+
+			"configuration for the target branch instead of falling back to "+
+			"rendering from a path named after the target branch.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.RequireImageMatches,
+		flagRequireImageMatches,
+		false,
+		"Fail if any image specified using --image does not match any image "+
+			"referenced by the manifests of any app.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.SkipPromotionOrder,
+		flagSkipPromotionOrder,
+		false,
+		"Render into the target branch even if the source commit has not yet "+
+			"been rendered into the branch preceding it in the repository's "+
+			"configured promotion order.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.Offline,
+		flagOffline,
+		false,
+		"Fail fast instead of rendering if doing so would require network "+
+			"access beyond that to the remote gitops repository, e.g. to fetch "+
+			"remote Kustomize bases or Helm chart dependencies that are not "+
+			"vendored, or to use the git provider's API. For air-gapped "+
+			"environments to which all dependencies have been mirrored.",
+	)
+
 	cmd.Flags().BoolVar(
 		&o.Stdout,
 		flagStdout,
@@ -154,6 +510,25 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 		"Write rendered manifests to stdout instead of the remote gitops repo.",
 	)
 
+	cmd.Flags().StringArrayVar(
+		&o.apps,
+		flagApp,
+		nil,
+		"Write only the rendered manifests of the specified app to stdout. May "+
+			"be specified multiple times. Requires --"+flagStdout+".",
+	)
+
+	cmd.Flags().StringVar(
+		&o.stdoutFormat,
+		flagStdoutFormat,
+		flagStdoutFormatText,
+		"The form in which rendered manifests are written to stdout (text, "+
+			"yaml, or json). text separates each app's manifests with a header, "+
+			"yaml concatenates them as a single YAML stream suitable for kubectl, "+
+			"and json writes an object whose keys are app names and whose values "+
+			"are the apps' manifests. Requires --"+flagStdout+".",
+	)
+
 	cmd.Flags().StringVarP(
 		&o.TargetBranch,
 		flagTargetBranch,
@@ -161,12 +536,59 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 		"",
 		"The branch of the remote gitops repository to write rendered manifests into.",
 	)
-	if err := cmd.MarkFlagRequired(flagTargetBranch); err != nil {
-		panic(fmt.Errorf("could not mark %s flag as required", flagTargetBranch))
-	}
 
-	// Make sure input source is specified and unambiguous.
-	cmd.MarkFlagsOneRequired(flagRepo, flagLocalInPath)
+	cmd.Flags().StringArrayVar(
+		&o.requiredChecks,
+		flagRequiredCheck,
+		nil,
+		"The name of a status check that must have passed on the source commit. "+
+			"Checks are looked up using the GitHub API with the repository "+
+			"password as a token. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.trustedKeyPaths,
+		flagTrustedKey,
+		nil,
+		"Path to an ASCII-armored OpenPGP public key or an SSH public key. When "+
+			"specified, rendering is refused unless the source commit is signed by "+
+			"one of the specified keys. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&o.toolEnv,
+		flagToolEnv,
+		nil,
+		"An environment variable, of the form tool=name, that processes running "+
+			"the specified tool (helm, kustomize, or ytt) may inherit. Other "+
+			"variables, apart from a few harmless ones, are removed from the "+
+			"environment before rendering. A name ending in * matches every "+
+			"variable with that prefix. This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringToStringVar(
+		&o.Options,
+		flagOption,
+		nil,
+		"An option, of the form name=value, that toggles an experimental "+
+			"behavior. Supported options are skipLastMile (true or false), "+
+			"diffAlgorithm (semantic or exact), traceCommands (true or false), "+
+			"migrateLayout (true or false), and pushViaAPI (true or false). "+
+			"This flag may be used more than once.",
+	)
+
+	cmd.Flags().StringToStringVar(
+		&o.Vars,
+		flagVar,
+		nil,
+		"A variable, of the form name=value, that may be referenced by "+
+			"configuration for the target branch using a placeholder of the form "+
+			"${var:name}. This flag may be used more than once.",
+	)
+
+	// Make sure input source is unambiguous. Since the target branch and input
+	// source may instead be specified by a request file, run checks that they
+	// are specified at all.
 	cmd.MarkFlagsMutuallyExclusive(flagRepo, flagLocalInPath)
 	// And the ref flag cannot be combined with the local input path..
 	cmd.MarkFlagsMutuallyExclusive(flagRef, flagLocalInPath)
@@ -176,55 +598,353 @@ func (o *rootOptions) addFlags(cmd *cobra.Command) {
 }
 
 func (o *rootOptions) preRun(cmd *cobra.Command, _ []string) {
+	setRepoCredsFromEnv(cmd)
+	// Defaults from the user-level configuration file rank below environment
+	// variables, so they're applied only after flags have been set from those
+	userConfigPath, required := userConfigPath()
+	if err := applyUserConfig(cmd, userConfigPath, required); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// envPrefix is the prefix of the names of all environment variables that
+// configure the CLI.
+const envPrefix = "KARGO_RENDER_"
+
+// envOptions is configuration read from environment variables whose names
+// begin with envPrefix.
+type envOptions struct {
+	RepoUsername   string
+	RepoPassword   string
+	RepoClientCert string
+	RepoClientKey  string
+}
+
+// setRepoCredsFromEnv sets any repository credential flags of the provided
+// command that were not specified explicitly using the values of the
+// corresponding environment variables, if any.
+func setRepoCredsFromEnv(cmd *cobra.Command) {
+	envOpts := envOptions{}
+	if err := env.PrefixScan(envPrefix, &envOpts); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	cmd.Flags().VisitAll(
 		func(flag *pflag.Flag) {
+			var envVarValue string
 			switch flag.Name {
-			case flagRepoPassword, flagRepoUsername:
-				if !flag.Changed {
-					envVarName := fmt.Sprintf(
-						"KARGO_RENDER_%s",
-						strings.ReplaceAll(
-							strings.ToUpper(flag.Name),
-							"-",
-							"_",
-						),
-					)
-					envVarValue := os.Getenv(envVarName)
-					if envVarValue != "" {
-						if err := cmd.Flags().Set(flag.Name, envVarValue); err != nil {
-							fmt.Println(err)
-							os.Exit(1)
-						}
-					}
-				}
+			case flagRepoPassword:
+				envVarValue = envOpts.RepoPassword
+			case flagRepoUsername:
+				envVarValue = envOpts.RepoUsername
+			case flagRepoClientCert:
+				envVarValue = envOpts.RepoClientCert
+			case flagRepoClientKey:
+				envVarValue = envOpts.RepoClientKey
+			}
+			if flag.Changed || envVarValue == "" {
+				return
+			}
+			if err := cmd.Flags().Set(flag.Name, envVarValue); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
 			}
 		},
 	)
 }
 
+// repoClientCertOptions are options for specifying a TLS client certificate
+// for authenticating to a remote gitops repository.
+type repoClientCertOptions struct {
+	repoClientCertPath string
+	repoClientKeyPath  string
+}
+
+// addFlags adds flags for the TLS client certificate options to the provided
+// command.
+func (o *repoClientCertOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.repoClientCertPath,
+		flagRepoClientCert,
+		"",
+		"Path to a PEM-encoded TLS client certificate for authenticating to a "+
+			"remote gitops repository that requires mutual TLS. Can alternatively "+
+			"be specified using the KARGO_RENDER_REPO_CLIENT_CERT environment "+
+			"variable.",
+	)
+	cmd.Flags().StringVar(
+		&o.repoClientKeyPath,
+		flagRepoClientKey,
+		"",
+		"Path to the PEM-encoded private key for the TLS client certificate. Can "+
+			"alternatively be specified using the KARGO_RENDER_REPO_CLIENT_KEY "+
+			"environment variable.",
+	)
+}
+
+// load reads the TLS client certificate and key, if specified, into the
+// provided credentials.
+func (o *repoClientCertOptions) load(creds *render.RepoCredentials) error {
+	if o.repoClientCertPath == "" && o.repoClientKeyPath == "" {
+		return nil
+	}
+	if o.repoClientCertPath == "" || o.repoClientKeyPath == "" {
+		return fmt.Errorf(
+			"--%s and --%s must be specified together",
+			flagRepoClientCert,
+			flagRepoClientKey,
+		)
+	}
+	certBytes, err := os.ReadFile(o.repoClientCertPath)
+	if err != nil {
+		return fmt.Errorf("error reading TLS client certificate: %w", err)
+	}
+	keyBytes, err := os.ReadFile(o.repoClientKeyPath)
+	if err != nil {
+		return fmt.Errorf("error reading TLS client key: %w", err)
+	}
+	creds.ClientCertificate = string(certBytes)
+	creds.ClientKey = string(keyBytes)
+	return nil
+}
+
+// readTrustedKeys reads the public keys in the files at the specified paths.
+func readTrustedKeys(paths []string) ([]string, error) {
+	keys := make([]string, len(paths))
+	for i, path := range paths {
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading trusted key: %w", err)
+		}
+		keys[i] = string(keyBytes)
+	}
+	return keys, nil
+}
+
+// parseToolEnv converts the provided values of the --tool-env flag, each of
+// the form tool=name, to names of environment variables indexed by tool.
+func parseToolEnv(values []string) (map[string][]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	toolEnv := map[string][]string{}
+	for _, value := range values {
+		tool, name, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf(
+				"--%s value %q is invalid; expected tool=name",
+				flagToolEnv,
+				value,
+			)
+		}
+		switch tool {
+		case "helm", "kustomize", "ytt":
+		default:
+			return nil, fmt.Errorf(
+				"--%s value %q is invalid; valid tools are helm, kustomize, and ytt",
+				flagToolEnv,
+				value,
+			)
+		}
+		toolEnv[tool] = append(toolEnv[tool], name)
+	}
+	return toolEnv, nil
+}
+
 // run performs manifest rendering.
-func (o *rootOptions) run(ctx context.Context, out io.Writer) error {
+func (o *rootOptions) run(
+	ctx context.Context,
+	in io.Reader,
+	out io.Writer,
+) error {
+	if err := o.repoClientCertOptions.load(&o.RepoCreds); err != nil {
+		return err
+	}
+
+	switch render.CloneStrategy(o.cloneStrategy) {
+	case "",
+		render.CloneStrategyFull,
+		render.CloneStrategyShallow,
+		render.CloneStrategyPartial:
+	default:
+		return fmt.Errorf(
+			"--%s %q is unsupported; supported strategies are full, shallow, and "+
+				"partial",
+			flagCloneStrategy,
+			o.cloneStrategy,
+		)
+	}
+
+	if o.lastMile.NameSuffix != "" || o.lastMile.Namespace != "" ||
+		len(o.lastMile.CommonLabels) > 0 || len(o.lastMile.CommonAnnotations) > 0 {
+		o.LastMile = &o.lastMile
+	}
+
+	if o.localOut != (render.LocalOutOptions{}) {
+		o.LocalOut = &o.localOut
+	}
+
+	if o.source != (render.SourceContext{}) {
+		o.Source = &o.source
+	}
+
+	if o.requestFile != "" {
+		req, err := loadRequestFile(o.requestFile, o.expandEnv, in)
+		if err != nil {
+			return err
+		}
+		if o.Request, err = overrideRequest(req, o.Request); err != nil {
+			return err
+		}
+	}
+	if !o.Stdout && (len(o.apps) > 0 || o.stdoutFormat != flagStdoutFormatText) {
+		return fmt.Errorf(
+			"--%s and --%s may only be specified with --%s",
+			flagApp,
+			flagStdoutFormat,
+			flagStdout,
+		)
+	}
+	switch o.stdoutFormat {
+	case flagStdoutFormatText, flagOutputYAML, flagOutputJSON:
+	default:
+		return fmt.Errorf(
+			"--%s %q is unsupported; supported formats are text, yaml, and json",
+			flagStdoutFormat,
+			o.stdoutFormat,
+		)
+	}
+	if o.TargetBranch == "" {
+		return fmt.Errorf(
+			"--%s must be specified, either as a flag or in a request file",
+			flagTargetBranch,
+		)
+	}
+	if o.RepoURL == "" && o.LocalInPath == "" {
+		return fmt.Errorf(
+			"one of --%s or --%s must be specified, either as a flag or in a "+
+				"request file",
+			flagRepo,
+			flagLocalInPath,
+		)
+	}
+
+	// An invalid request is refused before anything else is done, including
+	// emitting events
+	if err := render.ValidateRequest(o.Request); err != nil {
+		return err
+	}
+
+	var commitSignaturePolicies []render.CommitSignaturePolicy
+	if len(o.trustedKeyPaths) > 0 {
+		trustedKeys, err := readTrustedKeys(o.trustedKeyPaths)
+		if err != nil {
+			return err
+		}
+		commitSignaturePolicies = []render.CommitSignaturePolicy{
+			{TrustedKeys: trustedKeys},
+		}
+	}
+
+	toolEnv, err := parseToolEnv(o.toolEnv)
+	if err != nil {
+		return err
+	}
+	// Argo CD passes the entire environment of the process to helm and
+	// kustomize, so variables they mustn't inherit are removed from it
+	if err = render.RestrictProcessEnv(toolEnv); err != nil {
+		return err
+	}
+
+	var requiredChecksPolicies []render.RequiredChecksPolicy
+	if len(o.requiredChecks) > 0 {
+		requiredChecksPolicies = []render.RequiredChecksPolicy{
+			{Checks: o.requiredChecks},
+		}
+	}
+
 	logLevel := render.LogLevelError
 	if o.debug {
 		logLevel = render.LogLevelDebug
 	}
+	logger := log.New()
+	logger.SetLevel(log.Level(logLevel))
+	prepareHost(logger)
+
+	var eventSink render.EventSink
+	if o.eventSinkURL != "" {
+		// Events are delivered in the background, so any still queued when
+		// rendering is done must be delivered before the command exits
+		asyncSink := render.NewAsyncEventSink(
+			render.NewHTTPEventSink(o.eventSinkURL, nil),
+			0,
+		)
+		defer flushEvents(logger, asyncSink)
+		eventSink = asyncSink
+	}
+
+	// Progress goes to stderr so that stdout is left for machine readable
+	// output
+	var progressFn func(render.Progress)
+	if !o.noProgress {
+		progressFn = newProgressPrinter(os.Stderr)
+	}
 
 	svc := render.NewService(
 		&render.ServiceOptions{
-			LogLevel: logLevel,
+			LogLevel:              logLevel,
+			KeepWorkspacesOnError: o.keepWorkspace,
+			Kubeconfig:            o.kubeconfig,
+			AllowedConfigManagement: configManagementTools(
+				o.allowedConfigManagement,
+			),
+			CommitSignaturePolicies: commitSignaturePolicies,
+			RequiredChecksPolicies:  requiredChecksPolicies,
+			EventSink:               eventSink,
+			CloneCacheDir:           o.cloneCacheDir,
+			CloneStrategy:           render.CloneStrategy(o.cloneStrategy),
+			CloneFilter:             o.cloneFilter,
+			UserAgent:               o.userAgent,
+			HTTPHeaders:             o.httpHeaders,
+			KustomizeBinaryPath:     o.kustomizeBinary,
+			RenderTimeout:           o.renderTimeout,
+			ProgressFn:              progressFn,
+			SSHAgent:                o.sshAgent,
+			ToolEnv:                 toolEnv,
 		},
 	)
 
 	res, err := svc.RenderManifests(ctx, o.Request)
 	if err != nil {
+		// Commands traced before the failure are the most useful for
+		// reproducing it
+		if res.Diagnostics != nil {
+			fmt.Fprintln(os.Stderr, "Commands executed before the error:")
+			for _, command := range res.Diagnostics.Commands {
+				fmt.Fprintf(
+					os.Stderr,
+					"  %s (exit code %d, %s)\n",
+					command.Command,
+					command.ExitCode,
+					command.Duration,
+				)
+			}
+		}
 		return err
 	}
 
+	if len(o.apps) > 0 {
+		if res.Manifests, err = selectApps(res.Manifests, o.apps); err != nil {
+			return err
+		}
+	}
+
 	if o.outputFormat == "" {
 		switch res.ActionTaken {
 		case render.ActionTakenNone:
 			if o.Stdout {
-				return manifestsToStdout(res.Manifests, out)
+				return manifestsToStdout(res.Manifests, out, o.stdoutFormat)
 			}
 			fmt.Fprintln(
 				out,
@@ -256,6 +976,22 @@ func (o *rootOptions) run(ctx context.Context, out io.Writer) error {
 				o.LocalOutPath,
 			)
 		}
+		for _, prunedApp := range res.PrunedApps {
+			fmt.Fprintf(
+				out,
+				"Pruned output of app %s from %s\n",
+				prunedApp.App,
+				prunedApp.Path,
+			)
+		}
+		for _, path := range res.AdoptionDeletedPaths {
+			if res.ActionTaken == render.ActionTakenNone ||
+				res.ActionTaken == render.ActionTakenWroteToLocalPath {
+				fmt.Fprintf(out, "Adopting the branch would delete %s\n", path)
+			} else {
+				fmt.Fprintf(out, "Deleted %s while adopting the branch\n", path)
+			}
+		}
 	} else {
 		if err := output(res, out, o.outputFormat); err != nil {
 			return err
@@ -265,12 +1001,56 @@ func (o *rootOptions) run(ctx context.Context, out io.Writer) error {
 	return nil
 }
 
-func manifestsToStdout(manifests map[string][]byte, out io.Writer) error {
+// selectApps returns only the manifests of the specified apps from the
+// provided manifests, which are indexed by app name. An error is returned if
+// any of the specified apps has no manifests.
+func selectApps(
+	manifests map[string][]byte,
+	apps []string,
+) (map[string][]byte, error) {
+	selected := make(map[string][]byte, len(apps))
+	for _, app := range apps {
+		appManifests, ok := manifests[app]
+		if !ok {
+			return nil, fmt.Errorf("app %q is not rendered into the target branch", app)
+		}
+		selected[app] = appManifests
+	}
+	return selected, nil
+}
+
+// manifestsToStdout writes the provided manifests, which are indexed by app
+// name, to the provided writer in the specified format.
+func manifestsToStdout(
+	manifests map[string][]byte,
+	out io.Writer,
+	format string,
+) error {
 	apps := make([]string, 0, len(manifests))
 	for k := range manifests {
 		apps = append(apps, k)
 	}
 	sort.StringSlice(apps).Sort()
+	switch format {
+	case flagOutputJSON:
+		appManifests := make(map[string]string, len(manifests))
+		for app, yamlBytes := range manifests {
+			appManifests[app] = string(yamlBytes)
+		}
+		return output(appManifests, out, flagOutputJSON)
+	case flagOutputYAML:
+		for i, app := range apps {
+			yamlBytes := manifests[app]
+			if i > 0 {
+				fmt.Fprintln(out, "---")
+			}
+			fmt.Fprint(out, string(yamlBytes))
+			if len(yamlBytes) > 0 && !bytes.HasSuffix(yamlBytes, []byte("\n")) {
+				fmt.Fprintln(out)
+			}
+		}
+		return nil
+	}
 	for _, app := range apps {
 		const sep = "--------------------------------------------------"
 		fmt.Fprintln(out, sep)
@@ -280,3 +1060,19 @@ func manifestsToStdout(manifests map[string][]byte, out io.Writer) error {
 	}
 	return nil
 }
+
+// configManagementTools converts the provided tool names to
+// render.ConfigManagementTools. If names is nil, nil is returned, which
+// indicates all tools are allowed.
+func configManagementTools(names []string) []render.ConfigManagementTool {
+	if names == nil {
+		return nil
+	}
+	tools := make([]render.ConfigManagementTool, len(names))
+	for i, name := range names {
+		tools[i] = render.ConfigManagementTool(
+			strings.ToLower(strings.TrimSpace(name)),
+		)
+	}
+	return tools
+}
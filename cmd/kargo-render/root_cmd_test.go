@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCommand(t *testing.T) {
+	root := newRootCommand()
+	renderCmd, _, err := root.Find([]string{"render"})
+	require.NoError(t, err)
+	require.Equal(t, "render", renderCmd.Name())
+	// The render subcommand accepts every flag the root command does
+	root.Flags().VisitAll(func(flag *pflag.Flag) {
+		require.NotNil(t, renderCmd.Flags().Lookup(flag.Name), flag.Name)
+	})
+
+	serveCmd, _, err := root.Find([]string{"serve"})
+	require.NoError(t, err)
+	require.Equal(t, "server", serveCmd.Name())
+}
+
+func TestSelectApps(t *testing.T) {
+	manifests := map[string][]byte{
+		"foo": []byte("kind: ConfigMap\n"),
+		"bar": []byte("kind: Secret\n"),
+	}
+	selected, err := selectApps(manifests, []string{"bar"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"bar": []byte("kind: Secret\n")}, selected)
+
+	_, err = selectApps(manifests, []string{"baz"})
+	require.ErrorContains(t, err, `app "baz" is not rendered`)
+}
+
+func TestManifestsToStdout(t *testing.T) {
+	manifests := map[string][]byte{
+		"foo": []byte("kind: ConfigMap\n"),
+		"bar": []byte("kind: Secret"),
+	}
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: flagStdoutFormatText,
+			expected: "--------------------------------------------------\n" +
+				"App: bar\n" +
+				"--------------------------------------------------\n" +
+				"kind: Secret\n" +
+				"--------------------------------------------------\n" +
+				"App: foo\n" +
+				"--------------------------------------------------\n" +
+				"kind: ConfigMap\n\n",
+		},
+		{
+			format:   flagOutputYAML,
+			expected: "kind: Secret\n---\nkind: ConfigMap\n",
+		},
+		{
+			format: flagOutputJSON,
+			expected: "{\n" +
+				"  \"bar\": \"kind: Secret\",\n" +
+				"  \"foo\": \"kind: ConfigMap\\n\"\n" +
+				"}\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			require.NoError(t, manifestsToStdout(manifests, out, testCase.format))
+			require.Equal(t, testCase.expected, out.String())
+		})
+	}
+}
+
+func TestParseToolEnv(t *testing.T) {
+	toolEnv, err := parseToolEnv(nil)
+	require.NoError(t, err)
+	require.Nil(t, toolEnv)
+
+	toolEnv, err = parseToolEnv(
+		[]string{"helm=AWS_PROFILE", "helm=HELM_S3_*", "ytt=DATA"},
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		map[string][]string{
+			"helm": {"AWS_PROFILE", "HELM_S3_*"},
+			"ytt":  {"DATA"},
+		},
+		toolEnv,
+	)
+
+	_, err = parseToolEnv([]string{"helm"})
+	require.ErrorContains(t, err, "expected tool=name")
+
+	_, err = parseToolEnv([]string{"cue=FOO"})
+	require.ErrorContains(t, err, "valid tools are helm, kustomize, and ytt")
+}
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// maxRequestBytes is the maximum size of a rendering request the server will
+// read.
+const maxRequestBytes = 1 << 20
+
+// server is an http.Handler that accepts JSON-encoded rendering requests. Its
+// configuration can be replaced while it is running by calling reload.
+type server struct {
+	logger  *log.Logger
+	newSvc  func(*render.ServiceOptions) render.Service
+	state   atomic.Pointer[serverState]
+	mux     *http.ServeMux
+	metrics *serverMetrics
+	queue   *renderQueue
+	jobs    *renderJobs
+	// idempotency records the outcomes of requests bearing idempotency keys. It
+	// outlives reloads of the configuration so that retries are recognized
+	// regardless.
+	idempotency render.IdempotencyStore
+	// locker, if non-nil, locks branches so that replicas do not render into
+	// the same branch at once.
+	locker render.Locker
+	// client forwards rendering requests to the replicas that own them.
+	client *http.Client
+}
+
+// serverState is the part of the server that is replaced when its
+// configuration is reloaded.
+type serverState struct {
+	cfg  *serverConfig
+	svc  render.Service
+	cert *tls.Certificate
+	// ring, if non-nil, assigns each branch to the replica that renders it.
+	ring *render.HashRing
+}
+
+// serverMetrics are the Prometheus metrics exposed by the server.
+type serverMetrics struct {
+	requests  *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	queueWait *prometheus.HistogramVec
+	cloneSize *prometheus.HistogramVec
+}
+
+// newServer returns a server using the provided configuration. The provided
+// function is used to construct the Service that handles requests each time
+// the configuration is loaded. Whether metrics are exposed, and at what path,
+// whether profiling data is exposed, how many requests are handled at once,
+// for how long the outcomes of requests bearing idempotency keys are recorded,
+// and how branches are locked are determined by the initial configuration
+// only.
+func newServer(
+	logger *log.Logger,
+	cfg *serverConfig,
+	newSvc func(*render.ServiceOptions) render.Service,
+) (*server, error) {
+	s := &server{
+		logger: logger,
+		newSvc: newSvc,
+		mux:    http.NewServeMux(),
+		queue:  newRenderQueue(cfg.Queue),
+		jobs:   newRenderJobs(),
+		idempotency: render.NewInMemoryIdempotencyStore(
+			cfg.Idempotency.ttl(),
+		),
+		client: &http.Client{},
+	}
+	var err error
+	if s.locker, err = newLocker(cfg.Locking); err != nil {
+		return nil, err
+	}
+	if err = s.reload(cfg); err != nil {
+		return nil, err
+	}
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.mux.HandleFunc("/version", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(getVersionInfo())
+	})
+	s.mux.HandleFunc("/v1alpha1/render", s.handleRender)
+	s.mux.HandleFunc("/v1alpha1/queue", s.handleQueue)
+	s.mux.HandleFunc("/v1alpha1/renders/{id}", s.handleCancel)
+	s.mux.HandleFunc("/v1alpha1/renders/{id}/manifests", s.handleArtifacts)
+	s.mux.HandleFunc("/v1alpha1/renders/{id}/diff", s.handleArtifacts)
+	if cfg.Pprof.Enabled {
+		s.mux.Handle("/debug/pprof/", s.requireAuth(http.HandlerFunc(pprof.Index)))
+		s.mux.Handle("/debug/pprof/cmdline", s.requireAuth(http.HandlerFunc(pprof.Cmdline)))
+		s.mux.Handle("/debug/pprof/profile", s.requireAuth(http.HandlerFunc(pprof.Profile)))
+		s.mux.Handle("/debug/pprof/symbol", s.requireAuth(http.HandlerFunc(pprof.Symbol)))
+		s.mux.Handle("/debug/pprof/trace", s.requireAuth(http.HandlerFunc(pprof.Trace)))
+	}
+	if cfg.Metrics.Enabled {
+		registry := prometheus.NewRegistry()
+		s.metrics = &serverMetrics{
+			requests: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "kargo_render_server_requests_total",
+					Help: "Number of rendering requests handled, by response code.",
+				},
+				[]string{"code"},
+			),
+			duration: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:    "kargo_render_server_request_duration_seconds",
+					Help:    "Time taken to handle rendering requests, by response code.",
+					Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+				},
+				[]string{"code"},
+			),
+			queueWait: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:    "kargo_render_server_queue_wait_seconds",
+					Help:    "Time rendering requests waited to be handled, by priority.",
+					Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+				},
+				[]string{"priority"},
+			),
+			cloneSize: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name: "kargo_render_server_clone_object_bytes",
+					Help: "Size of the objects of the clones of remote repositories " +
+						"made while handling rendering requests, which approximates " +
+						"how much was transferred, by clone strategy.",
+					Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+				},
+				[]string{"strategy"},
+			),
+		}
+		registry.MustRegister(
+			s.metrics.requests,
+			s.metrics.duration,
+			s.metrics.queueWait,
+			s.metrics.cloneSize,
+		)
+		s.mux.Handle(
+			cfg.Metrics.Path,
+			promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		)
+	}
+	return s, nil
+}
+
+// reload replaces the server's configuration. Requests already in progress
+// complete using the previous configuration. The port the server listens on,
+// whether it serves HTTPS, whether it exposes metrics or profiling data, and
+// how branches are locked cannot be changed by reloading, nor can the limits on
+// how many requests are handled at once.
+func (s *server) reload(cfg *serverConfig) error {
+	commitSignaturePolicies := make(
+		[]render.CommitSignaturePolicy,
+		len(cfg.CommitSignaturePolicies),
+	)
+	for i, policy := range cfg.CommitSignaturePolicies {
+		trustedKeys, err := readTrustedKeys(policy.TrustedKeyFiles)
+		if err != nil {
+			return err
+		}
+		commitSignaturePolicies[i] = render.CommitSignaturePolicy{
+			TargetBranchPattern: policy.TargetBranchPattern,
+			TrustedKeys:         trustedKeys,
+		}
+	}
+	requiredChecksPolicies := make(
+		[]render.RequiredChecksPolicy,
+		len(cfg.RequiredChecksPolicies),
+	)
+	for i, policy := range cfg.RequiredChecksPolicies {
+		requiredChecksPolicies[i] = render.RequiredChecksPolicy(policy)
+	}
+	state := &serverState{
+		cfg: cfg,
+		svc: s.decorate(cfg, s.newSvc(
+			&render.ServiceOptions{
+				LogLevel: render.LogLevel(s.logger.Level),
+				AllowedConfigManagement: configManagementTools(
+					cfg.Allowlists.ConfigManagement,
+				),
+				CommitSignaturePolicies: commitSignaturePolicies,
+				RequiredChecksPolicies:  requiredChecksPolicies,
+				CloneCacheDir:           cfg.Cache.CloneCacheDir,
+				CloneStrategy:           render.CloneStrategy(cfg.Clone.Strategy),
+				CloneFilter:             cfg.Clone.Filter,
+				PartialCloneThreshold:   cfg.Clone.PartialThreshold,
+				ArtifactsDir:            cfg.Artifacts.Dir,
+				UserAgent:               cfg.HTTP.UserAgent,
+				HTTPHeaders:             cfg.HTTP.Headers,
+				KustomizeBinaryPath:     cfg.Render.KustomizeBinaryPath,
+				RenderTimeout:           cfg.Render.timeout(),
+				ToolEnv:                 cfg.Render.ToolEnv,
+			},
+		)),
+		ring: newHashRing(cfg.Routing),
+	}
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+		state.cert = &cert
+	}
+	s.state.Store(state)
+	return nil
+}
+
+// decorate returns the provided Service decorated as the provided
+// configuration requires.
+func (s *server) decorate(cfg *serverConfig, svc render.Service) render.Service {
+	if s.locker != nil {
+		svc = render.NewLockingService(svc, s.locker)
+	}
+	if window := cfg.Batching.window(); window > 0 {
+		svc = render.NewBatchingService(svc, window)
+	}
+	// Retries of requests that already succeeded must return the original
+	// response before anything else happens
+	return render.NewIdempotentService(svc, s.idempotency)
+}
+
+// getCertificate returns the TLS certificate from the server's current
+// configuration. It is suitable for use as tls.Config.GetCertificate, which
+// allows the certificate to be rotated by reloading the configuration.
+func (s *server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := s.state.Load().cert; cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("no TLS certificate is configured")
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(requestIDHeader, requestID(r))
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleRender handles a single rendering request.
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	state := s.state.Load()
+	code, body := s.render(state, w, r)
+	if s.metrics != nil {
+		codeStr := strconv.Itoa(code)
+		s.metrics.requests.WithLabelValues(codeStr).Inc()
+		s.metrics.duration.WithLabelValues(codeStr).Observe(
+			time.Since(start).Seconds(),
+		)
+	}
+	if p, ok := body.(problem); ok {
+		writeProblem(w, code, p)
+		return
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		s.logger.WithError(err).Error("error marshaling response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(bodyBytes)
+}
+
+// requireAuth returns an http.Handler that responds with 401 to requests that
+// do not bear one of the tokens in the server's current configuration and
+// passes other requests to the provided http.Handler.
+func (s *server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authenticated(s.state.Load().cfg, r) {
+			writeProblem(
+				w,
+				http.StatusUnauthorized,
+				problem{Detail: "a valid bearer token is required"},
+			)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleQueue reports, for every repository, how many rendering requests are
+// being handled and how many are waiting to be handled.
+func (s *server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(
+			w,
+			http.StatusMethodNotAllowed,
+			problem{Detail: "only GET requests are supported"},
+		)
+		return
+	}
+	if !authenticated(s.state.Load().cfg, r) {
+		writeProblem(
+			w,
+			http.StatusUnauthorized,
+			problem{Detail: "a valid bearer token is required"},
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(queueResponse{Repos: s.queue.stats()})
+}
+
+// handleArtifacts serves the rendered manifests, or the diff they introduced,
+// persisted for a single rendering request. Manifests are served as a JSON
+// object mapping app names to manifests. The diff is served as plain text.
+func (s *server) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	state := s.state.Load()
+	writeError := func(code int, msg string) {
+		writeProblem(w, code, problem{Detail: msg})
+	}
+	if r.Method != http.MethodGet {
+		writeError(http.StatusMethodNotAllowed, "only GET requests are supported")
+		return
+	}
+	if !authenticated(state.cfg, r) {
+		writeError(http.StatusUnauthorized, "a valid bearer token is required")
+		return
+	}
+	if state.cfg.Artifacts.Dir == "" {
+		writeError(http.StatusNotFound, "artifacts are not persisted by this server")
+		return
+	}
+	id := r.PathValue("id")
+	artifacts, err := render.LoadArtifacts(
+		state.cfg.Artifacts.Dir,
+		tenant(state.cfg, r),
+		id,
+	)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(
+			http.StatusNotFound,
+			fmt.Sprintf("no artifacts were found for request %q", id),
+		)
+		return
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("error loading artifacts")
+		writeError(http.StatusInternalServerError, "error loading artifacts")
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/diff") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, artifacts.Diff)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(artifacts.Manifests)
+}
+
+// artifactsPruneInterval is how often persisted artifacts are checked for any
+// that have been kept for longer than their retention period.
+const artifactsPruneInterval = time.Hour
+
+// pruneArtifacts removes persisted artifacts that have been kept for longer
+// than the retention period of the server's current configuration, at once
+// and then periodically, until the provided context is canceled.
+func (s *server) pruneArtifacts(ctx context.Context) {
+	ticker := time.NewTicker(artifactsPruneInterval)
+	defer ticker.Stop()
+	for {
+		if cfg := s.state.Load().cfg; cfg.Artifacts.Dir != "" {
+			removed, err := render.PruneArtifacts(
+				cfg.Artifacts.Dir,
+				cfg.Artifacts.retention(),
+			)
+			if err != nil {
+				s.logger.WithError(err).Error("error pruning artifacts")
+			}
+			if removed > 0 {
+				s.logger.WithField("removed", removed).Info("pruned artifacts")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueResponse is the body of responses to requests for the state of the
+// queue of rendering requests.
+type queueResponse struct {
+	// Repos describes the requests for every repository that has requests
+	// being handled or waiting to be handled.
+	Repos []repoQueueStats `json:"repos"`
+}
+
+// problem is the body of responses to requests that could not be handled. It
+// is a problem details object as described by RFC 9457.
+type problem struct {
+	// Type identifies the type of problem. It is always about:blank, which
+	// indicates that the problem is described by the status code alone.
+	Type string `json:"type"`
+	// Title is a short description of the status code.
+	Title string `json:"title"`
+	// Status is the status code of the response.
+	Status int `json:"status"`
+	// Detail describes this particular occurrence of the problem.
+	Detail string `json:"detail"`
+	// RequestID identifies the request that could not be handled. It is the
+	// ID specified by the request's X-Request-ID header, if any, or else one
+	// generated by the server.
+	RequestID string `json:"requestID"`
+	// Error duplicates Detail for the benefit of clients written against
+	// earlier versions of the server.
+	Error string `json:"error"`
+	// Diagnostics describes how the failed request was handled, if the
+	// request asked for diagnostics.
+	Diagnostics *render.Diagnostics `json:"diagnostics,omitempty"`
+	// Errors describes every problem with the fields of an invalid request.
+	Errors []render.FieldError `json:"errors,omitempty"`
+	// retryAfter, if non-zero, is sent as the Retry-After header of the
+	// response.
+	retryAfter time.Duration
+}
+
+// requestIDHeader is the name of the header that identifies a request, and
+// the response to it, for the purpose of correlating them with logs.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRegex matches the IDs that are valid as the ID of a rendering
+// request, so the server's request IDs can always be used as such.
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9][\w-]{0,127}$`)
+
+// requestID returns the ID specified by the provided request's X-Request-ID
+// header, if it is valid, or else a newly generated ID.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); requestIDRegex.MatchString(id) {
+		return id
+	}
+	return uuid.NewString()
+}
+
+// writeProblem completes the provided problem using the provided status code
+// and the ID of the request being responded to, and writes it as the response.
+func writeProblem(w http.ResponseWriter, code int, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(code)
+	p.Status = code
+	p.RequestID = w.Header().Get(requestIDHeader)
+	p.Error = p.Detail
+	if p.retryAfter > 0 {
+		w.Header().Set(
+			"Retry-After",
+			strconv.Itoa(int(p.retryAfter.Round(time.Second).Seconds())),
+		)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// errorStatus returns the status code of the response to a rendering request
+// that failed with the provided error.
+func errorStatus(err error) int {
+	switch {
+	case errors.As(err, new(*render.InvalidRequestError)):
+		return http.StatusBadRequest
+	case errors.Is(err, git.ErrAuthenticationFailed):
+		return http.StatusUnauthorized
+	case errors.As(err, new(*render.ConfigManagementToolNotAllowedError)),
+		errors.Is(err, git.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.As(err, new(*render.AppRenderTimeoutError)):
+		return http.StatusGatewayTimeout
+	case errors.As(err, new(*render.LockLostError)):
+		return http.StatusServiceUnavailable
+	case errors.As(err, new(*render.StalePlanError)),
+		errors.As(err, new(*render.IdempotencyKeyConflictError)),
+		errors.As(err, new(*render.UnmanagedBranchError)),
+		errors.As(err, new(*render.RequestInProgressError)),
+		errors.Is(err, git.ErrPushRejected):
+		return http.StatusConflict
+	case errors.As(err, new(*render.UnverifiedCommitError)),
+		errors.As(err, new(*render.RequiredChecksNotPassedError)),
+		errors.As(err, new(*render.PromotionOrderError)),
+		errors.As(err, new(*render.TooManyOpenPRsError)),
+		errors.As(err, new(*render.ResourcePolicyViolationError)),
+		errors.As(err, new(*render.DuplicateResourcesError)),
+		errors.As(err, new(*render.MissingPreservedPathsError)),
+		errors.As(err, new(*render.LintError)),
+		errors.As(err, new(*render.ExternalPathCollisionError)),
+		errors.As(err, new(*render.UnmatchedImagesError)),
+		errors.As(err, new(*render.InvalidConfigError)),
+		errors.As(err, new(*render.InvalidBranchConfigError)),
+		errors.As(err, new(*render.DuplicateBranchConfigError)),
+		errors.As(err, new(*render.UnreachableBranchConfigError)),
+		errors.As(err, new(*render.NoBranchConfigError)),
+		errors.As(err, new(*render.SymlinkError)),
+		errors.As(err, new(*render.UnpinnedRemoteBaseError)),
+		errors.As(err, new(*render.NetworkAccessRequiredError)),
+		errors.As(err, new(*render.UnsupportedVersionError)):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// render authenticates, authorizes, and handles the provided request, returning
+// the status code and body of the response. While the request is queued or
+// being handled, it can be canceled using its request ID, which is also the ID
+// of any artifacts persisted for it.
+func (s *server) render(
+	state *serverState,
+	w http.ResponseWriter,
+	r *http.Request,
+) (code int, body any) {
+	requestID := w.Header().Get(requestIDHeader)
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed,
+			problem{Detail: "only POST requests are supported"}
+	}
+	if !authenticated(state.cfg, r) {
+		return http.StatusUnauthorized,
+			problem{Detail: "a valid bearer token is required"}
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		return http.StatusBadRequest,
+			problem{Detail: fmt.Sprintf("error reading request: %s", err)}
+	}
+	if len(data) > maxRequestBytes {
+		return http.StatusRequestEntityTooLarge,
+			problem{Detail: "request is too large"}
+	}
+	req, err := render.UnmarshalRequest(data)
+	if err != nil {
+		return http.StatusBadRequest, problem{Detail: err.Error()}
+	}
+	if req.LocalInPath != "" || req.LocalOutPath != "" {
+		return http.StatusBadRequest, problem{
+			Detail: "localInPath and localOutPath are not supported by the server",
+		}
+	}
+	for _, output := range req.Outputs {
+		if output.Type == render.OutputTypeLocal {
+			return http.StatusBadRequest, problem{
+				Detail: "outputs of type local are not supported by the server",
+			}
+		}
+	}
+	// Invalid requests are refused before they wait in the queue
+	if err = render.ValidateRequest(req); err != nil {
+		p := problem{Detail: err.Error()}
+		var invalidErr *render.InvalidRequestError
+		if errors.As(err, &invalidErr) {
+			p.Errors = invalidErr.FieldErrors
+		}
+		return http.StatusBadRequest, p
+	}
+	req.Tenant = tenant(state.cfg, r)
+	// Jobs are canceled, and artifacts are downloaded, by the same ID, so the
+	// ID in the body, if any, must agree with the X-Request-ID header. If the
+	// header did not specify an ID, the ID in the body is adopted instead.
+	switch {
+	case req.ID == "":
+		req.ID = requestID
+	case req.ID == requestID:
+	case r.Header.Get(requestIDHeader) != requestID:
+		requestID = req.ID
+		w.Header().Set(requestIDHeader, requestID)
+	default:
+		return http.StatusBadRequest, problem{
+			Detail: fmt.Sprintf(
+				"id %q does not match the %s header %q",
+				req.ID,
+				requestIDHeader,
+				requestID,
+			),
+		}
+	}
+	if !state.cfg.repoURLAllowed(req.RepoURL) {
+		return http.StatusForbidden, problem{
+			Detail: fmt.Sprintf("repository %q is not allowed", req.RepoURL),
+		}
+	}
+	if req.PushURL != "" && !state.cfg.repoURLAllowed(req.PushURL) {
+		return http.StatusForbidden, problem{
+			Detail: fmt.Sprintf("repository %q is not allowed", req.PushURL),
+		}
+	}
+	if state.ring != nil && r.Header.Get(forwardedByHeader) == "" {
+		if owner := state.ring.Owner(req.RepoURL, req.TargetBranch); owner != state.cfg.Routing.Replica {
+			return s.forward(state.cfg, r, data, owner, requestID)
+		}
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	job, err := s.jobs.start(req.Tenant, requestID, cancel)
+	if err != nil {
+		return http.StatusConflict, problem{Detail: err.Error()}
+	}
+	defer func() {
+		s.jobs.finish(req.Tenant, requestID, job, code)
+	}()
+	canceledProblem := problem{
+		Detail: fmt.Sprintf("rendering request %q was canceled", requestID),
+	}
+	priority := req.Priority
+	if priority == "" {
+		priority = render.PriorityNormal
+	}
+	queuedAt := time.Now()
+	release, err := s.queue.acquire(
+		ctx,
+		req.RepoURL,
+		priority,
+		func(position int) {
+			s.logger.WithFields(log.Fields{
+				"repo":         req.RepoURL,
+				"targetBranch": req.TargetBranch,
+				"priority":     priority,
+				"position":     position,
+			}).Info("rendering request queued")
+		},
+	)
+	if err != nil {
+		var fullErr *queueFullError
+		if errors.As(err, &fullErr) {
+			s.logger.WithFields(log.Fields{
+				"repo":         req.RepoURL,
+				"targetBranch": req.TargetBranch,
+				"priority":     priority,
+				"retryAfter":   fullErr.RetryAfter,
+			}).Info("rendering request refused because the queue is full")
+			return http.StatusTooManyRequests, problem{
+				Detail:     err.Error(),
+				retryAfter: fullErr.RetryAfter,
+			}
+		}
+		if job.wasCanceled() {
+			return http.StatusConflict, canceledProblem
+		}
+		return http.StatusServiceUnavailable, problem{
+			Detail: fmt.Sprintf("request was abandoned while queued: %s", err),
+		}
+	}
+	defer release()
+	job.setRunning()
+	if s.metrics != nil {
+		s.metrics.queueWait.WithLabelValues(string(priority)).Observe(
+			time.Since(queuedAt).Seconds(),
+		)
+	}
+	res, err := state.svc.RenderManifests(ctx, req)
+	if s.metrics != nil && res.Clone != nil {
+		s.metrics.cloneSize.WithLabelValues(string(res.Clone.Strategy)).Observe(
+			float64(res.Clone.ObjectBytes),
+		)
+	}
+	if err != nil && job.wasCanceled() && errors.Is(err, context.Canceled) {
+		canceledProblem.Diagnostics = res.Diagnostics
+		return http.StatusConflict, canceledProblem
+	}
+	if err != nil {
+		code := errorStatus(err)
+		entry := s.logger.WithFields(log.Fields{
+			"repo":         req.RepoURL,
+			"targetBranch": req.TargetBranch,
+			"requestID":    requestID,
+		}).WithError(err)
+		if code == http.StatusInternalServerError {
+			entry.Error("error handling rendering request")
+		} else {
+			entry.Info("rendering request was refused")
+		}
+		return code, problem{
+			Detail:      err.Error(),
+			Diagnostics: res.Diagnostics,
+		}
+	}
+	return http.StatusOK, res
+}
+
+// tenant returns the tenant on whose behalf the provided request, which must
+// already have been authenticated, is made. Every token is a tenant of its own,
+// identified by a digest of the token so that the token itself is never
+// written to disk. If no tokens are configured, there are no tenants.
+func tenant(cfg *serverConfig, r *http.Request) string {
+	if len(cfg.Auth.Tokens) == 0 {
+		return ""
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// authenticated returns true if the provided request bears one of the tokens
+// in the provided configuration or if no tokens are configured.
+func authenticated(cfg *serverConfig, r *http.Request) bool {
+	if len(cfg.Auth.Tokens) == 0 {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	for _, allowed := range cfg.Auth.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+	libLog "github.com/akuity/kargo-render/internal/log"
+)
+
+type serverOptions struct {
+	logger     *log.Logger
+	configPath string
+}
+
+func newServerCommand() *cobra.Command {
+	cmdOpts := &serverOptions{
+		logger: libLog.LoggerOrDie(),
+	}
+
+	cmd := &cobra.Command{
+		Use:     "server",
+		Aliases: []string{"serve"},
+		Short:   "Run an HTTP server that accepts rendering requests",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmdOpts.run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&cmdOpts.configPath,
+		flagConfig,
+		"",
+		"Path to a YAML configuration file. Any setting can be overridden using "+
+			"an environment variable, e.g. KARGO_RENDER_SERVER_PORT. The file is "+
+			"reloaded when the server receives SIGHUP.",
+	)
+
+	return cmd
+}
+
+// run runs the server until it receives SIGINT or SIGTERM.
+func (o *serverOptions) run(ctx context.Context) error {
+	logger := o.logger
+
+	cfg, err := loadServerConfig(o.configPath)
+	if err != nil {
+		return err
+	}
+	prepareHost(logger)
+	srv, err := newServer(logger, cfg, render.NewService)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.TLS.CertFile != "" {
+		httpServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: srv.getCertificate,
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	defer signal.Stop(reloadCh)
+	go func() {
+		for {
+			select {
+			case <-reloadCh:
+				o.reload(srv)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go srv.pruneArtifacts(ctx)
+
+	errCh := make(chan error, 2)
+	if reconciler := newReconciler(srv, cfg); reconciler != nil {
+		go func() {
+			if err := reconciler.Run(ctx); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+	go func() {
+		logger.WithField("port", cfg.Port).Info("Starting Kargo Render server")
+		if cfg.TLS.CertFile != "" {
+			// The certificate is supplied by the TLSConfig
+			errCh <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			errCh <- httpServer.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err = <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("Shutting down Kargo Render server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil &&
+		!errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// reload reloads the server's configuration. If the new configuration cannot
+// be loaded, the server continues using its current configuration.
+func (o *serverOptions) reload(srv *server) {
+	cfg, err := loadServerConfig(o.configPath)
+	if err == nil {
+		err = srv.reload(cfg)
+	}
+	if err != nil {
+		o.logger.WithError(err).Error(
+			"error reloading configuration; continuing with current configuration",
+		)
+		return
+	}
+	o.logger.Info("Reloaded configuration")
+}
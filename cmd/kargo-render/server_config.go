@@ -0,0 +1,613 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"sigs.k8s.io/yaml"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/env"
+)
+
+// serverEnvPrefix is the prefix of the names of environment variables that
+// override settings from the server's configuration file.
+const serverEnvPrefix = envPrefix + "SERVER_"
+
+// Backends that may keep the locks on branches.
+const (
+	serverLockingBackendRedis = "redis"
+	serverLockingBackendLease = "lease"
+)
+
+// serverConfig is the configuration of the server. It is loaded from a YAML
+// file, if one is specified, and any setting can be overridden by an
+// environment variable. For instance, tls.certFile can be overridden using
+// KARGO_RENDER_SERVER_TLS_CERT_FILE.
+type serverConfig struct {
+	// Port is the port the server listens on. It defaults to 8080.
+	Port int `json:"port,omitempty"`
+	// TLS configures the server to serve HTTPS instead of HTTP.
+	TLS serverTLSConfig `json:"tls,omitempty"`
+	// Auth configures authentication of clients.
+	Auth serverAuthConfig `json:"auth,omitempty"`
+	// Allowlists restrict what clients may request.
+	Allowlists serverAllowlistsConfig `json:"allowlists,omitempty"`
+	// Cache configures caching of repositories.
+	Cache serverCacheConfig `json:"cache,omitempty"`
+	// Clone configures how remote repositories are cloned.
+	Clone serverCloneConfig `json:"clone,omitempty"`
+	// HTTP configures HTTP(S) requests made to git providers.
+	HTTP serverHTTPConfig `json:"http,omitempty"`
+	// Metrics configures the exposition of Prometheus metrics.
+	Metrics serverMetricsConfig `json:"metrics,omitempty"`
+	// Pprof configures the exposition of runtime profiling data.
+	Pprof serverPprofConfig `json:"pprof,omitempty"`
+	// Queue limits how many rendering requests are handled at once.
+	Queue serverQueueConfig `json:"queue,omitempty"`
+	// Render configures the tools used to render manifests.
+	Render serverRenderConfig `json:"render,omitempty"`
+	// Artifacts configures persistence of rendered manifests.
+	Artifacts serverArtifactsConfig `json:"artifacts,omitempty"`
+	// Locking configures the locks that prevent replicas from rendering into
+	// the same branch at once.
+	Locking serverLockingConfig `json:"locking,omitempty"`
+	// Routing configures the routing of requests for each branch to the same
+	// replica.
+	Routing serverRoutingConfig `json:"routing,omitempty"`
+	// Reconciliation configures the periodic re-rendering of branches.
+	Reconciliation serverReconciliationConfig `json:"reconciliation,omitempty"`
+	// Batching configures the coalescing of requests for the same branch.
+	Batching serverBatchingConfig `json:"batching,omitempty"`
+	// Idempotency configures how the outcomes of requests bearing idempotency
+	// keys are recorded.
+	Idempotency serverIdempotencyConfig `json:"idempotency,omitempty"`
+	// CommitSignaturePolicies require that source commits rendered into
+	// matching target branches are signed by trusted keys. These can only be
+	// specified in the configuration file.
+	CommitSignaturePolicies []serverCommitSignaturePolicy `json:"commitSignaturePolicies,omitempty" env:"-"` // nolint: lll
+	// RequiredChecksPolicies require that status checks on source commits
+	// rendered into matching target branches have passed. These can only be
+	// specified in the configuration file.
+	RequiredChecksPolicies []serverRequiredChecksPolicy `json:"requiredChecksPolicies,omitempty" env:"-"` // nolint: lll
+}
+
+type serverTLSConfig struct {
+	// CertFile is the path to a PEM-encoded certificate. If this and KeyFile are
+	// specified, the server serves HTTPS.
+	CertFile string `json:"certFile,omitempty"`
+	// KeyFile is the path to the PEM-encoded private key for CertFile.
+	KeyFile string `json:"keyFile,omitempty"`
+}
+
+type serverAuthConfig struct {
+	// Tokens are the bearer tokens clients may authenticate with. If none are
+	// specified, clients are not required to authenticate.
+	Tokens []string `json:"tokens,omitempty"`
+}
+
+type serverAllowlistsConfig struct {
+	// RepoURLs are patterns, in the syntax of path.Match, for the URLs of the
+	// repositories clients may request rendering for. If none are specified,
+	// any repository may be rendered.
+	RepoURLs []string `json:"repoURLs,omitempty" env:"REPO_URLS"`
+	// ConfigManagement are the configuration management tools that may be used
+	// to render manifests. If none are specified, all tools are allowed.
+	ConfigManagement []string `json:"configManagement,omitempty"`
+}
+
+type serverCacheConfig struct {
+	// CloneCacheDir is the directory in which mirrors of remote repositories
+	// are kept. If not specified, every request clones from scratch.
+	CloneCacheDir string `json:"cloneCacheDir,omitempty"`
+}
+
+type serverCloneConfig struct {
+	// Strategy determines how much of a remote repository is fetched when it
+	// is cloned. Valid values are full, shallow, partial, and auto. If not
+	// specified, repositories are cloned in full.
+	Strategy string `json:"strategy,omitempty"`
+	// Filter is the filter spec (see git rev-list --filter) used by partial
+	// clones. If not specified, the contents of all files are fetched only
+	// when they are needed.
+	Filter string `json:"filter,omitempty"`
+	// PartialThreshold is the size, in bytes, of a full clone of a repository
+	// above which the auto strategy clones the repository partially
+	// thereafter. If not specified, this defaults to 256 MiB.
+	PartialThreshold int64 `json:"partialThreshold,omitempty"`
+}
+
+type serverHTTPConfig struct {
+	// UserAgent is the User-Agent header sent with every HTTP(S) request made to
+	// a git provider. If not specified, this defaults to
+	// kargo-render/<version>.
+	UserAgent string `json:"userAgent,omitempty"`
+	// Headers are additional headers, indexed by name, sent with every HTTP(S)
+	// request made to a git provider. These can only be specified in the
+	// configuration file.
+	Headers map[string]string `json:"headers,omitempty" env:"-"`
+}
+
+type serverMetricsConfig struct {
+	// Enabled specifies whether Prometheus metrics are exposed.
+	Enabled bool `json:"enabled,omitempty"`
+	// Path is the path metrics are exposed at. It defaults to /metrics.
+	Path string `json:"path,omitempty"`
+}
+
+type serverPprofConfig struct {
+	// Enabled specifies whether runtime profiling data is exposed, in the format
+	// expected by go tool pprof, beneath /debug/pprof/. Clients must
+	// authenticate to access it, just as they must to request rendering.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+type serverArtifactsConfig struct {
+	// Dir is the directory in which the rendered manifests, and the diff they
+	// introduced, of every request that results in a commit are persisted, so
+	// that clients can download them. If not specified, nothing is persisted.
+	// The artifacts of each client are kept apart from those of other clients
+	// and can only be downloaded using the token they were created with.
+	Dir string `json:"dir,omitempty"`
+	// Retention is how long, e.g. 720h, artifacts are kept before they are
+	// removed. It defaults to 168h.
+	Retention string `json:"retention,omitempty"`
+}
+
+// retention returns the parsed Retention. It assumes Retention has already
+// been defaulted and validated.
+func (a serverArtifactsConfig) retention() time.Duration {
+	retention, _ := time.ParseDuration(a.Retention)
+	return retention
+}
+
+type serverLockingConfig struct {
+	// Backend is where locks are kept, either redis or lease (for Kubernetes
+	// Leases). If not specified, branches are not locked, which is safe only if
+	// there is a single replica or requests are routed so that each branch is
+	// rendered by one replica only.
+	Backend string `json:"backend,omitempty"`
+	// TTL is how long, e.g. 30s, a lock held by a replica that stops renewing it
+	// lasts. It defaults to 30s.
+	TTL string `json:"ttl,omitempty"`
+	// Redis configures the redis backend.
+	Redis serverRedisConfig `json:"redis,omitempty"`
+	// Lease configures the lease backend.
+	Lease serverLeaseConfig `json:"lease,omitempty"`
+}
+
+// ttl returns the parsed TTL, or zero if it is not specified. It assumes TTL
+// has already been validated.
+func (l serverLockingConfig) ttl() time.Duration {
+	ttl, _ := time.ParseDuration(l.TTL)
+	return ttl
+}
+
+type serverRedisConfig struct {
+	// Addr is the host:port address of the Redis server.
+	Addr string `json:"addr,omitempty"`
+	// Username is the username used to authenticate to the Redis server, if
+	// any.
+	Username string `json:"username,omitempty"`
+	// Password is the password used to authenticate to the Redis server, if
+	// any.
+	Password string `json:"password,omitempty"`
+	// DB is the number of the database used.
+	DB int `json:"db,omitempty"`
+}
+
+type serverLeaseConfig struct {
+	// Namespace is the Kubernetes namespace in which Leases are created. The
+	// server must run in the cluster and its service account must be allowed
+	// to get, create, update, and delete Leases in the namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type serverRoutingConfig struct {
+	// Replica is the name of this replica. It defaults to the hostname, which,
+	// for the pods of a StatefulSet, is stable.
+	Replica string `json:"replica,omitempty"`
+	// Replicas maps the name of every replica, including this one, to the base
+	// URL at which other replicas can reach it. If specified, each branch is
+	// assigned to one replica using consistent hashing, and requests for the
+	// branch received by other replicas are forwarded to it, keeping its
+	// workspaces and caches warm. These can only be specified in the
+	// configuration file.
+	Replicas map[string]string `json:"replicas,omitempty" env:"-"`
+}
+
+type serverReconciliationConfig struct {
+	// Targets are the branches that are periodically re-rendered from the
+	// source commits recorded in their metadata, correcting any drift. These can
+	// only be specified in the configuration file.
+	Targets []render.ReconciliationTarget `json:"targets,omitempty" env:"-"`
+}
+
+type serverBatchingConfig struct {
+	// Window is how long, e.g. 30s, the server waits after receiving a request
+	// that writes to a branch for further requests to write to the same branch.
+	// Requests that arrive within the window and differ only in their source
+	// commit, images, and variables are coalesced into a single rendering of
+	// the newest source commit, with the images and variables of all of them.
+	// If not specified, requests are never coalesced.
+	Window string `json:"window,omitempty"`
+}
+
+// window returns the parsed Window, or zero if it is not specified. It assumes
+// Window has already been validated.
+func (b serverBatchingConfig) window() time.Duration {
+	window, _ := time.ParseDuration(b.Window)
+	return window
+}
+
+type serverIdempotencyConfig struct {
+	// TTL is how long, e.g. 24h, the outcome of a successful request bearing an
+	// idempotency key is recorded, during which retries of the request return
+	// the original response. Outcomes are kept in memory, so they are not
+	// shared between replicas and do not survive a restart. It defaults to 24h.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ttl returns the parsed TTL. It assumes TTL has already been defaulted and
+// validated.
+func (i serverIdempotencyConfig) ttl() time.Duration {
+	ttl, _ := time.ParseDuration(i.TTL)
+	return ttl
+}
+
+type serverQueueConfig struct {
+	// Concurrency is the maximum number of rendering requests handled at once.
+	// Further requests wait until they can be handled. If zero, there is no
+	// limit.
+	Concurrency int `json:"concurrency,omitempty"`
+	// PerRepoConcurrency is the maximum number of rendering requests for any one
+	// repository handled at once. If zero, there is no limit. Whenever capacity
+	// becomes available, repositories with waiting requests take turns, so
+	// many requests for one repository cannot starve requests for others.
+	PerRepoConcurrency int `json:"perRepoConcurrency,omitempty"`
+	// MaxQueued is the maximum number of rendering requests waiting to be
+	// handled at once. Further requests are refused with a 429 response whose
+	// Retry-After header estimates, from the number of waiting requests, when
+	// to try again. If zero, there is no limit.
+	MaxQueued int `json:"maxQueued,omitempty"`
+	// MaxQueuedPerRepo is the maximum number of rendering requests for any one
+	// repository waiting to be handled at once. Further requests for the
+	// repository are refused as when MaxQueued is reached. If zero, there is no
+	// limit.
+	MaxQueuedPerRepo int `json:"maxQueuedPerRepo,omitempty"`
+}
+
+type serverRenderConfig struct {
+	// KustomizeBinaryPath is the path to the kustomize binary used to render
+	// Kustomize-based apps. If not specified, kustomize is found using the PATH
+	// environment variable.
+	KustomizeBinaryPath string `json:"kustomizeBinaryPath,omitempty"`
+	// Timeout is the maximum amount of time, e.g. 2m, rendering the manifests
+	// of any single app may take. If not specified, there is no limit.
+	Timeout string `json:"timeout,omitempty"`
+	// ToolEnv maps the name of a tool (helm, kustomize, or ytt) to environment
+	// variables that processes the server runs for the tool may inherit. Other
+	// variables, apart from a few harmless ones, are withheld from linters. The
+	// server doesn't remove any variables from its own environment, since they
+	// may override its configuration when it is reloaded, so helm and
+	// kustomize inherit its entire environment during rendering. These can
+	// only be specified in the configuration file.
+	ToolEnv map[string][]string `json:"toolEnv,omitempty" env:"-"`
+}
+
+// timeout returns the parsed Timeout, or zero if it is not specified. It
+// assumes Timeout has already been validated.
+func (r serverRenderConfig) timeout() time.Duration {
+	timeout, _ := time.ParseDuration(r.Timeout)
+	return timeout
+}
+
+type serverCommitSignaturePolicy struct {
+	// TargetBranchPattern is a regular expression matched against the names of
+	// target branches. If empty, the policy applies to all target branches.
+	TargetBranchPattern string `json:"targetBranchPattern,omitempty"`
+	// TrustedKeyFiles are paths to ASCII-armored OpenPGP public keys or SSH
+	// public keys of the parties that may sign source commits.
+	TrustedKeyFiles []string `json:"trustedKeyFiles,omitempty"`
+}
+
+type serverRequiredChecksPolicy struct {
+	// TargetBranchPattern is a regular expression matched against the names of
+	// target branches. If empty, the policy applies to all target branches.
+	TargetBranchPattern string `json:"targetBranchPattern,omitempty"`
+	// Checks are the names of the status checks that must have passed.
+	Checks []string `json:"checks,omitempty"`
+}
+
+// loadServerConfig loads the server's configuration from the YAML file at the
+// specified path, if any, then applies overrides from environment variables
+// and defaults, and validates the result.
+func loadServerConfig(configPath string) (*serverConfig, error) {
+	cfg := &serverConfig{}
+	if configPath != "" {
+		cfgBytes, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		if err = yaml.UnmarshalStrict(cfgBytes, cfg); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %w", configPath, err)
+		}
+	}
+	var err error
+	if err = env.PrefixScan(serverEnvPrefix, cfg); err != nil {
+		return nil, fmt.Errorf("error reading config from environment: %w", err)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 8080
+	}
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if cfg.Idempotency.TTL == "" {
+		cfg.Idempotency.TTL = "24h"
+	}
+	if cfg.Artifacts.Retention == "" {
+		cfg.Artifacts.Retention = "168h"
+	}
+	if cfg.Routing.Replica == "" && len(cfg.Routing.Replicas) > 0 {
+		if cfg.Routing.Replica, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("error determining name of replica: %w", err)
+		}
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid server configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// validate returns an error describing every problem with the configuration,
+// if there are any.
+func (c *serverConfig) validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(
+			errs,
+			errors.New("tls.certFile and tls.keyFile must be specified together"),
+		)
+	}
+	for _, token := range c.Auth.Tokens {
+		if strings.TrimSpace(token) == "" {
+			errs = append(errs, errors.New("auth.tokens must not contain empty tokens"))
+			break
+		}
+	}
+	for _, pattern := range c.Allowlists.RepoURLs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("allowlists.repoURLs pattern %q is invalid: %w", pattern, err),
+			)
+		}
+	}
+	for _, tool := range configManagementTools(c.Allowlists.ConfigManagement) {
+		switch tool {
+		case render.ConfigManagementToolDirectory,
+			render.ConfigManagementToolHelm,
+			render.ConfigManagementToolKustomize,
+			render.ConfigManagementToolPlugin:
+		default:
+			errs = append(
+				errs,
+				fmt.Errorf("allowlists.configManagement contains unknown tool %q", tool),
+			)
+		}
+	}
+	for i, policy := range c.CommitSignaturePolicies {
+		if _, err := regexp.Compile(policy.TargetBranchPattern); err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"commitSignaturePolicies[%d].targetBranchPattern is invalid: %w",
+					i,
+					err,
+				),
+			)
+		}
+		if len(policy.TrustedKeyFiles) == 0 {
+			errs = append(
+				errs,
+				fmt.Errorf("commitSignaturePolicies[%d].trustedKeyFiles is required", i),
+			)
+		}
+	}
+	for i, policy := range c.RequiredChecksPolicies {
+		if _, err := regexp.Compile(policy.TargetBranchPattern); err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"requiredChecksPolicies[%d].targetBranchPattern is invalid: %w",
+					i,
+					err,
+				),
+			)
+		}
+		if len(policy.Checks) == 0 {
+			errs = append(
+				errs,
+				fmt.Errorf("requiredChecksPolicies[%d].checks is required", i),
+			)
+		}
+	}
+	if c.Render.Timeout != "" {
+		if timeout, err := time.ParseDuration(c.Render.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("render.timeout is invalid: %w", err))
+		} else if timeout < 0 {
+			errs = append(errs, errors.New("render.timeout must not be negative"))
+		}
+	}
+	switch c.Locking.Backend {
+	case "":
+	case serverLockingBackendRedis:
+		if c.Locking.Redis.Addr == "" {
+			errs = append(
+				errs,
+				errors.New("locking.redis.addr is required by the redis backend"),
+			)
+		}
+	case serverLockingBackendLease:
+		if c.Locking.Lease.Namespace == "" {
+			errs = append(
+				errs,
+				errors.New("locking.lease.namespace is required by the lease backend"),
+			)
+		}
+	default:
+		errs = append(
+			errs,
+			fmt.Errorf("locking.backend %q is unsupported", c.Locking.Backend),
+		)
+	}
+	if c.Locking.TTL != "" {
+		if ttl, err := time.ParseDuration(c.Locking.TTL); err != nil {
+			errs = append(errs, fmt.Errorf("locking.ttl is invalid: %w", err))
+		} else if ttl < time.Second {
+			errs = append(errs, errors.New("locking.ttl must be at least 1s"))
+		}
+	}
+	if len(c.Routing.Replicas) > 0 {
+		if _, ok := c.Routing.Replicas[c.Routing.Replica]; !ok {
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"routing.replicas does not include this replica, %q",
+					c.Routing.Replica,
+				),
+			)
+		}
+		for replica, baseURL := range c.Routing.Replicas {
+			if u, err := url.Parse(baseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(
+					errs,
+					fmt.Errorf(
+						"routing.replicas URL %q of replica %q is invalid",
+						baseURL,
+						replica,
+					),
+				)
+			}
+		}
+	}
+	for i, target := range c.Reconciliation.Targets {
+		if target.RepoURL == "" {
+			errs = append(
+				errs,
+				fmt.Errorf("reconciliation.targets[%d].repoURL is required", i),
+			)
+		} else if !c.repoURLAllowed(target.RepoURL) {
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"reconciliation.targets[%d].repoURL %q is not allowed",
+					i,
+					target.RepoURL,
+				),
+			)
+		}
+		if target.TargetBranch == "" {
+			errs = append(
+				errs,
+				fmt.Errorf("reconciliation.targets[%d].targetBranch is required", i),
+			)
+		}
+		if _, err := cron.ParseStandard(target.Schedule); err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf("reconciliation.targets[%d].schedule is invalid: %w", i, err),
+			)
+		}
+	}
+	if c.Batching.Window != "" {
+		if window, err := time.ParseDuration(c.Batching.Window); err != nil {
+			errs = append(errs, fmt.Errorf("batching.window is invalid: %w", err))
+		} else if window < 0 {
+			errs = append(errs, errors.New("batching.window must not be negative"))
+		}
+	}
+	if c.Idempotency.TTL != "" {
+		if ttl, err := time.ParseDuration(c.Idempotency.TTL); err != nil {
+			errs = append(errs, fmt.Errorf("idempotency.ttl is invalid: %w", err))
+		} else if ttl <= 0 {
+			errs = append(errs, errors.New("idempotency.ttl must be positive"))
+		}
+	}
+	if c.Artifacts.Retention != "" {
+		if retention, err := time.ParseDuration(c.Artifacts.Retention); err != nil {
+			errs = append(errs, fmt.Errorf("artifacts.retention is invalid: %w", err))
+		} else if retention <= 0 {
+			errs = append(errs, errors.New("artifacts.retention must be positive"))
+		}
+	}
+	for tool := range c.Render.ToolEnv {
+		switch tool {
+		case "helm", "kustomize", "ytt":
+		default:
+			errs = append(errs, fmt.Errorf("render.toolEnv tool %q is unsupported", tool))
+		}
+	}
+	switch render.CloneStrategy(c.Clone.Strategy) {
+	case "",
+		render.CloneStrategyFull,
+		render.CloneStrategyShallow,
+		render.CloneStrategyPartial,
+		render.CloneStrategyAuto:
+	default:
+		errs = append(
+			errs,
+			fmt.Errorf("clone.strategy %q is unsupported", c.Clone.Strategy),
+		)
+	}
+	if c.Clone.PartialThreshold < 0 {
+		errs = append(errs, errors.New("clone.partialThreshold must not be negative"))
+	}
+	if c.Queue.Concurrency < 0 {
+		errs = append(errs, errors.New("queue.concurrency must not be negative"))
+	}
+	if c.Queue.PerRepoConcurrency < 0 {
+		errs = append(
+			errs,
+			errors.New("queue.perRepoConcurrency must not be negative"),
+		)
+	}
+	if c.Queue.MaxQueued < 0 {
+		errs = append(errs, errors.New("queue.maxQueued must not be negative"))
+	}
+	if c.Queue.MaxQueuedPerRepo < 0 {
+		errs = append(
+			errs,
+			errors.New("queue.maxQueuedPerRepo must not be negative"),
+		)
+	}
+	if !strings.HasPrefix(c.Metrics.Path, "/") {
+		errs = append(errs, fmt.Errorf("metrics.path %q must begin with /", c.Metrics.Path))
+	}
+	return errors.Join(errs...)
+}
+
+// repoURLAllowed returns true if the specified repository URL matches any of
+// the allowlisted patterns or if there are no such patterns.
+func (c *serverConfig) repoURLAllowed(repoURL string) bool {
+	if len(c.Allowlists.RepoURLs) == 0 {
+		return true
+	}
+	for _, pattern := range c.Allowlists.RepoURLs {
+		if matched, _ := path.Match(pattern, repoURL); matched {
+			return true
+		}
+	}
+	return false
+}
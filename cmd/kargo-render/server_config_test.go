@@ -0,0 +1,334 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestLoadServerConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     string
+		setup      func(*testing.T)
+		assertions func(*testing.T, *serverConfig, error)
+	}{
+		{
+			name: "no config file",
+			assertions: func(t *testing.T, cfg *serverConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 8080, cfg.Port)
+				require.Equal(t, "/metrics", cfg.Metrics.Path)
+				require.Equal(t, "24h", cfg.Idempotency.TTL)
+				require.Equal(t, "168h", cfg.Artifacts.Retention)
+			},
+		},
+		{
+			name: "config file",
+			config: `
+port: 9090
+tls:
+  certFile: /tls/tls.crt
+  keyFile: /tls/tls.key
+auth:
+  tokens:
+  - secret
+allowlists:
+  repoURLs:
+  - https://github.com/akuity/*
+  configManagement:
+  - helm
+cache:
+  cloneCacheDir: /var/cache/kargo-render
+clone:
+  strategy: auto
+  filter: blob:limit=1m
+  partialThreshold: 1073741824
+http:
+  userAgent: kargo-render/v1.2.3
+  headers:
+    X-Audit-Source: kargo
+metrics:
+  enabled: true
+  path: /prometheus
+queue:
+  concurrency: 10
+  perRepoConcurrency: 2
+  maxQueued: 100
+  maxQueuedPerRepo: 20
+render:
+  kustomizeBinaryPath: /usr/local/bin/kustomize
+  timeout: 2m
+artifacts:
+  dir: /var/lib/kargo-render/artifacts
+  retention: 720h
+batching:
+  window: 30s
+idempotency:
+  ttl: 1h
+locking:
+  backend: redis
+  ttl: 1m
+  redis:
+    addr: redis:6379
+    db: 1
+routing:
+  replica: kargo-render-0
+  replicas:
+    kargo-render-0: http://kargo-render-0.kargo-render:8080
+    kargo-render-1: http://kargo-render-1.kargo-render:8080
+reconciliation:
+  targets:
+  - repoURL: https://github.com/akuity/gitops
+    targetBranch: env/prod
+    schedule: "@hourly"
+commitSignaturePolicies:
+- targetBranchPattern: ^env/prod
+  trustedKeyFiles:
+  - /keys/release.asc
+requiredChecksPolicies:
+- checks:
+  - build
+`,
+			assertions: func(t *testing.T, cfg *serverConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					&serverConfig{
+						Port: 9090,
+						TLS: serverTLSConfig{
+							CertFile: "/tls/tls.crt",
+							KeyFile:  "/tls/tls.key",
+						},
+						Auth: serverAuthConfig{Tokens: []string{"secret"}},
+						Allowlists: serverAllowlistsConfig{
+							RepoURLs:         []string{"https://github.com/akuity/*"},
+							ConfigManagement: []string{"helm"},
+						},
+						Cache: serverCacheConfig{
+							CloneCacheDir: "/var/cache/kargo-render",
+						},
+						Clone: serverCloneConfig{
+							Strategy:         "auto",
+							Filter:           "blob:limit=1m",
+							PartialThreshold: 1 << 30,
+						},
+						HTTP: serverHTTPConfig{
+							UserAgent: "kargo-render/v1.2.3",
+							Headers:   map[string]string{"X-Audit-Source": "kargo"},
+						},
+						Metrics: serverMetricsConfig{
+							Enabled: true,
+							Path:    "/prometheus",
+						},
+						Queue: serverQueueConfig{
+							Concurrency:        10,
+							PerRepoConcurrency: 2,
+							MaxQueued:          100,
+							MaxQueuedPerRepo:   20,
+						},
+						Render: serverRenderConfig{
+							KustomizeBinaryPath: "/usr/local/bin/kustomize",
+							Timeout:             "2m",
+						},
+						Artifacts: serverArtifactsConfig{
+							Dir:       "/var/lib/kargo-render/artifacts",
+							Retention: "720h",
+						},
+						Batching:    serverBatchingConfig{Window: "30s"},
+						Idempotency: serverIdempotencyConfig{TTL: "1h"},
+						Locking: serverLockingConfig{
+							Backend: serverLockingBackendRedis,
+							TTL:     "1m",
+							Redis:   serverRedisConfig{Addr: "redis:6379", DB: 1},
+						},
+						Routing: serverRoutingConfig{
+							Replica: "kargo-render-0",
+							Replicas: map[string]string{
+								"kargo-render-0": "http://kargo-render-0.kargo-render:8080",
+								"kargo-render-1": "http://kargo-render-1.kargo-render:8080",
+							},
+						},
+						Reconciliation: serverReconciliationConfig{
+							Targets: []render.ReconciliationTarget{{
+								RepoURL:      "https://github.com/akuity/gitops",
+								TargetBranch: "env/prod",
+								Schedule:     "@hourly",
+							}},
+						},
+						CommitSignaturePolicies: []serverCommitSignaturePolicy{
+							{
+								TargetBranchPattern: "^env/prod",
+								TrustedKeyFiles:     []string{"/keys/release.asc"},
+							},
+						},
+						RequiredChecksPolicies: []serverRequiredChecksPolicy{
+							{Checks: []string{"build"}},
+						},
+					},
+					cfg,
+				)
+			},
+		},
+		{
+			name: "environment overrides config file",
+			config: `
+port: 9090
+allowlists:
+  repoURLs:
+  - https://github.com/akuity/*
+`,
+			setup: func(t *testing.T) {
+				t.Setenv("KARGO_RENDER_SERVER_PORT", "9091")
+				t.Setenv(
+					"KARGO_RENDER_SERVER_ALLOWLISTS_REPO_URLS",
+					"https://github.com/example/*",
+				)
+			},
+			assertions: func(t *testing.T, cfg *serverConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 9091, cfg.Port)
+				require.Equal(
+					t,
+					[]string{"https://github.com/example/*"},
+					cfg.Allowlists.RepoURLs,
+				)
+			},
+		},
+		{
+			name:   "unknown field",
+			config: "prot: 9090\n",
+			assertions: func(t *testing.T, _ *serverConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "error parsing config file")
+			},
+		},
+		{
+			name: "invalid config",
+			config: `
+port: 70000
+tls:
+  certFile: /tls/tls.crt
+allowlists:
+  repoURLs:
+  - "https://github.com/[akuity/*"
+  configManagement:
+  - jsonnet
+clone:
+  strategy: sparse
+  partialThreshold: -1
+metrics:
+  path: metrics
+queue:
+  concurrency: -1
+  maxQueued: -1
+render:
+  timeout: forever
+artifacts:
+  retention: -1h
+locking:
+  backend: lease
+  ttl: 10ms
+routing:
+  replica: kargo-render-2
+  replicas:
+    kargo-render-0: kargo-render-0
+reconciliation:
+  targets:
+  - repoURL: https://gitlab.com/akuity/gitops
+    schedule: sometimes
+commitSignaturePolicies:
+- targetBranchPattern: "("
+requiredChecksPolicies:
+- targetBranchPattern: "["
+`,
+			assertions: func(t *testing.T, _ *serverConfig, err error) {
+				require.Error(t, err)
+				// All problems are reported together
+				require.Contains(t, err.Error(), "port 70000 is out of range")
+				require.Contains(t, err.Error(), "must be specified together")
+				require.Contains(t, err.Error(), "pattern")
+				require.Contains(t, err.Error(), `unknown tool "jsonnet"`)
+				require.Contains(t, err.Error(), "must begin with /")
+				require.Contains(t, err.Error(), `clone.strategy "sparse" is unsupported`)
+				require.Contains(t, err.Error(), "clone.partialThreshold must not be negative")
+				require.Contains(t, err.Error(), "queue.concurrency must not be negative")
+				require.Contains(t, err.Error(), "queue.maxQueued must not be negative")
+				require.Contains(t, err.Error(), "render.timeout is invalid")
+				require.Contains(t, err.Error(), "artifacts.retention must be positive")
+				require.Contains(t, err.Error(), "locking.lease.namespace is required")
+				require.Contains(t, err.Error(), "locking.ttl must be at least 1s")
+				require.Contains(
+					t,
+					err.Error(),
+					`routing.replicas does not include this replica, "kargo-render-2"`,
+				)
+				require.Contains(t, err.Error(), `URL "kargo-render-0" of replica`)
+				require.Contains(
+					t,
+					err.Error(),
+					`reconciliation.targets[0].repoURL "https://gitlab.com/akuity/gitops" is not allowed`,
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"reconciliation.targets[0].targetBranch is required",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"reconciliation.targets[0].schedule is invalid",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"commitSignaturePolicies[0].targetBranchPattern is invalid",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"commitSignaturePolicies[0].trustedKeyFiles is required",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"requiredChecksPolicies[0].targetBranchPattern is invalid",
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"requiredChecksPolicies[0].checks is required",
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.setup != nil {
+				testCase.setup(t)
+			}
+			var configPath string
+			if testCase.config != "" {
+				configPath = filepath.Join(t.TempDir(), "config.yaml")
+				require.NoError(
+					t,
+					os.WriteFile(configPath, []byte(testCase.config), 0600),
+				)
+			}
+			cfg, err := loadServerConfig(configPath)
+			testCase.assertions(t, cfg, err)
+		})
+	}
+}
+
+func TestServerConfigRepoURLAllowed(t *testing.T) {
+	cfg := &serverConfig{}
+	require.True(t, cfg.repoURLAllowed("https://github.com/example/gitops"))
+	cfg.Allowlists.RepoURLs = []string{"https://github.com/akuity/*"}
+	require.True(t, cfg.repoURLAllowed("https://github.com/akuity/gitops"))
+	require.False(t, cfg.repoURLAllowed("https://github.com/example/gitops"))
+}
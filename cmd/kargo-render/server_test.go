@@ -0,0 +1,845 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// fakeService is a render.Service whose RenderManifests method can be
+// replaced by tests.
+type fakeService struct {
+	render.Service
+	opts     *render.ServiceOptions
+	renderFn func(context.Context, *render.Request) (render.Response, error)
+}
+
+func (f *fakeService) RenderManifests(
+	ctx context.Context,
+	req *render.Request,
+) (render.Response, error) {
+	return f.renderFn(ctx, req)
+}
+
+func TestServer(t *testing.T) {
+	const validRequest = `{
+		"repoURL": "https://github.com/akuity/gitops",
+		"targetBranch": "env/dev"
+	}`
+	var lastSvc *fakeService
+	newSvc := func(opts *render.ServiceOptions) render.Service {
+		lastSvc = &fakeService{
+			opts: opts,
+			renderFn: func(context.Context, *render.Request) (render.Response, error) {
+				return render.Response{ActionTaken: render.ActionTakenPushedDirectly}, nil
+			},
+		}
+		return lastSvc
+	}
+	cfg := &serverConfig{
+		Auth: serverAuthConfig{Tokens: []string{"secret"}},
+		Allowlists: serverAllowlistsConfig{
+			RepoURLs:         []string{"https://github.com/akuity/*"},
+			ConfigManagement: []string{"helm"},
+		},
+		Cache:   serverCacheConfig{CloneCacheDir: "/var/cache/kargo-render"},
+		Metrics: serverMetricsConfig{Enabled: true, Path: "/metrics"},
+		Pprof:   serverPprofConfig{Enabled: true},
+	}
+	srv, err := newServer(log.New(), cfg, newSvc)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]render.ConfigManagementTool{render.ConfigManagementToolHelm},
+		lastSvc.opts.AllowedConfigManagement,
+	)
+	require.Equal(t, "/var/cache/kargo-render", lastSvc.opts.CloneCacheDir)
+
+	doRequest := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1alpha1/render", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("wrong method", func(t *testing.T) {
+		rec := doRequest(http.MethodGet, "secret", "")
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		// A request ID is generated when none is specified
+		require.NotEmpty(t, rec.Header().Get(requestIDHeader))
+		require.Contains(
+			t,
+			rec.Body.String(),
+			`"requestID":"`+rec.Header().Get(requestIDHeader)+`"`,
+		)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		rec := doRequest(http.MethodPost, "", validRequest)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = doRequest(http.MethodPost, "wrong", validRequest)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		rec := doRequest(http.MethodPost, "secret", `{"repoURL": 42}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), "error validating request")
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		rec := doRequest(
+			http.MethodPost,
+			"secret",
+			`{"repoURL": "https://github.com/akuity/gitops", "targetBranch": "env/"}`,
+		)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(
+			t,
+			rec.Body.String(),
+			`"errors":[{"field":"targetBranch","reason":`+
+				`"TargetBranch \"env/\" is an invalid branch name"}]`,
+		)
+	})
+
+	t.Run("local paths", func(t *testing.T) {
+		rec := doRequest(
+			http.MethodPost,
+			"secret",
+			`{"localInPath": "/etc", "targetBranch": "env/dev"}`,
+		)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), "not supported by the server")
+	})
+
+	t.Run("repository not allowed", func(t *testing.T) {
+		rec := doRequest(
+			http.MethodPost,
+			"secret",
+			`{"repoURL": "https://github.com/example/gitops", "targetBranch": "env/dev"}`,
+		)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		// Pushing to a repository that is not allowed is refused too
+		rec = doRequest(
+			http.MethodPost,
+			"secret",
+			`{
+				"repoURL": "https://github.com/akuity/gitops",
+				"pushURL": "https://github.com/example/gitops",
+				"targetBranch": "env/dev"
+			}`,
+		)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		rec := doRequest(http.MethodPost, "secret", validRequest)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"actionTaken":"PUSHED_DIRECTLY"`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			err  error
+			code int
+		}{
+			{
+				name: "invalid request",
+				err:  &render.InvalidRequestError{Err: errors.New("bad")},
+				code: http.StatusBadRequest,
+			},
+			{
+				name: "tool not allowed",
+				err: fmt.Errorf(
+					"error rendering: %w",
+					&render.ConfigManagementToolNotAllowedError{App: "foo"},
+				),
+				code: http.StatusForbidden,
+			},
+			{
+				name: "render timed out",
+				err: fmt.Errorf(
+					"error rendering: %w",
+					&render.AppRenderTimeoutError{App: "foo", Stage: render.StagePreRender},
+				),
+				code: http.StatusGatewayTimeout,
+			},
+			{
+				name: "lock lost",
+				err: &render.LockLostError{
+					TargetBranch: "env/dev",
+					Err:          errors.New("lock is no longer held"),
+				},
+				code: http.StatusServiceUnavailable,
+			},
+			{
+				name: "push rejected",
+				err:  fmt.Errorf("error pushing: %w", git.ErrPushRejected),
+				code: http.StatusConflict,
+			},
+			{
+				name: "credentials rejected",
+				err:  fmt.Errorf("error cloning: %w", git.ErrAuthenticationFailed),
+				code: http.StatusUnauthorized,
+			},
+			{
+				name: "credentials lack permission",
+				err:  fmt.Errorf("error pushing: %w", git.ErrPermissionDenied),
+				code: http.StatusForbidden,
+			},
+			{
+				name: "policy violated",
+				err:  &render.PromotionOrderError{TargetBranch: "env/prod"},
+				code: http.StatusUnprocessableEntity,
+			},
+			{
+				name: "rendering failed",
+				err:  errors.New("something went wrong"),
+				code: http.StatusInternalServerError,
+			},
+		}
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				lastSvc.renderFn = func(
+					context.Context,
+					*render.Request,
+				) (render.Response, error) {
+					return render.Response{}, testCase.err
+				}
+				defer func() {
+					lastSvc.renderFn = func(
+						context.Context,
+						*render.Request,
+					) (render.Response, error) {
+						return render.Response{
+							ActionTaken: render.ActionTakenPushedDirectly,
+						}, nil
+					}
+				}()
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/v1alpha1/render",
+					strings.NewReader(validRequest),
+				)
+				req.Header.Set("Authorization", "Bearer secret")
+				req.Header.Set(requestIDHeader, "fake-request-id")
+				rec := httptest.NewRecorder()
+				srv.ServeHTTP(rec, req)
+				require.Equal(t, testCase.code, rec.Code)
+				require.Equal(
+					t,
+					"application/problem+json",
+					rec.Header().Get("Content-Type"),
+				)
+				require.Equal(t, "fake-request-id", rec.Header().Get(requestIDHeader))
+				p := problem{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+				require.Equal(t, testCase.code, p.Status)
+				require.Equal(t, http.StatusText(testCase.code), p.Title)
+				require.Equal(t, testCase.err.Error(), p.Detail)
+				require.Equal(t, "fake-request-id", p.RequestID)
+			})
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		newCfg := *cfg
+		newCfg.Auth.Tokens = []string{"new-secret"}
+		require.NoError(t, srv.reload(&newCfg))
+		rec := doRequest(http.MethodPost, "secret", validRequest)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = doRequest(http.MethodPost, "new-secret", validRequest)
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("request ID", func(t *testing.T) {
+		var renderedID string
+		lastSvc.renderFn = func(_ context.Context, req *render.Request) (render.Response, error) {
+			renderedID = req.ID
+			return render.Response{ActionTaken: render.ActionTakenPushedDirectly}, nil
+		}
+		testCases := []struct {
+			name       string
+			headerID   string
+			bodyID     string
+			assertions func(*testing.T, *httptest.ResponseRecorder)
+		}{
+			{
+				name:     "ID from header",
+				headerID: "fake-request-id",
+				assertions: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					require.Equal(t, http.StatusOK, rec.Code)
+					require.Equal(t, "fake-request-id", renderedID)
+				},
+			},
+			{
+				name:   "ID from body",
+				bodyID: "fake-body-id",
+				assertions: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					require.Equal(t, http.StatusOK, rec.Code)
+					require.Equal(t, "fake-body-id", renderedID)
+					require.Equal(t, "fake-body-id", rec.Header().Get(requestIDHeader))
+				},
+			},
+			{
+				name: "generated ID",
+				assertions: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					require.Equal(t, http.StatusOK, rec.Code)
+					require.NotEmpty(t, renderedID)
+					require.Equal(t, renderedID, rec.Header().Get(requestIDHeader))
+				},
+			},
+			{
+				name:     "mismatched IDs",
+				headerID: "fake-request-id",
+				bodyID:   "fake-body-id",
+				assertions: func(t *testing.T, rec *httptest.ResponseRecorder) {
+					require.Equal(t, http.StatusBadRequest, rec.Code)
+					require.Contains(t, rec.Body.String(), "does not match")
+				},
+			},
+		}
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				renderedID = ""
+				body := validRequest
+				if testCase.bodyID != "" {
+					body = fmt.Sprintf(
+						`{"repoURL": "https://github.com/akuity/gitops", "targetBranch": "env/dev", "id": %q}`,
+						testCase.bodyID,
+					)
+				}
+				req := httptest.NewRequest(http.MethodPost, "/v1alpha1/render", strings.NewReader(body))
+				req.Header.Set("Authorization", "Bearer new-secret")
+				if testCase.headerID != "" {
+					req.Header.Set(requestIDHeader, testCase.headerID)
+				}
+				rec := httptest.NewRecorder()
+				srv.ServeHTTP(rec, req)
+				testCase.assertions(t, rec)
+			})
+		}
+	})
+
+	t.Run("artifacts", func(t *testing.T) {
+		get := func(path, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			return rec
+		}
+		// Not persisted
+		rec := get("/v1alpha1/renders/fake-id/manifests", "new-secret")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+
+		newCfg := *srv.state.Load().cfg
+		newCfg.Auth.Tokens = []string{"new-secret", "other-secret"}
+		newCfg.Artifacts.Dir = t.TempDir()
+		require.NoError(t, srv.reload(&newCfg))
+		require.Equal(t, newCfg.Artifacts.Dir, lastSvc.opts.ArtifactsDir)
+
+		// Requests are made on behalf of the tenant identified by their token
+		var renderedTenant string
+		lastSvc.renderFn = func(_ context.Context, req *render.Request) (render.Response, error) {
+			renderedTenant = req.Tenant
+			return render.Response{ActionTaken: render.ActionTakenPushedDirectly}, nil
+		}
+		rec = doRequest(http.MethodPost, "new-secret", validRequest)
+		require.Equal(t, http.StatusOK, rec.Code)
+		tenantReq := httptest.NewRequest(http.MethodGet, "/", nil)
+		tenantReq.Header.Set("Authorization", "Bearer new-secret")
+		require.Equal(t, tenant(&newCfg, tenantReq), renderedTenant)
+		require.NotEmpty(t, renderedTenant)
+		require.NotContains(t, renderedTenant, "new-secret")
+
+		tenantDir := filepath.Join(newCfg.Artifacts.Dir, renderedTenant)
+		require.NoError(t, os.MkdirAll(tenantDir, 0700))
+		require.NoError(t, os.WriteFile(
+			filepath.Join(tenantDir, "fake-id.json"),
+			[]byte(`{"id":"fake-id","manifests":{"my-app":"kind: ConfigMap\n"},"diff":"fake diff"}`),
+			0600,
+		))
+
+		rec = get("/v1alpha1/renders/fake-id/manifests", "new-secret")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"my-app":"kind: ConfigMap\n"}`, rec.Body.String())
+		rec = get("/v1alpha1/renders/fake-id/diff", "new-secret")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "fake diff", rec.Body.String())
+		rec = get("/v1alpha1/renders/nonexistent-id/diff", "new-secret")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		// Other tenants can't download the artifacts
+		rec = get("/v1alpha1/renders/fake-id/manifests", "other-secret")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+
+		// Artifacts are removed once they have been kept for longer than the
+		// retention period
+		newCfg.Artifacts.Retention = "1h"
+		require.NoError(t, srv.reload(&newCfg))
+		old := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(tenantDir, "fake-id.json"), old, old))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		srv.pruneArtifacts(ctx)
+		rec = get("/v1alpha1/renders/fake-id/manifests", "new-secret")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1alpha1/queue", nil)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		req.Header.Set("Authorization", "Bearer new-secret")
+		rec = httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"repos":[]}`, rec.Body.String())
+	})
+
+	t.Run("version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"ArgoCDVersion"`)
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		req.Header.Set("Authorization", "Bearer "+srv.state.Load().cfg.Auth.Tokens[0])
+		rec = httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "goroutine profile")
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(
+			t,
+			rec.Body.String(),
+			`kargo_render_server_requests_total{code="200"} 6`,
+		)
+		require.Contains(
+			t,
+			rec.Body.String(),
+			`kargo_render_server_queue_wait_seconds_count{priority="normal"} 15`,
+		)
+	})
+}
+
+func TestServerQueueFull(t *testing.T) {
+	const validRequest = `{
+		"repoURL": "https://github.com/akuity/gitops",
+		"targetBranch": "env/dev"
+	}`
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{Queue: serverQueueConfig{Concurrency: 1, MaxQueued: 1}},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(context.Context, *render.Request) (render.Response, error) {
+					started <- struct{}{}
+					<-unblock
+					return render.Response{}, nil
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	doRequest := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(
+			rec,
+			httptest.NewRequest(
+				http.MethodPost,
+				"/v1alpha1/render",
+				strings.NewReader(validRequest),
+			),
+		)
+		return rec
+	}
+
+	codes := make(chan int, 2)
+	go func() { codes <- doRequest().Code }()
+	<-started
+	go func() { codes <- doRequest().Code }()
+	require.Eventually(
+		t,
+		func() bool {
+			stats := srv.queue.stats()
+			return len(stats) == 1 && stats[0].Queued == 1
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	// A third request would have to wait behind too many others
+	rec := doRequest()
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "20", rec.Header().Get("Retry-After"))
+	require.Contains(t, rec.Body.String(), "too many requests are already queued")
+
+	close(unblock)
+	<-started
+	require.Equal(t, http.StatusOK, <-codes)
+	require.Equal(t, http.StatusOK, <-codes)
+}
+
+func TestServerIdempotency(t *testing.T) {
+	const keyedRequest = `{
+		"repoURL": "https://github.com/akuity/gitops",
+		"targetBranch": "env/dev",
+		"idempotencyKey": "promotion-123"
+	}`
+	var calls int
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{Idempotency: serverIdempotencyConfig{TTL: "1h"}},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(context.Context, *render.Request) (render.Response, error) {
+					calls++
+					return render.Response{
+						ActionTaken: render.ActionTakenPushedDirectly,
+						CommitID:    fmt.Sprintf("commit-%d", calls),
+					}, nil
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(
+			rec,
+			httptest.NewRequest(
+				http.MethodPost,
+				"/v1alpha1/render",
+				strings.NewReader(keyedRequest),
+			),
+		)
+		require.Equal(t, http.StatusOK, rec.Code)
+		// The retry receives the original response
+		require.Contains(t, rec.Body.String(), `"commitID":"commit-1"`)
+	}
+	require.Equal(t, 1, calls)
+}
+
+func TestServerBatching(t *testing.T) {
+	var calls atomic.Int32
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{Batching: serverBatchingConfig{Window: "100ms"}},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(_ context.Context, req *render.Request) (render.Response, error) {
+					calls.Add(1)
+					return render.Response{CommitID: req.Ref}, nil
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	wg := sync.WaitGroup{}
+	for _, ref := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(ref string) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(
+				rec,
+				httptest.NewRequest(
+					http.MethodPost,
+					"/v1alpha1/render",
+					strings.NewReader(fmt.Sprintf(`{
+						"repoURL": "https://github.com/akuity/gitops",
+						"targetBranch": "env/dev",
+						"ref": %q
+					}`, ref)),
+				),
+			)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Contains(t, rec.Body.String(), `"commitID":"b"`)
+		}(ref)
+		// Ensure requests arrive in order
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestServerLocking(t *testing.T) {
+	mr := miniredis.RunT(t)
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{
+			Locking: serverLockingConfig{
+				Backend: serverLockingBackendRedis,
+				Redis:   serverRedisConfig{Addr: mr.Addr()},
+			},
+		},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(context.Context, *render.Request) (render.Response, error) {
+					// The branch is locked while it is rendered
+					require.Len(t, mr.Keys(), 1)
+					return render.Response{}, nil
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(
+		rec,
+		httptest.NewRequest(
+			http.MethodPost,
+			"/v1alpha1/render",
+			strings.NewReader(`{
+				"repoURL": "https://github.com/akuity/gitops",
+				"targetBranch": "env/dev"
+			}`),
+		),
+	)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, mr.Keys())
+}
+
+func TestServerRouting(t *testing.T) {
+	replicas := map[string]string{}
+	handlers := map[string]http.Handler{}
+	for _, replica := range []string{"a", "b"} {
+		replica := replica
+		httpSrv := httptest.NewServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlers[replica].ServeHTTP(w, r)
+			}),
+		)
+		t.Cleanup(httpSrv.Close)
+		replicas[replica] = httpSrv.URL
+	}
+	for replica := range replicas {
+		replica := replica
+		srv, err := newServer(
+			log.New(),
+			&serverConfig{
+				Auth: serverAuthConfig{Tokens: []string{"secret"}},
+				Routing: serverRoutingConfig{
+					Replica:  replica,
+					Replicas: replicas,
+				},
+			},
+			func(opts *render.ServiceOptions) render.Service {
+				return &fakeService{
+					opts: opts,
+					renderFn: func(_ context.Context, req *render.Request) (render.Response, error) {
+						if req.TargetBranch == "env/fail" {
+							return render.Response{}, &render.InvalidConfigError{}
+						}
+						return render.Response{CommitID: replica, ArtifactsID: req.ID}, nil
+					},
+				}
+			},
+		)
+		require.NoError(t, err)
+		handlers[replica] = srv
+	}
+	ring := render.NewHashRing([]string{"a", "b"}, 0)
+	const repoURL = "https://github.com/akuity/gitops"
+	for i := 0; i < 10; i++ {
+		branch := fmt.Sprintf("env/%d", i)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/v1alpha1/render",
+			strings.NewReader(fmt.Sprintf(
+				`{"repoURL": %q, "targetBranch": %q}`,
+				repoURL,
+				branch,
+			)),
+		)
+		req.Header.Set("Authorization", "Bearer secret")
+		handlers["a"].ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(
+			t,
+			rec.Body.String(),
+			fmt.Sprintf(`"commitID":%q`, ring.Owner(repoURL, branch)),
+		)
+		// The owner handles the request under the ID generated by the replica
+		// that received it
+		require.Contains(
+			t,
+			rec.Body.String(),
+			fmt.Sprintf(`"artifactsID":%q`, rec.Header().Get(requestIDHeader)),
+		)
+	}
+	// Problems reported by the owner are passed on
+	for _, replica := range []string{"a", "b"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/v1alpha1/render",
+			strings.NewReader(fmt.Sprintf(
+				`{"repoURL": %q, "targetBranch": "env/fail"}`,
+				repoURL,
+			)),
+		)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set(requestIDHeader, "fake-request-id")
+		handlers[replica].ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+		require.Contains(t, rec.Body.String(), `"requestID":"fake-request-id"`)
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	const validRequest = `{
+		"repoURL": "https://github.com/akuity/gitops",
+		"targetBranch": "env/dev"
+	}`
+	started := make(chan struct{})
+	srv, err := newServer(
+		log.New(),
+		&serverConfig{
+			Auth:  serverAuthConfig{Tokens: []string{"secret", "other-secret"}},
+			Queue: serverQueueConfig{Concurrency: 1},
+		},
+		func(opts *render.ServiceOptions) render.Service {
+			return &fakeService{
+				opts: opts,
+				renderFn: func(ctx context.Context, _ *render.Request) (render.Response, error) {
+					started <- struct{}{}
+					<-ctx.Done()
+					return render.Response{}, fmt.Errorf("error rendering: %w", ctx.Err())
+				},
+			}
+		},
+	)
+	require.NoError(t, err)
+	doRequestAs := func(token, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/v1alpha1/render",
+			strings.NewReader(validRequest),
+		)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(requestIDHeader, id)
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	doRequest := func(id string) *httptest.ResponseRecorder {
+		return doRequestAs("secret", id)
+	}
+	doCancelAs := func(token, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/v1alpha1/renders/"+id, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	doCancel := func(id string) *httptest.ResponseRecorder {
+		return doCancelAs("secret", id)
+	}
+
+	// Nothing to cancel
+	rec := doCancel("unknown")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	running := make(chan *httptest.ResponseRecorder, 1)
+	go func() { running <- doRequest("running") }()
+	<-started
+	queued := make(chan *httptest.ResponseRecorder, 1)
+	go func() { queued <- doRequest("queued") }()
+	require.Eventually(
+		t,
+		func() bool {
+			stats := srv.queue.stats()
+			return len(stats) == 1 && stats[0].Queued == 1
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	// A request ID can't be reused while the request is in progress
+	rec = doRequest("running")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "already queued or running")
+
+	// Other tenants can neither cancel the request nor be blocked by its ID
+	rec = doCancelAs("other-secret", "running")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	otherQueued := make(chan *httptest.ResponseRecorder, 1)
+	go func() { otherQueued <- doRequestAs("other-secret", "running") }()
+	require.Eventually(
+		t,
+		func() bool {
+			stats := srv.queue.stats()
+			return len(stats) == 1 && stats[0].Queued == 2
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+	rec = doCancelAs("other-secret", "running")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"id":"running","state":"canceled"}`, rec.Body.String())
+	rec = <-otherQueued
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// Canceling the queued request removes it from the queue
+	rec = doCancel("queued")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"id":"queued","state":"canceled"}`, rec.Body.String())
+	rec = <-queued
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), `rendering request \"queued\" was canceled`)
+	require.Empty(t, srv.queue.stats()[0].Queued)
+
+	// Canceling the running request interrupts it
+	rec = doCancel("running")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"id":"running","state":"canceled"}`, rec.Body.String())
+	rec = <-running
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Empty(t, srv.queue.stats())
+
+	// Requests that are no longer in progress can't be canceled
+	rec = doCancel("running")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// eventFlushTimeout is the maximum amount of time a command that is about to
+// exit waits for the events it emitted to be delivered.
+const eventFlushTimeout = 30 * time.Second
+
+// prepareHost readies the host for handling rendering requests. It's called
+// once, when a command that handles them starts, rather than each time a
+// rendering service is created. Problems are logged, since none of them keep
+// requests from being handled.
+func prepareHost(logger *log.Logger) {
+	// Detect the version of the git binary up front so that any problem with it
+	// is apparent before the first request is handled
+	if gitVersion, err := git.BinaryVersion(); err != nil {
+		logger.WithError(err).Warn("error detecting git version")
+	} else {
+		logger.WithField("gitVersion", gitVersion).Debug("detected git version")
+	}
+	// Credentials may have been left behind by a process that crashed while
+	// handling requests
+	swept, err := git.SweepCredentials()
+	if err != nil {
+		logger.WithError(err).Warn("error removing abandoned credentials")
+	}
+	if len(swept) > 0 {
+		logger.WithField("workspaces", len(swept)).
+			Info("removed credentials from abandoned workspaces")
+	}
+}
+
+// flushEvents waits, for a limited time, for the provided AsyncEventSink to
+// deliver the events emitted by a command that is about to exit. Failures are
+// logged, since the outcome of the command doesn't depend on them.
+func flushEvents(logger *log.Logger, sink *render.AsyncEventSink) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventFlushTimeout)
+	defer cancel()
+	if err := sink.Flush(ctx); err != nil {
+		logger.WithError(err).Error("error emitting events")
+	}
+}
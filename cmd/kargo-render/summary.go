@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	render "github.com/akuity/kargo-render"
+)
+
+// renderSummary aggregates the outcomes of rendering several target branches
+// in one invocation, such as one wave of a promotion, so that orchestration
+// tooling has a single artifact to inspect.
+type renderSummary struct {
+	// Branches summarizes the outcome for each target branch, in the order the
+	// branches were rendered.
+	Branches []branchSummary `json:"branches"`
+	// Succeeded is the number of target branches that were rendered, whether or
+	// not any action was taken.
+	Succeeded int `json:"succeeded"`
+	// Failed is the number of target branches that could not be rendered.
+	Failed int `json:"failed"`
+	// Duration is how long rendering all of the target branches took.
+	Duration time.Duration `json:"duration"`
+}
+
+// branchSummary summarizes the outcome of rendering a single target branch.
+type branchSummary struct {
+	TargetBranch   string             `json:"targetBranch"`
+	ActionTaken    render.ActionTaken `json:"actionTaken,omitempty"`
+	CommitID       string             `json:"commitID,omitempty"`
+	PullRequestURL string             `json:"pullRequestURL,omitempty"`
+	Duration       time.Duration      `json:"duration"`
+	Warnings       []string           `json:"warnings,omitempty"`
+	Error          string             `json:"error,omitempty"`
+}
+
+// summarize aggregates the provided results into a renderSummary.
+func summarize(results []actionResult) renderSummary {
+	summary := renderSummary{
+		Branches: make([]branchSummary, len(results)),
+	}
+	for i, result := range results {
+		branch := branchSummary{
+			TargetBranch: result.TargetBranch,
+			Duration:     result.duration,
+			Error:        result.Error,
+		}
+		if res := result.Response; res != nil {
+			branch.ActionTaken = res.ActionTaken
+			branch.CommitID = res.CommitID
+			branch.PullRequestURL = res.PullRequestURL
+			branch.Warnings = res.Warnings
+		}
+		if branch.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+		summary.Duration += branch.Duration
+		summary.Branches[i] = branch
+	}
+	return summary
+}
+
+// writeSummaryTable writes the provided summary to the provided io.Writer as
+// a human-readable table with one row per target branch.
+func writeSummaryTable(summary renderSummary, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BRANCH\tACTION\tCOMMIT/PR\tDURATION\tWARNINGS\tERROR")
+	for _, branch := range summary.Branches {
+		action := string(branch.ActionTaken)
+		if action == "" {
+			action = "-"
+		}
+		change := branch.PullRequestURL
+		if change == "" {
+			change = shortID(branch.CommitID)
+		}
+		if change == "" {
+			change = "-"
+		}
+		errMsg := branch.Error
+		if errMsg == "" {
+			errMsg = "-"
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%d\t%s\n",
+			branch.TargetBranch,
+			action,
+			change,
+			branch.Duration.Round(time.Millisecond),
+			len(branch.Warnings),
+			// A multi-line error would break the table
+			strings.ReplaceAll(errMsg, "\n", " "),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(
+		out,
+		"\n%d succeeded, %d failed in %s\n",
+		summary.Succeeded,
+		summary.Failed,
+		summary.Duration.Round(time.Millisecond),
+	)
+	return nil
+}
+
+// shortID returns the abbreviated form of the provided commit ID.
+func shortID(id string) string {
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestSummarize(t *testing.T) {
+	summary := summarize([]actionResult{
+		{
+			TargetBranch: "env/dev",
+			Response: &render.Response{
+				ActionTaken: render.ActionTakenPushedDirectly,
+				CommitID:    "0123456789abcdef",
+				Warnings:    []string{"something noteworthy"},
+			},
+			duration: 2 * time.Second,
+		},
+		{
+			TargetBranch: "env/staging",
+			Response: &render.Response{
+				ActionTaken:    render.ActionTakenOpenedPR,
+				PullRequestURL: "https://github.com/example/repo/pull/1",
+			},
+			duration: time.Second,
+		},
+		{
+			TargetBranch: "env/prod",
+			Error:        "error rendering branch env/prod:\nsomething went wrong",
+			duration:     500 * time.Millisecond,
+		},
+	})
+	require.Equal(t, 2, summary.Succeeded)
+	require.Equal(t, 1, summary.Failed)
+	require.Equal(t, 3500*time.Millisecond, summary.Duration)
+	require.Len(t, summary.Branches, 3)
+	require.Equal(
+		t,
+		branchSummary{
+			TargetBranch: "env/dev",
+			ActionTaken:  render.ActionTakenPushedDirectly,
+			CommitID:     "0123456789abcdef",
+			Duration:     2 * time.Second,
+			Warnings:     []string{"something noteworthy"},
+		},
+		summary.Branches[0],
+	)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writeSummaryTable(summary, out))
+	table := out.String()
+	require.Contains(t, table, "BRANCH")
+	require.Regexp(t, `env/dev +PUSHED_DIRECTLY +0123456 +2s +1 +-\n`, table)
+	require.Contains(t, table, "https://github.com/example/repo/pull/1")
+	require.Contains(t, table, "error rendering branch env/prod: something went wrong")
+	require.Contains(t, table, "2 succeeded, 1 failed in 3.5s")
+}
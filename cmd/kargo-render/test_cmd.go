@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+)
+
+type testOptions struct {
+	debug          bool
+	goldenDir      string
+	images         []string
+	localInPath    string
+	targetBranches []string
+	update         bool
+}
+
+func newTestCommand() *cobra.Command {
+	cmdOpts := &testOptions{}
+
+	cmd := &cobra.Command{
+		Use: "test",
+		Short: "Render environment-specific branches from a local repo and " +
+			"compare the results to golden files",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmdOpts.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	// Register the option flags on the command.
+	cmdOpts.addFlags(cmd)
+	if err := cmd.RegisterFlagCompletionFunc(
+		flagTargetBranch,
+		completeTargetBranches(func(*cobra.Command) branchSource {
+			return branchSource{localPath: cmdOpts.localInPath}
+		}),
+	); err != nil {
+		panic(fmt.Errorf("could not register completions of %s flag", flagTargetBranch))
+	}
+
+	return cmd
+}
+
+// addFlags adds the flags for the test options to the provided command.
+func (o *testOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(
+		&o.debug,
+		flagDebug,
+		"d",
+		false,
+		"Display debug output.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.goldenDir,
+		flagGoldenDir,
+		filepath.Join("testdata", "golden"),
+		"The directory containing golden files. Golden files for each target "+
+			"branch are stored in a subdirectory named after the branch.",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&o.images,
+		flagImage,
+		"i",
+		nil,
+		"An image to be incorporated into the rendered manifests. This flag may "+
+			"be used more than once.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.localInPath,
+		flagLocalInPath,
+		".",
+		"Read input from the specified path.",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&o.targetBranches,
+		flagTargetBranch,
+		"t",
+		nil,
+		"A branch to render and compare against golden files. This flag may be "+
+			"used more than once. If not specified, all branches explicitly named "+
+			"in the repository's Kargo Render configuration are tested.",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.update,
+		flagUpdate,
+		false,
+		"Update golden files to match the rendered manifests instead of "+
+			"comparing against them.",
+	)
+}
+
+// run renders each target branch and compares the results to golden files.
+func (o *testOptions) run(ctx context.Context, out io.Writer) error {
+	logLevel := render.LogLevelError
+	if o.debug {
+		logLevel = render.LogLevelDebug
+	}
+
+	targetBranches := o.targetBranches
+	if len(targetBranches) == 0 {
+		var err error
+		if targetBranches, err = render.ConfiguredBranchNames(o.localInPath); err != nil {
+			return err
+		}
+		if len(targetBranches) == 0 {
+			return errors.New(
+				"no target branches were specified and none are explicitly named in " +
+					"the repository's Kargo Render configuration",
+			)
+		}
+	}
+
+	svc := render.NewService(
+		&render.ServiceOptions{
+			LogLevel: logLevel,
+		},
+	)
+
+	var failed bool
+	for _, targetBranch := range targetBranches {
+		res, err := svc.RenderManifests(
+			ctx,
+			&render.Request{
+				LocalInPath:  o.localInPath,
+				TargetBranch: targetBranch,
+				Images:       o.images,
+				Stdout:       true,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("error rendering branch %q: %w", targetBranch, err)
+		}
+		branchGoldenDir := filepath.Join(o.goldenDir, targetBranch)
+		if o.update {
+			if err = updateGoldenFiles(branchGoldenDir, res.Manifests); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "UPDATED  %s\n", targetBranch)
+			continue
+		}
+		mismatches, err := compareGoldenFiles(branchGoldenDir, res.Manifests)
+		if err != nil {
+			return err
+		}
+		if len(mismatches) == 0 {
+			fmt.Fprintf(out, "PASS     %s\n", targetBranch)
+			continue
+		}
+		failed = true
+		fmt.Fprintf(out, "FAIL     %s\n", targetBranch)
+		for _, mismatch := range mismatches {
+			fmt.Fprintf(out, "  %s\n", mismatch)
+		}
+	}
+
+	if failed {
+		return errors.New(
+			"rendered manifests do not match golden files; re-run with --update " +
+				"if these changes are expected",
+		)
+	}
+	return nil
+}
+
+// goldenFileName returns the name of the golden file for the specified app.
+func goldenFileName(app string) string {
+	return fmt.Sprintf("%s.yaml", app)
+}
+
+// updateGoldenFiles replaces the contents of the specified directory with one
+// golden file per app.
+func updateGoldenFiles(dir string, manifests map[string][]byte) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("error removing golden files from %q: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %q: %w", dir, err)
+	}
+	for app, appManifests := range manifests {
+		path := filepath.Join(dir, goldenFileName(app))
+		if err := os.WriteFile(path, appManifests, 0644); err != nil { // nolint: gosec
+			return fmt.Errorf("error writing golden file %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// compareGoldenFiles compares rendered manifests to the golden files in the
+// specified directory and returns a sorted description of every discrepancy.
+func compareGoldenFiles(
+	dir string,
+	manifests map[string][]byte,
+) ([]string, error) {
+	mismatches := []string{}
+	expected := map[string]struct{}{}
+	for app, appManifests := range manifests {
+		fileName := goldenFileName(app)
+		expected[fileName] = struct{}{}
+		path := filepath.Join(dir, fileName)
+		goldenBytes, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: golden file missing", path))
+				continue
+			}
+			return nil, fmt.Errorf("error reading golden file %q: %w", path, err)
+		}
+		if !bytes.Equal(goldenBytes, appManifests) {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf("%s: %s", path, describeDifference(goldenBytes, appManifests)),
+			)
+		}
+	}
+	items, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error listing golden files in %q: %w", dir, err)
+	}
+	for _, item := range items {
+		if _, ok := expected[item.Name()]; !ok && !item.IsDir() {
+			mismatches = append(
+				mismatches,
+				fmt.Sprintf(
+					"%s: golden file has no corresponding app",
+					filepath.Join(dir, item.Name()),
+				),
+			)
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches, nil
+}
+
+// describeDifference returns a brief, human-readable description of the first
+// line at which the expected and actual bytes differ.
+func describeDifference(expected, actual []byte) string {
+	expectedLines := strings.Split(string(expected), "\n")
+	actualLines := strings.Split(string(actual), "\n")
+	for i := 0; i < len(expectedLines) && i < len(actualLines); i++ {
+		if expectedLines[i] != actualLines[i] {
+			return fmt.Sprintf(
+				"line %d: expected %q, got %q",
+				i+1,
+				expectedLines[i],
+				actualLines[i],
+			)
+		}
+	}
+	return fmt.Sprintf(
+		"expected %d lines, got %d",
+		len(expectedLines),
+		len(actualLines),
+	)
+}
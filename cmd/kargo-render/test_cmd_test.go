@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoldenFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "env", "dev")
+	manifests := map[string][]byte{
+		"foo": []byte("kind: ConfigMap\nmetadata:\n  name: foo\n"),
+		"bar": []byte("kind: ConfigMap\nmetadata:\n  name: bar\n"),
+	}
+
+	// Nothing to compare against yet
+	mismatches, err := compareGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 2)
+	require.Contains(t, mismatches[0], "golden file missing")
+
+	// Write golden files and compare again
+	err = updateGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	mismatches, err = compareGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	// Change one app's manifests
+	manifests["foo"] = []byte("kind: ConfigMap\nmetadata:\n  name: baz\n")
+	mismatches, err = compareGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	require.Contains(t, mismatches[0], "foo.yaml")
+	require.Contains(t, mismatches[0], "line 3")
+
+	// Remove an app entirely
+	delete(manifests, "bar")
+	mismatches, err = compareGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 2)
+	require.Contains(t, mismatches[0], "golden file has no corresponding app")
+
+	// Update should remove stale golden files
+	err = updateGoldenFiles(dir, manifests)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "bar.yaml"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// envUserConfig is the name of the environment variable that optionally
+// specifies the path to the user-level configuration file, overriding the
+// default path.
+const envUserConfig = envPrefix + "CONFIG"
+
+// userConfig is the content of the user-level configuration file.
+type userConfig struct {
+	// Defaults maps the names of flags of the render command, e.g. output or
+	// repo-netrc, to values used for any of the flags that are specified
+	// neither explicitly nor using environment variables. A flag that may be
+	// specified more than once may have a list of values, and a flag whose
+	// values are of the form key=value may have a map.
+	Defaults map[string]any `json:"defaults,omitempty"`
+}
+
+// userConfigPath returns the path to the user-level configuration file along
+// with a bool indicating whether the path was specified explicitly using the
+// environment variable named by envUserConfig. Otherwise, the path is
+// kargo-render/config.yaml beneath $XDG_CONFIG_HOME or, if that is not set,
+// beneath ~/.config. An empty path is returned if neither the environment
+// variable nor a home directory is available.
+func userConfigPath() (string, bool) {
+	if path := os.Getenv(envUserConfig); path != "" {
+		return path, true
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "kargo-render", "config.yaml"), false
+}
+
+// applyUserConfig sets every flag of the provided command that has not been
+// set, explicitly or from an environment variable, to its default in the
+// user-level configuration file at the specified path, if any. A missing file
+// is only an error if it is required.
+func applyUserConfig(cmd *cobra.Command, path string, required bool) error {
+	if path == "" {
+		return nil
+	}
+	cfgBytes, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading user configuration: %w", err)
+	}
+	cfg := userConfig{}
+	if err = yaml.UnmarshalStrict(cfgBytes, &cfg); err != nil {
+		return fmt.Errorf("error parsing user configuration %s: %w", path, err)
+	}
+	names := make([]string, 0, len(cfg.Defaults))
+	for name := range cfg.Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return fmt.Errorf(
+				"user configuration %s specifies a default for unknown flag --%s",
+				path,
+				name,
+			)
+		}
+		if flag.Changed {
+			continue
+		}
+		for _, value := range flagValues(cfg.Defaults[name]) {
+			if err = cmd.Flags().Set(name, value); err != nil {
+				return fmt.Errorf(
+					"user configuration %s specifies an invalid default for --%s: %w",
+					path,
+					name,
+					err,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// flagValues returns the values with which a flag is set to the provided
+// default from the user-level configuration file, one value per time the flag
+// would be specified on the command line. Lists yield one value per element
+// and maps yield one key=value pair per entry, in order by key.
+func flagValues(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, element := range v {
+			values = append(values, fmt.Sprint(element))
+		}
+		return values
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = fmt.Sprintf("%s=%v", key, v[key])
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
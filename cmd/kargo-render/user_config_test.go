@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserConfigPath(t *testing.T) {
+	t.Setenv(envUserConfig, "")
+	t.Setenv("XDG_CONFIG_HOME", "/config")
+	path, required := userConfigPath()
+	require.Equal(t, "/config/kargo-render/config.yaml", path)
+	require.False(t, required)
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/user")
+	path, _ = userConfigPath()
+	require.Equal(t, "/home/user/.config/kargo-render/config.yaml", path)
+
+	t.Setenv(envUserConfig, "/etc/kargo-render.yaml")
+	path, required = userConfigPath()
+	require.Equal(t, "/etc/kargo-render.yaml", path)
+	require.True(t, required)
+}
+
+func TestApplyUserConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(
+		t,
+		os.WriteFile(
+			path,
+			[]byte(`defaults:
+  debug: true
+  output: json
+  repo-username: from-config
+  image:
+  - nginx:1.25
+  - redis:7
+  label:
+    team: platform
+    tier: web
+`),
+			0600,
+		),
+	)
+	cmd := newRenderCommand()
+	require.NoError(t, cmd.Flags().Set(flagOutput, flagOutputYAML))
+	require.NoError(t, applyUserConfig(cmd, path, true))
+
+	flag := func(name string) string {
+		return cmd.Flags().Lookup(name).Value.String()
+	}
+	require.Equal(t, "true", flag(flagDebug))
+	// Explicit flags take precedence
+	require.Equal(t, flagOutputYAML, flag(flagOutput))
+	require.Equal(t, "from-config", flag(flagRepoUsername))
+	require.Equal(t, "[nginx:1.25,redis:7]", flag(flagImage))
+	labels, err := cmd.Flags().GetStringToString(flagLabel)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "platform", "tier": "web"}, labels)
+
+	// A missing file is only an error if it was specified explicitly
+	missingPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, applyUserConfig(newRenderCommand(), missingPath, false))
+	require.ErrorContains(
+		t,
+		applyUserConfig(newRenderCommand(), missingPath, true),
+		"error reading user configuration",
+	)
+
+	require.NoError(
+		t,
+		os.WriteFile(path, []byte("defaults:\n  no-such-flag: true\n"), 0600),
+	)
+	require.ErrorContains(
+		t,
+		applyUserConfig(newRenderCommand(), path, true),
+		"unknown flag --no-such-flag",
+	)
+
+	require.NoError(
+		t,
+		os.WriteFile(path, []byte("defaults:\n  debug: sometimes\n"), 0600),
+	)
+	require.ErrorContains(
+		t,
+		applyUserConfig(newRenderCommand(), path, true),
+		"invalid default for --debug",
+	)
+}
@@ -9,6 +9,22 @@ import (
 	"github.com/akuity/kargo-render/internal/version"
 )
 
+// versionInfo is the version information printed by the version command and
+// served by the server. In addition to information about the build, it
+// includes the versions of the tools upon which rendering depends.
+type versionInfo struct {
+	version.Version
+	version.Tools
+}
+
+// getVersionInfo returns version information.
+func getVersionInfo() versionInfo {
+	return versionInfo{
+		Version: version.GetVersion(),
+		Tools:   version.GetTools(),
+	}
+}
+
 type versionOptions struct {
 	outputFormat string
 }
@@ -48,5 +64,5 @@ func (o *versionOptions) run(_ context.Context, out io.Writer) error {
 	if o.outputFormat == "" {
 		o.outputFormat = "json"
 	}
-	return output(version.GetVersion(), out, o.outputFormat)
+	return output(getVersionInfo(), out, o.outputFormat)
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+)
+
+type warmUpOptions struct {
+	*render.WarmUpRequest
+	repoClientCertOptions
+	cloneCacheDir string
+	debug         bool
+	outputFormat  string
+}
+
+func newWarmUpCommand() *cobra.Command {
+	cmdOpts := &warmUpOptions{
+		WarmUpRequest: &render.WarmUpRequest{},
+	}
+
+	cmd := &cobra.Command{
+		Use: "warm-up",
+		Short: "Mirror a remote gitops repo into a clone cache and optionally " +
+			"pre-render its branches",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			setRepoCredsFromEnv(cmd)
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmdOpts.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	// Register the option flags on the command.
+	cmdOpts.addFlags(cmd)
+
+	return cmd
+}
+
+// addFlags adds the flags for the warm-up options to the provided command.
+func (o *warmUpOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&o.cloneCacheDir,
+		flagCloneCacheDir,
+		"",
+		"The directory in which mirrors of remote gitops repositories are kept. "+
+			"Rendering with the same clone cache directory copies objects from the "+
+			"mirror instead of fetching them all from the remote repository.",
+	)
+
+	cmd.Flags().BoolVarP(
+		&o.debug,
+		flagDebug,
+		"d",
+		false,
+		"Display debug output.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.outputFormat,
+		flagOutput,
+		"o",
+		"",
+		"Specify a format for command output (json or yaml).",
+	)
+
+	cmd.Flags().BoolVar(
+		&o.PreRender,
+		flagPreRender,
+		false,
+		"Render manifests for every branch explicitly named in the repository's "+
+			"Kargo Render configuration without writing anything to those "+
+			"branches. This warms any caches used by configuration management "+
+			"tools.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.RepoURL,
+		flagRepo,
+		"r",
+		"",
+		"The URL of a remote gitops repository.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.RepoCreds.Password,
+		flagRepoPassword,
+		"p",
+		"",
+		"Password or token for reading from the remote gitops repository. Can "+
+			"alternatively be specified using the KARGO_RENDER_REPO_PASSWORD "+
+			"environment variable.",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.RepoCreds.Username,
+		flagRepoUsername,
+		"u",
+		"",
+		"Username for reading from the remote gitops repository. Can "+
+			"alternatively be specified using the KARGO_RENDER_REPO_USERNAME "+
+			"environment variable.",
+	)
+
+	o.repoClientCertOptions.addFlags(cmd)
+
+	if err := cmd.MarkFlagRequired(flagRepo); err != nil {
+		panic(fmt.Errorf("could not mark %s flag as required", flagRepo))
+	}
+}
+
+// run performs the warm-up.
+func (o *warmUpOptions) run(ctx context.Context, out io.Writer) error {
+	if err := o.repoClientCertOptions.load(&o.RepoCreds); err != nil {
+		return err
+	}
+
+	logLevel := render.LogLevelError
+	if o.debug {
+		logLevel = render.LogLevelDebug
+	}
+
+	res, err := render.NewService(
+		&render.ServiceOptions{
+			LogLevel:      logLevel,
+			CloneCacheDir: o.cloneCacheDir,
+		},
+	).WarmUp(ctx, o.WarmUpRequest)
+	if err != nil {
+		return err
+	}
+
+	if o.outputFormat != "" {
+		return output(res, out, o.outputFormat)
+	}
+	if res.Mirrored {
+		fmt.Fprintf(out, "\nMirrored %s into %s\n", o.RepoURL, o.cloneCacheDir)
+	}
+	for _, branch := range res.PreRenderedBranches {
+		fmt.Fprintf(out, "Pre-rendered branch %s\n", branch)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	render "github.com/akuity/kargo-render"
+)
+
+type workerOptions struct {
+	redis                   redis.Options
+	queue                   render.RedisRequestQueueOptions
+	allowedConfigManagement []string
+	cloneCacheDir           string
+	concurrency             int
+	debug                   bool
+	idempotencyTTL          time.Duration
+	renderTimeout           time.Duration
+}
+
+func newWorkerCommand() *cobra.Command {
+	cmdOpts := &workerOptions{}
+
+	cmd := &cobra.Command{
+		Use: "worker",
+		Short: "Handle rendering requests received from Redis streams and " +
+			"publish their results",
+		Args: cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			if !cmd.Flags().Changed(flagRedisPassword) {
+				cmdOpts.redis.Password = os.Getenv(envPrefix + "REDIS_PASSWORD")
+			}
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmdOpts.run(cmd.Context())
+		},
+	}
+
+	// Register the option flags on the command.
+	cmdOpts.addFlags(cmd)
+
+	return cmd
+}
+
+// addFlags adds the flags for the worker options to the provided command.
+func (o *workerOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&o.allowedConfigManagement,
+		flagAllowedConfigManagement,
+		nil,
+		"A comma-separated list of configuration management tools (directory, "+
+			"helm, kustomize, or plugin) that may be used to render manifests. If "+
+			"not specified, all tools are allowed.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.cloneCacheDir,
+		flagCloneCacheDir,
+		"",
+		"The directory in which mirrors of remote gitops repositories are kept. "+
+			"Rendering with the same clone cache directory copies objects from the "+
+			"mirror instead of fetching them all from the remote repository.",
+	)
+
+	cmd.Flags().IntVar(
+		&o.concurrency,
+		flagConcurrency,
+		1,
+		"The maximum number of rendering requests handled at once.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.queue.Consumer,
+		flagConsumer,
+		"",
+		"The name, unique among workers, by which this worker is known to Redis. "+
+			"If not specified, the hostname is used.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.queue.Group,
+		flagConsumerGroup,
+		"",
+		"The name of the Redis consumer group shared by all workers. If not "+
+			"specified, kargo-render is used.",
+	)
+
+	cmd.Flags().BoolVarP(
+		&o.debug,
+		flagDebug,
+		"d",
+		false,
+		"Display debug output.",
+	)
+
+	cmd.Flags().DurationVar(
+		&o.idempotencyTTL,
+		flagIdempotencyTTL,
+		24*time.Hour,
+		"How long, e.g. 24h, requests bearing the same idempotency key as a "+
+			"request that succeeded get its result instead of being rendered "+
+			"again. Results are kept in memory, so they aren't shared between "+
+			"workers or restarts.",
+	)
+
+	cmd.Flags().DurationVar(
+		&o.queue.RedeliveryTimeout,
+		flagRedeliveryTimeout,
+		0,
+		"How long, e.g. 10m, a request received by a worker may go "+
+			"unacknowledged before it is delivered again, possibly to another "+
+			"worker. It must exceed the time rendering any request may take. If "+
+			"not specified, it is 10m.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.redis.Addr,
+		flagRedisAddr,
+		"",
+		"The host:port address of the Redis server.",
+	)
+
+	cmd.Flags().IntVar(
+		&o.redis.DB,
+		flagRedisDB,
+		0,
+		"The number of the Redis database used.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.redis.Password,
+		flagRedisPassword,
+		"",
+		"The password used to authenticate to the Redis server, if any. Can "+
+			"alternatively be specified using the KARGO_RENDER_REDIS_PASSWORD "+
+			"environment variable.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.redis.Username,
+		flagRedisUsername,
+		"",
+		"The username used to authenticate to the Redis server, if any.",
+	)
+
+	cmd.Flags().DurationVar(
+		&o.renderTimeout,
+		flagRenderTimeout,
+		0,
+		"The maximum amount of time, e.g. 2m, rendering the manifests of any "+
+			"single app may take. If not specified, there is no limit.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.queue.RequestsStream,
+		flagRequestsStream,
+		"",
+		"The Redis stream from which rendering requests are received, each in "+
+			"the request field of an entry. If not specified, "+
+			"kargo-render:requests is used.",
+	)
+
+	cmd.Flags().StringVar(
+		&o.queue.ResultsStream,
+		flagResultsStream,
+		"",
+		"The Redis stream to which results are published, each in the result "+
+			"field of an entry. If not specified, kargo-render:results is used.",
+	)
+
+	if err := cmd.MarkFlagRequired(flagRedisAddr); err != nil {
+		panic(fmt.Errorf("could not mark %s flag as required", flagRedisAddr))
+	}
+}
+
+// run handles rendering requests until the worker receives SIGINT or SIGTERM,
+// at which point it waits for requests already in progress to be handled.
+func (o *workerOptions) run(ctx context.Context) error {
+	logLevel := render.LogLevelInfo
+	if o.debug {
+		logLevel = render.LogLevelDebug
+	}
+
+	logger := log.New()
+	logger.SetLevel(log.Level(logLevel))
+	prepareHost(logger)
+
+	queue, err := render.NewRedisRequestQueue(redis.NewClient(&o.redis), &o.queue)
+	if err != nil {
+		return err
+	}
+	svc := render.NewIdempotentService(
+		render.NewService(
+			&render.ServiceOptions{
+				LogLevel: logLevel,
+				AllowedConfigManagement: configManagementTools(
+					o.allowedConfigManagement,
+				),
+				CloneCacheDir: o.cloneCacheDir,
+				RenderTimeout: o.renderTimeout,
+			},
+		),
+		render.NewInMemoryIdempotencyStore(o.idempotencyTTL),
+	)
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return render.NewWorker(
+		svc,
+		queue,
+		&render.WorkerOptions{
+			LogLevel:    logLevel,
+			Concurrency: o.concurrency,
+		},
+	).Run(ctx)
+}
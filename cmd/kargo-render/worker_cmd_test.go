@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerCommand(t *testing.T) {
+	t.Run("redis address is required", func(t *testing.T) {
+		cmd := newWorkerCommand()
+		cmd.SetArgs(nil)
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), flagRedisAddr)
+	})
+
+	t.Run("runs until canceled", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		mr.RequireAuth("secret")
+		t.Setenv(envPrefix+"REDIS_PASSWORD", "secret")
+		cmd := newWorkerCommand()
+		cmd.SetArgs([]string{"--" + flagRedisAddr, mr.Addr()})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, cmd.ExecuteContext(ctx))
+		// The consumer group was created using the password from the
+		// environment
+		require.True(t, mr.Exists("kargo-render:requests"))
+	})
+}
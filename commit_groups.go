@@ -0,0 +1,129 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// commitGroup describes changes to the output of one or more apps that are
+// committed together when the target branch's configuration calls for one
+// commit per app.
+type commitGroup struct {
+	// name is the name of the group. This is the name of the app itself unless
+	// the app's configuration specifies a CommitGroup.
+	name string
+	// apps is the names of the apps in the group, in order by name.
+	apps []string
+	// paths is the paths, relative to the root of the repository, of every
+	// changed file belonging to any app in the group.
+	paths []string
+}
+
+// commitGroups returns groups of the provided changed paths, relative to the
+// root of the repository, that belong to apps rendered into the target
+// branch, in order by group name. Each path belongs to the app with the
+// longest output path containing it. Paths belonging to no app, such as those
+// of branch metadata and of pruned apps, are not included in any group. Groups
+// of apps whose output has not changed are omitted.
+func commitGroups(rc requestContext, changedPaths []string) []commitGroup {
+	groupsByName := map[string]*commitGroup{}
+	groupOf := func(appName string) *commitGroup {
+		groupName := rc.target.branchConfig.AppConfigs[appName].CommitGroup
+		if groupName == "" {
+			groupName = appName
+		}
+		group, ok := groupsByName[groupName]
+		if !ok {
+			group = &commitGroup{name: groupName}
+			groupsByName[groupName] = group
+		}
+		return group
+	}
+	appsWithChanges := map[string]struct{}{}
+	for _, path := range changedPaths {
+		var owner, ownerPath string
+		for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+			if path == appIndexPath("", appName) {
+				owner, ownerPath = appName, path
+				break
+			}
+			outputPath := filepath.Clean(appOutputPath(appName, appConfig))
+			if (path == outputPath ||
+				strings.HasPrefix(path, outputPath+"/")) &&
+				len(outputPath) > len(ownerPath) {
+				owner, ownerPath = appName, outputPath
+			}
+		}
+		if owner == "" {
+			continue
+		}
+		group := groupOf(owner)
+		group.paths = append(group.paths, path)
+		if _, ok := appsWithChanges[owner]; !ok {
+			appsWithChanges[owner] = struct{}{}
+			group.apps = append(group.apps, owner)
+		}
+	}
+	groups := make([]commitGroup, 0, len(groupsByName))
+	for _, group := range groupsByName {
+		sort.Strings(group.apps)
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+// commitAppGroups commits the staged changes to the output of the apps
+// rendered into the target branch, one commit per commit group. Any other
+// staged changes, such as those to branch metadata, remain staged afterwards
+// so they can be committed with the usual commit message.
+func commitAppGroups(ctx context.Context, rc requestContext) error {
+	changedPaths, err := rc.repo.GetStagedDiffPaths(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for diffs: %w", err)
+	}
+	groups := commitGroups(rc, changedPaths)
+	for _, group := range groups {
+		if err = rc.repo.StagePaths(ctx, group.paths); err != nil {
+			return err
+		}
+		if err = rc.repo.Commit(
+			ctx,
+			buildCommitGroupMessage(rc, group),
+			commitOptions(rc),
+		); err != nil {
+			return fmt.Errorf(
+				"error committing manifests for %q: %w",
+				group.name,
+				err,
+			)
+		}
+	}
+	if err = rc.repo.AddAll(ctx); err != nil {
+		return fmt.Errorf("error staging changes: %w", err)
+	}
+	rc.logger.WithField("groups", len(groups)).
+		Debug("committed manifests of each commit group")
+	return nil
+}
+
+// buildCommitGroupMessage returns a message for a commit of the newly
+// rendered manifests of the apps in the provided group.
+func buildCommitGroupMessage(rc requestContext, group commitGroup) string {
+	lines := make([]string, len(group.apps))
+	for i, appName := range group.apps {
+		lines[i] = fmt.Sprintf("  * %s", appName)
+	}
+	return fmt.Sprintf(
+		"Render %s\n\nKargo Render created this commit by rendering manifests "+
+			"for the following apps from %s:\n\n%s",
+		group.name,
+		rc.source.commit,
+		strings.Join(lines, "\n"),
+	)
+}
@@ -0,0 +1,134 @@
+package render
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+func TestCommitGroups(t *testing.T) {
+	rc := requestContext{}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"foo":       {},
+		"foo-jobs":  {OutputPath: "foo/jobs"},
+		"bar":       {OutputPath: "apps/bar", CommitGroup: "backend"},
+		"baz":       {OutputPath: "apps/baz", CommitGroup: "backend"},
+		"qux":       {ContentAddressable: true},
+		"unchanged": {},
+	}
+	groups := commitGroups(
+		rc,
+		[]string{
+			".kargo-render/metadata.yaml",
+			".kargo-render/index/qux.yaml",
+			"apps/baz/all.yaml",
+			"apps/bar/all.yaml",
+			"foo/all.yaml",
+			"foo/jobs/all.yaml",
+			"foobar/all.yaml",
+			"pruned/all.yaml",
+			"qux/configmap-foo-1a2b3c4d.yaml",
+		},
+	)
+	require.Equal(
+		t,
+		[]commitGroup{
+			{
+				name:  "backend",
+				apps:  []string{"bar", "baz"},
+				paths: []string{"apps/baz/all.yaml", "apps/bar/all.yaml"},
+			},
+			{
+				name:  "foo",
+				apps:  []string{"foo"},
+				paths: []string{"foo/all.yaml"},
+			},
+			{
+				name:  "foo-jobs",
+				apps:  []string{"foo-jobs"},
+				paths: []string{"foo/jobs/all.yaml"},
+			},
+			{
+				name: "qux",
+				apps: []string{"qux"},
+				paths: []string{
+					".kargo-render/index/qux.yaml",
+					"qux/configmap-foo-1a2b3c4d.yaml",
+				},
+			},
+		},
+		groups,
+	)
+}
+
+// fakeCommitGroupsRepo is a git.Repo that records the paths staged for, and
+// the message of, every commit made to it.
+type fakeCommitGroupsRepo struct {
+	git.Repo
+	changedPaths []string
+	stagedPaths  [][]string
+	messages     []string
+}
+
+func (f *fakeCommitGroupsRepo) GetStagedDiffPaths(
+	context.Context,
+) ([]string, error) {
+	return f.changedPaths, nil
+}
+
+func (f *fakeCommitGroupsRepo) StagePaths(_ context.Context, paths []string) error {
+	f.stagedPaths = append(f.stagedPaths, paths)
+	return nil
+}
+
+func (f *fakeCommitGroupsRepo) Commit(
+	_ context.Context,
+	message string,
+	_ *git.CommitOptions,
+) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeCommitGroupsRepo) AddAll(context.Context) error {
+	return nil
+}
+
+func TestCommitAppGroups(t *testing.T) {
+	repo := &fakeCommitGroupsRepo{
+		changedPaths: []string{
+			".kargo-render/metadata.yaml",
+			"bar/all.yaml",
+			"foo/all.yaml",
+		},
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{},
+		repo:    repo,
+	}
+	rc.source.commit = "abc123"
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"foo": {},
+		"bar": {},
+	}
+
+	require.NoError(t, commitAppGroups(context.Background(), rc))
+	require.Equal(
+		t,
+		[][]string{{"bar/all.yaml"}, {"foo/all.yaml"}},
+		repo.stagedPaths,
+	)
+	require.Len(t, repo.messages, 2)
+	require.Equal(
+		t,
+		"Render bar\n\nKargo Render created this commit by rendering manifests "+
+			"for the following apps from abc123:\n\n  * bar",
+		repo.messages[0],
+	)
+	require.Contains(t, repo.messages[1], "Render foo")
+}
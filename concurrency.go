@@ -0,0 +1,19 @@
+package render
+
+import "context"
+
+// acquireSlot waits until the service may begin handling another request, if
+// the number of requests it handles at once is limited, and returns a function
+// that must be called once the request has been handled. If ctx is done first,
+// ctx's error is returned instead.
+func (s *service) acquireSlot(ctx context.Context) (func(), error) {
+	if s.requestSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.requestSlots <- struct{}{}:
+		return func() { <-s.requestSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestAcquireSlot(t *testing.T) {
+	s, ok := NewService(&ServiceOptions{MaxConcurrentRequests: 1}).(*service)
+	require.True(t, ok)
+	release, err := s.acquireSlot(context.Background())
+	require.NoError(t, err)
+
+	// No slot is free
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.acquireSlot(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	release, err = s.acquireSlot(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestServiceConcurrentRequests(t *testing.T) {
+	originDir := t.TempDir()
+	srcDir := t.TempDir()
+	git := func(dir string, arg ...string) {
+		cmd := exec.Command("git", arg...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git(originDir, "init", "-q", "--bare", "-b", "main")
+	git(srcDir, "init", "-q", "-b", "main")
+	git(srcDir, "config", "user.name", "Test")
+	git(srcDir, "config", "user.email", "test@example.com")
+	git(srcDir, "remote", "add", "origin", originDir)
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(srcDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+- name: env/prod
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+			0600,
+		),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "initial commit")
+	git(srcDir, "push", "-q", "origin", "main")
+
+	const maxConcurrentRequests = 2
+	s, ok := NewService(&ServiceOptions{
+		MaxConcurrentRequests: maxConcurrentRequests,
+	}).(*service)
+	require.True(t, ok)
+	var active, maxActive atomic.Int32
+	s.renderFn = func(
+		context.Context,
+		string,
+		argocd.ConfigManagementConfig,
+		*commandTrace,
+	) ([]byte, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		targetBranch := "env/dev"
+		if i%2 == 1 {
+			targetBranch = "env/prod"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.RenderManifests(
+				context.Background(),
+				&Request{
+					LocalInPath:  srcDir,
+					TargetBranch: targetBranch,
+					ReadOnly:     true,
+					// Last-mile rendering requires kustomize
+					Options: map[string]string{OptionSkipLastMile: "true"},
+				},
+			)
+			require.NoError(t, err)
+			require.Contains(t, string(res.Manifests["foo"]), "name: foo")
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, maxActive.Load(), int32(maxConcurrentRequests))
+}
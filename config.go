@@ -2,17 +2,25 @@ package render
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/xeipuuv/gojsonschema"
+	"golang.org/x/mod/semver"
 	"sigs.k8s.io/yaml"
 
 	"github.com/akuity/kargo-render/internal/argocd"
 	"github.com/akuity/kargo-render/internal/file"
+	"github.com/akuity/kargo-render/internal/manifests"
+	"github.com/akuity/kargo-render/internal/version"
 
 	_ "embed"
 )
@@ -42,32 +50,557 @@ func init() {
 type repoConfig struct {
 	// BranchConfigs is a list of branch-specific configurations.
 	BranchConfigs []branchConfig `json:"branchConfigs,omitempty"`
+	// Conventions optionally overrides the conventions used to locate input
+	// for branches whose configuration does not explicitly define any apps.
+	Conventions *conventionsConfig `json:"conventions,omitempty"`
+	// PromotionOrder optionally lists environment-specific branches in the
+	// order in which source commits should be promoted through them, e.g.
+	// env/dev, env/stage, env/prod. A source commit is refused by any branch in
+	// the list other than the first until it has been rendered into the branch
+	// preceding it.
+	PromotionOrder []string `json:"promotionOrder,omitempty"`
+	// Symlinks optionally specifies how symbolic links in environment-specific
+	// branches are treated when the branches are cleaned, when their contents
+	// are copied, and when manifests are written to them: preserve (the
+	// default), follow, or reject.
+	Symlinks string `json:"symlinks,omitempty"`
+	// MinVersion optionally specifies the earliest version of Kargo Render,
+	// e.g. v0.2.0, that can render the repository. Older versions refuse to.
+	MinVersion string `json:"minVersion,omitempty"`
+	// MetadataStorage optionally specifies where the metadata of
+	// environment-specific branches is stored: inline (the default), in each
+	// branch's .kargo-render directory; notes, in git notes attached to
+	// rendered commits; or branch, in a dedicated metadata branch.
+	MetadataStorage string `json:"metadataStorage,omitempty"`
+	// index, if non-nil, is an index of BranchConfigs built when the
+	// configuration was loaded.
+	index *branchConfigIndex
 }
 
-func (r *repoConfig) GetBranchConfig(name string) (branchConfig, error) {
-	for _, cfg := range r.BranchConfigs {
-		if cfg.Name == name {
-			return cfg, nil
+// predecessor returns the name of the branch that precedes the named branch
+// in the configured promotion order. An empty string is returned if the named
+// branch is first in the promotion order or does not appear in it at all.
+func (r *repoConfig) predecessor(branch string) string {
+	for i, name := range r.PromotionOrder {
+		if name == branch && i > 0 {
+			return r.PromotionOrder[i-1]
 		}
-		if cfg.Pattern != "" {
+	}
+	return ""
+}
+
+// conventionsConfig encapsulates conventions for locating input for branches
+// whose configuration does not explicitly define any apps. In templates, the
+// placeholder ${0} is replaced with the name of the target branch and
+// placeholders of the form ${var:name} are replaced with request variables.
+type conventionsConfig struct {
+	// KustomizePathTemplate is a template for the path, relative to the root of
+	// the repository, of the Kustomize overlay to render for a branch. This is
+	// mutually exclusive with the ValuesPathTemplate field.
+	KustomizePathTemplate string `json:"kustomizePathTemplate,omitempty"`
+	// ChartPath is the path, relative to the root of the repository, of a Helm
+	// chart to render for every branch. This must be specified if and only if
+	// the ValuesPathTemplate field is.
+	ChartPath string `json:"chartPath,omitempty"`
+	// ValuesPathTemplate is a template for the path, relative to the root of
+	// the repository, of the Helm values file to render the chart specified by
+	// the ChartPath field with for a branch.
+	ValuesPathTemplate string `json:"valuesPathTemplate,omitempty"`
+}
+
+// appConfig returns configuration for the single app rendered into the named
+// branch by convention. If c is nil, the default convention applies, whereby
+// input is located at a path named after the branch.
+func (c *conventionsConfig) appConfig(
+	branch string,
+	vars map[string]string,
+) (appConfig, error) {
+	values := []string{branch}
+	switch {
+	case c == nil:
+		return appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{Path: branch},
+		}, nil
+	case c.ValuesPathTemplate != "":
+		valuesPath, err := expandString(c.ValuesPathTemplate, values, vars)
+		if err != nil {
+			return appConfig{}, fmt.Errorf("error expanding values path: %w", err)
+		}
+		// Argo CD resolves values files relative to the chart's directory
+		if valuesPath, err = filepath.Rel(c.ChartPath, valuesPath); err != nil {
+			return appConfig{}, fmt.Errorf("error relativizing values path: %w", err)
+		}
+		return appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{
+				Path: c.ChartPath,
+				Helm: &argocd.ApplicationSourceHelm{
+					ApplicationSourceHelm: argoappv1.ApplicationSourceHelm{
+						ValueFiles: []string{valuesPath},
+					},
+				},
+			},
+		}, nil
+	default:
+		path, err := expandString(c.KustomizePathTemplate, values, vars)
+		if err != nil {
+			return appConfig{}, fmt.Errorf("error expanding Kustomize path: %w", err)
+		}
+		return appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{
+				Path:      path,
+				Kustomize: &argocd.ApplicationSourceKustomize{},
+			},
+		}, nil
+	}
+}
+
+// GetBranchConfig returns the configuration for the named branch, with all
+// placeholders expanded. Numbered placeholders of the form ${n} are replaced
+// with submatches of the branch name when configuration is matched by pattern.
+// Placeholders of the form ${var:name} are replaced with values from the
+// provided vars. If no configuration applies to the named branch, the default
+// branch configuration, if any, is returned. If there is no default either, a
+// *NoBranchConfigError is returned, unless no branch configurations are defined
+// at all, in which case empty configuration is returned.
+func (r *repoConfig) GetBranchConfig(
+	name string,
+	vars map[string]string,
+) (branchConfig, error) {
+	index := r.index
+	if index == nil {
+		// The configuration wasn't loaded by loadRepoConfig, so it may also have
+		// been modified since any index was built. Build one just for this call.
+		var err error
+		if index, err = newBranchConfigIndex(r.BranchConfigs); err != nil {
+			return branchConfig{}, err
+		}
+	}
+	namedIndex, named := index.names[name]
+	for _, pattern := range index.patterns {
+		if named && pattern.index > namedIndex {
+			break
+		}
+		if submatches := pattern.regex.FindStringSubmatch(name); len(submatches) > 0 {
+			return r.BranchConfigs[pattern.index].expand(submatches, vars)
+		}
+	}
+	if named {
+		return r.BranchConfigs[namedIndex].expand(nil, vars)
+	}
+	if index.defaultIndex >= 0 {
+		return r.BranchConfigs[index.defaultIndex].expand(nil, vars)
+	}
+	if len(r.BranchConfigs) > 0 {
+		return branchConfig{}, &NoBranchConfigError{Branch: name}
+	}
+	return branchConfig{}, nil
+}
+
+// branchConfigIndex permits the configuration for a branch to be found without
+// scanning every branch configuration or compiling any regular expressions.
+// Indices in a branchConfigIndex refer to positions in the list of branch
+// configurations it was built from.
+type branchConfigIndex struct {
+	// names maps the name of every explicitly named branch to the index of the
+	// first configuration for it.
+	names map[string]int
+	// patterns lists every configuration that is matched by pattern, in order.
+	patterns []indexedPattern
+	// defaultIndex is the index of the last default configuration, or -1 if
+	// there is none.
+	defaultIndex int
+}
+
+// indexedPattern is a compiled pattern of the branch configuration at the
+// specified index.
+type indexedPattern struct {
+	index int
+	regex *regexp.Regexp
+}
+
+// newBranchConfigIndex returns a branchConfigIndex for the provided branch
+// configurations. An error is returned if any pattern cannot be compiled.
+func newBranchConfigIndex(cfgs []branchConfig) (*branchConfigIndex, error) {
+	index := &branchConfigIndex{
+		names:        map[string]int{},
+		defaultIndex: -1,
+	}
+	for i, cfg := range cfgs {
+		switch {
+		case cfg.isDefault():
+			index.defaultIndex = i
+		case cfg.Name != "":
+			if _, ok := index.names[cfg.Name]; !ok {
+				index.names[cfg.Name] = i
+			}
+		default:
 			regex, err := regexp.Compile(cfg.Pattern)
 			if err != nil {
-				return branchConfig{},
+				return nil,
 					fmt.Errorf("error compiling regular expression /%s/", cfg.Pattern)
 			}
-			submatches := regex.FindStringSubmatch(name)
-			if len(submatches) > 0 {
-				return cfg.expand(submatches)
+			index.patterns = append(
+				index.patterns,
+				indexedPattern{index: i, regex: regex},
+			)
+		}
+	}
+	return index, nil
+}
+
+// lint checks for problems with the configuration that cannot be expressed by
+// the configuration schema. All problems found are returned, joined into a
+// single error.
+func (r *repoConfig) lint() error {
+	var errs []error
+	names := map[string]struct{}{}
+	patterns := map[string]int{}
+	regexes := make([]*regexp.Regexp, len(r.BranchConfigs))
+	var hasDefault bool
+	for i, cfg := range r.BranchConfigs {
+		for _, path := range cfg.ExternalPaths {
+			if cleanPath := filepath.Clean(path); !filepath.IsLocal(cleanPath) ||
+				pathsOverlap(cleanPath, ".kargo-render") {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index: i,
+					Reason: fmt.Sprintf(
+						"external path %q must be a local path outside .kargo-render",
+						path,
+					),
+				})
+			}
+			if cfg.Changelog != nil && pathsOverlap(path, cfg.Changelog.path()) {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index: i,
+					Reason: fmt.Sprintf(
+						"external path %q overlaps the changelog %q",
+						path,
+						cfg.Changelog.path(),
+					),
+				})
+			}
+		}
+		if cfg.AutoDiscover != nil && !filepath.IsLocal(cfg.AutoDiscover.Glob) {
+			errs = append(errs, &InvalidBranchConfigError{
+				Index: i,
+				Reason: fmt.Sprintf(
+					"auto-discovery glob %q must be a local path",
+					cfg.AutoDiscover.Glob,
+				),
+			})
+		}
+		if cfg.MetadataOnlyChanges == metadataOnlyChangesAmend &&
+			(cfg.PRs.Enabled || cfg.PRs.OpenOnRejectedPush) {
+			// Amending a commit that a PR is yet to be opened from would rewrite
+			// the history of the target branch
+			errs = append(errs, &InvalidBranchConfigError{
+				Index: i,
+				Reason: fmt.Sprintf(
+					"metadataOnlyChanges %q cannot be combined with pull requests",
+					metadataOnlyChangesAmend,
+				),
+			})
+		}
+		if r.metadataStorage().external() &&
+			(cfg.PRs.Enabled || cfg.PRs.OpenOnRejectedPush) {
+			// Metadata stored outside of a branch describes a commit pushed to it,
+			// which a PR's commits are not
+			errs = append(errs, &InvalidBranchConfigError{
+				Index: i,
+				Reason: fmt.Sprintf(
+					"pull requests cannot be opened when metadata storage is %q",
+					r.metadataStorage(),
+				),
+			})
+		}
+		for _, match := range branchNamePlaceholderRegex.FindAllStringSubmatch(
+			cfg.PRs.BranchNameTemplate,
+			-1,
+		) {
+			if _, ok := branchNamePlaceholders[match[1]]; !ok &&
+				!strings.HasPrefix(match[1], "var:") {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index: i,
+					Reason: fmt.Sprintf(
+						"branch name template has unknown placeholder %q",
+						match[0],
+					),
+				})
+			}
+		}
+		for appName, appCfg := range cfg.AppConfigs {
+			if len(appCfg.KindOutputPaths) > 0 && appCfg.ContentAddressable {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index: i,
+					Reason: fmt.Sprintf(
+						"app %q: kindOutputPaths and contentAddressable are mutually exclusive",
+						appName,
+					),
+				})
+			}
+			for dimension, dimensionValues := range appCfg.Matrix {
+				if !varNameRegex.MatchString(dimension) {
+					errs = append(errs, &InvalidBranchConfigError{
+						Index: i,
+						Reason: fmt.Sprintf(
+							"app %q: matrix key %q is an invalid variable name",
+							appName,
+							dimension,
+						),
+					})
+				}
+				seen := make(map[string]struct{}, len(dimensionValues))
+				for _, value := range dimensionValues {
+					_, dupe := seen[value]
+					seen[value] = struct{}{}
+					if dupe || !matrixValueRegex.MatchString(value) {
+						errs = append(errs, &InvalidBranchConfigError{
+							Index: i,
+							Reason: fmt.Sprintf(
+								"app %q: matrix value %q of %q is invalid or duplicated",
+								appName,
+								value,
+								dimension,
+							),
+						})
+					}
+				}
+			}
+			if appCfg.RenderTimeout != "" {
+				if timeout, err := time.ParseDuration(appCfg.RenderTimeout); err != nil ||
+					timeout <= 0 {
+					errs = append(errs, &InvalidBranchConfigError{
+						Index: i,
+						Reason: fmt.Sprintf(
+							"app %q: render timeout %q must be a positive duration, e.g. 2m",
+							appName,
+							appCfg.RenderTimeout,
+						),
+					})
+				}
+			}
+			if appCfg.ConfigManagement.Helm != nil {
+				errs = append(errs, lintHelmCRDs(i, appName, appCfg)...)
+			}
+			for kind, path := range appCfg.KindOutputPaths {
+				if cleanPath := filepath.Clean(path); !filepath.IsLocal(cleanPath) ||
+					cleanPath == "." {
+					errs = append(errs, &InvalidBranchConfigError{
+						Index: i,
+						Reason: fmt.Sprintf(
+							"app %q: output path %q for kind %q must be a local subdirectory",
+							appName,
+							path,
+							kind,
+						),
+					})
+				}
+			}
+		}
+		for _, rule := range cfg.DiffIgnore {
+			if _, err := rule.fieldPaths(); err != nil {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index:  i,
+					Reason: err.Error(),
+				})
+			}
+		}
+		for _, rule := range cfg.ImageFields {
+			if _, err := rule.fieldPaths(); err != nil {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index:  i,
+					Reason: err.Error(),
+				})
+			}
+		}
+		switch {
+		case cfg.Name != "" && cfg.Pattern != "":
+			errs = append(errs, &InvalidBranchConfigError{
+				Index:  i,
+				Reason: "name and pattern are mutually exclusive",
+			})
+		case cfg.isDefault():
+			if hasDefault {
+				errs = append(errs, &DuplicateBranchConfigError{})
+			}
+			hasDefault = true
+		case cfg.Name != "":
+			if _, ok := names[cfg.Name]; ok {
+				errs = append(errs, &DuplicateBranchConfigError{Name: cfg.Name})
+				continue
+			}
+			names[cfg.Name] = struct{}{}
+			for j, regex := range regexes[:i] {
+				if regex != nil && regex.MatchString(cfg.Name) {
+					errs = append(
+						errs,
+						&UnreachableBranchConfigError{Index: i, ShadowedBy: j},
+					)
+					break
+				}
+			}
+		default:
+			regex, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				errs = append(errs, &InvalidBranchConfigError{
+					Index:  i,
+					Reason: fmt.Sprintf("pattern /%s/ is invalid: %s", cfg.Pattern, err),
+				})
+				continue
+			}
+			if j, ok := patterns[cfg.Pattern]; ok {
+				errs = append(
+					errs,
+					&UnreachableBranchConfigError{Index: i, ShadowedBy: j},
+				)
+				continue
 			}
+			patterns[cfg.Pattern] = i
+			regexes[i] = regex
 		}
 	}
-	return branchConfig{}, nil
+	promotionOrder := map[string]struct{}{}
+	for _, name := range r.PromotionOrder {
+		if _, ok := promotionOrder[name]; ok {
+			errs = append(
+				errs,
+				fmt.Errorf("promotion order lists branch %q more than once", name),
+			)
+		}
+		promotionOrder[name] = struct{}{}
+	}
+	return errors.Join(errs...)
+}
+
+// crdKind is the kind of CustomResourceDefinitions.
+const crdKind = "CustomResourceDefinition"
+
+// renderTimeout returns the maximum amount of time each stage of rendering the
+// app may take: the app's own RenderTimeout, if it specifies one, or else the
+// provided default. Zero means there is no limit. It assumes RenderTimeout has
+// already been validated.
+func (a appConfig) renderTimeout(defaultTimeout time.Duration) time.Duration {
+	if a.RenderTimeout == "" {
+		return defaultTimeout
+	}
+	timeout, _ := time.ParseDuration(a.RenderTimeout)
+	return timeout
+}
+
+// kindOutputPaths returns the subdirectories of the app's output path to which
+// resources of particular kinds are routed, indexed by kind. These are the
+// app's KindOutputPaths, plus the subdirectory for CustomResourceDefinitions
+// if its chart's CustomResourceDefinitions are to be separated from its other
+// manifests.
+func (a appConfig) kindOutputPaths() map[string]string {
+	crdsOutput := a.ConfigManagement.Helm.CRDsOutput()
+	if crdsOutput == "" {
+		return a.KindOutputPaths
+	}
+	kindOutputPaths := maps.Clone(a.KindOutputPaths)
+	if kindOutputPaths == nil {
+		kindOutputPaths = map[string]string{}
+	}
+	kindOutputPaths[crdKind] = crdsOutput
+	return kindOutputPaths
+}
+
+// lintHelmCRDs checks the options of the Helm-based app with the specified
+// name, in the branch configuration at the specified index, that determine
+// what is done with the CustomResourceDefinitions of its chart.
+func lintHelmCRDs(index int, appName string, appCfg appConfig) []error {
+	helm := appCfg.ConfigManagement.Helm
+	var reasons []string
+	if helm.SkipCrds && helm.CRDs != "" && helm.CRDs != argocd.CRDsSkip {
+		reasons = append(reasons, fmt.Sprintf(
+			"skipCrds contradicts crds %q",
+			helm.CRDs,
+		))
+	}
+	if helm.CRDsOutputPath != "" {
+		if helm.CRDs != argocd.CRDsSeparate {
+			reasons = append(
+				reasons,
+				"crdsOutputPath requires crds to be \""+argocd.CRDsSeparate+"\"",
+			)
+		}
+		if cleanPath := filepath.Clean(helm.CRDsOutputPath); !filepath.IsLocal(cleanPath) ||
+			cleanPath == "." {
+			reasons = append(reasons, fmt.Sprintf(
+				"crdsOutputPath %q must be a local subdirectory",
+				helm.CRDsOutputPath,
+			))
+		}
+	}
+	if helm.CRDs == argocd.CRDsSeparate {
+		if appCfg.ContentAddressable {
+			reasons = append(
+				reasons,
+				"separate crds and contentAddressable are mutually exclusive",
+			)
+		}
+		if _, ok := appCfg.KindOutputPaths[crdKind]; ok {
+			reasons = append(reasons, fmt.Sprintf(
+				"separate crds and an output path for kind %q are mutually exclusive",
+				crdKind,
+			))
+		}
+	}
+	errs := make([]error, len(reasons))
+	for i, reason := range reasons {
+		errs[i] = &InvalidBranchConfigError{
+			Index:  index,
+			Reason: fmt.Sprintf("app %q: %s", appName, reason),
+		}
+	}
+	return errs
+}
+
+// ConfiguredBranchNames returns the names of all environment-specific branches
+// that are explicitly named in the Kargo Render configuration of the
+// repository whose working tree is at the specified path. Branches whose
+// configuration is matched by a pattern cannot be enumerated and are therefore
+// not included.
+func ConfiguredBranchNames(repoPath string) ([]string, error) {
+	cfg, err := loadRepoConfig(repoPath)
+	if err != nil {
+		return nil,
+			fmt.Errorf("error loading Kargo Render configuration from repo: %w", err)
+	}
+	names := []string{}
+	for _, branchCfg := range cfg.BranchConfigs {
+		if branchCfg.Name != "" {
+			names = append(names, branchCfg.Name)
+		}
+	}
+	return names, nil
+}
+
+// ConfiguredBranchPatterns returns the regular expressions that match the
+// names of environment-specific branches in the Kargo Render configuration of
+// the repository whose working tree is at the specified path, in the order
+// they are configured.
+func ConfiguredBranchPatterns(repoPath string) ([]string, error) {
+	cfg, err := loadRepoConfig(repoPath)
+	if err != nil {
+		return nil,
+			fmt.Errorf("error loading Kargo Render configuration from repo: %w", err)
+	}
+	patterns := []string{}
+	for _, branchCfg := range cfg.BranchConfigs {
+		if branchCfg.Pattern != "" {
+			patterns = append(patterns, branchCfg.Pattern)
+		}
+	}
+	return patterns, nil
 }
 
 // branchConfig encapsulates branch-specific Kargo Render configuration.
 type branchConfig struct {
 	// Name is the name of the environment-specific branch this configuration is
-	// for. This is mutually exclusive with the Pattern field.
+	// for. This is mutually exclusive with the Pattern field. A configuration
+	// that specifies neither Name nor Pattern is the default configuration,
+	// which applies to any branch not matched by any other configuration.
 	Name string `json:"name,omitempty"`
 	// Pattern is a regular expression that can be used to specify multiple
 	// environment-specific branches this configuration is for.
@@ -87,24 +620,528 @@ type branchConfig struct {
 	// exception. Paths may be to files or directories. Any path to a directory
 	// will cause that directory's entire contents to be preserved.
 	PreservedPaths []string `json:"preservedPaths,omitempty"`
+	// AutoDiscover optionally specifies how to dynamically discover apps at
+	// render time. Discovered apps are merged with any apps explicitly
+	// specified by the AppConfigs field, with the latter taking precedence.
+	AutoDiscover *autoDiscoverConfig `json:"autoDiscover,omitempty"`
+	// Helm optionally specifies defaults for Helm-based apps rendered into this
+	// branch.
+	Helm *branchHelmConfig `json:"helm,omitempty"`
+	// Kustomize optionally specifies policies for Kustomize-based apps rendered
+	// into this branch.
+	Kustomize *branchKustomizeConfig `json:"kustomize,omitempty"`
+	// Overlays optionally specifies other refs whose contents should be
+	// checked out into the workspace, alongside the contents of the source
+	// commit, before rendering. This is useful when environment-specific
+	// configuration is maintained in branches rather than directories.
+	Overlays []overlayConfig `json:"overlays,omitempty"`
+	// DiffIgnore optionally specifies fields of rendered resources that should
+	// be disregarded when determining whether rendering has changed anything.
+	// This is useful for fields, such as labels containing chart versions, that
+	// change frequently without any meaningful change to the resource.
+	DiffIgnore []diffIgnoreRule `json:"diffIgnore,omitempty"`
+	// FileHeader optionally specifies a comment to be prepended to every file of
+	// rendered manifests written to this branch, e.g. to warn that the file is
+	// generated and should not be edited. Placeholders ${app}, ${branch},
+	// ${commit}, ${shortCommit}, and ${var:name} are expanded for each app.
+	// Lines that are not already comments are made into comments. Files of apps
+	// using the content-addressable output layout get no header.
+	FileHeader string `json:"fileHeader,omitempty"`
+	// ImageFields optionally specifies fields of rendered resources, besides
+	// the images of containers, that hold image references into which images
+	// should be substituted during last-mile rendering. This is useful for
+	// custom resources and environment variables that reference images.
+	ImageFields []imageFieldRule `json:"imageFields,omitempty"`
+	// MemberCommits optionally specifies that the commits to the source branch
+	// since this branch was previously rendered should be listed in the
+	// message of each commit Kargo Render makes to this branch and in the
+	// Response.
+	MemberCommits *memberCommitsConfig `json:"memberCommits,omitempty"`
+	// Changelog optionally specifies that a changelog, to which an entry is
+	// added for every commit Kargo Render makes to this branch, should be
+	// maintained in this branch. This gives humans a readable history of the
+	// branch without having to parse its git log.
+	Changelog *changelogConfig `json:"changelog,omitempty"`
+	// ResourcePolicy optionally restricts which kinds of resources may be
+	// rendered into this branch. Violations are detected before anything is
+	// written to the branch.
+	ResourcePolicy *resourcePolicyConfig `json:"resourcePolicy,omitempty"`
+	// OnDuplicateResources specifies what to do when more than one app renders
+	// the same namespaced resource into this branch. Valid values are "fail",
+	// which refuses to proceed, and "warn", which proceeds, but reports the
+	// duplicates in the Response. If not specified, this defaults to "fail".
+	OnDuplicateResources string `json:"onDuplicateResources,omitempty"`
+	// OnMissingPreservedPaths specifies what to do when any of the paths
+	// specified by the PreservedPaths field does not exist in this branch, as
+	// when it has been renamed or deleted manually. Valid values are "warn",
+	// which proceeds, but reports the missing paths in the Response, and
+	// "fail", which refuses to proceed. If not specified, this defaults to
+	// "warn".
+	OnMissingPreservedPaths string `json:"onMissingPreservedPaths,omitempty"`
+	// ExternalPaths specifies paths relative to the root of the repository
+	// that are owned by other tools or maintained manually. Unlike
+	// PreservedPaths, which are only exempted from cleaning, Kargo Render
+	// never writes to or deletes anything at these paths and refuses to
+	// proceed if any app's output would collide with them.
+	ExternalPaths []string `json:"externalPaths,omitempty"`
+	// Report specifies whether a summary of the manifests rendered into this
+	// branch should be written to .kargo-render/report.json and included in
+	// the Response.
+	Report bool `json:"report,omitempty"`
+	// CommitPerApp specifies whether newly rendered manifests should be
+	// committed to this branch separately for each app, or for each group of
+	// apps sharing a CommitGroup, so that history and pull requests can be
+	// reviewed app by app. Changes belonging to no app, such as those to
+	// branch metadata and to the output of pruned apps, are committed last,
+	// with the usual commit message.
+	CommitPerApp bool `json:"commitPerApp,omitempty"`
+	// MetadataOnlyChanges specifies what to do when rendering changes nothing
+	// in this branch but Kargo Render's own metadata, as when the same images
+	// are specified in a different order. Valid values are "skip", which
+	// leaves the branch as it is, "amend", which amends the commit at the head
+	// of the branch to include the changes and force pushes it, and "commit",
+	// which makes a commit of its own whose message is prefixed with
+	// "[metadata] ". Changes to how long rendering took are never recorded
+	// alone. "amend" cannot be combined with PRs. If not specified, this
+	// defaults to "skip".
+	MetadataOnlyChanges string `json:"metadataOnlyChanges,omitempty"`
+	// MergedFiles optionally specifies files that are owned by this branch,
+	// but to which Kargo Render contributes content, such as an
+	// environment-specific CODEOWNERS file to which entries are appended. Like
+	// PreservedPaths, these files are exempted from cleaning, but on every
+	// render, content from the source commit is combined with them using the
+	// configured strategy.
+	MergedFiles []mergedFileConfig `json:"mergedFiles,omitempty"`
+	// AdoptExisting specifies whether Kargo Render should take ownership of
+	// this branch if it already exists, but does not appear to be managed by
+	// Kargo Render. If it does, the branch is cleaned, just as it is before
+	// every render, and its metadata is written. If this is false (the
+	// default), Kargo Render refuses to render into such a branch unless it is
+	// empty or the Request's AdoptBranch field is set.
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// resourcePolicyConfig restricts which kinds of resources may be rendered into
+// an environment-specific branch.
+type resourcePolicyConfig struct {
+	// Allow optionally lists rules matching the only resources that may be
+	// rendered into the branch. If empty, all resources not matched by Deny
+	// may be rendered into the branch.
+	Allow []resourceRule `json:"allow,omitempty"`
+	// Deny lists rules matching resources that may not be rendered into the
+	// branch. Deny takes precedence over Allow.
+	Deny []resourceRule `json:"deny,omitempty"`
+	// OnViolation specifies what to do when rendered resources violate the
+	// policy. Valid values are "fail", which refuses to proceed, and "warn",
+	// which proceeds, but reports the violations in the Response. If not
+	// specified, this defaults to "fail".
+	OnViolation string `json:"onViolation,omitempty"`
+}
+
+// resourceRule matches resources by API group and kind.
+type resourceRule struct {
+	// APIGroup optionally limits the rule to resources in the specified API
+	// group. The empty string denotes the core API group. If not specified,
+	// resources in any API group are matched.
+	APIGroup *string `json:"apiGroup,omitempty"`
+	// Kind optionally limits the rule to resources of the specified kind.
+	Kind string `json:"kind,omitempty"`
+}
+
+// matches returns a bool indicating whether the rule applies to a resource in
+// the specified API group and of the specified kind.
+func (r resourceRule) matches(apiGroup, kind string) bool {
+	return (r.APIGroup == nil || *r.APIGroup == apiGroup) &&
+		(r.Kind == "" || r.Kind == kind)
+}
+
+// changelogConfig specifies how the changelog of an environment-specific
+// branch is maintained.
+type changelogConfig struct {
+	// Format is the format of the changelog. Valid values are "markdown", which
+	// maintains a CHANGELOG.md file at the root of the branch, and "yaml", which
+	// maintains a .kargo-render/changelog.yaml file. If not specified, this
+	// defaults to "markdown".
+	Format string `json:"format,omitempty"`
+}
+
+// path returns the path, relative to the root of the branch, of the
+// changelog.
+func (c *changelogConfig) path() string {
+	if c.Format == changelogFormatYAML {
+		return ".kargo-render/changelog.yaml"
+	}
+	return "CHANGELOG.md"
+}
+
+// memberCommitsConfig specifies how the commits to the source branch since an
+// environment-specific branch was previously rendered are listed.
+type memberCommitsConfig struct {
+	// Max is the maximum number of commits to list. When there are more, only
+	// the newest are listed, followed by a count of those omitted. If not
+	// specified, this defaults to 20.
+	Max int `json:"max,omitempty"`
+}
+
+// limit returns the maximum number of commits to list.
+func (m *memberCommitsConfig) limit() int {
+	if m.Max > 0 {
+		return m.Max
+	}
+	return 20
+}
+
+// diffIgnoreRule specifies fields of rendered resources that should be
+// disregarded when determining whether rendering has changed anything.
+type diffIgnoreRule struct {
+	// Kind optionally limits the rule to resources of the specified kind.
+	Kind string `json:"kind,omitempty"`
+	// Name optionally limits the rule to resources with the specified name.
+	Name string `json:"name,omitempty"`
+	// JSONPaths are JSONPath expressions identifying the fields to disregard.
+	// Only child operators are supported, e.g. .metadata.labels['foo'],
+	// .spec.containers[*].image, or .spec.containers[0].
+	JSONPaths []string `json:"jsonPaths"`
+}
+
+// fieldPaths parses and returns the rule's JSONPaths.
+func (d diffIgnoreRule) fieldPaths() ([]manifests.FieldPath, error) {
+	paths := make([]manifests.FieldPath, len(d.JSONPaths))
+	for i, jsonPath := range d.JSONPaths {
+		var err error
+		if paths[i], err = manifests.ParseFieldPath(jsonPath); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// matches returns a bool indicating whether the rule applies to a resource of
+// the specified kind and name.
+func (d diffIgnoreRule) matches(kind, name string) bool {
+	return (d.Kind == "" || d.Kind == kind) && (d.Name == "" || d.Name == name)
+}
+
+// imageFieldRule specifies fields of rendered resources that hold image
+// references into which images should be substituted.
+type imageFieldRule struct {
+	// Kind optionally limits the rule to resources of the specified kind.
+	Kind string `json:"kind,omitempty"`
+	// JSONPaths are JSONPath expressions identifying the fields. Only child
+	// operators are supported, e.g. .spec.image or
+	// .spec.template.spec.containers[*].env[*].value. Fields whose values are
+	// not references to any of the images being substituted are left alone.
+	JSONPaths []string `json:"jsonPaths"`
+}
+
+// fieldPaths parses and returns the rule's JSONPaths.
+func (i imageFieldRule) fieldPaths() ([]manifests.FieldPath, error) {
+	paths := make([]manifests.FieldPath, len(i.JSONPaths))
+	for j, jsonPath := range i.JSONPaths {
+		var err error
+		if paths[j], err = manifests.ParseFieldPath(jsonPath); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// matches returns a bool indicating whether the rule applies to a resource of
+// the specified kind.
+func (i imageFieldRule) matches(kind string) bool {
+	return i.Kind == "" || i.Kind == kind
+}
+
+// overlayConfig specifies a ref whose contents should be checked out into the
+// workspace before rendering.
+type overlayConfig struct {
+	// Ref is the branch, tag, or commit whose contents should be checked out.
+	Ref string `json:"ref"`
+	// Path is a path, relative to the root of the repository, at which the
+	// contents of Ref should be checked out. Nothing may already exist at this
+	// path in the source commit.
+	Path string `json:"path"`
+}
+
+// mergedFileConfig specifies how content from the source commit is combined
+// with a file owned by an environment-specific branch.
+type mergedFileConfig struct {
+	// Path is the path, relative to the root of the branch, of the file owned
+	// by the branch. If the file does not exist, it is treated as empty.
+	Path string `json:"path"`
+	// Source is the path, relative to the root of the repository, of a file in
+	// the source commit whose content is combined with the file at Path.
+	Source string `json:"source"`
+	// Strategy specifies how the content of Source is combined with the file at
+	// Path. Valid values are "append", which appends it to the file, replacing
+	// whatever was appended by the previous render, "jsonpatch", which applies
+	// it to the file, which must be JSON or YAML, as an RFC 6902 JSON patch,
+	// and "template", which executes it as a Go template, with the file's
+	// existing content available to it, and replaces the file with the result.
+	Strategy string `json:"strategy"`
+}
+
+// branchHelmConfig encapsulates defaults for Helm-based apps rendered into a
+// branch. Charts that consult .Capabilities need these to be accurate for the
+// cluster the branch is deployed to in order to render correctly.
+type branchHelmConfig struct {
+	// K8SVersion is the Kubernetes version to render charts for when an app
+	// does not specify one.
+	K8SVersion string `json:"k8sVersion,omitempty"`
+	// APIVersions lists the API versions to render charts for when an app
+	// does not specify any.
+	APIVersions []string `json:"apiVersions,omitempty"`
+	// KubeContext optionally names a context in the kubeconfig available to
+	// Kargo Render. When specified, the Kubernetes version and API versions of
+	// the cluster it refers to are discovered at render time and used in place
+	// of any that are not specified by either the app or the K8SVersion and
+	// APIVersions fields.
+	KubeContext string `json:"kubeContext,omitempty"`
+}
+
+// branchKustomizeConfig encapsulates policies for Kustomize-based apps
+// rendered into a branch.
+type branchKustomizeConfig struct {
+	// RequirePinnedRemoteBases specifies whether rendering should be refused
+	// when any app's kustomization references a remote base that is not pinned
+	// to a specific commit. Remote bases referenced by branch or tag, or not by
+	// any ref at all, may change without any change to the source commit.
+	RequirePinnedRemoteBases bool `json:"requirePinnedRemoteBases,omitempty"`
+}
+
+// autoDiscoverConfig encapsulates options for dynamically discovering apps
+// at render time.
+type autoDiscoverConfig struct {
+	// Glob is a pattern, relative to the root of the repository, that matches
+	// directories from which apps should be rendered. Each matching directory
+	// becomes an app, which is named after the portion of the directory's path
+	// that matched the first path segment of the glob containing a wildcard.
+	// e.g. The glob apps/*/overlays/prod matching the directory
+	// apps/foo/overlays/prod results in an app named foo.
+	Glob string `json:"glob,omitempty"`
+	// CombineManifests specifies whether rendered manifests for discovered apps
+	// should be combined into a single file.
+	CombineManifests bool `json:"combineManifests,omitempty"`
+	// ContentAddressable specifies whether rendered manifests for discovered
+	// apps should be written to content-addressable files.
+	ContentAddressable bool `json:"contentAddressable,omitempty"`
+}
+
+// discoverApps returns configuration for every app discovered by applying the
+// branch's auto-discovery options to the repository at the specified path,
+// indexed by app name.
+func (b branchConfig) discoverApps(repoRoot string) (map[string]appConfig, error) {
+	appConfigs := map[string]appConfig{}
+	if b.AutoDiscover == nil {
+		return appConfigs, nil
+	}
+	if !filepath.IsLocal(b.AutoDiscover.Glob) {
+		return nil, fmt.Errorf(
+			"auto-discovery glob %q must be a local path",
+			b.AutoDiscover.Glob,
+		)
+	}
+	// Matches that are links must not lead out of the repository
+	realRepoRoot, err := filepath.EvalSymlinks(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path %q: %w", repoRoot, err)
+	}
+	glob := filepath.Clean(b.AutoDiscover.Glob)
+	globSegments := strings.Split(glob, "/")
+	nameSegment := -1
+	for i, segment := range globSegments {
+		if strings.ContainsAny(segment, "*?[") {
+			nameSegment = i
+			break
+		}
+	}
+	if nameSegment < 0 {
+		return nil, fmt.Errorf(
+			"auto-discovery glob %q does not contain any wildcards",
+			b.AutoDiscover.Glob,
+		)
+	}
+	matches, err := filepath.Glob(filepath.Join(repoRoot, glob))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error applying auto-discovery glob %q: %w",
+			b.AutoDiscover.Glob,
+			err,
+		)
+	}
+	for _, match := range matches {
+		var fi os.FileInfo
+		if fi, err = os.Stat(match); err != nil {
+			return nil, fmt.Errorf("error checking path %q: %w", match, err)
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		var path, realMatch, realPath string
+		if path, err = filepath.Rel(repoRoot, match); err != nil {
+			return nil, fmt.Errorf("error relativizing path %q: %w", match, err)
+		}
+		if realMatch, err = filepath.EvalSymlinks(match); err != nil {
+			return nil, fmt.Errorf("error resolving path %q: %w", match, err)
+		}
+		if realPath, err = filepath.Rel(realRepoRoot, realMatch); err != nil ||
+			!filepath.IsLocal(realPath) {
+			return nil, fmt.Errorf(
+				"auto-discovery glob %q matched path %q, which leads outside the "+
+					"repository",
+				b.AutoDiscover.Glob,
+				path,
+			)
+		}
+		appName := strings.Split(path, "/")[nameSegment]
+		if existing, ok := appConfigs[appName]; ok {
+			return nil, fmt.Errorf(
+				"auto-discovery glob %q matched paths %q and %q, which would both "+
+					"be rendered as app %q",
+				b.AutoDiscover.Glob,
+				existing.ConfigManagement.Path,
+				path,
+				appName,
+			)
+		}
+		appConfigs[appName] = appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{
+				Path: path,
+			},
+			CombineManifests:   b.AutoDiscover.CombineManifests,
+			ContentAddressable: b.AutoDiscover.ContentAddressable,
+		}
+	}
+	return appConfigs, nil
 }
 
-func (b branchConfig) expand(values []string) (branchConfig, error) {
+// isDefault returns a bool indicating whether this is the default branch
+// configuration.
+func (b branchConfig) isDefault() bool {
+	return b.Name == "" && b.Pattern == ""
+}
+
+func (b branchConfig) expand(
+	values []string,
+	vars map[string]string,
+) (branchConfig, error) {
 	cfg := b
 	cfg.AppConfigs = map[string]appConfig{}
 	for appName, appConfig := range b.AppConfigs {
+		if len(appConfig.Matrix) > 0 {
+			continue
+		}
 		var err error
-		if cfg.AppConfigs[appName], err = appConfig.expand(values); err != nil {
+		if cfg.AppConfigs[appName], err = appConfig.expand(values, vars); err != nil {
+			return cfg, fmt.Errorf(
+				"error expanding app config for app %q: %w",
+				appName,
+				err,
+			)
+		}
+	}
+	// Matrix apps are expanded only once all other apps are known, so that any
+	// collision between their names and those of other apps can be detected
+	for appName, appConfig := range b.AppConfigs {
+		if len(appConfig.Matrix) == 0 {
+			continue
+		}
+		matrixConfigs, err := appConfig.expandMatrix(appName, values, vars)
+		if err != nil {
 			return cfg, fmt.Errorf(
 				"error expanding app config for app %q: %w",
 				appName,
 				err,
 			)
 		}
+		for name, matrixConfig := range matrixConfigs {
+			if _, ok := cfg.AppConfigs[name]; ok {
+				return cfg, fmt.Errorf(
+					"matrix of app %q produces app %q, which already exists",
+					appName,
+					name,
+				)
+			}
+			cfg.AppConfigs[name] = matrixConfig
+		}
+	}
+
+	var err error
+	if b.PreservedPaths != nil {
+		cfg.PreservedPaths = make([]string, len(b.PreservedPaths))
+		for i, path := range b.PreservedPaths {
+			if cfg.PreservedPaths[i], err = expandString(path, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding preserved path %q: %w", path, err)
+			}
+		}
+	}
+
+	if b.ExternalPaths != nil {
+		cfg.ExternalPaths = make([]string, len(b.ExternalPaths))
+		for i, path := range b.ExternalPaths {
+			if cfg.ExternalPaths[i], err = expandString(path, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding external path %q: %w", path, err)
+			}
+		}
+	}
+
+	if b.AutoDiscover != nil {
+		autoDiscover := *b.AutoDiscover
+		if autoDiscover.Glob, err = expandString(autoDiscover.Glob, values, vars); err != nil {
+			return cfg, fmt.Errorf("error expanding auto-discovery glob: %w", err)
+		}
+		cfg.AutoDiscover = &autoDiscover
+	}
+
+	if b.Helm != nil {
+		helm := *b.Helm
+		if helm.K8SVersion, err = expandString(helm.K8SVersion, values, vars); err != nil {
+			return cfg, fmt.Errorf("error expanding Kubernetes version: %w", err)
+		}
+		helm.APIVersions = make([]string, len(b.Helm.APIVersions))
+		for i, apiVersion := range b.Helm.APIVersions {
+			if helm.APIVersions[i], err = expandString(apiVersion, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding API version %q: %w", apiVersion, err)
+			}
+		}
+		if helm.KubeContext, err = expandString(helm.KubeContext, values, vars); err != nil {
+			return cfg, fmt.Errorf("error expanding kubeContext: %w", err)
+		}
+		cfg.Helm = &helm
+	}
+
+	if b.MergedFiles != nil {
+		cfg.MergedFiles = make([]mergedFileConfig, len(b.MergedFiles))
+		for i, mergedFile := range b.MergedFiles {
+			cfg.MergedFiles[i] = mergedFileConfig{Strategy: mergedFile.Strategy}
+			if cfg.MergedFiles[i].Path, err = expandString(mergedFile.Path, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding merged file path: %w", err)
+			}
+			if cfg.MergedFiles[i].Source, err = expandString(mergedFile.Source, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding merged file source: %w", err)
+			}
+		}
+	}
+
+	// Other placeholders in these are replaced only once the commit is known,
+	// so request variables are expanded now, while errors can still be reported
+	if cfg.PRs.BranchNameTemplate, err = file.ExpandVars(b.PRs.BranchNameTemplate, vars); err != nil {
+		return cfg, fmt.Errorf("error expanding branch name template: %w", err)
+	}
+	if cfg.FileHeader, err = file.ExpandVars(b.FileHeader, vars); err != nil {
+		return cfg, fmt.Errorf("error expanding file header: %w", err)
 	}
 
-	for i, path := range b.PreservedPaths {
-		b.PreservedPaths[i] = file.ExpandPath(path, values)
+	if b.Overlays != nil {
+		cfg.Overlays = make([]overlayConfig, len(b.Overlays))
+		for i, overlay := range b.Overlays {
+			if cfg.Overlays[i].Ref, err = expandString(overlay.Ref, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding overlay ref: %w", err)
+			}
+			if cfg.Overlays[i].Path, err = expandString(overlay.Path, values, vars); err != nil {
+				return cfg, fmt.Errorf("error expanding overlay path: %w", err)
+			}
+		}
 	}
 	return cfg, nil
 }
@@ -120,18 +1157,209 @@ type appConfig struct {
 	// CombineManifests specifies whether rendered manifests should be combined
 	// into a single file.
 	CombineManifests bool `json:"combineManifests,omitempty"`
+	// ContentAddressable specifies whether each rendered manifest should be
+	// written to a file whose name includes a short hash of its contents in
+	// addition to the identity of the resource it describes. An index mapping
+	// each resource to its file is written to .kargo-render/index/<app>.yaml.
+	// This permits external systems to detect unchanged resources by file name
+	// alone. This is mutually exclusive with CombineManifests.
+	ContentAddressable bool `json:"contentAddressable,omitempty"`
+	// OutputFormat optionally specifies how rendered manifests should be
+	// formatted. When specified, every manifest is re-formatted accordingly,
+	// regardless of how the tools that rendered it formatted it. This prevents
+	// changes in formatting between versions of those tools from producing
+	// large diffs unrelated to any real change.
+	OutputFormat *outputFormatConfig `json:"outputFormat,omitempty"`
+	// KindOutputPaths optionally maps kinds of resources to subdirectories of
+	// the app's output path. Rendered manifests of resources of those kinds are
+	// written to the corresponding subdirectories instead of to the output path
+	// itself. This permits, for instance, Argo Rollouts resources such as
+	// Rollouts and AnalysisTemplates to be synced in separate waves. This is
+	// mutually exclusive with ContentAddressable.
+	KindOutputPaths map[string]string `json:"kindOutputPaths,omitempty"`
+	// SortBySyncWave specifies whether rendered manifests should be re-ordered
+	// in the order Argo CD would sync them: by sync phase, as determined by
+	// hook annotations, and then by sync wave. This permits manifests combined
+	// into a single file to be applied cleanly with kubectl.
+	SortBySyncWave bool `json:"sortBySyncWave,omitempty"`
+	// Matrix optionally maps the names of variables to lists of values. The app
+	// is then rendered once for every combination of values, as if each
+	// combination were a separate app named <app>-<value>[-<value>...], with
+	// values ordered by variable name. Each combination's values are available
+	// to ${var:name} placeholders, taking precedence over request variables. If
+	// OutputPath is not specified, each combination's output is written to
+	// <app>/<value>[/<value>...]. Otherwise, OutputPath must reference enough
+	// of the variables that every combination's output path is distinct.
+	Matrix map[string][]string `json:"matrix,omitempty"`
+	// CommitGroup optionally names a group of apps whose newly rendered
+	// manifests should be committed together when the branch's configuration
+	// specifies CommitPerApp. By default, each app is committed separately.
+	CommitGroup string `json:"commitGroup,omitempty"`
+	// FlattenApplications specifies whether Argo CD Applications found in the
+	// app's pre-rendered manifests should be replaced with the manifests
+	// rendered from their sources, recursively, so that an app-of-apps tree is
+	// rendered into concrete manifests for environments that do not run Argo
+	// CD. Every such source must be a path within the repository being
+	// rendered.
+	FlattenApplications bool `json:"flattenApplications,omitempty"`
+	// Lint optionally specifies that the app's input should be checked using
+	// the linters of its configuration management tool before it is rendered,
+	// so that problems are reported with the tools' own, actionable output.
+	Lint *lintConfig `json:"lint,omitempty"`
+	// CheckDeterminism specifies whether the app's manifests should be
+	// pre-rendered a second time and compared with the first result, so that
+	// templates producing different output on every render, for instance due
+	// to timestamps or random values, are reported in the Response. Such
+	// output defeats detection of renders that change nothing and causes
+	// perpetual churn in the branch.
+	CheckDeterminism bool `json:"checkDeterminism,omitempty"`
+	// RenderTimeout optionally specifies the maximum amount of time, e.g. 2m,
+	// each stage of rendering this app, such as pre-rendering or last-mile
+	// rendering, may take. This takes precedence over any timeout the Service
+	// was configured with, so that apps known to be slow can be given more
+	// time and others less.
+	RenderTimeout string `json:"renderTimeout,omitempty"`
+	// LastMile optionally customizes the last-mile rendering of the app's
+	// manifests.
+	LastMile *lastMileConfig `json:"lastMile,omitempty"`
+}
+
+// lastMileConfig customizes how an app's pre-rendered manifests are built
+// with kustomize during last-mile rendering.
+type lastMileConfig struct {
+	// BuildOptions are additional options, e.g. --enable-helm, passed to
+	// kustomize build. They are needed when the pre-rendered manifests include
+	// content, such as generators or transformers in the form of resources,
+	// that kustomize only processes when so instructed.
+	BuildOptions string `json:"buildOptions,omitempty"`
+}
+
+// lintConfig specifies how an app's input is linted before it is rendered.
+// Charts are linted using helm lint with the app's values and parameters.
+// Kustomizations are built using kustomize build, with the app's build
+// options, without the result being used.
+type lintConfig struct {
+	// OnFailure specifies what to do when a linter finds problems with the
+	// app's input. Valid values are "fail", which refuses to proceed, and
+	// "warn", which proceeds, but reports the linters' findings in the
+	// Response. If not specified, this defaults to "fail".
+	OnFailure string `json:"onFailure,omitempty"`
+	// YttFiles optionally lists paths, relative to the app's path, of ytt
+	// templates, schemas, and data values that are evaluated together using
+	// ytt, which validates the data values against their schemas.
+	YttFiles []string `json:"yttFiles,omitempty"`
+}
+
+// outputFormatConfig encapsulates options for formatting rendered manifests.
+type outputFormatConfig struct {
+	// Indent is the number of spaces used for each level of indentation.
+	Indent int `json:"indent,omitempty"`
+	// SequenceStyle is the style in which sequences are written. Valid values
+	// are "block" and "flow".
+	SequenceStyle string `json:"sequenceStyle,omitempty"`
+	// QuoteStyle is the style in which strings that must be quoted, such as
+	// those that would otherwise be interpreted as numbers or booleans, are
+	// written. Valid values are "double" and "single".
+	QuoteStyle string `json:"quoteStyle,omitempty"`
+}
+
+// formatOptions returns the manifests.FormatOptions corresponding to this
+// configuration.
+func (o outputFormatConfig) formatOptions() manifests.FormatOptions {
+	return manifests.FormatOptions{
+		Indent:        o.Indent,
+		SequenceStyle: manifests.SequenceStyle(o.SequenceStyle),
+		QuoteStyle:    manifests.QuoteStyle(o.QuoteStyle),
+	}
 }
 
-func (a appConfig) expand(values []string) (appConfig, error) {
+func (a appConfig) expand(
+	values []string,
+	vars map[string]string,
+) (appConfig, error) {
 	cfg := a
 	var err error
-	if cfg.ConfigManagement, err = a.ConfigManagement.Expand(values); err != nil {
+	if cfg.ConfigManagement, err = a.ConfigManagement.Expand(values, vars); err != nil {
 		return cfg, fmt.Errorf("error expanding config management config: %w", err)
 	}
-	cfg.OutputPath = file.ExpandPath(a.OutputPath, values)
+	if cfg.OutputPath, err = expandString(a.OutputPath, values, vars); err != nil {
+		return cfg, fmt.Errorf("error expanding output path: %w", err)
+	}
 	return cfg, nil
 }
 
+// expandMatrix expands the app's configuration once for every combination of
+// the values in its matrix, returning the resulting configurations indexed by
+// the names of the apps they configure.
+func (a appConfig) expandMatrix(
+	appName string,
+	values []string,
+	vars map[string]string,
+) (map[string]appConfig, error) {
+	dimensions := make([]string, 0, len(a.Matrix))
+	for dimension := range a.Matrix {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+	combinations := [][]string{{}}
+	for _, dimension := range dimensions {
+		next := make([][]string, 0, len(combinations)*len(a.Matrix[dimension]))
+		for _, combination := range combinations {
+			for _, value := range a.Matrix[dimension] {
+				next = append(
+					next,
+					append(append([]string{}, combination...), value),
+				)
+			}
+		}
+		combinations = next
+	}
+	appConfigs := make(map[string]appConfig, len(combinations))
+	namesByOutputPath := make(map[string]string, len(combinations))
+	for _, combination := range combinations {
+		combinationVars := make(map[string]string, len(vars)+len(dimensions))
+		for name, value := range vars {
+			combinationVars[name] = value
+		}
+		for i, dimension := range dimensions {
+			combinationVars[dimension] = combination[i]
+		}
+		cfg, err := a.expand(values, combinationVars)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Matrix = nil
+		if a.OutputPath == "" {
+			cfg.OutputPath =
+				filepath.Join(append([]string{appName}, combination...)...)
+		}
+		name := strings.Join(append([]string{appName}, combination...), "-")
+		if other, ok := namesByOutputPath[cfg.OutputPath]; ok {
+			return nil, fmt.Errorf(
+				"matrix combinations %q and %q would both be written to %q",
+				other,
+				name,
+				cfg.OutputPath,
+			)
+		}
+		namesByOutputPath[cfg.OutputPath] = name
+		appConfigs[name] = cfg
+	}
+	return appConfigs, nil
+}
+
+// expandString replaces numbered placeholders in the provided string with
+// corresponding values from the provided string array and then replaces
+// ${var:name} placeholders with corresponding values from the provided map. An
+// error is returned if any ${var:name} placeholder cannot be replaced.
+func expandString(
+	s string,
+	values []string,
+	vars map[string]string,
+) (string, error) {
+	return file.ExpandVars(file.ExpandPath(s, values), vars)
+}
+
 // pullRequestConfig encapsulates details related to PR management for a branch.
 type pullRequestConfig struct {
 	// Enabled specifies whether PRs should be opened for changes to a given
@@ -148,6 +1376,45 @@ type pullRequestConfig struct {
 	// other automation is involved. There are valid reasons for using either
 	// approach.
 	UseUniqueBranchNames bool `json:"useUniqueBranchNames,omitempty"`
+	// BranchNameTemplate optionally specifies the name of the branch PRs are
+	// opened from, in place of prs/kargo-render/ followed by the name of the
+	// environment-specific branch or, for new/unique branches, the request ID.
+	// In the template, ${branch}, ${requestID}, ${date}, and ${shortCommit} are
+	// replaced with the name of the environment-specific branch, the request
+	// ID, the current date in UTC (YYYY-MM-DD), and the abbreviated ID of the
+	// source commit, while placeholders of the form ${var:name} are replaced
+	// with request variables. Templates for new/unique branches should include
+	// ${requestID}, while others should only include placeholders that are the
+	// same for every request. MaxOpen counts PRs from branches whose names
+	// begin with the part of the template that precedes any other
+	// placeholder.
+	BranchNameTemplate string `json:"branchNameTemplate,omitempty"`
+	// OpenOnRejectedPush specifies whether, when PRs are not enabled and the
+	// remote repository rejects the direct push of changes to a given
+	// environment-specific branch, as it would if the branch were protected, a
+	// PR should be opened for the changes instead. Such PRs are always opened
+	// from a new/unique branch.
+	OpenOnRejectedPush bool `json:"openOnRejectedPush,omitempty"`
+	// MaxOpen optionally limits how many PRs opened by Kargo Render from
+	// new/unique branches may be open to a given environment-specific branch
+	// at once. This prevents runaway automation from flooding the repository
+	// with PRs. If zero, there is no limit. It has no effect unless
+	// UseUniqueBranchNames is also true.
+	MaxOpen int `json:"maxOpen,omitempty"`
+	// OnMaxOpen specifies what to do when opening another PR would exceed
+	// MaxOpen. Valid values are "fail", which refuses to proceed, and
+	// "updateOldest", which adds the changes to the oldest open PR instead. If
+	// not specified, this defaults to "fail".
+	OnMaxOpen string `json:"onMaxOpen,omitempty"`
+	// Reviewers optionally lists the usernames of users whose review should be
+	// requested on every PR Kargo Render opens to a given environment-specific
+	// branch. This ensures that PRs promoting changes to protected environments
+	// reach the people who must approve them.
+	Reviewers []string `json:"reviewers,omitempty"`
+	// TeamReviewers optionally lists the slugs of teams, within the
+	// organization that owns the repository, whose review should be requested
+	// on every PR Kargo Render opens to a given environment-specific branch.
+	TeamReviewers []string `json:"teamReviewers,omitempty"`
 }
 
 // loadRepoConfig attempts to load configuration from a kargo-render.json or
@@ -183,7 +1450,10 @@ func loadRepoConfig(repoPath string) (*repoConfig, error) {
 	if err != nil {
 		return cfg, fmt.Errorf("error reading Kargo Render configuration: %w", err)
 	}
-	if configBytes, err = normalizeAndValidate(configBytes); err != nil {
+	if configBytes, err = normalizeAndValidate(
+		filepath.Base(configPath),
+		configBytes,
+	); err != nil {
 		return cfg, fmt.Errorf(
 			"error normalizing and validating Kargo Render configuration: %w",
 			err,
@@ -192,31 +1462,82 @@ func loadRepoConfig(repoPath string) (*repoConfig, error) {
 	if err = json.Unmarshal(configBytes, cfg); err != nil {
 		return cfg, fmt.Errorf("error unmarshaling Kargo Render configuration: %w", err)
 	}
+	if err = cfg.lint(); err != nil {
+		return cfg, fmt.Errorf("error in Kargo Render configuration: %w", err)
+	}
+	if cfg.index, err = newBranchConfigIndex(cfg.BranchConfigs); err != nil {
+		return cfg, fmt.Errorf("error in Kargo Render configuration: %w", err)
+	}
 	return cfg, nil
 }
 
-func normalizeAndValidate(configBytes []byte) ([]byte, error) {
+// normalizeAndValidate converts the provided configuration, read from the
+// named file, to JSON and validates it against the configuration schema. If it
+// does not conform, an *InvalidConfigError locating every problem within the
+// file is returned.
+func normalizeAndValidate(filename string, configBytes []byte) ([]byte, error) {
 	// JSON is a subset of YAML, so it's safe to unconditionally pass JSON through
 	// this function
-	var err error
-	if configBytes, err = yaml.YAMLToJSON(configBytes); err != nil {
+	jsonBytes, err := yaml.YAMLToJSON(configBytes)
+	if err != nil {
 		return nil,
 			fmt.Errorf("error normalizing Kargo Render configuration: %w", err)
 	}
 
-	validationResult, err := configSchema.Validate(gojsonschema.NewBytesLoader(configBytes))
+	// This is checked before validation because a configuration written for a
+	// newer version of Kargo Render may use fields this version's schema does
+	// not permit, and that is less helpful to report than the version mismatch
+	if err = checkMinVersion(jsonBytes, version.GetVersion().Version); err != nil {
+		return nil, err
+	}
+
+	validationResult, err := configSchema.Validate(gojsonschema.NewBytesLoader(jsonBytes))
 	if err != nil {
 		return nil, fmt.Errorf("error validating Kargo Render configuration: %w", err)
 	}
 	if !validationResult.Valid() {
-		verrStrs := make([]string, len(validationResult.Errors()))
-		for i, verr := range validationResult.Errors() {
-			verrStrs[i] = verr.String()
-		}
 		return nil, fmt.Errorf(
-			"error validating Kargo Render configuration: %s",
-			strings.Join(verrStrs, "; "),
+			"error validating Kargo Render configuration: %w",
+			&InvalidConfigError{
+				File:     filename,
+				Problems: configProblems(configBytes, validationResult.Errors()),
+			},
 		)
 	}
-	return configBytes, nil
+	return jsonBytes, nil
+}
+
+// checkMinVersion returns an *UnsupportedVersionError if the provided
+// configuration, in JSON, specifies a minimum version of Kargo Render later
+// than the provided running version. Development builds, whose versions are
+// not semantic versions, are assumed to be recent enough. A minimum version
+// that is not a semantic version is left for schema validation to report.
+func checkMinVersion(jsonBytes []byte, runningVersion string) error {
+	cfg := struct {
+		MinVersion string `json:"minVersion"`
+	}{}
+	if err := json.Unmarshal(jsonBytes, &cfg); err != nil {
+		return nil // Not an object; schema validation will report that
+	}
+	minVersion := canonicalVersion(cfg.MinVersion)
+	current := canonicalVersion(runningVersion)
+	if !semver.IsValid(minVersion) || !semver.IsValid(current) {
+		return nil
+	}
+	if semver.Compare(current, minVersion) < 0 {
+		return &UnsupportedVersionError{
+			MinVersion: cfg.MinVersion,
+			Version:    runningVersion,
+		}
+	}
+	return nil
+}
+
+// canonicalVersion returns the provided version with the "v" prefix that
+// golang.org/x/mod/semver requires, adding it if it is missing.
+func canonicalVersion(v string) string {
+	if v == "" || strings.HasPrefix(v, "v") {
+		return v
+	}
+	return "v" + v
 }
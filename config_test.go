@@ -6,7 +6,10 @@ import (
 	"path/filepath"
 	"testing"
 
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
 )
 
 func TestLoadRepoConfig(t *testing.T) {
@@ -180,6 +183,238 @@ branchConfigs:
           path: env/prod/my-proj
         outputPath: prod/my-proj
         combineManifests: true`),
+		},
+		{
+			name: "valid PR reviewers",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    prs:
+      enabled: true
+      reviewers:
+      - alice
+      - bob-smith
+      teamReviewers:
+      - platform-team`),
+		},
+		{
+			name: "invalid PR team reviewer",
+			assertions: func(t *testing.T, err error) {
+				require.ErrorContains(t, err, "teamReviewers")
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    prs:
+      enabled: true
+      teamReviewers:
+      - my-org/platform-team`),
+		},
+		{
+			name: "valid last-mile build options",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod
+        lastMile:
+          buildOptions: --enable-helm`),
+		},
+		{
+			name: "invalid last-mile options",
+			assertions: func(t *testing.T, err error) {
+				require.ErrorContains(t, err, "lastMile")
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod
+        lastMile:
+          bogus: true`),
+		},
+		{
+			name: "valid auto-discovery",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - pattern: ^env/(.+)$
+    autoDiscover:
+      glob: apps/*/overlays/${1}
+      combineManifests: true`),
+		},
+		{
+			name: "valid request variables",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - pattern: ^env/(.+)$
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/${1}/${var:region}
+        outputPath: ${var:region}/my-proj
+    preservedPaths:
+      - ${var:region}/README.md`),
+		},
+		{
+			name: "valid diffIgnore",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    diffIgnore:
+      - kind: Deployment
+        jsonPaths:
+          - .metadata.labels['helm.sh/chart']`),
+		},
+		{
+			name: "diffIgnore without jsonPaths",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "jsonPaths")
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    diffIgnore:
+      - kind: Deployment`),
+		},
+		{
+			name: "valid branch helm defaults",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - pattern: ^env/(.+)$
+    helm:
+      k8sVersion: v1.29.0
+      apiVersions:
+        - monitoring.coreos.com/v1
+      kubeContext: ${1}
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: charts/my-proj
+          helm: {}`),
+		},
+		{
+			name: "valid kustomize conventions",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+conventions:
+  kustomizePathTemplate: envs/${0}`),
+		},
+		{
+			name: "valid helm conventions",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+conventions:
+  chartPath: chart
+  valuesPathTemplate: envs/${0}/values.yaml`),
+		},
+		{
+			name: "helm conventions without chart path",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+conventions:
+  valuesPathTemplate: envs/${0}/values.yaml`),
+		},
+		{
+			name: "conflicting conventions",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+conventions:
+  kustomizePathTemplate: envs/${0}
+  chartPath: chart
+  valuesPathTemplate: envs/${0}/values.yaml`),
+		},
+		{
+			name: "valid content-addressable output",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod/my-proj
+        contentAddressable: true
+        combineManifests: false`),
+		},
+		{
+			name: "content-addressable output combined",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod/my-proj
+        contentAddressable: true
+        combineManifests: true`),
+		},
+		{
+			name: "valid output format",
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod/my-proj
+        outputFormat:
+          indent: 4
+          sequenceStyle: block
+          quoteStyle: single`),
+		},
+		{
+			name: "invalid output format",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			config: []byte(`configVersion: v1alpha1
+branchConfigs:
+  - name: env/prod
+    appConfigs:
+      my-proj:
+        configManagement:
+          path: env/prod/my-proj
+        outputFormat:
+          quoteStyle: backtick`),
 		},
 		{
 			name: "invalid property",
@@ -198,10 +433,24 @@ branchConfigs:
         outputPath: prod/my-proj
         combineManifests: true`),
 		},
+		{
+			name:   "invalid minVersion",
+			config: []byte("configVersion: v1alpha1\nminVersion: latest"),
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:   "valid minVersion",
+			config: []byte("configVersion: v1alpha1\nminVersion: v0.1.0"),
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			configBytes, err := normalizeAndValidate(testCase.config)
+			configBytes, err := normalizeAndValidate("kargo-render.yaml", testCase.config)
 			testCase.assertions(t, err)
 			// For any validation that doesn't fail, the bytes returned should be
 			// JSON we can unmarshal...
@@ -213,3 +462,803 @@ branchConfigs:
 		})
 	}
 }
+
+func TestCheckMinVersion(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         string
+		runningVersion string
+		expectErr      bool
+	}{
+		{
+			name:           "no minimum version",
+			config:         `{"configVersion": "v1alpha1"}`,
+			runningVersion: "v0.1.0",
+		},
+		{
+			name:           "running version is the minimum",
+			config:         `{"minVersion": "v0.2.0"}`,
+			runningVersion: "v0.2.0",
+		},
+		{
+			name:           "running version is later",
+			config:         `{"minVersion": "0.2.0"}`,
+			runningVersion: "v0.3.1",
+		},
+		{
+			name:           "running version is earlier",
+			config:         `{"minVersion": "v0.2.0", "newField": true}`,
+			runningVersion: "v0.1.0",
+			expectErr:      true,
+		},
+		{
+			name:           "running version is a pre-release of the minimum",
+			config:         `{"minVersion": "v0.2.0"}`,
+			runningVersion: "v0.2.0-rc.1",
+			expectErr:      true,
+		},
+		{
+			name:           "development build",
+			config:         `{"minVersion": "v0.2.0"}`,
+			runningVersion: "devel+0123456",
+		},
+		{
+			name:           "invalid minimum version",
+			config:         `{"minVersion": "latest"}`,
+			runningVersion: "v0.1.0",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := checkMinVersion([]byte(testCase.config), testCase.runningVersion)
+			if !testCase.expectErr {
+				require.NoError(t, err)
+				return
+			}
+			versionErr := &UnsupportedVersionError{}
+			require.ErrorAs(t, err, &versionErr)
+			require.Equal(t, testCase.runningVersion, versionErr.Version)
+			require.Contains(t, err.Error(), "upgrade Kargo Render")
+		})
+	}
+}
+
+func TestGetBranchConfig(t *testing.T) {
+	cfg := repoConfig{
+		BranchConfigs: []branchConfig{
+			{
+				Name: "env/dev",
+				AppConfigs: map[string]appConfig{
+					"my-app": {
+						ConfigManagement: argocd.ConfigManagementConfig{
+							Path: "env/dev/${var:region}",
+						},
+						OutputPath: "${var:region}",
+					},
+				},
+			},
+			{
+				Pattern: "^env/(.+)$",
+				AppConfigs: map[string]appConfig{
+					"my-app": {
+						ConfigManagement: argocd.ConfigManagementConfig{
+							Path: "env/${1}/${var:region}",
+						},
+					},
+				},
+				PreservedPaths: []string{"${var:region}/README.md"},
+			},
+		},
+	}
+	vars := map[string]string{"region": "us-east-1"}
+
+	branchCfg, err := cfg.GetBranchConfig("env/dev", vars)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"env/dev/us-east-1",
+		branchCfg.AppConfigs["my-app"].ConfigManagement.Path,
+	)
+	require.Equal(t, "us-east-1", branchCfg.AppConfigs["my-app"].OutputPath)
+
+	branchCfg, err = cfg.GetBranchConfig("env/prod", vars)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"env/prod/us-east-1",
+		branchCfg.AppConfigs["my-app"].ConfigManagement.Path,
+	)
+	require.Equal(t, []string{"us-east-1/README.md"}, branchCfg.PreservedPaths)
+
+	_, err = cfg.GetBranchConfig("stage/prod", vars)
+	require.Error(t, err)
+	var noBranchConfigErr *NoBranchConfigError
+	require.ErrorAs(t, err, &noBranchConfigErr)
+	require.Equal(t, "stage/prod", noBranchConfigErr.Branch)
+
+	cfg.BranchConfigs = append(
+		cfg.BranchConfigs,
+		branchConfig{PreservedPaths: []string{"${var:region}"}},
+	)
+	branchCfg, err = cfg.GetBranchConfig("stage/prod", vars)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east-1"}, branchCfg.PreservedPaths)
+
+	branchCfg, err = (&repoConfig{}).GetBranchConfig("stage/prod", vars)
+	require.NoError(t, err)
+	require.Empty(t, branchCfg.AppConfigs)
+
+	cfg.BranchConfigs[0].PRs.BranchNameTemplate = "deploy/${var:region}/${branch}"
+	cfg.BranchConfigs[0].FileHeader = "rendered for ${var:region}"
+	branchCfg, err = cfg.GetBranchConfig("env/dev", vars)
+	require.NoError(t, err)
+	require.Equal(t, "deploy/us-east-1/${branch}", branchCfg.PRs.BranchNameTemplate)
+	require.Equal(t, "rendered for us-east-1", branchCfg.FileHeader)
+	// The configuration itself is left unexpanded
+	require.Equal(t, "env/dev/${var:region}", cfg.BranchConfigs[0].AppConfigs["my-app"].ConfigManagement.Path)
+	require.Equal(t, []string{"${var:region}/README.md"}, cfg.BranchConfigs[1].PreservedPaths)
+
+	_, err = cfg.GetBranchConfig("env/dev", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `variable "region" is not defined`)
+
+	_, err = cfg.GetBranchConfig("env/prod", map[string]string{"region": "../../etc"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must not be an absolute path or contain ..")
+}
+
+func TestGetBranchConfigWithMatrix(t *testing.T) {
+	cfg := repoConfig{
+		BranchConfigs: []branchConfig{
+			{
+				Name: "env/prod",
+				AppConfigs: map[string]appConfig{
+					"my-app": {
+						ConfigManagement: argocd.ConfigManagementConfig{
+							Path: "apps/my-app/${var:region}/${var:tier}",
+						},
+						Matrix: map[string][]string{
+							"tier":   {"web", "worker"},
+							"region": {"us-east", "eu-west"},
+						},
+					},
+					"other-app": {
+						ConfigManagement: argocd.ConfigManagementConfig{
+							Path: "apps/other-app/${var:region}",
+						},
+						OutputPath: "other/${var:region}",
+						Matrix:     map[string][]string{"region": {"us-east"}},
+					},
+				},
+			},
+		},
+	}
+
+	// Matrix values take precedence over request variables
+	branchCfg, err := cfg.GetBranchConfig(
+		"env/prod",
+		map[string]string{"region": "ap-south"},
+	)
+	require.NoError(t, err)
+	require.Len(t, branchCfg.AppConfigs, 5)
+	appCfg, ok := branchCfg.AppConfigs["my-app-eu-west-worker"]
+	require.True(t, ok)
+	require.Equal(t, "apps/my-app/eu-west/worker", appCfg.ConfigManagement.Path)
+	require.Equal(t, "my-app/eu-west/worker", appCfg.OutputPath)
+	require.Nil(t, appCfg.Matrix)
+	appCfg, ok = branchCfg.AppConfigs["other-app-us-east"]
+	require.True(t, ok)
+	require.Equal(t, "other/us-east", appCfg.OutputPath)
+
+	// An output path that does not distinguish combinations is rejected
+	cfg.BranchConfigs[0].AppConfigs["other-app"] = appConfig{
+		OutputPath: "other",
+		Matrix:     map[string][]string{"region": {"us-east", "eu-west"}},
+	}
+	_, err = cfg.GetBranchConfig("env/prod", nil)
+	require.ErrorContains(t, err, `would both be written to "other"`)
+
+	// A combination may not collide with another app
+	cfg.BranchConfigs[0].AppConfigs["other-app"] = appConfig{
+		Matrix: map[string][]string{"region": {"us-east"}},
+	}
+	cfg.BranchConfigs[0].AppConfigs["other-app-us-east"] = appConfig{}
+	_, err = cfg.GetBranchConfig("env/prod", nil)
+	require.ErrorContains(t, err, `produces app "other-app-us-east", which already exists`)
+}
+
+func TestNewBranchConfigIndex(t *testing.T) {
+	index, err := newBranchConfigIndex([]branchConfig{
+		{Pattern: "^stage/(.+)$"},
+		{Name: "env/dev"},
+		{},
+		{Pattern: "^env/(.+)$"},
+		{Name: "env/dev"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"env/dev": 1}, index.names)
+	require.Len(t, index.patterns, 2)
+	require.Equal(t, 0, index.patterns[0].index)
+	require.Equal(t, 3, index.patterns[1].index)
+	require.Equal(t, 2, index.defaultIndex)
+
+	_, err = newBranchConfigIndex([]branchConfig{{Pattern: "("}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error compiling regular expression")
+}
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cfg        repoConfig
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "name and pattern both specified",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Name: "env/dev", Pattern: "^env/(.+)$"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(t, 0, invalidErr.Index)
+			},
+		},
+		{
+			name: "metadata-only changes amended with pull requests",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name:                "env/dev",
+						MetadataOnlyChanges: metadataOnlyChangesAmend,
+						PRs:                 pullRequestConfig{Enabled: true},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Contains(t, invalidErr.Reason, "cannot be combined with pull requests")
+			},
+		},
+		{
+			name: "unknown branch name template placeholder",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						PRs: pullRequestConfig{
+							BranchNameTemplate: "deploy/${branch}/${sha}-${var:team}",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(
+					t,
+					`branch name template has unknown placeholder "${sha}"`,
+					invalidErr.Reason,
+				)
+			},
+		},
+		{
+			name: "invalid pattern",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{{Pattern: "^env/(.+$"}},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Contains(t, invalidErr.Reason, "is invalid")
+			},
+		},
+		{
+			name: "pull requests with external metadata storage",
+			cfg: repoConfig{
+				MetadataStorage: string(metadataStorageNotes),
+				BranchConfigs: []branchConfig{
+					{Name: "env/dev"},
+					{
+						Name: "env/prod",
+						PRs:  pullRequestConfig{OpenOnRejectedPush: true},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(t, 1, invalidErr.Index)
+				require.Contains(t, invalidErr.Reason, "metadata storage is \"notes\"")
+			},
+		},
+		{
+			name: "non-local external path",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{ExternalPaths: []string{"../flux"}},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Contains(t, invalidErr.Reason, "must be a local path")
+			},
+		},
+		{
+			name: "non-local auto-discovery glob",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{AutoDiscover: &autoDiscoverConfig{Glob: "../*/overlays/dev"}},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Contains(t, invalidErr.Reason, "auto-discovery glob")
+				require.Contains(t, invalidErr.Reason, "must be a local path")
+			},
+		},
+		{
+			name: "external path overlapping changelog",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						ExternalPaths: []string{"CHANGELOG.md"},
+						Changelog:     &changelogConfig{},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Contains(t, invalidErr.Reason, "overlaps the changelog")
+			},
+		},
+		{
+			name: "duplicate names",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Name: "env/dev"},
+					{Name: "env/dev"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var dupErr *DuplicateBranchConfigError
+				require.ErrorAs(t, err, &dupErr)
+				require.Equal(t, "env/dev", dupErr.Name)
+			},
+		},
+		{
+			name: "duplicate defaults",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{{}, {}},
+			},
+			assertions: func(t *testing.T, err error) {
+				var dupErr *DuplicateBranchConfigError
+				require.ErrorAs(t, err, &dupErr)
+				require.Empty(t, dupErr.Name)
+			},
+		},
+		{
+			name: "name shadowed by earlier pattern",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Pattern: "^env/(.+)$"},
+					{Name: "env/prod"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var unreachableErr *UnreachableBranchConfigError
+				require.ErrorAs(t, err, &unreachableErr)
+				require.Equal(t, 1, unreachableErr.Index)
+				require.Equal(t, 0, unreachableErr.ShadowedBy)
+			},
+		},
+		{
+			name: "duplicate patterns",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Pattern: "^env/(.+)$"},
+					{Name: "stage/prod"},
+					{Pattern: "^env/(.+)$"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var unreachableErr *UnreachableBranchConfigError
+				require.ErrorAs(t, err, &unreachableErr)
+				require.Equal(t, 2, unreachableErr.Index)
+				require.Equal(t, 0, unreachableErr.ShadowedBy)
+			},
+		},
+		{
+			name: "invalid diffIgnore JSONPath",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						DiffIgnore: []diffIgnoreRule{
+							{JSONPaths: []string{".metadata..labels"}},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(t, 0, invalidErr.Index)
+			},
+		},
+		{
+			name: "invalid imageFields JSONPath",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						ImageFields: []imageFieldRule{
+							{Kind: "Canary", JSONPaths: []string{"spec.image"}},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(t, 0, invalidErr.Index)
+			},
+		},
+		{
+			name: "invalid kindOutputPaths",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						AppConfigs: map[string]appConfig{
+							"my-app": {
+								ContentAddressable: true,
+								KindOutputPaths:    map[string]string{"Rollout": "../rollouts"},
+							},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.Equal(t, 0, invalidErr.Index)
+				require.ErrorContains(t, err, "mutually exclusive")
+				require.ErrorContains(t, err, "must be a local subdirectory")
+			},
+		},
+		{
+			name: "invalid helm crds options",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						AppConfigs: map[string]appConfig{
+							"skip": {
+								ConfigManagement: argocd.ConfigManagementConfig{
+									Helm: &argocd.ApplicationSourceHelm{
+										ApplicationSourceHelm: argoappv1.ApplicationSourceHelm{
+											SkipCrds: true,
+										},
+										CRDs:           argocd.CRDsInclude,
+										CRDsOutputPath: "crds",
+									},
+								},
+							},
+							"separate": {
+								ConfigManagement: argocd.ConfigManagementConfig{
+									Helm: &argocd.ApplicationSourceHelm{
+										CRDs:           argocd.CRDsSeparate,
+										CRDsOutputPath: "../crds",
+									},
+								},
+								KindOutputPaths: map[string]string{
+									crdKind: "definitions",
+								},
+							},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.ErrorContains(t, err, "skipCrds contradicts")
+				require.ErrorContains(t, err, "crdsOutputPath requires")
+				require.ErrorContains(t, err, "must be a local subdirectory")
+				require.ErrorContains(t, err, `output path for kind "CustomResourceDefinition"`)
+			},
+		},
+		{
+			name: "invalid matrix",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						AppConfigs: map[string]appConfig{
+							"my-app": {
+								Matrix: map[string][]string{
+									"1region": {"us-east"},
+									"tier":    {"web", "web", "../web"},
+								},
+							},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.ErrorContains(t, err, `matrix key "1region" is an invalid variable name`)
+				require.ErrorContains(t, err, `matrix value "web" of "tier" is invalid or duplicated`)
+				require.ErrorContains(t, err, `matrix value "../web" of "tier"`)
+			},
+		},
+		{
+			name: "invalid render timeouts",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{
+						Name: "env/dev",
+						AppConfigs: map[string]appConfig{
+							"fast": {RenderTimeout: "0s"},
+							"slow": {RenderTimeout: "forever"},
+							"ok":   {RenderTimeout: "1m30s"},
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+				require.ErrorContains(t, err, `app "fast": render timeout "0s" must be a positive duration`)
+				require.ErrorContains(t, err, `app "slow": render timeout "forever"`)
+				require.NotContains(t, err.Error(), `app "ok"`)
+			},
+		},
+		{
+			name: "multiple problems",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Name: "env/dev"},
+					{Name: "env/dev"},
+					{Pattern: "^env/(.+$"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				var dupErr *DuplicateBranchConfigError
+				require.ErrorAs(t, err, &dupErr)
+				var invalidErr *InvalidBranchConfigError
+				require.ErrorAs(t, err, &invalidErr)
+			},
+		},
+		{
+			name: "branch listed more than once in promotion order",
+			cfg: repoConfig{
+				PromotionOrder: []string{"env/dev", "env/prod", "env/dev"},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					`promotion order lists branch "env/dev" more than once`,
+				)
+			},
+		},
+		{
+			name: "success",
+			cfg: repoConfig{
+				BranchConfigs: []branchConfig{
+					{Name: "env/prod"},
+					{Pattern: "^env/(.+)$"},
+					{},
+				},
+				PromotionOrder: []string{"env/dev", "env/prod"},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.assertions(t, testCase.cfg.lint())
+		})
+	}
+}
+
+func TestConfiguredBranchNames(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(dir, "kargo-render.yaml"),
+		[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+- name: env/prod
+- pattern: ^env/(.+)$
+`),
+		0600,
+	)
+	require.NoError(t, err)
+	names, err := ConfiguredBranchNames(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"env/dev", "env/prod"}, names)
+}
+
+func TestDiscoverApps(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, dir := range []string{
+		"apps/foo/overlays/dev",
+		"apps/foo/overlays/prod",
+		"apps/bar/overlays/dev",
+		"apps/baz/base",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, dir), 0755))
+	}
+	outsideDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, "links"), 0755))
+	require.NoError(
+		t,
+		os.Symlink(outsideDir, filepath.Join(repoRoot, "links", "outside")),
+	)
+
+	testCases := []struct {
+		name       string
+		cfg        branchConfig
+		assertions func(*testing.T, map[string]appConfig, error)
+	}{
+		{
+			name: "non-local glob",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{Glob: "../*"},
+			},
+			assertions: func(t *testing.T, _ map[string]appConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "must be a local path")
+			},
+		},
+		{
+			name: "absolute glob",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{Glob: "/tmp/*"},
+			},
+			assertions: func(t *testing.T, _ map[string]appConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "must be a local path")
+			},
+		},
+		{
+			name: "match leading outside the repository",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{Glob: "links/*"},
+			},
+			assertions: func(t *testing.T, _ map[string]appConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "leads outside the repository")
+			},
+		},
+		{
+			name: "auto-discovery not configured",
+			assertions: func(t *testing.T, appConfigs map[string]appConfig, err error) {
+				require.NoError(t, err)
+				require.Empty(t, appConfigs)
+			},
+		},
+		{
+			name: "glob without wildcards",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{Glob: "apps/foo/overlays/dev"},
+			},
+			assertions: func(t *testing.T, _ map[string]appConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "does not contain any wildcards")
+			},
+		},
+		{
+			name: "ambiguous app names",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{Glob: "apps/*/overlays/*"},
+			},
+			assertions: func(t *testing.T, _ map[string]appConfig, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "would both be rendered as app")
+			},
+		},
+		{
+			name: "success",
+			cfg: branchConfig{
+				AutoDiscover: &autoDiscoverConfig{
+					Glob:             "apps/*/overlays/dev",
+					CombineManifests: true,
+				},
+			},
+			assertions: func(t *testing.T, appConfigs map[string]appConfig, err error) {
+				require.NoError(t, err)
+				require.Len(t, appConfigs, 2)
+				require.Equal(
+					t,
+					"apps/foo/overlays/dev",
+					appConfigs["foo"].ConfigManagement.Path,
+				)
+				require.True(t, appConfigs["foo"].CombineManifests)
+				require.Equal(
+					t,
+					"apps/bar/overlays/dev",
+					appConfigs["bar"].ConfigManagement.Path,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			appConfigs, err := testCase.cfg.discoverApps(repoRoot)
+			testCase.assertions(t, appConfigs, err)
+		})
+	}
+}
+
+func TestConventionsAppConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		conventions *conventionsConfig
+		assertions  func(*testing.T, appConfig, error)
+	}{
+		{
+			name: "default conventions",
+			assertions: func(t *testing.T, cfg appConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/dev", cfg.ConfigManagement.Path)
+				require.Nil(t, cfg.ConfigManagement.Kustomize)
+				require.Nil(t, cfg.ConfigManagement.Helm)
+			},
+		},
+		{
+			name: "kustomize path template",
+			conventions: &conventionsConfig{
+				KustomizePathTemplate: "envs/${0}/${var:region}",
+			},
+			assertions: func(t *testing.T, cfg appConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					"envs/env/dev/us-east-1",
+					cfg.ConfigManagement.Path,
+				)
+				require.NotNil(t, cfg.ConfigManagement.Kustomize)
+			},
+		},
+		{
+			name: "values path template",
+			conventions: &conventionsConfig{
+				ChartPath:          "charts/foo",
+				ValuesPathTemplate: "envs/${0}/values.yaml",
+			},
+			assertions: func(t *testing.T, cfg appConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "charts/foo", cfg.ConfigManagement.Path)
+				require.NotNil(t, cfg.ConfigManagement.Helm)
+				require.Equal(
+					t,
+					[]string{"../../envs/env/dev/values.yaml"},
+					cfg.ConfigManagement.Helm.ValueFiles,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg, err := testCase.conventions.appConfig(
+				"env/dev",
+				map[string]string{"region": "us-east-1"},
+			)
+			testCase.assertions(t, cfg, err)
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package render
 
 import (
+	"time"
+
 	log "github.com/sirupsen/logrus"
 
+	"github.com/akuity/kargo-render/internal/github"
 	"github.com/akuity/kargo-render/pkg/git"
 )
 
@@ -13,6 +16,20 @@ type requestContext struct {
 	source       sourceContext
 	intermediate intermediateContext
 	target       targetContext
+	timings      *timings
+	// commands, if non-nil, records every external command executed while
+	// handling the request.
+	commands *commandTrace
+	// plan, if non-nil, indicates that the request is being handled only to
+	// create a plan, which is recorded here.
+	plan *Plan
+	// toolEnv maps the names of tools to environment variables that processes
+	// running them may inherit beyond the defaults. See ServiceOptions.ToolEnv.
+	toolEnv map[string][]string
+	// renderTimeout is the maximum amount of time each stage of rendering any
+	// single app may take, unless the app's configuration specifies otherwise.
+	// Zero means there is no limit. See ServiceOptions.RenderTimeout.
+	renderTimeout time.Duration
 }
 
 type sourceContext struct {
@@ -29,7 +46,17 @@ type targetContext struct {
 	newBranchMetadata    branchMetadata
 	prerenderedManifests map[string][]byte
 	renderedManifests    map[string][]byte
+	mergedFileSources    map[string][]byte
+	prunedApps           []PrunedApp
+	sourceHistory        *SourceHistory
 	commit               commitContext
+	// unborn indicates that the target branch was created without any commit,
+	// so that the rendered manifests will be its first.
+	unborn bool
+	// symlinks is the repository's policy for symbolic links in the branch.
+	symlinks symlinkPolicy
+	// metadataStorage is where the repository stores the branch's metadata.
+	metadataStorage metadataStorage
 }
 
 type commitContext struct {
@@ -37,4 +64,7 @@ type commitContext struct {
 	oldBranchMetadata *branchMetadata
 	id                string
 	message           string
+	// reusedPR, if non-nil, is an open PR to whose branch changes are committed
+	// in lieu of opening another PR from a new/unique branch.
+	reusedPR *github.PR
 }
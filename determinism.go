@@ -0,0 +1,59 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// checkDeterminism pre-renders the manifests of every app whose configuration
+// enables checking determinism a second time and compares the result with the
+// app's pre-rendered manifests in the provided requestContext. The names of
+// apps whose manifests differ are returned in order. Differences are only
+// reported, since they do not make the manifests any less valid.
+func (s *service) checkDeterminism(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+) ([]string, error) {
+	appNames := make([]string, 0, len(rc.target.branchConfig.AppConfigs))
+	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+		if appConfig.CheckDeterminism {
+			appNames = append(appNames, appName)
+		}
+	}
+	sort.Strings(appNames)
+	var nondeterministicApps []string
+	for i, appName := range appNames {
+		appConfig := rc.target.branchConfig.AppConfigs[appName]
+		start :=
+			rc.timings.startApp(StageDeterminism, appName, i+1, len(appNames))
+		manifests, err := withAppTimeout(
+			ctx,
+			appName,
+			StageDeterminism,
+			appConfig.renderTimeout(rc.renderTimeout),
+			func(ctx context.Context) ([]byte, error) {
+				return s.preRenderApp(ctx, rc, repoRoot, nil, appName, appConfig)
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error pre-rendering manifests for app %q a second time: %w",
+				appName,
+				err,
+			)
+		}
+		rc.timings.record(StageDeterminism, appName, start)
+		if bytes.Equal(manifests, rc.target.prerenderedManifests[appName]) {
+			continue
+		}
+		rc.logger.WithField("app", appName).Warn(
+			"app's manifests differed when pre-rendered a second time; its " +
+				"templates may be nondeterministic",
+		)
+		nondeterministicApps = append(nondeterministicApps, appName)
+	}
+	return nondeterministicApps, nil
+}
@@ -0,0 +1,65 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestCheckDeterminism(t *testing.T) {
+	var calls atomic.Int32
+	s := &service{
+		renderFn: func(
+			_ context.Context,
+			_ string,
+			cfg argocd.ConfigManagementConfig,
+			_ *commandTrace,
+		) ([]byte, error) {
+			if cfg.Path == "random" {
+				return []byte(fmt.Sprintf("value: %d\n", calls.Add(1))), nil
+			}
+			return []byte("path: " + cfg.Path + "\n"), nil
+		},
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{},
+		timings: &timings{},
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"stable": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "stable"},
+			CheckDeterminism: true,
+		},
+		"random": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "random"},
+			CheckDeterminism: true,
+		},
+		"unchecked": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "random"},
+		},
+	}
+	var err error
+	rc.target.prerenderedManifests, err =
+		s.preRender(context.Background(), rc, t.TempDir())
+	require.NoError(t, err)
+
+	nondeterministicApps, err :=
+		s.checkDeterminism(context.Background(), rc, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, []string{"random"}, nondeterministicApps)
+
+	var checked []string
+	for _, timing := range rc.timings.stages {
+		if timing.Stage == StageDeterminism {
+			checked = append(checked, timing.App)
+		}
+	}
+	require.Equal(t, []string{"random", "stable"}, checked)
+}
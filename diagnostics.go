@@ -0,0 +1,86 @@
+package render
+
+import (
+	"time"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// Diagnostics encapsulates details of how a rendering request was handled that
+// are useful for diagnosing problems.
+type Diagnostics struct {
+	// Commands lists, in order, every external command Kargo Render executed
+	// while handling the request. The helm and kustomize commands Argo CD's
+	// repo server executes to render an app's manifests can't be observed
+	// individually, so each rendering of an app is listed as a single
+	// argocd-repo-server generate-manifests command instead.
+	Commands []ExecutedCommand `json:"commands,omitempty"`
+}
+
+// ExecutedCommand describes a single external command executed while handling
+// a rendering request.
+type ExecutedCommand struct {
+	// Command is the command, including all of its arguments, with any
+	// credentials redacted.
+	Command string `json:"command"`
+	// ExitCode is the exit code the command returned. It is -1 if the command
+	// could not be started or was killed.
+	ExitCode int `json:"exitCode"`
+	// Duration is how long the command took.
+	Duration time.Duration `json:"duration"`
+}
+
+// commandTrace accumulates ExecutedCommands over the course of handling a
+// rendering request. A nil *commandTrace records nothing.
+type commandTrace struct {
+	commands []ExecutedCommand
+}
+
+// observe records the execution of the specified command.
+func (c *commandTrace) observe(
+	command string,
+	exitCode int,
+	duration time.Duration,
+) {
+	if c == nil {
+		return
+	}
+	c.commands = append(
+		c.commands,
+		ExecutedCommand{
+			Command:  command,
+			ExitCode: exitCode,
+			Duration: duration,
+		},
+	)
+}
+
+// observeResult records the execution of the command described by the
+// provided Result.
+func (c *commandTrace) observeResult(res libExec.Result) {
+	c.observe(res.Command, res.ExitCode, res.Duration)
+}
+
+// traceRepoOptions returns the provided options, updated so that every command
+// executed on behalf of the repository is recorded by the provided
+// commandTrace. If the commandTrace is nil, the options are returned
+// unaltered.
+func traceRepoOptions(
+	opts *git.RepoOptions,
+	trace *commandTrace,
+) *git.RepoOptions {
+	if trace != nil {
+		opts.CommandObserver = trace.observe
+	}
+	return opts
+}
+
+// diagnostics returns Diagnostics describing everything recorded by the
+// commandTrace. If the commandTrace is nil, nil is returned.
+func (c *commandTrace) diagnostics() *Diagnostics {
+	if c == nil {
+		return nil
+	}
+	return &Diagnostics{Commands: c.commands}
+}
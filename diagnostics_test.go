@@ -0,0 +1,30 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
+)
+
+func TestCommandTrace(t *testing.T) {
+	var trace *commandTrace
+	trace.observe("git status", 0, time.Second)
+	require.Nil(t, trace.diagnostics())
+
+	trace = &commandTrace{}
+	trace.observe("git status", 0, time.Second)
+	trace.observeResult(libExec.Result{Command: "cp -r a b", ExitCode: 1})
+	require.Equal(
+		t,
+		&Diagnostics{
+			Commands: []ExecutedCommand{
+				{Command: "git status", ExitCode: 0, Duration: time.Second},
+				{Command: "cp -r a b", ExitCode: 1},
+			},
+		},
+		trace.diagnostics(),
+	)
+}
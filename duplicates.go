@@ -0,0 +1,107 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/akuity/kargo-render/internal/manifests"
+)
+
+// resourceIdentity identifies a namespaced resource independently of the
+// version of the API it was rendered with.
+type resourceIdentity struct {
+	apiGroup  string
+	kind      string
+	namespace string
+	name      string
+}
+
+// checkDuplicateResources returns every namespaced resource that more than one
+// app renders into the target branch. Argo CD Applications managing the same
+// resource fight over it, so if the target branch's configuration says to fail
+// when there are duplicates, a DuplicateResourcesError is returned instead.
+// Resources that do not specify a namespace are disregarded, since apps
+// deployed to different namespaces may legitimately render them. Apps are
+// checked in order by name so that the result is deterministic.
+func checkDuplicateResources(
+	rc requestContext,
+) ([]DuplicateResource, error) {
+	appNames := make([]string, 0, len(rc.target.renderedManifests))
+	for appName := range rc.target.renderedManifests {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	var identities []resourceIdentity
+	appsByIdentity := map[resourceIdentity][]string{}
+	for _, appName := range appNames {
+		resources, err :=
+			manifests.SplitYAMLResources(rc.target.renderedManifests[appName])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error parsing rendered manifests for app %q: %w",
+				appName,
+				err,
+			)
+		}
+		for _, resource := range resources {
+			if resource.Namespace == "" {
+				continue
+			}
+			identity := resourceIdentity{
+				apiGroup:  apiGroupOf(resource.APIVersion),
+				kind:      resource.Kind,
+				namespace: resource.Namespace,
+				name:      resource.Name,
+			}
+			apps, ok := appsByIdentity[identity]
+			if !ok {
+				identities = append(identities, identity)
+			}
+			// An app that renders the same resource twice has a problem that
+			// Kustomize would already have reported.
+			if len(apps) == 0 || apps[len(apps)-1] != appName {
+				appsByIdentity[identity] = append(apps, appName)
+			}
+		}
+	}
+	var duplicates []DuplicateResource
+	for _, identity := range identities {
+		apps := appsByIdentity[identity]
+		if len(apps) < 2 {
+			continue
+		}
+		duplicates = append(duplicates, DuplicateResource{
+			APIGroup:  identity.apiGroup,
+			Kind:      identity.kind,
+			Namespace: identity.namespace,
+			Name:      identity.name,
+			Apps:      apps,
+		})
+	}
+	if len(duplicates) > 0 &&
+		rc.target.branchConfig.OnDuplicateResources != violationActionWarn {
+		return nil, &DuplicateResourcesError{
+			TargetBranch: rc.request.TargetBranch,
+			Duplicates:   duplicates,
+		}
+	}
+	return duplicates, nil
+}
+
+// String returns a string of the form <kind>[.<apiGroup>] <namespace>/<name>
+// (<app>, <app>, ...) that identifies the duplicated resource and the apps
+// that render it.
+func (d DuplicateResource) String() string {
+	kind := d.Kind
+	if d.APIGroup != "" {
+		kind = fmt.Sprintf("%s.%s", d.Kind, d.APIGroup)
+	}
+	return fmt.Sprintf(
+		"%s %s/%s (%s)",
+		kind,
+		d.Namespace,
+		d.Name,
+		strings.Join(d.Apps, ", "),
+	)
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDuplicateResources(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		onDuplicateResources string
+		renderedManifests    map[string][]byte
+		assertions           func(*testing.T, []DuplicateResource, error)
+	}{
+		{
+			name: "no duplicates",
+			renderedManifests: map[string][]byte{
+				"foo": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: foo
+`),
+				"bar": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: bar
+`),
+			},
+			assertions: func(t *testing.T, duplicates []DuplicateResource, err error) {
+				require.NoError(t, err)
+				require.Empty(t, duplicates)
+			},
+		},
+		{
+			name: "resources without a namespace are disregarded",
+			renderedManifests: map[string][]byte{
+				"foo": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`),
+				"bar": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`),
+			},
+			assertions: func(t *testing.T, duplicates []DuplicateResource, err error) {
+				require.NoError(t, err)
+				require.Empty(t, duplicates)
+			},
+		},
+		{
+			name: "duplicates",
+			renderedManifests: map[string][]byte{
+				"foo": []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shared
+  namespace: shared
+`),
+				"bar": []byte(`apiVersion: apps/v1beta2
+kind: Deployment
+metadata:
+  name: shared
+  namespace: shared
+`),
+				"baz": []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shared
+  namespace: shared
+`),
+			},
+			assertions: func(t *testing.T, duplicates []DuplicateResource, err error) {
+				require.Empty(t, duplicates)
+				var dupErr *DuplicateResourcesError
+				require.ErrorAs(t, err, &dupErr)
+				require.Equal(t, "env/prod", dupErr.TargetBranch)
+				require.Equal(
+					t,
+					[]DuplicateResource{{
+						APIGroup:  "apps",
+						Kind:      "Deployment",
+						Namespace: "shared",
+						Name:      "shared",
+						Apps:      []string{"bar", "baz", "foo"},
+					}},
+					dupErr.Duplicates,
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"Deployment.apps shared/shared (bar, baz, foo)",
+				)
+			},
+		},
+		{
+			name:                 "duplicates with warning",
+			onDuplicateResources: violationActionWarn,
+			renderedManifests: map[string][]byte{
+				"foo": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  namespace: shared
+`),
+				"bar": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  namespace: shared
+`),
+			},
+			assertions: func(t *testing.T, duplicates []DuplicateResource, err error) {
+				require.NoError(t, err)
+				require.Len(t, duplicates, 1)
+				require.Equal(
+					t,
+					"ConfigMap shared/shared (bar, foo)",
+					duplicates[0].String(),
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				request: &Request{TargetBranch: "env/prod"},
+			}
+			rc.target.branchConfig.OnDuplicateResources =
+				testCase.onDuplicateResources
+			rc.target.renderedManifests = testCase.renderedManifests
+			duplicates, err := checkDuplicateResources(rc)
+			testCase.assertions(t, duplicates, err)
+		})
+	}
+}
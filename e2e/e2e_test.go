@@ -0,0 +1,272 @@
+//go:build e2e
+
+// Package e2e contains end-to-end tests of Kargo Render that render fixture
+// repositories, served by an in-process git server, using real helm,
+// kustomize, and ytt binaries, and compare the resulting branches to golden
+// outputs. They are excluded from unit tests and run using make test-e2e.
+// Golden outputs can be regenerated by running the tests with -update.
+package e2e
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	render "github.com/akuity/kargo-render"
+	"github.com/akuity/kargo-render/pkg/rendertest"
+)
+
+var update = flag.Bool("update", false, "update golden outputs")
+
+// metadataPath is the path of the branch metadata in a rendered branch.
+const metadataPath = ".kargo-render/metadata.yaml"
+
+// branchMetadata is the subset of the branch metadata that is checked.
+type branchMetadata struct {
+	SourceCommit       string            `json:"sourceCommit"`
+	ImageSubstitutions []string          `json:"imageSubstitutions"`
+	AppOutputPaths     map[string]string `json:"appOutputPaths"`
+	AppOutputLayouts   map[string]string `json:"appOutputLayouts"`
+}
+
+func TestKustomize(t *testing.T) {
+	rendertest.RequireTools(t, "kustomize")
+	server := rendertest.NewGitServer(t)
+	repoURL := server.SeedRepo(t, "kustomize", "testdata/kustomize/repo")
+	source := rendertest.HeadCommit(t, repoURL, rendertest.DefaultBranch)
+
+	res, err := rendertest.Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+			Images:       []string{"nginx:1.27"},
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	requireGolden(t, repoURL, "env/dev", "testdata/kustomize/golden/env/dev")
+	require.Equal(
+		t,
+		branchMetadata{
+			SourceCommit:       source.ID,
+			ImageSubstitutions: []string{"nginx:1.27"},
+			AppOutputPaths:     map[string]string{"guestbook": "guestbook"},
+			AppOutputLayouts:   map[string]string{"guestbook": "split"},
+		},
+		loadMetadata(t, repoURL, "env/dev"),
+	)
+	commit := rendertest.HeadCommit(t, repoURL, "env/dev")
+	require.Equal(t, res.CommitID, commit.ID)
+	require.True(
+		t,
+		strings.HasPrefix(
+			commit.Message,
+			"Initial commit\n\nKargo Render created this commit by rendering "+
+				"manifests from "+source.ID,
+		),
+		commit.Message,
+	)
+	require.Contains(
+		t,
+		commit.Message,
+		"Kargo Render also incorporated the following images into this "+
+			"commit:\n\n  * nginx:1.27",
+	)
+
+	// Rendering the same source again changes nothing
+	res, err = rendertest.Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+			Images:       []string{"nginx:1.27"},
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenNone, res.ActionTaken)
+	require.Equal(t, commit.ID, rendertest.HeadCommit(t, repoURL, "env/dev").ID)
+}
+
+func TestPRBranchNames(t *testing.T) {
+	rendertest.RequireTools(t, "kustomize")
+	server := rendertest.NewGitServer(t)
+	repoURL := server.SeedRepo(t, "prs", "testdata/kustomize/repo")
+
+	testCases := []struct {
+		name         string
+		req          *render.Request
+		commitBranch string
+	}{
+		{
+			name: "branch named for target branch",
+			req: &render.Request{
+				RepoURL:      repoURL,
+				TargetBranch: "env/prod",
+			},
+			commitBranch: "prs/kargo-render/env/prod",
+		},
+		{
+			name: "unique branch name",
+			req: &render.Request{
+				ID:           "e2e-unique",
+				RepoURL:      repoURL,
+				TargetBranch: "env/stage",
+			},
+			commitBranch: "prs/kargo-render/e2e-unique",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// The commit branch is pushed before the pull request is opened, which
+			// only GitHub repositories support
+			_, err := rendertest.Render(t, testCase.req, nil)
+			require.ErrorContains(t, err, "error parsing github repository URL")
+			requireGolden(
+				t,
+				repoURL,
+				testCase.commitBranch,
+				"testdata/kustomize/golden/env/dev",
+			)
+			// Nothing was pushed to the target branch except its initial commit
+			require.Equal(
+				t,
+				"Initial commit",
+				rendertest.HeadCommit(t, repoURL, testCase.req.TargetBranch).Message,
+			)
+		})
+	}
+}
+
+func TestHelm(t *testing.T) {
+	rendertest.RequireTools(t, "helm", "kustomize")
+	server := rendertest.NewGitServer(t)
+	repoURL := server.SeedRepo(t, "helm", "testdata/helm/repo")
+	source := rendertest.HeadCommit(t, repoURL, rendertest.DefaultBranch)
+
+	res, err := rendertest.Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+			Images:       []string{"nginx:1.27"},
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	requireGolden(t, repoURL, "env/dev", "testdata/helm/golden/env/dev")
+	require.Equal(
+		t,
+		branchMetadata{
+			SourceCommit:       source.ID,
+			ImageSubstitutions: []string{"nginx:1.27"},
+			AppOutputPaths:     map[string]string{"hello": "hello"},
+			AppOutputLayouts:   map[string]string{"hello": "split"},
+		},
+		loadMetadata(t, repoURL, "env/dev"),
+	)
+}
+
+func TestDirectoryWithYttLint(t *testing.T) {
+	rendertest.RequireTools(t, "kustomize", "ytt")
+	server := rendertest.NewGitServer(t)
+	repoURL := server.SeedRepo(t, "directory", "testdata/directory/repo")
+
+	res, err := rendertest.Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	require.Empty(t, res.LintFindings)
+	requireGolden(t, repoURL, "env/dev", "testdata/directory/golden/env/dev")
+
+	// Data values that don't satisfy their schema are refused
+	_, err = rendertest.Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/broken",
+		},
+		nil,
+	)
+	var lintErr *render.LintError
+	require.ErrorAs(t, err, &lintErr)
+}
+
+// requireGolden fails the test unless the files at the head of the specified
+// branch, other than the branch metadata, are exactly those in the specified
+// golden directory. Manifests are compared semantically, so that formatting
+// differences between versions of the rendering tools are disregarded. If
+// the -update flag was specified, the golden directory is replaced with the
+// branch's files instead.
+func requireGolden(t *testing.T, repoURL, branch, goldenDir string) {
+	t.Helper()
+	files := rendertest.BranchFiles(t, repoURL, branch)
+	delete(files, metadataPath)
+	if *update {
+		require.NoError(t, os.RemoveAll(goldenDir))
+		for path, data := range files {
+			goldenPath := filepath.Join(goldenDir, path)
+			require.NoError(t, os.MkdirAll(filepath.Dir(goldenPath), 0755))
+			require.NoError(t, os.WriteFile(goldenPath, data, 0644)) // nolint: gosec
+		}
+		return
+	}
+	golden := map[string][]byte{}
+	require.NoError(
+		t,
+		filepath.WalkDir(
+			goldenDir,
+			func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				relPath, err := filepath.Rel(goldenDir, path)
+				if err != nil {
+					return err
+				}
+				golden[relPath], err = os.ReadFile(path)
+				return err
+			},
+		),
+	)
+	require.ElementsMatch(t, keys(golden), keys(files))
+	for path, want := range golden {
+		var wantObj, gotObj any
+		require.NoError(t, yaml.Unmarshal(want, &wantObj), path)
+		require.NoError(t, yaml.Unmarshal(files[path], &gotObj), path)
+		require.Equal(t, wantObj, gotObj, path)
+	}
+}
+
+// loadMetadata returns the metadata at the head of the specified branch.
+func loadMetadata(t *testing.T, repoURL, branch string) branchMetadata {
+	t.Helper()
+	files := rendertest.BranchFiles(t, repoURL, branch)
+	require.Contains(t, files, metadataPath)
+	md := branchMetadata{}
+	require.NoError(t, yaml.Unmarshal(files[metadataPath], &md))
+	return md
+}
+
+func keys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,61 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
+)
+
+// defaultToolEnv maps the name of each tool Kargo Render runs to the
+// environment variables, beyond those in libExec.DefaultEnvAllowlist, that the
+// tool may inherit by default. These configure the tools themselves.
+var defaultToolEnv = map[string][]string{
+	"helm":      {"HELM_*", "XDG_*"},
+	"kustomize": {"KUSTOMIZE_*", "XDG_*"},
+	"ytt":       {"YTT_*"},
+}
+
+// toolEnvAllowlist returns the entries of the allowlist of environment
+// variables that processes running the specified tool may inherit, given the
+// provided opt-ins, indexed by tool name.
+func toolEnvAllowlist(toolEnv map[string][]string, tool string) []string {
+	allowlist := append([]string{}, defaultToolEnv[tool]...)
+	return append(allowlist, toolEnv[tool]...)
+}
+
+// toolEnviron returns the environment variables of the current process, in the
+// form "key=value", that processes running the specified tool may inherit,
+// given the provided opt-ins, indexed by tool name.
+func toolEnviron(toolEnv map[string][]string, tool string) []string {
+	return libExec.Environ(toolEnvAllowlist(toolEnv, tool)...)
+}
+
+// RestrictProcessEnv removes every environment variable that no tool may
+// inherit, given the provided opt-ins, indexed by tool name (see
+// ServiceOptions.ToolEnv), from the environment of the current process. Argo
+// CD's repo server, which runs helm and kustomize in the course of rendering,
+// passes the entire environment of the process to them, so this is the only
+// means of keeping other variables from them. Since it affects the whole
+// process, it should only be called once, at startup, by programs that don't
+// themselves need the variables that are removed.
+func RestrictProcessEnv(toolEnv map[string][]string) error {
+	allowlist := append([]string{}, libExec.DefaultEnvAllowlist...)
+	for _, entries := range defaultToolEnv {
+		allowlist = append(allowlist, entries...)
+	}
+	for _, entries := range toolEnv {
+		allowlist = append(allowlist, entries...)
+	}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if libExec.EnvAllowed(name, allowlist) {
+			continue
+		}
+		if err := os.Unsetenv(name); err != nil {
+			return fmt.Errorf("error unsetting environment variable %q: %w", name, err)
+		}
+	}
+	return nil
+}
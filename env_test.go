@@ -0,0 +1,51 @@
+package render
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolEnviron(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("HELM_CACHE_HOME", "/cache")
+	t.Setenv("MY_VAR", "foo")
+	toolEnv := map[string][]string{"helm": {"MY_*"}}
+
+	environ := toolEnviron(toolEnv, "helm")
+	require.Contains(t, environ, "HELM_CACHE_HOME=/cache")
+	require.Contains(t, environ, "MY_VAR=foo")
+	require.NotContains(t, environ, "GITHUB_TOKEN=secret")
+
+	environ = toolEnviron(toolEnv, "ytt")
+	require.NotContains(t, environ, "HELM_CACHE_HOME=/cache")
+	require.NotContains(t, environ, "MY_VAR=foo")
+}
+
+func TestRestrictProcessEnv(t *testing.T) {
+	// Restore the entire environment afterward, since variables that aren't
+	// set by this test are removed, too
+	environ := os.Environ()
+	t.Cleanup(func() {
+		os.Clearenv()
+		for _, kv := range environ {
+			name, value, _ := strings.Cut(kv, "=")
+			os.Setenv(name, value)
+		}
+	})
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("KUSTOMIZE_PLUGIN_HOME", "/plugins")
+	t.Setenv("MY_VAR", "foo")
+
+	require.NoError(
+		t,
+		RestrictProcessEnv(map[string][]string{"ytt": {"MY_VAR"}}),
+	)
+	_, ok := os.LookupEnv("GITHUB_TOKEN")
+	require.False(t, ok)
+	require.Equal(t, "/plugins", os.Getenv("KUSTOMIZE_PLUGIN_HOME"))
+	require.Equal(t, "foo", os.Getenv("MY_VAR"))
+	require.NotEmpty(t, os.Getenv("PATH"))
+}
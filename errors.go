@@ -0,0 +1,697 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// InvalidRequestError is returned when a Request is malformed or specifies an
+// invalid combination of fields.
+type InvalidRequestError struct {
+	// Err describes every problem with the Request.
+	Err error
+	// FieldErrors describe every problem with the Request individually.
+	FieldErrors []FieldError
+}
+
+// newInvalidRequestError returns an InvalidRequestError describing the
+// provided problems.
+func newInvalidRequestError(fieldErrs []FieldError) *InvalidRequestError {
+	errs := make([]error, len(fieldErrs))
+	for i := range fieldErrs {
+		errs[i] = &fieldErrs[i]
+	}
+	return &InvalidRequestError{
+		Err:         errors.Join(errs...),
+		FieldErrors: fieldErrs,
+	}
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidRequestError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError describes a problem with one field of a Request. Problems with a
+// combination of fields are attributed to one of them.
+type FieldError struct {
+	// Field is the path to the field in the Request's JSON representation, with
+	// the names of nested fields separated by periods, e.g.
+	// "repoCreds.writeCreds.netrc".
+	Field string `json:"field"`
+	// Reason describes the problem.
+	Reason string `json:"reason"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Reason
+}
+
+// IdempotencyKeyConflictError is returned when a Request specifies an
+// idempotency key that was already used for a different Request.
+type IdempotencyKeyConflictError struct {
+	// Key is the idempotency key.
+	Key string
+}
+
+func (e *IdempotencyKeyConflictError) Error() string {
+	return fmt.Sprintf(
+		"idempotency key %q was already used for a different request",
+		e.Key,
+	)
+}
+
+// DuplicateBranchConfigError is returned when a repository's Kargo Render
+// configuration contains more than one configuration for the same branch name
+// or more than one default branch configuration.
+type DuplicateBranchConfigError struct {
+	// Name is the duplicated branch name. It is empty when the duplicate is a
+	// default branch configuration.
+	Name string
+}
+
+func (e *DuplicateBranchConfigError) Error() string {
+	if e.Name == "" {
+		return "configuration contains more than one default branch configuration"
+	}
+	return fmt.Sprintf(
+		"configuration contains more than one branch configuration for branch %q",
+		e.Name,
+	)
+}
+
+// UnreachableBranchConfigError is returned when a branch configuration in a
+// repository's Kargo Render configuration can never be selected because every
+// branch it could apply to is already matched by an earlier configuration.
+type UnreachableBranchConfigError struct {
+	// Index is the index of the unreachable branch configuration.
+	Index int
+	// ShadowedBy is the index of the earlier branch configuration that matches
+	// all branches the unreachable configuration could apply to.
+	ShadowedBy int
+}
+
+func (e *UnreachableBranchConfigError) Error() string {
+	return fmt.Sprintf(
+		"branch configuration %d can never be selected because branch "+
+			"configuration %d already matches every branch it applies to",
+		e.Index,
+		e.ShadowedBy,
+	)
+}
+
+// InvalidBranchConfigError is returned when a branch configuration in a
+// repository's Kargo Render configuration is well-formed according to the
+// configuration schema, but is nonetheless unusable.
+type InvalidBranchConfigError struct {
+	// Index is the index of the invalid branch configuration.
+	Index int
+	// Reason describes why the branch configuration is invalid.
+	Reason string
+}
+
+func (e *InvalidBranchConfigError) Error() string {
+	return fmt.Sprintf("branch configuration %d is invalid: %s", e.Index, e.Reason)
+}
+
+// InvalidConfigError is returned when a repository's Kargo Render configuration
+// does not conform to the configuration schema.
+type InvalidConfigError struct {
+	// File is the name of the configuration file.
+	File string
+	// Problems lists every way in which the configuration does not conform to
+	// the configuration schema.
+	Problems []ConfigProblem
+}
+
+// ConfigProblem describes a single way in which a repository's Kargo Render
+// configuration does not conform to the configuration schema.
+type ConfigProblem struct {
+	// Field identifies the offending field, e.g. branchConfigs.0.name. It is
+	// empty if the problem is with the configuration as a whole.
+	Field string
+	// Description describes the problem.
+	Description string
+	// Line is the line of the configuration file, starting at 1, at which the
+	// offending field is found. It is zero if the line is not known.
+	Line int
+	// Column is the column of the configuration file, starting at 1, at which
+	// the offending field is found. It is zero if the column is not known.
+	Column int
+	// Snippet is the text of the line at which the offending field is found.
+	Snippet string
+}
+
+func (e *InvalidConfigError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		location := e.File
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", e.File, problem.Line, problem.Column)
+		}
+		problems[i] = fmt.Sprintf("%s: %s", location, problem.Description)
+		if problem.Field != "" {
+			problems[i] = fmt.Sprintf(
+				"%s: %s: %s",
+				location,
+				problem.Field,
+				problem.Description,
+			)
+		}
+		if problem.Snippet != "" {
+			problems[i] = fmt.Sprintf("%s\n\t%s", problems[i], problem.Snippet)
+		}
+	}
+	return fmt.Sprintf(
+		"configuration does not conform to the configuration schema:\n%s",
+		strings.Join(problems, "\n"),
+	)
+}
+
+// NoBranchConfigError is returned when a repository's Kargo Render
+// configuration defines branch configurations, but none of them, including a
+// default, applies to the requested target branch.
+type NoBranchConfigError struct {
+	// Branch is the name of the branch for which no configuration was found.
+	Branch string
+}
+
+func (e *NoBranchConfigError) Error() string {
+	return fmt.Sprintf(
+		"no branch configuration applies to branch %q; add a configuration "+
+			"whose name or pattern matches it, or a default branch configuration "+
+			"that specifies neither a name nor a pattern",
+		e.Branch,
+	)
+}
+
+// UnmatchedImagesError is returned when rendering is refused because images
+// specified by a Request that requires every image to match do not match any
+// image referenced by the manifests of any app.
+type UnmatchedImagesError struct {
+	// Images lists the images that matched nothing.
+	Images []string
+}
+
+func (e *UnmatchedImagesError) Error() string {
+	return fmt.Sprintf(
+		"refusing to render because the following images do not match any "+
+			"image referenced by any app: %s",
+		strings.Join(e.Images, ", "),
+	)
+}
+
+// StalePlanError is returned when applying a Plan is refused because a branch
+// it applies to has changed since the Plan was created.
+type StalePlanError struct {
+	// Branch is the name of the branch that has changed.
+	Branch string
+	// ExpectedCommit is the ID (sha) of the commit that was at the head of
+	// Branch when the Plan was created. It is empty if Branch did not exist.
+	ExpectedCommit string
+	// ActualCommit describes the current head of Branch.
+	ActualCommit string
+}
+
+func (e *StalePlanError) Error() string {
+	expected := e.ExpectedCommit
+	if expected == "" {
+		expected = "(nonexistent)"
+	}
+	return fmt.Sprintf(
+		"branch %q has changed from %s to %s since the plan was created; "+
+			"create a new plan",
+		e.Branch,
+		expected,
+		e.ActualCommit,
+	)
+}
+
+// ConfigManagementToolNotAllowedError is returned when rendering an app would
+// require a configuration management tool that the Service has not been
+// configured to allow.
+type ConfigManagementToolNotAllowedError struct {
+	// App is the name of the app.
+	App string
+	// Tool is the configuration management tool the app requires.
+	Tool ConfigManagementTool
+	// BuildOption, if non-empty, is the kustomize build option, such as
+	// --enable-exec, because of which the app requires the tool.
+	BuildOption string
+	// Allowed lists the configuration management tools that are allowed.
+	Allowed []ConfigManagementTool
+}
+
+func (e *ConfigManagementToolNotAllowedError) Error() string {
+	allowed := make([]string, len(e.Allowed))
+	for i, tool := range e.Allowed {
+		allowed[i] = string(tool)
+	}
+	if e.BuildOption != "" {
+		return fmt.Sprintf(
+			"app %q uses kustomize build option %s, which executes commands as "+
+				"configuration management tool %q does, which is not allowed; "+
+				"allowed tools are: [%s]",
+			e.App,
+			e.BuildOption,
+			e.Tool,
+			strings.Join(allowed, ", "),
+		)
+	}
+	return fmt.Sprintf(
+		"app %q requires configuration management tool %q, which is not "+
+			"allowed; allowed tools are: [%s]",
+		e.App,
+		e.Tool,
+		strings.Join(allowed, ", "),
+	)
+}
+
+// UnverifiedCommitError is returned when rendering is refused because the
+// source commit does not bear a good signature made by a key trusted by a
+// CommitSignaturePolicy that applies to the target branch.
+type UnverifiedCommitError struct {
+	// Commit is the ID of the source commit.
+	Commit string
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Signature describes the signature on the source commit, if any.
+	Signature git.CommitSignature
+}
+
+func (e *UnverifiedCommitError) Error() string {
+	var reason string
+	switch e.Signature.Status {
+	case "N", "":
+		reason = "it is not signed"
+	case "U", "E":
+		reason = fmt.Sprintf(
+			"it is signed by key %q, which is not trusted",
+			e.Signature.Key,
+		)
+	default:
+		reason = fmt.Sprintf(
+			"its signature by key %q could not be verified (status %s)",
+			e.Signature.Key,
+			e.Signature.Status,
+		)
+	}
+	return fmt.Sprintf(
+		"refusing to render commit %q into branch %q because %s",
+		e.Commit,
+		e.TargetBranch,
+		reason,
+	)
+}
+
+// RequiredChecksNotPassedError is returned when rendering is refused because
+// status checks required by a RequiredChecksPolicy that applies to the target
+// branch have not passed on the source commit.
+type RequiredChecksNotPassedError struct {
+	// Commit is the ID of the source commit.
+	Commit string
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Checks maps the name of each required check that has not passed to its
+	// state: pending, failure, or missing.
+	Checks map[string]string
+}
+
+func (e *RequiredChecksNotPassedError) Error() string {
+	checks := make([]string, 0, len(e.Checks))
+	for check, state := range e.Checks {
+		checks = append(checks, fmt.Sprintf("%s (%s)", check, state))
+	}
+	sort.Strings(checks)
+	return fmt.Sprintf(
+		"refusing to render commit %q into branch %q because required checks "+
+			"have not passed: %s",
+		e.Commit,
+		e.TargetBranch,
+		strings.Join(checks, ", "),
+	)
+}
+
+// TooManyOpenPRsError is returned when rendering is refused because opening
+// another pull request to the target branch would exceed the limit on open
+// pull requests in the branch's configuration.
+type TooManyOpenPRsError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Open is the number of pull requests opened by Kargo Render that are
+	// open to the target branch.
+	Open int
+	// Max is the maximum number of such pull requests that may be open.
+	Max int
+}
+
+func (e *TooManyOpenPRsError) Error() string {
+	return fmt.Sprintf(
+		"refusing to open another pull request to branch %q because %d are "+
+			"already open and at most %d may be",
+		e.TargetBranch,
+		e.Open,
+		e.Max,
+	)
+}
+
+// PromotionOrderError is returned when rendering is refused because the source
+// commit has not yet been rendered into the branch that precedes the target
+// branch in the repository's configured promotion order.
+type PromotionOrderError struct {
+	// Commit is the ID of the source commit.
+	Commit string
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Predecessor is the name of the branch that precedes the target branch.
+	Predecessor string
+	// PredecessorCommit is the ID of the source commit the predecessor was most
+	// recently rendered from. It is empty if the predecessor has never been
+	// rendered.
+	PredecessorCommit string
+}
+
+func (e *PromotionOrderError) Error() string {
+	if e.PredecessorCommit == "" {
+		return fmt.Sprintf(
+			"refusing to render commit %q into branch %q because branch %q, "+
+				"which precedes it in the promotion order, has not been rendered yet",
+			e.Commit,
+			e.TargetBranch,
+			e.Predecessor,
+		)
+	}
+	return fmt.Sprintf(
+		"refusing to render commit %q into branch %q because it has not yet "+
+			"been rendered into branch %q, which precedes it in the promotion "+
+			"order and was last rendered from commit %q",
+		e.Commit,
+		e.TargetBranch,
+		e.Predecessor,
+		e.PredecessorCommit,
+	)
+}
+
+// ResourcePolicyViolationError is returned when rendering is refused because
+// rendered resources violate the resource policy of the target branch.
+type ResourcePolicyViolationError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Violations lists every rendered resource that violates the policy.
+	Violations []ResourcePolicyViolation
+}
+
+func (e *ResourcePolicyViolationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		violations[i] = violation.String()
+	}
+	return fmt.Sprintf(
+		"refusing to render into branch %q because rendered resources violate "+
+			"its resource policy: %s",
+		e.TargetBranch,
+		strings.Join(violations, ", "),
+	)
+}
+
+// MissingPreservedPathsError is returned when rendering is refused because
+// paths the target branch's configuration says to preserve do not exist in
+// the branch.
+type MissingPreservedPathsError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Paths lists every preserved path that does not exist.
+	Paths []string
+}
+
+func (e *MissingPreservedPathsError) Error() string {
+	return fmt.Sprintf(
+		"refusing to render into branch %q because preserved paths do not "+
+			"exist in it: %s",
+		e.TargetBranch,
+		strings.Join(e.Paths, ", "),
+	)
+}
+
+// DuplicateResourcesError is returned when rendering is refused because more
+// than one app renders the same namespaced resource into the target branch.
+type DuplicateResourcesError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Duplicates lists every resource rendered by more than one app.
+	Duplicates []DuplicateResource
+}
+
+func (e *DuplicateResourcesError) Error() string {
+	duplicates := make([]string, len(e.Duplicates))
+	for i, duplicate := range e.Duplicates {
+		duplicates[i] = duplicate.String()
+	}
+	return fmt.Sprintf(
+		"refusing to render into branch %q because resources are rendered by "+
+			"more than one app: %s",
+		e.TargetBranch,
+		strings.Join(duplicates, ", "),
+	)
+}
+
+// LintError is returned when rendering is refused because a linter found
+// problems with the input of an app whose lint configuration says to fail on
+// them.
+type LintError struct {
+	// Finding describes the problems.
+	Finding LintFinding
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf(
+		"refusing to render app %q because %s found problems with its input:\n%s",
+		e.Finding.App,
+		e.Finding.Linter,
+		e.Finding.Output,
+	)
+}
+
+// ExternalPathCollisionError is returned when rendering is refused because
+// the output path of an app overlaps a path that the target branch's
+// configuration says is owned by other tools.
+type ExternalPathCollisionError struct {
+	// App is the name of the app.
+	App string
+	// OutputPath is the app's output path.
+	OutputPath string
+	// ExternalPath is the external path the output path overlaps.
+	ExternalPath string
+}
+
+func (e *ExternalPathCollisionError) Error() string {
+	return fmt.Sprintf(
+		"refusing to write output of app %q to %q because it overlaps %q, "+
+			"which is owned by other tools",
+		e.App,
+		e.OutputPath,
+		e.ExternalPath,
+	)
+}
+
+// SymlinkError is returned when Kargo Render encounters a symbolic link in a
+// target branch that the repository's symlink policy does not permit it to
+// clean, copy, or write through.
+type SymlinkError struct {
+	// Path is the path of the link, relative to the root of the branch.
+	Path string
+	// Policy is the repository's symlink policy.
+	Policy string
+	// Reason describes why the link is not permitted.
+	Reason string
+}
+
+func (e *SymlinkError) Error() string {
+	return fmt.Sprintf(
+		"symbolic link %q is not permitted by symlink policy %q: %s",
+		e.Path,
+		e.Policy,
+		e.Reason,
+	)
+}
+
+// UnpinnedRemoteBaseError is returned when rendering is refused because an
+// app's kustomization references a remote base that is not pinned to a
+// specific commit and the target branch's configuration requires remote bases
+// to be pinned.
+type UnpinnedRemoteBaseError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// RemoteBase is the offending remote base.
+	RemoteBase RemoteBase
+}
+
+func (e *UnpinnedRemoteBaseError) Error() string {
+	return fmt.Sprintf(
+		"refusing to render app %q into branch %q because %s references remote "+
+			"base %q, which is not pinned to a commit",
+		e.RemoteBase.App,
+		e.TargetBranch,
+		e.RemoteBase.Kustomization,
+		e.RemoteBase.URL,
+	)
+}
+
+// NetworkAccessRequiredError is returned when rendering is refused because a
+// request is to be handled offline, but handling it would require network
+// access beyond that to the remote repository.
+type NetworkAccessRequiredError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Reasons describes everything that would require network access.
+	Reasons []string
+}
+
+func (e *NetworkAccessRequiredError) Error() string {
+	return fmt.Sprintf(
+		"refusing to render into branch %q offline because doing so would "+
+			"require network access: %s",
+		e.TargetBranch,
+		strings.Join(e.Reasons, "; "),
+	)
+}
+
+// UnsupportedVersionError is returned when a repository's Kargo Render
+// configuration requires a later version of Kargo Render than the one handling
+// a request.
+type UnsupportedVersionError struct {
+	// MinVersion is the earliest version the configuration permits.
+	MinVersion string
+	// Version is the version of Kargo Render handling the request.
+	Version string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf(
+		"Kargo Render configuration requires Kargo Render %s or later, but this "+
+			"is version %s; upgrade Kargo Render to render this repository",
+		e.MinVersion,
+		e.Version,
+	)
+}
+
+// AppRenderTimeoutError is returned when a stage of rendering an app's
+// manifests takes longer than the app's render timeout permits. This usually
+// indicates a misbehaving chart or kustomization, such as a template that
+// never terminates.
+type AppRenderTimeoutError struct {
+	// App is the name of the app.
+	App string
+	// Stage is the stage of rendering that timed out, e.g. StagePreRender or
+	// StageLastMile.
+	Stage string
+	// Timeout is the render timeout that was exceeded.
+	Timeout time.Duration
+}
+
+func (e *AppRenderTimeoutError) Error() string {
+	return fmt.Sprintf(
+		"stage %q of rendering app %q did not complete within the render timeout "+
+			"of %s",
+		e.Stage,
+		e.App,
+		e.Timeout,
+	)
+}
+
+// CommitVetoedError is returned when ServiceOptions.PreCommitHook refuses to
+// permit the changes rendered into a target branch to be committed.
+type CommitVetoedError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Err is the error returned by the hook.
+	Err error
+}
+
+func (e *CommitVetoedError) Error() string {
+	return fmt.Sprintf(
+		"pre-commit hook vetoed commit to target branch %q: %s",
+		e.TargetBranch,
+		e.Err,
+	)
+}
+
+func (e *CommitVetoedError) Unwrap() error {
+	return e.Err
+}
+
+// UnmanagedBranchError is returned when rendering is refused because the
+// target branch is not empty, but has no Kargo Render metadata, so that its
+// contents, which something else may maintain, are not overwritten.
+type UnmanagedBranchError struct {
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Path is the path to the working tree of the target branch if it was
+	// prepared by the caller rather than by Kargo Render. Such a branch cannot
+	// be adopted.
+	Path string
+}
+
+func (e *UnmanagedBranchError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf(
+			"%s is not empty, but does not appear to be managed by Kargo Render; "+
+				"refusing to overwrite its contents",
+			e.Path,
+		)
+	}
+	return fmt.Sprintf(
+		"target branch %q already exists, but does not appear to be managed by "+
+			"Kargo Render; refusing to overwrite branch contents unless the branch "+
+			"is adopted",
+		e.TargetBranch,
+	)
+}
+
+// LockLostError is returned when a request that required a lock on the target
+// branch was canceled because the lock could not be renewed, in which case
+// another replica may have acquired it.
+type LockLostError struct {
+	// RepoURL is the URL of the repository.
+	RepoURL string
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// Err describes why the lock could not be renewed.
+	Err error
+}
+
+func (e *LockLostError) Error() string {
+	return fmt.Sprintf(
+		"lost lock on target branch %q of repository %q: %s",
+		e.TargetBranch,
+		e.RepoURL,
+		e.Err,
+	)
+}
+
+func (e *LockLostError) Unwrap() error {
+	return e.Err
+}
+
+// RequestInProgressError is returned when a request bearing an ID is refused
+// because another attempt at handling a request with the same ID is in
+// progress and is using the workspace the ID determines.
+type RequestInProgressError struct {
+	// RequestID is the ID of the request.
+	RequestID string
+}
+
+func (e *RequestInProgressError) Error() string {
+	return fmt.Sprintf(
+		"request %q is already being handled; its workspace is in use",
+		e.RequestID,
+	)
+}
@@ -0,0 +1,330 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the CloudEvents emitted by the Kargo Render service.
+const (
+	// EventTypeRenderStarted is the type of the event emitted when the handling
+	// of a request begins. Its data identifies the repository and target
+	// branch.
+	EventTypeRenderStarted = "io.akuity.kargo-render.render.started"
+	// EventTypeRenderCompleted is the type of the event emitted when a request
+	// has been handled successfully. Its data is the Response.
+	EventTypeRenderCompleted = "io.akuity.kargo-render.render.completed"
+	// EventTypeRenderFailed is the type of the event emitted when a request
+	// could not be handled. Its data describes the error.
+	EventTypeRenderFailed = "io.akuity.kargo-render.render.failed"
+	// EventTypePROpened is the type of the event emitted, in addition to
+	// EventTypeRenderCompleted, when handling a request opened a pull request.
+	// Its data is the Response.
+	EventTypePROpened = "io.akuity.kargo-render.pr.opened"
+)
+
+// cloudEventsSpecVersion is the version of the CloudEvents specification that
+// Events conform to.
+const cloudEventsSpecVersion = "1.0"
+
+// Event is a CloudEvent, in its JSON representation, emitted by the Kargo
+// Render service.
+type Event struct {
+	// SpecVersion is the version of the CloudEvents specification the event
+	// conforms to.
+	SpecVersion string `json:"specversion"`
+	// ID uniquely identifies the event.
+	ID string `json:"id"`
+	// Source identifies the context in which the event occurred. This is the
+	// URL of the repository the request pertained to.
+	Source string `json:"source"`
+	// Type is the type of the event. It is one of the EventType* constants.
+	Type string `json:"type"`
+	// Subject is the target branch the request pertained to.
+	Subject string `json:"subject,omitempty"`
+	// Time is when the event occurred.
+	Time time.Time `json:"time"`
+	// DataContentType is the content type of Data. It is always
+	// application/json.
+	DataContentType string `json:"datacontenttype"`
+	// Data is the event payload.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// EventSink is an interface for components that can deliver Events emitted by
+// the Kargo Render service to some destination, such as an HTTP endpoint or a
+// message broker.
+type EventSink interface {
+	// Send delivers the provided Event.
+	Send(context.Context, Event) error
+}
+
+// httpEventSink is an EventSink that delivers Events to an HTTP endpoint.
+type httpEventSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPEventSink returns an EventSink that delivers each Event to the
+// specified URL as an HTTP POST request, using the CloudEvents HTTP protocol
+// binding's structured content mode. If client is nil, a client with a ten
+// second timeout is used. Any response status other than 2xx is treated as a
+// failure to deliver the Event.
+func NewHTTPEventSink(url string, client *http.Client) EventSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &httpEventSink{
+		url:    url,
+		client: client,
+	}
+}
+
+func (h *httpEventSink) Send(ctx context.Context, event Event) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		h.url,
+		bytes.NewReader(eventBytes),
+	)
+	if err != nil {
+		return fmt.Errorf("error building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending event: %w", err)
+	}
+	defer res.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("event sink responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// defaultMaxQueuedEvents is the number of Events an AsyncEventSink holds for
+// delivery, by default, before it starts to drop them.
+const defaultMaxQueuedEvents = 100
+
+// eventDeliveryTimeout is the maximum amount of time an AsyncEventSink waits
+// for any one Event to be delivered, so that a sink that hangs can't hold up
+// the Events queued behind it indefinitely.
+const eventDeliveryTimeout = 10 * time.Second
+
+// AsyncEventSink is an EventSink that queues Events and delivers them to
+// another EventSink in the background, one at a time and in the order they
+// were sent, so that senders never wait on a slow destination. The Kargo
+// Render service delivers Events through an AsyncEventSink of its own unless
+// it is given one. Programs that may exit shortly after handling a request
+// should give it one and call Flush before exiting.
+type AsyncEventSink struct {
+	sink      EventSink
+	maxQueued int
+	// onError, if non-nil, is invoked with every Event that could not be
+	// delivered. Otherwise, errors are retained until Flush is called.
+	onError func(Event, error)
+
+	mu      sync.Mutex
+	queue   []Event
+	errs    []error
+	running bool
+	// idle is closed once the queue has been drained.
+	idle chan struct{}
+}
+
+// NewAsyncEventSink returns an AsyncEventSink that delivers Events to the
+// provided EventSink. At most maxQueued Events await delivery at once; Events
+// sent while that many are waiting are dropped. If maxQueued is not positive,
+// a default of 100 is used.
+func NewAsyncEventSink(sink EventSink, maxQueued int) *AsyncEventSink {
+	if maxQueued <= 0 {
+		maxQueued = defaultMaxQueuedEvents
+	}
+	idle := make(chan struct{})
+	close(idle)
+	return &AsyncEventSink{
+		sink:      sink,
+		maxQueued: maxQueued,
+		idle:      idle,
+	}
+}
+
+// Send queues the provided Event for delivery and returns immediately. An
+// error is returned only if the Event was dropped because the queue is full.
+func (a *AsyncEventSink) Send(_ context.Context, event Event) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) >= a.maxQueued {
+		return fmt.Errorf(
+			"dropped event because %d events are already awaiting delivery",
+			len(a.queue),
+		)
+	}
+	a.queue = append(a.queue, event)
+	if !a.running {
+		a.running = true
+		a.idle = make(chan struct{})
+		go a.deliver(a.idle)
+	}
+	return nil
+}
+
+// deliver delivers queued Events until none are left, then closes idle.
+func (a *AsyncEventSink) deliver(idle chan struct{}) {
+	for {
+		a.mu.Lock()
+		if len(a.queue) == 0 {
+			a.running = false
+			close(idle)
+			a.mu.Unlock()
+			return
+		}
+		event := a.queue[0]
+		a.queue = a.queue[1:]
+		a.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), eventDeliveryTimeout)
+		err := a.sink.Send(ctx, event)
+		cancel()
+		if err == nil {
+			continue
+		}
+		if a.onError != nil {
+			a.onError(event, err)
+			continue
+		}
+		a.mu.Lock()
+		a.errs = append(a.errs, err)
+		a.mu.Unlock()
+	}
+}
+
+// Flush waits until every queued Event has been delivered, or until the
+// provided context is done, whichever happens first. It returns the errors,
+// if any, that occurred while delivering Events since Flush was last called.
+func (a *AsyncEventSink) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	idle := a.idle
+	a.mu.Unlock()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := errors.Join(a.errs...)
+	a.errs = nil
+	return err
+}
+
+// renderStartedEventData is the payload of EventTypeRenderStarted events.
+type renderStartedEventData struct {
+	RepoURL      string `json:"repoURL,omitempty"`
+	TargetBranch string `json:"targetBranch"`
+}
+
+// renderFailedEventData is the payload of EventTypeRenderFailed events.
+type renderFailedEventData struct {
+	RepoURL      string `json:"repoURL,omitempty"`
+	TargetBranch string `json:"targetBranch"`
+	Error        string `json:"error"`
+}
+
+// withEvents invokes fn, emitting events that describe its progress and
+// outcome to the service's EventSink, if any.
+func (s *service) withEvents(
+	ctx context.Context,
+	repoURL string,
+	targetBranch string,
+	fn func() (Response, error),
+) (Response, error) {
+	if s.eventSink == nil {
+		return fn()
+	}
+	s.emitEvent(
+		ctx,
+		repoURL,
+		targetBranch,
+		EventTypeRenderStarted,
+		renderStartedEventData{
+			RepoURL:      repoURL,
+			TargetBranch: targetBranch,
+		},
+	)
+	res, err := fn()
+	if err != nil {
+		s.emitEvent(
+			ctx,
+			repoURL,
+			targetBranch,
+			EventTypeRenderFailed,
+			renderFailedEventData{
+				RepoURL:      repoURL,
+				TargetBranch: targetBranch,
+				Error:        err.Error(),
+			},
+		)
+		return res, err
+	}
+	s.emitEvent(ctx, repoURL, targetBranch, EventTypeRenderCompleted, res)
+	if res.ActionTaken == ActionTakenOpenedPR {
+		s.emitEvent(ctx, repoURL, targetBranch, EventTypePROpened, res)
+	}
+	return res, nil
+}
+
+// emitEvent sends an event of the specified type to the service's EventSink,
+// which queues it for delivery. Events are delivered on a best-effort basis.
+// Failure to deliver an event is logged, but never causes the request the event
+// pertains to to fail.
+func (s *service) emitEvent(
+	ctx context.Context,
+	repoURL string,
+	targetBranch string,
+	eventType string,
+	data any,
+) {
+	logger := s.logger.WithField("eventType", eventType)
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		logger.WithError(err).Error("error marshaling event data")
+		return
+	}
+	source := repoURL
+	if source == "" {
+		source = "kargo-render"
+	}
+	if err = s.eventSink.Send(
+		// The request may have been canceled, but its outcome is still news
+		context.WithoutCancel(ctx),
+		Event{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              uuid.NewString(),
+			Source:          source,
+			Type:            eventType,
+			Subject:         targetBranch,
+			Time:            time.Now().UTC(),
+			DataContentType: "application/json",
+			Data:            dataBytes,
+		},
+	); err != nil {
+		logger.WithError(err).Error("error emitting event")
+		return
+	}
+	logger.Debug("queued event")
+}
@@ -0,0 +1,211 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Reasons given by the Kubernetes Events, and by the status conditions, that
+// describe the handling of a request.
+const (
+	// ReasonRenderStarted is the reason given when the handling of a request
+	// begins.
+	ReasonRenderStarted = "RenderStarted"
+	// ReasonRenderCompleted is the reason given when a request has been handled
+	// successfully.
+	ReasonRenderCompleted = "RenderCompleted"
+	// ReasonRenderFailed is the reason given when a request could not be
+	// handled.
+	ReasonRenderFailed = "RenderFailed"
+	// ReasonPROpened is the reason given when handling a request opened a pull
+	// request.
+	ReasonPROpened = "PROpened"
+)
+
+// Types of the status conditions of a Kubernetes resource that represents a
+// request. See SetRenderConditions.
+const (
+	// ConditionTypeRendered indicates whether the request has been handled
+	// successfully. It is Unknown while the request is being handled.
+	ConditionTypeRendered = "Rendered"
+	// ConditionTypePROpened indicates that handling the request opened a pull
+	// request, whose URL is the condition's message.
+	ConditionTypePROpened = "PROpened"
+	// ConditionTypeFailed indicates whether the request could not be handled.
+	// If so, the condition's message is the error.
+	ConditionTypeFailed = "Failed"
+)
+
+// kubernetesEventSink is an EventSink that records Events as Kubernetes Events
+// pertaining to a single Kubernetes resource.
+type kubernetesEventSink struct {
+	client    corev1client.EventsGetter
+	object    corev1.ObjectReference
+	component string
+}
+
+// NewKubernetesEventSink returns an EventSink that records each Event as a
+// Kubernetes Event, pertaining to the specified object, using the provided
+// client, which is typically obtained by calling CoreV1() on a Kubernetes
+// clientset. The object is typically the resource representing the request,
+// so that `kubectl describe` shows how it was handled. Kubernetes Events are
+// created in the object's namespace and attributed to the specified component.
+func NewKubernetesEventSink(
+	client corev1client.EventsGetter,
+	object corev1.ObjectReference,
+	component string,
+) EventSink {
+	return &kubernetesEventSink{
+		client:    client,
+		object:    object,
+		component: component,
+	}
+}
+
+func (k *kubernetesEventSink) Send(ctx context.Context, event Event) error {
+	desc, err := describeEvent(event)
+	if err != nil {
+		return err
+	}
+	eventType := corev1.EventTypeNormal
+	if desc.failed {
+		eventType = corev1.EventTypeWarning
+	}
+	eventTime := metav1.NewTime(event.Time)
+	if _, err = k.client.Events(k.object.Namespace).Create(
+		ctx,
+		&corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				// This is how names are chosen by client-go's event recorder
+				Name:      fmt.Sprintf("%s.%x", k.object.Name, time.Now().UnixNano()),
+				Namespace: k.object.Namespace,
+			},
+			InvolvedObject: k.object,
+			Reason:         desc.reason,
+			Message:        desc.message,
+			Source:         corev1.EventSource{Component: k.component},
+			FirstTimestamp: eventTime,
+			LastTimestamp:  eventTime,
+			Count:          1,
+			Type:           eventType,
+		},
+		metav1.CreateOptions{},
+	); err != nil {
+		return fmt.Errorf("error creating Kubernetes event: %w", err)
+	}
+	return nil
+}
+
+// SetRenderConditions updates the provided status conditions of a Kubernetes
+// resource that represents a request to reflect an Event emitted while
+// handling the request. This gives a controller that handles such resources
+// the standard means of reporting on them, e.g. by passing an EventSink that
+// calls SetRenderConditions, then updates the resource's status, to
+// NewService. observedGeneration is the generation of the resource that the
+// request was derived from.
+func SetRenderConditions(
+	conditions *[]metav1.Condition,
+	event Event,
+	observedGeneration int64,
+) error {
+	desc, err := describeEvent(event)
+	if err != nil {
+		return err
+	}
+	set := func(conditionType string, status metav1.ConditionStatus) {
+		meta.SetStatusCondition(
+			conditions,
+			metav1.Condition{
+				Type:               conditionType,
+				Status:             status,
+				ObservedGeneration: observedGeneration,
+				Reason:             desc.reason,
+				Message:            desc.message,
+			},
+		)
+	}
+	switch event.Type {
+	case EventTypeRenderStarted:
+		set(ConditionTypeRendered, metav1.ConditionUnknown)
+		set(ConditionTypeFailed, metav1.ConditionFalse)
+		// A pull request opened by an earlier attempt is not news anymore
+		meta.RemoveStatusCondition(conditions, ConditionTypePROpened)
+	case EventTypeRenderCompleted:
+		set(ConditionTypeRendered, metav1.ConditionTrue)
+		set(ConditionTypeFailed, metav1.ConditionFalse)
+	case EventTypeRenderFailed:
+		set(ConditionTypeRendered, metav1.ConditionFalse)
+		set(ConditionTypeFailed, metav1.ConditionTrue)
+	case EventTypePROpened:
+		set(ConditionTypePROpened, metav1.ConditionTrue)
+	}
+	return nil
+}
+
+// eventDescription is a human readable account of an Event.
+type eventDescription struct {
+	reason  string
+	message string
+	failed  bool
+}
+
+// describeEvent returns a human readable account of the provided Event, which
+// is suitable for Kubernetes Events and status conditions alike.
+func describeEvent(event Event) (eventDescription, error) {
+	switch event.Type {
+	case EventTypeRenderStarted:
+		return eventDescription{
+			reason:  ReasonRenderStarted,
+			message: fmt.Sprintf("Rendering manifests for branch %s", event.Subject),
+		}, nil
+	case EventTypeRenderFailed:
+		data := renderFailedEventData{}
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return eventDescription{}, fmt.Errorf("error unmarshaling event data: %w", err)
+		}
+		return eventDescription{
+			reason: ReasonRenderFailed,
+			message: fmt.Sprintf(
+				"Error rendering manifests for branch %s: %s",
+				event.Subject,
+				data.Error,
+			),
+			failed: true,
+		}, nil
+	case EventTypeRenderCompleted, EventTypePROpened:
+		res := Response{}
+		if err := json.Unmarshal(event.Data, &res); err != nil {
+			return eventDescription{}, fmt.Errorf("error unmarshaling event data: %w", err)
+		}
+		if event.Type == EventTypePROpened {
+			return eventDescription{
+				reason: ReasonPROpened,
+				message: fmt.Sprintf(
+					"Opened pull request %s for branch %s",
+					res.PullRequestURL,
+					event.Subject,
+				),
+			}, nil
+		}
+		message := fmt.Sprintf(
+			"Rendered manifests for branch %s; action taken: %s",
+			event.Subject,
+			res.ActionTaken,
+		)
+		if res.CommitID != "" {
+			message = fmt.Sprintf("%s; commit: %s", message, res.CommitID)
+		}
+		return eventDescription{
+			reason:  ReasonRenderCompleted,
+			message: message,
+		}, nil
+	}
+	return eventDescription{}, fmt.Errorf("unknown event type %q", event.Type)
+}
@@ -0,0 +1,121 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestEvent returns an Event of the specified type whose data is the
+// provided value.
+func newTestEvent(t *testing.T, eventType string, data any) Event {
+	dataBytes, err := json.Marshal(data)
+	require.NoError(t, err)
+	return Event{
+		Type:    eventType,
+		Subject: "env/dev",
+		Time:    time.Now().UTC(),
+		Data:    dataBytes,
+	}
+}
+
+func TestKubernetesEventSink(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	sink := NewKubernetesEventSink(
+		client.CoreV1(),
+		corev1.ObjectReference{
+			Kind:      "RenderRequest",
+			Namespace: "foo",
+			Name:      "bar",
+		},
+		"kargo-render",
+	)
+	ctx := context.Background()
+	require.NoError(
+		t,
+		sink.Send(
+			ctx,
+			newTestEvent(t, EventTypeRenderCompleted, Response{
+				ActionTaken: ActionTakenPushedDirectly,
+				CommitID:    "abc",
+			}),
+		),
+	)
+	require.NoError(
+		t,
+		sink.Send(
+			ctx,
+			newTestEvent(t, EventTypeRenderFailed, renderFailedEventData{
+				Error: "something went wrong",
+			}),
+		),
+	)
+	require.Error(t, sink.Send(ctx, Event{Type: "bogus"}))
+
+	events, err := client.CoreV1().Events("foo").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 2)
+	reasons := map[string]corev1.Event{}
+	for _, event := range events.Items {
+		require.Equal(t, "bar", event.InvolvedObject.Name)
+		require.Equal(t, "kargo-render", event.Source.Component)
+		reasons[event.Reason] = event
+	}
+	completed := reasons[ReasonRenderCompleted]
+	require.Equal(t, corev1.EventTypeNormal, completed.Type)
+	require.Contains(t, completed.Message, "commit: abc")
+	failed := reasons[ReasonRenderFailed]
+	require.Equal(t, corev1.EventTypeWarning, failed.Type)
+	require.Contains(t, failed.Message, "something went wrong")
+}
+
+func TestSetRenderConditions(t *testing.T) {
+	var conditions []metav1.Condition
+
+	started := newTestEvent(t, EventTypeRenderStarted, renderStartedEventData{})
+	require.NoError(t, SetRenderConditions(&conditions, started, 1))
+	require.Equal(
+		t,
+		metav1.ConditionUnknown,
+		meta.FindStatusCondition(conditions, ConditionTypeRendered).Status,
+	)
+	require.True(t, meta.IsStatusConditionFalse(conditions, ConditionTypeFailed))
+
+	failed := newTestEvent(t, EventTypeRenderFailed, renderFailedEventData{
+		Error: "something went wrong",
+	})
+	require.NoError(t, SetRenderConditions(&conditions, failed, 1))
+	require.True(t, meta.IsStatusConditionFalse(conditions, ConditionTypeRendered))
+	failedCondition := meta.FindStatusCondition(conditions, ConditionTypeFailed)
+	require.Equal(t, metav1.ConditionTrue, failedCondition.Status)
+	require.Equal(t, ReasonRenderFailed, failedCondition.Reason)
+	require.Contains(t, failedCondition.Message, "something went wrong")
+
+	// A retry succeeds
+	res := Response{
+		ActionTaken:    ActionTakenOpenedPR,
+		PullRequestURL: "https://github.com/akuity/foobar/pull/1",
+	}
+	for _, event := range []Event{
+		started,
+		newTestEvent(t, EventTypeRenderCompleted, res),
+		newTestEvent(t, EventTypePROpened, res),
+	} {
+		require.NoError(t, SetRenderConditions(&conditions, event, 2))
+	}
+	require.True(t, meta.IsStatusConditionTrue(conditions, ConditionTypeRendered))
+	require.True(t, meta.IsStatusConditionFalse(conditions, ConditionTypeFailed))
+	prOpened := meta.FindStatusCondition(conditions, ConditionTypePROpened)
+	require.Equal(t, metav1.ConditionTrue, prOpened.Status)
+	require.Contains(t, prOpened.Message, res.PullRequestURL)
+	for _, condition := range conditions {
+		require.Equal(t, int64(2), condition.ObservedGeneration)
+	}
+}
@@ -0,0 +1,259 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEventSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (f *fakeEventSink) Send(_ context.Context, event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeEventSink) types() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	types := make([]string, len(f.events))
+	for i, event := range f.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestWithEvents(t *testing.T) {
+	testCases := []struct {
+		name       string
+		res        Response
+		err        error
+		assertions func(*testing.T, *fakeEventSink, Response, error)
+	}{
+		{
+			name: "failure",
+			err:  errors.New("something went wrong"),
+			assertions: func(t *testing.T, sink *fakeEventSink, _ Response, err error) {
+				require.EqualError(t, err, "something went wrong")
+				require.Equal(
+					t,
+					[]string{EventTypeRenderStarted, EventTypeRenderFailed},
+					sink.types(),
+				)
+				data := renderFailedEventData{}
+				require.NoError(t, json.Unmarshal(sink.events[1].Data, &data))
+				require.Equal(t, "something went wrong", data.Error)
+			},
+		},
+		{
+			name: "pushed directly",
+			res: Response{
+				ActionTaken: ActionTakenPushedDirectly,
+				CommitID:    "abc",
+			},
+			assertions: func(t *testing.T, sink *fakeEventSink, res Response, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "abc", res.CommitID)
+				require.Equal(
+					t,
+					[]string{EventTypeRenderStarted, EventTypeRenderCompleted},
+					sink.types(),
+				)
+				for _, event := range sink.events {
+					require.Equal(t, cloudEventsSpecVersion, event.SpecVersion)
+					require.NotEmpty(t, event.ID)
+					require.Equal(t, "https://github.com/akuity/foobar", event.Source)
+					require.Equal(t, "env/dev", event.Subject)
+					require.Equal(t, "application/json", event.DataContentType)
+				}
+				data := Response{}
+				require.NoError(t, json.Unmarshal(sink.events[1].Data, &data))
+				require.Equal(t, "abc", data.CommitID)
+			},
+		},
+		{
+			name: "opened PR",
+			res: Response{
+				ActionTaken:    ActionTakenOpenedPR,
+				PullRequestURL: "https://github.com/akuity/foobar/pull/1",
+			},
+			assertions: func(t *testing.T, sink *fakeEventSink, _ Response, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]string{
+						EventTypeRenderStarted,
+						EventTypeRenderCompleted,
+						EventTypePROpened,
+					},
+					sink.types(),
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sink := &fakeEventSink{}
+			svc := &service{
+				logger:    log.New(),
+				eventSink: sink,
+			}
+			res, err := svc.withEvents(
+				context.Background(),
+				"https://github.com/akuity/foobar",
+				"env/dev",
+				func() (Response, error) {
+					return testCase.res, testCase.err
+				},
+			)
+			testCase.assertions(t, sink, res, err)
+		})
+	}
+}
+
+func TestHTTPEventSink(t *testing.T) {
+	var contentType string
+	var received Event
+	status := http.StatusAccepted
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(body, &received))
+			w.WriteHeader(status)
+		}),
+	)
+	defer server.Close()
+	sink := NewHTTPEventSink(server.URL, nil)
+
+	event := Event{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              "123",
+		Source:          "https://github.com/akuity/foobar",
+		Type:            EventTypeRenderStarted,
+		Subject:         "env/dev",
+		DataContentType: "application/json",
+		Data:            json.RawMessage(`{"targetBranch":"env/dev"}`),
+	}
+	require.NoError(t, sink.Send(context.Background(), event))
+	require.Equal(t, "application/cloudevents+json; charset=utf-8", contentType)
+	require.Equal(t, event.ID, received.ID)
+	require.Equal(t, event.Type, received.Type)
+	require.JSONEq(t, string(event.Data), string(received.Data))
+
+	status = http.StatusInternalServerError
+	err := sink.Send(context.Background(), event)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "500")
+}
+
+// blockingEventSink is an EventSink that doesn't finish sending any Event
+// until it's unblocked.
+type blockingEventSink struct {
+	fakeEventSink
+	unblock chan struct{}
+	err     error
+}
+
+func (b *blockingEventSink) Send(ctx context.Context, event Event) error {
+	<-b.unblock
+	if b.err != nil {
+		return b.err
+	}
+	return b.fakeEventSink.Send(ctx, event)
+}
+
+func TestAsyncEventSink(t *testing.T) {
+	t.Run("events are delivered in order", func(t *testing.T) {
+		sink := &blockingEventSink{unblock: make(chan struct{})}
+		asyncSink := NewAsyncEventSink(sink, 0)
+		for _, eventType := range []string{
+			EventTypeRenderStarted,
+			EventTypeRenderCompleted,
+		} {
+			require.NoError(
+				t,
+				asyncSink.Send(context.Background(), Event{Type: eventType}),
+			)
+		}
+		require.Empty(t, sink.types())
+		close(sink.unblock)
+		require.NoError(t, asyncSink.Flush(context.Background()))
+		require.Equal(
+			t,
+			[]string{EventTypeRenderStarted, EventTypeRenderCompleted},
+			sink.types(),
+		)
+	})
+
+	t.Run("events are dropped when the queue is full", func(t *testing.T) {
+		sink := &blockingEventSink{unblock: make(chan struct{})}
+		asyncSink := NewAsyncEventSink(sink, 1)
+		// The first event is taken off the queue for delivery, if not at once
+		require.NoError(t, asyncSink.Send(context.Background(), Event{}))
+		require.Eventually(
+			t,
+			func() bool {
+				return asyncSink.Send(context.Background(), Event{}) != nil
+			},
+			time.Second,
+			10*time.Millisecond,
+		)
+		close(sink.unblock)
+		require.NoError(t, asyncSink.Flush(context.Background()))
+		require.Len(t, sink.types(), 2)
+	})
+
+	t.Run("flushing returns delivery errors", func(t *testing.T) {
+		sink := &blockingEventSink{
+			unblock: make(chan struct{}),
+			err:     errors.New("something went wrong"),
+		}
+		asyncSink := NewAsyncEventSink(sink, 0)
+		require.NoError(t, asyncSink.Send(context.Background(), Event{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, asyncSink.Flush(ctx), context.DeadlineExceeded)
+		close(sink.unblock)
+		require.EqualError(
+			t,
+			asyncSink.Flush(context.Background()),
+			"something went wrong",
+		)
+		require.NoError(t, asyncSink.Flush(context.Background()))
+	})
+}
+
+func TestSlowEventSink(t *testing.T) {
+	sink := &blockingEventSink{unblock: make(chan struct{})}
+	defer close(sink.unblock)
+	svc := NewService(&ServiceOptions{EventSink: sink})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The request is invalid, so it fails without any rendering, but its
+		// failure is still news
+		_, err := svc.RenderManifests(context.Background(), &Request{})
+		require.Error(t, err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "rendering waited on the event sink")
+	}
+}
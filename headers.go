@@ -0,0 +1,69 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+)
+
+// fileHeader returns the comment to be prepended to every file of rendered
+// manifests written for the named app, expanded from the target branch's
+// FileHeader template. In the template, ${app}, ${branch}, ${commit}, and
+// ${shortCommit} are replaced with the name of the app, the name of the target
+// branch, and the full and abbreviated IDs of the source commit. Placeholders
+// of the form ${var:name} were already replaced with request variables when
+// the branch's configuration was loaded.
+// Every line of the result is made a YAML comment, if it isn't one already. If
+// the branch has no FileHeader, nil is returned.
+func fileHeader(rc requestContext, appName string) []byte {
+	template := rc.target.branchConfig.FileHeader
+	if template == "" {
+		return nil
+	}
+	shortCommit := rc.source.commit
+	if len(shortCommit) > 7 {
+		shortCommit = shortCommit[:7]
+	}
+	header := strings.NewReplacer(
+		"${app}", appName,
+		"${branch}", rc.request.TargetBranch,
+		"${commit}", rc.source.commit,
+		"${shortCommit}", shortCommit,
+	).Replace(template)
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(header, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			sb.WriteString(line)
+		case strings.TrimSpace(line) == "":
+			sb.WriteString("#")
+		default:
+			sb.WriteString("# ")
+			sb.WriteString(line)
+		}
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+// withHeader returns the provided manifests preceded by the provided header,
+// which may be nil.
+func withHeader(header []byte, manifests []byte) []byte {
+	if len(header) == 0 {
+		return manifests
+	}
+	return append(append(make([]byte, 0, len(header)+len(manifests)), header...), manifests...)
+}
+
+// stripHeader returns the provided manifests without the comment lines, if
+// any, at their very beginning, so that manifests can be compared regardless
+// of the headers prepended to them.
+func stripHeader(manifests []byte) []byte {
+	for bytes.HasPrefix(manifests, []byte("#")) {
+		i := bytes.IndexByte(manifests, '\n')
+		if i < 0 {
+			return nil
+		}
+		manifests = manifests[i+1:]
+	}
+	return manifests
+}
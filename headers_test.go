@@ -0,0 +1,35 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHeader(t *testing.T) {
+	rc := requestContext{
+		request: &Request{
+			TargetBranch: "env/prod",
+		},
+		source: sourceContext{commit: "0123456789abcdef"},
+	}
+	require.Nil(t, fileHeader(rc, "foo"))
+
+	rc.target.branchConfig.FileHeader = "GENERATED by Kargo Render from ${shortCommit} -- do not edit\n" +
+		"\n" +
+		"# app ${app} in ${branch} (${commit}) owned by platform\n"
+	require.Equal(
+		t,
+		"# GENERATED by Kargo Render from 0123456 -- do not edit\n"+
+			"#\n"+
+			"# app foo in env/prod (0123456789abcdef) owned by platform\n",
+		string(fileHeader(rc, "foo")),
+	)
+}
+
+func TestStripHeader(t *testing.T) {
+	manifests := []byte("kind: Service\n# not a header\n")
+	require.Equal(t, manifests, stripHeader(withHeader([]byte("# one\n#\n# two\n"), manifests)))
+	require.Equal(t, manifests, stripHeader(manifests))
+	require.Empty(t, stripHeader([]byte("# only a comment")))
+}
@@ -0,0 +1,35 @@
+package render
+
+import (
+	"context"
+)
+
+// getSourceHistory returns a SourceHistory describing the commits to the
+// source branch since the target branch was previously rendered. If the target
+// branch has never been rendered, or the commit it was previously rendered
+// from no longer exists, as can happen when the source branch's history is
+// rewritten, nil is returned.
+func getSourceHistory(
+	ctx context.Context,
+	rc requestContext,
+) *SourceHistory {
+	prevCommit := rc.target.oldBranchMetadata.SourceCommit
+	if prevCommit == "" {
+		return nil
+	}
+	commits, err := rc.repo.CommitMessages(ctx, prevCommit, rc.source.commit)
+	if err != nil {
+		rc.logger.WithError(err).WithField("previousSourceCommit", prevCommit).
+			Warn("error getting commits since target branch was previously rendered")
+		return nil
+	}
+	history := &SourceHistory{
+		PreviousSourceCommit: prevCommit,
+		CommitCount:          len(commits),
+	}
+	if memberCommits := rc.target.branchConfig.MemberCommits; memberCommits != nil &&
+		len(commits) > 0 {
+		history.Commits = commits[:min(len(commits), memberCommits.limit())]
+	}
+	return history
+}
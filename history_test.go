@@ -0,0 +1,128 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// fakeHistoryRepo is a git.Repo whose history consists of the specified
+// commits, oldest first.
+type fakeHistoryRepo struct {
+	git.Repo
+	commits []string
+}
+
+func (f *fakeHistoryRepo) CommitMessages(
+	_ context.Context,
+	id1 string,
+	id2 string,
+) ([]string, error) {
+	start, end := -1, -1
+	for i, id := range f.commits {
+		if id == id1 {
+			start = i
+		}
+		if id == id2 {
+			end = i
+		}
+	}
+	if start < 0 || end < 0 {
+		return nil, errors.New("unknown commit")
+	}
+	msgs := []string{}
+	for i := end; i > start; i-- {
+		msgs = append(msgs, fmt.Sprintf("%s commit %d", f.commits[i], i))
+	}
+	return msgs, nil
+}
+
+func TestGetSourceHistory(t *testing.T) {
+	repo := &fakeHistoryRepo{commits: []string{"a", "b", "c", "d"}}
+	testCases := []struct {
+		name          string
+		prevCommit    string
+		memberCommits *memberCommitsConfig
+		assertions    func(*testing.T, *SourceHistory)
+	}{
+		{
+			name: "never rendered",
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Nil(t, history)
+			},
+		},
+		{
+			name:       "previous commit no longer exists",
+			prevCommit: "z",
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Nil(t, history)
+			},
+		},
+		{
+			name:       "member commits not listed",
+			prevCommit: "a",
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Equal(
+					t,
+					&SourceHistory{PreviousSourceCommit: "a", CommitCount: 3},
+					history,
+				)
+			},
+		},
+		{
+			name:          "member commits listed",
+			prevCommit:    "b",
+			memberCommits: &memberCommitsConfig{},
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Equal(
+					t,
+					&SourceHistory{
+						PreviousSourceCommit: "b",
+						CommitCount:          2,
+						Commits:              []string{"d commit 3", "c commit 2"},
+					},
+					history,
+				)
+			},
+		},
+		{
+			name:          "member commits capped",
+			prevCommit:    "a",
+			memberCommits: &memberCommitsConfig{Max: 1},
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Equal(t, 3, history.CommitCount)
+				require.Equal(t, []string{"d commit 3"}, history.Commits)
+			},
+		},
+		{
+			name:          "rendered from same commit",
+			prevCommit:    "d",
+			memberCommits: &memberCommitsConfig{},
+			assertions: func(t *testing.T, history *SourceHistory) {
+				require.Equal(
+					t,
+					&SourceHistory{PreviousSourceCommit: "d"},
+					history,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				logger: log.NewEntry(log.New()),
+				repo:   repo,
+			}
+			rc.source.commit = "d"
+			rc.target.oldBranchMetadata.SourceCommit = testCase.prevCommit
+			rc.target.branchConfig.MemberCommits = testCase.memberCommits
+			testCase.assertions(t, getSourceHistory(context.Background(), rc))
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is the outcome of a rendering request, recorded under the
+// request's idempotency key.
+type IdempotencyRecord struct {
+	// RequestDigest is a digest of the request, excluding its credentials,
+	// that produced Response. It is used to detect the reuse of an idempotency
+	// key for a different request.
+	RequestDigest string `json:"requestDigest"`
+	// Response is the Response to the request.
+	Response Response `json:"response"`
+}
+
+// IdempotencyStore is an interface for components that can durably record the
+// outcomes of rendering requests, indexed by idempotency key.
+type IdempotencyStore interface {
+	// Get returns the record stored under the specified key. A nil record is
+	// returned if no such record exists.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// Put stores the provided record under the specified key.
+	Put(ctx context.Context, key string, record IdempotencyRecord) error
+}
+
+// idempotentService is a Service implementation that decorates another
+// Service, ensuring that rendering requests bearing an idempotency key that
+// has already been handled successfully are not handled again.
+type idempotentService struct {
+	svc      Service
+	store    IdempotencyStore
+	mu       sync.Mutex
+	inFlight map[string]chan struct{}
+}
+
+// NewIdempotentService returns an implementation of the Service interface that
+// decorates the provided Service. When a rendering request specifies an
+// IdempotencyKey, and the provided store already holds the outcome of a
+// successful request with the same key, the original Response is returned
+// without handling the request again. This prevents clients that time out and
+// retry from creating duplicate commits or PRs. Concurrent requests with the
+// same key are handled one at a time. Failed requests are not recorded, so
+// they may be retried using the same key. Reusing a key for a different
+// request is an error.
+func NewIdempotentService(svc Service, store IdempotencyStore) Service {
+	return &idempotentService{
+		svc:      svc,
+		store:    store,
+		inFlight: map[string]chan struct{}{},
+	}
+}
+
+// Plan creates a plan using the decorated Service. Creating a plan has no side
+// effects, so idempotency keys are not honored.
+func (i *idempotentService) Plan(ctx context.Context, req *Request) (Plan, error) {
+	return i.svc.Plan(ctx, req)
+}
+
+// Apply applies a plan using the decorated Service. A plan cannot be applied
+// twice, since applying it changes the branches it applies to, so idempotency
+// keys are not needed.
+func (i *idempotentService) Apply(
+	ctx context.Context,
+	req *ApplyRequest,
+) (Response, error) {
+	return i.svc.Apply(ctx, req)
+}
+
+// WarmUp warms up the decorated Service. Warming up has no effect on any
+// branch, so idempotency keys are not needed.
+func (i *idempotentService) WarmUp(
+	ctx context.Context,
+	req *WarmUpRequest,
+) (WarmUpResponse, error) {
+	return i.svc.WarmUp(ctx, req)
+}
+
+// RenderWorkspace renders a workspace using the decorated Service. Rendering a
+// workspace has no effect on any remote branch, so idempotency keys are not
+// needed.
+func (i *idempotentService) RenderWorkspace(
+	ctx context.Context,
+	req *WorkspaceRequest,
+) (WorkspaceResponse, error) {
+	return i.svc.RenderWorkspace(ctx, req)
+}
+
+// NewPipeline returns a Pipeline from the decorated Service. The caller decides
+// whether and when the Pipeline publishes anything, so idempotency keys are not
+// honored and callers must avoid publishing the same request twice themselves.
+func (i *idempotentService) NewPipeline(req *Request) (*Pipeline, error) {
+	return i.svc.NewPipeline(req)
+}
+
+func (i *idempotentService) RenderManifests(
+	ctx context.Context,
+	req *Request,
+) (Response, error) {
+	key := strings.TrimSpace(req.IdempotencyKey)
+	if key == "" {
+		return i.svc.RenderManifests(ctx, req)
+	}
+	// Keys are namespaced by tenant, so tenants that happen to choose the same
+	// key neither wait for nor learn of each other's requests
+	storeKey := key
+	if req.Tenant != "" {
+		storeKey = req.Tenant + "/" + key
+	}
+
+	release, err := i.acquire(ctx, storeKey)
+	if err != nil {
+		return Response{}, err
+	}
+	defer release()
+
+	digest, err := requestDigest(req)
+	if err != nil {
+		return Response{}, err
+	}
+	record, err := i.store.Get(ctx, storeKey)
+	if err != nil {
+		return Response{}, fmt.Errorf(
+			"error retrieving record for idempotency key %q: %w",
+			key,
+			err,
+		)
+	}
+	if record != nil {
+		if record.RequestDigest != digest {
+			return Response{}, &IdempotencyKeyConflictError{Key: key}
+		}
+		return record.Response, nil
+	}
+
+	res, err := i.svc.RenderManifests(ctx, req)
+	if err != nil {
+		return res, err
+	}
+	if err = i.store.Put(
+		ctx,
+		storeKey,
+		IdempotencyRecord{
+			RequestDigest: digest,
+			Response:      res,
+		},
+	); err != nil {
+		return res, fmt.Errorf(
+			"error storing record for idempotency key %q: %w",
+			key,
+			err,
+		)
+	}
+	return res, nil
+}
+
+// acquire blocks until no other request with the specified idempotency key is
+// in flight or the provided context is canceled. It returns a function that
+// must be called once the caller's request is no longer in flight.
+func (i *idempotentService) acquire(
+	ctx context.Context,
+	key string,
+) (func(), error) {
+	for {
+		i.mu.Lock()
+		done, ok := i.inFlight[key]
+		if !ok {
+			done = make(chan struct{})
+			i.inFlight[key] = done
+			i.mu.Unlock()
+			return func() {
+				i.mu.Lock()
+				delete(i.inFlight, key)
+				i.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		i.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// requestDigest returns a digest of the provided request, excluding its
+// credentials, idempotency key, and ID, which differs between retries unless
+// the client specifies it.
+func requestDigest(req *Request) (string, error) {
+	r := *req
+	r.RepoCreds = RepoCredentials{}
+	r.IdempotencyKey = ""
+	r.ID = ""
+	reqBytes, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+	sum := sha256.Sum256(reqBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// inMemoryIdempotencyStore is an IdempotencyStore implementation that keeps
+// records in memory for a limited time.
+type inMemoryIdempotencyStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	records map[string]inMemoryIdempotencyRecord
+}
+
+type inMemoryIdempotencyRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// NewInMemoryIdempotencyStore returns an implementation of the
+// IdempotencyStore interface that keeps records in memory for the specified
+// amount of time. Records do not survive a restart and are not shared between
+// processes, so this is suitable only for a single, long-running process.
+func NewInMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &inMemoryIdempotencyStore{
+		ttl:     ttl,
+		records: map[string]inMemoryIdempotencyRecord{},
+	}
+}
+
+func (i *inMemoryIdempotencyStore) Get(
+	_ context.Context,
+	key string,
+) (*IdempotencyRecord, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	r, ok := i.records[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(r.expires) {
+		delete(i.records, key)
+		return nil, nil
+	}
+	return &r.record, nil
+}
+
+func (i *inMemoryIdempotencyStore) Put(
+	_ context.Context,
+	key string,
+	record IdempotencyRecord,
+) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := time.Now()
+	// Opportunistically evict expired records
+	for k, r := range i.records {
+		if now.After(r.expires) {
+			delete(i.records, k)
+		}
+	}
+	i.records[key] = inMemoryIdempotencyRecord{
+		record:  record,
+		expires: now.Add(i.ttl),
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentService(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	svc := NewIdempotentService(
+		&mockService{
+			renderFn: func(_ context.Context, req *Request) (Response, error) {
+				calls.Add(1)
+				if fail.Load() {
+					return Response{}, errors.New("something went wrong")
+				}
+				// Simulate a slow render so concurrent requests overlap
+				time.Sleep(50 * time.Millisecond)
+				return Response{CommitID: req.Ref}, nil
+			},
+		},
+		NewInMemoryIdempotencyStore(time.Hour),
+	)
+
+	t.Run("requests without a key are always handled", func(t *testing.T) {
+		calls.Store(0)
+		for i := 0; i < 2; i++ {
+			_, err := svc.RenderManifests(
+				context.Background(),
+				&Request{TargetBranch: "env/dev"},
+			)
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("retried requests return the original response", func(t *testing.T) {
+		calls.Store(0)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						// Each attempt may have a different ID
+						ID:             fmt.Sprintf("attempt-%d", i),
+						TargetBranch:   "env/dev",
+						Ref:            "abc",
+						IdempotencyKey: "retried",
+						RepoCreds:      RepoCredentials{Password: "rotated"},
+					},
+				)
+				require.NoError(t, err)
+				require.Equal(t, "abc", res.CommitID)
+			}(i)
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("key reused for a different request", func(t *testing.T) {
+		_, err := svc.RenderManifests(
+			context.Background(),
+			&Request{
+				TargetBranch:   "env/dev",
+				Ref:            "def",
+				IdempotencyKey: "retried",
+			},
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "already used for a different request")
+	})
+
+	t.Run("tenants using the same key don't collide", func(t *testing.T) {
+		// Each render waits for the other to start, so they fail unless they
+		// are handled concurrently
+		var started sync.WaitGroup
+		started.Add(2)
+		svc := NewIdempotentService(
+			&mockService{
+				renderFn: func(_ context.Context, req *Request) (Response, error) {
+					started.Done()
+					allStarted := make(chan struct{})
+					go func() {
+						started.Wait()
+						close(allStarted)
+					}()
+					select {
+					case <-allStarted:
+					case <-time.After(5 * time.Second):
+						return Response{}, errors.New("renders were serialized")
+					}
+					return Response{CommitID: req.Tenant + "-" + req.Ref}, nil
+				},
+			},
+			NewInMemoryIdempotencyStore(time.Hour),
+		)
+		wg := sync.WaitGroup{}
+		for _, tenant := range []string{"foo", "bar"} {
+			wg.Add(1)
+			go func(tenant string) {
+				defer wg.Done()
+				res, err := svc.RenderManifests(
+					context.Background(),
+					&Request{
+						TargetBranch:   "env/dev",
+						Ref:            tenant + "-ref",
+						IdempotencyKey: "shared",
+						Tenant:         tenant,
+					},
+				)
+				require.NoError(t, err)
+				require.Equal(t, tenant+"-"+tenant+"-ref", res.CommitID)
+			}(tenant)
+		}
+		wg.Wait()
+	})
+
+	t.Run("failed requests can be retried", func(t *testing.T) {
+		calls.Store(0)
+		req := Request{
+			TargetBranch:   "env/dev",
+			Ref:            "abc",
+			IdempotencyKey: "failed",
+		}
+		fail.Store(true)
+		_, err := svc.RenderManifests(context.Background(), &req)
+		require.Error(t, err)
+		fail.Store(false)
+		res, err := svc.RenderManifests(context.Background(), &req)
+		require.NoError(t, err)
+		require.Equal(t, "abc", res.CommitID)
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestInMemoryIdempotencyStore(t *testing.T) {
+	store := NewInMemoryIdempotencyStore(50 * time.Millisecond)
+	record, err := store.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	require.Nil(t, record)
+	err = store.Put(
+		context.Background(),
+		"foo",
+		IdempotencyRecord{Response: Response{CommitID: "abc"}},
+	)
+	require.NoError(t, err)
+	record, err = store.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	require.Equal(t, "abc", record.Response.CommitID)
+	time.Sleep(100 * time.Millisecond)
+	record, err = store.Get(context.Background(), "foo")
+	require.NoError(t, err)
+	require.Nil(t, record)
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignoreFilePath is the path, relative to the root of a target branch, of an
+// optional file, in gitignore syntax, listing paths that Kargo Render should
+// neither clean nor consider when determining whether rendering has changed
+// anything. Because it lives in the target branch, it can be maintained by the
+// owners of an environment without changes to the source repository.
+const ignoreFilePath = ".kargo-render/ignore"
+
+// ignoreRules are the rules parsed from a target branch's ignore file.
+type ignoreRules struct {
+	dir     string
+	matcher gitignore.Matcher
+}
+
+// loadIgnoreRules loads ignore rules from the ignore file, if any, in the
+// specified directory. If no ignore file exists, nil is returned.
+func loadIgnoreRules(dir string) (*ignoreRules, error) {
+	fileBytes, err := os.ReadFile(filepath.Join(dir, ignoreFilePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newIgnoreRules(dir, lines), nil
+}
+
+// newIgnoreRules returns ignore rules for the specified directory parsed from
+// the provided lines in gitignore syntax. Blank lines and comments are
+// disregarded. If no rules remain, nil is returned.
+func newIgnoreRules(dir string, lines []string) *ignoreRules {
+	var patterns []gitignore.Pattern
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return &ignoreRules{
+		dir:     dir,
+		matcher: gitignore.NewMatcher(patterns),
+	}
+}
+
+// matches returns true if the specified path, or any directory containing it,
+// is matched by the ignore rules. The path MUST be absolute. Calling this
+// method on nil ignore rules always returns false.
+func (i *ignoreRules) matches(path string, isDir bool) bool {
+	if i == nil {
+		return false
+	}
+	relPath, err := filepath.Rel(i.dir, path)
+	if err != nil || !filepath.IsLocal(relPath) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	// As with git, nothing within an ignored directory can be un-ignored
+	for j := 1; j < len(parts); j++ {
+		if i.matcher.Match(parts[:j], true) {
+			return true
+		}
+	}
+	return i.matcher.Match(parts, isDir)
+}
@@ -0,0 +1,66 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIgnoreRules(t *testing.T) {
+	t.Run("no ignore file", func(t *testing.T) {
+		ignore, err := loadIgnoreRules(t.TempDir())
+		require.NoError(t, err)
+		require.Nil(t, ignore)
+		require.False(t, ignore.matches("/foo", false))
+	})
+
+	t.Run("ignore file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(
+			t,
+			os.MkdirAll(filepath.Join(dir, ".kargo-render"), 0755),
+		)
+		require.NoError(
+			t,
+			os.WriteFile(
+				filepath.Join(dir, ignoreFilePath),
+				[]byte(`# Maintained by the platform team
+/docs/
+*.md
+!KEEP.md
+
+generated/**/secret.yaml
+`),
+				0600,
+			),
+		)
+		ignore, err := loadIgnoreRules(dir)
+		require.NoError(t, err)
+		require.NotNil(t, ignore)
+		testCases := []struct {
+			path    string
+			isDir   bool
+			matches bool
+		}{
+			{path: "docs", isDir: true, matches: true},
+			{path: "docs/index.html", matches: true},
+			{path: "apps/docs", matches: false},
+			{path: "README.md", matches: true},
+			{path: "apps/README.md", matches: true},
+			{path: "KEEP.md", matches: false},
+			{path: "generated/foo/bar/secret.yaml", matches: true},
+			{path: "generated/foo/bar/config.yaml", matches: false},
+			{path: "apps/foo/deployment.yaml", matches: false},
+		}
+		for _, testCase := range testCases {
+			require.Equal(
+				t,
+				testCase.matches,
+				ignore.matches(filepath.Join(dir, testCase.path), testCase.isDir),
+				testCase.path,
+			)
+		}
+	})
+}
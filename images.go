@@ -0,0 +1,199 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/internal/manifests"
+	libStrings "github.com/akuity/kargo-render/internal/strings"
+)
+
+// imageName returns the name of the image identified by the provided image
+// reference, i.e. the reference minus any tag or digest.
+func imageName(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// imagesByName indexes the provided images, each of the form <name>:<tag>, by
+// name.
+func imagesByName(images []string) map[string]string {
+	byName := make(map[string]string, len(images))
+	for _, image := range images {
+		addr, _, _ := libStrings.SplitLast(image, ":")
+		byName[addr] = image
+	}
+	return byName
+}
+
+// substituteImageFields substitutes the provided images, each of the form
+// <name>:<tag>, into every field of every resource in the provided manifest
+// that is identified by any of the provided rules and holds a reference to an
+// image of the same name. Resources with no such fields are left untouched.
+func substituteImageFields(
+	manifest []byte,
+	rules []imageFieldRule,
+	images []string,
+) ([]byte, error) {
+	if len(rules) == 0 || len(images) == 0 {
+		return manifest, nil
+	}
+	newRefs := imagesByName(images)
+	resources, err := manifests.SplitYAMLResources(manifest)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([][]byte, len(resources))
+	for i, resource := range resources {
+		docs[i] = resource.Manifest
+		var obj map[string]any
+		var changed bool
+		for _, rule := range rules {
+			if !rule.matches(resource.Kind) {
+				continue
+			}
+			if obj == nil {
+				if err = yaml.Unmarshal(resource.Manifest, &obj); err != nil {
+					return nil, fmt.Errorf("error unmarshaling resource: %w", err)
+				}
+			}
+			// Rules were already validated when the configuration was loaded
+			fieldPaths, _ := rule.fieldPaths()
+			for _, fieldPath := range fieldPaths {
+				fieldPath.Update(obj, func(value any) any {
+					ref, ok := value.(string)
+					if !ok {
+						return value
+					}
+					if newRef, ok := newRefs[imageName(ref)]; ok && newRef != ref {
+						changed = true
+						return newRef
+					}
+					return value
+				})
+			}
+		}
+		if changed {
+			if docs[i], err = yaml.Marshal(obj); err != nil {
+				return nil, fmt.Errorf("error marshaling resource: %w", err)
+			}
+		}
+	}
+	return manifests.CombineYAML(docs), nil
+}
+
+// imageReferences returns the distinct image references, in sorted order,
+// held by the images of containers of resources in the provided manifest and
+// by the fields of those resources that are identified by the provided rules.
+func imageReferences(manifest []byte, rules []imageFieldRule) ([]string, error) {
+	refs, err := manifests.ImageReferences(manifest)
+	if err != nil || len(rules) == 0 {
+		return refs, err
+	}
+	resources, err := manifests.SplitYAMLResources(manifest)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(refs))
+	for _, ref := range refs {
+		seen[ref] = struct{}{}
+	}
+	for _, resource := range resources {
+		var obj map[string]any
+		for _, rule := range rules {
+			if !rule.matches(resource.Kind) {
+				continue
+			}
+			if obj == nil {
+				if err = yaml.Unmarshal(resource.Manifest, &obj); err != nil {
+					return nil, fmt.Errorf("error unmarshaling resource: %w", err)
+				}
+			}
+			fieldPaths, _ := rule.fieldPaths()
+			for _, fieldPath := range fieldPaths {
+				for _, value := range fieldPath.Values(obj) {
+					if ref, ok := value.(string); ok && ref != "" {
+						if _, ok = seen[ref]; !ok {
+							seen[ref] = struct{}{}
+							refs = append(refs, ref)
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// getImageSubstitutions returns, for every app, the image references in its
+// pre-rendered manifests for which one of the provided images, which are those
+// incorporated during last-mile rendering, was substituted. This includes
+// references held by fields identified by the target branch's imageFields
+// rules. Apps are examined in order by name. It also returns any images
+// specified by the request that did not match any image referenced by any
+// app, unless the request requires every image to match, in which case an
+// UnmatchedImagesError is returned instead.
+func getImageSubstitutions(
+	rc requestContext,
+	images []string,
+) ([]ImageSubstitution, []string, error) {
+	newRefs := imagesByName(images)
+	appNames := make([]string, 0, len(rc.target.prerenderedManifests))
+	for appName := range rc.target.prerenderedManifests {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	var subs []ImageSubstitution
+	matched := map[string]struct{}{}
+	for _, appName := range appNames {
+		refs, err := imageReferences(
+			rc.target.prerenderedManifests[appName],
+			rc.target.branchConfig.ImageFields,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"error finding images referenced by app %q: %w",
+				appName,
+				err,
+			)
+		}
+		for _, ref := range refs {
+			name := imageName(ref)
+			newRef, ok := newRefs[name]
+			if !ok {
+				continue
+			}
+			matched[name] = struct{}{}
+			if newRef != ref {
+				subs = append(
+					subs,
+					ImageSubstitution{
+						App: appName,
+						Old: ref,
+						New: newRef,
+					},
+				)
+			}
+		}
+	}
+	var unmatched []string
+	for _, image := range rc.request.Images {
+		addr, _, _ := libStrings.SplitLast(image, ":")
+		if _, ok := matched[addr]; !ok {
+			unmatched = append(unmatched, image)
+		}
+	}
+	if len(unmatched) > 0 && rc.request.RequireImageMatches {
+		return nil, nil, &UnmatchedImagesError{Images: unmatched}
+	}
+	return subs, unmatched, nil
+}
@@ -0,0 +1,237 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageName(t *testing.T) {
+	testCases := map[string]string{
+		"nginx":                           "nginx",
+		"nginx:1.25":                      "nginx",
+		"example.com:5000/foo":            "example.com:5000/foo",
+		"example.com:5000/foo:v1.0.0":     "example.com:5000/foo",
+		"example.com/foo@sha256:abc":      "example.com/foo",
+		"example.com/foo:v1.0.0@sha256:1": "example.com/foo",
+	}
+	for ref, expected := range testCases {
+		t.Run(ref, func(t *testing.T) {
+			require.Equal(t, expected, imageName(ref))
+		})
+	}
+}
+
+func TestGetImageSubstitutions(t *testing.T) {
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: example.com/foo:v1.0.0
+      - name: bar
+        image: example.com/bar:v2.0.0
+`
+	testCases := []struct {
+		name                 string
+		requestImages        []string
+		requireImageMatches  bool
+		imageFields          []imageFieldRule
+		images               []string
+		prerenderedManifests map[string][]byte
+		assertions           func(*testing.T, []ImageSubstitution, []string, error)
+	}{
+		{
+			name: "invalid manifests",
+			prerenderedManifests: map[string][]byte{
+				"foo": []byte("kind: ["),
+			},
+			assertions: func(t *testing.T, _ []ImageSubstitution, _ []string, err error) {
+				require.ErrorContains(t, err, `app "foo"`)
+			},
+		},
+		{
+			name:          "success",
+			requestImages: []string{"example.com/foo:v1.1.0", "example.com/baz:v3.0.0"},
+			images: []string{
+				// Substituted by an earlier request and unchanged since
+				"example.com/bar:v2.0.0",
+				"example.com/baz:v3.0.0",
+				"example.com/foo:v1.1.0",
+			},
+			prerenderedManifests: map[string][]byte{
+				"b": []byte(deployment),
+				"a": []byte(deployment),
+			},
+			assertions: func(
+				t *testing.T,
+				subs []ImageSubstitution,
+				unmatched []string,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]ImageSubstitution{
+						{
+							App: "a",
+							Old: "example.com/foo:v1.0.0",
+							New: "example.com/foo:v1.1.0",
+						},
+						{
+							App: "b",
+							Old: "example.com/foo:v1.0.0",
+							New: "example.com/foo:v1.1.0",
+						},
+					},
+					subs,
+				)
+				require.Equal(t, []string{"example.com/baz:v3.0.0"}, unmatched)
+			},
+		},
+		{
+			name:          "image fields",
+			requestImages: []string{"example.com/foo:v1.1.0"},
+			imageFields: []imageFieldRule{
+				{Kind: "Canary", JSONPaths: []string{".spec.image"}},
+			},
+			images: []string{"example.com/foo:v1.1.0"},
+			prerenderedManifests: map[string][]byte{
+				"a": []byte(`apiVersion: flagger.app/v1beta1
+kind: Canary
+metadata:
+  name: foo
+spec:
+  image: example.com/foo:v1.0.0
+`),
+			},
+			assertions: func(
+				t *testing.T,
+				subs []ImageSubstitution,
+				unmatched []string,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]ImageSubstitution{{
+						App: "a",
+						Old: "example.com/foo:v1.0.0",
+						New: "example.com/foo:v1.1.0",
+					}},
+					subs,
+				)
+				require.Empty(t, unmatched)
+			},
+		},
+		{
+			name:                "unmatched images when matches are required",
+			requestImages:       []string{"example.com/foo:v1.1.0", "example.com/baz:v3.0.0"},
+			requireImageMatches: true,
+			images:              []string{"example.com/baz:v3.0.0", "example.com/foo:v1.1.0"},
+			prerenderedManifests: map[string][]byte{
+				"a": []byte(deployment),
+			},
+			assertions: func(t *testing.T, _ []ImageSubstitution, _ []string, err error) {
+				var unmatchedErr *UnmatchedImagesError
+				require.ErrorAs(t, err, &unmatchedErr)
+				require.Equal(t, []string{"example.com/baz:v3.0.0"}, unmatchedErr.Images)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				request: &Request{
+					Images:              testCase.requestImages,
+					RequireImageMatches: testCase.requireImageMatches,
+				},
+			}
+			rc.target.branchConfig.ImageFields = testCase.imageFields
+			rc.target.prerenderedManifests = testCase.prerenderedManifests
+			subs, unmatched, err := getImageSubstitutions(rc, testCase.images)
+			testCase.assertions(t, subs, unmatched, err)
+		})
+	}
+}
+
+func TestSubstituteImageFields(t *testing.T) {
+	const manifest = `apiVersion: flagger.app/v1beta1
+kind: Canary
+metadata:
+  name: foo
+spec:
+  image: example.com/foo:v1.0.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: IMAGE
+          value: example.com/bar:v1.0.0
+        - name: MODE
+          value: fast
+        image: example.com/foo:v1.1.0
+        name: foo
+`
+	rules := []imageFieldRule{
+		{Kind: "Canary", JSONPaths: []string{".spec.image"}},
+		{
+			Kind:      "Deployment",
+			JSONPaths: []string{".spec.template.spec.containers[*].env[*].value"},
+		},
+	}
+	images := []string{"example.com/foo:v1.1.0", "example.com/bar:v2.0.0"}
+
+	t.Run("no rules", func(t *testing.T) {
+		result, err := substituteImageFields([]byte(manifest), nil, images)
+		require.NoError(t, err)
+		require.Equal(t, manifest, string(result))
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		_, err := substituteImageFields([]byte("kind: ["), rules, images)
+		require.Error(t, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		result, err := substituteImageFields([]byte(manifest), rules, images)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			`apiVersion: flagger.app/v1beta1
+kind: Canary
+metadata:
+  name: foo
+spec:
+  image: example.com/foo:v1.1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: IMAGE
+          value: example.com/bar:v2.0.0
+        - name: MODE
+          value: fast
+        image: example.com/foo:v1.1.0
+        name: foo
+`,
+			string(result),
+		)
+	})
+}
@@ -3,8 +3,11 @@ package argocd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/argo-cd/v2/reposerver/apiclient"
@@ -12,6 +15,7 @@ import (
 	"github.com/argoproj/argo-cd/v2/util/git"
 	"k8s.io/apimachinery/pkg/api/resource"
 
+	libExec "github.com/akuity/kargo-render/internal/exec"
 	"github.com/akuity/kargo-render/internal/file"
 	"github.com/akuity/kargo-render/internal/manifests"
 )
@@ -36,6 +40,46 @@ type ApplicationSourceHelm struct {
 
 	RepoURL string `json:"repoURL,omitempty"`
 	Chart   string `json:"chart,omitempty"`
+
+	// CRDs specifies what to do with the CustomResourceDefinitions in the
+	// crds/ directories of the chart and its dependencies: CRDsInclude,
+	// CRDsSkip, or CRDsSeparate. If not specified, they are included.
+	CRDs string `json:"crds,omitempty"`
+	// CRDsOutputPath is the subdirectory of the app's output path to which
+	// CustomResourceDefinitions are written when CRDs is CRDsSeparate. If not
+	// specified, this defaults to DefaultCRDsOutputPath.
+	CRDsOutputPath string `json:"crdsOutputPath,omitempty"`
+}
+
+// Values of the CRDs field of ApplicationSourceHelm.
+const (
+	// CRDsInclude includes CustomResourceDefinitions with the rest of a chart's
+	// manifests, as helm template --include-crds does.
+	CRDsInclude = "include"
+	// CRDsSkip leaves CustomResourceDefinitions out, as helm template does
+	// without --include-crds.
+	CRDsSkip = "skip"
+	// CRDsSeparate includes CustomResourceDefinitions, but writes them to a
+	// dedicated subdirectory of the app's output path.
+	CRDsSeparate = "separate"
+)
+
+// DefaultCRDsOutputPath is the subdirectory of an app's output path to which
+// CustomResourceDefinitions are written when they are separated from the rest
+// of a chart's manifests and no other subdirectory is specified.
+const DefaultCRDsOutputPath = "crds"
+
+// CRDsOutput returns the subdirectory of an app's output path to which
+// CustomResourceDefinitions are written, or the empty string if they are not
+// separated from the rest of the app's manifests.
+func (h *ApplicationSourceHelm) CRDsOutput() string {
+	if h == nil || h.CRDs != CRDsSeparate {
+		return ""
+	}
+	if h.CRDsOutputPath == "" {
+		return DefaultCRDsOutputPath
+	}
+	return h.CRDsOutputPath
 }
 
 // ApplicationSourceKustomize holds configuration for Kustomize-based
@@ -45,28 +89,50 @@ type ApplicationSourceKustomize struct {
 	BuildOptions string `json:"buildOptions,omitempty"`
 }
 
-func expand(item map[string]any, values []string) {
+func expand(item map[string]any, values []string, vars map[string]string) error {
 	for k, v := range item {
 		switch value := v.(type) {
 		case string:
-			item[k] = file.ExpandPath(value, values)
+			expanded, err := expandString(value, values, vars)
+			if err != nil {
+				return fmt.Errorf("error expanding %s: %w", k, err)
+			}
+			item[k] = expanded
 		case map[string]any:
-			expand(value, values)
+			if err := expand(value, values, vars); err != nil {
+				return fmt.Errorf("error expanding %s: %w", k, err)
+			}
 		case []any:
 			for i, v := range value {
 				switch v := v.(type) {
 				case string:
-					value[i] = file.ExpandPath(v, values)
+					expanded, err := expandString(v, values, vars)
+					if err != nil {
+						return fmt.Errorf("error expanding %s[%d]: %w", k, i, err)
+					}
+					value[i] = expanded
 				case map[string]any:
-					expand(v, values)
+					if err := expand(v, values, vars); err != nil {
+						return fmt.Errorf("error expanding %s[%d]: %w", k, i, err)
+					}
 				}
 			}
 		}
 	}
+	return nil
+}
+
+func expandString(
+	s string,
+	values []string,
+	vars map[string]string,
+) (string, error) {
+	return file.ExpandVars(file.ExpandPath(s, values), vars)
 }
 
 func (c ConfigManagementConfig) Expand(
 	values []string,
+	vars map[string]string,
 ) (ConfigManagementConfig, error) {
 	data, err := json.Marshal(c)
 	if err != nil {
@@ -76,7 +142,9 @@ func (c ConfigManagementConfig) Expand(
 	if err = json.Unmarshal(data, &cfgMap); err != nil {
 		return c, err
 	}
-	expand(cfgMap, values)
+	if err = expand(cfgMap, values, vars); err != nil {
+		return c, err
+	}
 	data, err = json.Marshal(cfgMap)
 	if err != nil {
 		return c, err
@@ -88,11 +156,35 @@ func (c ConfigManagementConfig) Expand(
 	return cfg, nil
 }
 
+// RenderOptions encapsulates settings for a single invocation of Render. These
+// are used in place of the environment variables Argo CD's repo server would
+// otherwise consult so that concurrent invocations with different settings do
+// not interfere with one another.
+type RenderOptions struct {
+	// KustomizeBinaryPath is the path to the kustomize binary used to render
+	// Kustomize-based applications. If not specified, kustomize is found using
+	// the PATH environment variable.
+	KustomizeBinaryPath string
+	// Timeout, if non-zero, is the maximum amount of time rendering may take.
+	Timeout time.Duration
+	// Observer, if non-nil, is invoked with a Result describing the generation
+	// of manifests once it has completed, whether or not it completed
+	// successfully. Argo CD's repo server executes the helm or kustomize
+	// commands that generate manifests itself, without any means of observing
+	// them individually, so they are described together by a single Result
+	// whose Command names the path and, if generation succeeded, the tool.
+	Observer func(libExec.Result)
+}
+
 func Render(
 	ctx context.Context,
 	repoRoot string,
 	cfg ConfigManagementConfig,
+	opts *RenderOptions,
 ) ([]byte, error) {
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
 	src := argoappv1.ApplicationSource{
 		Plugin: cfg.Plugin,
 	}
@@ -100,7 +192,11 @@ func Render(
 	var namespace string
 	var k8sVersion string
 	if cfg.Helm != nil {
-		src.Helm = &cfg.Helm.ApplicationSourceHelm
+		helm := cfg.Helm.ApplicationSourceHelm
+		if cfg.Helm.CRDs == CRDsSkip {
+			helm.SkipCrds = true
+		}
+		src.Helm = &helm
 		apiVersions = cfg.Helm.APIVersions
 		namespace = cfg.Helm.Namespace
 		k8sVersion = cfg.Helm.K8SVersion
@@ -112,12 +208,24 @@ func Render(
 			BuildOptions: cfg.Kustomize.BuildOptions,
 		}
 	}
+	if opts.KustomizeBinaryPath != "" {
+		if kustomizeOptions == nil {
+			kustomizeOptions = &argoappv1.KustomizeOptions{}
+		}
+		kustomizeOptions.BinaryPath = opts.KustomizeBinaryPath
+	}
 
-	res, err := repository.GenerateManifests(
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	res, err := generateManifests(
 		ctx,
 		filepath.Join(repoRoot, cfg.Path),
-		repoRoot, // Repo root
-		"",       // Revision -- seems ok to be empty string
+		repoRoot,
 		&apiclient.ManifestRequest{
 			// Both of these fields need to be non-nil
 			Repo:              &argoappv1.Repository{},
@@ -127,12 +235,10 @@ func Render(
 			Namespace:         namespace,
 			KubeVersion:       k8sVersion,
 		},
-		true,
-		&git.NoopCredsStore{}, // No need for this
-		// Allow any quantity of generated manifests
-		resource.MustParse("0"),
-		nil,
 	)
+	if opts.Observer != nil {
+		opts.Observer(generateManifestsResult(cfg.Path, res, err, time.Since(start)))
+	}
 	if err != nil {
 		return nil,
 			fmt.Errorf("error generating manifests using Argo CD repo server: %w", err)
@@ -147,3 +253,108 @@ func Render(
 	// Glue the manifests together
 	return manifests.CombineYAML(yamlManifests), nil
 }
+
+// generateManifests generates manifests for the application at the specified
+// path using Argo CD's repo server. The repo server does not stop rendering
+// when the provided context is done, so this returns the context's error as
+// soon as that happens, without waiting for the repo server to finish.
+func generateManifests(
+	ctx context.Context,
+	appPath string,
+	repoRoot string,
+	req *apiclient.ManifestRequest,
+) (*apiclient.ManifestResponse, error) {
+	type result struct {
+		res *apiclient.ManifestResponse
+		err error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		res, err := repository.GenerateManifests(
+			ctx,
+			appPath,
+			repoRoot,
+			"", // Revision -- seems ok to be empty string
+			req,
+			true,
+			&git.NoopCredsStore{}, // No need for this
+			// Allow any quantity of generated manifests
+			resource.MustParse("0"),
+			nil,
+		)
+		resCh <- result{res: res, err: err}
+	}()
+	select {
+	case r := <-resCh:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// generateManifestsResult returns a Result describing the generation of
+// manifests for the application at the specified path, which returned the
+// provided response and error after the provided duration. Exit codes mirror
+// those of commands: 0 if generation succeeded, -1 if it was canceled or timed
+// out, and 1 if it otherwise failed.
+func generateManifestsResult(
+	path string,
+	res *apiclient.ManifestResponse,
+	err error,
+	duration time.Duration,
+) libExec.Result {
+	command := []string{"argocd-repo-server", "generate-manifests"}
+	if res != nil && res.SourceType != "" {
+		command = append(command, "--source-type", res.SourceType)
+	}
+	result := libExec.Result{
+		Command:  strings.Join(append(command, "--path", path), " "),
+		Duration: duration,
+	}
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		result.ExitCode = -1
+	case err != nil:
+		result.ExitCode = 1
+	}
+	return result
+}
+
+// SourceType returns the name of the configuration management tool Argo CD's
+// repo server will use to render manifests for the provided configuration.
+// This is the tool that is explicitly configured, if any, and is otherwise
+// inferred from the contents of the directory at cfg.Path. Possible return
+// values are "Directory", "Helm", "Kustomize", and "Plugin".
+func SourceType(
+	ctx context.Context,
+	repoRoot string,
+	cfg ConfigManagementConfig,
+) (string, error) {
+	src := argoappv1.ApplicationSource{
+		Plugin: cfg.Plugin,
+	}
+	if cfg.Helm != nil {
+		src.Helm = &cfg.Helm.ApplicationSourceHelm
+	}
+	if cfg.Kustomize != nil {
+		src.Kustomize = &cfg.Kustomize.ApplicationSourceKustomize
+	}
+	sourceType, err := repository.GetAppSourceType(
+		ctx,
+		&src,
+		filepath.Join(repoRoot, cfg.Path),
+		repoRoot,
+		"",  // App name -- only used for locating app-specific overrides
+		nil, // Manifest generation is enabled for all tools
+		nil,
+		nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf(
+			"error determining configuration management tool for path %q: %w",
+			cfg.Path,
+			err,
+		)
+	}
+	return string(sourceType), nil
+}
@@ -1,10 +1,16 @@
 package argocd
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/stretchr/testify/require"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
 )
 
 func TestExpand(t *testing.T) {
@@ -15,16 +21,184 @@ func TestExpand(t *testing.T) {
 			ApplicationSourceHelm: argoappv1.ApplicationSourceHelm{
 				ReleaseName: "foo",
 				ValueFiles:  []string{"env/${1}/foo/values.yaml"},
-				Parameters: []argoappv1.HelmParameter{{
-					Name:  "env",
-					Value: "${1}",
-				}},
+				Parameters: []argoappv1.HelmParameter{
+					{
+						Name:  "env",
+						Value: "${1}",
+					},
+					{
+						Name:  "region",
+						Value: "${var:region}",
+					},
+				},
 			},
 		},
 	}
-	expandedCfg, err := cfg.Expand([]string{"foo", "bar"})
+	expandedCfg, err := cfg.Expand(
+		[]string{"foo", "bar"},
+		map[string]string{"region": "us-east-1"},
+	)
 	require.NoError(t, err)
 
 	require.Equal(t, "env/bar/foo/values.yaml", expandedCfg.Helm.ValueFiles[0])
 	require.Equal(t, "bar", expandedCfg.Helm.Parameters[0].Value)
+	require.Equal(t, "us-east-1", expandedCfg.Helm.Parameters[1].Value)
+
+	_, err = cfg.Expand([]string{"foo", "bar"}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `variable "region" is not defined`)
+}
+
+func TestSourceType(t *testing.T) {
+	testCases := []struct {
+		name       string
+		files      []string
+		cfg        ConfigManagementConfig
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:  "inferred helm",
+			files: []string{"Chart.yaml"},
+			assertions: func(t *testing.T, sourceType string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Helm", sourceType)
+			},
+		},
+		{
+			name:  "inferred kustomize",
+			files: []string{"kustomization.yaml"},
+			assertions: func(t *testing.T, sourceType string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Kustomize", sourceType)
+			},
+		},
+		{
+			name:  "inferred directory",
+			files: []string{"deployment.yaml"},
+			assertions: func(t *testing.T, sourceType string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Directory", sourceType)
+			},
+		},
+		{
+			name:  "explicit plugin",
+			files: []string{"kustomization.yaml"},
+			cfg: ConfigManagementConfig{
+				Plugin: &argoappv1.ApplicationSourcePlugin{Name: "foo"},
+			},
+			assertions: func(t *testing.T, sourceType string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Plugin", sourceType)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			for _, file := range testCase.files {
+				err := os.WriteFile(filepath.Join(repoRoot, file), nil, 0600)
+				require.NoError(t, err)
+			}
+			sourceType, err :=
+				SourceType(context.Background(), repoRoot, testCase.cfg)
+			testCase.assertions(t, sourceType, err)
+		})
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	// The fake kustomize prints a ConfigMap unless asked to build a directory
+	// named "slow", in which case it takes far longer than the timeout
+	binDir := t.TempDir()
+	kustomizePath := filepath.Join(binDir, "fake-kustomize")
+	require.NoError(
+		t,
+		os.WriteFile(
+			kustomizePath,
+			[]byte(`#!/bin/sh
+case "$2" in */slow) sleep 5 ;; esac
+echo "apiVersion: v1"
+echo "kind: ConfigMap"
+echo "metadata:"
+echo "  name: rendered-by-fake"
+`),
+			0700, // nolint: gosec
+		),
+	)
+	repoRoot := t.TempDir()
+	for _, dir := range []string{"fast", "slow"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, dir), 0700))
+		require.NoError(
+			t,
+			os.WriteFile(
+				filepath.Join(repoRoot, dir, "kustomization.yaml"),
+				[]byte("resources: []\n"),
+				0600,
+			),
+		)
+	}
+
+	testCases := []struct {
+		name       string
+		path       string
+		assertions func(*testing.T, []byte, libExec.Result, error)
+	}{
+		{
+			name: "configured kustomize binary is used",
+			path: "fast",
+			assertions: func(
+				t *testing.T,
+				manifests []byte,
+				observed libExec.Result,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Contains(t, string(manifests), "rendered-by-fake")
+				require.Equal(
+					t,
+					"argocd-repo-server generate-manifests --source-type Kustomize "+
+						"--path fast",
+					observed.Command,
+				)
+				require.Zero(t, observed.ExitCode)
+			},
+		},
+		{
+			name: "timeout is exceeded",
+			path: "slow",
+			assertions: func(
+				t *testing.T,
+				_ []byte,
+				observed libExec.Result,
+				err error,
+			) {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.Equal(
+					t,
+					"argocd-repo-server generate-manifests --path slow",
+					observed.Command,
+				)
+				require.Equal(t, -1, observed.ExitCode)
+				require.GreaterOrEqual(t, observed.Duration, time.Second)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var observed libExec.Result
+			manifests, err := Render(
+				context.Background(),
+				repoRoot,
+				ConfigManagementConfig{Path: testCase.path},
+				&RenderOptions{
+					KustomizeBinaryPath: kustomizePath,
+					Timeout:             time.Second,
+					Observer: func(res libExec.Result) {
+						observed = res
+					},
+				},
+			)
+			testCase.assertions(t, manifests, observed, err)
+		})
+	}
 }
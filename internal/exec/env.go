@@ -0,0 +1,71 @@
+package exec
+
+import (
+	"os"
+	"strings"
+)
+
+// DefaultEnvAllowlist lists the environment variables that every child process
+// may inherit. These locate executables, temporary files, and Kubernetes
+// clusters and configure locales and proxies, none of which are secrets.
+var DefaultEnvAllowlist = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"TMPDIR",
+	"TZ",
+	"LANG",
+	"LC_*",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+	"KUBECONFIG",
+	"KUBERNETES_SERVICE_HOST",
+	"KUBERNETES_SERVICE_PORT",
+}
+
+// Environ returns the environment variables of the current process, in the
+// form "key=value", that are matched by DefaultEnvAllowlist or by the provided
+// allowlist. See FilterEnv.
+func Environ(allowlist ...string) []string {
+	return FilterEnv(
+		os.Environ(),
+		append(append([]string{}, DefaultEnvAllowlist...), allowlist...),
+	)
+}
+
+// FilterEnv returns the environment variables, in the form "key=value", whose
+// names are matched by any entry in the provided allowlist. An entry ending in
+// "*" matches every name that begins with what precedes it. Any other entry
+// matches only the name that is identical to it.
+func FilterEnv(environ []string, allowlist []string) []string {
+	filtered := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if EnvAllowed(name, allowlist) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// EnvAllowed returns a bool indicating whether the environment variable with
+// the specified name is matched by any entry in the provided allowlist. See
+// FilterEnv.
+func EnvAllowed(name string, allowlist []string) bool {
+	for _, entry := range allowlist {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == entry {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterEnv(t *testing.T) {
+	require.Equal(
+		t,
+		[]string{"PATH=/usr/bin", "HELM_CACHE_HOME=/cache", "LC_ALL=C"},
+		FilterEnv(
+			[]string{
+				"PATH=/usr/bin",
+				"GITHUB_TOKEN=secret",
+				"HELM_CACHE_HOME=/cache",
+				"LC_ALL=C",
+				"PATHS=foo",
+			},
+			[]string{"PATH", "HELM_*", "LC_*"},
+		),
+	)
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("MY_VAR", "foo")
+	t.Setenv("TZ", "UTC")
+	environ := Environ("MY_VAR")
+	require.Contains(t, environ, "MY_VAR=foo")
+	require.Contains(t, environ, "TZ=UTC")
+	require.NotContains(t, environ, "GITHUB_TOKEN=secret")
+}
@@ -1,10 +1,25 @@
 package exec
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
+const redacted = "*****"
+
+// waitDelay is how long Exec waits, after a command has exited or been killed,
+// for processes it started to close its output before giving up on them.
+const waitDelay = 5 * time.Second
+
 // ExitError is an error type that is produced by the Exec() function when a
 // command returns a non-zero exit code.
 type ExitError struct {
@@ -13,6 +28,8 @@ type ExitError struct {
 	// Output is the combined output (stdout and stderr) produced when Command was
 	// executed.
 	Output []byte
+	// Stderr is the output written to stderr when Command was executed.
+	Stderr []byte
 	// ExitCode is the exit code that was returned when Command was executed.
 	ExitCode int
 }
@@ -25,27 +42,252 @@ func (e *ExitError) Error() string {
 	)
 }
 
-// Exec is a custom replacement for cmd.CombinedOutput(). It executes the
-// provided command and returns the command's combined output (stdout + stderr)
-// and an error. When the command completes successfully, with a non-zero exit
-// code, the error is nil. If the command's exit code is non-zero, the error is
-// of type ExitError. Other, unanticipated errors are wrapped and returned
-// as-is. The primary benefit to calling Exec() over calling
-// cmd.CombinedOutput() directly is that errors will automatically include
-// command output, which is likely to contain important information about the
-// cause of the error.
-func Exec(cmd *exec.Cmd) ([]byte, error) {
-	res, err := cmd.CombinedOutput()
+// Options represents optional settings for the Exec() function.
+type Options struct {
+	// Timeout, if non-zero, is the maximum amount of time a command may run
+	// before it is killed.
+	Timeout time.Duration
+	// Logger, if non-nil, is used to log the command and to stream its output,
+	// line by line, at DEBUG level.
+	Logger *log.Entry
+	// Redactions is a list of sensitive strings, such as passwords or tokens,
+	// that will be masked wherever they appear in logged output, in error
+	// messages, and in the Command field of any Result or ExitError.
+	Redactions []string
+	// Observer, if non-nil, is invoked with the Result of every command once
+	// it has completed, whether or not it completed successfully.
+	Observer func(Result)
+	// EnvAllowlist lists environment variables, beyond those in
+	// DefaultEnvAllowlist, that a command whose Env is nil may inherit. See
+	// FilterEnv. It is ignored if the command's Env is already set.
+	EnvAllowlist []string
+}
+
+// Result encapsulates the details of a successfully executed command.
+type Result struct {
+	// Command is the command that was executed.
+	Command string
+	// Stdout is the output written to stdout by the command.
+	Stdout []byte
+	// Stderr is the output written to stderr by the command.
+	Stderr []byte
+	// Combined is the combined output (stdout and stderr) of the command, in
+	// the order in which it was written.
+	Combined []byte
+	// ExitCode is the exit code that was returned by the command. It is -1 if
+	// the command could not be started or was killed.
+	ExitCode int
+	// Duration is how long the command took to execute.
+	Duration time.Duration
+}
+
+// Exec executes the provided command, killing it and any processes it started
+// if the provided context is canceled or if the timeout specified by opts
+// elapses first. A command whose Env is nil inherits only the environment
+// variables of the current process that are allowed by opts. It returns a
+// Result in which stdout and stderr are captured separately. When the command
+// completes successfully, with a zero exit code, the error is nil. If the
+// command's exit code is non-zero, the error is of type ExitError. Other,
+// unanticipated errors are wrapped and returned as-is. The primary benefit to
+// calling Exec() over calling cmd.CombinedOutput() directly is that errors will
+// automatically include command output, which is likely to contain important
+// information about the cause of the error.
+func Exec(ctx context.Context, cmd *exec.Cmd, opts *Options) (Result, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	res := Result{Command: opts.redact(cmd.String())}
+
+	// The environment of the current process may contain secrets that the
+	// command has no need for
+	if cmd.Env == nil {
+		cmd.Env = Environ(opts.EnvAllowlist...)
+	}
+
+	var logger *log.Entry
+	if opts.Logger != nil {
+		logger = opts.Logger.WithField("cmd", res.Command)
+		logger.Debug("executing command")
+	}
+
+	combined := &syncBuffer{}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	stdoutLog := newLogWriter(logger, "stdout", opts)
+	stderrLog := newLogWriter(logger, "stderr", opts)
+	cmd.Stdout = &teeWriter{buf: stdout, combined: combined, logs: stdoutLog}
+	cmd.Stderr = &teeWriter{buf: stderr, combined: combined, logs: stderrLog}
+
+	// Processes started by the command inherit its output, so killing the
+	// command alone would leave Wait blocked until they exit.
+	setProcessGroup(cmd)
+	if cmd.WaitDelay == 0 {
+		cmd.WaitDelay = waitDelay
+	}
+
+	start := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = kill(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+		// The command itself succeeded, but left behind processes that did not
+		// close its output in time. Their output is of no interest.
+		if errors.Is(err, exec.ErrWaitDelay) && ctx.Err() == nil {
+			err = nil
+		}
+	}
+	res.Duration = time.Since(start)
+	stdoutLog.flush()
+	stderrLog.flush()
+
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+	res.Combined = combined.Bytes()
+	res.ExitCode = -1
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if opts.Observer != nil {
+		opts.Observer(res)
+	}
+
+	if logger != nil {
+		logger.WithFields(log.Fields{
+			"exitCode": res.ExitCode,
+			"duration": res.Duration,
+		}).Debug("command completed")
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		return res, fmt.Errorf(
+			"error executing cmd [%s]: %s: %w",
+			res.Command,
+			opts.redact(string(res.Combined)),
+			ctxErr,
+		)
+	}
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, &ExitError{
-				Command:  cmd.String(),
-				Output:   res,
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return res, &ExitError{
+				Command:  res.Command,
+				Output:   []byte(opts.redact(string(res.Combined))),
+				Stderr:   []byte(opts.redact(string(res.Stderr))),
 				ExitCode: exitErr.ExitCode(),
 			}
 		}
-		return nil,
-			fmt.Errorf("error executing cmd [%s]: %s: %w", cmd.String(), string(res), err)
+		return res, fmt.Errorf(
+			"error executing cmd [%s]: %s: %w",
+			res.Command,
+			opts.redact(string(res.Combined)),
+			err,
+		)
 	}
 	return res, nil
 }
+
+// redact masks all occurrences of the strings specified by o.Redactions in the
+// provided string.
+func (o *Options) redact(s string) string {
+	for _, r := range o.Redactions {
+		if r != "" {
+			s = strings.ReplaceAll(s, r, redacted)
+		}
+	}
+	return s
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent writes. It is used
+// to collect combined output, since exec.Cmd may write to stdout and stderr
+// from separate goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Bytes()
+}
+
+// teeWriter writes to a stream-specific buffer, a buffer of combined output,
+// and, optionally, a logWriter.
+type teeWriter struct {
+	buf      *bytes.Buffer
+	combined *syncBuffer
+	logs     *logWriter
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	_, _ = t.combined.Write(p)
+	t.logs.write(p)
+	return len(p), nil
+}
+
+// logWriter logs complete lines of output at DEBUG level, with sensitive
+// strings redacted.
+type logWriter struct {
+	logger  *log.Entry
+	opts    *Options
+	pending []byte
+}
+
+func newLogWriter(logger *log.Entry, stream string, opts *Options) *logWriter {
+	if logger == nil || !logger.Logger.IsLevelEnabled(log.DebugLevel) {
+		return &logWriter{}
+	}
+	return &logWriter{
+		logger: logger.WithField("stream", stream),
+		opts:   opts,
+	}
+}
+
+func (l *logWriter) write(p []byte) {
+	if l.logger == nil {
+		return
+	}
+	l.pending = append(l.pending, p...)
+	i := bytes.LastIndexByte(l.pending, '\n')
+	if i < 0 {
+		return
+	}
+	l.logLines(l.pending[:i])
+	l.pending = l.pending[i+1:]
+}
+
+func (l *logWriter) flush() {
+	if l.logger == nil || len(l.pending) == 0 {
+		return
+	}
+	l.logLines(l.pending)
+	l.pending = nil
+}
+
+func (l *logWriter) logLines(p []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		l.logger.Debug(l.opts.redact(scanner.Text()))
+	}
+}
@@ -1,10 +1,14 @@
 package exec
 
 import (
+	"bytes"
+	"context"
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,19 +16,21 @@ func TestExec(t *testing.T) {
 	testCases := []struct {
 		name       string
 		cmd        *exec.Cmd
-		assertions func(t *testing.T, res []byte, err error)
+		opts       *Options
+		assertions func(t *testing.T, res Result, err error)
 	}{
 		{
 			name: "error",
 			// This command should fail, but ALSO produce some output
 			cmd: exec.Command("expr", "100", "/", "0"),
-			assertions: func(t *testing.T, _ []byte, err error) {
+			assertions: func(t *testing.T, _ Result, err error) {
 				require.Error(t, err)
 				exitErr, ok := err.(*ExitError)
 				require.True(t, ok)
 				// Path to expr will be different on Mac and Linux
 				require.True(t, strings.HasSuffix(exitErr.Command, "expr 100 / 0"))
 				require.Equal(t, "expr: division by zero\n", string(exitErr.Output))
+				require.Equal(t, "expr: division by zero\n", string(exitErr.Stderr))
 				require.NotEmpty(t, exitErr.ExitCode)
 				require.Contains(t, err.Error(), "expr 100 / 0")
 				require.Contains(t, err.Error(), "expr: division by zero")
@@ -33,16 +39,131 @@ func TestExec(t *testing.T) {
 		{
 			name: "success",
 			cmd:  exec.Command("echo", "foobar"),
-			assertions: func(t *testing.T, res []byte, err error) {
+			assertions: func(t *testing.T, res Result, err error) {
 				require.NoError(t, err)
-				require.Equal(t, "foobar\n", string(res))
+				require.Equal(t, "foobar\n", string(res.Stdout))
+				require.Empty(t, res.Stderr)
+				require.Equal(t, 0, res.ExitCode)
+			},
+		},
+		{
+			name: "stdout and stderr are separated",
+			cmd:  exec.Command("sh", "-c", "echo foo; echo bar >&2"),
+			assertions: func(t *testing.T, res Result, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "foo\n", string(res.Stdout))
+				require.Equal(t, "bar\n", string(res.Stderr))
+				require.Contains(t, string(res.Combined), "foo\n")
+				require.Contains(t, string(res.Combined), "bar\n")
+			},
+		},
+		{
+			name: "timeout",
+			cmd:  exec.Command("sleep", "10"),
+			opts: &Options{
+				Timeout: 100 * time.Millisecond,
+			},
+			assertions: func(t *testing.T, res Result, err error) {
+				require.Error(t, err)
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.Less(t, res.Duration, 10*time.Second)
+			},
+		},
+		{
+			name: "timeout kills processes started by command",
+			// The subshell inherits the command's output, so Exec would wait for it
+			// if it were not killed along with the command
+			cmd: exec.Command("sh", "-c", "sleep 10; :"),
+			opts: &Options{
+				Timeout: 200 * time.Millisecond,
+			},
+			assertions: func(t *testing.T, res Result, err error) {
+				require.Error(t, err)
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.Less(t, res.Duration, 2*time.Second)
+			},
+		},
+		{
+			name: "redaction",
+			cmd:  exec.Command("sh", "-c", "echo my-secret >&2; exit 1"),
+			opts: &Options{
+				Redactions: []string{"my-secret"},
+			},
+			assertions: func(t *testing.T, _ Result, err error) {
+				require.Error(t, err)
+				require.NotContains(t, err.Error(), "my-secret")
+				require.Contains(t, err.Error(), redacted)
 			},
 		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			res, err := Exec(testCase.cmd)
+			res, err := Exec(context.Background(), testCase.cmd, testCase.opts)
 			testCase.assertions(t, res, err)
 		})
 	}
 }
+
+func TestExecLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(buf)
+	logger.SetLevel(log.DebugLevel)
+	_, err := Exec(
+		context.Background(),
+		exec.Command("echo", "my-secret"),
+		&Options{
+			Logger:     log.NewEntry(logger),
+			Redactions: []string{"my-secret"},
+		},
+	)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "command completed")
+	require.Contains(t, buf.String(), redacted)
+	require.NotContains(t, buf.String(), "my-secret")
+}
+
+func TestExecObserver(t *testing.T) {
+	var observed []Result
+	opts := &Options{
+		Redactions: []string{"my-secret"},
+		Observer: func(res Result) {
+			observed = append(observed, res)
+		},
+	}
+	_, err := Exec(
+		context.Background(),
+		exec.Command("sh", "-c", "exit 3", "my-secret"),
+		opts,
+	)
+	require.Error(t, err)
+	_, err = Exec(context.Background(), exec.Command("/no/such/command"), opts)
+	require.Error(t, err)
+	require.Len(t, observed, 2)
+	require.Equal(t, 3, observed[0].ExitCode)
+	require.Contains(t, observed[0].Command, redacted)
+	require.NotContains(t, observed[0].Command, "my-secret")
+	require.Equal(t, -1, observed[1].ExitCode)
+}
+
+func TestExecEnv(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("MY_VAR", "foo")
+
+	res, err := Exec(
+		context.Background(),
+		exec.Command("env"),
+		&Options{EnvAllowlist: []string{"MY_VAR"}},
+	)
+	require.NoError(t, err)
+	require.Contains(t, string(res.Stdout), "MY_VAR=foo")
+	require.Contains(t, string(res.Stdout), "PATH=")
+	require.NotContains(t, string(res.Stdout), "GITHUB_TOKEN")
+
+	// An environment set by the caller is left alone
+	cmd := exec.Command("env")
+	cmd.Env = []string{"GITHUB_TOKEN=secret"}
+	res, err = Exec(context.Background(), cmd, nil)
+	require.NoError(t, err)
+	require.Equal(t, "GITHUB_TOKEN=secret\n", string(res.Stdout))
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package exec
+
+import "os/exec"
+
+// setProcessGroup does nothing on platforms without process groups.
+func setProcessGroup(*exec.Cmd) {}
+
+// kill kills the provided command, which must have been started. Processes it
+// started are left running on platforms without process groups, but Exec stops
+// waiting for them after waitDelay.
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup arranges for the provided command to be started in a process
+// group of its own so that any processes it starts can be killed along with
+// it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// kill kills the provided command, which must have been started, and every
+// other process in its process group.
+func kill(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
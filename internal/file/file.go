@@ -1,8 +1,11 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -32,3 +35,48 @@ func ExpandPath(pathTemplate string, values []string) string {
 	}
 	return pathTemplate
 }
+
+// varPlaceholderRegex matches placeholders of the form ${var:name}.
+var varPlaceholderRegex = regexp.MustCompile(`\$\{var:([^}]*)\}`)
+
+// ExpandVars expands the provided template, replacing placeholders of the form
+// ${var:name} with corresponding values from the provided map. Since expanded
+// templates are frequently paths, values that are absolute paths or that
+// contain .. as a path element are refused, as are placeholders that reference
+// names not present in the map. All such problems are returned, joined into a
+// single error. The expanded template is returned.
+func ExpandVars(template string, vars map[string]string) (string, error) {
+	var errs []error
+	expanded := varPlaceholderRegex.ReplaceAllStringFunc(
+		template,
+		func(placeholder string) string {
+			name := varPlaceholderRegex.FindStringSubmatch(placeholder)[1]
+			value, ok := vars[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("variable %q is not defined", name))
+				return placeholder
+			}
+			if strings.HasPrefix(value, "/") || strings.HasPrefix(value, `\`) ||
+				slices.Contains(strings.FieldsFunc(value, isPathSeparator), "..") {
+				errs = append(
+					errs,
+					fmt.Errorf(
+						"value %q of variable %q must not be an absolute path or "+
+							"contain ..",
+						value,
+						name,
+					),
+				)
+				return placeholder
+			}
+			return value
+		},
+	)
+	return expanded, errors.Join(errs...)
+}
+
+// isPathSeparator returns true if the provided rune separates the elements of
+// a path on any platform.
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
@@ -60,3 +60,100 @@ func TestExpandPath(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandVars(t *testing.T) {
+	testCases := []struct {
+		name       string
+		template   string
+		vars       map[string]string
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name:     "empty string",
+			template: "",
+			vars:     map[string]string{"region": "us-east-1"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Empty(t, output)
+			},
+		},
+		{
+			name:     "single substitution",
+			template: "env/${var:region}/values.yaml",
+			vars:     map[string]string{"region": "us-east-1"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/us-east-1/values.yaml", output)
+			},
+		},
+		{
+			name:     "multiple substitutions",
+			template: "${var:cluster}/${var:region}/${var:cluster}",
+			vars:     map[string]string{"cluster": "foo", "region": "bar"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "foo/bar/foo", output)
+			},
+		},
+		{
+			name:     "values are not expanded",
+			template: "${var:cluster}/${var:region}",
+			vars:     map[string]string{"cluster": "${var:region}", "region": "bar"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "${var:region}/bar", output)
+			},
+		},
+		{
+			name:     "placeholder with no corresponding value",
+			template: "env/${var:region}/${var:cluster}",
+			vars:     map[string]string{"region": "us-east-1"},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `variable "cluster" is not defined`)
+			},
+		},
+		{
+			name:     "value traversing paths",
+			template: "env/${var:region}/values.yaml",
+			vars:     map[string]string{"region": "us-east-1/../../.."},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `variable "region" must not`)
+			},
+		},
+		{
+			name:     "absolute value",
+			template: "${var:region}/values.yaml",
+			vars:     map[string]string{"region": "/etc"},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `variable "region" must not`)
+			},
+		},
+		{
+			name:     "value containing dots",
+			template: "env/${var:version}/values.yaml",
+			vars:     map[string]string{"version": "1..2"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/1..2/values.yaml", output)
+			},
+		},
+		{
+			name:     "numbered placeholders are untouched",
+			template: "env/${1}/${var:region}",
+			vars:     map[string]string{"region": "us-east-1"},
+			assertions: func(t *testing.T, output string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/${1}/us-east-1", output)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			output, err := ExpandVars(testCase.template, testCase.vars)
+			testCase.assertions(t, output, err)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v47/github"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// CheckState is the state of a status check on a commit.
+type CheckState string
+
+const (
+	// CheckStateSuccess indicates a check has completed successfully.
+	CheckStateSuccess CheckState = "success"
+	// CheckStatePending indicates a check has not yet completed.
+	CheckStatePending CheckState = "pending"
+	// CheckStateFailure indicates a check has completed unsuccessfully.
+	CheckStateFailure CheckState = "failure"
+)
+
+// GetCheckStates returns the states of the status checks on the specified
+// commit, indexed by name. Both check runs, which are created by GitHub Apps
+// such as GitHub Actions, and commit statuses, which are created by other
+// integrations, are included. If a check run and a commit status have the same
+// name, the least successful state is returned.
+func GetCheckStates(
+	ctx context.Context,
+	repoURL string,
+	commit string,
+	repoCreds git.RepoCredentials,
+	clientOpts *ClientOptions,
+) (map[string]CheckState, error) {
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	githubClient := newClient(ctx, repoCreds, clientOpts)
+	states := map[string]CheckState{}
+	record := func(name string, state CheckState) {
+		if existing, ok := states[name]; !ok || state.worseThan(existing) {
+			states[name] = state
+		}
+	}
+
+	runOpts := &github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		runs, res, err := githubClient.Checks.ListCheckRunsForRef(
+			ctx,
+			owner,
+			repo,
+			commit,
+			runOpts,
+		)
+		if err != nil {
+			return nil,
+				fmt.Errorf("error listing check runs for commit %q: %w", commit, err)
+		}
+		for _, run := range runs.CheckRuns {
+			record(run.GetName(), checkRunState(run))
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		runOpts.Page = res.NextPage
+	}
+
+	statusOpts := &github.ListOptions{PerPage: 100}
+	for {
+		status, res, err := githubClient.Repositories.GetCombinedStatus(
+			ctx,
+			owner,
+			repo,
+			commit,
+			statusOpts,
+		)
+		if err != nil {
+			return nil,
+				fmt.Errorf("error getting statuses of commit %q: %w", commit, err)
+		}
+		for _, s := range status.Statuses {
+			record(s.GetContext(), commitStatusState(s))
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		statusOpts.Page = res.NextPage
+	}
+
+	return states, nil
+}
+
+// checkRunState returns the CheckState corresponding to the provided check
+// run. Neutral and skipped check runs are considered successful, as they are by
+// GitHub's branch protection rules.
+func checkRunState(run *github.CheckRun) CheckState {
+	if run.GetStatus() != "completed" {
+		return CheckStatePending
+	}
+	switch run.GetConclusion() {
+	case "success", "neutral", "skipped":
+		return CheckStateSuccess
+	default:
+		return CheckStateFailure
+	}
+}
+
+// commitStatusState returns the CheckState corresponding to the provided
+// commit status.
+func commitStatusState(status *github.RepoStatus) CheckState {
+	switch status.GetState() {
+	case "success":
+		return CheckStateSuccess
+	case "pending":
+		return CheckStatePending
+	default:
+		return CheckStateFailure
+	}
+}
+
+// worseThan returns true if the CheckState is less successful than the
+// provided CheckState.
+func (c CheckState) worseThan(other CheckState) bool {
+	rank := map[CheckState]int{
+		CheckStateSuccess: 0,
+		CheckStatePending: 1,
+		CheckStateFailure: 2,
+	}
+	return rank[c] > rank[other]
+}
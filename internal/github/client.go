@@ -0,0 +1,85 @@
+package github
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v47/github"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// ClientOptions customizes the requests made to the GitHub API.
+type ClientOptions struct {
+	// UserAgent, if non-empty, is sent as the User-Agent header of every
+	// request in place of that of the underlying client library.
+	UserAgent string
+	// Headers are additional headers, indexed by name, that are sent with every
+	// request.
+	Headers map[string]string
+	// Logger, if non-nil, is used to log the rate limit remaining after every
+	// request at DEBUG level.
+	Logger *log.Entry
+}
+
+// newClient returns a client for the GitHub API that authenticates using the
+// password of the provided credentials as a token and is customized by the
+// provided options, which may be nil.
+func newClient(
+	ctx context.Context,
+	repoCreds git.RepoCredentials,
+	opts *ClientOptions,
+) *github.Client {
+	httpClient := oauth2.NewClient(
+		ctx,
+		oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: repoCreds.Password},
+		),
+	)
+	if opts == nil {
+		return github.NewClient(httpClient)
+	}
+	httpClient.Transport = &transport{
+		base: httpClient.Transport,
+		opts: opts,
+	}
+	githubClient := github.NewClient(httpClient)
+	if opts.UserAgent != "" {
+		githubClient.UserAgent = opts.UserAgent
+	}
+	return githubClient
+}
+
+// transport is an http.RoundTripper that adds the headers specified by
+// ClientOptions to every request and logs the rate limit remaining after
+// every response.
+type transport struct {
+	base http.RoundTripper
+	opts *ClientOptions
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.opts.Headers) > 0 {
+		// A RoundTripper must not modify the request it is given
+		req = req.Clone(req.Context())
+		for name, value := range t.opts.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+	res, err := t.base.RoundTrip(req)
+	if err != nil || t.opts.Logger == nil {
+		return res, err
+	}
+	if remaining := res.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		t.opts.Logger.WithFields(log.Fields{
+			"method":             req.Method,
+			"path":               req.URL.Path,
+			"rateLimit":          res.Header.Get("X-RateLimit-Limit"),
+			"rateLimitRemaining": remaining,
+			"rateLimitReset":     res.Header.Get("X-RateLimit-Reset"),
+		}).Debug("GitHub API rate limit")
+	}
+	return res, nil
+}
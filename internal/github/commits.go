@@ -0,0 +1,155 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/google/go-github/v47/github"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// Commit describes a commit to be created using the GitHub API.
+type Commit struct {
+	// Message is the commit message.
+	Message string
+	// AuthorName and AuthorEmail optionally identify the author of the commit.
+	// If they are not specified, GitHub attributes the commit to the principal
+	// the token belongs to.
+	AuthorName  string
+	AuthorEmail string
+	// Files maps the paths of files added or modified by the commit, relative
+	// to the root of the repository, to their new contents.
+	Files map[string][]byte
+	// Deleted are the paths of files deleted by the commit, relative to the
+	// root of the repository.
+	Deleted []string
+}
+
+// PushCommits creates the provided commits, in order, on top of the parent
+// commit with the specified ID using the GitHub API instead of the git
+// protocol, then points the specified branch at the last of them, creating the
+// branch if it does not already exist. If the parent commit ID is empty, the
+// first commit has no parent. The ID of the last commit is returned.
+//
+// Because GitHub itself creates the commits, a token that permits writing
+// repository contents, but not access via the git protocol, suffices, and the
+// commits are signed by GitHub. All files are created as regular,
+// non-executable files.
+func PushCommits(
+	ctx context.Context,
+	repoURL string,
+	branch string,
+	parent string,
+	commits []Commit,
+	repoCreds git.RepoCredentials,
+	clientOpts *ClientOptions,
+) (string, error) {
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", err
+	}
+	githubClient := newClient(ctx, repoCreds, clientOpts)
+
+	var baseTree string
+	if parent != "" {
+		parentCommit, _, err :=
+			githubClient.Git.GetCommit(ctx, owner, repo, parent)
+		if err != nil {
+			return "", fmt.Errorf("error getting commit %q: %w", parent, err)
+		}
+		baseTree = parentCommit.GetTree().GetSHA()
+	}
+
+	for _, commit := range commits {
+		entries := make([]*github.TreeEntry, 0, len(commit.Files)+len(commit.Deleted))
+		paths := make([]string, 0, len(commit.Files))
+		for path := range commit.Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			blob, _, err := githubClient.Git.CreateBlob(
+				ctx,
+				owner,
+				repo,
+				&github.Blob{
+					Content: github.String(
+						base64.StdEncoding.EncodeToString(commit.Files[path]),
+					),
+					Encoding: github.String("base64"),
+				},
+			)
+			if err != nil {
+				return "", fmt.Errorf("error creating blob for %q: %w", path, err)
+			}
+			entries = append(
+				entries,
+				&github.TreeEntry{
+					Path: github.String(path),
+					Mode: github.String("100644"),
+					Type: github.String("blob"),
+					SHA:  blob.SHA,
+				},
+			)
+		}
+		for _, path := range commit.Deleted {
+			// An entry with neither content nor a SHA deletes the file
+			entries = append(
+				entries,
+				&github.TreeEntry{
+					Path: github.String(path),
+					Mode: github.String("100644"),
+					Type: github.String("blob"),
+				},
+			)
+		}
+		tree, _, err :=
+			githubClient.Git.CreateTree(ctx, owner, repo, baseTree, entries)
+		if err != nil {
+			return "", fmt.Errorf("error creating tree: %w", err)
+		}
+		newCommit := &github.Commit{
+			Message: github.String(commit.Message),
+			Tree:    tree,
+		}
+		if parent != "" {
+			newCommit.Parents = []*github.Commit{{SHA: github.String(parent)}}
+		}
+		if commit.AuthorName != "" || commit.AuthorEmail != "" {
+			newCommit.Author = &github.CommitAuthor{
+				Name:  github.String(commit.AuthorName),
+				Email: github.String(commit.AuthorEmail),
+			}
+		}
+		created, _, err := githubClient.Git.CreateCommit(ctx, owner, repo, newCommit)
+		if err != nil {
+			return "", fmt.Errorf("error creating commit: %w", err)
+		}
+		parent = created.GetSHA()
+		baseTree = tree.GetSHA()
+	}
+
+	ref := &github.Reference{
+		Ref:    github.String(fmt.Sprintf("refs/heads/%s", branch)),
+		Object: &github.GitObject{SHA: github.String(parent)},
+	}
+	_, res, err := githubClient.Git.GetRef(ctx, owner, repo, *ref.Ref)
+	switch {
+	case err == nil:
+		// Like a push, this fails if the branch has moved on in the meantime
+		if _, _, err = githubClient.Git.UpdateRef(ctx, owner, repo, ref, false); err != nil {
+			return "", fmt.Errorf("error updating branch %q: %w", branch, err)
+		}
+	case res != nil && res.StatusCode == http.StatusNotFound:
+		if _, _, err = githubClient.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+			return "", fmt.Errorf("error creating branch %q: %w", branch, err)
+		}
+	default:
+		return "", fmt.Errorf("error getting branch %q: %w", branch, err)
+	}
+	return parent, nil
+}
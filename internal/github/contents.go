@@ -0,0 +1,50 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v47/github"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// GetFileContents returns the contents of the file at the specified path,
+// relative to the root of the repository, as of the specified branch or
+// commit. If no such file exists, or the branch does not exist, nil is
+// returned. Files larger than 1 MB cannot be retrieved this way.
+func GetFileContents(
+	ctx context.Context,
+	repoURL string,
+	ref string,
+	path string,
+	repoCreds git.RepoCredentials,
+	clientOpts *ClientOptions,
+) ([]byte, error) {
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	githubClient := newClient(ctx, repoCreds, clientOpts)
+	file, _, res, err := githubClient.Repositories.GetContents(
+		ctx,
+		owner,
+		repo,
+		path,
+		&github.RepositoryContentGetOptions{Ref: ref},
+	)
+	switch {
+	case res != nil && res.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("error getting file %q at %q: %w", path, ref, err)
+	case file == nil:
+		return nil, fmt.Errorf("%q at %q is not a file", path, ref)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding file %q at %q: %w", path, ref, err)
+	}
+	return []byte(content), nil
+}
@@ -2,16 +2,35 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v47/github"
-	"golang.org/x/oauth2"
 
 	"github.com/akuity/kargo-render/pkg/git"
 )
 
+// PROptions encapsulates optional pull request configuration.
+type PROptions struct {
+	// Labels are labels to apply to the pull request.
+	Labels []string
+	// Draft specifies whether the pull request should be opened as a draft.
+	Draft bool
+	// Reviewers are the usernames of users whose review should be requested.
+	Reviewers []string
+	// TeamReviewers are the slugs of teams whose review should be requested.
+	TeamReviewers []string
+}
+
+// OpenPR opens a pull request from the commit branch to the target branch and
+// returns its URL. If a pull request already exists for the commit branch, an
+// empty URL is returned. Labels and reviewers are applied once the pull request
+// is open, so failing to apply them does not prevent it from being opened. In
+// that case, the URL of the pull request is returned along with the error.
 func OpenPR(
 	ctx context.Context,
 	repoURL string,
@@ -20,19 +39,17 @@ func OpenPR(
 	targetBranch string,
 	commitBranch string,
 	repoCreds git.RepoCredentials,
+	opts *PROptions,
+	clientOpts *ClientOptions,
 ) (string, error) {
+	if opts == nil {
+		opts = &PROptions{}
+	}
 	owner, repo, err := parseGitHubURL(repoURL)
 	if err != nil {
 		return "", err
 	}
-	githubClient := github.NewClient(
-		oauth2.NewClient(
-			ctx,
-			oauth2.StaticTokenSource(
-				&oauth2.Token{AccessToken: repoCreds.Password},
-			),
-		),
-	)
+	githubClient := newClient(ctx, repoCreds, clientOpts)
 	pr, _, err := githubClient.PullRequests.Create(
 		ctx,
 		owner,
@@ -43,6 +60,7 @@ func OpenPR(
 			Head:                github.String(commitBranch),
 			Body:                github.String(body),
 			MaintainerCanModify: github.Bool(false),
+			Draft:               github.Bool(opts.Draft),
 		},
 	)
 	if err != nil {
@@ -54,7 +72,112 @@ func OpenPR(
 		return "",
 			fmt.Errorf("error opening pull request to the target branch: %w", err)
 	}
-	return *pr.HTMLURL, nil
+	var errs []error
+	if len(opts.Labels) > 0 {
+		if _, _, err = githubClient.Issues.AddLabelsToIssue(
+			ctx,
+			owner,
+			repo,
+			pr.GetNumber(),
+			opts.Labels,
+		); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"error labeling pull request %s: %w",
+				pr.GetHTMLURL(),
+				err,
+			))
+		}
+	}
+	if len(opts.Reviewers) > 0 || len(opts.TeamReviewers) > 0 {
+		if _, _, err = githubClient.PullRequests.RequestReviewers(
+			ctx,
+			owner,
+			repo,
+			pr.GetNumber(),
+			github.ReviewersRequest{
+				Reviewers:     opts.Reviewers,
+				TeamReviewers: opts.TeamReviewers,
+			},
+		); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"error requesting reviews of pull request %s: %w",
+				pr.GetHTMLURL(),
+				err,
+			))
+		}
+	}
+	return pr.GetHTMLURL(), errors.Join(errs...)
+}
+
+// PR describes an open pull request.
+type PR struct {
+	// Number is the number of the pull request.
+	Number int
+	// URL is the URL of the pull request on the web.
+	URL string
+	// HeadBranch is the branch the pull request was opened from.
+	HeadBranch string
+	// CreatedAt is when the pull request was opened.
+	CreatedAt time.Time
+}
+
+// ListOpenPRs returns the open pull requests to the specified target branch
+// from branches of the same repository whose names begin with the specified
+// prefix, oldest first.
+func ListOpenPRs(
+	ctx context.Context,
+	repoURL string,
+	targetBranch string,
+	headBranchPrefix string,
+	repoCreds git.RepoCredentials,
+	clientOpts *ClientOptions,
+) ([]PR, error) {
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	githubClient := newClient(ctx, repoCreds, clientOpts)
+	listOpts := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        targetBranch,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var prs []PR
+	for {
+		page, res, err :=
+			githubClient.PullRequests.List(ctx, owner, repo, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error listing pull requests to branch %q: %w",
+				targetBranch,
+				err,
+			)
+		}
+		for _, pr := range page {
+			head := pr.GetHead()
+			fromRepo := strings.EqualFold(
+				head.GetRepo().GetFullName(),
+				fmt.Sprintf("%s/%s", owner, repo),
+			)
+			if !fromRepo || !strings.HasPrefix(head.GetRef(), headBranchPrefix) {
+				continue
+			}
+			prs = append(prs, PR{
+				Number:     pr.GetNumber(),
+				URL:        pr.GetHTMLURL(),
+				HeadBranch: head.GetRef(),
+				CreatedAt:  pr.GetCreatedAt(),
+			})
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		listOpts.Page = res.NextPage
+	}
+	sort.SliceStable(prs, func(i, j int) bool {
+		return prs[i].CreatedAt.Before(prs[j].CreatedAt)
+	})
+	return prs, nil
 }
 
 func parseGitHubURL(url string) (string, string, error) {
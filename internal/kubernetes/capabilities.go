@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Capabilities describes the Kubernetes version and API versions supported by
+// a cluster. These are the details Helm exposes to charts as .Capabilities.
+type Capabilities struct {
+	// K8SVersion is the cluster's Kubernetes version, e.g. v1.29.0.
+	K8SVersion string
+	// APIVersions lists every API group/version supported by the cluster, as
+	// well as every group/version/kind, e.g. apps/v1 and apps/v1/Deployment.
+	APIVersions []string
+}
+
+// DiscoverCapabilities connects to the cluster identified by the specified
+// context of the specified kubeconfig file and discovers its Capabilities. If
+// kubeconfig is empty, the usual rules for locating a kubeconfig file apply:
+// the KUBECONFIG environment variable is honored and ~/.kube/config is used
+// as a fallback. If kubeContext is empty, the current context is used.
+func DiscoverCapabilities(
+	kubeconfig string,
+	kubeContext string,
+) (Capabilities, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	restCfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return Capabilities{},
+			fmt.Errorf("error loading kubeconfig context %q: %w", kubeContext, err)
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(restCfg)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("error creating discovery client: %w", err)
+	}
+	return discoverCapabilities(client)
+}
+
+func discoverCapabilities(
+	client discovery.DiscoveryInterface,
+) (Capabilities, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return Capabilities{},
+			fmt.Errorf("error discovering Kubernetes version: %w", err)
+	}
+	// Cloud providers commonly append pre-release or build metadata to the
+	// version (e.g. v1.29.0-eks-5e0fdde). Helm would treat such a version as a
+	// pre-release and it would fail most charts' kubeVersion constraints, so
+	// only the major, minor, and patch versions are retained.
+	ver, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf(
+			"error parsing Kubernetes version %q: %w",
+			info.GitVersion,
+			err,
+		)
+	}
+	_, resourceLists, err := client.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		// A failure to discover some groups (e.g. due to an unavailable
+		// aggregated API server) is tolerated, since every other group was
+		// still discovered.
+		return Capabilities{},
+			fmt.Errorf("error discovering API versions: %w", err)
+	}
+	return Capabilities{
+		K8SVersion: fmt.Sprintf(
+			"v%d.%d.%d",
+			ver.Major(),
+			ver.Minor(),
+			ver.Patch(),
+		),
+		APIVersions: apiVersions(resourceLists),
+	}, nil
+}
+
+// apiVersions returns a sorted list of every group/version and
+// group/version/kind in the provided resource lists, formatted the way Helm
+// expects them.
+func apiVersions(resourceLists []*metav1.APIResourceList) []string {
+	set := map[string]struct{}{}
+	for _, resourceList := range resourceLists {
+		if resourceList == nil {
+			continue
+		}
+		set[resourceList.GroupVersion] = struct{}{}
+		for _, resource := range resourceList.APIResources {
+			set[fmt.Sprintf("%s/%s", resourceList.GroupVersion, resource.Kind)] =
+				struct{}{}
+		}
+	}
+	versions := make([]string, 0, len(set))
+	for v := range set {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
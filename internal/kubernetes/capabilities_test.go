@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDiscoverCapabilities(t *testing.T) {
+	testCases := []struct {
+		name       string
+		gitVersion string
+		assertions func(*testing.T, Capabilities, error)
+	}{
+		{
+			name:       "unparseable version",
+			gitVersion: "bogus",
+			assertions: func(t *testing.T, _ Capabilities, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "error parsing Kubernetes version")
+			},
+		},
+		{
+			name:       "success",
+			gitVersion: "v1.29.3-eks-5e0fdde",
+			assertions: func(t *testing.T, capabilities Capabilities, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "v1.29.3", capabilities.K8SVersion)
+				require.Equal(
+					t,
+					[]string{
+						"apps/v1",
+						"apps/v1/Deployment",
+						"apps/v1/StatefulSet",
+						"v1",
+						"v1/ConfigMap",
+					},
+					capabilities.APIVersions,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := &fakediscovery.FakeDiscovery{
+				Fake: &clienttesting.Fake{
+					Resources: []*metav1.APIResourceList{
+						{
+							GroupVersion: "v1",
+							APIResources: []metav1.APIResource{
+								{Name: "configmaps", Kind: "ConfigMap"},
+							},
+						},
+						{
+							GroupVersion: "apps/v1",
+							APIResources: []metav1.APIResource{
+								{Name: "deployments", Kind: "Deployment"},
+								{Name: "deployments/status", Kind: "Deployment"},
+								{Name: "statefulsets", Kind: "StatefulSet"},
+							},
+						},
+					},
+				},
+				FakedServerVersion: &version.Info{GitVersion: testCase.gitVersion},
+			}
+			capabilities, err := discoverCapabilities(client)
+			testCase.assertions(t, capabilities, err)
+		})
+	}
+}
@@ -14,16 +14,34 @@ import (
 	"github.com/akuity/kargo-render/internal/strings"
 )
 
+// Options are transformations, in addition to image substitutions, applied to
+// every manifest while rendering.
+type Options struct {
+	// NameSuffix is appended to the names of all resources.
+	NameSuffix string
+	// Namespace is set as the namespace of all namespaced resources.
+	Namespace string
+	// CommonLabels are added to all resources and selectors.
+	CommonLabels map[string]string
+	// CommonAnnotations are added to all resources.
+	CommonAnnotations map[string]string
+	// BuildOptions are additional options, e.g. --enable-helm, passed to
+	// kustomize build.
+	BuildOptions string
+}
+
 // Render delegates, in-process to the Argo CD repo server to render plain YAML
 // manifests from a directory containing a kustomization.yaml file. This
 // function also accepts a list of images (address/name + tag) that will be
-// substituted for older versions of the same image. Because of this capability,
-// this function is used for last-mile rendering, even when a configuration
-// management tool other than Kustomize is used for pre-rendering.
+// substituted for older versions of the same image, along with other options
+// applied to every manifest. Because of this capability, this function is used
+// for last-mile rendering, even when a configuration management tool other
+// than Kustomize is used for pre-rendering.
 func Render(
 	ctx context.Context,
 	path string,
 	images []string,
+	opts Options,
 ) ([]byte, error) {
 	kustomizeImages := make(argoappv1.KustomizeImages, len(images))
 	for i, image := range images {
@@ -31,6 +49,12 @@ func Render(
 		kustomizeImages[i] =
 			argoappv1.KustomizeImage(fmt.Sprintf("%s=%s", addr, image))
 	}
+	var kustomizeOptions *argoappv1.KustomizeOptions
+	if opts.BuildOptions != "" {
+		kustomizeOptions = &argoappv1.KustomizeOptions{
+			BuildOptions: opts.BuildOptions,
+		}
+	}
 
 	res, err := repository.GenerateManifests(
 		ctx,
@@ -46,9 +70,14 @@ func Render(
 			Repo: &argoappv1.Repository{},
 			ApplicationSource: &argoappv1.ApplicationSource{
 				Kustomize: &argoappv1.ApplicationSourceKustomize{
-					Images: kustomizeImages,
+					Images:            kustomizeImages,
+					NameSuffix:        opts.NameSuffix,
+					Namespace:         opts.Namespace,
+					CommonLabels:      opts.CommonLabels,
+					CommonAnnotations: opts.CommonAnnotations,
 				},
 			},
+			KustomizeOptions: kustomizeOptions,
 		},
 		true,
 		&git.NoopCredsStore{}, // No need for this
@@ -1,17 +1,25 @@
 package render
 
 import (
-	"os"
-
 	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/pkg/env"
 )
 
+// envOptions is logging configuration read from environment variables.
+type envOptions struct {
+	LogLevel string
+}
+
 func LoggerOrDie() *log.Logger {
+	envOpts := envOptions{}
+	if err := env.PrefixScan("KARGO_RENDER_", &envOpts); err != nil {
+		log.Fatal(err)
+	}
 	logLevel := log.InfoLevel
-	logLevelStr := os.Getenv("KARGO_RENDER_LOG_LEVEL")
-	if logLevelStr != "" {
+	if envOpts.LogLevel != "" {
 		var err error
-		if logLevel, err = log.ParseLevel(logLevelStr); err != nil {
+		if logLevel, err = log.ParseLevel(envOpts.LogLevel); err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -0,0 +1,213 @@
+package manifests
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type segmentType int
+
+const (
+	segmentTypeKey segmentType = iota
+	segmentTypeIndex
+	segmentTypeWildcard
+)
+
+type pathSegment struct {
+	segmentType segmentType
+	key         string
+	index       int
+}
+
+// FieldPath identifies zero or more fields within a resource. It is parsed
+// from a simple subset of JSONPath syntax by ParseFieldPath.
+type FieldPath []pathSegment
+
+// ParseFieldPath parses a FieldPath from a JSONPath expression consisting of a
+// sequence of child operators, each of which is one of the following:
+//
+//   - .key or ['key'] or ["key"] selects the named field of an object. The
+//     bracketed forms permit keys containing dots, e.g.
+//     .metadata.labels['helm.sh/chart'].
+//   - [n] selects the nth element of an array.
+//   - [*] or .* selects every field of an object or every element of an array.
+//
+// A leading $ is permitted, but not required.
+func ParseFieldPath(path string) (FieldPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest == "" {
+		return nil, fmt.Errorf("field path %q is empty", path)
+	}
+	var fieldPath FieldPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			switch key {
+			case "":
+				return nil, fmt.Errorf("field path %q contains an empty key", path)
+			case "*":
+				fieldPath = append(fieldPath, pathSegment{segmentType: segmentTypeWildcard})
+			default:
+				fieldPath = append(fieldPath, pathSegment{key: key})
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("field path %q contains an unterminated [", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case selector == "*":
+				fieldPath = append(fieldPath, pathSegment{segmentType: segmentTypeWildcard})
+			case len(selector) >= 2 &&
+				(selector[0] == '\'' || selector[0] == '"') &&
+				selector[len(selector)-1] == selector[0]:
+				fieldPath = append(
+					fieldPath,
+					pathSegment{key: selector[1 : len(selector)-1]},
+				)
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf(
+						"field path %q contains invalid selector [%s]",
+						path,
+						selector,
+					)
+				}
+				fieldPath = append(
+					fieldPath,
+					pathSegment{segmentType: segmentTypeIndex, index: index},
+				)
+			}
+		default:
+			return nil, fmt.Errorf(
+				"field path %q is invalid at %q; expected . or [",
+				path,
+				rest,
+			)
+		}
+	}
+	return fieldPath, nil
+}
+
+// Clear removes every field identified by the FieldPath from the provided
+// object, which is typically a resource unmarshaled into a map[string]any.
+// Array elements that are identified are not removed, since that would change
+// the indices of subsequent elements, but are instead replaced with nil.
+func (p FieldPath) Clear(obj any) {
+	if len(p) == 0 {
+		return
+	}
+	segment, rest := p[0], p[1:]
+	switch node := obj.(type) {
+	case map[string]any:
+		switch segment.segmentType {
+		case segmentTypeKey:
+			if len(rest) == 0 {
+				delete(node, segment.key)
+			} else if child, ok := node[segment.key]; ok {
+				rest.Clear(child)
+			}
+		case segmentTypeWildcard:
+			for key, child := range node {
+				if len(rest) == 0 {
+					delete(node, key)
+				} else {
+					rest.Clear(child)
+				}
+			}
+		}
+	case []any:
+		switch segment.segmentType {
+		case segmentTypeIndex:
+			if segment.index < len(node) {
+				if len(rest) == 0 {
+					node[segment.index] = nil
+				} else {
+					rest.Clear(node[segment.index])
+				}
+			}
+		case segmentTypeWildcard:
+			for i, child := range node {
+				if len(rest) == 0 {
+					node[i] = nil
+				} else {
+					rest.Clear(child)
+				}
+			}
+		}
+	}
+}
+
+// Values returns the values of every field identified by the FieldPath within
+// the provided object, which is typically a resource unmarshaled into a
+// map[string]any.
+func (p FieldPath) Values(obj any) []any {
+	var values []any
+	p.Update(obj, func(value any) any {
+		values = append(values, value)
+		return value
+	})
+	return values
+}
+
+// Update replaces the value of every field identified by the FieldPath within
+// the provided object, which is typically a resource unmarshaled into a
+// map[string]any, with the value returned by the provided function when it is
+// passed the field's current value.
+func (p FieldPath) Update(obj any, fn func(value any) any) {
+	if len(p) == 0 {
+		return
+	}
+	segment, rest := p[0], p[1:]
+	switch node := obj.(type) {
+	case map[string]any:
+		switch segment.segmentType {
+		case segmentTypeKey:
+			if child, ok := node[segment.key]; ok {
+				if len(rest) == 0 {
+					node[segment.key] = fn(child)
+				} else {
+					rest.Update(child, fn)
+				}
+			}
+		case segmentTypeWildcard:
+			for key, child := range node {
+				if len(rest) == 0 {
+					node[key] = fn(child)
+				} else {
+					rest.Update(child, fn)
+				}
+			}
+		}
+	case []any:
+		switch segment.segmentType {
+		case segmentTypeIndex:
+			if segment.index < len(node) {
+				if len(rest) == 0 {
+					node[segment.index] = fn(node[segment.index])
+				} else {
+					rest.Update(node[segment.index], fn)
+				}
+			}
+		case segmentTypeWildcard:
+			for i, child := range node {
+				if len(rest) == 0 {
+					node[i] = fn(child)
+				} else {
+					rest.Update(child, fn)
+				}
+			}
+		}
+	}
+}
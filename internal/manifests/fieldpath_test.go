@@ -0,0 +1,197 @@
+package manifests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	testCases := []struct {
+		path       string
+		assertions func(*testing.T, FieldPath, error)
+	}{
+		{
+			path: "",
+			assertions: func(t *testing.T, _ FieldPath, err error) {
+				require.ErrorContains(t, err, "is empty")
+			},
+		},
+		{
+			path: ".metadata..labels",
+			assertions: func(t *testing.T, _ FieldPath, err error) {
+				require.ErrorContains(t, err, "empty key")
+			},
+		},
+		{
+			path: ".spec.containers[0",
+			assertions: func(t *testing.T, _ FieldPath, err error) {
+				require.ErrorContains(t, err, "unterminated")
+			},
+		},
+		{
+			path: ".spec.containers[foo]",
+			assertions: func(t *testing.T, _ FieldPath, err error) {
+				require.ErrorContains(t, err, "invalid selector")
+			},
+		},
+		{
+			path: "metadata",
+			assertions: func(t *testing.T, _ FieldPath, err error) {
+				require.ErrorContains(t, err, "expected . or [")
+			},
+		},
+		{
+			path: `$.metadata.labels['helm.sh/chart']`,
+			assertions: func(t *testing.T, path FieldPath, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					FieldPath{
+						{key: "metadata"},
+						{key: "labels"},
+						{key: "helm.sh/chart"},
+					},
+					path,
+				)
+			},
+		},
+		{
+			path: `.spec.containers[*].env[1]["value"]`,
+			assertions: func(t *testing.T, path FieldPath, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					FieldPath{
+						{key: "spec"},
+						{key: "containers"},
+						{segmentType: segmentTypeWildcard},
+						{key: "env"},
+						{segmentType: segmentTypeIndex, index: 1},
+						{key: "value"},
+					},
+					path,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			path, err := ParseFieldPath(testCase.path)
+			testCase.assertions(t, path, err)
+		})
+	}
+}
+
+func TestFieldPathClear(t *testing.T) {
+	newObj := func(labels map[string]any, containers ...any) map[string]any {
+		return map[string]any{
+			"metadata": map[string]any{"labels": labels},
+			"spec":     map[string]any{"containers": containers},
+		}
+	}
+	obj := func() map[string]any {
+		return newObj(
+			map[string]any{"app": "foo", "helm.sh/chart": "foo-1.2.3"},
+			map[string]any{"name": "foo", "image": "foo:1"},
+			map[string]any{"name": "bar", "image": "bar:1"},
+		)
+	}
+	testCases := []struct {
+		path     string
+		expected map[string]any
+	}{
+		{
+			path: `.metadata.labels['helm.sh/chart']`,
+			expected: newObj(
+				map[string]any{"app": "foo"},
+				map[string]any{"name": "foo", "image": "foo:1"},
+				map[string]any{"name": "bar", "image": "bar:1"},
+			),
+		},
+		{
+			path: ".spec.containers[*].image",
+			expected: newObj(
+				map[string]any{"app": "foo", "helm.sh/chart": "foo-1.2.3"},
+				map[string]any{"name": "foo"},
+				map[string]any{"name": "bar"},
+			),
+		},
+		{
+			path: ".spec.containers[1]",
+			expected: newObj(
+				map[string]any{"app": "foo", "helm.sh/chart": "foo-1.2.3"},
+				map[string]any{"name": "foo", "image": "foo:1"},
+				nil,
+			),
+		},
+		{
+			path: ".metadata.*",
+			expected: map[string]any{
+				"metadata": map[string]any{},
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{"name": "foo", "image": "foo:1"},
+						map[string]any{"name": "bar", "image": "bar:1"},
+					},
+				},
+			},
+		},
+		{
+			path:     ".status.nonexistent",
+			expected: obj(),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			path, err := ParseFieldPath(testCase.path)
+			require.NoError(t, err)
+			actual := obj()
+			path.Clear(actual)
+			require.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestFieldPathUpdate(t *testing.T) {
+	obj := func() map[string]any {
+		return map[string]any{
+			"spec": map[string]any{
+				"containers": []any{
+					map[string]any{"name": "foo", "image": "foo:1"},
+					map[string]any{"name": "bar", "image": "bar:1"},
+				},
+			},
+		}
+	}
+	path, err := ParseFieldPath(".spec.containers[*].image")
+	require.NoError(t, err)
+
+	actual := obj()
+	require.Equal(t, []any{"foo:1", "bar:1"}, path.Values(actual))
+	require.Equal(t, obj(), actual)
+
+	path.Update(actual, func(value any) any {
+		return fmt.Sprintf("%v-updated", value)
+	})
+	require.Equal(
+		t,
+		map[string]any{
+			"spec": map[string]any{
+				"containers": []any{
+					map[string]any{"name": "foo", "image": "foo:1-updated"},
+					map[string]any{"name": "bar", "image": "bar:1-updated"},
+				},
+			},
+		},
+		actual,
+	)
+
+	// Fields that do not exist are not created
+	path, err = ParseFieldPath(".spec.initContainers[*].image")
+	require.NoError(t, err)
+	actual = obj()
+	path.Update(actual, func(any) any { return "new" })
+	require.Equal(t, obj(), actual)
+}
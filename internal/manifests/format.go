@@ -0,0 +1,119 @@
+package manifests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// SequenceStyle is a style in which YAML sequences may be written.
+type SequenceStyle string
+
+const (
+	// SequenceStyleBlock writes sequences with one item per line, each prefixed
+	// by "- ".
+	SequenceStyleBlock SequenceStyle = "block"
+	// SequenceStyleFlow writes sequences on a single line, enclosed in square
+	// brackets.
+	SequenceStyleFlow SequenceStyle = "flow"
+)
+
+// QuoteStyle is a style in which quoted YAML strings may be written.
+type QuoteStyle string
+
+const (
+	// QuoteStyleDouble writes quoted strings using double quotes.
+	QuoteStyleDouble QuoteStyle = "double"
+	// QuoteStyleSingle writes quoted strings using single quotes, except where
+	// a string contains characters that can only be represented using escape
+	// sequences, which are only available within double quotes.
+	QuoteStyleSingle QuoteStyle = "single"
+)
+
+// FormatOptions specifies how YAML manifests should be formatted. The zero
+// value of any field leaves the corresponding aspect of formatting unchanged
+// from the library's defaults.
+type FormatOptions struct {
+	// Indent is the number of spaces used for each level of indentation.
+	Indent int
+	// SequenceStyle is the style in which all sequences are written.
+	SequenceStyle SequenceStyle
+	// QuoteStyle is the style in which all strings that must be quoted, for
+	// instance because they would otherwise be interpreted as a number or
+	// boolean, are written.
+	QuoteStyle QuoteStyle
+}
+
+// Format re-encodes every YAML document in the provided manifests according to
+// the provided options. Formatting is applied uniformly, regardless of how the
+// input was formatted, so that output does not depend upon the idiosyncrasies
+// of whichever tools produced the input. Comments are preserved. Lines are
+// never wrapped.
+func Format(manifests []byte, opts FormatOptions) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(manifests))
+	docs := [][]byte{}
+	for {
+		doc := &yaml.Node{}
+		if err := dec.Decode(doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error decoding YAML document: %w", err)
+		}
+		applyStyles(doc, opts)
+		buf := &bytes.Buffer{}
+		enc := yaml.NewEncoder(buf)
+		if opts.Indent > 0 {
+			enc.SetIndent(opts.Indent)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("error encoding YAML document: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("error encoding YAML document: %w", err)
+		}
+		docs = append(docs, buf.Bytes())
+	}
+	return CombineYAML(docs), nil
+}
+
+// applyStyles recursively applies the styles specified by the provided
+// options to the provided node and all of its descendants.
+func applyStyles(node *yaml.Node, opts FormatOptions) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		switch opts.SequenceStyle {
+		case SequenceStyleBlock:
+			node.Style &^= yaml.FlowStyle
+		case SequenceStyleFlow:
+			node.Style |= yaml.FlowStyle
+		}
+	case yaml.ScalarNode:
+		quoted := node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0
+		if !quoted {
+			break
+		}
+		switch opts.QuoteStyle {
+		case QuoteStyleDouble:
+			node.Style = yaml.DoubleQuotedStyle
+		case QuoteStyleSingle:
+			if strings.IndexFunc(node.Value, requiresEscape) < 0 {
+				node.Style = yaml.SingleQuotedStyle
+			}
+		}
+	}
+	for _, child := range node.Content {
+		applyStyles(child, opts)
+	}
+}
+
+// requiresEscape returns a bool indicating whether the provided rune can only
+// be represented in YAML using an escape sequence.
+func requiresEscape(r rune) bool {
+	return r == '\n' || !unicode.IsPrint(r)
+}
@@ -0,0 +1,88 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	const manifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  # A comment
+  labels: {app: foo}
+data:
+  port: "8080"
+  enabled: 'true'
+  weird: "tab\there"
+  list: [a, b]
+---
+apiVersion: v1
+kind: List
+items:
+- a
+- b
+`
+	testCases := []struct {
+		name       string
+		opts       FormatOptions
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name: "indentation and block sequences",
+			opts: FormatOptions{
+				Indent:        4,
+				SequenceStyle: SequenceStyleBlock,
+			},
+			assertions: func(t *testing.T, formatted string, err error) {
+				require.NoError(t, err)
+				require.Contains(t, formatted, "    name: foo\n")
+				require.Contains(t, formatted, "    # A comment\n")
+				require.Contains(t, formatted, "    list:\n        - a\n        - b\n")
+				require.Contains(t, formatted, "---\n")
+			},
+		},
+		{
+			name: "flow sequences",
+			opts: FormatOptions{SequenceStyle: SequenceStyleFlow},
+			assertions: func(t *testing.T, formatted string, err error) {
+				require.NoError(t, err)
+				require.Contains(t, formatted, "items: [a, b]\n")
+			},
+		},
+		{
+			name: "double quotes",
+			opts: FormatOptions{QuoteStyle: QuoteStyleDouble},
+			assertions: func(t *testing.T, formatted string, err error) {
+				require.NoError(t, err)
+				require.Contains(t, formatted, `port: "8080"`)
+				require.Contains(t, formatted, `enabled: "true"`)
+			},
+		},
+		{
+			name: "single quotes",
+			opts: FormatOptions{QuoteStyle: QuoteStyleSingle},
+			assertions: func(t *testing.T, formatted string, err error) {
+				require.NoError(t, err)
+				require.Contains(t, formatted, `port: '8080'`)
+				require.Contains(t, formatted, `enabled: 'true'`)
+				// Cannot be represented without an escape sequence
+				require.Contains(t, formatted, `weird: "tab\there"`)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			formatted, err := Format([]byte(manifests), testCase.opts)
+			testCase.assertions(t, string(formatted), err)
+		})
+	}
+}
+
+func TestFormatInvalidYAML(t *testing.T) {
+	_, err := Format([]byte("foo: [bar"), FormatOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error decoding YAML document")
+}
@@ -0,0 +1,65 @@
+package manifests
+
+import (
+	"fmt"
+	"sort"
+
+	libyaml "sigs.k8s.io/yaml"
+)
+
+// ImageReferences returns the distinct image references, in sorted order, of
+// every container, init container, and ephemeral container, at any depth, of
+// every resource in the provided manifest. These are the fields Kustomize's
+// image transformer acts upon, e.g. the containers of a Deployment's Pod
+// template.
+func ImageReferences(manifest []byte) ([]string, error) {
+	resources, err := SplitYAMLResources(manifest)
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]struct{}{}
+	for _, resource := range resources {
+		obj := map[string]any{}
+		if err = libyaml.Unmarshal(resource.Manifest, &obj); err != nil {
+			return nil, fmt.Errorf("error unmarshaling resource: %w", err)
+		}
+		collectImageReferences(obj, refs)
+	}
+	sortedRefs := make([]string, 0, len(refs))
+	for ref := range refs {
+		sortedRefs = append(sortedRefs, ref)
+	}
+	sort.Strings(sortedRefs)
+	return sortedRefs, nil
+}
+
+// containerListKeys are the keys of the fields that hold lists of containers.
+var containerListKeys = map[string]struct{}{
+	"containers":          {},
+	"initContainers":      {},
+	"ephemeralContainers": {},
+}
+
+func collectImageReferences(obj any, refs map[string]struct{}) {
+	switch o := obj.(type) {
+	case map[string]any:
+		for key, val := range o {
+			if _, ok := containerListKeys[key]; ok {
+				if containers, ok := val.([]any); ok {
+					for _, container := range containers {
+						if c, ok := container.(map[string]any); ok {
+							if ref, ok := c["image"].(string); ok && ref != "" {
+								refs[ref] = struct{}{}
+							}
+						}
+					}
+				}
+			}
+			collectImageReferences(val, refs)
+		}
+	case []any:
+		for _, val := range o {
+			collectImageReferences(val, refs)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageReferences(t *testing.T) {
+	testCases := []struct {
+		name       string
+		manifest   []byte
+		assertions func(*testing.T, []string, error)
+	}{
+		{
+			name:     "invalid YAML",
+			manifest: []byte("kind: ["),
+			assertions: func(t *testing.T, _ []string, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "success",
+			manifest: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: foo
+        image: example.com/foo:v1.0.0
+      - name: bar
+        image: example.com/bar@sha256:abc
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: foo
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: foo
+            image: example.com/foo:v1.0.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+data:
+  image: not-an-image
+`),
+			assertions: func(t *testing.T, refs []string, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]string{
+						"busybox",
+						"example.com/bar@sha256:abc",
+						"example.com/foo:v1.0.0",
+					},
+					refs,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			refs, err := ImageReferences(testCase.manifest)
+			testCase.assertions(t, refs, err)
+		})
+	}
+}
@@ -31,8 +31,44 @@ func CombineYAML(manifests [][]byte) []byte {
 }
 
 func SplitYAML(manifest []byte) (map[string][]byte, error) {
+	resources, err := SplitYAMLResources(manifest)
+	if err != nil {
+		return nil, err
+	}
+	manifestsByResourceTypeAndName := make(map[string][]byte, len(resources))
+	for _, resource := range resources {
+		manifestsByResourceTypeAndName[resource.TypeAndName()] = resource.Manifest
+	}
+	return manifestsByResourceTypeAndName, nil
+}
+
+// Resource is a single Kubernetes resource parsed from a YAML document.
+type Resource struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Annotations are the resource's annotations.
+	Annotations map[string]string
+	// Manifest is the YAML document the resource was parsed from.
+	Manifest []byte
+}
+
+// TypeAndName returns a string of the form <name>-<kind>, in lower case, that
+// identifies the resource within a set of resources.
+func (r Resource) TypeAndName() string {
+	return fmt.Sprintf(
+		"%s-%s",
+		strings.ToLower(r.Name),
+		strings.ToLower(r.Kind),
+	)
+}
+
+// SplitYAMLResources parses each YAML document in the provided manifest as a
+// Kubernetes resource.
+func SplitYAMLResources(manifest []byte) ([]Resource, error) {
 	dec := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
-	manifestsByResourceTypeAndName := map[string][]byte{}
+	resources := []Resource{}
 	for {
 		manifest, err := dec.Read()
 		if err != nil {
@@ -43,9 +79,12 @@ func SplitYAML(manifest []byte) (map[string][]byte, error) {
 		}
 
 		resource := struct {
-			Kind     string `json:"kind"`
-			Metadata struct {
-				Name string `json:"name"`
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Namespace   string            `json:"namespace"`
+				Name        string            `json:"name"`
+				Annotations map[string]string `json:"annotations"`
 			} `json:"metadata"`
 		}{}
 		if err := libyaml.Unmarshal(manifest, &resource); err != nil {
@@ -57,12 +96,14 @@ func SplitYAML(manifest []byte) (map[string][]byte, error) {
 		if resource.Metadata.Name == "" {
 			return nil, errors.New("resource is missing metadata.name field")
 		}
-		resourceTypeAndName := fmt.Sprintf(
-			"%s-%s",
-			strings.ToLower(resource.Metadata.Name),
-			strings.ToLower(resource.Kind),
-		)
-		manifestsByResourceTypeAndName[resourceTypeAndName] = manifest
+		resources = append(resources, Resource{
+			APIVersion:  resource.APIVersion,
+			Kind:        resource.Kind,
+			Namespace:   resource.Metadata.Namespace,
+			Name:        resource.Metadata.Name,
+			Annotations: resource.Metadata.Annotations,
+			Manifest:    manifest,
+		})
 	}
-	return manifestsByResourceTypeAndName, nil
+	return resources, nil
 }
@@ -161,3 +161,26 @@ metadata:
 		})
 	}
 }
+
+func TestSplitYAMLResources(t *testing.T) {
+	resources, err := SplitYAMLResources([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: Foo
+  namespace: bar
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: bar
+`))
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.Equal(t, "apps/v1", resources[0].APIVersion)
+	require.Equal(t, "Deployment", resources[0].Kind)
+	require.Equal(t, "bar", resources[0].Namespace)
+	require.Equal(t, "Foo", resources[0].Name)
+	require.Equal(t, "foo-deployment", resources[0].TypeAndName())
+	require.Empty(t, resources[1].Namespace)
+	require.Equal(t, "bar-namespace", resources[1].TypeAndName())
+}
@@ -0,0 +1,84 @@
+package manifests
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// syncWaveAnnotation is the annotation Argo CD uses to order the syncing of
+	// resources within a sync phase.
+	syncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+	// hookAnnotation is the annotation Argo CD uses to designate a resource as
+	// a hook that is synced in a particular sync phase.
+	hookAnnotation = "argocd.argoproj.io/hook"
+	// helmHookAnnotation is the annotation Helm uses to designate a resource as
+	// a hook. Argo CD maps Helm hooks to its own sync phases.
+	helmHookAnnotation = "helm.sh/hook"
+)
+
+// syncPhaseRanks maps Argo CD hook types, and the Helm hook types Argo CD maps
+// to them, to the order of the sync phases they run in. Resources that are not
+// hooks are synced in the Sync phase.
+var syncPhaseRanks = map[string]int{
+	"PreSync":      0,
+	"pre-install":  0,
+	"pre-upgrade":  0,
+	"Sync":         1,
+	"PostSync":     2,
+	"post-install": 2,
+	"post-upgrade": 2,
+	"SyncFail":     3,
+}
+
+// syncPhaseRank returns the rank of the sync phase the resource is synced in.
+// If a hook is of more than one type, the earliest phase is used.
+func (r Resource) syncPhaseRank() int {
+	hooks := r.Annotations[hookAnnotation]
+	if hooks == "" {
+		hooks = r.Annotations[helmHookAnnotation]
+	}
+	rank := -1
+	for _, hook := range strings.Split(hooks, ",") {
+		if hookRank, ok := syncPhaseRanks[strings.TrimSpace(hook)]; ok &&
+			(rank < 0 || hookRank < rank) {
+			rank = hookRank
+		}
+	}
+	if rank < 0 {
+		return syncPhaseRanks["Sync"]
+	}
+	return rank
+}
+
+// syncWave returns the sync wave of the resource. Like Argo CD, it treats a
+// missing or invalid wave as wave zero.
+func (r Resource) syncWave() int {
+	wave, _ := strconv.Atoi(strings.TrimSpace(r.Annotations[syncWaveAnnotation]))
+	return wave
+}
+
+// SortBySyncOrder re-orders the YAML documents in the provided manifest in the
+// order Argo CD would sync them: by sync phase, as determined by hook
+// annotations, and then by sync wave. The relative order of documents in the
+// same phase and wave is preserved. This permits the result to be applied
+// cleanly with kubectl.
+func SortBySyncOrder(manifest []byte) ([]byte, error) {
+	resources, err := SplitYAMLResources(manifest)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		if iRank, jRank := resources[i].syncPhaseRank(),
+			resources[j].syncPhaseRank(); iRank != jRank {
+			return iRank < jRank
+		}
+		return resources[i].syncWave() < resources[j].syncWave()
+	})
+	docs := make([][]byte, len(resources))
+	for i, resource := range resources {
+		docs[i] = resource.Manifest
+	}
+	return CombineYAML(docs), nil
+}
@@ -0,0 +1,89 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortBySyncOrder(t *testing.T) {
+	testCases := []struct {
+		name       string
+		manifest   string
+		assertions func(*testing.T, []byte, error)
+	}{
+		{
+			name:     "invalid manifest",
+			manifest: "metadata:\n  name: foo\n",
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "missing kind field")
+			},
+		},
+		{
+			name: "sorted by phase, then wave",
+			manifest: `kind: Job
+metadata:
+  name: smoke-test
+  annotations:
+    argocd.argoproj.io/hook: PostSync
+---
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    argocd.argoproj.io/sync-wave: "1"
+---
+kind: ConfigMap
+metadata:
+  name: config
+---
+kind: Namespace
+metadata:
+  name: ns
+  annotations:
+    argocd.argoproj.io/sync-wave: "-1"
+---
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+---
+kind: Service
+metadata:
+  name: app
+  annotations:
+    argocd.argoproj.io/sync-wave: bogus
+`,
+			assertions: func(t *testing.T, sorted []byte, err error) {
+				require.NoError(t, err)
+				resources, err := SplitYAMLResources(sorted)
+				require.NoError(t, err)
+				names := make([]string, len(resources))
+				for i, resource := range resources {
+					names[i] = resource.TypeAndName()
+				}
+				require.Equal(
+					t,
+					[]string{
+						"migrate-job",
+						"ns-namespace",
+						"config-configmap",
+						"app-service",
+						"app-deployment",
+						"smoke-test-job",
+					},
+					names,
+				)
+				// Annotations survive sorting
+				require.Contains(t, string(sorted), "argocd.argoproj.io/hook: PostSync")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sorted, err := SortBySyncOrder([]byte(testCase.manifest))
+			testCase.assertions(t, sorted, err)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package version
+
+import (
+	"os/exec"
+	"regexp"
+	"runtime/debug"
+	"sync"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// UnknownVersion is reported for any tool whose version cannot be determined,
+// including tools that are not installed.
+const UnknownVersion = "unknown"
+
+// argoCDModulePath is the path of the Go module that provides the Argo CD
+// library Kargo Render uses for rendering.
+const argoCDModulePath = "github.com/argoproj/argo-cd/v2"
+
+// toolVersionRegex matches the version number in the output of a tool's
+// version command.
+var toolVersionRegex = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// Tools encapsulates the versions of the external tools and libraries upon
+// which rendering depends. Rendered manifests can only be reproduced reliably
+// using the same versions of all of these.
+type Tools struct {
+	// GitVersion is the version of the git binary.
+	GitVersion string
+	// HelmVersion is the version of the helm binary.
+	HelmVersion string
+	// KustomizeVersion is the version of the kustomize binary.
+	KustomizeVersion string
+	// YttVersion is the version of the ytt binary.
+	YttVersion string
+	// ArgoCDVersion is the version of the Argo CD library that is embedded in
+	// Kargo Render.
+	ArgoCDVersion string
+}
+
+var getTools = sync.OnceValue(func() Tools {
+	tools := Tools{
+		GitVersion:       UnknownVersion,
+		HelmVersion:      binaryVersion("helm", "version", "--short"),
+		KustomizeVersion: binaryVersion("kustomize", "version"),
+		YttVersion:       binaryVersion("ytt", "version"),
+		ArgoCDVersion:    moduleVersion(argoCDModulePath),
+	}
+	if gitVersion, err := git.BinaryVersion(); err == nil {
+		tools.GitVersion = gitVersion
+	}
+	return tools
+})
+
+// GetTools returns the versions of the external tools and libraries upon which
+// rendering depends. The tools are only consulted upon the first call.
+// Subsequent calls return the same result.
+func GetTools() Tools {
+	return getTools()
+}
+
+// binaryVersion executes the specified binary with the specified arguments and
+// returns the first version number found in its output.
+func binaryVersion(name string, arg ...string) string {
+	cmd := exec.Command(name, arg...)
+	cmd.Env = libExec.Environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return UnknownVersion
+	}
+	return parseToolVersion(string(out))
+}
+
+// parseToolVersion returns the first version number found in the output of a
+// tool's version command.
+func parseToolVersion(out string) string {
+	if v := toolVersionRegex.FindString(out); v != "" {
+		return v
+	}
+	return UnknownVersion
+}
+
+// moduleVersion returns the version of the specified Go module that was used
+// to build the application.
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return UnknownVersion
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == path {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return UnknownVersion
+}
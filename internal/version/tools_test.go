@@ -0,0 +1,46 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToolVersion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		out      string
+		expected string
+	}{
+		{
+			name:     "no version",
+			out:      "command not found",
+			expected: UnknownVersion,
+		},
+		{
+			name:     "helm",
+			out:      "v3.14.2+gc309b6f\n",
+			expected: "3.14.2",
+		},
+		{
+			name:     "kustomize",
+			out:      "v5.3.0\n",
+			expected: "5.3.0",
+		},
+		{
+			name:     "older kustomize",
+			out:      "{Version:kustomize/v4.5.7 GitCommit:56d82a8 BuildDate:2022-08-02T16:35:54Z}",
+			expected: "4.5.7",
+		},
+		{
+			name:     "ytt",
+			out:      "ytt version 0.46.0\n",
+			expected: "0.46.0",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, parseToolVersion(testCase.out))
+		})
+	}
+}
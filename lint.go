@@ -0,0 +1,203 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	libExec "github.com/akuity/kargo-render/internal/exec"
+)
+
+// Linters that may check the input of an app.
+const (
+	linterHelm      = "helm"
+	linterKustomize = "kustomize"
+	linterYtt       = "ytt"
+)
+
+// defaultLintTimeout is the maximum amount of time each linter may run when
+// rendering the app it checks is not limited.
+const defaultLintTimeout = 5 * time.Minute
+
+// lintApps runs the linters of every app whose configuration enables linting
+// against the app's input in the provided repository and returns what they
+// found. If any app's lint configuration says to fail when problems are found,
+// a LintError is returned for the first such app instead. Apps are linted in
+// order by name so that the result is deterministic.
+func lintApps(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+) ([]LintFinding, error) {
+	appNames := make([]string, 0, len(rc.target.branchConfig.AppConfigs))
+	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+		if appConfig.Lint != nil {
+			appNames = append(appNames, appName)
+		}
+	}
+	sort.Strings(appNames)
+	var findings []LintFinding
+	for i, appName := range appNames {
+		appConfig := rc.target.branchConfig.AppConfigs[appName]
+		start := rc.timings.startApp(StageLint, appName, i+1, len(appNames))
+		appFindings, err := lintApp(ctx, rc, repoRoot, appName, appConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error linting app %q: %w", appName, err)
+		}
+		rc.timings.record(StageLint, appName, start)
+		for _, finding := range appFindings {
+			if appConfig.Lint.OnFailure != violationActionWarn {
+				return nil, &LintError{Finding: finding}
+			}
+			rc.logger.WithFields(log.Fields{
+				"app":    appName,
+				"linter": finding.Linter,
+			}).Warn("linter found problems with the app's input")
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// lintApp runs the linters applicable to the specified app against its input
+// and returns a LintFinding for each linter that found problems.
+func lintApp(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+	appName string,
+	appConfig appConfig,
+) ([]LintFinding, error) {
+	cfg := appConfig.ConfigManagement
+	appDir := filepath.Join(repoRoot, cfg.Path)
+	sourceType, err := argocd.SourceType(ctx, repoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var linters []string
+	var cmds []*exec.Cmd
+	switch sourceType {
+	case "Helm":
+		// Inline values are written to a file of their own for helm lint
+		tmpDir, err := os.MkdirTemp("", "lint-")
+		if err != nil {
+			return nil, fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		args, err := helmLintArgs(appDir, tmpDir, cfg.Helm)
+		if err != nil {
+			return nil, err
+		}
+		linters = append(linters, linterHelm)
+		cmds = append(cmds, exec.Command(linterHelm, args...))
+	case "Kustomize":
+		args := []string{"build", "."}
+		if cfg.Kustomize != nil {
+			args = append(args, strings.Fields(cfg.Kustomize.BuildOptions)...)
+		}
+		linters = append(linters, linterKustomize)
+		cmds = append(cmds, exec.Command(linterKustomize, args...))
+	}
+	if len(appConfig.Lint.YttFiles) > 0 {
+		args := make([]string, 0, 2*len(appConfig.Lint.YttFiles))
+		for _, path := range appConfig.Lint.YttFiles {
+			args = append(args, "--file", path)
+		}
+		linters = append(linters, linterYtt)
+		cmds = append(cmds, exec.Command(linterYtt, args...))
+	}
+
+	// Linters are held to the same limit as rendering the app, or to a default
+	// one if rendering is not limited, so that a hung linter can't stall the
+	// request
+	timeout := appConfig.renderTimeout(rc.renderTimeout)
+	if timeout == 0 {
+		timeout = defaultLintTimeout
+	}
+	var findings []LintFinding
+	for i, cmd := range cmds {
+		cmd.Dir = appDir
+		_, err = libExec.Exec(
+			ctx,
+			cmd,
+			&libExec.Options{
+				Timeout:      timeout,
+				Logger:       rc.logger,
+				Observer:     rc.commands.observeResult,
+				EnvAllowlist: toolEnvAllowlist(rc.toolEnv, linters[i]),
+			},
+		)
+		exitErr := &libExec.ExitError{}
+		if errors.As(err, &exitErr) {
+			findings = append(findings, LintFinding{
+				App:    appName,
+				Linter: linters[i],
+				Output: strings.TrimSpace(string(exitErr.Output)),
+			})
+		} else if err != nil {
+			return nil, fmt.Errorf("error running %s: %w", linters[i], err)
+		}
+	}
+	return findings, nil
+}
+
+// helmLintArgs returns arguments for linting the chart in the specified
+// directory using helm lint with the provided values and parameters. Inline
+// values are written to a file in the provided temporary directory.
+func helmLintArgs(
+	chartDir string,
+	tmpDir string,
+	cfg *argocd.ApplicationSourceHelm,
+) ([]string, error) {
+	args := []string{"lint", "."}
+	if cfg == nil {
+		return args, nil
+	}
+	if cfg.Namespace != "" {
+		args = append(args, "--namespace", cfg.Namespace)
+	}
+	for _, valueFile := range cfg.ValueFiles {
+		if cfg.IgnoreMissingValueFiles {
+			if _, err := os.Stat(filepath.Join(chartDir, valueFile)); err != nil {
+				continue
+			}
+		}
+		args = append(args, "--values", valueFile)
+	}
+	var values []byte
+	switch {
+	case cfg.ValuesObject != nil && len(cfg.ValuesObject.Raw) > 0:
+		// JSON is valid YAML
+		values = cfg.ValuesObject.Raw
+	case cfg.Values != "":
+		values = []byte(cfg.Values)
+	}
+	if len(values) > 0 {
+		valuesPath := filepath.Join(tmpDir, "values.yaml")
+		if err := os.WriteFile(valuesPath, values, 0600); err != nil {
+			return nil, fmt.Errorf("error writing inline values: %w", err)
+		}
+		args = append(args, "--values", valuesPath)
+	}
+	for _, param := range cfg.Parameters {
+		flag := "--set"
+		if param.ForceString {
+			flag = "--set-string"
+		}
+		args = append(args, flag, fmt.Sprintf("%s=%s", param.Name, param.Value))
+	}
+	for _, param := range cfg.FileParameters {
+		args = append(args, "--set-file", fmt.Sprintf("%s=%s", param.Name, param.Path))
+	}
+	return args, nil
+}
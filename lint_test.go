@@ -0,0 +1,226 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestLintApps(t *testing.T) {
+	// Fake linters echo their arguments and fail if any argument ends in "bad"
+	binDir := t.TempDir()
+	for _, linter := range []string{linterHelm, linterKustomize, linterYtt} {
+		require.NoError(
+			t,
+			os.WriteFile(
+				filepath.Join(binDir, linter),
+				[]byte(`#!/bin/sh
+echo "$(basename "$0") $*"
+for arg in "$@"; do
+  case "$arg" in *bad)
+    echo "Error: something is wrong" >&2
+    exit 1
+  esac
+done
+`),
+				0700, // nolint: gosec
+			),
+		)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	repoRoot := t.TempDir()
+	for path, contents := range map[string]string{
+		"chart/Chart.yaml":                 "apiVersion: v2\nname: chart\nversion: 0.1.0\n",
+		"chart/values-dev.yaml":            "replicas: 1\n",
+		"kustomize/kustomization.yaml":     "resources: []\n",
+		"kustomize/ytt/schema.yaml":        "#@data/values-schema\n---\n",
+		"directory/configmap.yaml":         "kind: ConfigMap\n",
+		"kustomize-bad/kustomization.yaml": "resources: []\n",
+	} {
+		path = filepath.Join(repoRoot, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	}
+
+	testCases := []struct {
+		name       string
+		appConfigs map[string]appConfig
+		assertions func(*testing.T, []LintFinding, error)
+	}{
+		{
+			name: "linting not enabled",
+			appConfigs: map[string]appConfig{
+				"foo": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path:      "kustomize-bad",
+						Kustomize: &argocd.ApplicationSourceKustomize{BuildOptions: "bad"},
+					},
+				},
+			},
+			assertions: func(t *testing.T, findings []LintFinding, err error) {
+				require.NoError(t, err)
+				require.Empty(t, findings)
+			},
+		},
+		{
+			name: "no problems found",
+			appConfigs: map[string]appConfig{
+				"foo": {
+					ConfigManagement: argocd.ConfigManagementConfig{Path: "directory"},
+					Lint:             &lintConfig{},
+				},
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{Path: "kustomize"},
+					Lint: &lintConfig{
+						YttFiles: []string{"ytt/schema.yaml"},
+					},
+				},
+			},
+			assertions: func(t *testing.T, findings []LintFinding, err error) {
+				require.NoError(t, err)
+				require.Empty(t, findings)
+			},
+		},
+		{
+			name: "problems found with warnings configured",
+			appConfigs: map[string]appConfig{
+				"foo": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path: "chart",
+						Helm: &argocd.ApplicationSourceHelm{
+							ApplicationSourceHelm: argoappv1.ApplicationSourceHelm{
+								ValueFiles: []string{"values-dev.yaml", "values-missing.yaml"},
+								Parameters: []argoappv1.HelmParameter{
+									{Name: "image.tag", Value: "bad", ForceString: true},
+								},
+								IgnoreMissingValueFiles: true,
+							},
+							Namespace: "dev",
+						},
+					},
+					Lint: &lintConfig{OnFailure: violationActionWarn},
+				},
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{Path: "kustomize"},
+					Lint: &lintConfig{
+						OnFailure: violationActionWarn,
+						YttFiles:  []string{"bad"},
+					},
+				},
+			},
+			assertions: func(t *testing.T, findings []LintFinding, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]LintFinding{
+						{
+							App:    "bar",
+							Linter: linterYtt,
+							Output: "ytt --file bad\nError: something is wrong",
+						},
+						{
+							App:    "foo",
+							Linter: linterHelm,
+							Output: "helm lint . --namespace dev --values values-dev.yaml " +
+								"--set-string image.tag=bad\nError: something is wrong",
+						},
+					},
+					findings,
+				)
+			},
+		},
+		{
+			name: "problems found",
+			appConfigs: map[string]appConfig{
+				"foo": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path:      "kustomize-bad",
+						Kustomize: &argocd.ApplicationSourceKustomize{BuildOptions: "bad"},
+					},
+					Lint: &lintConfig{},
+				},
+			},
+			assertions: func(t *testing.T, _ []LintFinding, err error) {
+				lintErr := &LintError{}
+				require.ErrorAs(t, err, &lintErr)
+				require.Equal(
+					t,
+					LintFinding{
+						App:    "foo",
+						Linter: linterKustomize,
+						Output: "kustomize build . bad\nError: something is wrong",
+					},
+					lintErr.Finding,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				logger:  log.NewEntry(log.New()),
+				request: &Request{},
+				timings: &timings{},
+			}
+			rc.target.branchConfig.AppConfigs = testCase.appConfigs
+			findings, err := lintApps(context.Background(), rc, repoRoot)
+			testCase.assertions(t, findings, err)
+		})
+	}
+}
+
+func TestLintAppsTimeout(t *testing.T) {
+	// The fake kustomize takes far longer than the timeout
+	binDir := t.TempDir()
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(binDir, linterKustomize),
+			[]byte("#!/bin/sh\nsleep 5\n"),
+			0700, // nolint: gosec
+		),
+	)
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	repoRoot := t.TempDir()
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(repoRoot, "kustomization.yaml"),
+			[]byte("resources: []\n"),
+			0600,
+		),
+	)
+
+	rc := requestContext{
+		logger:        log.NewEntry(log.New()),
+		request:       &Request{},
+		timings:       &timings{},
+		commands:      &commandTrace{},
+		renderTimeout: 100 * time.Millisecond,
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"foo": {Lint: &lintConfig{}},
+	}
+	start := time.Now()
+	_, err := lintApps(context.Background(), rc, repoRoot)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+	// The linter that timed out is traced
+	diagnostics := rc.commands.diagnostics()
+	require.Len(t, diagnostics.Commands, 1)
+	require.Equal(
+		t,
+		filepath.Join(binDir, linterKustomize)+" build .",
+		diagnostics.Commands[0].Command,
+	)
+	require.Equal(t, -1, diagnostics.Commands[0].ExitCode)
+}
@@ -0,0 +1,244 @@
+package render
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// localOutput is a local path to which rendered manifests are written, whether
+// it was specified using a Request's LocalOutPath or its Outputs.
+type localOutput struct {
+	// path is where the rendered manifests are written.
+	path string
+	// opts customizes what is written to path.
+	opts LocalOutOptions
+	// index is the position of the output among the request's local outputs.
+	// It distinguishes the temporary directories of outputs written as tar
+	// archives.
+	index int
+}
+
+// preparedLocalOutput is a localOutput along with the directory the rendered
+// manifests were written to in order to fulfill it.
+type preparedLocalOutput struct {
+	localOutput
+	// dir is the directory the rendered manifests were written to. It differs
+	// from path when a tar archive is written to path.
+	dir string
+	// finished indicates whether the output was written in its entirety.
+	finished bool
+	// metadata is the content of the branch metadata that was excluded from
+	// the output, if any.
+	metadata []byte
+}
+
+// localOutputs returns the local outputs of the Request, in order.
+func (r *Request) localOutputs() []localOutput {
+	if r.LocalOutPath != "" {
+		out := localOutput{path: r.LocalOutPath}
+		if r.LocalOut != nil {
+			out.opts = *r.LocalOut
+		}
+		return []localOutput{out}
+	}
+	var outs []localOutput
+	for _, output := range r.Outputs {
+		if output.Type != OutputTypeLocal {
+			continue
+		}
+		out := localOutput{path: output.Path, index: len(outs)}
+		if output.LocalOut != nil {
+			out.opts = *output.LocalOut
+		}
+		outs = append(outs, out)
+	}
+	return outs
+}
+
+// prepareLocalOutput returns the directory rendered manifests should be
+// written to in order to fulfill the provided local output. Unless the output
+// calls for manifests only, the directory is seeded with the contents of the
+// specified source directory, which is usually the working tree of the target
+// branch. When the output calls for a tar archive, the directory is a
+// temporary one within the repository's home directory.
+func prepareLocalOutput(
+	ctx context.Context,
+	rc requestContext,
+	out localOutput,
+	srcDir string,
+) (string, error) {
+	outputDir := out.path
+	if out.opts.Format == LocalOutFormatTar {
+		outputDir = filepath.Join(
+			rc.repo.HomeDir(),
+			fmt.Sprintf("local-out-%d", out.index),
+		)
+	}
+	if out.opts.ManifestsOnly {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return "", fmt.Errorf(
+				"error creating local output directory %q: %w",
+				outputDir,
+				err,
+			)
+		}
+		return outputDir, nil
+	}
+	if err := copyBranchContents(
+		ctx,
+		srcDir,
+		outputDir,
+		rc.target.symlinks,
+		rc.commands,
+	); err != nil {
+		return "", fmt.Errorf(
+			"error copying branch contents to local output directory %q: %w",
+			outputDir,
+			err,
+		)
+	}
+	return outputDir, nil
+}
+
+// copyLocalOutput returns a directory to which the rendered manifests, along
+// with the target branch's metadata, merged files, and the provided report,
+// have been copied
+// from the specified source directory, to which they have already been
+// written, in order to fulfill the provided local output. Local output is not
+// a branch, so metadata is always written to it, even if it is stored outside
+// of the target branch.
+func copyLocalOutput(
+	ctx context.Context,
+	rc requestContext,
+	out localOutput,
+	srcDir string,
+	report *RenderReport,
+) (string, error) {
+	outputDir, err := prepareLocalOutput(ctx, rc, out, srcDir)
+	if err != nil {
+		return "", err
+	}
+	if err = writeBranchMetadata(
+		rc.target.newBranchMetadata,
+		outputDir,
+	); err != nil {
+		return "", fmt.Errorf("error writing branch metadata: %w", err)
+	}
+	if out.opts.ManifestsOnly {
+		if _, err = mergeFiles(rc, outputDir); err != nil {
+			return "", err
+		}
+		if err = writeReport(report, outputDir); err != nil {
+			return "", err
+		}
+		if err = writeAllManifests(rc, outputDir); err != nil {
+			return "", err
+		}
+	}
+	return outputDir, nil
+}
+
+// finishLocalOutput applies any options of the provided local output that
+// take effect after rendered manifests have been written to the specified
+// directory. If branch metadata is excluded from the output, the content of
+// the metadata file that was removed is returned so that it is not lost.
+func finishLocalOutput(out localOutput, outputDir string) ([]byte, error) {
+	var metadata []byte
+	if out.opts.ExcludeMetadata {
+		bkDir := filepath.Join(outputDir, ".kargo-render")
+		var err error
+		if metadata, err = os.ReadFile(
+			filepath.Join(bkDir, "metadata.yaml"),
+		); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading branch metadata: %w", err)
+		}
+		if err = os.RemoveAll(bkDir); err != nil {
+			return nil, fmt.Errorf("error removing branch metadata from local output: %w", err)
+		}
+	}
+	if out.opts.Format == LocalOutFormatTar {
+		if err := writeTarArchive(outputDir, out.path); err != nil {
+			return nil, fmt.Errorf(
+				"error writing tar archive %q: %w",
+				out.path,
+				err,
+			)
+		}
+	}
+	return metadata, nil
+}
+
+// writeTarArchive writes the contents of the specified directory to an
+// uncompressed tar archive at the specified path. Paths within the archive are
+// relative to the directory. If the archive cannot be written in its entirety,
+// nothing is left at the specified path.
+func writeTarArchive(srcDir, path string) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(path)
+		}
+	}()
+	tw := tar.NewWriter(f)
+	if err = filepath.WalkDir(
+		srcDir,
+		func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(srcDir, filePath)
+			if err != nil {
+				return err
+			}
+			if relPath == "." {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			var link string
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				if link, err = os.Readlink(filePath); err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(fi, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(relPath)
+			if fi.IsDir() {
+				hdr.Name += "/"
+			}
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			src, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			_, err = io.Copy(tw, src)
+			return err
+		},
+	); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
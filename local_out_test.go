@@ -0,0 +1,99 @@
+package render
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinishLocalOutput(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       *LocalOutOptions
+		assertions func(t *testing.T, outputDir, outPath string, metadata []byte, err error)
+	}{
+		{
+			name: "defaults",
+			assertions: func(t *testing.T, outputDir, _ string, metadata []byte, err error) {
+				require.NoError(t, err)
+				require.Nil(t, metadata)
+				require.FileExists(t, filepath.Join(outputDir, ".kargo-render", "metadata.yaml"))
+				require.FileExists(t, filepath.Join(outputDir, "app", "all.yaml"))
+			},
+		},
+		{
+			name: "metadata excluded",
+			opts: &LocalOutOptions{ExcludeMetadata: true},
+			assertions: func(t *testing.T, outputDir, _ string, metadata []byte, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "sourceCommit: abc123\n", string(metadata))
+				require.NoDirExists(t, filepath.Join(outputDir, ".kargo-render"))
+				require.FileExists(t, filepath.Join(outputDir, "app", "all.yaml"))
+			},
+		},
+		{
+			name: "tar archive",
+			opts: &LocalOutOptions{
+				ExcludeMetadata: true,
+				Format:          LocalOutFormatTar,
+			},
+			assertions: func(t *testing.T, _, outPath string, metadata []byte, err error) {
+				require.NoError(t, err)
+				require.NotEmpty(t, metadata)
+				f, err := os.Open(outPath)
+				require.NoError(t, err)
+				defer f.Close()
+				contents := map[string]string{}
+				tr := tar.NewReader(f)
+				for {
+					hdr, err := tr.Next()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					require.NoError(t, err)
+					data, err := io.ReadAll(tr)
+					require.NoError(t, err)
+					contents[hdr.Name] = string(data)
+				}
+				require.Equal(
+					t,
+					map[string]string{
+						"app/":         "",
+						"app/all.yaml": "kind: ConfigMap\n",
+					},
+					contents,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			outPath := filepath.Join(t.TempDir(), "out.tar")
+			require.NoError(t, writeBranchMetadata(
+				branchMetadata{SourceCommit: "abc123"},
+				outputDir,
+			))
+			require.NoError(t, os.Mkdir(filepath.Join(outputDir, "app"), 0755))
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(outputDir, "app", "all.yaml"),
+					[]byte("kind: ConfigMap\n"),
+					0644,
+				),
+			)
+			req := &Request{
+				LocalOutPath: outPath,
+				LocalOut:     testCase.opts,
+			}
+			metadata, err := finishLocalOutput(req.localOutputs()[0], outputDir)
+			testCase.assertions(t, outputDir, outPath, metadata, err)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Locker is an interface for components that can acquire locks that are
+// exclusive across all replicas of a server built on Kargo Render.
+type Locker interface {
+	// Lock blocks until the lock identified by the specified key is acquired
+	// or the provided context is canceled. It returns a function that must be
+	// called to release the lock. Implementations hold locks for a limited
+	// time, renewing them for as long as they are held, so that a lock held by
+	// a replica that dies is eventually released. The returned context, which
+	// is derived from the provided one, is canceled if the lock cannot be
+	// renewed, since another replica may then acquire it. Work that requires
+	// the lock should use that context.
+	Lock(
+		ctx context.Context,
+		key string,
+	) (lockCtx context.Context, unlock func(), err error)
+}
+
+// lockingService is a Service implementation that decorates another Service,
+// ensuring that no two requests that write to the same branch of the same
+// repository are handled at once, even by different replicas.
+type lockingService struct {
+	svc    Service
+	locker Locker
+}
+
+// NewLockingService returns an implementation of the Service interface that
+// decorates the provided Service. Before handling a rendering request or
+// applying a Plan, it uses the provided Locker to acquire a lock on the
+// repository and target branch in question. This prevents multiple replicas of
+// a server from concurrently rendering into the same branch. Requests that do
+// not write to a remote repository, and the creation of Plans, do not require
+// a lock. If the lock is lost while a request is being handled, the request is
+// canceled and a LockLostError is returned.
+func NewLockingService(svc Service, locker Locker) Service {
+	return &lockingService{
+		svc:    svc,
+		locker: locker,
+	}
+}
+
+// Plan creates a plan using the decorated Service. Creating a plan writes
+// nothing, so no lock is required.
+func (l *lockingService) Plan(ctx context.Context, req *Request) (Plan, error) {
+	return l.svc.Plan(ctx, req)
+}
+
+func (l *lockingService) Apply(
+	ctx context.Context,
+	req *ApplyRequest,
+) (Response, error) {
+	lockCtx, unlock, err := l.locker.Lock(
+		ctx,
+		branchKey(req.Plan.RepoURL, req.Plan.TargetBranch),
+	)
+	if err != nil {
+		return Response{}, err
+	}
+	defer unlock()
+	res, err := l.svc.Apply(lockCtx, req)
+	return res, lockLost(ctx, lockCtx, req.Plan.RepoURL, req.Plan.TargetBranch, err)
+}
+
+// WarmUp warms up the decorated Service. Warming up writes nothing, so no
+// lock is required.
+func (l *lockingService) WarmUp(
+	ctx context.Context,
+	req *WarmUpRequest,
+) (WarmUpResponse, error) {
+	return l.svc.WarmUp(ctx, req)
+}
+
+// RenderWorkspace renders a workspace using the decorated Service. The caller
+// owns the workspace and is responsible for writing to the remote repository,
+// so no lock is required.
+func (l *lockingService) RenderWorkspace(
+	ctx context.Context,
+	req *WorkspaceRequest,
+) (WorkspaceResponse, error) {
+	return l.svc.RenderWorkspace(ctx, req)
+}
+
+// NewPipeline returns a Pipeline from the decorated Service. No lock could be
+// held across stages that the caller may run at any time, or never, so no lock
+// is acquired and callers publishing to the same branch concurrently must
+// serialize their Pipelines themselves.
+func (l *lockingService) NewPipeline(req *Request) (*Pipeline, error) {
+	return l.svc.NewPipeline(req)
+}
+
+func (l *lockingService) RenderManifests(
+	ctx context.Context,
+	req *Request,
+) (Response, error) {
+	if req.LocalInPath != "" || !req.writesToRemote() {
+		return l.svc.RenderManifests(ctx, req)
+	}
+	lockCtx, unlock, err := l.locker.Lock(
+		ctx,
+		branchKey(req.RepoURL, req.TargetBranch),
+	)
+	if err != nil {
+		return Response{}, err
+	}
+	defer unlock()
+	res, err := l.svc.RenderManifests(lockCtx, req)
+	return res, lockLost(ctx, lockCtx, req.RepoURL, req.TargetBranch, err)
+}
+
+// lockLost returns a LockLostError if the provided lock context was canceled
+// because the lock on the specified branch was lost, rather than because the
+// provided context, from which it was derived, was canceled. Otherwise, the
+// provided error is returned.
+func lockLost(
+	ctx context.Context,
+	lockCtx context.Context,
+	repoURL string,
+	branch string,
+	err error,
+) error {
+	if ctx.Err() != nil || lockCtx.Err() == nil {
+		return err
+	}
+	return &LockLostError{
+		RepoURL:      repoURL,
+		TargetBranch: branch,
+		Err:          context.Cause(lockCtx),
+	}
+}
+
+// branchKey returns a key that uniquely identifies the specified branch of the
+// specified repository.
+func branchKey(repoURL, branch string) string {
+	return strings.Join(
+		[]string{
+			strings.TrimSpace(repoURL),
+			strings.TrimPrefix(strings.TrimSpace(branch), "refs/heads/"),
+		},
+		"\x00",
+	)
+}
+
+// keepAlive invokes renew at the specified interval until the returned
+// function is called. It returns a context, derived from the provided one,
+// that is canceled if renew fails, since the lock being renewed may then be
+// acquired by another replica before it is renewed again.
+func keepAlive(
+	ctx context.Context,
+	renew func(context.Context) error,
+	interval time.Duration,
+) (lockCtx context.Context, stop func()) {
+	lockCtx, cancelLock := context.WithCancelCause(ctx)
+	// Renewal continues until the lock is released, even if the provided
+	// context is canceled first
+	renewCtx, cancelRenew := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := renew(renewCtx); err != nil {
+					if renewCtx.Err() == nil {
+						cancelLock(fmt.Errorf("error renewing lock: %w", err))
+					}
+					return
+				}
+			case <-renewCtx.Done():
+				return
+			}
+		}
+	}()
+	return lockCtx, func() {
+		cancelRenew()
+		<-done
+		cancelLock(nil)
+	}
+}
+
+// lockRetryInterval is how long Lockers wait before trying again to acquire a
+// lock that is held by another replica.
+const lockRetryInterval = 250 * time.Millisecond
+
+// waitToRetry blocks until it is time to try again to acquire a lock or the
+// provided context is canceled, in which case the context's error is returned.
+func waitToRetry(ctx context.Context) error {
+	select {
+	case <-time.After(lockRetryInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,178 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// leaseLocker is a Locker implementation backed by Kubernetes Leases.
+type leaseLocker struct {
+	client        coordinationv1client.LeasesGetter
+	namespace     string
+	leaseDuration time.Duration
+}
+
+// NewLeaseLocker returns a Locker that acquires locks by creating Kubernetes
+// Leases in the specified namespace using the provided client, which is
+// typically obtained by calling CoordinationV1() on a Kubernetes clientset.
+// Leases expire after the specified duration unless renewed, which happens
+// automatically for as long as they are held. Leases have a granularity of one
+// second, so if leaseDuration is less than a second, it defaults to 30 seconds.
+func NewLeaseLocker(
+	client coordinationv1client.LeasesGetter,
+	namespace string,
+	leaseDuration time.Duration,
+) Locker {
+	if leaseDuration < time.Second {
+		leaseDuration = 30 * time.Second
+	}
+	return &leaseLocker{
+		client:        client,
+		namespace:     namespace,
+		leaseDuration: leaseDuration,
+	}
+}
+
+func (l *leaseLocker) Lock(
+	ctx context.Context,
+	key string,
+) (context.Context, func(), error) {
+	keyDigest := sha256.Sum256([]byte(key))
+	name := "kargo-render-lock-" + hex.EncodeToString(keyDigest[:16])
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s_%s", hostname, uuid.NewString())
+	for {
+		acquired, err := l.tryAcquire(ctx, name, holder)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error acquiring lease %q: %w", name, err)
+		}
+		if acquired {
+			break
+		}
+		if err = waitToRetry(ctx); err != nil {
+			return nil, nil, fmt.Errorf("error acquiring lease %q: %w", name, err)
+		}
+	}
+	lockCtx, stop := keepAlive(
+		ctx,
+		func(ctx context.Context) error {
+			return l.renew(ctx, name, holder)
+		},
+		l.leaseDuration/3,
+	)
+	return lockCtx, func() {
+		stop()
+		// If this fails, the lease will expire on its own
+		l.release(context.Background(), name, holder)
+	}, nil
+}
+
+// tryAcquire makes a single attempt to acquire the named Lease on behalf of
+// the specified holder. It returns false if the Lease is held by another
+// holder or was modified concurrently.
+func (l *leaseLocker) tryAcquire(
+	ctx context.Context,
+	name string,
+	holder string,
+) (bool, error) {
+	leases := l.client.Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(l.leaseDuration / time.Second)
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &durationSeconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err = leases.Create(
+			ctx,
+			&coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: l.namespace,
+				},
+				Spec: spec,
+			},
+			metav1.CreateOptions{},
+		); apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if !leaseExpired(lease, now.Time) {
+		return false, nil
+	}
+	lease.Spec = spec
+	if _, err = leases.Update(ctx, lease, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// renew extends the named Lease if it is still held by the specified holder.
+func (l *leaseLocker) renew(
+	ctx context.Context,
+	name string,
+	holder string,
+) error {
+	leases := l.client.Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return fmt.Errorf("lease %q is no longer held", name)
+	}
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// release deletes the named Lease if it is still held by the specified holder.
+func (l *leaseLocker) release(ctx context.Context, name, holder string) {
+	leases := l.client.Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil ||
+		lease.Spec.HolderIdentity == nil ||
+		*lease.Spec.HolderIdentity != holder {
+		return
+	}
+	_ = leases.Delete(
+		ctx,
+		name,
+		metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{
+				ResourceVersion: &lease.ResourceVersion,
+			},
+		},
+	)
+}
+
+// leaseExpired returns true if the provided Lease is not held or was last
+// renewed longer ago than its duration.
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" ||
+		spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return spec.RenewTime.Add(
+		time.Duration(*spec.LeaseDurationSeconds) * time.Second,
+	).Before(now)
+}
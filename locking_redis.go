@@ -0,0 +1,102 @@
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// redisRenewScript extends the expiry of a lock only if it is still held by
+	// the caller.
+	redisRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	// redisUnlockScript deletes a lock only if it is still held by the caller.
+	redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// redisLocker is a Locker implementation backed by Redis.
+type redisLocker struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewRedisLocker returns a Locker that acquires locks using the provided Redis
+// client. Locks expire after the specified TTL unless renewed, which happens
+// automatically for as long as they are held. If ttl is not specified, it
+// defaults to 30 seconds.
+func NewRedisLocker(client redis.UniversalClient, ttl time.Duration) Locker {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &redisLocker{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (r *redisLocker) Lock(
+	ctx context.Context,
+	key string,
+) (context.Context, func(), error) {
+	keyDigest := sha256.Sum256([]byte(key))
+	redisKey := "kargo-render:lock:" + hex.EncodeToString(keyDigest[:])
+	token := uuid.NewString()
+	for {
+		acquired, err := r.client.SetNX(ctx, redisKey, token, r.ttl).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error acquiring lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if err = waitToRetry(ctx); err != nil {
+			return nil, nil, fmt.Errorf("error acquiring lock: %w", err)
+		}
+	}
+	lockCtx, stop := keepAlive(
+		ctx,
+		func(ctx context.Context) error {
+			renewed, err := redisRenewScript.Run(
+				ctx,
+				r.client,
+				[]string{redisKey},
+				token,
+				r.ttl.Milliseconds(),
+			).Int()
+			if err != nil {
+				return err
+			}
+			if renewed == 0 {
+				return errors.New("lock is no longer held")
+			}
+			return nil
+		},
+		r.ttl/3,
+	)
+	return lockCtx, func() {
+		stop()
+		// If this fails, the lock will expire on its own
+		_ = redisUnlockScript.Run(
+			context.Background(),
+			r.client,
+			[]string{redisKey},
+			token,
+		).Err()
+	}, nil
+}
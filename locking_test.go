@@ -0,0 +1,139 @@
+package render
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLockingService(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	svc := NewLockingService(
+		&mockService{
+			renderFn: func(context.Context, *Request) (Response, error) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					if m := maxInFlight.Load(); n <= m ||
+						maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				return Response{}, nil
+			},
+		},
+		NewRedisLocker(
+			redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}),
+			time.Second,
+		),
+	)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.RenderManifests(
+				context.Background(),
+				&Request{
+					RepoURL:      "https://github.com/akuity/foobar",
+					TargetBranch: "env/dev",
+				},
+			)
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), maxInFlight.Load())
+}
+
+func TestLockers(t *testing.T) {
+	testCases := []struct {
+		name   string
+		locker func(*testing.T) Locker
+	}{
+		{
+			name: "redis",
+			locker: func(t *testing.T) Locker {
+				return NewRedisLocker(
+					redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}),
+					time.Second,
+				)
+			},
+		},
+		{
+			name: "lease",
+			locker: func(*testing.T) Locker {
+				return NewLeaseLocker(
+					fake.NewSimpleClientset().CoordinationV1(),
+					"kargo-render",
+					time.Second,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			locker := testCase.locker(t)
+
+			_, unlock, err := locker.Lock(context.Background(), "foo")
+			require.NoError(t, err)
+
+			// A different lock can be acquired while the first is held
+			_, unlockBar, err := locker.Lock(context.Background(), "bar")
+			require.NoError(t, err)
+			unlockBar()
+
+			// The first lock cannot be acquired again while it is held, even
+			// after the time for which it was originally acquired has elapsed
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+			_, _, err = locker.Lock(ctx, "foo")
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+
+			// Once released, the lock can be acquired again
+			unlock()
+			lockCtx, unlock, err := locker.Lock(context.Background(), "foo")
+			require.NoError(t, err)
+			unlock()
+			// Releasing the lock ends the work that required it
+			require.ErrorIs(t, lockCtx.Err(), context.Canceled)
+		})
+	}
+}
+
+func TestLockingServiceLockLost(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	svc := NewLockingService(
+		&mockService{
+			renderFn: func(ctx context.Context, _ *Request) (Response, error) {
+				// Another replica takes the lock while the request is handled
+				redisServer.FlushAll()
+				<-ctx.Done()
+				return Response{}, ctx.Err()
+			},
+		},
+		NewRedisLocker(
+			redis.NewClient(&redis.Options{Addr: redisServer.Addr()}),
+			300*time.Millisecond,
+		),
+	)
+	_, err := svc.RenderManifests(
+		context.Background(),
+		&Request{
+			RepoURL:      "https://github.com/akuity/foobar",
+			TargetBranch: "env/dev",
+		},
+	)
+	lostErr := &LockLostError{}
+	require.ErrorAs(t, err, &lostErr)
+	require.Equal(t, "env/dev", lostErr.TargetBranch)
+	require.ErrorContains(t, err, "no longer held")
+}
@@ -0,0 +1,205 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"sigs.k8s.io/yaml"
+)
+
+// Strategies by which content from the source commit may be combined with a
+// file owned by an environment-specific branch.
+const (
+	mergeStrategyAppend    = "append"
+	mergeStrategyJSONPatch = "jsonpatch"
+	mergeStrategyTemplate  = "template"
+)
+
+// mergedFileTemplateData is the data available to templates used with the
+// "template" merge strategy.
+type mergedFileTemplateData struct {
+	// Existing is the existing content of the file owned by the branch, or the
+	// empty string if it does not exist.
+	Existing string
+	// SourceCommit is the ID (sha) of the commit the branch is being rendered
+	// from.
+	SourceCommit string
+	// TargetBranch is the name of the branch being rendered.
+	TargetBranch string
+	// Apps lists the names of all apps rendered into the branch, in order.
+	Apps []string
+}
+
+// readMergedFileSources reads, from the specified directory, the source of
+// every file the branch's configuration says is to be merged and returns their
+// contents indexed by the path of the file they are to be merged with. This
+// must happen before the source commit is no longer checked out.
+func readMergedFileSources(
+	rc requestContext,
+	repoRoot string,
+) (map[string][]byte, error) {
+	mergedFiles := rc.target.branchConfig.MergedFiles
+	if len(mergedFiles) == 0 {
+		return nil, nil
+	}
+	sources := make(map[string][]byte, len(mergedFiles))
+	for _, mergedFile := range mergedFiles {
+		source, err := os.ReadFile(filepath.Join(repoRoot, mergedFile.Source))
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error reading source %q of merged file %q: %w",
+				mergedFile.Source,
+				mergedFile.Path,
+				err,
+			)
+		}
+		sources[mergedFile.Path] = source
+	}
+	return sources, nil
+}
+
+// mergeFiles combines the sources read by readMergedFileSources with the files
+// owned by the branch in the specified directory using the strategy configured
+// for each. The content appended to each file merged using the "append"
+// strategy is returned, indexed by the file's path, so that it can be recorded
+// in branch metadata.
+func mergeFiles(rc requestContext, dir string) (map[string]string, error) {
+	oldMetadata := rc.target.oldBranchMetadata
+	if rc.target.commit.oldBranchMetadata != nil {
+		oldMetadata = *rc.target.commit.oldBranchMetadata
+	}
+	var contributions map[string]string
+	for _, mergedFile := range rc.target.branchConfig.MergedFiles {
+		path := filepath.Join(dir, mergedFile.Path)
+		existing, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil,
+				fmt.Errorf("error reading merged file %q: %w", mergedFile.Path, err)
+		}
+		source := rc.target.mergedFileSources[mergedFile.Path]
+		var merged []byte
+		switch mergedFile.Strategy {
+		case mergeStrategyAppend:
+			merged = appendContribution(
+				existing,
+				oldMetadata.MergedFileContributions[mergedFile.Path],
+				source,
+			)
+			if contributions == nil {
+				contributions = map[string]string{}
+			}
+			contributions[mergedFile.Path] = string(source)
+		case mergeStrategyJSONPatch:
+			merged, err = applyJSONPatch(mergedFile.Path, existing, source)
+		case mergeStrategyTemplate:
+			merged, err = executeMergeTemplate(rc, existing, source)
+		default:
+			err = fmt.Errorf("unknown merge strategy %q", mergedFile.Strategy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error merging file %q: %w", mergedFile.Path, err)
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf(
+				"error ensuring existence of directory %q: %w",
+				filepath.Dir(path),
+				err,
+			)
+		}
+		if err = os.WriteFile(path, merged, 0644); err != nil { // nolint: gosec
+			return nil,
+				fmt.Errorf("error writing merged file %q: %w", mergedFile.Path, err)
+		}
+	}
+	return contributions, nil
+}
+
+// appendContribution returns the provided existing content with the provided
+// contribution appended to it. If the existing content ends with the
+// contribution appended by the previous render, that is removed first so that
+// appending is idempotent.
+func appendContribution(existing []byte, oldContribution string, contribution []byte) []byte {
+	base := existing
+	if oldContribution != "" {
+		base = bytes.TrimSuffix(existing, []byte(oldContribution))
+	}
+	merged := append([]byte{}, base...)
+	if len(merged) > 0 && !bytes.HasSuffix(merged, []byte("\n")) {
+		merged = append(merged, '\n')
+	}
+	return append(merged, contribution...)
+}
+
+// applyJSONPatch applies the provided RFC 6902 JSON patch, which may be
+// expressed in JSON or YAML, to the provided existing content of the file at
+// the specified path. Files with a .json extension are treated as JSON and all
+// others as YAML. If the file does not exist, the patch is applied to an empty
+// object. Since the patch is applied anew on every render, it should consist
+// of operations, like replace, that are idempotent.
+func applyJSONPatch(path string, existing []byte, patchBytes []byte) ([]byte, error) {
+	patchJSON, err := yaml.YAMLToJSON(patchBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing patch: %w", err)
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding patch: %w", err)
+	}
+	docJSON := []byte("{}")
+	if len(bytes.TrimSpace(existing)) > 0 {
+		if docJSON, err = yaml.YAMLToJSON(existing); err != nil {
+			return nil, fmt.Errorf("error parsing existing content: %w", err)
+		}
+	}
+	if docJSON, err = patch.Apply(docJSON); err != nil {
+		return nil, fmt.Errorf("error applying patch: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		buf := &bytes.Buffer{}
+		if err = json.Indent(buf, docJSON, "", "  "); err != nil {
+			return nil, fmt.Errorf("error formatting patched content: %w", err)
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+	merged, err := yaml.JSONToYAML(docJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling patched content: %w", err)
+	}
+	return merged, nil
+}
+
+// executeMergeTemplate executes the provided Go template using the provided
+// existing content of a file owned by the branch and details of the request.
+func executeMergeTemplate(
+	rc requestContext,
+	existing []byte,
+	tmpl []byte,
+) ([]byte, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(string(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	data := mergedFileTemplateData{
+		Existing:     string(existing),
+		SourceCommit: rc.source.commit,
+		TargetBranch: rc.request.TargetBranch,
+		Apps:         make([]string, 0, len(rc.target.branchConfig.AppConfigs)),
+	}
+	for appName := range rc.target.branchConfig.AppConfigs {
+		data.Apps = append(data.Apps, appName)
+	}
+	sort.Strings(data.Apps)
+	buf := &bytes.Buffer{}
+	if err = t.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
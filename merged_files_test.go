@@ -0,0 +1,190 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendContribution(t *testing.T) {
+	testCases := []struct {
+		name            string
+		existing        string
+		oldContribution string
+		contribution    string
+		expected        string
+	}{
+		{
+			name:         "file does not exist",
+			contribution: "/apps/ @team\n",
+			expected:     "/apps/ @team\n",
+		},
+		{
+			name:         "first contribution",
+			existing:     "* @owners\n",
+			contribution: "/apps/ @team\n",
+			expected:     "* @owners\n/apps/ @team\n",
+		},
+		{
+			name:         "existing content lacks trailing newline",
+			existing:     "* @owners",
+			contribution: "/apps/ @team\n",
+			expected:     "* @owners\n/apps/ @team\n",
+		},
+		{
+			name:            "previous contribution is replaced",
+			existing:        "* @owners\n/apps/ @team\n",
+			oldContribution: "/apps/ @team\n",
+			contribution:    "/apps/ @other-team\n",
+			expected:        "* @owners\n/apps/ @other-team\n",
+		},
+		{
+			name:            "previous contribution was edited manually",
+			existing:        "* @owners\n/apps/ @edited\n",
+			oldContribution: "/apps/ @team\n",
+			contribution:    "/apps/ @team\n",
+			expected:        "* @owners\n/apps/ @edited\n/apps/ @team\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(
+				t,
+				testCase.expected,
+				string(
+					appendContribution(
+						[]byte(testCase.existing),
+						testCase.oldContribution,
+						[]byte(testCase.contribution),
+					),
+				),
+			)
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		existing   string
+		patch      string
+		assertions func(*testing.T, []byte, error)
+	}{
+		{
+			name:  "invalid patch",
+			path:  "values.yaml",
+			patch: "op: replace",
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "error decoding patch")
+			},
+		},
+		{
+			name:     "YAML file",
+			path:     "values.yaml",
+			existing: "owners:\n- alice\nenv: dev\n",
+			patch:    "- op: replace\n  path: /owners/0\n  value: bob\n",
+			assertions: func(t *testing.T, merged []byte, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env: dev\nowners:\n- bob\n", string(merged))
+			},
+		},
+		{
+			name:  "JSON file that does not exist",
+			path:  "settings.json",
+			patch: `[{"op": "add", "path": "/env", "value": "dev"}]`,
+			assertions: func(t *testing.T, merged []byte, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "{\n  \"env\": \"dev\"\n}\n", string(merged))
+			},
+		},
+		{
+			name:     "patch does not apply",
+			path:     "settings.json",
+			existing: "{}",
+			patch:    `[{"op": "test", "path": "/env", "value": "dev"}]`,
+			assertions: func(t *testing.T, _ []byte, err error) {
+				require.ErrorContains(t, err, "error applying patch")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			merged, err := applyJSONPatch(
+				testCase.path,
+				[]byte(testCase.existing),
+				[]byte(testCase.patch),
+			)
+			testCase.assertions(t, merged, err)
+		})
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "CODEOWNERS"), []byte("* @owners\n"), 0600),
+	)
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Dev\n"), 0600),
+	)
+	rc := requestContext{
+		request: &Request{TargetBranch: "env/dev"},
+		source:  sourceContext{commit: "abc123"},
+	}
+	rc.target.branchConfig = branchConfig{
+		AppConfigs: map[string]appConfig{"foo": {}, "bar": {}},
+		MergedFiles: []mergedFileConfig{
+			{
+				Path:     "CODEOWNERS",
+				Source:   "codeowners",
+				Strategy: mergeStrategyAppend,
+			},
+			{
+				Path:     "README.md",
+				Source:   "readme.tmpl",
+				Strategy: mergeStrategyTemplate,
+			},
+		},
+	}
+	rc.target.mergedFileSources = map[string][]byte{
+		"CODEOWNERS": []byte("/foo/ @foo-team\n"),
+		"README.md": []byte(
+			"# {{ .TargetBranch }}\n\nRendered from {{ .SourceCommit }}: " +
+				"{{ range .Apps }}{{ . }} {{ end }}\n",
+		),
+	}
+	rc.target.oldBranchMetadata = branchMetadata{
+		MergedFileContributions: map[string]string{"CODEOWNERS": "/old/ @old\n"},
+	}
+	contributions, err := mergeFiles(rc, dir)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		map[string]string{"CODEOWNERS": "/foo/ @foo-team\n"},
+		contributions,
+	)
+
+	codeOwners, err := os.ReadFile(filepath.Join(dir, "CODEOWNERS"))
+	require.NoError(t, err)
+	require.Equal(t, "* @owners\n/foo/ @foo-team\n", string(codeOwners))
+	readme, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"# env/dev\n\nRendered from abc123: bar foo \n",
+		string(readme),
+	)
+
+	// Merging again leaves the appended content as it was
+	rc.target.oldBranchMetadata.MergedFileContributions = contributions
+	_, err = mergeFiles(rc, dir)
+	require.NoError(t, err)
+	codeOwners, err = os.ReadFile(filepath.Join(dir, "CODEOWNERS"))
+	require.NoError(t, err)
+	require.Equal(t, "* @owners\n/foo/ @foo-team\n", string(codeOwners))
+}
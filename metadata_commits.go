@@ -0,0 +1,176 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// Values of a branch's MetadataOnlyChanges setting other than the default,
+// "skip".
+const (
+	// metadataOnlyChangesAmend causes changes to nothing but Kargo Render's
+	// metadata to be amended into the commit at the head of the branch.
+	metadataOnlyChangesAmend = "amend"
+	// metadataOnlyChangesCommit causes changes to nothing but Kargo Render's
+	// metadata to be committed on their own.
+	metadataOnlyChangesCommit = "commit"
+)
+
+// metadataCommitPrefix prefixes the messages of commits that contain nothing
+// but changes to Kargo Render's metadata, so that they are easily told apart
+// from commits of newly rendered manifests.
+const metadataCommitPrefix = "[metadata] "
+
+// branchMetadataPath is the path of the branch metadata relative to the root
+// of a branch.
+const branchMetadataPath = ".kargo-render/metadata.yaml"
+
+// metadataChangesToRecord returns true if the target branch's configuration
+// says to record changes to nothing but Kargo Render's metadata and the staged
+// changes at the provided paths, none of which are meaningful, include such
+// changes. Changes to how long rendering took are disregarded.
+func metadataChangesToRecord(
+	ctx context.Context,
+	rc requestContext,
+	paths []string,
+) (bool, error) {
+	switch rc.target.branchConfig.MetadataOnlyChanges {
+	case metadataOnlyChangesAmend, metadataOnlyChangesCommit:
+	default:
+		return false, nil
+	}
+	for _, path := range paths {
+		if !strings.HasPrefix(path, ".kargo-render/") {
+			continue // Ignored rather than metadata
+		}
+		if path != branchMetadataPath {
+			return true, nil
+		}
+		oldBytes, err := rc.repo.ReadFileAtCommit(ctx, "HEAD", path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("error reading branch metadata: %w", err)
+		}
+		newBytes, err := os.ReadFile(filepath.Join(rc.repo.WorkingDir(), path))
+		if err != nil {
+			return false, fmt.Errorf("error reading branch metadata: %w", err)
+		}
+		if oldBytes, err = withoutRenderTimings(oldBytes); err != nil {
+			return false, err
+		}
+		if newBytes, err = withoutRenderTimings(newBytes); err != nil {
+			return false, err
+		}
+		if !bytes.Equal(oldBytes, newBytes) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// withoutRenderTimings returns the provided branch metadata, normalized, with
+// its RenderTimings removed.
+func withoutRenderTimings(mdBytes []byte) ([]byte, error) {
+	md := branchMetadata{}
+	if err := yaml.Unmarshal(mdBytes, &md); err != nil {
+		return nil, fmt.Errorf("error unmarshaling branch metadata: %w", err)
+	}
+	md.RenderTimings = nil
+	mdBytes, err := yaml.Marshal(md)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling branch metadata: %w", err)
+	}
+	return mdBytes, nil
+}
+
+// publishMetadataChanges records staged changes to nothing but Kargo Render's
+// metadata as the target branch's configuration says to, either by amending
+// the commit at the head of the commit branch and force pushing it or by
+// committing them on their own and publishing the commit as usual. The
+// provided Response is updated accordingly and returned.
+func (s *service) publishMetadataChanges(
+	ctx context.Context,
+	rc requestContext,
+	res Response,
+) (Response, error) {
+	if rc.target.branchConfig.MetadataOnlyChanges == metadataOnlyChangesCommit {
+		message, err := buildCommitMessage(ctx, rc)
+		if err != nil {
+			return res, err
+		}
+		rc.target.commit.message = metadataCommitPrefix + message
+		return s.commitAndPublish(ctx, rc, res)
+	}
+
+	if rc.request.ReadOnly {
+		return res, errors.New(
+			"refusing to write to the remote repository in response to a " +
+				"read-only request",
+		)
+	}
+	if rc.request.boolOption(OptionPushViaAPI) {
+		return res, fmt.Errorf(
+			"metadataOnlyChanges %q cannot be combined with the %s option",
+			metadataOnlyChangesAmend,
+			OptionPushViaAPI,
+		)
+	}
+	amendedID, err := rc.repo.LastCommitID(ctx)
+	if err != nil {
+		return res, fmt.Errorf(
+			"error getting last commit ID from the commit branch: %w",
+			err,
+		)
+	}
+	if rc.target.commit.message, err = rc.repo.FullCommitMessage(
+		ctx,
+		amendedID,
+	); err != nil {
+		return res, fmt.Errorf("error getting message of commit to amend: %w", err)
+	}
+	commitStart := rc.timings.start(StageCommit)
+	if err = s.runPreCommitHook(ctx, rc); err != nil {
+		return res, err
+	}
+	if err = rc.repo.Commit(
+		ctx,
+		rc.target.commit.message,
+		&git.CommitOptions{Amend: true},
+	); err != nil {
+		return res, fmt.Errorf("error amending commit: %w", err)
+	}
+	rc.timings.record(StageCommit, "", commitStart)
+	if err = s.refreshRepoCreds(ctx, rc); err != nil {
+		return res, err
+	}
+	pushStart := rc.timings.start(StagePush)
+	if err = rc.repo.ForcePush(ctx, amendedID); err != nil {
+		return res, fmt.Errorf("error pushing amended commit to remote: %w", err)
+	}
+	rc.timings.record(StagePush, "", pushStart)
+	if res.CommitID, err = rc.repo.LastCommitID(ctx); err != nil {
+		return res, fmt.Errorf(
+			"error getting last commit ID from the commit branch: %w",
+			err,
+		)
+	}
+	res.ActionTaken = ActionTakenPushedDirectly
+	rc.logger.WithFields(log.Fields{
+		"amendedCommitID": amendedID,
+		"commitID":        res.CommitID,
+	}).Debug("amended metadata changes into commit and pushed it")
+	return res, nil
+}
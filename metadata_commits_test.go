@@ -0,0 +1,133 @@
+package render
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestMetadataOnlyChanges(t *testing.T) {
+	testCases := []struct {
+		mode       string
+		assertions func(t *testing.T, res Response, before, after []string)
+	}{
+		{
+			mode: "skip",
+			assertions: func(t *testing.T, res Response, before, after []string) {
+				require.Equal(t, ActionTakenNone, res.ActionTaken)
+				require.Equal(t, before, after)
+			},
+		},
+		{
+			mode: metadataOnlyChangesCommit,
+			assertions: func(t *testing.T, res Response, before, after []string) {
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+				require.Len(t, after, len(before)+1)
+				require.Equal(t, before, after[1:])
+				require.Equal(t, res.CommitID, strings.Fields(after[0])[0])
+				require.Contains(t, after[0], " [metadata] Render env/dev")
+			},
+		},
+		{
+			mode: metadataOnlyChangesAmend,
+			assertions: func(t *testing.T, res Response, before, after []string) {
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+				require.Len(t, after, len(before))
+				require.Equal(t, before[1:], after[1:])
+				require.NotEqual(t, before[0], after[0])
+				require.Equal(t, res.CommitID, strings.Fields(after[0])[0])
+				// The amended commit keeps its message
+				require.Equal(
+					t,
+					strings.Fields(before[0])[1:],
+					strings.Fields(after[0])[1:],
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.mode, func(t *testing.T) {
+			originDir := t.TempDir()
+			srcDir := t.TempDir()
+			git := func(dir string, arg ...string) string {
+				cmd := exec.Command("git", arg...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+				return string(out)
+			}
+			git(originDir, "init", "-q", "--bare", "-b", "main")
+			git(srcDir, "init", "-q", "-b", "main")
+			git(srcDir, "config", "user.name", "Test")
+			git(srcDir, "config", "user.email", "test@example.com")
+			git(srcDir, "remote", "add", "origin", originDir)
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(srcDir, "kargo-render.yaml"),
+					[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  metadataOnlyChanges: `+testCase.mode+`
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+					0600,
+				),
+			)
+			git(srcDir, "add", ".")
+			git(srcDir, "commit", "-q", "-m", "initial commit")
+			git(srcDir, "push", "-q", "origin", "main")
+
+			s, ok := NewService(nil).(*service)
+			require.True(t, ok)
+			s.renderFn = func(
+				context.Context,
+				string,
+				argocd.ConfigManagementConfig,
+				*commandTrace,
+			) ([]byte, error) {
+				return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+			}
+			render := func(sourceBranch string) Response {
+				res, err := s.RenderManifests(
+					context.Background(),
+					&Request{
+						LocalInPath:   srcDir,
+						TargetBranch:  "env/dev",
+						CommitMessage: "Render env/dev",
+						Source:        &SourceContext{Branch: sourceBranch},
+						// Last-mile rendering requires kustomize
+						Options: map[string]string{OptionSkipLastMile: "true"},
+					},
+				)
+				require.NoError(t, err)
+				return res
+			}
+			history := func() []string {
+				return strings.Split(
+					strings.TrimSpace(git(originDir, "log", "--format=%H %s", "env/dev")),
+					"\n",
+				)
+			}
+
+			require.Equal(t, ActionTakenPushedDirectly, render("main").ActionTaken)
+			before := history()
+			// Only the recorded source branch, which is metadata, changes
+			testCase.assertions(t, render("release"), before, history())
+			// Nothing changes but how long rendering took
+			after := history()
+			require.Equal(t, ActionTakenNone, render("release").ActionTaken)
+			require.Equal(t, after, history())
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// metadataStorage determines where Kargo Render stores the metadata of the
+// target branches it renders.
+type metadataStorage string
+
+const (
+	// metadataStorageInline stores a branch's metadata in the branch itself, in
+	// a .kargo-render/metadata.yaml file. This is the default.
+	metadataStorageInline metadataStorage = "inline"
+	// metadataStorageNotes stores a branch's metadata in a git note attached to
+	// the commit at the head of the branch, in the notes ref metadataNotesRef.
+	metadataStorageNotes metadataStorage = "notes"
+	// metadataStorageBranch stores a branch's metadata in a <branch>/metadata.yaml
+	// file in the dedicated branch metadataBranch.
+	metadataStorageBranch metadataStorage = "branch"
+)
+
+const (
+	// metadataNotesRef is the notes ref in which branch metadata is stored when
+	// using metadataStorageNotes.
+	metadataNotesRef = "refs/notes/kargo-render"
+	// metadataBranch is the branch in which branch metadata is stored when using
+	// metadataStorageBranch.
+	metadataBranch = "kargo-render/metadata"
+	// metadataBranchRef is the full name of the ref of metadataBranch.
+	metadataBranchRef = "refs/heads/" + metadataBranch
+	// metadataPushAttempts is how many times storing branch metadata outside
+	// of the branch is attempted. Metadata for every target branch shares one
+	// ref, so pushes for different target branches can race.
+	metadataPushAttempts = 3
+)
+
+// metadataStorage returns where the repository's branch metadata is stored,
+// or the default if its configuration does not say.
+func (r *repoConfig) metadataStorage() metadataStorage {
+	if r == nil || r.MetadataStorage == "" {
+		return metadataStorageInline
+	}
+	return metadataStorage(r.MetadataStorage)
+}
+
+// external returns true if branch metadata is stored outside of the branches
+// it describes.
+func (m metadataStorage) external() bool {
+	return m == metadataStorageNotes || m == metadataStorageBranch
+}
+
+// readStoredBranchMetadata reads the metadata of the named branch, whose head
+// is the specified commit or other revision, from the provided external
+// storage, first fetching the ref it is stored in. If no metadata for the
+// branch is found, a nil result is returned.
+func readStoredBranchMetadata(
+	ctx context.Context,
+	repo git.Repo,
+	storage metadataStorage,
+	branch string,
+	rev string,
+) (*branchMetadata, error) {
+	var mdBytes []byte
+	switch storage {
+	case metadataStorageNotes:
+		ok, err := repo.FetchRef(ctx, metadataNotesRef)
+		if err != nil || !ok {
+			return nil, err
+		}
+		if mdBytes, err = repo.ReadNote(ctx, metadataNotesRef, rev); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	case metadataStorageBranch:
+		ok, err := repo.FetchRef(ctx, metadataBranchRef)
+		if err != nil || !ok {
+			return nil, err
+		}
+		if mdBytes, err = repo.ReadFileAtCommit(
+			ctx,
+			metadataBranchRef,
+			metadataBranchPath(branch),
+		); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	md := &branchMetadata{}
+	if err := yaml.Unmarshal(mdBytes, md); err != nil {
+		return nil, fmt.Errorf("error unmarshaling branch metadata: %w", err)
+	}
+	return md, nil
+}
+
+// loadCheckedOutBranchMetadata loads the metadata of the named branch, which
+// is checked out in the repository's working tree, from the storage the
+// repository's configuration specifies. When metadata is stored externally,
+// but none is found there, metadata stored in the branch itself is loaded
+// instead, so branches rendered before the repository changed where it stores
+// metadata are still recognized. If no metadata is found at all, a nil result
+// is returned.
+func loadCheckedOutBranchMetadata(
+	ctx context.Context,
+	rc requestContext,
+	branch string,
+) (*branchMetadata, error) {
+	if rc.target.metadataStorage.external() && !rc.target.unborn {
+		commitID, err := rc.repo.LastCommitID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		md, err := readStoredBranchMetadata(
+			ctx,
+			rc.repo,
+			rc.target.metadataStorage,
+			branch,
+			commitID,
+		)
+		if err != nil || md != nil {
+			return md, err
+		}
+	}
+	return loadBranchMetadata(rc.repo.WorkingDir())
+}
+
+// findRefBranchMetadata loads the metadata of the branch, if any, that the
+// specified ref, which is checked out in the repository's working tree, names
+// or points into. Since it is not yet known where the repository stores
+// metadata, every storage is consulted, starting with the branch itself. If
+// no metadata is found, a nil result is returned.
+func findRefBranchMetadata(
+	ctx context.Context,
+	repo git.Repo,
+	ref string,
+) (*branchMetadata, error) {
+	md, err := loadBranchMetadata(repo.WorkingDir())
+	if err != nil || md != nil {
+		return md, err
+	}
+	commitID, err := repo.LastCommitID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if md, err = readStoredBranchMetadata(
+		ctx,
+		repo,
+		metadataStorageNotes,
+		ref,
+		commitID,
+	); err != nil || md != nil {
+		return md, err
+	}
+	return readStoredBranchMetadata(
+		ctx,
+		repo,
+		metadataStorageBranch,
+		ref,
+		commitID,
+	)
+}
+
+// storeBranchMetadata stores the new metadata of the target branch in the
+// external storage the repository's configuration specifies and pushes it to
+// the remote repository. Metadata stored in a note is attached to the commit
+// that was pushed to the target branch. Since metadata for every target branch
+// shares one ref, a failed push is retried after fetching the ref again.
+func storeBranchMetadata(ctx context.Context, rc requestContext) error {
+	mdBytes, err := yaml.Marshal(rc.target.newBranchMetadata)
+	if err != nil {
+		return fmt.Errorf("error marshaling branch metadata: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		switch rc.target.metadataStorage {
+		case metadataStorageNotes:
+			err = storeBranchMetadataInNote(ctx, rc, mdBytes)
+		case metadataStorageBranch:
+			err = storeBranchMetadataInBranch(ctx, rc, mdBytes)
+		default:
+			return nil
+		}
+		if err == nil || attempt == metadataPushAttempts {
+			return err
+		}
+		rc.logger.WithError(err).WithField("attempt", attempt).
+			Warn("error storing branch metadata; retrying")
+	}
+}
+
+// storeBranchMetadataInNote attaches the provided metadata, in a note, to the
+// commit that was pushed to the target branch and pushes the notes ref.
+func storeBranchMetadataInNote(
+	ctx context.Context,
+	rc requestContext,
+	mdBytes []byte,
+) error {
+	if _, err := rc.repo.FetchRef(ctx, metadataNotesRef); err != nil {
+		return err
+	}
+	if err := rc.repo.WriteNote(
+		ctx,
+		metadataNotesRef,
+		rc.target.commit.id,
+		mdBytes,
+	); err != nil {
+		return err
+	}
+	return rc.repo.PushRef(ctx, metadataNotesRef, metadataNotesRef)
+}
+
+// storeBranchMetadataInBranch commits the provided metadata to the target
+// branch's file in the metadata branch, creating the branch if necessary, and
+// pushes the metadata branch.
+func storeBranchMetadataInBranch(
+	ctx context.Context,
+	rc requestContext,
+	mdBytes []byte,
+) error {
+	ok, err := rc.repo.FetchRef(ctx, metadataBranchRef)
+	if err != nil {
+		return err
+	}
+	var parent string
+	if ok {
+		parent = metadataBranchRef
+	}
+	commitID, err := rc.repo.CommitFile(
+		ctx,
+		parent,
+		metadataBranchPath(rc.request.TargetBranch),
+		mdBytes,
+		fmt.Sprintf(
+			"Kargo Render: update metadata of branch %s to commit %s",
+			rc.request.TargetBranch,
+			rc.target.commit.id,
+		),
+	)
+	if err != nil {
+		return err
+	}
+	return rc.repo.PushRef(ctx, commitID, metadataBranchRef)
+}
+
+// metadataBranchPath returns the path, relative to the root of the metadata
+// branch, of the file in which the named branch's metadata is stored.
+func metadataBranchPath(branch string) string {
+	return path.Join(branch, "metadata.yaml")
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestExternalMetadataStorage(t *testing.T) {
+	testCases := []struct {
+		storage      metadataStorage
+		readMetadata func(git func(...string) string) string
+	}{
+		{
+			storage: metadataStorageNotes,
+			readMetadata: func(git func(...string) string) string {
+				return git("notes", "--ref", metadataNotesRef, "show", "env/dev")
+			},
+		},
+		{
+			storage: metadataStorageBranch,
+			readMetadata: func(git func(...string) string) string {
+				return git("show", metadataBranch+":env/dev/metadata.yaml")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(string(testCase.storage), func(t *testing.T) {
+			originDir := t.TempDir()
+			srcDir := t.TempDir()
+			git := func(dir string, arg ...string) string {
+				cmd := exec.Command("git", arg...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+				return string(out)
+			}
+			git(originDir, "init", "-q", "--bare", "-b", "main")
+			git(srcDir, "init", "-q", "-b", "main")
+			git(srcDir, "config", "user.name", "Test")
+			git(srcDir, "config", "user.email", "test@example.com")
+			git(srcDir, "remote", "add", "origin", originDir)
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(srcDir, "kargo-render.yaml"),
+					[]byte(`configVersion: v1alpha1
+metadataStorage: `+string(testCase.storage)+`
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+					0600,
+				),
+			)
+			git(srcDir, "add", ".")
+			git(srcDir, "commit", "-q", "-m", "initial commit")
+			git(srcDir, "push", "-q", "origin", "main")
+			sourceCommit := git(srcDir, "rev-parse", "HEAD")
+
+			s, ok := NewService(nil).(*service)
+			require.True(t, ok)
+			name := "foo"
+			s.renderFn = func(
+				context.Context,
+				string,
+				argocd.ConfigManagementConfig,
+				*commandTrace,
+			) ([]byte, error) {
+				return []byte(
+					"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n",
+				), nil
+			}
+			render := func() Response {
+				res, err := s.RenderManifests(
+					context.Background(),
+					&Request{
+						LocalInPath:   srcDir,
+						TargetBranch:  "env/dev",
+						CommitMessage: "Render env/dev",
+						// Last-mile rendering requires kustomize
+						Options: map[string]string{OptionSkipLastMile: "true"},
+					},
+				)
+				require.NoError(t, err)
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+				return res
+			}
+			originGit := func(arg ...string) string {
+				return git(originDir, arg...)
+			}
+
+			render()
+			// The branch itself holds no metadata
+			require.NotContains(
+				t,
+				git(originDir, "ls-tree", "-r", "--name-only", "env/dev"),
+				".kargo-render",
+			)
+			require.Contains(
+				t,
+				testCase.readMetadata(originGit),
+				"sourceCommit: "+sourceCommit,
+			)
+
+			// The branch is recognized as managed by Kargo Render when rendered
+			// again
+			name = "bar"
+			render()
+			require.Contains(
+				t,
+				testCase.readMetadata(originGit),
+				"sourceCommit: "+sourceCommit,
+			)
+		})
+	}
+}
+
+func TestRemoveBranchMetadata(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeBranchMetadata(branchMetadata{SourceCommit: "abc"}, dir))
+	require.NoError(t, removeBranchMetadata(dir))
+	require.NoDirExists(t, filepath.Join(dir, ".kargo-render"))
+
+	// Other content of the .kargo-render directory is left alone
+	require.NoError(t, writeBranchMetadata(branchMetadata{SourceCommit: "abc"}, dir))
+	reportPath := filepath.Join(dir, ".kargo-render", "report.json")
+	require.NoError(t, os.WriteFile(reportPath, []byte("{}"), 0600))
+	require.NoError(t, removeBranchMetadata(dir))
+	require.NoFileExists(t, filepath.Join(dir, ".kargo-render", "metadata.yaml"))
+	require.FileExists(t, reportPath)
+
+	// Nothing to remove is not an error
+	require.NoError(t, removeBranchMetadata(t.TempDir()))
+}
@@ -0,0 +1,326 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/akuity/kargo-render/internal/manifests"
+)
+
+const (
+	// appOutputLayoutSplit is the layout of an app's output when each
+	// resource is written to its own file.
+	appOutputLayoutSplit = "split"
+	// appOutputLayoutCombined is the layout of an app's output when all
+	// resources are combined into a single file.
+	appOutputLayoutCombined = "combined"
+	// appOutputLayoutContentAddressable is the layout of an app's output when
+	// each resource is written to a content-addressable file.
+	appOutputLayoutContentAddressable = "contentAddressable"
+)
+
+// appOutputLayout returns the layout of the output of an app with the provided
+// configuration.
+func appOutputLayout(appConfig appConfig) string {
+	switch {
+	case appConfig.CombineManifests:
+		return appOutputLayoutCombined
+	case appConfig.ContentAddressable:
+		return appOutputLayoutContentAddressable
+	default:
+		return appOutputLayoutSplit
+	}
+}
+
+// recordedAppOutputLayout returns the layout of the output of an app with the
+// provided configuration as recorded in branch metadata. This is the app's
+// appOutputLayout, followed by the subdirectories, if any, to which resources
+// of particular kinds are routed, in order by kind, e.g. "split, ConfigMap in
+// config, CustomResourceDefinition in crds".
+func recordedAppOutputLayout(appConfig appConfig) string {
+	kindOutputPaths := appConfig.kindOutputPaths()
+	if len(kindOutputPaths) == 0 {
+		return appOutputLayout(appConfig)
+	}
+	kinds := make([]string, 0, len(kindOutputPaths))
+	for kind := range kindOutputPaths {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, 0, len(kinds)+1)
+	parts = append(parts, appOutputLayout(appConfig))
+	for _, kind := range kinds {
+		parts = append(
+			parts,
+			fmt.Sprintf("%s in %s", kind, filepath.Clean(kindOutputPaths[kind])),
+		)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// findRelocations compares the output path and layout recorded in the
+// provided metadata for every app in the provided configuration to those the
+// configuration now specifies and returns details of every app whose output
+// must be relocated, sorted by app name. Apps not recorded in the metadata are
+// new and have no output to relocate. If the metadata predates the recording
+// of layouts, only changes to output paths are detected.
+func findRelocations(
+	oldMetadata branchMetadata,
+	appConfigs map[string]appConfig,
+) []RelocatedApp {
+	var relocations []RelocatedApp
+	for appName, appConfig := range appConfigs {
+		oldPath, ok := oldMetadata.AppOutputPaths[appName]
+		if !ok {
+			continue
+		}
+		oldLayout := oldMetadata.AppOutputLayouts[appName]
+		newPath := appOutputPath(appName, appConfig)
+		newLayout := recordedAppOutputLayout(appConfig)
+		if filepath.Clean(oldPath) == filepath.Clean(newPath) &&
+			(oldLayout == "" || oldLayout == newLayout) {
+			continue
+		}
+		relocations = append(relocations, RelocatedApp{
+			App:       appName,
+			OldPath:   oldPath,
+			OldLayout: oldLayout,
+			NewPath:   newPath,
+			NewLayout: newLayout,
+		})
+	}
+	sort.Slice(relocations, func(i, j int) bool {
+		return relocations[i].App < relocations[j].App
+	})
+	return relocations
+}
+
+// relocateAppOutput detects apps whose output path or layout has changed since
+// the commit branch was last rendered, as recorded in the provided metadata,
+// and commits the previously rendered manifests of those apps, moved to their
+// new paths and layouts but otherwise unaltered, to the commit branch. This
+// separates the relocation from any change to the manifests themselves so
+// that both remain easy to review. The commit is not pushed. The working tree
+// is left clean, as it was found. Details of every relocated app are returned,
+// sorted by app name.
+func relocateAppOutput(
+	ctx context.Context,
+	rc requestContext,
+	oldMetadata branchMetadata,
+) ([]RelocatedApp, error) {
+	relocations := findRelocations(oldMetadata, rc.target.branchConfig.AppConfigs)
+	if len(relocations) == 0 {
+		return nil, nil
+	}
+	// The commit branch was cleaned when it was checked out, so its previous
+	// contents must be restored first
+	if err := rc.repo.ResetHard(ctx); err != nil {
+		return nil, fmt.Errorf("error restoring commit branch contents: %w", err)
+	}
+	workingDir := rc.repo.WorkingDir()
+	md := oldMetadata
+	md.AppOutputPaths = make(map[string]string, len(oldMetadata.AppOutputPaths))
+	for appName, path := range oldMetadata.AppOutputPaths {
+		md.AppOutputPaths[appName] = path
+	}
+	md.AppOutputLayouts =
+		make(map[string]string, len(oldMetadata.AppOutputLayouts))
+	for appName, layout := range oldMetadata.AppOutputLayouts {
+		md.AppOutputLayouts[appName] = layout
+	}
+	for _, relocation := range relocations {
+		oldPath := filepath.Clean(relocation.OldPath)
+		if !filepath.IsLocal(oldPath) {
+			return nil, fmt.Errorf(
+				"output path %q for app %q is not a local path; refusing to relocate it",
+				oldPath,
+				relocation.App,
+			)
+		}
+		if err := checkExternalPaths(
+			relocation.App,
+			oldPath,
+			rc.target.branchConfig.ExternalPaths,
+		); err != nil {
+			return nil, err
+		}
+		// The output of other apps may be nested within this app's output path
+		otherOutputDirs := make([]string, 0, len(md.AppOutputPaths))
+		for appName, path := range md.AppOutputPaths {
+			if appName != relocation.App {
+				otherOutputDirs =
+					append(otherOutputDirs, filepath.Join(workingDir, path))
+			}
+		}
+		oldDir := filepath.Join(workingDir, oldPath)
+		appManifests, err := readAppOutput(oldDir, otherOutputDirs)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error reading output of app %q from %q: %w",
+				relocation.App,
+				oldPath,
+				err,
+			)
+		}
+		if err = removeAppOutput(oldDir, otherOutputDirs); err != nil {
+			return nil, fmt.Errorf(
+				"error removing output path %q for app %q: %w",
+				oldPath,
+				relocation.App,
+				err,
+			)
+		}
+		indexPath := appIndexPath(workingDir, relocation.App)
+		if err = os.Remove(indexPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf(
+				"error removing resource index %q: %w",
+				indexPath,
+				err,
+			)
+		}
+		if err = writeAppManifests(
+			rc.logger.WithField("app", relocation.App),
+			workingDir,
+			relocation.App,
+			rc.target.branchConfig.AppConfigs[relocation.App],
+			appManifests,
+			// Every app's manifests, including their headers, are written again
+			// once the relocation has been committed
+			nil,
+			rc.target.symlinks,
+		); err != nil {
+			return nil, err
+		}
+		md.AppOutputPaths[relocation.App] = relocation.NewPath
+		md.AppOutputLayouts[relocation.App] = relocation.NewLayout
+	}
+	// When metadata is stored outside of the branch, only the metadata of the
+	// commit that is eventually pushed is stored
+	if rc.target.metadataStorage.external() {
+		if err := removeBranchMetadata(workingDir); err != nil {
+			return nil, err
+		}
+	} else if err := writeBranchMetadata(md, workingDir); err != nil {
+		return nil, fmt.Errorf("error writing branch metadata: %w", err)
+	}
+	if err := rc.repo.AddAll(ctx); err != nil {
+		return nil, fmt.Errorf("error staging relocated manifests: %w", err)
+	}
+	if err := rc.repo.Commit(
+		ctx,
+		buildRelocationCommitMessage(relocations),
+		commitOptions(rc),
+	); err != nil {
+		return nil, fmt.Errorf("error committing relocated manifests: %w", err)
+	}
+	rc.logger.WithField("apps", len(relocations)).
+		Debug("committed relocated manifests")
+	if err := cleanCommitBranch(
+		workingDir,
+		commitBranchPreservedPaths(rc),
+		rc.target.symlinks,
+	); err != nil {
+		return nil, fmt.Errorf("error cleaning commit branch: %w", err)
+	}
+	return relocations, nil
+}
+
+// readAppOutput returns the manifests in every YAML file within the specified
+// directory or, recursively, within its subdirectories, such as those to which
+// resources of particular kinds are routed, in order by path, combined into a
+// single stream of YAML documents. Any layout of an app's output may be read
+// this way. Subdirectories that are the output directories of other apps, as
+// specified by otherOutputDirs, are skipped.
+func readAppOutput(dir string, otherOutputDirs []string) ([]byte, error) {
+	var appManifests [][]byte
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && slices.Contains(otherOutputDirs, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".yaml" {
+			return nil
+		}
+		manifest, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		appManifests = append(appManifests, manifest)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return manifests.CombineYAML(appManifests), nil
+}
+
+// removeAppOutput removes the specified directory and everything within it,
+// except the output directories of other apps, as specified by
+// otherOutputDirs, and the directories that contain them.
+func removeAppOutput(dir string, otherOutputDirs []string) error {
+	var nested []string
+	for _, otherDir := range otherOutputDirs {
+		if rel, err := filepath.Rel(dir, otherDir); err == nil &&
+			rel != "." && filepath.IsLocal(rel) {
+			nested = append(nested, otherDir)
+		}
+	}
+	if len(nested) == 0 {
+		return os.RemoveAll(dir)
+	}
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		path := filepath.Join(dir, item.Name())
+		if slices.Contains(nested, path) {
+			continue
+		}
+		if err = removeAppOutput(path, nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildRelocationCommitMessage returns a message for a commit that relocates
+// the output of the specified apps.
+func buildRelocationCommitMessage(relocations []RelocatedApp) string {
+	lines := make([]string, len(relocations))
+	for i, relocation := range relocations {
+		oldLayout := relocation.OldLayout
+		if oldLayout == "" {
+			oldLayout = "unknown layout"
+		}
+		lines[i] = fmt.Sprintf(
+			"  * %s: %s (%s) -> %s (%s)",
+			relocation.App,
+			relocation.OldPath,
+			oldLayout,
+			relocation.NewPath,
+			relocation.NewLayout,
+		)
+	}
+	return fmt.Sprintf(
+		"Relocate rendered manifests\n\nKargo Render created this commit by "+
+			"moving previously rendered manifests, without otherwise changing "+
+			"them, to new paths or layouts:\n\n%s",
+		strings.Join(lines, "\n"),
+	)
+}
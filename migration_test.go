@@ -0,0 +1,216 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// fakeRelocationRepo is a git.Repo whose working tree is reset to the
+// specified files and that records the messages of commits made to it.
+type fakeRelocationRepo struct {
+	git.Repo
+	dir      string
+	files    map[string]string
+	messages []string
+}
+
+func (f *fakeRelocationRepo) ResetHard(context.Context) error {
+	for path, contents := range f.files {
+		path = filepath.Join(f.dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeRelocationRepo) AddAll(context.Context) error {
+	return nil
+}
+
+func (f *fakeRelocationRepo) Commit(
+	_ context.Context,
+	message string,
+	_ *git.CommitOptions,
+) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeRelocationRepo) WorkingDir() string {
+	return f.dir
+}
+
+func TestFindRelocations(t *testing.T) {
+	oldMetadata := branchMetadata{
+		AppOutputPaths: map[string]string{
+			"foo":  "foo",
+			"bar":  "bar",
+			"baz":  "baz",
+			"quux": "quux",
+		},
+		AppOutputLayouts: map[string]string{
+			"foo":  appOutputLayoutSplit,
+			"bar":  appOutputLayoutSplit,
+			"quux": appOutputLayoutSplit,
+		},
+	}
+	relocations := findRelocations(
+		oldMetadata,
+		map[string]appConfig{
+			// Unchanged
+			"foo": {OutputPath: "foo/"},
+			// Layout changed
+			"bar": {CombineManifests: true},
+			// Path changed; layout not previously recorded
+			"baz": {OutputPath: "apps/baz", ContentAddressable: true},
+			// New
+			"qux": {},
+			// Kinds of resources routed to a subdirectory
+			"quux": {KindOutputPaths: map[string]string{"ConfigMap": "config/"}},
+		},
+	)
+	require.Equal(
+		t,
+		[]RelocatedApp{
+			{
+				App:       "bar",
+				OldPath:   "bar",
+				OldLayout: appOutputLayoutSplit,
+				NewPath:   "bar",
+				NewLayout: appOutputLayoutCombined,
+			},
+			{
+				App:       "baz",
+				OldPath:   "baz",
+				NewPath:   "apps/baz",
+				NewLayout: appOutputLayoutContentAddressable,
+			},
+			{
+				App:       "quux",
+				OldPath:   "quux",
+				OldLayout: appOutputLayoutSplit,
+				NewPath:   "quux",
+				NewLayout: "split, ConfigMap in config",
+			},
+		},
+		relocations,
+	)
+}
+
+func TestRelocateAppOutput(t *testing.T) {
+	const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`
+	const secret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: foo
+`
+	oldMetadata := branchMetadata{
+		SourceCommit: "abc123",
+		AppOutputPaths: map[string]string{
+			"foo": "foo",
+			"bar": "bar",
+		},
+		AppOutputLayouts: map[string]string{
+			"foo": appOutputLayoutSplit,
+			"bar": appOutputLayoutSplit,
+		},
+	}
+	repo := &fakeRelocationRepo{
+		dir: t.TempDir(),
+		files: map[string]string{
+			"foo/foo-configmap.yaml": configMap,
+			"foo/foo-secret.yaml":    secret,
+			"bar/foo-configmap.yaml": configMap,
+		},
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{},
+		repo:    repo,
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"foo": {OutputPath: "apps/foo", CombineManifests: true},
+		"bar": {},
+	}
+
+	relocations, err := relocateAppOutput(context.Background(), rc, oldMetadata)
+	require.NoError(t, err)
+	require.Len(t, relocations, 1)
+	require.Equal(t, "foo", relocations[0].App)
+
+	// The relocation was committed
+	require.Len(t, repo.messages, 1)
+	require.Contains(
+		t,
+		repo.messages[0],
+		"foo: foo (split) -> apps/foo (combined)",
+	)
+
+	// The working tree was cleaned again afterwards, except for metadata,
+	// which records the relocation without recording a new source commit
+	entries, err := os.ReadDir(repo.dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ".kargo-render", entries[0].Name())
+	md, err := loadBranchMetadata(repo.dir)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", md.SourceCommit)
+	require.Equal(t, "apps/foo", md.AppOutputPaths["foo"])
+	require.Equal(t, appOutputLayoutCombined, md.AppOutputLayouts["foo"])
+	require.Equal(t, "bar", md.AppOutputPaths["bar"])
+	// The metadata that was passed in was not modified
+	require.Equal(t, "foo", oldMetadata.AppOutputPaths["foo"])
+}
+
+func TestReadAppOutput(t *testing.T) {
+	dir := t.TempDir()
+	for path, contents := range map[string]string{
+		"b.yaml":          "kind: B\n",
+		"a.yaml":          "kind: A\n",
+		"README.md":       "# Hi\n",
+		"crds/c.yaml":     "kind: C\n",
+		"nested/app.yaml": "kind: Nested\n",
+	} {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	}
+	otherOutputDirs := []string{filepath.Join(dir, "nested")}
+	appManifests, err := readAppOutput(dir, otherOutputDirs)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"kind: A\n---\nkind: B\n---\nkind: C\n",
+		string(appManifests),
+	)
+
+	appManifests, err = readAppOutput(filepath.Join(dir, "missing"), nil)
+	require.NoError(t, err)
+	require.Empty(t, appManifests)
+
+	// The output of the other app is all that remains
+	require.NoError(t, removeAppOutput(dir, otherOutputDirs))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "nested", entries[0].Name())
+	require.FileExists(t, filepath.Join(dir, "nested", "app.yaml"))
+
+	require.NoError(t, removeAppOutput(dir, nil))
+	require.NoDirExists(t, dir)
+}
@@ -0,0 +1,168 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	libManifests "github.com/akuity/kargo-render/internal/manifests"
+)
+
+// hasMeaningfulChanges returns a bool indicating whether the specified paths,
+// which are assumed to differ between the working tree and the head of the
+// commit branch, contain any changes worth committing. Changes confined to
+// Kargo Render's own metadata or to paths matched by the branch's ignore file
+// are never meaningful. Changes confined to fields the target branch's
+// configuration says to ignore are also not meaningful, unless the request
+// selects DiffAlgorithmExact. Likewise, when the target branch's configuration
+// specifies a FileHeader, changes confined to the comments heading manifest
+// files, which may mention the source commit, are not meaningful.
+func hasMeaningfulChanges(
+	ctx context.Context,
+	rc requestContext,
+	paths []string,
+) (bool, error) {
+	if rc.target.unborn {
+		// Anything at all is a change to a branch without any commit
+		return len(paths) > 0, nil
+	}
+	manifestPaths, err := MeaningfulPaths(rc.repo.WorkingDir(), paths)
+	if err != nil {
+		return false, err
+	}
+	if len(manifestPaths) == 0 {
+		return false, nil
+	}
+	rules := rc.target.branchConfig.DiffIgnore
+	hasHeader := rc.target.branchConfig.FileHeader != ""
+	if (len(rules) == 0 && !hasHeader) ||
+		rc.request.option(OptionDiffAlgorithm) == DiffAlgorithmExact {
+		return true, nil
+	}
+	for _, path := range manifestPaths {
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return true, nil
+		}
+		oldBytes, err := rc.repo.ReadFileAtCommit(ctx, "HEAD", path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("error reading %q from commit branch: %w", path, err)
+		}
+		newBytes, err := os.ReadFile(filepath.Join(rc.repo.WorkingDir(), path))
+		if err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("error reading %q: %w", path, err)
+		}
+		if hasHeader {
+			oldBytes = stripHeader(oldBytes)
+			newBytes = stripHeader(newBytes)
+			if len(rules) == 0 {
+				if !bytes.Equal(oldBytes, newBytes) {
+					return true, nil
+				}
+				continue
+			}
+		}
+		if manifestsDiffer(oldBytes, newBytes, rules) {
+			return true, nil
+		}
+	}
+	rc.logger.Debug("all changes are confined to ignored fields or headers")
+	return false, nil
+}
+
+// MeaningfulPaths returns those of the provided paths, relative to the root of
+// the working tree of a target branch at the specified directory, whose changes
+// are worth committing. Changes to Kargo Render's own metadata, beneath the
+// .kargo-render directory, never are, nor are changes to paths matched by the
+// branch's .kargo-render/ignore file or by any of the provided patterns, which
+// use the same gitignore syntax. Kargo Render uses this wherever it decides
+// whether rendering changed anything, so programs that make the same decision
+// about a working tree can agree with it.
+func MeaningfulPaths(
+	dir string,
+	paths []string,
+	ignorePatterns ...string,
+) ([]string, error) {
+	ignore, err := loadIgnoreRules(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", ignoreFilePath, err)
+	}
+	extraIgnore := newIgnoreRules(dir, ignorePatterns)
+	meaningful := make([]string, 0, len(paths))
+	for _, path := range paths {
+		absPath := filepath.Join(dir, path)
+		if strings.HasPrefix(path, ".kargo-render/") ||
+			ignore.matches(absPath, false) ||
+			extraIgnore.matches(absPath, false) {
+			continue
+		}
+		meaningful = append(meaningful, path)
+	}
+	return meaningful, nil
+}
+
+// manifestsDiffer returns a bool indicating whether the two provided sets of
+// manifests differ in any way other than in fields identified by the provided
+// rules. Wherever the comparison cannot be made with certainty, for instance
+// because either set of manifests cannot be parsed, the sets are assumed to
+// differ.
+func manifestsDiffer(oldBytes, newBytes []byte, rules []diffIgnoreRule) bool {
+	oldResources, err := normalizedResources(oldBytes, rules)
+	if err != nil {
+		return true
+	}
+	newResources, err := normalizedResources(newBytes, rules)
+	if err != nil {
+		return true
+	}
+	return !reflect.DeepEqual(oldResources, newResources)
+}
+
+// normalizedResources parses the provided manifests and returns the resulting
+// objects, indexed by type and name, with all fields identified by the provided
+// rules cleared.
+func normalizedResources(
+	manifests []byte,
+	rules []diffIgnoreRule,
+) (map[string]map[string]any, error) {
+	resources, err := libManifests.SplitYAMLResources(manifests)
+	if err != nil {
+		return nil, err
+	}
+	objs := make(map[string]map[string]any, len(resources))
+	for _, resource := range resources {
+		key := fmt.Sprintf(
+			"%s/%s/%s/%s",
+			resource.APIVersion,
+			resource.Kind,
+			resource.Namespace,
+			resource.Name,
+		)
+		if _, ok := objs[key]; ok {
+			return nil, fmt.Errorf("duplicate resource %q", key)
+		}
+		obj := map[string]any{}
+		if err = yaml.Unmarshal(resource.Manifest, &obj); err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if !rule.matches(resource.Kind, resource.Name) {
+				continue
+			}
+			// Rules were already validated when the configuration was loaded
+			fieldPaths, _ := rule.fieldPaths()
+			for _, fieldPath := range fieldPaths {
+				fieldPath.Clear(obj)
+			}
+		}
+		objs[key] = obj
+	}
+	return objs, nil
+}
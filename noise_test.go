@@ -0,0 +1,175 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeaningfulPaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".kargo-render"), 0755))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, ignoreFilePath), []byte("/docs/\n"), 0600),
+	)
+	paths := []string{
+		".kargo-render/metadata.yaml",
+		"docs/index.html",
+		"README.md",
+		"my-app/all.yaml",
+	}
+
+	meaningful, err := MeaningfulPaths(dir, paths)
+	require.NoError(t, err)
+	require.Equal(t, []string{"README.md", "my-app/all.yaml"}, meaningful)
+
+	// Additional patterns are applied on top of the ignore file
+	meaningful, err = MeaningfulPaths(dir, paths, "*.md")
+	require.NoError(t, err)
+	require.Equal(t, []string{"my-app/all.yaml"}, meaningful)
+
+	// Metadata-only changes are not meaningful
+	meaningful, err = MeaningfulPaths(dir, paths[:1])
+	require.NoError(t, err)
+	require.Empty(t, meaningful)
+}
+
+func TestManifestsDiffer(t *testing.T) {
+	const oldManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+  labels:
+    helm.sh/chart: my-chart-1.0.0
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+  labels:
+    helm.sh/chart: my-chart-1.0.0
+`
+	testCases := []struct {
+		name         string
+		newManifests string
+		rules        []diffIgnoreRule
+		differ       bool
+	}{
+		{
+			name:         "identical",
+			newManifests: oldManifests,
+			differ:       false,
+		},
+		{
+			name: "differences confined to ignored fields",
+			newManifests: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+  name: my-app
+spec:
+  replicas: 1
+`,
+			rules: []diffIgnoreRule{
+				{JSONPaths: []string{".metadata.labels['helm.sh/chart']"}},
+			},
+			differ: false,
+		},
+		{
+			name: "ignored field differs on a resource the rule does not match",
+			newManifests: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+`,
+			rules: []diffIgnoreRule{
+				{
+					Kind:      "Deployment",
+					JSONPaths: []string{".metadata.labels['helm.sh/chart']"},
+				},
+			},
+			differ: true,
+		},
+		{
+			name: "other fields differ",
+			newManifests: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-config
+  labels:
+    helm.sh/chart: my-chart-1.0.1
+`,
+			rules: []diffIgnoreRule{
+				{JSONPaths: []string{".metadata.labels['helm.sh/chart']"}},
+			},
+			differ: true,
+		},
+		{
+			name: "resource removed",
+			newManifests: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+  labels:
+    helm.sh/chart: my-chart-1.0.0
+spec:
+  replicas: 1
+`,
+			rules: []diffIgnoreRule{
+				{JSONPaths: []string{".metadata.labels['helm.sh/chart']"}},
+			},
+			differ: true,
+		},
+		{
+			name:         "unparseable manifests",
+			newManifests: "{",
+			differ:       true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(
+				t,
+				testCase.differ,
+				manifestsDiffer(
+					[]byte(oldManifests),
+					[]byte(testCase.newManifests),
+					testCase.rules,
+				),
+			)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// oauthTokenExpiryMargin is how long before it expires an access token is
+// replaced, so that no operation begins with a token that may expire while
+// the operation is still underway.
+const oauthTokenExpiryMargin = 5 * time.Minute
+
+// defaultOAuthUsername is the username that accompanies access tokens obtained
+// using a refresh token unless another is specified. GitLab requires this
+// username, and other providers, such as Azure DevOps, accept any username.
+const defaultOAuthUsername = "oauth2"
+
+// refreshOAuthToken obtains a new access token using the refresh token in the
+// provided credentials, if they include one, unless the access token obtained
+// earlier is not about to expire, and uses it as the credentials' password. If
+// the provider issues a new refresh token in exchange, it replaces the old one
+// in the credentials and is passed to the service's oauthRefreshTokenFn, if one
+// was specified. It returns true if the credentials were changed.
+func (s *service) refreshOAuthToken(
+	ctx context.Context,
+	repoURL string,
+	creds *RepoCredentials,
+) (bool, error) {
+	refresh := creds.OAuthRefresh
+	if refresh == nil {
+		return false, nil
+	}
+	if token := creds.oauthToken; token != nil &&
+		(token.Expiry.IsZero() ||
+			time.Until(token.Expiry) > oauthTokenExpiryMargin) {
+		return false, nil
+	}
+	cfg := &oauth2.Config{
+		ClientID:     refresh.ClientID,
+		ClientSecret: refresh.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: refresh.TokenURL},
+	}
+	token, err := cfg.TokenSource(
+		ctx,
+		&oauth2.Token{RefreshToken: refresh.RefreshToken},
+	).Token()
+	if err != nil {
+		return false, fmt.Errorf("error refreshing OAuth access token: %w", err)
+	}
+	if token.RefreshToken != "" && token.RefreshToken != refresh.RefreshToken {
+		// Copy the credentials rather than modifying the caller's
+		rotated := *refresh
+		rotated.RefreshToken = token.RefreshToken
+		creds.OAuthRefresh = &rotated
+		if s.oauthRefreshTokenFn != nil {
+			s.oauthRefreshTokenFn(ctx, repoURL, token.RefreshToken)
+		}
+	}
+	creds.Username = refresh.Username
+	if creds.Username == "" {
+		creds.Username = defaultOAuthUsername
+	}
+	creds.Password = token.AccessToken
+	creds.oauthToken = token
+	return true, nil
+}
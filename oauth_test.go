@@ -0,0 +1,81 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshOAuthToken(t *testing.T) {
+	var exchanges int
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+			exchanges++
+			// Like GitLab, issue a new refresh token with every access token
+			require.Equal(
+				t,
+				fmt.Sprintf("refresh-%d", exchanges),
+				r.PostForm.Get("refresh_token"),
+			)
+			w.Header().Set("Content-Type", "application/json")
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  fmt.Sprintf("access-%d", exchanges),
+				"refresh_token": fmt.Sprintf("refresh-%d", exchanges+1),
+				"token_type":    "bearer",
+				"expires_in":    3600,
+			}))
+		}),
+	)
+	defer server.Close()
+
+	var rotated []string
+	s, ok := NewService(&ServiceOptions{
+		OAuthRefreshTokenFn: func(_ context.Context, repoURL, refreshToken string) {
+			require.Equal(t, "https://gitlab.com/akuity/foobar", repoURL)
+			rotated = append(rotated, refreshToken)
+		},
+	}).(*service)
+	require.True(t, ok)
+
+	refresh := &OAuthRefreshCredentials{
+		TokenURL:     server.URL,
+		ClientID:     "kargo-render",
+		RefreshToken: "refresh-1",
+	}
+	creds := RepoCredentials{OAuthRefresh: refresh}
+	ctx := context.Background()
+	refreshed, err :=
+		s.refreshOAuthToken(ctx, "https://gitlab.com/akuity/foobar", &creds)
+	require.NoError(t, err)
+	require.True(t, refreshed)
+	require.Equal(t, "oauth2", creds.Username)
+	require.Equal(t, "access-1", creds.Password)
+	require.Equal(t, "refresh-2", creds.OAuthRefresh.RefreshToken)
+	require.Equal(t, []string{"refresh-2"}, rotated)
+	// The caller's credentials are left as they were
+	require.Equal(t, "refresh-1", refresh.RefreshToken)
+
+	// The access token remains valid
+	refreshed, err =
+		s.refreshOAuthToken(ctx, "https://gitlab.com/akuity/foobar", &creds)
+	require.NoError(t, err)
+	require.False(t, refreshed)
+	require.Equal(t, 1, exchanges)
+
+	// The access token is about to expire
+	creds.oauthToken.Expiry = time.Now().Add(time.Minute)
+	refreshed, err =
+		s.refreshOAuthToken(ctx, "https://gitlab.com/akuity/foobar", &creds)
+	require.NoError(t, err)
+	require.True(t, refreshed)
+	require.Equal(t, "access-2", creds.Password)
+	require.Equal(t, []string{"refresh-2", "refresh-3"}, rotated)
+}
@@ -0,0 +1,191 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// chartDependencies is the subset of a Helm chart's Chart.yaml that lists its
+// dependencies.
+type chartDependencies struct {
+	Dependencies []struct {
+		Name       string `json:"name"`
+		Repository string `json:"repository"`
+	} `json:"dependencies,omitempty"`
+}
+
+// checkOffline returns a NetworkAccessRequiredError describing everything that
+// would require network access beyond that to the remote repository if the
+// request is to be handled offline. The apps of the target branch, which are
+// resolved relative to the provided repository root, are examined in order by
+// name so that the result is deterministic. If pushes is true, the request is
+// handled by pushing to the remote repository, as opposed to by rendering a
+// prepared workspace, so use of the git provider's API is also checked for.
+// Network access that only becomes necessary while resolving the apps'
+// configuration is refused where it would otherwise occur.
+func checkOffline(rc requestContext, repoRoot string, pushes bool) error {
+	if !rc.request.Offline {
+		return nil
+	}
+	var reasons []string
+	if pushes && rc.request.writesToRemote() {
+		prs := rc.target.branchConfig.PRs
+		if prs.Enabled {
+			reasons = append(
+				reasons,
+				"pull requests are opened using the git provider's API",
+			)
+		} else if prs.OpenOnRejectedPush {
+			reasons = append(
+				reasons,
+				"a pull request is opened using the git provider's API if a "+
+					"direct push is rejected",
+			)
+		}
+		if rc.request.boolOption(OptionPushViaAPI) {
+			reasons = append(
+				reasons,
+				"commits are pushed using the git provider's API",
+			)
+		}
+	}
+
+	appNames := make([]string, 0, len(rc.target.branchConfig.AppConfigs))
+	for appName := range rc.target.branchConfig.AppConfigs {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		cfg := rc.target.branchConfig.AppConfigs[appName].ConfigManagement
+		switch {
+		case cfg.Plugin != nil:
+			continue // What plugins do is unknowable
+		case cfg.Helm != nil:
+			for _, valueFile := range cfg.Helm.ValueFiles {
+				if isRemoteURL(valueFile) {
+					reasons = append(
+						reasons,
+						fmt.Sprintf(
+							"app %q references values file %q by URL",
+							appName,
+							valueFile,
+						),
+					)
+				}
+			}
+			deps, err := findUnvendoredChartDependencies(repoRoot, cfg.Path)
+			if err != nil {
+				return fmt.Errorf(
+					"error finding chart dependencies of app %q: %w",
+					appName,
+					err,
+				)
+			}
+			for _, dep := range deps {
+				reasons = append(
+					reasons,
+					fmt.Sprintf(
+						"app %q depends on chart %q, which is not vendored into "+
+							"its charts directory",
+						appName,
+						dep,
+					),
+				)
+			}
+		default:
+			remoteBases, err := findRemoteBases(repoRoot, cfg.Path)
+			if err != nil {
+				return fmt.Errorf(
+					"error finding remote bases of app %q: %w",
+					appName,
+					err,
+				)
+			}
+			for _, remoteBase := range remoteBases {
+				reasons = append(
+					reasons,
+					fmt.Sprintf(
+						"app %q references remote base %q in %s",
+						appName,
+						remoteBase.URL,
+						remoteBase.Kustomization,
+					),
+				)
+			}
+		}
+	}
+
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &NetworkAccessRequiredError{
+		TargetBranch: rc.request.TargetBranch,
+		Reasons:      reasons,
+	}
+}
+
+// findUnvendoredChartDependencies returns the names and repositories, in
+// the form name (repository), of the dependencies of the Helm chart in the
+// specified directory, relative to the root of the provided repository, that
+// must be fetched from a remote chart repository because they have not been
+// vendored into the chart's charts/ directory, either as a directory or as an
+// archive.
+func findUnvendoredChartDependencies(
+	repoRoot string,
+	dir string,
+) ([]string, error) {
+	chartDir := filepath.Join(repoRoot, dir)
+	chartBytes, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	chart := chartDependencies{}
+	if err = yaml.Unmarshal(chartBytes, &chart); err != nil {
+		return nil, fmt.Errorf("error parsing Chart.yaml: %w", err)
+	}
+	var deps []string
+	for _, dep := range chart.Dependencies {
+		if dep.Repository == "" || strings.HasPrefix(dep.Repository, "file://") {
+			continue // Local
+		}
+		vendored, err := chartDependencyVendored(chartDir, dep.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !vendored {
+			deps = append(deps, fmt.Sprintf("%s (%s)", dep.Name, dep.Repository))
+		}
+	}
+	return deps, nil
+}
+
+// chartDependencyVendored returns true if the charts/ directory of the Helm
+// chart in the specified directory contains the named dependency.
+func chartDependencyVendored(chartDir string, name string) (bool, error) {
+	fi, err := os.Stat(filepath.Join(chartDir, "charts", name))
+	if err == nil && fi.IsDir() {
+		return true, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	archives, err := filepath.Glob(
+		filepath.Join(chartDir, "charts", name+"-*.tgz"),
+	)
+	return len(archives) > 0, err
+}
+
+// isRemoteURL returns true if the provided string is an HTTP or HTTPS URL.
+func isRemoteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
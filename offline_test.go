@@ -0,0 +1,142 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestCheckOffline(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeFile := func(path string, data string) {
+		path = filepath.Join(repoRoot, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	}
+	writeFile("local/kustomization.yaml", "resources:\n- deployment.yaml\n")
+	writeFile(
+		"remote/kustomization.yaml",
+		"resources:\n- https://github.com/example/repo//base?ref=v1.0.0\n",
+	)
+	writeFile(
+		"chart/Chart.yaml",
+		`name: chart
+dependencies:
+- name: local
+  repository: file://../local-chart
+- name: vendored
+  repository: https://charts.example.com
+- name: archived
+  repository: oci://registry.example.com/charts
+- name: missing
+  repository: https://charts.example.com
+`,
+	)
+	writeFile("chart/charts/vendored/Chart.yaml", "name: vendored\n")
+	writeFile("chart/charts/archived-1.0.0.tgz", "")
+
+	testCases := []struct {
+		name       string
+		req        *Request
+		prs        pullRequestConfig
+		apps       map[string]argocd.ConfigManagementConfig
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "not offline",
+			req:  &Request{TargetBranch: "env/prod"},
+			prs:  pullRequestConfig{Enabled: true},
+			apps: map[string]argocd.ConfigManagementConfig{
+				"remote": {Path: "remote"},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "nothing requires network access",
+			req:  &Request{TargetBranch: "env/prod", Offline: true},
+			apps: map[string]argocd.ConfigManagementConfig{
+				"local":  {Path: "local"},
+				"plugin": {Path: "remote", Plugin: &argoappv1.ApplicationSourcePlugin{}},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "pull requests not opened when rendering to stdout",
+			req:  &Request{TargetBranch: "env/prod", Offline: true, Stdout: true},
+			prs:  pullRequestConfig{Enabled: true},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "network access required",
+			req: &Request{
+				TargetBranch: "env/prod",
+				Offline:      true,
+				Options:      map[string]string{OptionPushViaAPI: "true"},
+			},
+			prs: pullRequestConfig{OpenOnRejectedPush: true},
+			apps: map[string]argocd.ConfigManagementConfig{
+				"chart": {
+					Path: "chart",
+					Helm: &argocd.ApplicationSourceHelm{
+						ApplicationSourceHelm: argoappv1.ApplicationSourceHelm{
+							ValueFiles: []string{
+								"values.yaml",
+								"https://example.com/values.yaml",
+							},
+						},
+					},
+				},
+				"remote": {Path: "remote"},
+			},
+			assertions: func(t *testing.T, err error) {
+				offlineErr := &NetworkAccessRequiredError{}
+				require.ErrorAs(t, err, &offlineErr)
+				require.Equal(t, "env/prod", offlineErr.TargetBranch)
+				require.Equal(
+					t,
+					[]string{
+						"a pull request is opened using the git provider's API if a " +
+							"direct push is rejected",
+						"commits are pushed using the git provider's API",
+						`app "chart" references values file ` +
+							`"https://example.com/values.yaml" by URL`,
+						`app "chart" depends on chart ` +
+							`"missing (https://charts.example.com)", which is not ` +
+							"vendored into its charts directory",
+						`app "remote" references remote base ` +
+							`"https://github.com/example/repo//base?ref=v1.0.0" in ` +
+							"remote/kustomization.yaml",
+					},
+					offlineErr.Reasons,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				logger:  log.NewEntry(log.New()),
+				request: testCase.req,
+			}
+			rc.target.branchConfig.PRs = testCase.prs
+			rc.target.branchConfig.AppConfigs = map[string]appConfig{}
+			for appName, cfg := range testCase.apps {
+				rc.target.branchConfig.AppConfigs[appName] =
+					appConfig{ConfigManagement: cfg}
+			}
+			testCase.assertions(t, checkOffline(rc, repoRoot, true))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	// OptionSkipLastMile is the name of a Request option that, when "true",
+	// causes Kargo Render to skip last-mile rendering. Pre-rendered manifests
+	// are then written to the target branch as they are, without any images
+	// being substituted into them, so this option cannot be combined with
+	// Images. Image substitutions recorded by earlier renders of the target
+	// branch are not carried forward.
+	OptionSkipLastMile = "skipLastMile"
+	// OptionDiffAlgorithm is the name of a Request option that selects how
+	// Kargo Render determines whether rendering has changed anything. Valid
+	// values are DiffAlgorithmSemantic (the default) and DiffAlgorithmExact.
+	OptionDiffAlgorithm = "diffAlgorithm"
+	// OptionTraceCommands is the name of a Request option that, when "true",
+	// causes Kargo Render to record every external command it executes in the
+	// Diagnostics of the Response, so that failures can be reproduced locally
+	// using the exact commands Kargo Render ran.
+	OptionTraceCommands = "traceCommands"
+	// OptionMigrateLayout is the name of a Request option that, when "true",
+	// causes Kargo Render to move the previously rendered output of any app
+	// whose output path or layout has changed to its new path and layout, in a
+	// commit of its own, before committing newly rendered manifests. This keeps
+	// both changes easy to review.
+	OptionMigrateLayout = "migrateLayout"
+	// OptionPushViaAPI is the name of a Request option that, when "true",
+	// causes Kargo Render to recreate its commits in the remote repository
+	// using the git provider's API instead of pushing them using git. This
+	// permits the use of tokens that grant write access to repository contents
+	// without granting access via the git protocol, and the resulting commits
+	// are signed by the provider. Only GitHub is currently supported.
+	OptionPushViaAPI = "pushViaAPI"
+	// OptionSkipInitialCommit is the name of a Request option that, when
+	// "true", causes Kargo Render to create a target branch that does not yet
+	// exist without first pushing an empty initial commit to it. The rendered
+	// manifests then become the branch's first commit, and the branch is
+	// pushed only once. This has no effect when pull requests are enabled for
+	// the target branch or when combined with OptionPushViaAPI, since both
+	// require the branch to exist before anything is rendered into it.
+	OptionSkipInitialCommit = "skipInitialCommit"
+)
+
+const (
+	// DiffAlgorithmSemantic compares rendered resources field by field,
+	// disregarding any fields the target branch's configuration says to
+	// ignore.
+	DiffAlgorithmSemantic = "semantic"
+	// DiffAlgorithmExact treats any change whatsoever to rendered manifests as
+	// meaningful, regardless of the target branch's configuration.
+	DiffAlgorithmExact = "exact"
+)
+
+// optionValidators maps the name of every supported Request option to a
+// function that validates its value.
+var optionValidators = map[string]func(string) error{
+	OptionSkipLastMile: func(value string) error {
+		_, err := strconv.ParseBool(value)
+		return err
+	},
+	OptionTraceCommands: func(value string) error {
+		_, err := strconv.ParseBool(value)
+		return err
+	},
+	OptionMigrateLayout: func(value string) error {
+		_, err := strconv.ParseBool(value)
+		return err
+	},
+	OptionPushViaAPI: func(value string) error {
+		_, err := strconv.ParseBool(value)
+		return err
+	},
+	OptionSkipInitialCommit: func(value string) error {
+		_, err := strconv.ParseBool(value)
+		return err
+	},
+	OptionDiffAlgorithm: func(value string) error {
+		if value != DiffAlgorithmSemantic && value != DiffAlgorithmExact {
+			return fmt.Errorf(
+				"valid values are %q and %q",
+				DiffAlgorithmSemantic,
+				DiffAlgorithmExact,
+			)
+		}
+		return nil
+	},
+}
+
+// validateOptions returns an error for every option in the provided map that
+// is unsupported or has an invalid value.
+func validateOptions(options map[string]string) []FieldError {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []FieldError
+	for _, name := range names {
+		validate, ok := optionValidators[name]
+		if !ok {
+			errs = append(
+				errs,
+				invalidField("options."+name, "Options key %q is unsupported", name),
+			)
+			continue
+		}
+		if err := validate(options[name]); err != nil {
+			errs = append(
+				errs,
+				invalidField(
+					"options."+name,
+					"Options value %q for key %q is invalid: %s",
+					options[name],
+					name,
+					err,
+				),
+			)
+		}
+	}
+	return errs
+}
+
+// option returns the value of the named option. An empty string is returned
+// if the option is not set.
+func (r *Request) option(name string) string {
+	return r.Options[name]
+}
+
+// boolOption returns the value of the named option as a bool. False is
+// returned if the option is not set. Options are validated before a Request
+// is handled, so the value is assumed to be parseable.
+func (r *Request) boolOption(name string) bool {
+	value, _ := strconv.ParseBool(r.option(name))
+	return value
+}
@@ -0,0 +1,177 @@
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// canonicalize trims whitespace from the output and makes its path, if any,
+// absolute. Problems doing so are described by the returned errors, in which
+// the output is identified by the specified field path.
+func (o *Output) canonicalize(path string) []FieldError {
+	o.Type = OutputType(strings.TrimSpace(string(o.Type)))
+	if o.LocalOut != nil {
+		o.LocalOut.canonicalize()
+	}
+	o.Path = strings.TrimSpace(o.Path)
+	if o.Path == "" {
+		return nil
+	}
+	o.Path = strings.TrimSuffix(o.Path, "/")
+	var err error
+	if o.Path, err = filepath.Abs(o.Path); err != nil {
+		return []FieldError{
+			invalidField(
+				path+".path",
+				"error canonicalizing path %s: %s",
+				o.Path,
+				err,
+			),
+		}
+	}
+	return nil
+}
+
+// validateOutputs returns errors describing any problems with the Request's
+// Outputs. There may be only one output of each type other than
+// OutputTypeLocal, and no two local outputs may share a path.
+func (r *Request) validateOutputs() []FieldError {
+	if len(r.Outputs) == 0 {
+		return nil
+	}
+	var errs []FieldError
+	types := map[OutputType]struct{}{}
+	paths := map[string]struct{}{}
+	for i, output := range r.Outputs {
+		path := fmt.Sprintf("outputs[%d]", i)
+		switch output.Type {
+		case OutputTypeBranch, OutputTypeStdout:
+			if _, ok := types[output.Type]; ok {
+				errs = append(
+					errs,
+					invalidField(
+						path+".type",
+						"only one output of type %q may be specified",
+						output.Type,
+					),
+				)
+			}
+			if output.Path != "" || output.LocalOut != nil {
+				errs = append(
+					errs,
+					invalidField(
+						path,
+						"Path and LocalOut may only be specified for outputs of type %q",
+						OutputTypeLocal,
+					),
+				)
+			}
+		case OutputTypeLocal:
+			if output.Path == "" {
+				errs = append(
+					errs,
+					invalidField(
+						path+".path",
+						"Path is required for outputs of type %q",
+						OutputTypeLocal,
+					),
+				)
+			} else if _, ok := paths[output.Path]; ok {
+				errs = append(
+					errs,
+					invalidField(
+						path+".path",
+						"path %q is specified by more than one output",
+						output.Path,
+					),
+				)
+			}
+			paths[output.Path] = struct{}{}
+			if output.LocalOut != nil {
+				errs = append(errs, output.LocalOut.validate(path+".localOut")...)
+			}
+		case "":
+			errs = append(errs, invalidField(path+".type", "Type is a required field"))
+		default:
+			errs = append(
+				errs,
+				invalidField(
+					path+".type",
+					"Type %q is unsupported; supported types are %q, %q, and %q",
+					output.Type,
+					OutputTypeBranch,
+					OutputTypeLocal,
+					OutputTypeStdout,
+				),
+			)
+		}
+		types[output.Type] = struct{}{}
+	}
+	if r.CommitMessage != "" && !r.hasOutput(OutputTypeBranch) {
+		errs = append(
+			errs,
+			invalidField(
+				"commitMessage",
+				"CommitMessage may only be specified along with an output of type %q",
+				OutputTypeBranch,
+			),
+		)
+	}
+	return errs
+}
+
+// hasOutput returns whether the Request's Outputs include one of the specified
+// type.
+func (r *Request) hasOutput(outputType OutputType) bool {
+	for _, output := range r.Outputs {
+		if output.Type == outputType {
+			return true
+		}
+	}
+	return false
+}
+
+// returnsManifests returns whether the rendered manifests are returned in the
+// Response to the Request.
+func (r *Request) returnsManifests() bool {
+	return r.Stdout || r.hasOutput(OutputTypeStdout) ||
+		(r.ReadOnly && len(r.localOutputs()) == 0)
+}
+
+// outputResults returns the results of writing to each of the Request's
+// Outputs, given the Response that describes the target branch, if it was
+// among them, and the local outputs that were written.
+func (r *Request) outputResults(
+	res Response,
+	locals []preparedLocalOutput,
+) []OutputResult {
+	if len(r.Outputs) == 0 {
+		return nil
+	}
+	results := make([]OutputResult, len(r.Outputs))
+	for i, output := range r.Outputs {
+		result := OutputResult{
+			Type:        output.Type,
+			ActionTaken: ActionTakenNone,
+		}
+		switch output.Type {
+		case OutputTypeBranch:
+			if r.writesToRemote() {
+				result.ActionTaken = res.ActionTaken
+				result.CommitID = res.CommitID
+				result.PullRequestURL = res.PullRequestURL
+			}
+		case OutputTypeLocal:
+			for _, local := range locals {
+				if local.path == output.Path && local.finished {
+					result.ActionTaken = ActionTakenWroteToLocalPath
+					result.Path = local.path
+					result.BranchMetadata = local.metadata
+				}
+			}
+		}
+		results[i] = result
+	}
+	return results
+}
@@ -0,0 +1,195 @@
+package render
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestOutputs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		outputs    func(outDir string) []Output
+		assertions func(t *testing.T, outDir string, res Response)
+	}{
+		{
+			name: "branch, local paths, and stdout",
+			outputs: func(outDir string) []Output {
+				return []Output{
+					{Type: OutputTypeBranch},
+					{
+						Type:     OutputTypeLocal,
+						Path:     filepath.Join(outDir, "dir"),
+						LocalOut: &LocalOutOptions{ExcludeMetadata: true},
+					},
+					{
+						Type: OutputTypeLocal,
+						Path: filepath.Join(outDir, "out.tar"),
+						LocalOut: &LocalOutOptions{
+							ManifestsOnly: true,
+							Format:        LocalOutFormatTar,
+						},
+					},
+					{Type: OutputTypeStdout},
+				}
+			},
+			assertions: func(t *testing.T, outDir string, res Response) {
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+				require.NotEmpty(t, res.CommitID)
+				require.Empty(t, res.LocalPath)
+				require.Contains(t, res.Manifests, "foo")
+				require.Len(t, res.Outputs, 4)
+				require.Equal(
+					t,
+					OutputResult{
+						Type:        OutputTypeBranch,
+						ActionTaken: ActionTakenPushedDirectly,
+						CommitID:    res.CommitID,
+					},
+					res.Outputs[0],
+				)
+				require.Equal(t, ActionTakenWroteToLocalPath, res.Outputs[1].ActionTaken)
+				require.Equal(t, filepath.Join(outDir, "dir"), res.Outputs[1].Path)
+				require.Contains(t, string(res.Outputs[1].BranchMetadata), "sourceCommit")
+				require.Equal(
+					t,
+					OutputResult{
+						Type:        OutputTypeLocal,
+						ActionTaken: ActionTakenWroteToLocalPath,
+						Path:        filepath.Join(outDir, "out.tar"),
+					},
+					res.Outputs[2],
+				)
+				require.Equal(
+					t,
+					OutputResult{Type: OutputTypeStdout, ActionTaken: ActionTakenNone},
+					res.Outputs[3],
+				)
+
+				require.FileExists(
+					t,
+					filepath.Join(outDir, "dir", "foo", "foo-configmap.yaml"),
+				)
+				require.NoDirExists(t, filepath.Join(outDir, "dir", ".kargo-render"))
+
+				f, err := os.Open(filepath.Join(outDir, "out.tar"))
+				require.NoError(t, err)
+				defer f.Close()
+				var names []string
+				tr := tar.NewReader(f)
+				for {
+					hdr, err := tr.Next()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					require.NoError(t, err)
+					names = append(names, hdr.Name)
+				}
+				require.Contains(t, names, "foo/foo-configmap.yaml")
+				require.Contains(t, names, ".kargo-render/metadata.yaml")
+			},
+		},
+		{
+			name: "several local paths",
+			outputs: func(outDir string) []Output {
+				return []Output{
+					{Type: OutputTypeLocal, Path: filepath.Join(outDir, "a")},
+					{Type: OutputTypeLocal, Path: filepath.Join(outDir, "b")},
+				}
+			},
+			assertions: func(t *testing.T, outDir string, res Response) {
+				require.Equal(t, ActionTakenWroteToLocalPath, res.ActionTaken)
+				require.Equal(t, filepath.Join(outDir, "a"), res.LocalPath)
+				require.Empty(t, res.Manifests)
+				require.Len(t, res.Outputs, 2)
+				for i, dir := range []string{"a", "b"} {
+					require.Equal(
+						t,
+						OutputResult{
+							Type:        OutputTypeLocal,
+							ActionTaken: ActionTakenWroteToLocalPath,
+							Path:        filepath.Join(outDir, dir),
+						},
+						res.Outputs[i],
+					)
+					require.FileExists(
+						t,
+						filepath.Join(outDir, dir, "foo", "foo-configmap.yaml"),
+					)
+					require.FileExists(
+						t,
+						filepath.Join(outDir, dir, ".kargo-render", "metadata.yaml"),
+					)
+				}
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			originDir := t.TempDir()
+			srcDir := t.TempDir()
+			outDir := t.TempDir()
+			git := func(dir string, arg ...string) {
+				cmd := exec.Command("git", arg...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+			}
+			git(originDir, "init", "-q", "--bare", "-b", "main")
+			git(srcDir, "init", "-q", "-b", "main")
+			git(srcDir, "config", "user.name", "Test")
+			git(srcDir, "config", "user.email", "test@example.com")
+			git(srcDir, "remote", "add", "origin", originDir)
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(srcDir, "kargo-render.yaml"),
+					[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+					0600,
+				),
+			)
+			git(srcDir, "add", ".")
+			git(srcDir, "commit", "-q", "-m", "initial commit")
+			git(srcDir, "push", "-q", "origin", "main")
+
+			s, ok := NewService(nil).(*service)
+			require.True(t, ok)
+			s.renderFn = func(
+				context.Context,
+				string,
+				argocd.ConfigManagementConfig,
+				*commandTrace,
+			) ([]byte, error) {
+				return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+			}
+			res, err := s.RenderManifests(
+				context.Background(),
+				&Request{
+					LocalInPath:  srcDir,
+					TargetBranch: "env/dev",
+					Outputs:      testCase.outputs(outDir),
+					// Last-mile rendering requires kustomize
+					Options: map[string]string{OptionSkipLastMile: "true"},
+				},
+			)
+			require.NoError(t, err)
+			testCase.assertions(t, outDir, res)
+		})
+	}
+}
@@ -0,0 +1,992 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// Stages of a Pipeline, in the order in which they must run.
+const (
+	pipelineStagePrepareWorkspace = iota
+	pipelineStageLoadConfig
+	pipelineStagePreRenderApps
+	pipelineStageLastMile
+	pipelineStageWriteOutputs
+	pipelineStagePublish
+)
+
+// pipelineStageNames maps every stage of a Pipeline to the name of the method
+// that runs it.
+var pipelineStageNames = []string{
+	"PrepareWorkspace",
+	"LoadConfig",
+	"PreRenderApps",
+	"LastMile",
+	"WriteOutputs",
+	"Publish",
+}
+
+// Pipeline handles a rendering request in discrete stages, so that programs
+// embedding Kargo Render can run a subset of them, for instance rendering
+// manifests, inspecting them, and only publishing them later, or not at all.
+// RenderManifests runs every stage in order. The stages, which share the
+// state of the request, must likewise run in order: PrepareWorkspace,
+// LoadConfig, PreRenderApps, LastMile, WriteOutputs, and Publish. A stage may
+// not run again, and no stage may run after one has failed. Requests that
+// don't write to the remote repository are handled completely by
+// WriteOutputs, after which Publish does nothing. Close must be called once
+// the Pipeline is no longer needed, whether or not every stage has run.
+// Pipelines are not safe for concurrent use.
+type Pipeline struct {
+	svc            *service
+	rc             requestContext
+	res            Response
+	startEndLogger *log.Entry
+	repoOpts       *git.RepoOptions
+	overlayDirs    []string
+	outputDir      string
+	// localOutputs are the local outputs that have been prepared, in order.
+	localOutputs []preparedLocalOutput
+	// next is the next stage to run.
+	next int
+	// done indicates that the request has been handled completely.
+	done bool
+	// err is the error returned by the stage that failed, if any.
+	err error
+	// unlockWorkspace, if non-nil, releases the lock on the workspace of a
+	// request bearing an ID. It is called by Close.
+	unlockWorkspace func() error
+	closed          bool
+}
+
+// newPipeline returns a Pipeline for handling the provided request. If plan is
+// non-nil, nothing is written to the remote repository and the changes that
+// would have been written are recorded in plan instead.
+func (s *service) newPipeline(req *Request, plan *Plan) (*Pipeline, error) {
+	if req.id = strings.TrimSpace(req.ID); req.id == "" {
+		req.id = uuid.NewString()
+	}
+
+	logger := s.logger.WithField("request", req.id)
+	p := &Pipeline{
+		svc: s,
+		startEndLogger: logger.WithFields(log.Fields{
+			"repo":         req.RepoURL,
+			"targetBranch": req.TargetBranch,
+		}),
+	}
+
+	p.startEndLogger.Debug("handling rendering request")
+
+	if s.keepWorkspacesOnError {
+		gcKeptWorkspaces(logger, s.keptWorkspaceTTL)
+	}
+
+	if err := req.canonicalizeAndValidate(); err != nil {
+		return nil, err
+	}
+	p.startEndLogger.Debug("validated rendering request")
+
+	p.rc = requestContext{
+		logger:        logger,
+		request:       req,
+		timings:       newTimings(s.progressFn),
+		plan:          plan,
+		toolEnv:       s.toolEnv,
+		renderTimeout: s.renderTimeout,
+	}
+	if req.boolOption(OptionTraceCommands) {
+		p.rc.commands = &commandTrace{}
+	}
+	return p, nil
+}
+
+// NewPipeline returns a Pipeline for handling the provided request in stages.
+// The request is validated, but nothing else is done until the Pipeline's
+// stages are run.
+func (s *service) NewPipeline(req *Request) (*Pipeline, error) {
+	return s.newPipeline(req, nil)
+}
+
+// run runs the specified stage using the provided function, provided that
+// it is the next stage to run, and records any error it returns.
+func (p *Pipeline) run(stage int, fn func() error) error {
+	switch {
+	case p.closed:
+		return errors.New("pipeline is closed")
+	case p.err != nil:
+		return fmt.Errorf(
+			"stage %s cannot run after an earlier stage failed: %w",
+			pipelineStageNames[stage],
+			p.err,
+		)
+	case stage != p.next:
+		return fmt.Errorf(
+			"stage %s cannot run next; expected stage %s",
+			pipelineStageNames[stage],
+			pipelineStageNames[p.next],
+		)
+	}
+	p.next++
+	if p.done {
+		return nil
+	}
+	if err := fn(); err != nil {
+		p.err = err
+		return err
+	}
+	return nil
+}
+
+// Response returns the Response to the request, reflecting the stages that
+// have run so far.
+func (p *Pipeline) Response() Response {
+	res := p.res
+	res.APIVersion = APIVersion
+	res.Timings = p.rc.timings.stages
+	res.Diagnostics = p.rc.commands.diagnostics()
+	res.Outputs = p.rc.request.outputResults(res, p.localOutputs)
+	return res
+}
+
+// Manifests returns the fully rendered manifests of every app, indexed by app
+// name. It returns nil until LastMile has run.
+func (p *Pipeline) Manifests() map[string][]byte {
+	return p.rc.target.renderedManifests
+}
+
+// Done returns true if the request has been handled completely, in which case
+// any remaining stages do nothing.
+func (p *Pipeline) Done() bool {
+	return p.done
+}
+
+// PrepareWorkspace clones the remote repository, or copies the local one,
+// into a new workspace, checks out the source commit, and checks that the
+// commit satisfies any commit signature and required checks policies.
+func (p *Pipeline) PrepareWorkspace(ctx context.Context) error {
+	return p.run(pipelineStagePrepareWorkspace, func() error {
+		return p.prepareWorkspace(ctx)
+	})
+}
+
+func (p *Pipeline) prepareWorkspace(ctx context.Context) error {
+	s := p.svc
+	rc := &p.rc
+	logger := rc.logger
+
+	// Requests bearing an ID use a workspace whose location is determined by
+	// the ID, so that retries can reuse the workspaces of interrupted attempts
+	p.repoOpts = traceRepoOptions(s.repoOptions(logger), rc.commands)
+	if !rc.request.ReadOnly {
+		p.repoOpts.PushURL = rc.request.PushURL
+	}
+	if rc.request.ID != "" {
+		var reused bool
+		var err error
+		if p.unlockWorkspace, err = lockRequestWorkspace(rc.request.ID); err != nil {
+			return err
+		}
+		if p.repoOpts.HomeDir, reused, err =
+			prepareRequestWorkspace(rc.request.ID); err != nil {
+			return fmt.Errorf("error preparing workspace: %w", err)
+		}
+		if reused {
+			logger.WithField("workspace", p.repoOpts.HomeDir).
+				Debug("reusing workspace of earlier attempt at handling request")
+		}
+	}
+
+	// Credentials that include a refresh token have no access token yet
+	if _, err := s.refreshOAuthToken(
+		ctx,
+		rc.request.RepoURL,
+		&rc.request.RepoCreds,
+	); err != nil {
+		return err
+	}
+
+	var err error
+	if rc.request.LocalInPath != "" {
+
+		// We'll be taking our input from a local directory which is presumably
+		// a git repository with the desired source commit already checked out.
+		//
+		// This is mainly useful when Kargo proper wishes to handle the reading and
+		// writing to/from remote repositories itself, leaving Kargo Render to
+		// handle rendering only.
+
+		start := rc.timings.start(StageCopy)
+		if rc.repo, err = git.CopyRepo(
+			ctx,
+			rc.request.LocalInPath,
+			rc.request.gitCreds(),
+			p.repoOpts,
+		); err != nil {
+			return fmt.Errorf("error copying local repository: %w", err)
+		}
+		rc.timings.record(StageCopy, "", start)
+		// Check if the working tree is dirty. CopyRepo already refuses to copy a
+		// dirty working tree, so this is only a safeguard.
+		var isDirty bool
+		if isDirty, err = rc.repo.HasDiffs(ctx); err != nil {
+			return fmt.Errorf("error checking for diffs: %w", err)
+		}
+		if isDirty {
+			return errors.New("working tree is dirty; refusing to proceed")
+		}
+		// Check that there is exactly one remote and it's named "origin"
+		var remotes []string
+		if remotes, err = rc.repo.Remotes(ctx); err != nil {
+			return fmt.Errorf("error getting remotes: %w", err)
+		}
+		if len(remotes) != 1 || remotes[0] != git.RemoteOrigin {
+			return errors.New(
+				"local repository must have exactly one remote, which must be " +
+					"named \"origin\"; refusing to proceed",
+			)
+		}
+
+	} else {
+
+		// Clone the remote repository ourselves
+
+		start := rc.timings.start(StageClone)
+		if rc.repo, err = git.Clone(
+			ctx,
+			rc.request.RepoURL,
+			rc.request.gitCreds(),
+			s.cloneOptions(p.repoOpts, rc.request.RepoURL),
+		); err != nil {
+			return fmt.Errorf("error cloning remote repository: %w", err)
+		}
+		rc.timings.record(StageClone, "", start)
+
+	}
+
+	// TODO: Add some logging to this block
+	if rc.request.LocalInPath != "" || rc.request.Ref == "" {
+		// For either of these mutually exclusive cases, we don't know the source
+		// commit yet
+		if rc.source.commit, err = rc.repo.LastCommitID(ctx); err != nil {
+			return fmt.Errorf("error getting last commit ID: %w", err)
+		}
+	} else {
+		if err = rc.repo.Checkout(ctx, rc.request.Ref); err != nil {
+			return fmt.Errorf("error checking out %q: %w", rc.request.Ref, err)
+		}
+		if rc.intermediate.branchMetadata, err = findRefBranchMetadata(
+			ctx,
+			rc.repo,
+			rc.request.Ref,
+		); err != nil {
+			return fmt.Errorf("error loading branch metadata: %w", err)
+		}
+		if rc.intermediate.branchMetadata == nil {
+			// We're not on a target branch. We're sitting on the source commit.
+			if rc.source.commit, err = rc.repo.LastCommitID(ctx); err != nil {
+				return fmt.Errorf("error getting last commit ID: %w", err)
+			}
+		} else {
+			// Follow the branch metadata back to the real source commit
+			if err = rc.repo.Checkout(
+				ctx,
+				rc.intermediate.branchMetadata.SourceCommit,
+			); err != nil {
+				return fmt.Errorf(
+					"error checking out %q: %w",
+					rc.intermediate.branchMetadata.SourceCommit,
+					err,
+				)
+			}
+			rc.source.commit = rc.intermediate.branchMetadata.SourceCommit
+		}
+	}
+
+	if err = s.checkCommitSignaturePolicies(
+		ctx,
+		rc.repo,
+		rc.request.TargetBranch,
+		rc.source.commit,
+	); err != nil {
+		return err
+	}
+	return s.checkRequiredChecksPolicies(ctx, rc.request, rc.source.commit)
+}
+
+// LoadConfig loads the configuration of the target branch from the source
+// commit, checks the repository's promotion order, checks out any overlays,
+// and resolves the configuration of every app, including any that are
+// discovered. For offline requests, it then checks that nothing remaining
+// would require network access.
+func (p *Pipeline) LoadConfig(ctx context.Context) error {
+	return p.run(pipelineStageLoadConfig, func() error {
+		rc := &p.rc
+		repoConfig, branchCfg, err := loadBranchConfig(*rc, rc.repo.WorkingDir())
+		if err != nil {
+			return err
+		}
+		rc.target.branchConfig = branchCfg
+		rc.target.symlinks = repoConfig.symlinkPolicy()
+		rc.target.metadataStorage = repoConfig.metadataStorage()
+
+		if err = checkPromotionOrder(ctx, *rc, repoConfig); err != nil {
+			return err
+		}
+
+		if p.overlayDirs, err = exportOverlays(ctx, *rc); err != nil {
+			return fmt.Errorf("error checking out overlays: %w", err)
+		}
+
+		if rc.target.branchConfig.AppConfigs, err = p.svc.resolveAppConfigs(
+			ctx,
+			*rc,
+			repoConfig,
+			rc.repo.WorkingDir(),
+		); err != nil {
+			return err
+		}
+		return checkOffline(*rc, rc.repo.WorkingDir(), true)
+	})
+}
+
+// PreRenderApps lints the input of every app whose configuration enables
+// linting, resolves the remote bases of Kustomize-based apps, and pre-renders
+// the manifests of every app, checking the determinism of those whose
+// configuration says to.
+func (p *Pipeline) PreRenderApps(ctx context.Context) error {
+	return p.run(pipelineStagePreRenderApps, func() error {
+		s := p.svc
+		rc := &p.rc
+		var err error
+		if p.res.LintFindings, err =
+			lintApps(ctx, *rc, rc.repo.WorkingDir()); err != nil {
+			return err
+		}
+
+		if p.res.RemoteBases, err =
+			s.resolveRemoteBases(ctx, *rc, rc.repo.WorkingDir()); err != nil {
+			return err
+		}
+		if rc.target.prerenderedManifests, err =
+			s.preRender(ctx, *rc, rc.repo.WorkingDir()); err != nil {
+			return fmt.Errorf("error pre-rendering manifests: %w", err)
+		}
+		if p.res.NondeterministicApps, err = s.checkDeterminism(
+			ctx,
+			*rc,
+			rc.repo.WorkingDir(),
+		); err != nil {
+			return err
+		}
+		if rc.target.mergedFileSources, err =
+			readMergedFileSources(*rc, rc.repo.WorkingDir()); err != nil {
+			return err
+		}
+		// Overlays were only needed as input
+		for _, dir := range p.overlayDirs {
+			if err = os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("error removing overlay %q: %w", dir, err)
+			}
+		}
+		return nil
+	})
+}
+
+// LastMile switches to the target branch, and to the branch any commit will
+// be made to, which depend upon the target branch's existing contents, and
+// then completes rendering of every app's manifests by substituting images
+// and applying any other last-mile transformations. The rendered manifests are
+// then checked against the target branch's resource policy. For in-memory
+// requests, no branch is switched to.
+func (p *Pipeline) LastMile(ctx context.Context) error {
+	return p.run(pipelineStageLastMile, func() error {
+		if !p.rc.request.InMemory {
+			if err := p.switchBranches(ctx); err != nil {
+				return err
+			}
+		}
+		return p.lastMile(ctx)
+	})
+}
+
+// switchBranches switches to the target branch, loads its metadata, and then
+// switches to the branch any commit will be made to.
+func (p *Pipeline) switchBranches(ctx context.Context) error {
+	s := p.svc
+	rc := &p.rc
+	logger := rc.logger
+	res := &p.res
+
+	if err := s.refreshRepoCreds(ctx, *rc); err != nil {
+		return err
+	}
+
+	var err error
+	if rc.target.unborn, err = switchToTargetBranch(ctx, *rc); err != nil {
+		return fmt.Errorf("error switching to target branch: %w", err)
+	}
+
+	oldTargetBranchMetadata, err :=
+		loadCheckedOutBranchMetadata(ctx, *rc, rc.request.TargetBranch)
+	if err != nil {
+		return fmt.Errorf("error loading branch metadata: %w", err)
+	}
+	if oldTargetBranchMetadata == nil {
+		// The target branch doesn't appear to already be managed by Kargo Render.
+		// We'll let this slide if the branch is 100% empty, but we'll refuse to
+		// proceed otherwise.
+		var empty bool
+		if empty, err = branchIsEmpty(rc.repo.WorkingDir()); err != nil {
+			return err
+		}
+		if !empty {
+			if !rc.request.AdoptBranch && !rc.target.branchConfig.AdoptExisting {
+				return &UnmanagedBranchError{TargetBranch: rc.request.TargetBranch}
+			}
+			// Report what cleaning the branch deletes before anything is deleted
+			if res.AdoptionDeletedPaths, err = listCleanablePaths(
+				rc.repo.WorkingDir(),
+				commitBranchPreservedPaths(*rc),
+			); err != nil {
+				return fmt.Errorf("error listing contents of target branch: %w", err)
+			}
+			res.Warnings = append(
+				res.Warnings,
+				fmt.Sprintf(
+					"target branch %q was not managed by Kargo Render and has been "+
+						"adopted; %d file(s) not preserved by its configuration are "+
+						"deleted from it",
+					rc.request.TargetBranch,
+					len(res.AdoptionDeletedPaths),
+				),
+			)
+			logger.WithField("deletedPaths", len(res.AdoptionDeletedPaths)).
+				Warn("adopting target branch not managed by Kargo Render")
+		}
+		rc.target.oldBranchMetadata = branchMetadata{}
+	} else {
+		rc.target.oldBranchMetadata = *oldTargetBranchMetadata
+		// Only a branch that is already managed is expected to contain every
+		// preserved path
+		if res.MissingPreservedPaths, err =
+			checkPreservedPaths(*rc, rc.repo.WorkingDir()); err != nil {
+			return err
+		}
+		if len(res.MissingPreservedPaths) > 0 {
+			res.Warnings = append(
+				res.Warnings,
+				fmt.Sprintf(
+					"preserved path(s) %s do not exist in target branch %q and "+
+						"protect nothing",
+					strings.Join(res.MissingPreservedPaths, ", "),
+					rc.request.TargetBranch,
+				),
+			)
+			logger.WithField("missingPaths", res.MissingPreservedPaths).
+				Warn("preserved paths do not exist in target branch")
+		}
+	}
+
+	rc.target.sourceHistory = getSourceHistory(ctx, *rc)
+	res.SourceHistory = rc.target.sourceHistory
+
+	if rc.target.commit.reusedPR, err = s.checkOpenPRLimit(ctx, *rc); err != nil {
+		return err
+	}
+	if pr := rc.target.commit.reusedPR; pr != nil {
+		res.Warnings = append(
+			res.Warnings,
+			fmt.Sprintf(
+				"the limit of %d open pull requests to target branch %q has been "+
+					"reached; updating the oldest, %s, instead of opening another",
+				rc.target.branchConfig.PRs.MaxOpen,
+				rc.request.TargetBranch,
+				pr.URL,
+			),
+		)
+		logger.WithField("prURL", pr.URL).
+			Warn("open pull request limit reached; updating the oldest")
+	}
+
+	if rc.target.commit.branch, err = switchToCommitBranch(ctx, *rc); err != nil {
+		return fmt.Errorf("error switching to commit branch: %w", err)
+	}
+
+	if rc.target.commit.branch != rc.request.TargetBranch {
+		// The commit branch isn't the target branch and we should take into account
+		// any metadata that already exists in the commit branch, in case that
+		// branch already existed.
+		if rc.target.commit.oldBranchMetadata, err =
+			loadCheckedOutBranchMetadata(ctx, *rc, rc.target.commit.branch); err != nil {
+			return fmt.Errorf("error loading branch metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// lastMile completes rendering of every app's manifests and checks the
+// results.
+func (p *Pipeline) lastMile(ctx context.Context) error {
+	rc := &p.rc
+	logger := rc.logger
+	res := &p.res
+
+	var err error
+	rc.target.newBranchMetadata.SourceCommit = rc.source.commit
+	rc.target.newBranchMetadata.Source = rc.request.Source
+	rc.target.newBranchMetadata.RemoteBases = res.RemoteBases
+	if rc.target.newBranchMetadata.ImageSubstitutions,
+		rc.target.renderedManifests,
+		err =
+		renderLastMile(ctx, *rc); err != nil {
+		return fmt.Errorf("error in last-mile manifest rendering: %w", err)
+	}
+	if !rc.request.boolOption(OptionSkipLastMile) {
+		if res.ImageSubstitutions, res.UnmatchedImages, err =
+			getImageSubstitutions(
+				*rc,
+				rc.target.newBranchMetadata.ImageSubstitutions,
+			); err != nil {
+			return err
+		}
+		rc.target.newBranchMetadata.AppImageSubstitutions = res.ImageSubstitutions
+		for _, image := range res.UnmatchedImages {
+			logger.WithField("image", image).
+				Warn("image does not match any image referenced by any app")
+		}
+	}
+
+	if res.ResourcePolicyViolations, err = checkResourcePolicy(*rc); err != nil {
+		return err
+	}
+	for _, violation := range res.ResourcePolicyViolations {
+		logger.WithField("resource", violation.String()).
+			Warn("rendered resource violates the branch's resource policy")
+	}
+	if res.DuplicateResources, err = checkDuplicateResources(*rc); err != nil {
+		return err
+	}
+	for _, duplicate := range res.DuplicateResources {
+		logger.WithField("resource", duplicate.String()).
+			Warn("resource is rendered by more than one app")
+	}
+	if res.Report, err = buildReport(
+		*rc,
+		res.ResourcePolicyViolations,
+		res.DuplicateResources,
+		res.UnmatchedImages,
+	); err != nil {
+		return fmt.Errorf("error building report: %w", err)
+	}
+	return nil
+}
+
+// WriteOutputs writes the rendered manifests, along with the target branch's
+// metadata, to the working tree of the branch any commit will be made to, or
+// to the request's only local path, after pruning the output of apps that are
+// no longer rendered into the branch, and then copies them to any other local
+// paths. Requests that don't write to the target branch, requests that return
+// the rendered manifests in memory, and requests that are only being planned,
+// are handled completely by this stage.
+func (p *Pipeline) WriteOutputs(ctx context.Context) error {
+	return p.run(pipelineStageWriteOutputs, func() error {
+		return p.writeOutputs(ctx)
+	})
+}
+
+func (p *Pipeline) writeOutputs(ctx context.Context) error {
+	rc := &p.rc
+	logger := rc.logger
+	res := &p.res
+
+	// Rendering is complete, so how long it took is known
+	res.RenderTimings = rc.timings.summary()
+	rc.target.newBranchMetadata.RenderTimings = res.RenderTimings
+
+	// If we're writing to stdout, or mustn't write anywhere, return the
+	// manifests, and if there's nowhere else to write them, we're done
+	locals := rc.request.localOutputs()
+	toBranch := rc.request.writesToRemote()
+	if rc.request.returnsManifests() {
+		res.Manifests = rc.target.renderedManifests
+		if !toBranch && len(locals) == 0 {
+			res.ActionTaken = ActionTakenNone
+			p.done = true
+			return nil
+		}
+	}
+
+	// If we're rendering to memory, return the metadata that would have been
+	// written along with the manifests and we're done
+	var err error
+	if rc.request.InMemory {
+		rc.target.newBranchMetadata.AppOutputPaths,
+			rc.target.newBranchMetadata.AppOutputLayouts =
+			appOutputMetadata(rc.target.branchConfig.AppConfigs)
+		if res.BranchMetadata, err =
+			yaml.Marshal(rc.target.newBranchMetadata); err != nil {
+			return fmt.Errorf("error marshaling branch metadata: %w", err)
+		}
+		res.ActionTaken = ActionTakenNone
+		res.Manifests = rc.target.renderedManifests
+		p.done = true
+		return nil
+	}
+
+	// Figure out where we're writing to. Manifests written to a single local
+	// path are written there directly. Otherwise, they're written to the
+	// working tree and copied to any local paths from there.
+	p.outputDir = rc.repo.WorkingDir()
+	if !toBranch && len(locals) == 1 {
+		if p.outputDir, err = prepareLocalOutput(
+			ctx,
+			*rc,
+			locals[0],
+			rc.repo.WorkingDir(),
+		); err != nil {
+			p.outputDir = ""
+			return err
+		}
+		p.localOutputs = []preparedLocalOutput{
+			{localOutput: locals[0], dir: p.outputDir},
+		}
+	}
+	outputDir := p.outputDir
+
+	// Move the output of any apps whose output path or layout has changed, in
+	// a commit of its own, before anything else is written
+	if rc.request.boolOption(OptionMigrateLayout) && toBranch && rc.plan == nil {
+		commitBranchMetadata := rc.target.oldBranchMetadata
+		if rc.target.commit.oldBranchMetadata != nil {
+			commitBranchMetadata = *rc.target.commit.oldBranchMetadata
+		}
+		if res.RelocatedApps, err =
+			relocateAppOutput(ctx, *rc, commitBranchMetadata); err != nil {
+			return fmt.Errorf("error relocating app output: %w", err)
+		}
+		// Relocated output is no longer found at its old path, so it must not
+		// be reported as pruned
+		oldPaths := rc.target.oldBranchMetadata.AppOutputPaths
+		for _, relocated := range res.RelocatedApps {
+			if _, ok := oldPaths[relocated.App]; ok {
+				oldPaths[relocated.App] = relocated.NewPath
+			}
+		}
+	}
+
+	// Prune output of any apps that are no longer rendered into this branch
+	rc.target.newBranchMetadata.AppOutputPaths,
+		rc.target.newBranchMetadata.AppOutputLayouts =
+		appOutputMetadata(rc.target.branchConfig.AppConfigs)
+	if rc.target.prunedApps, err = pruneOrphanedApps(
+		outputDir,
+		rc.target.oldBranchMetadata,
+		rc.target.newBranchMetadata,
+		rc.target.branchConfig.ExternalPaths,
+	); err != nil {
+		return fmt.Errorf("error pruning orphaned apps: %w", err)
+	}
+	res.PrunedApps = rc.target.prunedApps
+	if len(rc.target.prunedApps) > 0 {
+		logger.WithField("apps", len(rc.target.prunedApps)).
+			Debug("pruned output of orphaned apps")
+	}
+
+	// Combine content from the source commit with files owned by this branch
+	if rc.target.newBranchMetadata.MergedFileContributions, err =
+		mergeFiles(*rc, outputDir); err != nil {
+		return err
+	}
+
+	// Write branch metadata, unless it is stored outside of the branch, in
+	// which case it is stored once the branch has been pushed. Local output is
+	// not a branch, so metadata is always written to it.
+	if rc.target.metadataStorage.external() && toBranch {
+		if err = removeBranchMetadata(outputDir); err != nil {
+			return err
+		}
+	} else {
+		if err = writeBranchMetadata(
+			rc.target.newBranchMetadata,
+			outputDir,
+		); err != nil {
+			return fmt.Errorf("error writing branch metadata: %w", err)
+		}
+		logger.WithField("sourceCommit", rc.source.commit).
+			Debug("wrote branch metadata")
+	}
+	if err = writeReport(res.Report, outputDir); err != nil {
+		return err
+	}
+
+	// Write the fully-rendered manifests to the root of the repo
+	if err = writeAllManifests(*rc, outputDir); err != nil {
+		return err
+	}
+	logger.Debug("wrote all manifests")
+
+	// Copy the manifests to any local paths they weren't written to directly
+	if len(p.localOutputs) == 0 {
+		for _, out := range locals {
+			dir, err := copyLocalOutput(ctx, *rc, out, outputDir, res.Report)
+			if err != nil {
+				return err
+			}
+			p.localOutputs = append(
+				p.localOutputs,
+				preparedLocalOutput{localOutput: out, dir: dir},
+			)
+		}
+	}
+	for i := range p.localOutputs {
+		out := &p.localOutputs[i]
+		if out.metadata, err = finishLocalOutput(out.localOutput, out.dir); err != nil {
+			return err
+		}
+		out.finished = true
+	}
+	if len(locals) > 0 {
+		logger.WithField("paths", len(locals)).Debug("wrote local outputs")
+	}
+
+	// If we're only writing to local paths, we're done
+	if !toBranch {
+		res.BranchMetadata = p.localOutputs[0].metadata
+		res.ActionTaken = ActionTakenWroteToLocalPath
+		res.LocalPath = locals[0].path
+		p.done = true
+		return nil
+	}
+
+	// If we're only planning, record the changes and we're done
+	if rc.plan != nil {
+		if err = completePlan(ctx, *rc); err != nil {
+			return fmt.Errorf("error creating plan: %w", err)
+		}
+		res.ActionTaken = ActionTakenNone
+		p.done = true
+	}
+	return nil
+}
+
+// Publish commits the outputs written by WriteOutputs, unless they do not
+// meaningfully differ from the head of the branch they are to be committed
+// to, pushes the commit to the remote repository, and, if applicable, opens
+// or updates a pull request to the target branch. Changes to nothing but
+// Kargo Render's metadata are only published if the target branch's
+// configuration says to. The Response to the request is returned.
+func (p *Pipeline) Publish(ctx context.Context) (Response, error) {
+	err := p.run(pipelineStagePublish, func() error {
+		return p.publish(ctx)
+	})
+	return p.Response(), err
+}
+
+func (p *Pipeline) publish(ctx context.Context) error {
+	s := p.svc
+	rc := &p.rc
+	logger := rc.logger
+
+	// If we get to here, we're writing to the remote repository
+
+	// Before committing, check if we actually have any diffs from the head of
+	// this branch that are NOT just Kargo Render metadata or fields the branch is
+	// configured to ignore. We'd have an error if we tried to commit with no
+	// diffs!
+	var err error
+	if err = rc.repo.AddAll(ctx); err != nil {
+		return fmt.Errorf("error staging changes: %w", err)
+	}
+	diffPaths, err := rc.repo.GetStagedDiffPaths(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for diffs: %w", err)
+	}
+	meaningful, err := hasMeaningfulChanges(ctx, *rc, diffPaths)
+	if err != nil {
+		return err
+	}
+	if !meaningful {
+		logger.WithField("commitBranch", rc.target.commit.branch).Debug(
+			"manifests do not differ from the head of the " +
+				"commit branch; no further action is required",
+		)
+		if len(p.res.RelocatedApps) > 0 {
+			// The relocation commit must be published even though nothing else
+			// is committed
+			if err = rc.repo.ResetHard(ctx); err != nil {
+				return fmt.Errorf("error discarding changes: %w", err)
+			}
+			if rc.target.commit.id, err = rc.repo.LastCommitID(ctx); err != nil {
+				return fmt.Errorf(
+					"error getting last commit ID from the commit branch: %w",
+					err,
+				)
+			}
+			p.res, err = s.publish(ctx, *rc, p.res)
+			return err
+		}
+		var recordMetadata bool
+		if recordMetadata, err =
+			metadataChangesToRecord(ctx, *rc, diffPaths); err != nil {
+			return err
+		}
+		if recordMetadata {
+			p.res, err = s.publishMetadataChanges(ctx, *rc, p.res)
+			return err
+		}
+		p.res.ActionTaken = ActionTakenNone
+		if p.res.CommitID, err = rc.repo.LastCommitID(ctx); err != nil {
+			return fmt.Errorf(
+				"error getting last commit ID from the commit branch: %w",
+				err,
+			)
+		}
+		return nil
+	}
+
+	// Only now that we know a commit will be made do we record it in the
+	// changelog, since doing so is itself a change
+	if cfg := rc.target.branchConfig.Changelog; cfg != nil {
+		if err = updateChangelog(
+			rc.repo.WorkingDir(),
+			cfg,
+			newChangelogEntry(*rc, time.Now()),
+		); err != nil {
+			return fmt.Errorf("error updating changelog: %w", err)
+		}
+		logger.Debug("updated changelog")
+	}
+
+	if rc.target.commit.message, err = buildCommitMessage(ctx, *rc); err != nil {
+		return err
+	}
+	logger.Debug("prepared commit message")
+
+	var diff string
+	if s.artifactsDir != "" {
+		if err = rc.repo.AddAll(ctx); err != nil {
+			return fmt.Errorf("error staging changes: %w", err)
+		}
+		if diff, err = rc.repo.GetStagedDiff(ctx); err != nil {
+			return fmt.Errorf("error getting diff: %w", err)
+		}
+	}
+
+	if p.res, err = s.commitAndPublish(ctx, *rc, p.res); err != nil {
+		return err
+	}
+
+	if s.artifactsDir != "" {
+		artifacts := Artifacts{
+			ID:             rc.request.id,
+			Tenant:         rc.request.Tenant,
+			RepoURL:        rc.request.RepoURL,
+			TargetBranch:   rc.request.TargetBranch,
+			CommitID:       p.res.CommitID,
+			PullRequestURL: p.res.PullRequestURL,
+			Manifests:      make(map[string]string, len(rc.target.renderedManifests)),
+			Diff:           diff,
+			Created:        time.Now().UTC(),
+		}
+		for appName, appManifests := range rc.target.renderedManifests {
+			artifacts.Manifests[appName] = string(appManifests)
+		}
+		// The commit has already been published, so failing to persist its
+		// artifacts must not fail the request
+		if err = saveArtifacts(s.artifactsDir, artifacts); err != nil {
+			logger.WithError(err).Error("error persisting artifacts")
+		} else {
+			p.res.ArtifactsID = artifacts.ID
+		}
+	}
+
+	p.startEndLogger.Debug("completed rendering request")
+	return nil
+}
+
+// Close releases the workspace used by the Pipeline, unless it is pinned, or
+// unless a stage failed and the Service is configured to keep the workspaces
+// of failed requests. In the latter cases, the error returned by the stage
+// that failed is returned again, amended with the location of the workspace.
+// Otherwise, that error, if any, is returned as it is. Calling Close more than
+// once has no further effect.
+func (p *Pipeline) Close() error {
+	if p.closed {
+		return p.err
+	}
+	p.closed = true
+	rc := &p.rc
+	logger := rc.logger
+	if p.unlockWorkspace != nil {
+		defer func() {
+			if err := p.unlockWorkspace(); err != nil {
+				logger.WithError(err).Error("error unlocking workspace")
+			}
+		}()
+	}
+
+	// Local outputs are removed if the request failed, and temporary
+	// directories from which tar archives were written are removed either way
+	for i := range p.localOutputs {
+		out := &p.localOutputs[i]
+		var paths []string
+		if out.dir != out.path {
+			paths = append(paths, out.dir)
+		}
+		if p.err != nil {
+			paths = append(paths, out.path)
+			out.finished = false
+		}
+		for _, path := range paths {
+			if rmErr := os.RemoveAll(path); rmErr != nil {
+				logger.WithError(rmErr).Error(
+					"error cleaning up local output directory",
+				)
+			}
+		}
+	}
+
+	if rc.repo == nil {
+		return p.err
+	}
+	if rc.request.LocalInPath == "" {
+		p.res.Clone = p.svc.cloneStats(
+			context.Background(),
+			logger,
+			rc.repo,
+			rc.request.RepoURL,
+			CloneStrategy(p.repoOpts.CloneStrategy),
+		)
+	}
+	if isWorkspacePinned(rc.repo.HomeDir()) {
+		rc.repo.Release()
+		logger.WithField("workspace", rc.repo.HomeDir()).
+			Info("retained pinned workspace")
+		if p.err != nil {
+			p.err = fmt.Errorf(
+				"%w (workspace pinned at %s)",
+				p.err,
+				rc.repo.HomeDir(),
+			)
+		}
+		return p.err
+	}
+	if p.err != nil && p.svc.keepWorkspacesOnError {
+		rc.repo.Release()
+		p.err = keepWorkspace(logger, rc.repo.HomeDir(), p.err)
+		return p.err
+	}
+	rc.repo.Close()
+	return p.err
+}
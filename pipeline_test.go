@@ -0,0 +1,237 @@
+package render
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestPipeline(t *testing.T) {
+	originDir := t.TempDir()
+	srcDir := t.TempDir()
+	git := func(dir string, arg ...string) string {
+		cmd := exec.Command("git", arg...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	git(originDir, "init", "-q", "--bare", "-b", "main")
+	git(srcDir, "init", "-q", "-b", "main")
+	git(srcDir, "config", "user.name", "Test")
+	git(srcDir, "config", "user.email", "test@example.com")
+	git(srcDir, "remote", "add", "origin", originDir)
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(srcDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+			0600,
+		),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "initial commit")
+	git(srcDir, "push", "-q", "origin", "main")
+
+	s, ok := NewService(nil).(*service)
+	require.True(t, ok)
+	s.renderFn = func(
+		context.Context,
+		string,
+		argocd.ConfigManagementConfig,
+		*commandTrace,
+	) ([]byte, error) {
+		return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+	}
+
+	ctx := context.Background()
+	p, err := s.NewPipeline(&Request{
+		LocalInPath:   srcDir,
+		TargetBranch:  "env/dev",
+		CommitMessage: "Render env/dev",
+		// Last-mile rendering requires kustomize
+		Options: map[string]string{OptionSkipLastMile: "true"},
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	// Stages must run in order
+	require.ErrorContains(
+		t,
+		p.LoadConfig(ctx),
+		"stage LoadConfig cannot run next; expected stage PrepareWorkspace",
+	)
+
+	require.NoError(t, p.PrepareWorkspace(ctx))
+	require.NoError(t, p.LoadConfig(ctx))
+	require.NoError(t, p.PreRenderApps(ctx))
+	require.NoError(t, p.LastMile(ctx))
+	require.Contains(t, string(p.Manifests()["foo"]), "name: foo")
+
+	// Stages may not run again
+	require.ErrorContains(
+		t,
+		p.LastMile(ctx),
+		"stage LastMile cannot run next; expected stage WriteOutputs",
+	)
+
+	// The rendered manifests haven't been pushed to the remote repository yet
+	require.NotContains(
+		t,
+		git(originDir, "log", "--format=%s", "env/dev"),
+		"Render env/dev",
+	)
+
+	require.NoError(t, p.WriteOutputs(ctx))
+	require.False(t, p.Done())
+	res, err := p.Publish(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+	require.Equal(
+		t,
+		res.CommitID+"\n",
+		git(originDir, "rev-parse", "env/dev"),
+	)
+	require.NoError(t, p.Close())
+}
+
+func TestPipelineStageFailure(t *testing.T) {
+	s, ok := NewService(nil).(*service)
+	require.True(t, ok)
+	ctx := context.Background()
+	p, err := s.NewPipeline(&Request{
+		LocalInPath:  t.TempDir(),
+		TargetBranch: "env/dev",
+	})
+	require.NoError(t, err)
+
+	// The directory isn't a git repository
+	err = p.PrepareWorkspace(ctx)
+	require.Error(t, err)
+	require.ErrorContains(
+		t,
+		p.LoadConfig(ctx),
+		"stage LoadConfig cannot run after an earlier stage failed",
+	)
+	require.ErrorIs(t, p.Close(), err)
+	require.ErrorContains(t, p.LoadConfig(ctx), "pipeline is closed")
+}
+
+func TestTargetBranchOwnership(t *testing.T) {
+	testCases := []struct {
+		name       string
+		files      map[string]string
+		assertions func(*testing.T, Response, error)
+	}{
+		{
+			name:  "branch with only an initial commit",
+			files: map[string]string{},
+			assertions: func(t *testing.T, res Response, err error) {
+				require.NoError(t, err)
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+			},
+		},
+		{
+			name: "branch with only metadata",
+			files: map[string]string{
+				".kargo-render/metadata.yaml": "sourceCommit: abc\n",
+			},
+			assertions: func(t *testing.T, res Response, err error) {
+				require.NoError(t, err)
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+			},
+		},
+		{
+			name:  "unmanaged branch",
+			files: map[string]string{"README.md": "# Not rendered\n"},
+			assertions: func(t *testing.T, _ Response, err error) {
+				unmanagedErr := &UnmanagedBranchError{}
+				require.ErrorAs(t, err, &unmanagedErr)
+				require.Equal(t, "env/dev", unmanagedErr.TargetBranch)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			originDir := t.TempDir()
+			srcDir := t.TempDir()
+			git := func(dir string, arg ...string) {
+				cmd := exec.Command("git", arg...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+			}
+			git(originDir, "init", "-q", "--bare", "-b", "main")
+			git(srcDir, "init", "-q", "-b", "main")
+			git(srcDir, "config", "user.name", "Test")
+			git(srcDir, "config", "user.email", "test@example.com")
+			git(srcDir, "remote", "add", "origin", originDir)
+
+			// Prepare the target branch
+			git(srcDir, "checkout", "-q", "--orphan", "env/dev")
+			for path, content := range testCase.files {
+				path = filepath.Join(srcDir, path)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+			}
+			git(srcDir, "add", ".")
+			git(srcDir, "commit", "-q", "--allow-empty", "-m", "prepare env/dev")
+			git(srcDir, "push", "-q", "origin", "env/dev")
+			git(srcDir, "rm", "-q", "-r", "--ignore-unmatch", ".")
+
+			git(srcDir, "checkout", "-q", "--orphan", "main")
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(srcDir, "kargo-render.yaml"),
+					[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+					0600,
+				),
+			)
+			git(srcDir, "add", "kargo-render.yaml")
+			git(srcDir, "commit", "-q", "-m", "initial commit")
+			git(srcDir, "push", "-q", "origin", "main")
+
+			s, ok := NewService(nil).(*service)
+			require.True(t, ok)
+			s.renderFn = func(
+				context.Context,
+				string,
+				argocd.ConfigManagementConfig,
+				*commandTrace,
+			) ([]byte, error) {
+				return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+			}
+			res, err := s.RenderManifests(
+				context.Background(),
+				&Request{
+					LocalInPath:  srcDir,
+					TargetBranch: "env/dev",
+					// Last-mile rendering requires kustomize
+					Options: map[string]string{OptionSkipLastMile: "true"},
+				},
+			)
+			testCase.assertions(t, res, err)
+		})
+	}
+}
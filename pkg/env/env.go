@@ -1,4 +1,6 @@
-package os
+// Package env provides helpers for reading configuration from environment
+// variables.
+package env
 
 import (
 	"fmt"
@@ -101,3 +103,46 @@ func GetDurationFromEnvVar(
 	}
 	return val, nil
 }
+
+// MustGetRequiredEnvVar is like GetRequiredEnvVar, but panics if the
+// environment variable is not set.
+func MustGetRequiredEnvVar(name string) string {
+	val, err := GetRequiredEnvVar(name)
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// MustGetIntFromEnvVar is like GetIntFromEnvVar, but panics if the value of
+// the environment variable cannot be parsed as an integer.
+func MustGetIntFromEnvVar(name string, defaultValue int) int {
+	val, err := GetIntFromEnvVar(name, defaultValue)
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// MustGetBoolFromEnvVar is like GetBoolFromEnvVar, but panics if the value of
+// the environment variable cannot be parsed as a bool.
+func MustGetBoolFromEnvVar(name string, defaultValue bool) bool {
+	val, err := GetBoolFromEnvVar(name, defaultValue)
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// MustGetDurationFromEnvVar is like GetDurationFromEnvVar, but panics if the
+// value of the environment variable cannot be parsed as a time.Duration.
+func MustGetDurationFromEnvVar(
+	name string,
+	defaultValue time.Duration,
+) time.Duration {
+	val, err := GetDurationFromEnvVar(name, defaultValue)
+	if err != nil {
+		panic(err)
+	}
+	return val
+}
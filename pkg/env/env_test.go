@@ -1,4 +1,4 @@
-package os
+package env
 
 import (
 	"testing"
@@ -258,3 +258,39 @@ func TestGetDurationFromEnvVar(t *testing.T) {
 		})
 	}
 }
+
+func TestMustGetRequiredEnvVar(t *testing.T) {
+	require.Panics(t, func() {
+		MustGetRequiredEnvVar(testEnvVarName)
+	})
+	t.Setenv(testEnvVarName, "foo")
+	require.Equal(t, "foo", MustGetRequiredEnvVar(testEnvVarName))
+}
+
+func TestMustGetIntFromEnvVar(t *testing.T) {
+	require.Equal(t, 42, MustGetIntFromEnvVar(testEnvVarName, 42))
+	t.Setenv(testEnvVarName, "foo")
+	require.Panics(t, func() {
+		MustGetIntFromEnvVar(testEnvVarName, 42)
+	})
+}
+
+func TestMustGetBoolFromEnvVar(t *testing.T) {
+	require.True(t, MustGetBoolFromEnvVar(testEnvVarName, true))
+	t.Setenv(testEnvVarName, "foo")
+	require.Panics(t, func() {
+		MustGetBoolFromEnvVar(testEnvVarName, true)
+	})
+}
+
+func TestMustGetDurationFromEnvVar(t *testing.T) {
+	require.Equal(
+		t,
+		time.Minute,
+		MustGetDurationFromEnvVar(testEnvVarName, time.Minute),
+	)
+	t.Setenv(testEnvVarName, "foo")
+	require.Panics(t, func() {
+		MustGetDurationFromEnvVar(testEnvVarName, time.Minute)
+	})
+}
@@ -0,0 +1,140 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// PrefixScan populates the exported fields of the struct pointed to by opts
+// from environment variables whose names begin with the specified prefix. By
+// default, the name of the environment variable for a field is the prefix
+// followed by the field's name converted to upper snake case. For instance,
+// with the prefix "KARGO_RENDER_", a field named RepoUsername is populated from
+// KARGO_RENDER_REPO_USERNAME. The name can be overridden using an `env` struct
+// tag and a field can be excluded using the tag `env:"-"`.
+//
+// Fields may be strings, bools, integers, time.Durations, or string slices,
+// which are parsed from comma-delimited values. Fields may also be structs,
+// whose fields are populated from environment variables whose names begin
+// with the name of the struct field followed by an underscore. For instance,
+// a field named CertFile in a struct field named TLS is populated from
+// KARGO_RENDER_TLS_CERT_FILE. Fields whose environment
+// variables are unset or empty are left unmodified, so opts may be initialized
+// with default values before it is passed to PrefixScan. All values that cannot
+// be parsed are reported together in the returned error.
+func PrefixScan(prefix string, opts any) error {
+	val := reflect.ValueOf(opts)
+	if val.Kind() != reflect.Pointer || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct; got %T", opts)
+	}
+	return errors.Join(scanStruct(prefix, val.Elem())...)
+}
+
+// scanStruct populates the exported fields of the provided struct from
+// environment variables whose names begin with the specified prefix.
+func scanStruct(prefix string, val reflect.Value) []error {
+	valType := val.Type()
+	var errs []error
+	for i := 0; i < valType.NumField(); i++ {
+		field := valType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		suffix := field.Tag.Get("env")
+		if suffix == "-" {
+			continue
+		}
+		if suffix == "" {
+			suffix = upperSnakeCase(field.Name)
+		}
+		name := prefix + suffix
+		if field.Type.Kind() == reflect.Struct {
+			errs = append(errs, scanStruct(name+"_", val.Field(i))...)
+			continue
+		}
+		valStr := os.Getenv(name)
+		if valStr == "" {
+			continue
+		}
+		if err := setField(val.Field(i), valStr); err != nil {
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"value %q for environment variable %s was not parsable: %w",
+					valStr,
+					name,
+					err,
+				),
+			)
+		}
+	}
+	return errs
+}
+
+// setField parses the provided string and sets the provided field to the
+// result.
+func setField(field reflect.Value, valStr string) error {
+	if field.Type() == durationType {
+		val, err := time.ParseDuration(valStr)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(val))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(valStr)
+	case reflect.Bool:
+		val, err := strconv.ParseBool(valStr)
+		if err != nil {
+			return err
+		}
+		field.SetBool(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := strconv.ParseInt(valStr, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(val)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		items := strings.Split(valStr, ",")
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			slice.Index(i).SetString(strings.TrimSpace(item))
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// upperSnakeCase converts a Go identifier such as "RepoURL" to upper snake
+// case, e.g. "REPO_URL".
+func upperSnakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixScan(t *testing.T) {
+	type testOptions struct {
+		LogLevel     string
+		RepoURL      string
+		Debug        bool
+		Port         int
+		Timeout      time.Duration
+		Images       []string
+		Renamed      string `env:"OTHER_NAME"`
+		Skipped      string `env:"-"`
+		DefaultValue string
+		TLS          struct {
+			CertFile string
+		}
+	}
+	testCases := []struct {
+		name       string
+		setup      func()
+		opts       any
+		assertions func(*testing.T, any, error)
+	}{
+		{
+			name: "not a pointer to a struct",
+			opts: testOptions{},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "expected a pointer to a struct")
+			},
+		},
+		{
+			name: "success",
+			setup: func() {
+				t.Setenv("TEST_LOG_LEVEL", "debug")
+				t.Setenv("TEST_REPO_URL", "https://github.com/akuity/foobar")
+				t.Setenv("TEST_DEBUG", "true")
+				t.Setenv("TEST_PORT", "8080")
+				t.Setenv("TEST_TIMEOUT", "5s")
+				t.Setenv("TEST_IMAGES", "foo:blue, foo:green")
+				t.Setenv("TEST_OTHER_NAME", "renamed")
+				t.Setenv("TEST_SKIPPED", "skipped")
+				t.Setenv("TEST_TLS_CERT_FILE", "/tls/tls.crt")
+			},
+			opts: &testOptions{DefaultValue: "default"},
+			assertions: func(t *testing.T, opts any, err error) {
+				require.NoError(t, err)
+				expected := &testOptions{
+					LogLevel:     "debug",
+					RepoURL:      "https://github.com/akuity/foobar",
+					Debug:        true,
+					Port:         8080,
+					Timeout:      5 * time.Second,
+					Images:       []string{"foo:blue", "foo:green"},
+					Renamed:      "renamed",
+					DefaultValue: "default",
+				}
+				expected.TLS.CertFile = "/tls/tls.crt"
+				require.Equal(t, expected, opts)
+			},
+		},
+		{
+			name: "unparsable values",
+			setup: func() {
+				t.Setenv("TEST_DEBUG", "maybe")
+				t.Setenv("TEST_PORT", "eighty")
+			},
+			opts: &testOptions{},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.Error(t, err)
+				// All problems are reported together
+				require.Contains(t, err.Error(), "TEST_DEBUG")
+				require.Contains(t, err.Error(), "TEST_PORT")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.setup != nil {
+				testCase.setup()
+			}
+			err := PrefixScan("TEST_", testCase.opts)
+			testCase.assertions(t, testCase.opts, err)
+		})
+	}
+}
+
+func TestUpperSnakeCase(t *testing.T) {
+	for in, expected := range map[string]string{
+		"Port":         "PORT",
+		"LogLevel":     "LOG_LEVEL",
+		"RepoURL":      "REPO_URL",
+		"TLSCertPath":  "TLS_CERT_PATH",
+		"RepoUsername": "REPO_USERNAME",
+	} {
+		require.Equal(t, expected, upperSnakeCase(in))
+	}
+}
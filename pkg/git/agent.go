@@ -0,0 +1,64 @@
+package git
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshAgent is an SSH agent that runs within the current process and holds a
+// single private key in memory, serving it to ssh over a Unix domain socket.
+type sshAgent struct {
+	socketPath string
+	listener   net.Listener
+}
+
+// startSSHAgent starts an SSH agent holding the provided PEM-encoded private
+// key that listens on a Unix domain socket at the specified path.
+func startSSHAgent(socketPath string, key string) (*sshAgent, error) {
+	privateKey, err := ssh.ParseRawPrivateKey([]byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing SSH private key: %w", err)
+	}
+	keyring := agent.NewKeyring()
+	if err = keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		return nil, fmt.Errorf("error adding SSH private key to agent: %w", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error listening for SSH agent connections on %q: %w",
+			socketPath,
+			err,
+		)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				// The listener was closed
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return &sshAgent{
+		socketPath: socketPath,
+		listener:   listener,
+	}, nil
+}
+
+// env returns an environment variable that directs ssh to the agent.
+func (a *sshAgent) env() string {
+	return fmt.Sprintf("SSH_AUTH_SOCK=%s", a.socketPath)
+}
+
+// close stops the agent. The key it held is then no longer available.
+func (a *sshAgent) close() error {
+	return a.listener.Close()
+}
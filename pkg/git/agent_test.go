@@ -0,0 +1,61 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSSHAgent(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	require.NoError(t, err)
+
+	homeDir := t.TempDir()
+	r := &repo{
+		url:     "git@github.com:akuity/test.git",
+		homeDir: homeDir,
+		dir:     homeDir,
+		creds: RepoCredentials{
+			WriteCreds: &RepoCredentials{
+				SSHPrivateKey: string(pem.EncodeToMemory(block)),
+			},
+		},
+		opts: RepoOptions{SSHAgent: true},
+	}
+	cmd, err := r.buildPushCommand(RemoteOrigin, "main")
+	require.NoError(t, err)
+	require.Equal(t, []string{"git", "push", "origin", "main"}, cmd.Args)
+	socketPath := filepath.Join(homeDir, ".ssh", "id_rsa_write.sock")
+	require.Contains(t, cmd.Env, "SSH_AUTH_SOCK="+socketPath)
+
+	// The key is held by the agent and is never written to disk
+	_, err = os.Stat(filepath.Join(homeDir, ".ssh", "id_rsa_write"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	keys, err := agent.NewClient(conn).List()
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	require.Len(t, keys, 1)
+	require.Equal(t, publicKey.Marshal(), keys[0].Marshal())
+
+	// The agent is stopped when the repository is released
+	require.NoError(t, r.Release())
+	_, err = net.Dial("unix", socketPath)
+	require.Error(t, err)
+
+	_, err = startSSHAgent(filepath.Join(homeDir, "invalid.sock"), "not a key")
+	require.ErrorContains(t, err, "error parsing SSH private key")
+}
@@ -1,14 +1,21 @@
 package git
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 
 	libExec "github.com/akuity/kargo-render/internal/exec"
 )
@@ -19,6 +26,44 @@ const (
 	tmpPrefix = "repo-"
 )
 
+// ErrPushRejected is wrapped by errors returned from Push when the remote
+// repository refuses to accept the push, as it does, for instance, when the
+// branch being pushed is protected. It is not wrapped when the push fails
+// because the branch has moved on in the remote repository.
+var ErrPushRejected = errors.New("push rejected by remote repository")
+
+// ErrAuthenticationFailed is wrapped by errors returned from any operation
+// that failed because the remote repository refused the credentials used to
+// access it, or because no credentials were provided where some are required.
+var ErrAuthenticationFailed = errors.New(
+	"remote repository rejected the credentials",
+)
+
+// ErrPermissionDenied is wrapped by errors returned from any operation that
+// failed because the remote repository accepted the credentials used to access
+// it, but they lack permission to do what was attempted, such as pushing.
+var ErrPermissionDenied = errors.New(
+	"credentials lack permission to access the remote repository",
+)
+
+// authFailureOutputs are fragments, in lower case, of the output of git
+// commands that failed because the remote repository refused the credentials.
+var authFailureOutputs = []string{
+	"authentication failed",
+	"could not read username",
+	"invalid username or password",
+	"permission denied (publickey)",
+	"returned error: 401",
+}
+
+// permissionFailureOutputs are fragments, in lower case, of the output of git
+// commands that failed because the credentials may not do what was attempted.
+var permissionFailureOutputs = []string{
+	"returned error: 403",
+	"permission to",
+	"write access to repository not granted",
+}
+
 // RepoCredentials represents the credentials for connecting to a private git
 // repository.
 type RepoCredentials struct {
@@ -33,65 +78,234 @@ type RepoCredentials struct {
 	// field, can be used for both reading from and writing to some remote
 	// repository.
 	Password string `json:"password,omitempty"`
+	// ClientCertificate is a PEM-encoded TLS client certificate presented to
+	// remote repositories accessed over HTTPS that require mutual TLS. It must
+	// be accompanied by ClientKey.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	// ClientKey is the PEM-encoded private key for ClientCertificate.
+	ClientKey string `json:"clientKey,omitempty"`
+	// ExtraHTTPHeaders are additional headers, indexed by name, that are sent
+	// with every HTTP(S) request made to the remote repository using these
+	// credentials. This permits authentication to servers that expect a token
+	// in a header, such as GitLab's PRIVATE-TOKEN, instead of basic auth. Their
+	// values are redacted from logged commands.
+	ExtraHTTPHeaders map[string]string `json:"extraHTTPHeaders,omitempty"`
+	// Netrc specifies that Username and Password should be supplied to git
+	// using a .netrc file in the repository's isolated home directory, with an
+	// entry for the host of every remote repository accessed over HTTP(S),
+	// instead of using git's "store" credential helper. This is useful with
+	// servers and proxies that are set up to be used with .netrc. Credentials
+	// in .netrc are used for both reading and writing, so this cannot be
+	// combined with ReadCreds or WriteCreds.
+	Netrc bool `json:"netrc,omitempty"`
+	// ReadCreds, if non-nil, are used in place of all other fields for reading
+	// from the remote repository. They must not themselves specify ReadCreds or
+	// WriteCreds.
+	ReadCreds *RepoCredentials `json:"readCreds,omitempty"`
+	// WriteCreds, if non-nil, are used in place of all other fields for writing
+	// to the remote repository, which includes pushing and opening pull
+	// requests. They must not themselves specify ReadCreds or WriteCreds.
+	WriteCreds *RepoCredentials `json:"writeCreds,omitempty"`
+}
+
+// ForReading returns the credentials to use for reading from the remote
+// repository. These are ReadCreds, if specified, or otherwise, the
+// credentials themselves.
+func (c RepoCredentials) ForReading() RepoCredentials {
+	if c.ReadCreds != nil {
+		return *c.ReadCreds
+	}
+	c.ReadCreds = nil
+	c.WriteCreds = nil
+	return c
+}
+
+// ForWriting returns the credentials to use for writing to the remote
+// repository. These are WriteCreds, if specified, or otherwise, the
+// credentials themselves.
+func (c RepoCredentials) ForWriting() RepoCredentials {
+	if c.WriteCreds != nil {
+		return *c.WriteCreds
+	}
+	c.ReadCreds = nil
+	c.WriteCreds = nil
+	return c
 }
 
 // Repo is an interface for interacting with a git repository.
 type Repo interface {
 	// AddAll stages pending changes for commit.
-	AddAll() error
+	AddAll(ctx context.Context) error
 	// AddAllAndCommit is a convenience function that stages pending changes for
 	// commit to the current branch and then commits them using the provided
 	// commit message.
-	AddAllAndCommit(message string) error
+	AddAllAndCommit(ctx context.Context, message string) error
 	// Clean cleans the working directory.
-	Clean() error
+	Clean(ctx context.Context) error
 	// Close cleans up file system resources used by this repository. This should
-	// always be called before a repository goes out of scope.
+	// always be called before a repository goes out of scope, unless Release is
+	// called instead.
 	Close() error
+	// Release releases resources held by this repository, such as any SSH
+	// agent, without removing its home directory. This should be called in place
+	// of Close when the home directory is to be retained after the repository
+	// goes out of scope. Any credentials in the home directory are then eligible
+	// for removal by SweepCredentials.
+	Release() error
 	// Checkout checks out the specified branch.
-	Checkout(branch string) error
+	Checkout(ctx context.Context, branch string) error
 	// Commit commits staged changes to the current branch.
-	Commit(message string, opts *CommitOptions) error
+	Commit(ctx context.Context, message string, opts *CommitOptions) error
 	// CreateChildBranch creates a new branch that is a child of the current
 	// branch.
-	CreateChildBranch(branch string) error
+	CreateChildBranch(ctx context.Context, branch string) error
 	// CreateOrphanedBranch creates a new branch that shares no commit history
 	// with any other branch.
-	CreateOrphanedBranch(branch string) error
+	CreateOrphanedBranch(ctx context.Context, branch string) error
 	// HasDiffs returns a bool indicating whether the working directory currently
 	// contains any differences from what's already at the head of the current
 	// branch.
-	HasDiffs() (bool, error)
+	HasDiffs(ctx context.Context) (bool, error)
+	// Status describes, in the order git reports them, every path in the
+	// working tree or the index that differs from what's already at the head
+	// of the current branch, including untracked files.
+	Status(ctx context.Context) ([]StatusEntry, error)
 	// GetDiffPaths returns a string slice indicating the paths, relative to the
-	// root of the repository, of any new or modified files.
-	GetDiffPaths() ([]string, error)
+	// root of the repository, of any new, modified, or deleted files. Both the
+	// old and new paths of renamed files are included.
+	GetDiffPaths(ctx context.Context) ([]string, error)
+	// ExportTree writes the files at the specified ref (a branch, tag, or
+	// commit) to the specified directory without changing the current branch,
+	// the index, or the working tree.
+	ExportTree(ctx context.Context, ref string, dir string) error
+	// GetStagedDiff returns a unified diff of all changes that are staged for
+	// commit.
+	GetStagedDiff(ctx context.Context) (string, error)
+	// GetStagedDiffPaths returns a string slice indicating the paths, relative
+	// to the root of the repository, of any new, modified, or deleted files that
+	// are staged for commit.
+	GetStagedDiffPaths(ctx context.Context) ([]string, error)
+	// IsAncestor returns a bool indicating whether the commit identified by
+	// ancestor is an ancestor of, or the same as, the commit identified by
+	// descendant.
+	IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error)
 	// LastCommitID returns the ID (sha) of the most recent commit to the current
 	// branch.
-	LastCommitID() (string, error)
+	LastCommitID(ctx context.Context) (string, error)
 	// LocalBranchExists returns a bool indicating if the specified branch exists.
-	LocalBranchExists(branch string) (bool, error)
+	LocalBranchExists(ctx context.Context, branch string) (bool, error)
 	// CommitMessage returns the text of the most recent commit message associated
 	// with the specified commit ID.
-	CommitMessage(id string) (string, error)
+	CommitMessage(ctx context.Context, id string) (string, error)
+	// CommitSignature returns details of the signature on the specified commit,
+	// verified against the provided trusted public keys. Each key may be either
+	// an ASCII-armored OpenPGP public key or an SSH public key in the format
+	// used by authorized_keys files.
+	CommitSignature(
+		ctx context.Context,
+		id string,
+		trustedKeys []string,
+	) (CommitSignature, error)
+	// ReadFileAtCommit returns the contents of the file at the specified path,
+	// relative to the root of the repository, as of the specified commit. If no
+	// such file existed as of that commit, the returned error wraps
+	// fs.ErrNotExist.
+	ReadFileAtCommit(ctx context.Context, id string, path string) ([]byte, error)
 	// CommitMessages returns a slice of commit messages starting with id1 and
 	// ending with id2. The results exclude id1, but include id2.
-	CommitMessages(id1, id2 string) ([]string, error)
+	CommitMessages(ctx context.Context, id1, id2 string) ([]string, error)
+	// FullCommitMessage returns the complete message, including both the
+	// subject and the body, of the commit with the specified ID.
+	FullCommitMessage(ctx context.Context, id string) (string, error)
+	// CommitChanges returns the changes the specified commit made to files,
+	// relative to its first parent or, if it has no parent, relative to an
+	// empty tree.
+	CommitChanges(ctx context.Context, id string) ([]FileChange, error)
+	// ParentCommitID returns the ID of the first parent of the specified
+	// commit. An empty string is returned if the commit has no parent.
+	ParentCommitID(ctx context.Context, id string) (string, error)
+	// UnpushedCommitIDs returns the IDs of all commits to the current branch
+	// that are not contained in any branch of the remote repository, as of the
+	// last fetch, ordered from oldest to newest.
+	UnpushedCommitIDs(ctx context.Context) ([]string, error)
 	// Fetch fetches from the remote repository.
-	Fetch() error
+	Fetch(ctx context.Context) error
+	// FetchRef fetches the specified ref, e.g. refs/notes/commits, from the
+	// remote repository, replacing the local ref of the same name. If the
+	// remote repository has no such ref, nothing is fetched and false is
+	// returned.
+	FetchRef(ctx context.Context, ref string) (bool, error)
 	// Pull fetches from the remote repository and merges the changes into the
 	// current branch.
-	Pull(branch string) error
+	Pull(ctx context.Context, branch string) error
+	// Merge merges the specified commit or other revision, e.g. origin/env/dev,
+	// into the current branch, creating a merge commit with the provided
+	// message unless the branch can simply be fast-forwarded. If the changes
+	// conflict, the merge is aborted, leaving the current branch and working
+	// tree as they were, and the conflicts are described by the result instead
+	// of by an error.
+	Merge(ctx context.Context, rev string, message string) (MergeResult, error)
+	// Rebase replays the commits of the current branch that are not reachable
+	// from the specified commit or other revision on top of it. If replaying a
+	// commit produces conflicts, the rebase is aborted, leaving the current
+	// branch and working tree as they were, and the conflicts are described by
+	// the result instead of by an error.
+	Rebase(ctx context.Context, upstream string) (MergeResult, error)
 	// Push pushes from the current branch to a remote branch by the same name.
-	Push() error
+	Push(ctx context.Context) error
+	// PushDryRun does everything Push does except actually write to the remote
+	// repository. This verifies that a push would be permitted.
+	PushDryRun(ctx context.Context) error
+	// PushRef pushes the specified local ref, or commit, to the specified ref of
+	// the remote repository, which must be a fast-forward.
+	PushRef(ctx context.Context, src string, dst string) error
+	// ForcePush pushes from the current branch to a remote branch by the same
+	// name, even if that is not a fast-forward, but only if the remote branch
+	// is still at the specified commit. This is used to replace an amended
+	// commit without risk of discarding anything pushed in the meantime.
+	ForcePush(ctx context.Context, expectedID string) error
+	// ReadNote returns the content of the note attached to the specified commit
+	// in the specified notes ref, e.g. refs/notes/commits. If there is no such
+	// note, the returned error wraps fs.ErrNotExist.
+	ReadNote(ctx context.Context, notesRef string, id string) ([]byte, error)
+	// WriteNote attaches a note with the provided content to the specified
+	// commit in the specified notes ref, replacing any note already attached to
+	// it. The commit need not be present in the local repository.
+	WriteNote(
+		ctx context.Context,
+		notesRef string,
+		id string,
+		content []byte,
+	) error
+	// CommitFile creates a commit whose tree is the tree of the specified
+	// parent commit with the file at the specified path replaced by one with the
+	// provided content. If the parent is empty, the commit has no parent and
+	// contains only that file. Neither the working tree, the index, nor any
+	// branch is changed. The ID of the new commit is returned.
+	CommitFile(
+		ctx context.Context,
+		parent string,
+		path string,
+		content []byte,
+		message string,
+	) (string, error)
 	// RemoteBranchExists returns a bool indicating if the specified branch exists
 	// in the remote repository.
-	RemoteBranchExists(branch string) (bool, error)
+	RemoteBranchExists(ctx context.Context, branch string) (bool, error)
 	// Remotes returns a slice of strings representing the names of the remotes.
-	Remotes() ([]string, error)
+	Remotes(ctx context.Context) ([]string, error)
 	// RemoteURL returns the URL of the the specified remote.
-	RemoteURL(name string) (string, error)
+	RemoteURL(ctx context.Context, name string) (string, error)
 	// ResetHard performs a hard reset.
-	ResetHard() error
+	ResetHard(ctx context.Context) error
+	// SetCredentials replaces the credentials used for authenticating to the
+	// remote repository. This permits short-lived tokens to be rotated for the
+	// benefit of long-running operations.
+	SetCredentials(repoCreds RepoCredentials) error
+	// StagePaths unstages any staged changes and then stages pending changes to
+	// only the specified paths, each of which must exist in either the working
+	// tree or the index.
+	StagePaths(ctx context.Context, paths []string) error
 	// URL returns the remote URL of the repository.
 	URL() string
 	// WorkingDir returns an absolute path to the repository's working tree.
@@ -99,16 +313,219 @@ type Repo interface {
 	// HomeDir returns an absolute path to the home directory of the system user
 	// who has cloned this repo.
 	HomeDir() string
+	// ObjectBytes returns the total size, in bytes, of the objects stored in
+	// the repository. Since objects that are not already present are fetched
+	// from the remote repository, this approximates how much has been
+	// transferred from it, including any objects fetched on demand because of
+	// a partial clone.
+	ObjectBytes(ctx context.Context) (int64, error)
+}
+
+// FileChange describes a change made to a single file by a commit.
+type FileChange struct {
+	// Path is the path of the file, relative to the root of the repository.
+	Path string
+	// Deleted indicates whether the file was deleted. If false, the file was
+	// added or modified.
+	Deleted bool
+}
+
+// StatusEntry describes a single path that differs from what's already at the
+// head of the current branch.
+type StatusEntry struct {
+	// Kind describes what sort of difference the entry records.
+	Kind StatusEntryKind
+	// Index is git's one character code describing how the path differs in the
+	// index, e.g. 'M' for modified, 'A' for added, 'D' for deleted, or 'R' for
+	// renamed. It is '.' if the path is unchanged in the index and '?' if the
+	// path is untracked.
+	Index byte
+	// WorkTree is git's one character code describing how the path differs in
+	// the working tree from the index, using the same codes as Index.
+	WorkTree byte
+	// Path is the path of the file, relative to the root of the repository.
+	Path string
+	// OrigPath is the path, relative to the root of the repository, that the
+	// file was renamed or copied from. It is only set for entries of kind
+	// StatusEntryKindRenamed or StatusEntryKindCopied.
+	OrigPath string
+}
+
+// StatusEntryKind describes what sort of difference a StatusEntry records.
+type StatusEntryKind string
+
+const (
+	// StatusEntryKindChanged indicates that a tracked file was added, modified,
+	// or deleted.
+	StatusEntryKindChanged StatusEntryKind = "changed"
+	// StatusEntryKindRenamed indicates that a tracked file was renamed.
+	StatusEntryKindRenamed StatusEntryKind = "renamed"
+	// StatusEntryKindCopied indicates that a tracked file was copied.
+	StatusEntryKindCopied StatusEntryKind = "copied"
+	// StatusEntryKindUnmerged indicates that a file has unresolved conflicts.
+	StatusEntryKindUnmerged StatusEntryKind = "unmerged"
+	// StatusEntryKindUntracked indicates that a file is not tracked.
+	StatusEntryKindUntracked StatusEntryKind = "untracked"
+)
+
+// MergeResult describes the outcome of a merge or rebase.
+type MergeResult struct {
+	// CommitID is the ID of the commit at the head of the current branch once
+	// the operation has succeeded. It is not set if there were conflicts.
+	CommitID string
+	// Conflicts describes, in order by path, every path with conflicting
+	// changes. If it is empty, the operation succeeded.
+	Conflicts []Conflict
+	// ConflictingCommitID is the ID of the commit that could not be replayed
+	// without conflicts. It is only set by Rebase.
+	ConflictingCommitID string
+}
+
+// Conflict describes a path with conflicting changes.
+type Conflict struct {
+	// Path is the path of the file, relative to the root of the repository.
+	Path string
+	// Kind describes how the changes to the file conflict.
+	Kind ConflictKind
+}
+
+// ConflictKind describes how the changes made to a file by both sides of a
+// merge or rebase conflict. "Us" is the current branch when merging, but the
+// upstream revision when rebasing, since a rebase replays the current
+// branch's commits onto the upstream revision.
+type ConflictKind string
+
+const (
+	// ConflictKindBothModified indicates that both sides modified the file.
+	ConflictKindBothModified ConflictKind = "bothModified"
+	// ConflictKindBothAdded indicates that both sides added the file with
+	// different content.
+	ConflictKindBothAdded ConflictKind = "bothAdded"
+	// ConflictKindBothDeleted indicates that both sides deleted the file, which
+	// conflicts only when they also renamed it differently.
+	ConflictKindBothDeleted ConflictKind = "bothDeleted"
+	// ConflictKindAddedByUs indicates that only our side added the file, which
+	// conflicts only when the other side renamed something to the same path.
+	ConflictKindAddedByUs ConflictKind = "addedByUs"
+	// ConflictKindAddedByThem indicates that only their side added the file,
+	// which conflicts only when our side renamed something to the same path.
+	ConflictKindAddedByThem ConflictKind = "addedByThem"
+	// ConflictKindDeletedByUs indicates that our side deleted the file while
+	// their side modified it.
+	ConflictKindDeletedByUs ConflictKind = "deletedByUs"
+	// ConflictKindDeletedByThem indicates that their side deleted the file
+	// while our side modified it.
+	ConflictKindDeletedByThem ConflictKind = "deletedByThem"
+)
+
+// CloneStrategy determines how much of the history and content of a remote
+// repository is fetched when it is cloned.
+type CloneStrategy string
+
+const (
+	// CloneStrategyFull fetches the entire history and content of the remote
+	// repository. This is the default.
+	CloneStrategyFull CloneStrategy = "full"
+	// CloneStrategyShallow fetches only the most recent commit of each branch.
+	// Commits that are not at the tip of any branch cannot be checked out, and
+	// operations that examine history, such as IsAncestor and CommitMessages,
+	// see only the fetched commits.
+	CloneStrategyShallow CloneStrategy = "shallow"
+	// CloneStrategyPartial fetches the entire history of the remote repository,
+	// but defers fetching the objects excluded by RepoOptions.CloneFilter until
+	// they are needed. Remote repositories that do not support partial clones
+	// are cloned in full instead.
+	CloneStrategyPartial CloneStrategy = "partial"
+)
+
+// DefaultCloneFilter is the filter spec (see git rev-list --filter) used by
+// CloneStrategyPartial when no other is specified. It defers fetching the
+// contents of all files until they are needed.
+const DefaultCloneFilter = "blob:none"
+
+// RepoOptions represents optional settings for cloning or copying a
+// repository.
+type RepoOptions struct {
+	// CommandTimeout, if non-zero, is the maximum amount of time any single git
+	// command may run before it is killed.
+	CommandTimeout time.Duration
+	// Logger, if non-nil, is used to log git commands and their output at DEBUG
+	// level. Credentials are redacted from all such output.
+	Logger *log.Entry
+	// ReferenceDir, if non-empty, is the path to a local mirror of the remote
+	// repository, such as one created using Mirror, from which objects are
+	// copied when cloning instead of being fetched from the remote repository.
+	// If no repository exists at the path, it is ignored.
+	ReferenceDir string
+	// CommandObserver, if non-nil, is invoked once for every command executed
+	// on behalf of the repository, after the command has completed, with the
+	// command itself, its exit code, and how long it took. Credentials are
+	// redacted from the command. The exit code is -1 if the command could not
+	// be started or was killed.
+	CommandObserver func(command string, exitCode int, duration time.Duration)
+	// HomeDir, if non-empty, is the path to use as the repository's home
+	// directory in place of a new temporary directory. It is created if it
+	// does not already exist. If it already contains a clone of the same
+	// remote repository, as it would following an earlier, interrupted
+	// attempt at the same work, Clone reuses that clone, restoring it to the
+	// state of a fresh clone, instead of cloning again.
+	HomeDir string
+	// CloneStrategy determines how much of the remote repository is fetched
+	// when it is cloned. If not specified, CloneStrategyFull is assumed.
+	CloneStrategy CloneStrategy
+	// PushURL, if non-empty, is the URL of the remote repository that is
+	// pushed to in place of the one that is cloned or copied. This permits a
+	// nearby, read-only mirror of a repository to be read from while changes
+	// are pushed to the canonical repository. The same credentials are used
+	// for both, so with HTTP(S), both must be served by hosts that accept
+	// them.
+	PushURL string
+	// CloneFilter is the filter spec (see git rev-list --filter) used when
+	// CloneStrategy is CloneStrategyPartial. If not specified,
+	// DefaultCloneFilter is used.
+	CloneFilter string
+	// UserAgent, if non-empty, is sent as the User-Agent header of every HTTP(S)
+	// request to the remote repository in place of git's own.
+	UserAgent string
+	// HTTPHeaders are additional headers, indexed by name, that are sent with
+	// every HTTP(S) request to the remote repository. This permits proxies and
+	// audit systems to attribute traffic. Their values are redacted from logged
+	// commands.
+	HTTPHeaders map[string]string
+	// SSHAgent specifies that SSH private keys should be held in memory by an
+	// SSH agent that runs within the current process, for as long as the
+	// repository is in use, instead of being written to its home directory.
+	// git is directed to the agent using SSH_AUTH_SOCK, so the keys are never
+	// written to disk.
+	SSHAgent bool
+}
+
+// homeDir returns the path to use as a repository's home directory, creating
+// it if necessary.
+func (o *RepoOptions) homeDir() (string, error) {
+	if o.HomeDir == "" {
+		return os.MkdirTemp("", tmpPrefix)
+	}
+	return o.HomeDir, os.MkdirAll(o.HomeDir, 0700)
 }
 
 // repo is an implementation of the Repo interface for interacting with a git
 // repository.
 type repo struct {
 	url           string
+	pushURL       string
 	homeDir       string
 	dir           string
 	currentBranch string
 	creds         RepoCredentials
+	opts          RepoOptions
+	// homeLock is the open lock file of the home directory. See lockHomeDir.
+	homeLock *os.File
+	// readAgent and writeAgent are the SSH agents holding the keys for reading
+	// from and writing to the remote repository, if RepoOptions.SSHAgent was
+	// specified and SSH keys are in use.
+	readAgent  *sshAgent
+	writeAgent *sshAgent
 }
 
 // Clone produces a local clone of the remote git repository at the specified
@@ -117,10 +534,15 @@ type repo struct {
 // perform any setup that is required for successfully authenticating to the
 // remote repository.
 func Clone(
+	ctx context.Context,
 	cloneURL string,
 	repoCreds RepoCredentials,
+	opts *RepoOptions,
 ) (Repo, error) {
-	homeDir, err := os.MkdirTemp("", tmpPrefix)
+	if opts == nil {
+		opts = &RepoOptions{}
+	}
+	homeDir, err := opts.homeDir()
 	if err != nil {
 		return nil, fmt.Errorf(
 			"error creating home directory for repo %q: %w",
@@ -133,17 +555,119 @@ func Clone(
 		homeDir: homeDir,
 		dir:     filepath.Join(homeDir, "repo"),
 		creds:   repoCreds,
+		opts:    *opts,
 	}
-	if err = r.setupAuth(repoCreds); err != nil {
-		return nil, err
+	if err = r.lockHomeDir(); err != nil {
+		return nil, r.abandon(err)
+	}
+	if err = r.setupAuth(ctx, repoCreds); err != nil {
+		return nil, r.abandon(err)
+	}
+	reusable, err := r.isReusable(ctx)
+	if err != nil {
+		return nil, r.abandon(err)
+	}
+	if reusable {
+		err = r.refresh(ctx)
+	} else {
+		err = r.clone(ctx)
+	}
+	if err != nil {
+		return r, err
+	}
+	return r, r.setPushURL(ctx)
+}
+
+// Mirror creates a bare mirror of the branches of the remote git repository at
+// the specified path or, if a mirror already exists there, updates it. The
+// mirror is suitable for use as RepoOptions.ReferenceDir to speed up
+// subsequent clones of the same repository.
+func Mirror(
+	ctx context.Context,
+	cloneURL string,
+	repoCreds RepoCredentials,
+	dir string,
+	opts *RepoOptions,
+) error {
+	if opts == nil {
+		opts = &RepoOptions{}
+	}
+	homeDir, err := os.MkdirTemp("", tmpPrefix)
+	if err != nil {
+		return fmt.Errorf(
+			"error creating home directory for mirror of repo %q: %w",
+			cloneURL,
+			err,
+		)
+	}
+	r := &repo{
+		url:     cloneURL,
+		homeDir: homeDir,
+		dir:     dir,
+		creds:   repoCreds,
+		opts:    *opts,
+	}
+	defer r.Close()
+	if err = r.lockHomeDir(); err != nil {
+		return err
+	}
+	if err = r.setupAuth(ctx, repoCreds); err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); err == nil {
+		if _, err = r.run(ctx, r.buildCommand(
+			"fetch",
+			"--prune",
+			"--no-tags",
+			RemoteOrigin,
+			"+refs/heads/*:refs/heads/*",
+		)); err != nil {
+			return fmt.Errorf("error updating mirror of repo %q: %w", cloneURL, err)
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error checking for mirror of repo %q: %w", cloneURL, err)
+	}
+	// Clone into a temporary location first so that a failed clone never leaves
+	// a broken mirror behind
+	tmpDir := filepath.Join(homeDir, "mirror")
+	cmd := r.buildCommand("clone", "--bare", "--no-tags", r.url, tmpDir)
+	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+	if _, err = r.run(ctx, cmd); err != nil {
+		return fmt.Errorf("error mirroring repo %q: %w", cloneURL, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return fmt.Errorf("error creating parent directory of %q: %w", dir, err)
 	}
-	return r, r.clone()
+	if err = os.Rename(tmpDir, dir); err != nil {
+		return fmt.Errorf("error moving mirror of repo %q to %q: %w", cloneURL, dir, err)
+	}
+	return nil
 }
 
 // CopyRepo copies a git repository from the specified path to a temporary
 // location. Repository credentials are required in order to authenticate to the
 // remote repository, if any.
-func CopyRepo(path string, repoCreds RepoCredentials) (Repo, error) {
+//
+// Rather than copying the repository in its entirety, the copy is a clone that
+// borrows the original's objects (see git clone --shared), so copying is fast
+// and consumes little disk space regardless of the repository's size. The
+// original is never modified. The copy has the same remote, branches,
+// remote-tracking branches, and tags as the original and has the same commit
+// checked out, but only committed content is copied, so the working tree of
+// the original must be clean. Because the copy depends on the original's
+// objects, the original must not be pruned of them (e.g. by git gc) while the
+// copy is in use.
+func CopyRepo(
+	ctx context.Context,
+	path string,
+	repoCreds RepoCredentials,
+	opts *RepoOptions,
+) (Repo, error) {
+	if opts == nil {
+		opts = &RepoOptions{}
+	}
+
 	// Validate path is absolute
 	if !filepath.IsAbs(path) {
 		return nil, fmt.Errorf("path %s is not absolute", path)
@@ -156,33 +680,103 @@ func CopyRepo(path string, repoCreds RepoCredentials) (Repo, error) {
 		return nil, fmt.Errorf("path %s is not a directory", path)
 	}
 
+	r := &repo{opts: *opts}
+
 	// Validate path is a git repository
 	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
 	cmd.Dir = path
-	if _, err := libExec.Exec(cmd); err != nil {
+	if _, err := r.run(ctx, cmd); err != nil {
 		return nil, fmt.Errorf("path %s is not a git repository: %w", path, err)
 	}
 
-	homeDir, err := os.MkdirTemp("", tmpPrefix)
+	// Uncommitted changes would not be copied, so refuse to proceed if there
+	// are any
+	cmd = exec.Command("git", "status", "--porcelain")
+	cmd.Dir = path
+	statusBytes, err := r.run(ctx, cmd)
 	if err != nil {
+		return nil, fmt.Errorf("error checking status of repo at %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(statusBytes)) > 0 {
 		return nil, fmt.Errorf(
-			"error creating directory for copy of repo at %s: %w",
+			"working tree of repo at %s is dirty; refusing to proceed",
+			path,
+		)
+	}
+
+	cmd = exec.Command("git", "remote")
+	cmd.Dir = path
+	remoteBytes, err := r.run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error listing remotes of repo at %s: %w", path, err)
+	}
+	sourceRemotes := strings.Fields(string(remoteBytes))
+	if len(sourceRemotes) != 1 {
+		return nil, fmt.Errorf(
+			"expected exactly one remote in source repository; found %d",
+			len(sourceRemotes),
+		)
+	}
+	remote := sourceRemotes[0]
+	cmd = exec.Command("git", "remote", "get-url", remote)
+	cmd.Dir = path
+	urlBytes, err := r.run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error obtaining URL for remote %q of repo at %s: %w",
+			remote,
 			path,
 			err,
 		)
 	}
 
-	r := &repo{
-		homeDir: homeDir,
-		dir:     filepath.Join(homeDir, "repo"),
+	// HEAD is either a symbolic ref to a branch or, if detached, a commit
+	headRef := "HEAD"
+	cmd = exec.Command("git", "symbolic-ref", "-q", "HEAD")
+	cmd.Dir = path
+	if headBytes, err := r.run(ctx, cmd); err == nil {
+		headRef = strings.TrimSpace(string(headBytes))
+	}
+	// The commit is empty if HEAD is a branch with no commits yet
+	var headCommit string
+	cmd = exec.Command("git", "rev-parse", "-q", "--verify", "HEAD")
+	cmd.Dir = path
+	if commitBytes, err := r.run(ctx, cmd); err == nil {
+		headCommit = strings.TrimSpace(string(commitBytes))
+	} else if headRef == "HEAD" {
+		return nil, fmt.Errorf("error getting last commit ID of repo at %s: %w", path, err)
+	}
+
+	homeDir, err := opts.homeDir()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error creating directory for copy of repo at %s: %w",
+			path,
+			err,
+		)
+	}
+	r.homeDir = homeDir
+	r.dir = filepath.Join(homeDir, "repo")
+	if err = r.lockHomeDir(); err != nil {
+		return nil, err
+	}
+	// Copying is cheap, so any copy left behind by an earlier attempt is
+	// simply replaced
+	if err = os.RemoveAll(r.dir); err != nil {
+		return nil, fmt.Errorf("error removing earlier copy of repo: %w", err)
 	}
 
-	// Copy from path to r.dir. Note: This obviously only works on *nix systems,
-	// but we already advise that Kargo Render not be run outside of a Linux
-	// container since its dependent on compatible versions of git, helm, and
-	// kustomize binaries.
-	// nolint: gosec
-	if _, err = libExec.Exec(exec.Command("cp", "-r", path, r.dir)); err != nil {
+	cmd = r.buildCommand(
+		"clone",
+		"--shared",
+		"--no-checkout",
+		"--origin",
+		remote,
+		path,
+		r.dir,
+	)
+	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+	if _, err = r.run(ctx, cmd); err != nil {
 		return nil, fmt.Errorf(
 			"error copying repo from %s to %s: %w",
 			path,
@@ -190,8 +784,46 @@ func CopyRepo(path string, repoCreds RepoCredentials) (Repo, error) {
 			err,
 		)
 	}
+	// The clone's branches and remote-tracking branches reflect the original's
+	// branches, so replace them with the original's branches and
+	// remote-tracking branches respectively. No objects are transferred.
+	if _, err = r.run(ctx, r.buildCommand(
+		"fetch",
+		"--prune",
+		"--no-tags",
+		"--update-head-ok",
+		path,
+		"+refs/heads/*:refs/heads/*",
+		fmt.Sprintf("+refs/remotes/%s/*:refs/remotes/%s/*", remote, remote),
+	)); err != nil {
+		return nil, fmt.Errorf("error copying refs from repo at %s: %w", path, err)
+	}
+	if _, err = r.run(ctx, r.buildCommand(
+		"remote",
+		"set-url",
+		remote,
+		strings.TrimSpace(string(urlBytes)),
+	)); err != nil {
+		return nil, fmt.Errorf("error setting URL for remote %q: %w", remote, err)
+	}
+	if headRef == "HEAD" {
+		cmd = r.buildCommand("update-ref", "--no-deref", "HEAD", headCommit)
+	} else {
+		cmd = r.buildCommand("symbolic-ref", "HEAD", headRef)
+	}
+	if _, err = r.run(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("error checking out %q: %w", headRef, err)
+	}
+	if headCommit != "" {
+		if _, err = r.run(
+			ctx,
+			r.buildCommand("reset", "--hard", "-q", headCommit),
+		); err != nil {
+			return nil, fmt.Errorf("error checking out %q: %w", headCommit, err)
+		}
+	}
 
-	remotes, err := r.Remotes()
+	remotes, err := r.Remotes(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -201,45 +833,82 @@ func CopyRepo(path string, repoCreds RepoCredentials) (Repo, error) {
 			len(remotes),
 		)
 	}
-	r.url, err = r.RemoteURL(remotes[0])
+	r.url, err = r.RemoteURL(ctx, remotes[0])
 	if err != nil {
 		return nil, err
 	}
 
-	if err = r.setupAuth(repoCreds); err != nil {
+	if err = r.setupAuth(ctx, repoCreds); err != nil {
 		return nil, err
 	}
 
-	return r, nil
+	return r, r.setPushURL(ctx)
+}
+
+// setPushURL configures the remote repository's push URL, if the repository's
+// options specify one, so that it is pushed to in place of the one that was
+// cloned or copied.
+func (r *repo) setPushURL(ctx context.Context) error {
+	if r.pushURL == "" {
+		return nil
+	}
+	if _, err := r.run(ctx, r.buildCommand(
+		"remote",
+		"set-url",
+		"--push",
+		RemoteOrigin,
+		r.pushURL,
+	)); err != nil {
+		return fmt.Errorf("error setting push URL of remote %q: %w", RemoteOrigin, err)
+	}
+	return nil
 }
 
-func (r *repo) AddAll() error {
-	if _, err := libExec.Exec(r.buildCommand("add", ".")); err != nil {
+func (r *repo) AddAll(ctx context.Context) error {
+	if _, err := r.run(ctx, r.buildCommand("add", ".")); err != nil {
 		return fmt.Errorf("error staging changes for commit: %w", err)
 	}
 	return nil
 }
 
-func (r *repo) AddAllAndCommit(message string) error {
-	if err := r.AddAll(); err != nil {
+func (r *repo) AddAllAndCommit(ctx context.Context, message string) error {
+	if err := r.AddAll(ctx); err != nil {
 		return err
 	}
-	return r.Commit(message, nil)
+	return r.Commit(ctx, message, nil)
 }
 
-func (r *repo) Clean() error {
-	_, err := libExec.Exec(r.buildCommand("clean", "-fd"))
+func (r *repo) Clean(ctx context.Context) error {
+	_, err := r.run(ctx, r.buildCommand("clean", "-fd"))
 	if err != nil {
 		return fmt.Errorf("error cleaning branch %q: %w", r.currentBranch, err)
 	}
 	return nil
 }
 
-func (r *repo) clone() error {
+func (r *repo) clone(ctx context.Context) error {
 	r.currentBranch = "HEAD"
-	cmd := r.buildCommand("clone", "--no-tags", r.url, r.dir)
+	args := []string{"clone", "--no-tags"}
+	if r.opts.ReferenceDir != "" {
+		// Objects are copied out of the reference repository so that the clone
+		// does not break if the reference repository is later updated or removed
+		args = append(args, "--reference-if-able", r.opts.ReferenceDir, "--dissociate")
+	}
+	switch r.opts.CloneStrategy {
+	case CloneStrategyShallow:
+		// Every branch is needed, since the target branch is checked out after
+		// the source commit
+		args = append(args, "--depth", "1", "--no-single-branch")
+	case CloneStrategyPartial:
+		filter := r.opts.CloneFilter
+		if filter == "" {
+			filter = DefaultCloneFilter
+		}
+		args = append(args, "--filter", filter)
+	}
+	cmd := r.buildCommand(append(args, r.url, r.dir)...)
 	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
-	if _, err := libExec.Exec(cmd); err != nil {
+	if _, err := r.run(ctx, cmd); err != nil {
 		return fmt.Errorf(
 			"error cloning repo %q into %q: %w",
 			r.url,
@@ -250,13 +919,125 @@ func (r *repo) clone() error {
 	return nil
 }
 
+// isReusable returns a bool indicating whether the repository's working
+// directory already contains a clone of the same remote repository. Anything
+// else found there is removed so that the remote repository can be cloned
+// afresh.
+func (r *repo) isReusable(ctx context.Context) (bool, error) {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); err != nil {
+		if !os.IsNotExist(err) {
+			return false, fmt.Errorf("error checking for existing clone: %w", err)
+		}
+	} else if url, err := r.RemoteURL(ctx, RemoteOrigin); err == nil &&
+		url == r.url {
+		return true, nil
+	}
+	if err := os.RemoveAll(r.dir); err != nil {
+		return false, fmt.Errorf("error removing %q: %w", r.dir, err)
+	}
+	return false, nil
+}
+
+// refresh restores an existing clone of the remote repository to the state of
+// a fresh clone: the remote repository is fetched, all changes to the working
+// tree and all local branches are discarded, and the remote repository's
+// default branch is checked out.
+func (r *repo) refresh(ctx context.Context) error {
+	r.currentBranch = "HEAD"
+	if _, err := r.run(ctx, r.buildCommand(
+		"fetch",
+		"--prune",
+		"--no-tags",
+		RemoteOrigin,
+	)); err != nil {
+		return fmt.Errorf("error fetching from remote repo %q: %w", r.url, err)
+	}
+	for _, args := range [][]string{
+		{"reset", "--hard"},
+		{"clean", "-ffdx"},
+		{"checkout", "--detach"},
+	} {
+		if _, err := r.run(ctx, r.buildCommand(args...)); err != nil {
+			return fmt.Errorf("error resetting existing clone: %w", err)
+		}
+	}
+	resBytes, err := r.run(ctx, r.buildCommand(
+		"for-each-ref",
+		"--format=%(refname:short)",
+		"refs/heads/",
+	))
+	if err != nil {
+		return fmt.Errorf("error listing local branches: %w", err)
+	}
+	for _, branch := range strings.Fields(string(resBytes)) {
+		if _, err = r.run(ctx, r.buildCommand("branch", "-D", branch)); err != nil {
+			return fmt.Errorf("error deleting local branch %q: %w", branch, err)
+		}
+	}
+	if resBytes, err = r.run(ctx, r.buildCommand(
+		"symbolic-ref",
+		"--short",
+		fmt.Sprintf("refs/remotes/%s/HEAD", RemoteOrigin),
+	)); err != nil {
+		return fmt.Errorf("error determining default branch: %w", err)
+	}
+	defaultBranch := strings.TrimPrefix(
+		strings.TrimSpace(string(resBytes)),
+		RemoteOrigin+"/",
+	)
+	if _, err = r.run(
+		ctx,
+		r.buildCommand("checkout", defaultBranch, "--"),
+	); err != nil {
+		return fmt.Errorf(
+			"error checking out default branch %q: %w",
+			defaultBranch,
+			err,
+		)
+	}
+	return nil
+}
+
 func (r *repo) Close() error {
+	if err := r.Release(); err != nil {
+		return err
+	}
 	return os.RemoveAll(r.homeDir)
 }
 
-func (r *repo) Checkout(branch string) error {
+// abandon cleans up after a repository that could not be returned to the
+// caller, then returns the provided error, which explains why. A home directory
+// that Clone created is removed. One that the caller provided is retained,
+// since it may hold a clone worth reusing, but credentials are removed from it.
+func (r *repo) abandon(err error) error {
+	errs := []error{err, r.Release()}
+	if r.opts.HomeDir == "" {
+		errs = append(errs, os.RemoveAll(r.homeDir))
+	} else if _, sweepErr := sweepHomeDir(r.homeDir); sweepErr != nil {
+		errs = append(errs, sweepErr)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *repo) Release() error {
+	var errs []error
+	for _, a := range []*sshAgent{r.readAgent, r.writeAgent} {
+		if a != nil {
+			errs = append(errs, a.close())
+		}
+	}
+	r.readAgent = nil
+	r.writeAgent = nil
+	if r.homeLock != nil {
+		errs = append(errs, r.homeLock.Close())
+		r.homeLock = nil
+	}
+	return errors.Join(errs...)
+}
+
+func (r *repo) Checkout(ctx context.Context, branch string) error {
 	r.currentBranch = branch
-	if _, err := libExec.Exec(r.buildCommand(
+	if _, err := r.run(ctx, r.buildCommand(
 		"checkout",
 		branch,
 		// The next line makes it crystal clear to git that we're checking out
@@ -276,9 +1057,16 @@ func (r *repo) Checkout(branch string) error {
 
 type CommitOptions struct {
 	AllowEmpty bool
+	// Author optionally overrides the author of the commit. It must be of the
+	// form "Name <email>". The committer is unaffected.
+	Author string
+	// Amend specifies that the commit at the head of the current branch should
+	// be replaced by one that also includes the staged changes, instead of
+	// a new commit being made on top of it.
+	Amend bool
 }
 
-func (r *repo) Commit(message string, opts *CommitOptions) error {
+func (r *repo) Commit(ctx context.Context, message string, opts *CommitOptions) error {
 	if opts == nil {
 		opts = &CommitOptions{}
 	}
@@ -286,7 +1074,13 @@ func (r *repo) Commit(message string, opts *CommitOptions) error {
 	if opts.AllowEmpty {
 		cmdTokens = append(cmdTokens, "--allow-empty")
 	}
-	if _, err := libExec.Exec(r.buildCommand(cmdTokens...)); err != nil {
+	if opts.Author != "" {
+		cmdTokens = append(cmdTokens, "--author", opts.Author)
+	}
+	if opts.Amend {
+		cmdTokens = append(cmdTokens, "--amend")
+	}
+	if _, err := r.run(ctx, r.buildCommand(cmdTokens...)); err != nil {
 		return fmt.Errorf(
 			"error committing changes to branch %q: %w",
 			r.currentBranch,
@@ -296,9 +1090,9 @@ func (r *repo) Commit(message string, opts *CommitOptions) error {
 	return nil
 }
 
-func (r *repo) CreateChildBranch(branch string) error {
+func (r *repo) CreateChildBranch(ctx context.Context, branch string) error {
 	r.currentBranch = branch
-	if _, err := libExec.Exec(r.buildCommand(
+	if _, err := r.run(ctx, r.buildCommand(
 		"checkout",
 		"-b",
 		branch,
@@ -317,26 +1111,42 @@ func (r *repo) CreateChildBranch(branch string) error {
 	return nil
 }
 
-func (r *repo) CreateOrphanedBranch(branch string) error {
+func (r *repo) CreateOrphanedBranch(ctx context.Context, branch string) error {
+	return r.createOrphanedBranch(ctx, branch, canSwitchOrphan())
+}
+
+// createOrphanedBranch creates an orphaned branch using `git switch --orphan`
+// if useSwitch is true. Otherwise, it falls back to `git checkout --orphan`,
+// which, unlike `git switch --orphan`, leaves the index and working tree
+// intact, so they are emptied explicitly.
+func (r *repo) createOrphanedBranch(
+	ctx context.Context,
+	branch string,
+	useSwitch bool,
+) error {
 	r.currentBranch = branch
-	if _, err := libExec.Exec(r.buildCommand(
-		"switch",
-		"--orphan",
-		branch,
-		"--discard-changes",
-	)); err != nil {
-		return fmt.Errorf(
-			"error creating orphaned branch %q for repo %q: %w",
-			branch,
-			r.url,
-			err,
-		)
+	cmds := [][]string{{"switch", "--orphan", branch, "--discard-changes"}}
+	if !useSwitch {
+		cmds = [][]string{
+			{"checkout", "--orphan", branch},
+			{"rm", "-r", "-f", "-q", "--ignore-unmatch", "."},
+		}
+	}
+	for _, args := range cmds {
+		if _, err := r.run(ctx, r.buildCommand(args...)); err != nil {
+			return fmt.Errorf(
+				"error creating orphaned branch %q for repo %q: %w",
+				branch,
+				r.url,
+				err,
+			)
+		}
 	}
-	return r.Clean()
+	return r.Clean(ctx)
 }
 
-func (r *repo) HasDiffs() (bool, error) {
-	resBytes, err := libExec.Exec(r.buildCommand("status", "-s"))
+func (r *repo) HasDiffs(ctx context.Context) (bool, error) {
+	resBytes, err := r.run(ctx, r.buildCommand("status", "-s"))
 	if err != nil {
 		return false,
 			fmt.Errorf("error checking status of branch %q: %w", r.currentBranch, err)
@@ -344,34 +1154,194 @@ func (r *repo) HasDiffs() (bool, error) {
 	return len(resBytes) > 0, nil
 }
 
-func (r *repo) GetDiffPaths() ([]string, error) {
-	resBytes, err := libExec.Exec(r.buildCommand("status", "-s"))
+func (r *repo) Status(ctx context.Context) ([]StatusEntry, error) {
+	resBytes, err := r.run(ctx, r.buildCommand(
+		"status",
+		"--porcelain=v2",
+		"-z",
+		"--untracked-files=all",
+	))
 	if err != nil {
 		return nil,
 			fmt.Errorf("error checking status of branch %q: %w", r.currentBranch, err)
 	}
+	entries, err := parseStatus(resBytes)
+	if err != nil {
+		return nil,
+			fmt.Errorf("error parsing status of branch %q: %w", r.currentBranch, err)
+	}
+	return entries, nil
+}
+
+// parseStatus parses the output of git status --porcelain=v2 -z. Since fields
+// are separated by spaces and only a path, which is always last, may contain
+// spaces, each entry is split into a fixed number of fields that depends on
+// its type. Since entries are NUL terminated and paths are not quoted, paths
+// containing newlines or non-ASCII characters need no special treatment.
+func parseStatus(statusBytes []byte) ([]StatusEntry, error) {
+	records := strings.Split(string(statusBytes), "\x00")
+	entries := []StatusEntry{}
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" || record[0] == '#' {
+			continue // Trailing terminator or header
+		}
+		var fieldCount int
+		var entry StatusEntry
+		switch record[0] {
+		case '1':
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			fieldCount = 9
+			entry.Kind = StatusEntryKindChanged
+		case '2':
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>NUL<origPath>
+			fieldCount = 10
+			if i+1 >= len(records) {
+				return nil, fmt.Errorf("missing original path of entry %q", record)
+			}
+			i++
+			entry.OrigPath = records[i]
+			entry.Kind = StatusEntryKindRenamed
+		case 'u':
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fieldCount = 11
+			entry.Kind = StatusEntryKindUnmerged
+		case '?':
+			fieldCount = 2
+			entry.Kind = StatusEntryKindUntracked
+			entry.Index = '?'
+			entry.WorkTree = '?'
+		case '!':
+			continue // Ignored
+		default:
+			return nil, fmt.Errorf("unrecognized entry %q", record)
+		}
+		fields := strings.SplitN(record, " ", fieldCount)
+		if len(fields) != fieldCount || fields[fieldCount-1] == "" {
+			return nil, fmt.Errorf("malformed entry %q", record)
+		}
+		if entry.Kind != StatusEntryKindUntracked {
+			if len(fields[1]) != 2 {
+				return nil, fmt.Errorf("malformed entry %q", record)
+			}
+			entry.Index = fields[1][0]
+			entry.WorkTree = fields[1][1]
+		}
+		if entry.Kind == StatusEntryKindRenamed && strings.HasPrefix(fields[8], "C") {
+			entry.Kind = StatusEntryKindCopied
+		}
+		entry.Path = fields[fieldCount-1]
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *repo) GetDiffPaths(ctx context.Context) ([]string, error) {
+	entries, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
 	paths := []string{}
-	scanner := bufio.NewScanner(bytes.NewReader(resBytes))
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		paths = append(
-			paths,
-			strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)[1],
+	for _, entry := range entries {
+		if entry.Kind == StatusEntryKindRenamed {
+			paths = append(paths, entry.OrigPath)
+		}
+		paths = append(paths, entry.Path)
+	}
+	return paths, nil
+}
+
+func (r *repo) GetStagedDiff(ctx context.Context) (string, error) {
+	resBytes, err := r.run(
+		ctx,
+		r.buildCommand("diff", "--cached", "--no-renames", "--no-color"),
+	)
+	if err != nil {
+		return "",
+			fmt.Errorf("error diffing staged changes in branch %q: %w", r.currentBranch, err)
+	}
+	return string(resBytes), nil
+}
+
+func (r *repo) ExportTree(ctx context.Context, ref string, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %q: %w", dir, err)
+	}
+	// Restoring only the working tree, and substituting a different working
+	// tree, leaves everything about the repository itself untouched.
+	if _, err := r.run(ctx, r.buildCommand(
+		"--work-tree", dir,
+		"restore",
+		"--source", ref,
+		"--worktree",
+		"--",
+		":/",
+	)); err != nil {
+		return fmt.Errorf(
+			"error exporting tree of %q from repo %q: %w",
+			ref,
+			r.url,
+			err,
 		)
 	}
+	return nil
+}
+
+func (r *repo) GetStagedDiffPaths(ctx context.Context) ([]string, error) {
+	resBytes, err := r.run(
+		ctx,
+		r.buildCommand("diff", "--cached", "--no-renames", "--name-only", "-z"),
+	)
+	if err != nil {
+		return nil,
+			fmt.Errorf("error diffing staged changes in branch %q: %w", r.currentBranch, err)
+	}
+	paths := []string{}
+	// Paths are NUL terminated and, unlike newline terminated ones, never
+	// quoted
+	for _, path := range strings.Split(string(resBytes), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
 	return paths, nil
 }
 
-func (r *repo) LastCommitID() (string, error) {
-	shaBytes, err := libExec.Exec(r.buildCommand("rev-parse", "HEAD"))
+func (r *repo) IsAncestor(
+	ctx context.Context,
+	ancestor string,
+	descendant string,
+) (bool, error) {
+	if _, err := r.run(ctx, r.buildCommand(
+		"merge-base",
+		"--is-ancestor",
+		ancestor,
+		descendant,
+	)); err != nil {
+		if exitErr, ok := err.(*libExec.ExitError); ok && exitErr.ExitCode == 1 {
+			// Not an ancestor
+			return false, nil
+		}
+		return false, fmt.Errorf(
+			"error checking whether commit %q is an ancestor of commit %q: %w",
+			ancestor,
+			descendant,
+			err,
+		)
+	}
+	return true, nil
+}
+
+func (r *repo) LastCommitID(ctx context.Context) (string, error) {
+	shaBytes, err := r.run(ctx, r.buildCommand("rev-parse", "HEAD"))
 	if err != nil {
 		return "", fmt.Errorf("error obtaining ID of last commit: %w", err)
 	}
 	return strings.TrimSpace(string(shaBytes)), nil
 }
 
-func (r *repo) LocalBranchExists(branch string) (bool, error) {
-	resBytes, err := libExec.Exec(r.buildCommand(
+func (r *repo) LocalBranchExists(ctx context.Context, branch string) (bool, error) {
+	resBytes, err := r.run(ctx, r.buildCommand(
 		"branch",
 		"--list",
 		branch,
@@ -385,8 +1355,9 @@ func (r *repo) LocalBranchExists(branch string) (bool, error) {
 	) == branch, nil
 }
 
-func (r *repo) CommitMessage(id string) (string, error) {
-	msgBytes, err := libExec.Exec(
+func (r *repo) CommitMessage(ctx context.Context, id string) (string, error) {
+	msgBytes, err := r.run(
+		ctx,
 		r.buildCommand("log", "-n", "1", "--pretty=format:%s", id),
 	)
 	if err != nil {
@@ -396,11 +1367,144 @@ func (r *repo) CommitMessage(id string) (string, error) {
 	return string(msgBytes), nil
 }
 
-func (r *repo) CommitMessages(id1, id2 string) ([]string, error) {
-	allMsgBytes, err := libExec.Exec(r.buildCommand(
-		"log",
-		"--pretty=oneline",
-		"--decorate-refs=",
+func (r *repo) FullCommitMessage(ctx context.Context, id string) (string, error) {
+	msgBytes, err := r.run(
+		ctx,
+		r.buildCommand("log", "-n", "1", "--pretty=format:%B", id),
+	)
+	if err != nil {
+		return "",
+			fmt.Errorf("error obtaining commit message for commit %q: %w", id, err)
+	}
+	return strings.TrimSpace(string(msgBytes)), nil
+}
+
+// CommitSignature describes the signature on a commit, as verified against a
+// set of trusted public keys.
+type CommitSignature struct {
+	// Status is git's one-character summary of the signature, as described for
+	// the %G? placeholder in git-log(1). Notably, G indicates a good signature
+	// made by a trusted key, U a good signature made by a key that isn't
+	// trusted, E a signature that could not be checked, and N no signature.
+	Status string
+	// Key is the ID or fingerprint of the key that made the signature, if any.
+	Key string
+	// Signer is the identity associated with the key that made the signature,
+	// if known.
+	Signer string
+}
+
+// Verified returns true if the commit bears a good signature made by one of
+// the trusted keys.
+func (c CommitSignature) Verified() bool {
+	return c.Status == "G"
+}
+
+func (r *repo) CommitSignature(
+	ctx context.Context,
+	id string,
+	trustedKeys []string,
+) (CommitSignature, error) {
+	var sig CommitSignature
+	// OpenPGP keys are imported into a keyring, and SSH keys are written to an
+	// allowed signers file, both of which are discarded after verification so
+	// that nothing but the provided keys is ever trusted.
+	verifyDir, err := os.MkdirTemp(r.homeDir, "verify-")
+	if err != nil {
+		return sig, fmt.Errorf("error creating verification directory: %w", err)
+	}
+	defer os.RemoveAll(verifyDir)
+	gnupgHome := filepath.Join(verifyDir, "gnupg")
+	if err = os.Mkdir(gnupgHome, 0700); err != nil {
+		return sig, fmt.Errorf("error creating %q: %w", gnupgHome, err)
+	}
+	// Every key in the keyring was explicitly provided, so all are trusted
+	if err = os.WriteFile(
+		filepath.Join(gnupgHome, "gpg.conf"),
+		[]byte("trust-model always\n"),
+		0600,
+	); err != nil {
+		return sig, fmt.Errorf("error writing GnuPG configuration: %w", err)
+	}
+	gnupgHomeEnvVar := fmt.Sprintf("GNUPGHOME=%s", gnupgHome)
+	allowedSigners := &strings.Builder{}
+	for _, key := range trustedKeys {
+		key = strings.TrimSpace(key)
+		if strings.HasPrefix(key, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+			cmd := exec.Command("gpg", "--batch", "--import")
+			cmd.Env = []string{gnupgHomeEnvVar}
+			cmd.Stdin = strings.NewReader(key)
+			if _, err = r.run(ctx, cmd); err != nil {
+				return sig, fmt.Errorf("error importing OpenPGP public key: %w", err)
+			}
+			continue
+		}
+		// Signers' principals are irrelevant to verifying commits
+		fmt.Fprintf(allowedSigners, "* %s\n", key)
+	}
+	allowedSignersPath := filepath.Join(verifyDir, "allowed_signers")
+	if err = os.WriteFile(
+		allowedSignersPath,
+		[]byte(allowedSigners.String()),
+		0600,
+	); err != nil {
+		return sig, fmt.Errorf("error writing SSH allowed signers: %w", err)
+	}
+	cmd := r.buildCommand(
+		"-c", fmt.Sprintf("gpg.ssh.allowedSignersFile=%s", allowedSignersPath),
+		"log", "-n", "1", "--pretty=format:%G?%n%GK%n%GS", id,
+	)
+	cmd.Env = append(cmd.Env, gnupgHomeEnvVar)
+	resBytes, err := r.run(ctx, cmd)
+	if err != nil {
+		return sig,
+			fmt.Errorf("error obtaining signature of commit %q: %w", id, err)
+	}
+	fields := strings.SplitN(string(resBytes), "\n", 3)
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	sig.Status = strings.TrimSpace(fields[0])
+	sig.Key = strings.TrimSpace(fields[1])
+	sig.Signer = strings.TrimSpace(fields[2])
+	return sig, nil
+}
+
+func (r *repo) ReadFileAtCommit(
+	ctx context.Context,
+	id string,
+	path string,
+) ([]byte, error) {
+	lsBytes, err := r.run(
+		ctx,
+		r.buildCommand("ls-tree", "--name-only", id, "--", path),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %q in commit %q: %w", path, id, err)
+	}
+	if strings.TrimSpace(string(lsBytes)) == "" {
+		return nil, fmt.Errorf(
+			"error reading %q in commit %q: %w",
+			path,
+			id,
+			fs.ErrNotExist,
+		)
+	}
+	contentBytes, err := r.run(
+		ctx,
+		r.buildCommand("show", fmt.Sprintf("%s:%s", id, path)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q in commit %q: %w", path, id, err)
+	}
+	return contentBytes, nil
+}
+
+func (r *repo) CommitMessages(ctx context.Context, id1, id2 string) ([]string, error) {
+	allMsgBytes, err := r.run(ctx, r.buildCommand(
+		"log",
+		"--pretty=oneline",
+		"--decorate-refs=",
 		"--decorate-refs-exclude=",
 		fmt.Sprintf("%s..%s", id1, id2),
 	))
@@ -426,16 +1530,111 @@ func (r *repo) CommitMessages(id1, id2 string) ([]string, error) {
 	return msgs, nil
 }
 
-func (r *repo) Fetch() error {
-	if _, err := libExec.Exec(r.buildCommand("fetch", RemoteOrigin)); err != nil {
+func (r *repo) CommitChanges(ctx context.Context, id string) ([]FileChange, error) {
+	resBytes, err := r.run(ctx, r.buildCommand(
+		"diff-tree",
+		"--no-commit-id",
+		"--no-renames",
+		"--root",
+		"-r",
+		"--name-status",
+		"-z",
+		id,
+	))
+	if err != nil {
+		return nil,
+			fmt.Errorf("error obtaining changes made by commit %q: %w", id, err)
+	}
+	// Output alternates between statuses and paths, each terminated by a NUL
+	fields := strings.Split(strings.TrimSuffix(string(resBytes), "\x00"), "\x00")
+	changes := []FileChange{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(
+			changes,
+			FileChange{
+				Path:    fields[i+1],
+				Deleted: fields[i] == "D",
+			},
+		)
+	}
+	return changes, nil
+}
+
+func (r *repo) ParentCommitID(ctx context.Context, id string) (string, error) {
+	resBytes, err := r.run(ctx, r.buildCommand(
+		"rev-list",
+		"--parents",
+		"-n", "1",
+		id,
+	))
+	if err != nil {
+		return "",
+			fmt.Errorf("error obtaining parent of commit %q: %w", id, err)
+	}
+	// The output is the commit's ID followed by the IDs of its parents
+	ids := strings.Fields(string(resBytes))
+	if len(ids) < 2 {
+		return "", nil
+	}
+	return ids[1], nil
+}
+
+func (r *repo) UnpushedCommitIDs(ctx context.Context) ([]string, error) {
+	resBytes, err := r.run(ctx, r.buildCommand(
+		"rev-list",
+		"--reverse",
+		"HEAD",
+		"--not",
+		fmt.Sprintf("--remotes=%s", RemoteOrigin),
+	))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error obtaining unpushed commits to branch %q: %w",
+			r.currentBranch,
+			err,
+		)
+	}
+	return strings.Fields(string(resBytes)), nil
+}
+
+func (r *repo) Fetch(ctx context.Context) error {
+	if _, err := r.run(ctx, r.buildCommand("fetch", RemoteOrigin)); err != nil {
 		return fmt.Errorf("error fetching from remote repo %q: %w", r.url, err)
 	}
 	return nil
 }
 
-func (r *repo) Pull(branch string) error {
+func (r *repo) FetchRef(ctx context.Context, ref string) (bool, error) {
+	if _, err := r.run(ctx, r.buildCommand(
+		"ls-remote",
+		"--exit-code", // Return 2 if not found
+		RemoteOrigin,
+		ref,
+	)); err != nil {
+		if exitErr, ok := err.(*libExec.ExitError); ok && exitErr.ExitCode == 2 {
+			return false, nil
+		}
+		return false, fmt.Errorf(
+			"error checking for existence of ref %q in remote repo %q: %w",
+			ref,
+			r.url,
+			err,
+		)
+	}
+	if _, err := r.run(ctx, r.buildCommand(
+		"fetch",
+		RemoteOrigin,
+		fmt.Sprintf("+%s:%s", ref, ref),
+	)); err != nil {
+		return false,
+			fmt.Errorf("error fetching ref %q from remote repo %q: %w", ref, r.url, err)
+	}
+	return true, nil
+}
+
+func (r *repo) Pull(ctx context.Context, branch string) error {
 	if _, err :=
-		libExec.Exec(r.buildCommand("pull", RemoteOrigin, branch)); err != nil {
+		r.run(ctx, r.buildCommand("pull", RemoteOrigin, branch)); err != nil {
 		return fmt.Errorf(
 			"error pulling branch %q from remote repo %q: %w",
 			branch,
@@ -446,16 +1645,337 @@ func (r *repo) Pull(branch string) error {
 	return nil
 }
 
-func (r *repo) Push() error {
-	if _, err :=
-		libExec.Exec(r.buildCommand("push", RemoteOrigin, r.currentBranch)); err != nil {
+func (r *repo) Merge(
+	ctx context.Context,
+	rev string,
+	message string,
+) (MergeResult, error) {
+	if _, err := r.run(
+		ctx,
+		r.buildCommand("merge", "--no-edit", "-m", message, rev),
+	); err != nil {
+		conflicts, conflictsErr := r.conflicts(ctx)
+		if conflictsErr != nil {
+			return MergeResult{}, conflictsErr
+		}
+		if len(conflicts) == 0 {
+			return MergeResult{}, fmt.Errorf(
+				"error merging %q into branch %q: %w",
+				rev,
+				r.currentBranch,
+				err,
+			)
+		}
+		if _, err = r.run(ctx, r.buildCommand("merge", "--abort")); err != nil {
+			return MergeResult{}, fmt.Errorf("error aborting merge: %w", err)
+		}
+		return MergeResult{Conflicts: conflicts}, nil
+	}
+	commitID, err := r.LastCommitID(ctx)
+	return MergeResult{CommitID: commitID}, err
+}
+
+func (r *repo) Rebase(ctx context.Context, upstream string) (MergeResult, error) {
+	if _, err := r.run(ctx, r.buildCommand("rebase", upstream)); err != nil {
+		conflicts, conflictsErr := r.conflicts(ctx)
+		if conflictsErr != nil {
+			return MergeResult{}, conflictsErr
+		}
+		if len(conflicts) == 0 {
+			// A rebase that failed before it began, e.g. because the working tree
+			// has uncommitted changes, leaves nothing to abort, so any error doing
+			// so is of no interest
+			_, _ = r.run(ctx, r.buildCommand("rebase", "--abort"))
+			return MergeResult{}, fmt.Errorf(
+				"error rebasing branch %q onto %q: %w",
+				r.currentBranch,
+				upstream,
+				err,
+			)
+		}
+		res := MergeResult{Conflicts: conflicts}
+		if idBytes, idErr := r.run(
+			ctx,
+			r.buildCommand("rev-parse", "REBASE_HEAD"),
+		); idErr == nil {
+			res.ConflictingCommitID = strings.TrimSpace(string(idBytes))
+		}
+		if _, err = r.run(ctx, r.buildCommand("rebase", "--abort")); err != nil {
+			return MergeResult{}, fmt.Errorf("error aborting rebase: %w", err)
+		}
+		return res, nil
+	}
+	commitID, err := r.LastCommitID(ctx)
+	return MergeResult{CommitID: commitID}, err
+}
+
+// conflicts returns, in order by path, every path in the index with
+// conflicting changes, as left by a merge or rebase that stopped because of
+// them.
+func (r *repo) conflicts(ctx context.Context) ([]Conflict, error) {
+	resBytes, err := r.run(ctx, r.buildCommand("ls-files", "--unmerged", "-z"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing conflicting paths: %w", err)
+	}
+	// Each entry is of the form "<mode> <object> <stage>\t<path>", where stage
+	// 1 is the common ancestor, 2 is our side, and 3 is their side
+	stages := map[string][4]bool{}
+	for _, entry := range strings.Split(string(resBytes), "\x00") {
+		info, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(info)
+		if len(fields) != 3 {
+			continue
+		}
+		stage, err := strconv.Atoi(fields[2])
+		if err != nil || stage < 1 || stage > 3 {
+			continue
+		}
+		pathStages := stages[path]
+		pathStages[stage] = true
+		stages[path] = pathStages
+	}
+	conflicts := make([]Conflict, 0, len(stages))
+	for path, pathStages := range stages {
+		conflicts = append(conflicts, Conflict{
+			Path: path,
+			Kind: conflictKind(pathStages[1], pathStages[2], pathStages[3]),
+		})
+	}
+	slices.SortFunc(conflicts, func(a, b Conflict) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return conflicts, nil
+}
+
+// conflictKind returns the kind of a conflict from whether the conflicting
+// path exists in the common ancestor, on our side, and on their side.
+func conflictKind(base, ours, theirs bool) ConflictKind {
+	switch {
+	case ours && theirs && base:
+		return ConflictKindBothModified
+	case ours && theirs:
+		return ConflictKindBothAdded
+	case ours && base:
+		return ConflictKindDeletedByThem
+	case theirs && base:
+		return ConflictKindDeletedByUs
+	case ours:
+		return ConflictKindAddedByUs
+	case theirs:
+		return ConflictKindAddedByThem
+	default:
+		return ConflictKindBothDeleted
+	}
+}
+
+func (r *repo) Push(ctx context.Context) error {
+	cmd, err := r.buildPushCommand(RemoteOrigin, r.currentBranch)
+	if err != nil {
+		return err
+	}
+	if _, err = r.run(ctx, cmd); err != nil {
+		var exitErr *libExec.ExitError
+		if errors.As(err, &exitErr) &&
+			bytes.Contains(exitErr.Output, []byte("[remote rejected]")) {
+			return fmt.Errorf(
+				"error pushing branch %q: %w: %w",
+				r.currentBranch,
+				ErrPushRejected,
+				err,
+			)
+		}
 		return fmt.Errorf("error pushing branch %q: %w", r.currentBranch, err)
 	}
 	return nil
 }
 
-func (r *repo) RemoteBranchExists(branch string) (bool, error) {
-	if _, err := libExec.Exec(r.buildCommand(
+func (r *repo) ForcePush(ctx context.Context, expectedID string) error {
+	cmd, err := r.buildPushCommand(
+		fmt.Sprintf(
+			"--force-with-lease=refs/heads/%s:%s",
+			r.currentBranch,
+			expectedID,
+		),
+		RemoteOrigin,
+		r.currentBranch,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err = r.run(ctx, cmd); err != nil {
+		var exitErr *libExec.ExitError
+		if errors.As(err, &exitErr) &&
+			bytes.Contains(exitErr.Output, []byte("[remote rejected]")) {
+			return fmt.Errorf(
+				"error force pushing branch %q: %w: %w",
+				r.currentBranch,
+				ErrPushRejected,
+				err,
+			)
+		}
+		return fmt.Errorf("error force pushing branch %q: %w", r.currentBranch, err)
+	}
+	return nil
+}
+
+func (r *repo) PushDryRun(ctx context.Context) error {
+	cmd, err := r.buildPushCommand("--dry-run", RemoteOrigin, r.currentBranch)
+	if err != nil {
+		return err
+	}
+	if _, err = r.run(ctx, cmd); err != nil {
+		return fmt.Errorf("error pushing branch %q (dry run): %w", r.currentBranch, err)
+	}
+	return nil
+}
+
+func (r *repo) PushRef(ctx context.Context, src string, dst string) error {
+	cmd, err := r.buildPushCommand(RemoteOrigin, fmt.Sprintf("%s:%s", src, dst))
+	if err != nil {
+		return err
+	}
+	if _, err = r.run(ctx, cmd); err != nil {
+		var exitErr *libExec.ExitError
+		if errors.As(err, &exitErr) &&
+			bytes.Contains(exitErr.Output, []byte("[remote rejected]")) {
+			return fmt.Errorf("error pushing ref %q: %w: %w", dst, ErrPushRejected, err)
+		}
+		return fmt.Errorf("error pushing ref %q: %w", dst, err)
+	}
+	return nil
+}
+
+func (r *repo) ReadNote(
+	ctx context.Context,
+	notesRef string,
+	id string,
+) ([]byte, error) {
+	// git cannot look for a note in a notes ref that does not exist
+	idBytes, err := r.run(ctx, r.buildCommand(
+		"for-each-ref",
+		"--format=%(objectname)",
+		notesRef,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving notes ref %q: %w", notesRef, err)
+	}
+	if strings.TrimSpace(string(idBytes)) == "" {
+		return nil, fmt.Errorf(
+			"error reading note on commit %q in %q: %w",
+			id,
+			notesRef,
+			fs.ErrNotExist,
+		)
+	}
+	noteBytes, err := r.run(
+		ctx,
+		r.buildCommand("notes", "--ref", notesRef, "list", id),
+	)
+	if err != nil {
+		var exitErr *libExec.ExitError
+		if errors.As(err, &exitErr) &&
+			bytes.Contains(exitErr.Output, []byte("no note found")) {
+			return nil, fmt.Errorf(
+				"error reading note on commit %q in %q: %w",
+				id,
+				notesRef,
+				fs.ErrNotExist,
+			)
+		}
+		return nil,
+			fmt.Errorf("error reading note on commit %q in %q: %w", id, notesRef, err)
+	}
+	contentBytes, err := r.run(
+		ctx,
+		r.buildCommand("cat-file", "blob", strings.TrimSpace(string(noteBytes))),
+	)
+	if err != nil {
+		return nil,
+			fmt.Errorf("error reading note on commit %q in %q: %w", id, notesRef, err)
+	}
+	return contentBytes, nil
+}
+
+func (r *repo) WriteNote(
+	ctx context.Context,
+	notesRef string,
+	id string,
+	content []byte,
+) error {
+	cmd := r.buildCommand("notes", "--ref", notesRef, "add", "-f", "-F", "-", id)
+	cmd.Stdin = bytes.NewReader(content)
+	if _, err := r.run(ctx, cmd); err != nil {
+		return fmt.Errorf("error writing note on commit %q in %q: %w", id, notesRef, err)
+	}
+	return nil
+}
+
+func (r *repo) CommitFile(
+	ctx context.Context,
+	parent string,
+	path string,
+	content []byte,
+	message string,
+) (string, error) {
+	// A temporary index is used so that the real one is left untouched
+	indexFile, err := os.CreateTemp(r.homeDir, "index-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary index: %w", err)
+	}
+	indexPath := indexFile.Name()
+	_ = indexFile.Close()
+	// git refuses to read an empty file as an index
+	_ = os.Remove(indexPath)
+	defer os.Remove(indexPath)
+	run := func(stdin []byte, arg ...string) (string, error) {
+		cmd := r.buildCommand(arg...)
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+indexPath)
+		if stdin != nil {
+			cmd.Stdin = bytes.NewReader(stdin)
+		}
+		out, err := r.run(ctx, cmd)
+		return strings.TrimSpace(string(out)), err
+	}
+	readTreeArgs := []string{"read-tree", "--empty"}
+	if parent != "" {
+		readTreeArgs = []string{"read-tree", parent}
+	}
+	if _, err = run(nil, readTreeArgs...); err != nil {
+		return "", fmt.Errorf("error reading tree of commit %q: %w", parent, err)
+	}
+	blobID, err := run(content, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", fmt.Errorf("error writing content of %q: %w", path, err)
+	}
+	if _, err = run(
+		nil,
+		"update-index",
+		"--add",
+		"--cacheinfo",
+		fmt.Sprintf("100644,%s,%s", blobID, path),
+	); err != nil {
+		return "", fmt.Errorf("error adding %q to tree: %w", path, err)
+	}
+	treeID, err := run(nil, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("error writing tree: %w", err)
+	}
+	commitArgs := []string{"commit-tree", treeID, "-m", message}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	id, err := run(nil, commitArgs...)
+	if err != nil {
+		return "", fmt.Errorf("error committing %q: %w", path, err)
+	}
+	return id, nil
+}
+
+func (r *repo) RemoteBranchExists(ctx context.Context, branch string) (bool, error) {
+	if _, err := r.run(ctx, r.buildCommand(
 		"ls-remote",
 		"--heads",
 		"--exit-code", // Return 2 if not found
@@ -476,16 +1996,16 @@ func (r *repo) RemoteBranchExists(branch string) (bool, error) {
 	return true, nil
 }
 
-func (r *repo) Remotes() ([]string, error) {
-	resBytes, err := libExec.Exec(r.buildCommand("remote"))
+func (r *repo) Remotes(ctx context.Context) ([]string, error) {
+	resBytes, err := r.run(ctx, r.buildCommand("remote"))
 	if err != nil {
 		return nil, fmt.Errorf("error listing remotes for repo %q: %w", r.url, err)
 	}
 	return strings.Fields(string(resBytes)), nil
 }
 
-func (r *repo) RemoteURL(name string) (string, error) {
-	resBytes, err := libExec.Exec(r.buildCommand("remote", "get-url", name))
+func (r *repo) RemoteURL(ctx context.Context, name string) (string, error) {
+	resBytes, err := r.run(ctx, r.buildCommand("remote", "get-url", name))
 	if err != nil {
 		return "", fmt.Errorf(
 			"error obtaining URL for remote %q of repo %q: %w",
@@ -497,14 +2017,59 @@ func (r *repo) RemoteURL(name string) (string, error) {
 	return strings.TrimSpace(string(resBytes)), nil
 }
 
-func (r *repo) ResetHard() error {
+func (r *repo) ResetHard(ctx context.Context) error {
 	if _, err :=
-		libExec.Exec(r.buildCommand("reset", "--hard")); err != nil {
+		r.run(ctx, r.buildCommand("reset", "--hard")); err != nil {
 		return fmt.Errorf("error resetting branch working tree: %w", err)
 	}
 	return nil
 }
 
+func (r *repo) StagePaths(ctx context.Context, paths []string) error {
+	// A branch with no commits yet has no HEAD to reset the index to, so the
+	// index is emptied instead
+	unstageCmd := r.buildCommand("reset", "-q")
+	if _, err := r.run(
+		ctx,
+		r.buildCommand("rev-parse", "-q", "--verify", "HEAD"),
+	); err != nil {
+		unstageCmd = r.buildCommand(
+			"rm", "-r", "-q", "--cached", "--ignore-unmatch", ".",
+		)
+	}
+	if _, err := r.run(ctx, unstageCmd); err != nil {
+		return fmt.Errorf("error unstaging changes: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"add", "--all", "--"}, paths...)
+	if _, err := r.run(ctx, r.buildCommand(args...)); err != nil {
+		return fmt.Errorf("error staging changes for commit: %w", err)
+	}
+	return nil
+}
+
+func (r *repo) ObjectBytes(ctx context.Context) (int64, error) {
+	resBytes, err := r.run(ctx, r.buildCommand("count-objects", "-v"))
+	if err != nil {
+		return 0, fmt.Errorf("error counting objects: %w", err)
+	}
+	var kib int64
+	for _, line := range strings.Split(string(resBytes), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || (name != "size" && name != "size-pack") {
+			continue
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing %s of objects: %w", name, err)
+		}
+		kib += size
+	}
+	return kib * 1024, nil
+}
+
 func (r *repo) URL() string {
 	return r.url
 }
@@ -517,41 +2082,85 @@ func (r *repo) WorkingDir() string {
 	return r.dir
 }
 
-// SetupAuth configures the git CLI for authentication using either SSH or the
-// "store" (username/password-based) credential helper.
-func (r *repo) setupAuth(repoCreds RepoCredentials) error {
+func (r *repo) SetCredentials(repoCreds RepoCredentials) error {
+	readCreds := repoCreds.ForReading()
+	oldReadCreds := r.creds.ForReading()
+	if readCreds.SSHPrivateKey != "" || oldReadCreds.SSHPrivateKey != "" {
+		return errors.New(
+			"credentials cannot be replaced when SSH authentication is in use",
+		)
+	}
+	var err error
+	if readCreds.Netrc {
+		err = r.writeNetrc(readCreds)
+	} else {
+		err = r.writeCredentialsStore(r.credentialsStorePath(), readCreds)
+	}
+	if err != nil {
+		return err
+	}
+	if err = r.writeAuthHeaders(readCreds); err != nil {
+		return err
+	}
+	// The client certificate, if any, remains configured
+	readCreds.ClientCertificate = oldReadCreds.ClientCertificate
+	readCreds.ClientKey = oldReadCreds.ClientKey
+	if repoCreds.ReadCreds != nil {
+		repoCreds.ReadCreds = &readCreds
+	} else {
+		repoCreds.ClientCertificate = readCreds.ClientCertificate
+		repoCreds.ClientKey = readCreds.ClientKey
+	}
+	r.creds = repoCreds
+	return nil
+}
+
+// setupAuth configures the git CLI for authentication using either SSH or
+// git's built-in "store" (username/password-based) credential helper. Only
+// the credentials for reading are configured globally. Any separate
+// credentials for writing are applied to push commands only. See
+// buildPushCommand.
+func (r *repo) setupAuth(ctx context.Context, repoCreds RepoCredentials) error {
+	r.creds = repoCreds
+	r.pushURL = r.opts.PushURL
+	repoCreds = repoCreds.ForReading()
+
 	// Configure the git client
 	cmd := r.buildCommand("config", "--global", "user.name", "Kargo Render")
 	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
-	if _, err := libExec.Exec(cmd); err != nil {
+	if _, err := r.run(ctx, cmd); err != nil {
 		return fmt.Errorf("error configuring git username: %w", err)
 	}
 	cmd =
 		r.buildCommand("config", "--global", "user.email", "kargo-render@akuity.io")
 	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
-	if _, err := libExec.Exec(cmd); err != nil {
+	if _, err := r.run(ctx, cmd); err != nil {
 		return fmt.Errorf("error configuring git user email address: %w", err)
 	}
+	if err := r.setupHTTP(ctx); err != nil {
+		return err
+	}
+	// Headers for authentication are kept in a file of their own, included by
+	// the global configuration, so that they can be replaced along with the
+	// rest of the credentials. See SetCredentials.
+	cmd = r.buildCommand("config", "--global", "include.path", r.authHeadersPath())
+	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+	if _, err := r.run(ctx, cmd); err != nil {
+		return fmt.Errorf("error configuring git to include auth headers: %w", err)
+	}
+	if err := r.writeAuthHeaders(repoCreds); err != nil {
+		return err
+	}
 
 	// If an SSH key was provided, use that.
 	if repoCreds.SSHPrivateKey != "" {
-		sshConfigPath := filepath.Join(r.homeDir, ".ssh", "config")
-		// nolint: lll
-		const sshConfig = "Host *\n  StrictHostKeyChecking no\n  UserKnownHostsFile=/dev/null"
-		if err :=
-			os.WriteFile(sshConfigPath, []byte(sshConfig), 0600); err != nil {
-			return fmt.Errorf("error writing SSH config to %q: %w", sshConfigPath, err)
-		}
-
-		rsaKeyPath := filepath.Join(r.homeDir, ".ssh", "id_rsa")
-		if err := os.WriteFile(
-			rsaKeyPath,
-			[]byte(repoCreds.SSHPrivateKey),
-			0600,
-		); err != nil {
-			return fmt.Errorf("error writing SSH key to %q: %w", rsaKeyPath, err)
-		}
-		return nil // We're done
+		var err error
+		r.readAgent, err = r.writeSSHKey("id_rsa", repoCreds.SSHPrivateKey)
+		return err // We're done
+	}
+
+	if err := r.setupClientCertificate(ctx, repoCreds); err != nil {
+		return err
 	}
 
 	// If no password is specified, we're done'.
@@ -559,19 +2168,440 @@ func (r *repo) setupAuth(repoCreds RepoCredentials) error {
 		return nil
 	}
 
-	lowerURL := strings.ToLower(r.url)
-	if strings.HasPrefix(lowerURL, "http://") || strings.HasPrefix(lowerURL, "https://") {
-		u, err := url.Parse(r.url)
-		if err != nil {
-			return fmt.Errorf("error parsing URL %q: %w", r.url, err)
+	if !isHTTPURL(r.url) {
+		return nil
+	}
+
+	// git consults .netrc in the home directory by itself
+	if repoCreds.Netrc {
+		return r.writeNetrc(repoCreds)
+	}
+
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return fmt.Errorf("error parsing URL %q: %w", r.url, err)
+	}
+	u.User = url.User(repoCreds.Username)
+	r.url = u.String()
+	if isHTTPURL(r.pushURL) {
+		if u, err = url.Parse(r.pushURL); err != nil {
+			return fmt.Errorf("error parsing URL %q: %w", r.pushURL, err)
 		}
 		u.User = url.User(repoCreds.Username)
-		r.url = u.String()
+		r.pushURL = u.String()
+	}
+
+	// Configure git to use the "store" credential helper, which is built into
+	// git itself, with a credentials file that lives in the home directory.
+	// This means no external credential helper binary is required.
+	cmd = r.buildCommand(
+		"config",
+		"--global",
+		"credential.helper",
+		fmt.Sprintf("store --file=%s", r.credentialsStorePath()),
+	)
+	cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+	if _, err = r.run(ctx, cmd); err != nil {
+		return fmt.Errorf("error configuring git credential helper: %w", err)
+	}
+
+	return r.writeCredentialsStore(r.credentialsStorePath(), repoCreds)
+}
+
+// setupHTTP configures the git CLI to send the User-Agent header and any
+// additional headers specified by the repository's options with every HTTP(S)
+// request.
+func (r *repo) setupHTTP(ctx context.Context) error {
+	if r.opts.UserAgent != "" {
+		cmd := r.buildCommand("config", "--global", "http.userAgent", r.opts.UserAgent)
+		cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+		if _, err := r.run(ctx, cmd); err != nil {
+			return fmt.Errorf("error configuring git user agent: %w", err)
+		}
+	}
+	for _, header := range headerLines(r.opts.HTTPHeaders) {
+		cmd := r.buildCommand(
+			"config",
+			"--global",
+			"--add",
+			"http.extraHeader",
+			header,
+		)
+		cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+		if _, err := r.run(ctx, cmd); err != nil {
+			return fmt.Errorf(
+				"error configuring HTTP header %q: %w",
+				strings.SplitN(header, ":", 2)[0],
+				err,
+			)
+		}
+	}
+	return nil
+}
+
+// headerLines returns the provided headers, indexed by name, as lines of the
+// form "Name: value", sorted by name.
+func headerLines(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = fmt.Sprintf("%s: %s", name, headers[name])
+	}
+	return lines
+}
+
+// isHTTPURL returns a bool indicating whether the provided URL uses the HTTP or
+// HTTPS scheme.
+func isHTTPURL(u string) bool {
+	lowerURL := strings.ToLower(u)
+	return strings.HasPrefix(lowerURL, "http://") ||
+		strings.HasPrefix(lowerURL, "https://")
+}
+
+// writeSSHKey writes the provided SSH private key to a file by the specified
+// name in the .ssh directory of the home directory, along with an SSH config
+// that disables host key checking. If RepoOptions.SSHAgent was specified, the
+// key is instead held by an SSH agent listening on a socket by the specified
+// name, with a .sock extension, in the same directory, and the agent is
+// returned.
+func (r *repo) writeSSHKey(name string, key string) (*sshAgent, error) {
+	sshDir := filepath.Join(r.homeDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating %q: %w", sshDir, err)
+	}
+	sshConfigPath := filepath.Join(sshDir, "config")
+	// nolint: lll
+	const sshConfig = "Host *\n  StrictHostKeyChecking no\n  UserKnownHostsFile=/dev/null"
+	if err :=
+		os.WriteFile(sshConfigPath, []byte(sshConfig), 0600); err != nil {
+		return nil, fmt.Errorf("error writing SSH config to %q: %w", sshConfigPath, err)
+	}
+	if r.opts.SSHAgent {
+		socketPath := filepath.Join(sshDir, name+".sock")
+		// A socket left behind by an earlier process would prevent listening
+		if err := os.Remove(socketPath); err != nil &&
+			!errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error removing %q: %w", socketPath, err)
+		}
+		return startSSHAgent(socketPath, key)
+	}
+	keyPath := filepath.Join(sshDir, name)
+	if err := os.WriteFile(keyPath, []byte(key), 0600); err != nil {
+		return nil, fmt.Errorf("error writing SSH key to %q: %w", keyPath, err)
+	}
+	return nil, nil
+}
+
+// buildPushCommand builds a push command with the provided arguments. If
+// separate credentials for writing to the remote repository were specified,
+// they are written to the home directory and the command is configured to use
+// them in place of those configured globally for reading.
+func (r *repo) buildPushCommand(arg ...string) (*exec.Cmd, error) {
+	if r.creds.WriteCreds == nil {
+		return r.buildCommand(append([]string{"push"}, arg...)...), nil
+	}
+	writeCreds := r.creds.ForWriting()
+	var config []string
+	var env []string
+	switch {
+	case writeCreds.SSHPrivateKey != "" && r.opts.SSHAgent:
+		// The agent holding the key for reading is replaced by one holding only
+		// the key for writing
+		if r.writeAgent == nil {
+			var err error
+			if r.writeAgent, err =
+				r.writeSSHKey("id_rsa_write", writeCreds.SSHPrivateKey); err != nil {
+				return nil, err
+			}
+		}
+		env = append(env, r.writeAgent.env())
+	case writeCreds.SSHPrivateKey != "":
+		const keyName = "id_rsa_write"
+		if _, err := r.writeSSHKey(keyName, writeCreds.SSHPrivateKey); err != nil {
+			return nil, err
+		}
+		config = append(
+			config,
+			fmt.Sprintf(
+				"core.sshCommand=ssh -i %s -o IdentitiesOnly=yes",
+				filepath.Join(r.homeDir, ".ssh", keyName),
+			),
+		)
+	case writeCreds.Password != "" && isHTTPURL(r.pushTarget()):
+		path := filepath.Join(r.homeDir, ".git-write-credentials")
+		if err := r.writeCredentialsStore(path, writeCreds); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(r.pushTarget())
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URL %q: %w", r.pushTarget(), err)
+		}
+		u.User = url.User(writeCreds.Username)
+		config = append(
+			config,
+			fmt.Sprintf("remote.%s.pushurl=%s", RemoteOrigin, u.String()),
+			// An empty value clears the list of credential helpers configured
+			// globally for reading
+			"credential.helper=",
+			fmt.Sprintf("credential.helper=store --file=%s", path),
+		)
+	}
+	if len(r.creds.ForReading().ExtraHTTPHeaders) > 0 ||
+		len(writeCreds.ExtraHTTPHeaders) > 0 {
+		// An empty value clears the list of headers configured globally, which
+		// includes those for reading, so any others are added back
+		config = append(config, "http.extraHeader=")
+		for _, header := range headerLines(r.opts.HTTPHeaders) {
+			config = append(config, "http.extraHeader="+header)
+		}
+		for _, header := range headerLines(writeCreds.ExtraHTTPHeaders) {
+			config = append(config, "http.extraHeader="+header)
+		}
+	}
+	if writeCreds.ClientCertificate != "" && writeCreds.ClientKey != "" {
+		for _, file := range []struct {
+			path      string
+			contents  string
+			configKey string
+		}{
+			{
+				path:      filepath.Join(r.homeDir, ".git-write-client-cert.pem"),
+				contents:  writeCreds.ClientCertificate,
+				configKey: "http.sslCert",
+			},
+			{
+				path:      filepath.Join(r.homeDir, ".git-write-client-key.pem"),
+				contents:  writeCreds.ClientKey,
+				configKey: "http.sslKey",
+			},
+		} {
+			if err := os.WriteFile(file.path, []byte(file.contents), 0600); err != nil {
+				return nil, fmt.Errorf("error writing %q: %w", file.path, err)
+			}
+			config = append(config, fmt.Sprintf("%s=%s", file.configKey, file.path))
+		}
+	}
+	args := make([]string, 0, 2*len(config)+len(arg)+1)
+	for _, c := range config {
+		args = append(args, "-c", c)
+	}
+	args = append(args, "push")
+	cmd := r.buildCommand(append(args, arg...)...)
+	cmd.Env = append(cmd.Env, env...)
+	return cmd, nil
+}
 
+// setupClientCertificate configures the git CLI to present the TLS client
+// certificate from the provided credentials, if any, to remote repositories
+// accessed over HTTPS. The certificate and key are written to the repository's
+// isolated home directory.
+func (r *repo) setupClientCertificate(
+	ctx context.Context,
+	repoCreds RepoCredentials,
+) error {
+	if repoCreds.ClientCertificate == "" && repoCreds.ClientKey == "" {
+		return nil
+	}
+	if repoCreds.ClientCertificate == "" || repoCreds.ClientKey == "" {
+		return errors.New(
+			"a TLS client certificate and key must be specified together",
+		)
+	}
+	for _, file := range []struct {
+		path      string
+		contents  string
+		configKey string
+	}{
+		{
+			path:      filepath.Join(r.homeDir, ".git-client-cert.pem"),
+			contents:  repoCreds.ClientCertificate,
+			configKey: "http.sslCert",
+		},
+		{
+			path:      filepath.Join(r.homeDir, ".git-client-key.pem"),
+			contents:  repoCreds.ClientKey,
+			configKey: "http.sslKey",
+		},
+	} {
+		if err := os.WriteFile(file.path, []byte(file.contents), 0600); err != nil {
+			return fmt.Errorf("error writing %q: %w", file.path, err)
+		}
+		cmd := r.buildCommand("config", "--global", file.configKey, file.path)
+		cmd.Dir = r.homeDir // Override the cmd.Dir that's set by r.buildCommand()
+		if _, err := r.run(ctx, cmd); err != nil {
+			return fmt.Errorf("error configuring git %s: %w", file.configKey, err)
+		}
 	}
 	return nil
 }
 
+// pushTarget returns the URL of the remote repository that is pushed to.
+func (r *repo) pushTarget() string {
+	if r.pushURL != "" {
+		return r.pushURL
+	}
+	return r.url
+}
+
+// credentialsStorePath returns the path to the file used by the "store"
+// credential helper.
+func (r *repo) credentialsStorePath() string {
+	return filepath.Join(r.homeDir, ".git-credentials")
+}
+
+// authHeadersPath returns the path to the git configuration file, included by
+// the global configuration, that specifies the ExtraHTTPHeaders of the
+// credentials used for reading.
+func (r *repo) authHeadersPath() string {
+	return filepath.Join(r.homeDir, ".git-auth-headers")
+}
+
+// writeAuthHeaders (over)writes the file returned by authHeadersPath so that
+// it configures git to send only the ExtraHTTPHeaders of the provided
+// credentials.
+func (r *repo) writeAuthHeaders(repoCreds RepoCredentials) error {
+	config := "[http]\n"
+	for _, header := range headerLines(repoCreds.ExtraHTTPHeaders) {
+		header = strings.ReplaceAll(header, `\`, `\\`)
+		header = strings.ReplaceAll(header, `"`, `\"`)
+		config += fmt.Sprintf("\textraHeader = \"%s\"\n", header)
+	}
+	if err := os.WriteFile(r.authHeadersPath(), []byte(config), 0600); err != nil {
+		return fmt.Errorf(
+			"error writing git auth headers to %q: %w",
+			r.authHeadersPath(),
+			err,
+		)
+	}
+	return nil
+}
+
+// writeNetrc (over)writes the .netrc file in the repository's home directory so
+// that it contains only the provided credentials, for the host of every remote
+// repository accessed over HTTP(S).
+func (r *repo) writeNetrc(repoCreds RepoCredentials) error {
+	var lines []string
+	for _, repoURL := range []string{r.url, r.pushURL} {
+		if !isHTTPURL(repoURL) {
+			continue
+		}
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return fmt.Errorf("error parsing URL %q: %w", repoURL, err)
+		}
+		line := fmt.Sprintf(
+			"machine %s login %s password %s",
+			u.Hostname(),
+			repoCreds.Username,
+			repoCreds.Password,
+		)
+		if !slices.Contains(lines, line) {
+			lines = append(lines, line)
+		}
+	}
+	path := filepath.Join(r.homeDir, ".netrc")
+	if err := os.WriteFile(
+		path,
+		[]byte(strings.Join(lines, "\n")+"\n"),
+		0600,
+	); err != nil {
+		return fmt.Errorf("error writing git credentials to %q: %w", path, err)
+	}
+	return nil
+}
+
+// writeCredentialsStore (over)writes the file at the specified path, for use
+// by the "store" credential helper, so that it contains only the provided
+// credentials.
+func (r *repo) writeCredentialsStore(path string, repoCreds RepoCredentials) error {
+	var lines []string
+	for _, repoURL := range []string{r.url, r.pushURL} {
+		if !isHTTPURL(repoURL) {
+			continue
+		}
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return fmt.Errorf("error parsing URL %q: %w", repoURL, err)
+		}
+		credsURL := &url.URL{
+			Scheme: u.Scheme,
+			Host:   u.Host,
+			User:   url.UserPassword(repoCreds.Username, repoCreds.Password),
+		}
+		if line := credsURL.String(); !slices.Contains(lines, line) {
+			lines = append(lines, line)
+		}
+	}
+	if err := os.WriteFile(
+		path,
+		[]byte(strings.Join(lines, "\n")+"\n"),
+		0600,
+	); err != nil {
+		return fmt.Errorf("error writing git credentials to %q: %w", path, err)
+	}
+	return nil
+}
+
+// run executes the provided command, subject to the repository's options, and
+// returns the command's stdout.
+func (r *repo) run(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	opts := &libExec.Options{
+		Timeout: r.opts.CommandTimeout,
+		Logger:  r.opts.Logger,
+		Redactions: []string{
+			r.creds.ForReading().Password,
+			r.creds.ForReading().SSHPrivateKey,
+			r.creds.ForReading().ClientKey,
+			r.creds.ForWriting().Password,
+			r.creds.ForWriting().SSHPrivateKey,
+			r.creds.ForWriting().ClientKey,
+		},
+	}
+	for _, value := range r.opts.HTTPHeaders {
+		opts.Redactions = append(opts.Redactions, value)
+	}
+	for _, value := range r.creds.ForReading().ExtraHTTPHeaders {
+		opts.Redactions = append(opts.Redactions, value)
+	}
+	for _, value := range r.creds.ForWriting().ExtraHTTPHeaders {
+		opts.Redactions = append(opts.Redactions, value)
+	}
+	if observer := r.opts.CommandObserver; observer != nil {
+		opts.Observer = func(res libExec.Result) {
+			observer(res.Command, res.ExitCode, res.Duration)
+		}
+	}
+	res, err := libExec.Exec(ctx, cmd, opts)
+	return res.Stdout, classifyError(err)
+}
+
+// classifyError returns the provided error, wrapped together with
+// ErrAuthenticationFailed or ErrPermissionDenied if the output of the command
+// that failed shows that the remote repository refused the credentials or
+// found them lacking.
+func classifyError(err error) error {
+	exitErr := &libExec.ExitError{}
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	output := strings.ToLower(string(exitErr.Output))
+	for _, fragment := range authFailureOutputs {
+		if strings.Contains(output, fragment) {
+			return fmt.Errorf("%w: %w", ErrAuthenticationFailed, err)
+		}
+	}
+	for _, fragment := range permissionFailureOutputs {
+		if strings.Contains(output, fragment) {
+			return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+		}
+	}
+	return err
+}
+
 func (r *repo) buildCommand(arg ...string) *exec.Cmd {
 	cmd := exec.Command("git", arg...)
 	homeEnvVar := fmt.Sprintf("HOME=%s", r.homeDir)
@@ -580,12 +2610,8 @@ func (r *repo) buildCommand(arg ...string) *exec.Cmd {
 	} else {
 		cmd.Env = append(cmd.Env, homeEnvVar)
 	}
-	if r.creds.Password != "" {
-		cmd.Env = append(
-			cmd.Env,
-			"GIT_ASKPASS=/usr/local/bin/credential-helper",
-			fmt.Sprintf("GIT_PASSWORD=%s", r.creds.Password),
-		)
+	if r.readAgent != nil {
+		cmd.Env = append(cmd.Env, r.readAgent.env())
 	}
 	cmd.Dir = r.dir
 	return cmd
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// homeLockFile is the name of a file in every repository's home directory that
+// is locked, for as long as the repository is in use, by the process using it.
+// Locks are released by the operating system when a process exits for any
+// reason, so a home directory whose lock can be acquired has been abandoned.
+const homeLockFile = ".git-home.lock"
+
+// credentialPaths are the paths, relative to a repository's home directory, of
+// every file or directory to which credentials may be written.
+var credentialPaths = []string{
+	".ssh",
+	".git-credentials",
+	".git-write-credentials",
+	".git-auth-headers",
+	".netrc",
+	".git-client-cert.pem",
+	".git-client-key.pem",
+	".git-write-client-cert.pem",
+	".git-write-client-key.pem",
+}
+
+// lockHomeDir acquires a shared lock on the repository's home directory, which
+// prevents SweepCredentials from removing credentials from it, and holds it
+// until the repository is released.
+func (r *repo) lockHomeDir() error {
+	f, err := os.OpenFile(
+		filepath.Join(r.homeDir, homeLockFile),
+		os.O_RDWR|os.O_CREATE,
+		0600,
+	)
+	if err != nil {
+		return fmt.Errorf("error opening lock file of home directory: %w", err)
+	}
+	if err = lockShared(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error locking home directory: %w", err)
+	}
+	r.homeLock = f
+	return nil
+}
+
+// SweepCredentials removes the credentials written to the home directories of
+// repositories, in the system's temporary directory, that are no longer in use
+// by any process. These are left behind when a process exits without closing
+// its repositories, as it does when it crashes, and when a repository's home
+// directory is retained for inspection. Home directories are otherwise left
+// intact. The paths of the home directories from which credentials were
+// removed are returned.
+func SweepCredentials() ([]string, error) {
+	tempDir := os.TempDir()
+	items, err := os.ReadDir(tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing temporary directory contents: %w", err)
+	}
+	var swept []string
+	var errs []error
+	for _, item := range items {
+		if !item.IsDir() || !strings.HasPrefix(item.Name(), tmpPrefix) {
+			continue
+		}
+		dir := filepath.Join(tempDir, item.Name())
+		removed, err := sweepHomeDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if removed {
+			swept = append(swept, dir)
+		}
+	}
+	return swept, errors.Join(errs...)
+}
+
+// sweepHomeDir removes any credentials from the specified home directory if it
+// is not in use by any process. It returns a bool indicating whether any
+// credentials were removed.
+func sweepHomeDir(dir string) (bool, error) {
+	f, err := os.OpenFile(
+		filepath.Join(dir, homeLockFile),
+		os.O_RDWR|os.O_CREATE,
+		0600,
+	)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// The directory was removed in the meantime
+			return false, nil
+		}
+		return false, fmt.Errorf("error opening lock file in %q: %w", dir, err)
+	}
+	defer f.Close()
+	if locked, err := tryLockExclusive(f); err != nil {
+		return false, fmt.Errorf("error locking %q: %w", dir, err)
+	} else if !locked {
+		return false, nil
+	}
+	var removed bool
+	for _, path := range credentialPaths {
+		path = filepath.Join(dir, path)
+		if _, err = os.Lstat(path); err != nil {
+			continue
+		}
+		if err = os.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("error removing %q: %w", path, err)
+		}
+		removed = true
+	}
+	return removed, nil
+}
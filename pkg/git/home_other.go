@@ -0,0 +1,17 @@
+//go:build !unix
+
+package git
+
+import "os"
+
+// lockShared does nothing on platforms without advisory file locks.
+func lockShared(*os.File) error {
+	return nil
+}
+
+// tryLockExclusive always reports that the lock could not be acquired on
+// platforms without advisory file locks, since whether a home directory is
+// still in use cannot be determined.
+func tryLockExclusive(*os.File) (bool, error) {
+	return false, nil
+}
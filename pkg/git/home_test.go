@@ -0,0 +1,60 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepCredentials(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	writeCredentials := func(homeDir string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(homeDir, ".ssh"), 0700))
+		for _, path := range []string{
+			filepath.Join(".ssh", "id_rsa"),
+			".git-credentials",
+			".netrc",
+		} {
+			require.NoError(
+				t,
+				os.WriteFile(filepath.Join(homeDir, path), []byte("secret"), 0600),
+			)
+		}
+		require.NoError(t, os.MkdirAll(filepath.Join(homeDir, "repo"), 0700))
+	}
+
+	// Left behind by a process that crashed
+	abandonedDir := filepath.Join(tempDir, tmpPrefix+"abandoned")
+	writeCredentials(abandonedDir)
+
+	// In use by a repository
+	inUseDir := filepath.Join(tempDir, tmpPrefix+"in-use")
+	writeCredentials(inUseDir)
+	r := &repo{homeDir: inUseDir}
+	require.NoError(t, r.lockHomeDir())
+
+	// Not a repository's home directory
+	otherDir := filepath.Join(tempDir, "other")
+	writeCredentials(otherDir)
+
+	swept, err := SweepCredentials()
+	require.NoError(t, err)
+	require.Equal(t, []string{abandonedDir}, swept)
+	require.NoDirExists(t, filepath.Join(abandonedDir, ".ssh"))
+	require.NoFileExists(t, filepath.Join(abandonedDir, ".git-credentials"))
+	require.NoFileExists(t, filepath.Join(abandonedDir, ".netrc"))
+	require.DirExists(t, filepath.Join(abandonedDir, "repo"))
+	require.FileExists(t, filepath.Join(inUseDir, ".git-credentials"))
+	require.FileExists(t, filepath.Join(otherDir, ".git-credentials"))
+
+	// Once released, the repository's home directory is abandoned, too
+	require.NoError(t, r.Release())
+	swept, err = SweepCredentials()
+	require.NoError(t, err)
+	require.Equal(t, []string{inUseDir}, swept)
+	require.NoFileExists(t, filepath.Join(inUseDir, ".git-credentials"))
+}
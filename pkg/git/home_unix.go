@@ -0,0 +1,25 @@
+//go:build unix
+
+package git
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockShared blocks until it acquires a shared lock on the provided file.
+func lockShared(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_SH)
+}
+
+// tryLockExclusive attempts to acquire an exclusive lock on the provided file
+// without blocking. It returns a bool indicating whether the lock was
+// acquired.
+func tryLockExclusive(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,85 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// binaryVersionRegex matches the output of `git version`, capturing the major,
+// minor, and (optional) patch components of the version number. Anything
+// following those, such as the ".windows.1" suffix of Git for Windows or the
+// "(Apple Git-146)" suffix of Apple's git, is ignored.
+var binaryVersionRegex = regexp.MustCompile(`^git version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// binaryVersion is a parsed git version number.
+type binaryVersion struct {
+	major int
+	minor int
+	patch int
+}
+
+func (v binaryVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// atLeast returns a bool indicating whether the version is the same as or
+// newer than the specified major and minor version.
+func (v binaryVersion) atLeast(major, minor int) bool {
+	return v.major > major || (v.major == major && v.minor >= minor)
+}
+
+var (
+	detectBinaryVersionOnce sync.Once
+	detectedBinaryVersion   binaryVersion
+	detectBinaryVersionErr  error
+)
+
+// BinaryVersion returns the version of the git binary that is used for all
+// operations, e.g. "2.43.0". The binary is only consulted upon the first call.
+// Subsequent calls return the same result.
+func BinaryVersion() (string, error) {
+	v, err := getBinaryVersion()
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func getBinaryVersion() (binaryVersion, error) {
+	detectBinaryVersionOnce.Do(func() {
+		out, err := exec.Command("git", "version").Output()
+		if err != nil {
+			detectBinaryVersionErr = fmt.Errorf("error detecting git version: %w", err)
+			return
+		}
+		detectedBinaryVersion, detectBinaryVersionErr = parseBinaryVersion(string(out))
+	})
+	return detectedBinaryVersion, detectBinaryVersionErr
+}
+
+// parseBinaryVersion parses the output of `git version`.
+func parseBinaryVersion(out string) (binaryVersion, error) {
+	matches := binaryVersionRegex.FindStringSubmatch(strings.TrimSpace(out))
+	if matches == nil {
+		return binaryVersion{}, fmt.Errorf("error parsing git version %q", out)
+	}
+	v := binaryVersion{}
+	v.major, _ = strconv.Atoi(matches[1])
+	v.minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		v.patch, _ = strconv.Atoi(matches[3])
+	}
+	return v, nil
+}
+
+// canSwitchOrphan returns a bool indicating whether the git binary supports
+// `git switch --orphan`, which was introduced in git 2.23. If the version of
+// the binary cannot be determined, it is assumed to be recent enough.
+func canSwitchOrphan() bool {
+	v, err := getBinaryVersion()
+	return err != nil || v.atLeast(2, 23)
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBinaryVersion(t *testing.T) {
+	testCases := []struct {
+		name       string
+		out        string
+		assertions func(*testing.T, binaryVersion, error)
+	}{
+		{
+			name: "invalid output",
+			out:  "not git",
+			assertions: func(t *testing.T, _ binaryVersion, err error) {
+				require.ErrorContains(t, err, "error parsing git version")
+			},
+		},
+		{
+			name: "typical output",
+			out:  "git version 2.43.0\n",
+			assertions: func(t *testing.T, v binaryVersion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "2.43.0", v.String())
+				require.True(t, v.atLeast(2, 23))
+			},
+		},
+		{
+			name: "output with suffix",
+			out:  "git version 2.39.3 (Apple Git-146)",
+			assertions: func(t *testing.T, v binaryVersion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "2.39.3", v.String())
+			},
+		},
+		{
+			name: "output without patch version",
+			out:  "git version 2.22",
+			assertions: func(t *testing.T, v binaryVersion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "2.22.0", v.String())
+				require.False(t, v.atLeast(2, 23))
+			},
+		},
+		{
+			name: "old major version",
+			out:  "git version 1.8.3.1",
+			assertions: func(t *testing.T, v binaryVersion, err error) {
+				require.NoError(t, err)
+				require.False(t, v.atLeast(2, 23))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			v, err := parseBinaryVersion(testCase.out)
+			testCase.assertions(t, v, err)
+		})
+	}
+}
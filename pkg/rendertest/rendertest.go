@@ -0,0 +1,258 @@
+// Package rendertest provides utilities for writing realistic, end-to-end tests
+// of Kargo Render. It can spin up an in-process git server, seed repositories
+// on that server from fixture directories, execute complete rendering requests
+// against those repositories, and read back the contents of the resulting
+// branches for the purpose of making assertions.
+package rendertest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sosedoff/gitkit"
+
+	render "github.com/akuity/kargo-render"
+	libExec "github.com/akuity/kargo-render/internal/exec"
+)
+
+// DefaultBranch is the name of the default branch of every repository seeded
+// by a GitServer.
+const DefaultBranch = "main"
+
+// GitServer is an in-process git server that serves repositories over HTTP.
+type GitServer struct {
+	server   *httptest.Server
+	reposDir string
+}
+
+// NewGitServer starts a new, in-process git server. The server, and all
+// repositories it serves, are automatically cleaned up when the test (or
+// benchmark) completes.
+func NewGitServer(t testing.TB) *GitServer {
+	t.Helper()
+	reposDir := t.TempDir()
+	service := gitkit.New(gitkit.Config{Dir: reposDir})
+	if err := service.Setup(); err != nil {
+		t.Fatalf("error setting up git server: %s", err)
+	}
+	server := httptest.NewServer(service)
+	t.Cleanup(server.Close)
+	return &GitServer{
+		server:   server,
+		reposDir: reposDir,
+	}
+}
+
+// URL returns the base URL of the git server.
+func (g *GitServer) URL() string {
+	return g.server.URL
+}
+
+// SeedRepo creates a new repository with the specified name on the git server,
+// populates its default branch with a single commit containing the contents of
+// the specified fixture directory, and returns the repository's URL.
+func (g *GitServer) SeedRepo(t testing.TB, name, fixtureDir string) string {
+	t.Helper()
+	ctx := context.Background()
+	repoURL := fmt.Sprintf("%s/%s.git", g.server.URL, name)
+	bareDir := filepath.Join(g.reposDir, fmt.Sprintf("%s.git", name))
+	gitOrDie(
+		ctx,
+		t,
+		g.reposDir,
+		"init",
+		"--bare",
+		fmt.Sprintf("--initial-branch=%s", DefaultBranch),
+		bareDir,
+	)
+	workDir := t.TempDir()
+	gitOrDie(
+		ctx,
+		t,
+		workDir,
+		"init",
+		fmt.Sprintf("--initial-branch=%s", DefaultBranch),
+	)
+	if err := copyDir(fixtureDir, workDir); err != nil {
+		t.Fatalf("error copying fixture %q: %s", fixtureDir, err)
+	}
+	gitOrDie(ctx, t, workDir, "add", ".")
+	gitOrDie(ctx, t, workDir, "commit", "--allow-empty", "-m", "Initial commit")
+	gitOrDie(ctx, t, workDir, "push", repoURL, DefaultBranch)
+	return repoURL
+}
+
+// SeedBranch creates a new branch with the specified name in the repository
+// with the specified URL. The branch shares no history with any other branch
+// and consists of a single commit containing the contents of the specified
+// fixture directory.
+func (g *GitServer) SeedBranch(t testing.TB, repoURL, branch, fixtureDir string) {
+	t.Helper()
+	ctx := context.Background()
+	workDir := t.TempDir()
+	gitOrDie(ctx, t, workDir, "init", fmt.Sprintf("--initial-branch=%s", branch))
+	if err := copyDir(fixtureDir, workDir); err != nil {
+		t.Fatalf("error copying fixture %q: %s", fixtureDir, err)
+	}
+	gitOrDie(ctx, t, workDir, "add", ".")
+	gitOrDie(ctx, t, workDir, "commit", "--allow-empty", "-m", "Initial commit")
+	gitOrDie(ctx, t, workDir, "push", repoURL, branch)
+}
+
+// BranchFiles returns the contents of every file at the head of the specified
+// branch of the specified repository, indexed by path relative to the root of
+// the repository. The .git directory is excluded.
+func BranchFiles(t testing.TB, repoURL, branch string) map[string][]byte {
+	t.Helper()
+	dir := t.TempDir()
+	gitOrDie(
+		context.Background(),
+		t,
+		dir,
+		"clone",
+		"--depth=1",
+		fmt.Sprintf("--branch=%s", branch),
+		repoURL,
+		".",
+	)
+	files := map[string][]byte{}
+	if err := filepath.WalkDir(
+		dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if files[relPath], err = os.ReadFile(path); err != nil {
+				return err
+			}
+			return nil
+		},
+	); err != nil {
+		t.Fatalf("error reading files from branch %q: %s", branch, err)
+	}
+	return files
+}
+
+// Commit describes a single commit.
+type Commit struct {
+	// ID is the ID (sha) of the commit.
+	ID string
+	// Message is the commit's full message.
+	Message string
+}
+
+// HeadCommit returns the commit at the head of the specified branch of the
+// repository with the specified URL.
+func HeadCommit(t testing.TB, repoURL, branch string) Commit {
+	t.Helper()
+	dir := t.TempDir()
+	ctx := context.Background()
+	gitOrDie(
+		ctx,
+		t,
+		dir,
+		"clone",
+		"--depth=1",
+		fmt.Sprintf("--branch=%s", branch),
+		repoURL,
+		".",
+	)
+	return Commit{
+		ID:      strings.TrimSpace(gitOrDie(ctx, t, dir, "rev-parse", "HEAD")),
+		Message: strings.TrimSpace(gitOrDie(ctx, t, dir, "log", "-1", "--format=%B")),
+	}
+}
+
+// Render executes the provided rendering request using a new instance of the
+// Kargo Render service, configured using the provided options.
+func Render(
+	t testing.TB,
+	req *render.Request,
+	opts *render.ServiceOptions,
+) (render.Response, error) {
+	t.Helper()
+	return render.NewService(opts).RenderManifests(context.Background(), req)
+}
+
+// RequireTools skips the test (or benchmark) if any of the specified binaries
+// cannot be found on the PATH. Most complete rendering flows require, at a
+// minimum, kustomize.
+func RequireTools(t testing.TB, tools ...string) {
+	t.Helper()
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required but was not found on the PATH", tool)
+		}
+	}
+}
+
+// gitOrDie executes a git command in the specified directory and returns what
+// it wrote to stdout, failing the test if the command fails. The command is
+// isolated from any global or system git configuration on the host.
+func gitOrDie(
+	ctx context.Context,
+	t testing.TB,
+	dir string,
+	args ...string,
+) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(
+		os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Kargo Render Tests",
+		"GIT_AUTHOR_EMAIL=kargo-render-tests@akuity.io",
+		"GIT_COMMITTER_NAME=Kargo Render Tests",
+		"GIT_COMMITTER_EMAIL=kargo-render-tests@akuity.io",
+	)
+	res, err := libExec.Exec(ctx, cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res.Stdout)
+}
+
+// copyDir recursively copies the contents of srcDir into dstDir, which must
+// already exist.
+func copyDir(srcDir, dstDir string) error {
+	return filepath.WalkDir(
+		srcDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			dstPath := filepath.Join(dstDir, relPath)
+			if d.IsDir() {
+				return os.MkdirAll(dstPath, 0755)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(dstPath, data, 0644) // nolint: gosec
+		},
+	)
+}
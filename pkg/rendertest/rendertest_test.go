@@ -0,0 +1,142 @@
+package rendertest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	render "github.com/akuity/kargo-render"
+)
+
+func TestSeedRepo(t *testing.T) {
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	files := BranchFiles(t, repoURL, DefaultBranch)
+	require.Contains(t, files, "env/dev/configmap.yaml")
+}
+
+func TestHeadCommit(t *testing.T) {
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	commit := HeadCommit(t, repoURL, DefaultBranch)
+	require.Len(t, commit.ID, 40)
+	require.Equal(t, "Initial commit", commit.Message)
+}
+
+func TestRender(t *testing.T) {
+	RequireTools(t, "kustomize")
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	res, err := Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	files := BranchFiles(t, repoURL, "env/dev")
+	require.Contains(t, files, "app/test-configmap.yaml")
+	require.Contains(t, files, ".kargo-render/metadata.yaml")
+}
+
+func TestRenderWithOverlay(t *testing.T) {
+	RequireTools(t, "kustomize")
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/overlays/main")
+	server.SeedBranch(t, repoURL, "config/dev", "testdata/overlays/config-dev")
+	res, err := Render(
+		t,
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+		},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	files := BranchFiles(t, repoURL, "env/dev")
+	require.Contains(t, files, "app/dev-test-configmap.yaml")
+}
+
+func TestRenderRequiringBranchConfig(t *testing.T) {
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	_, err := Render(
+		t,
+		&render.Request{
+			RepoURL:             repoURL,
+			TargetBranch:        "env/dev",
+			RequireBranchConfig: true,
+		},
+		nil,
+	)
+	require.Error(t, err)
+	var noBranchConfigErr *render.NoBranchConfigError
+	require.ErrorAs(t, err, &noBranchConfigErr)
+	require.Equal(t, "env/dev", noBranchConfigErr.Branch)
+}
+
+func TestPlanAndApply(t *testing.T) {
+	RequireTools(t, "kustomize")
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	svc := render.NewService(nil)
+	plan, err := svc.Plan(
+		context.Background(),
+		&render.Request{
+			RepoURL:      repoURL,
+			TargetBranch: "env/dev",
+		},
+	)
+	require.NoError(t, err)
+	require.NotEmpty(t, plan.Changes)
+	require.Contains(t, plan.Diff, "app/test-configmap.yaml")
+
+	res, err := svc.Apply(context.Background(), &render.ApplyRequest{Plan: plan})
+	require.NoError(t, err)
+	require.Equal(t, render.ActionTakenPushedDirectly, res.ActionTaken)
+	files := BranchFiles(t, repoURL, "env/dev")
+	require.Contains(t, files, "app/test-configmap.yaml")
+
+	// The same plan cannot be applied twice, since the target branch has moved
+	_, err = svc.Apply(context.Background(), &render.ApplyRequest{Plan: plan})
+	require.Error(t, err)
+	var staleErr *render.StalePlanError
+	require.ErrorAs(t, err, &staleErr)
+}
+
+func TestWarmUp(t *testing.T) {
+	server := NewGitServer(t)
+	repoURL := server.SeedRepo(t, "test", "testdata/basic")
+	svc := render.NewService(
+		&render.ServiceOptions{
+			CloneCacheDir: t.TempDir(),
+		},
+	)
+	res, err := svc.WarmUp(
+		context.Background(),
+		&render.WarmUpRequest{RepoURL: repoURL},
+	)
+	require.NoError(t, err)
+	require.True(t, res.Mirrored)
+	// Warming up again updates the existing mirror
+	res, err = svc.WarmUp(
+		context.Background(),
+		&render.WarmUpRequest{RepoURL: repoURL},
+	)
+	require.NoError(t, err)
+	require.True(t, res.Mirrored)
+}
+
+func TestWarmUpWithoutCloneCache(t *testing.T) {
+	_, err := render.NewService(nil).WarmUp(
+		context.Background(),
+		&render.WarmUpRequest{RepoURL: "https://github.com/akuity/foobar"},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "nothing to warm up")
+}
@@ -0,0 +1,471 @@
+package render
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// Plan describes exactly what changes handling a rendering request would make
+// to an environment-specific branch. A Plan is produced by Service.Plan and
+// applied, unmodified, by Service.Apply. This permits a human to review and
+// approve a concrete diff before anything is written to the remote repository.
+// A Plan never contains repository credentials, so it is safe to persist or to
+// hand to a reviewer as an artifact.
+type Plan struct {
+	// RepoURL is the URL of the remote GitOps repository the Plan applies to.
+	RepoURL string `json:"repoURL"`
+	// PushURL is the URL of the remote GitOps repository that is pushed to
+	// when the Plan is applied, if other than RepoURL.
+	PushURL string `json:"pushURL,omitempty"`
+	// SourceCommit is the ID (sha) of the commit from which manifests were
+	// rendered.
+	SourceCommit string `json:"sourceCommit"`
+	// TargetBranch is the name of the environment-specific branch the Plan
+	// applies to.
+	TargetBranch string `json:"targetBranch"`
+	// TargetCommit is the ID (sha) of the commit at the head of TargetBranch
+	// when the Plan was created. It is empty if TargetBranch did not yet exist
+	// in the remote repository. A Plan cannot be applied once the head of
+	// TargetBranch has moved.
+	TargetCommit string `json:"targetCommit,omitempty"`
+	// CommitBranch is the name of the branch that changes will be committed to.
+	// This differs from TargetBranch when changes are to be PR'ed to
+	// TargetBranch.
+	CommitBranch string `json:"commitBranch"`
+	// CommitBranchCommit is the ID (sha) of the commit at the head of
+	// CommitBranch when the Plan was created, if CommitBranch differs from
+	// TargetBranch and already existed in the remote repository. A Plan cannot
+	// be applied once the head of CommitBranch has moved.
+	CommitBranchCommit string `json:"commitBranchCommit,omitempty"`
+	// UniqueCommitBranch indicates whether CommitBranch is unique to the
+	// request from which the Plan was created.
+	UniqueCommitBranch bool `json:"uniqueCommitBranch,omitempty"`
+	// CommitMessage is the message for the commit that will be created when the
+	// Plan is applied.
+	CommitMessage string `json:"commitMessage,omitempty"`
+	// CommitAuthor is the author of the commit that will be created when the
+	// Plan is applied, if other than Kargo Render itself.
+	CommitAuthor *CommitAuthor `json:"commitAuthor,omitempty"`
+	// PullRequest customizes any pull request opened when the Plan is applied.
+	PullRequest *PullRequestOptions `json:"pullRequest,omitempty"`
+	// Source describes where SourceCommit came from, as specified by the
+	// request from which the Plan was created. It is recorded in the body of
+	// any pull request opened when the Plan is applied.
+	Source *SourceContext `json:"source,omitempty"`
+	// Changes describes every file that will be written or deleted when the
+	// Plan is applied. If this is empty, applying the Plan is a no-op.
+	Changes []FileChange `json:"changes,omitempty"`
+	// Diff is a unified diff of Changes, suitable for review.
+	Diff string `json:"diff,omitempty"`
+	// Token is a digest of all other fields of the Plan. Service.Apply refuses
+	// to apply a Plan whose Token does not match its contents. When the Service
+	// was configured with a PlanSigningKey, the digest is an HMAC computed
+	// using that key.
+	Token string `json:"token"`
+}
+
+// FileChange describes a change to a single file in an environment-specific
+// branch.
+type FileChange struct {
+	// Path is the path of the file, relative to the root of the branch.
+	Path string `json:"path"`
+	// Content is the complete new content of the file. It is empty if Deleted
+	// is true.
+	Content []byte `json:"content,omitempty"`
+	// Deleted indicates whether the file is deleted.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// ApplyRequest is a request to apply a previously created Plan.
+type ApplyRequest struct {
+	// Plan is the Plan to apply.
+	Plan Plan `json:"plan"`
+	// RepoCreds encapsulates read/write credentials for the remote GitOps
+	// repository referenced by the Plan.
+	RepoCreds RepoCredentials `json:"repoCreds,omitempty"`
+}
+
+func (s *service) Plan(ctx context.Context, req *Request) (Plan, error) {
+	if !req.writesToRemote() || len(req.Outputs) > 1 {
+		return Plan{}, errors.New(
+			"LocalOutPath, Stdout, ReadOnly, and Outputs other than the target " +
+				"branch cannot be used when creating a plan",
+		)
+	}
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer release()
+	plan := &Plan{}
+	if _, err = s.renderManifests(ctx, req, plan); err != nil {
+		return Plan{}, err
+	}
+	if plan.Token, err = s.planToken(*plan); err != nil {
+		return Plan{}, err
+	}
+	return *plan, nil
+}
+
+// completePlan records the changes that have been made to the working tree
+// of the commit branch, as well as other details needed to apply them later,
+// in rc.plan.
+func completePlan(ctx context.Context, rc requestContext) error {
+	plan := rc.plan
+	plan.RepoURL = rc.repo.URL()
+	plan.PushURL = rc.request.PushURL
+	plan.SourceCommit = rc.source.commit
+	plan.TargetBranch = rc.request.TargetBranch
+	plan.CommitBranch = rc.target.commit.branch
+	plan.UniqueCommitBranch = rc.target.branchConfig.PRs.UseUniqueBranchNames
+	plan.CommitAuthor = rc.request.CommitAuthor
+	plan.PullRequest = rc.request.PullRequest
+	plan.Source = rc.request.Source
+	if err := rc.repo.AddAll(ctx); err != nil {
+		return fmt.Errorf("error staging changes: %w", err)
+	}
+	paths, err := rc.repo.GetStagedDiffPaths(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for diffs: %w", err)
+	}
+	meaningful, err := hasMeaningfulChanges(ctx, rc, paths)
+	if err != nil {
+		return err
+	}
+	if !meaningful {
+		rc.logger.WithField("commitBranch", rc.target.commit.branch).Debug(
+			"manifests do not differ from the head of the commit branch; " +
+				"plan contains no changes",
+		)
+		return nil
+	}
+	if plan.Diff, err = rc.repo.GetStagedDiff(ctx); err != nil {
+		return fmt.Errorf("error diffing changes: %w", err)
+	}
+	plan.Changes = make([]FileChange, len(paths))
+	for i, path := range paths {
+		plan.Changes[i] = FileChange{Path: path}
+		content, readErr := os.ReadFile(filepath.Join(rc.repo.WorkingDir(), path))
+		if os.IsNotExist(readErr) {
+			plan.Changes[i].Deleted = true
+			continue
+		}
+		if readErr != nil {
+			return fmt.Errorf("error reading %q: %w", path, readErr)
+		}
+		plan.Changes[i].Content = content
+	}
+	if plan.CommitMessage, err = buildCommitMessage(ctx, rc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *service) Apply(
+	ctx context.Context,
+	req *ApplyRequest,
+) (Response, error) {
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	defer release()
+	return s.withEvents(
+		ctx,
+		req.Plan.RepoURL,
+		req.Plan.TargetBranch,
+		func() (Response, error) {
+			return s.apply(ctx, req)
+		},
+	)
+}
+
+// apply makes exactly the changes described by the Plan in the provided
+// ApplyRequest.
+func (s *service) apply(
+	ctx context.Context,
+	req *ApplyRequest,
+) (res Response, err error) {
+	plan := req.Plan
+	logger := s.logger.WithField("request", uuid.NewString())
+	startEndLogger := logger.WithFields(log.Fields{
+		"repo":         plan.RepoURL,
+		"targetBranch": plan.TargetBranch,
+	})
+	startEndLogger.Debug("handling apply request")
+
+	token, err := s.planToken(plan)
+	if err != nil {
+		return res, err
+	}
+	if !hmac.Equal([]byte(token), []byte(plan.Token)) {
+		return res, errors.New(
+			"plan token does not match plan contents; refusing to apply a plan " +
+				"that has been modified",
+		)
+	}
+
+	rc := requestContext{
+		logger: logger,
+		request: &Request{
+			RepoURL:      plan.RepoURL,
+			PushURL:      plan.PushURL,
+			RepoCreds:    req.RepoCreds,
+			TargetBranch: plan.TargetBranch,
+			CommitAuthor: plan.CommitAuthor,
+			PullRequest:  plan.PullRequest,
+			Source:       plan.Source,
+		},
+		timings: newTimings(s.progressFn),
+	}
+	defer func() {
+		res.APIVersion = APIVersion
+		res.Timings = rc.timings.stages
+	}()
+	rc.source.commit = plan.SourceCommit
+	rc.target.commit.branch = plan.CommitBranch
+	rc.target.commit.message = plan.CommitMessage
+	rc.target.branchConfig.PRs = pullRequestConfig{
+		Enabled:              plan.CommitBranch != plan.TargetBranch,
+		UseUniqueBranchNames: plan.UniqueCommitBranch,
+	}
+
+	if _, err = s.refreshOAuthToken(
+		ctx,
+		plan.RepoURL,
+		&rc.request.RepoCreds,
+	); err != nil {
+		return res, err
+	}
+	start := rc.timings.start(StageClone)
+	cloneOpts := s.cloneOptions(s.repoOptions(logger), plan.RepoURL)
+	cloneOpts.PushURL = plan.PushURL
+	if rc.repo, err = git.Clone(
+		ctx,
+		plan.RepoURL,
+		rc.request.RepoCreds.gitCreds(),
+		cloneOpts,
+	); err != nil {
+		return res, fmt.Errorf("error cloning remote repository: %w", err)
+	}
+	rc.timings.record(StageClone, "", start)
+	defer func() {
+		res.Clone = s.cloneStats(
+			ctx,
+			logger,
+			rc.repo,
+			plan.RepoURL,
+			CloneStrategy(cloneOpts.CloneStrategy),
+		)
+		if err != nil && s.keepWorkspacesOnError {
+			rc.repo.Release()
+			err = keepWorkspace(logger, rc.repo.HomeDir(), err)
+			return
+		}
+		rc.repo.Close()
+	}()
+
+	if len(plan.Changes) == 0 {
+		startEndLogger.Debug("plan contains no changes; no action is required")
+		res.ActionTaken = ActionTakenNone
+		return res, nil
+	}
+
+	if err = s.refreshRepoCreds(ctx, rc); err != nil {
+		return res, err
+	}
+
+	if err = checkoutPlannedBranches(ctx, rc, plan); err != nil {
+		return res, err
+	}
+
+	if err = applyChanges(rc.repo.WorkingDir(), plan.Changes); err != nil {
+		return res, fmt.Errorf("error applying planned changes: %w", err)
+	}
+	logger.Debug("applied planned changes")
+
+	if res, err = s.commitAndPublish(ctx, rc, res); err != nil {
+		return res, err
+	}
+
+	startEndLogger.Debug("completed apply request")
+
+	return res, nil
+}
+
+// checkoutPlannedBranches checks out the target branch and, if applicable, the
+// commit branch referenced by the provided Plan, returning a *StalePlanError if
+// the head of either branch has moved since the Plan was created.
+func checkoutPlannedBranches(
+	ctx context.Context,
+	rc requestContext,
+	plan Plan,
+) error {
+	if err := checkPlannedBranch(
+		ctx,
+		rc.repo,
+		plan.TargetBranch,
+		plan.TargetCommit,
+		false,
+	); err != nil {
+		return err
+	}
+	if _, err := switchToTargetBranch(ctx, rc); err != nil {
+		return fmt.Errorf("error switching to target branch: %w", err)
+	}
+	if err := checkPlannedBranch(
+		ctx,
+		rc.repo,
+		plan.TargetBranch,
+		plan.TargetCommit,
+		true,
+	); err != nil {
+		return err
+	}
+	if plan.CommitBranch == plan.TargetBranch {
+		return nil
+	}
+	if err := checkPlannedBranch(
+		ctx,
+		rc.repo,
+		plan.CommitBranch,
+		plan.CommitBranchCommit,
+		false,
+	); err != nil {
+		return err
+	}
+	if plan.CommitBranchCommit == "" {
+		if err := rc.repo.CreateChildBranch(ctx, plan.CommitBranch); err != nil {
+			return fmt.Errorf("error creating child of target branch: %w", err)
+		}
+		return nil
+	}
+	if err := rc.repo.Checkout(ctx, plan.CommitBranch); err != nil {
+		return fmt.Errorf("error checking out commit branch: %w", err)
+	}
+	return checkPlannedBranch(
+		ctx,
+		rc.repo,
+		plan.CommitBranch,
+		plan.CommitBranchCommit,
+		true,
+	)
+}
+
+// checkPlannedBranch returns a *StalePlanError if the specified branch does
+// not match the state recorded in a Plan. An empty expectedCommit indicates the
+// branch did not exist in the remote repository when the Plan was created. If
+// checkedOut is false, only the existence of the branch in the remote
+// repository is checked. Otherwise, the branch is assumed to be checked out
+// and its head is compared to expectedCommit.
+func checkPlannedBranch(
+	ctx context.Context,
+	repo git.Repo,
+	branch string,
+	expectedCommit string,
+	checkedOut bool,
+) error {
+	if !checkedOut {
+		exists, err := repo.RemoteBranchExists(ctx, branch)
+		if err != nil {
+			return fmt.Errorf(
+				"error checking for existence of remote branch %q: %w",
+				branch,
+				err,
+			)
+		}
+		if exists && expectedCommit == "" {
+			return &StalePlanError{Branch: branch, ActualCommit: "(created)"}
+		}
+		if !exists && expectedCommit != "" {
+			return &StalePlanError{
+				Branch:         branch,
+				ExpectedCommit: expectedCommit,
+				ActualCommit:   "(deleted)",
+			}
+		}
+		return nil
+	}
+	if expectedCommit == "" {
+		return nil
+	}
+	actualCommit, err := repo.LastCommitID(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"error getting last commit ID from branch %q: %w",
+			branch,
+			err,
+		)
+	}
+	if actualCommit != expectedCommit {
+		return &StalePlanError{
+			Branch:         branch,
+			ExpectedCommit: expectedCommit,
+			ActualCommit:   actualCommit,
+		}
+	}
+	return nil
+}
+
+// applyChanges writes or deletes files in the specified directory as described
+// by the provided changes.
+func applyChanges(dir string, changes []FileChange) error {
+	for _, change := range changes {
+		path := filepath.Clean(change.Path)
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf(
+				"path %q is not a local path; refusing to apply change",
+				change.Path,
+			)
+		}
+		path = filepath.Join(dir, path)
+		if change.Deleted {
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("error deleting %q: %w", change.Path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf(
+				"error creating directory for %q: %w",
+				change.Path,
+				err,
+			)
+		}
+		// nolint: gosec
+		if err := os.WriteFile(path, change.Content, 0644); err != nil {
+			return fmt.Errorf("error writing %q: %w", change.Path, err)
+		}
+	}
+	return nil
+}
+
+// planToken returns a digest of all fields of the provided Plan other than
+// its Token. If the service was configured with a signing key, the digest is
+// an HMAC computed using that key.
+func (s *service) planToken(plan Plan) (string, error) {
+	plan.Token = ""
+	planBytes, err := json.Marshal(plan)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling plan: %w", err)
+	}
+	if len(s.planSigningKey) == 0 {
+		sum := sha256.Sum256(planBytes)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, s.planSigningKey)
+	_, _ = mac.Write(planBytes)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,119 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanToken(t *testing.T) {
+	plan := Plan{
+		RepoURL:      "https://github.com/akuity/foobar",
+		SourceCommit: "1abcdef2",
+		TargetBranch: "env/dev",
+		CommitBranch: "env/dev",
+		Changes: []FileChange{{
+			Path:    "app/all.yaml",
+			Content: []byte("foo"),
+		}},
+	}
+
+	unsigned := &service{}
+	token, err := unsigned.planToken(plan)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	// The token should not depend on any existing token
+	plan.Token = "bogus"
+	sameToken, err := unsigned.planToken(plan)
+	require.NoError(t, err)
+	require.Equal(t, token, sameToken)
+
+	// The token should depend on the plan's contents
+	plan.Changes[0].Content = []byte("bar")
+	differentToken, err := unsigned.planToken(plan)
+	require.NoError(t, err)
+	require.NotEqual(t, token, differentToken)
+
+	// The token should depend on the signing key
+	signed := &service{planSigningKey: []byte("secret")}
+	signedToken, err := signed.planToken(plan)
+	require.NoError(t, err)
+	require.NotEqual(t, differentToken, signedToken)
+}
+
+func TestApplyRejectsModifiedPlan(t *testing.T) {
+	svc := NewService(nil)
+	plan := Plan{
+		RepoURL:      "https://github.com/akuity/foobar",
+		TargetBranch: "env/dev",
+		CommitBranch: "env/dev",
+	}
+	var err error
+	plan.Token, err = (&service{}).planToken(plan)
+	require.NoError(t, err)
+	plan.TargetBranch = "env/prod"
+	_, err = svc.Apply(context.Background(), &ApplyRequest{Plan: plan})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match plan contents")
+}
+
+func TestApplyChanges(t *testing.T) {
+	testCases := []struct {
+		name       string
+		changes    []FileChange
+		assertions func(t *testing.T, dir string, err error)
+	}{
+		{
+			name:    "non-local path",
+			changes: []FileChange{{Path: "../foo.yaml"}},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is not a local path")
+			},
+		},
+		{
+			name: "success",
+			changes: []FileChange{
+				{
+					Path:    "app/new.yaml",
+					Content: []byte("new"),
+				},
+				{
+					Path:    "app/existing.yaml",
+					Content: []byte("modified"),
+				},
+				{
+					Path:    "app/deleted.yaml",
+					Deleted: true,
+				},
+			},
+			assertions: func(t *testing.T, dir string, err error) {
+				require.NoError(t, err)
+				content, err := os.ReadFile(filepath.Join(dir, "app", "new.yaml"))
+				require.NoError(t, err)
+				require.Equal(t, "new", string(content))
+				content, err = os.ReadFile(filepath.Join(dir, "app", "existing.yaml"))
+				require.NoError(t, err)
+				require.Equal(t, "modified", string(content))
+				require.NoFileExists(t, filepath.Join(dir, "app", "deleted.yaml"))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0755))
+			for _, name := range []string{"existing.yaml", "deleted.yaml"} {
+				require.NoError(
+					t,
+					os.WriteFile(filepath.Join(dir, "app", name), []byte("old"), 0600),
+				)
+			}
+			testCase.assertions(t, dir, applyChanges(dir, testCase.changes))
+		})
+	}
+}
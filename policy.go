@@ -0,0 +1,360 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/github"
+	"github.com/akuity/kargo-render/internal/manifests"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// ConfigManagementTool represents a configuration management tool that may be
+// used to render an app's manifests.
+type ConfigManagementTool string
+
+const (
+	// ConfigManagementToolDirectory represents plain manifests that are read
+	// from a directory without further processing.
+	ConfigManagementToolDirectory ConfigManagementTool = "directory"
+	// ConfigManagementToolHelm represents Helm.
+	ConfigManagementToolHelm ConfigManagementTool = "helm"
+	// ConfigManagementToolKustomize represents Kustomize.
+	ConfigManagementToolKustomize ConfigManagementTool = "kustomize"
+	// ConfigManagementToolPlugin represents an Argo CD config management
+	// plugin. Plugins execute arbitrary commands.
+	ConfigManagementToolPlugin ConfigManagementTool = "plugin"
+)
+
+// kustomizeExecBuildOptions are the options of kustomize build that cause it to
+// execute arbitrary commands, as config management plugins do.
+var kustomizeExecBuildOptions = []string{
+	"--enable-alpha-plugins",
+	"--enable-exec",
+	"--helm-command",
+}
+
+// checkConfigManagementPolicy returns a ConfigManagementToolNotAllowedError if
+// rendering any of the provided apps would require a configuration management
+// tool that the service has not been configured to allow. Since they execute
+// arbitrary commands, kustomize build options that enable exec plugins or
+// replace the helm command, whether used to render an app or to build its
+// manifests during last-mile rendering, require config management plugins to
+// be allowed. Apps are checked in order by name so that the result is
+// deterministic.
+func (s *service) checkConfigManagementPolicy(
+	ctx context.Context,
+	repoRoot string,
+	appConfigs map[string]appConfig,
+) error {
+	if s.allowedConfigManagement == nil {
+		return nil
+	}
+	appNames := make([]string, 0, len(appConfigs))
+	for appName := range appConfigs {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	for _, appName := range appNames {
+		sourceType, err := argocd.SourceType(
+			ctx,
+			repoRoot,
+			appConfigs[appName].ConfigManagement,
+		)
+		if err != nil {
+			return fmt.Errorf("error checking app %q: %w", appName, err)
+		}
+		tool := ConfigManagementTool(strings.ToLower(sourceType))
+		if !slices.Contains(s.allowedConfigManagement, tool) {
+			return &ConfigManagementToolNotAllowedError{
+				App:     appName,
+				Tool:    tool,
+				Allowed: s.allowedConfigManagement,
+			}
+		}
+		if slices.Contains(s.allowedConfigManagement, ConfigManagementToolPlugin) {
+			continue
+		}
+		appConfig := appConfigs[appName]
+		var buildOptions []string
+		if kustomizeCfg := appConfig.ConfigManagement.Kustomize; kustomizeCfg != nil {
+			buildOptions = append(buildOptions, kustomizeCfg.BuildOptions)
+		}
+		if appConfig.LastMile != nil {
+			buildOptions = append(buildOptions, appConfig.LastMile.BuildOptions)
+		}
+		for _, options := range buildOptions {
+			if option := kustomizeExecBuildOption(options); option != "" {
+				return &ConfigManagementToolNotAllowedError{
+					App:         appName,
+					Tool:        ConfigManagementToolPlugin,
+					BuildOption: option,
+					Allowed:     s.allowedConfigManagement,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// kustomizeExecBuildOption returns the first of the provided kustomize build
+// options that causes kustomize to execute arbitrary commands, or an empty
+// string if there is none. Boolean options explicitly set to false are
+// ignored.
+func kustomizeExecBuildOption(options string) string {
+	for _, option := range strings.Fields(options) {
+		name, value, hasValue := strings.Cut(option, "=")
+		if !slices.Contains(kustomizeExecBuildOptions, name) {
+			continue
+		}
+		if enabled, err := strconv.ParseBool(value); hasValue && err == nil && !enabled {
+			continue
+		}
+		return name
+	}
+	return ""
+}
+
+// CommitSignaturePolicy requires that source commits rendered into matching
+// target branches bear a good signature made by one of a set of trusted keys.
+// This prevents unsigned commits, or commits signed by unknown parties, from
+// being promoted into protected environments.
+type CommitSignaturePolicy struct {
+	// TargetBranchPattern is a regular expression matched against the names of
+	// target branches. The policy applies to any target branch whose name
+	// matches. If empty, the policy applies to all target branches.
+	TargetBranchPattern string
+	// TrustedKeys are the public keys of the parties that may sign source
+	// commits. Each may be either an ASCII-armored OpenPGP public key or an SSH
+	// public key in the format used by authorized_keys files.
+	TrustedKeys []string
+}
+
+// checkCommitSignaturePolicies returns an UnverifiedCommitError if the
+// specified source commit does not satisfy every CommitSignaturePolicy that
+// applies to the specified target branch.
+func (s *service) checkCommitSignaturePolicies(
+	ctx context.Context,
+	repo git.Repo,
+	targetBranch string,
+	commit string,
+) error {
+	for _, policy := range s.commitSignaturePolicies {
+		applies, err := policyApplies(policy.TargetBranchPattern, targetBranch)
+		if err != nil {
+			return err
+		}
+		if !applies {
+			continue
+		}
+		sig, err := repo.CommitSignature(ctx, commit, policy.TrustedKeys)
+		if err != nil {
+			return fmt.Errorf("error verifying signature of commit %q: %w", commit, err)
+		}
+		if !sig.Verified() {
+			return &UnverifiedCommitError{
+				Commit:       commit,
+				TargetBranch: targetBranch,
+				Signature:    sig,
+			}
+		}
+	}
+	return nil
+}
+
+// RequiredChecksPolicy requires that status checks on source commits rendered
+// into matching target branches have passed. This prevents commits that failed
+// CI from being promoted. Checks are looked up using the git provider's API,
+// which is presently supported only for repositories hosted by GitHub.
+type RequiredChecksPolicy struct {
+	// TargetBranchPattern is a regular expression matched against the names of
+	// target branches. The policy applies to any target branch whose name
+	// matches. If empty, the policy applies to all target branches.
+	TargetBranchPattern string
+	// Checks are the names of the checks that must have passed. For checks
+	// implemented using GitHub Actions, these are the names of jobs.
+	Checks []string
+}
+
+// checkRequiredChecksPolicies returns a RequiredChecksNotPassedError if any
+// check required by any RequiredChecksPolicy that applies to the specified
+// target branch has not passed on the specified source commit. Offline
+// requests are refused with a NetworkAccessRequiredError if any check is
+// required.
+func (s *service) checkRequiredChecksPolicies(
+	ctx context.Context,
+	req *Request,
+	commit string,
+) error {
+	var required []string
+	for _, policy := range s.requiredChecksPolicies {
+		applies, err := policyApplies(policy.TargetBranchPattern, req.TargetBranch)
+		if err != nil {
+			return err
+		}
+		if applies {
+			required = append(required, policy.Checks...)
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+	if req.Offline {
+		return &NetworkAccessRequiredError{
+			TargetBranch: req.TargetBranch,
+			Reasons: []string{
+				"required status checks are retrieved using the git provider's API",
+			},
+		}
+	}
+	states, err := s.getCheckStatesFn(
+		ctx,
+		req.RepoURL,
+		commit,
+		req.RepoCreds.gitCreds().ForReading(),
+		s.githubClientOptions(s.logger.WithField("request", req.id)),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting status checks: %w", err)
+	}
+	sort.Strings(required)
+	notPassed := map[string]string{}
+	for _, check := range slices.Compact(required) {
+		state, ok := states[check]
+		switch {
+		case !ok:
+			notPassed[check] = "missing"
+		case state != github.CheckStateSuccess:
+			notPassed[check] = string(state)
+		}
+	}
+	if len(notPassed) > 0 {
+		return &RequiredChecksNotPassedError{
+			Commit:       commit,
+			TargetBranch: req.TargetBranch,
+			Checks:       notPassed,
+		}
+	}
+	return nil
+}
+
+// policyApplies returns true if a policy with the specified target branch
+// pattern applies to the specified target branch. A policy with no pattern
+// applies to all target branches.
+func policyApplies(pattern string, targetBranch string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return false,
+			fmt.Errorf("error compiling regular expression /%s/: %w", pattern, err)
+	}
+	return regex.MatchString(targetBranch), nil
+}
+
+// violationActionWarn is the value of configuration fields, such as a resource
+// policy's OnViolation field, that causes problems with rendered resources to
+// be reported rather than refused.
+const violationActionWarn = "warn"
+
+// violationActionFail is the value of configuration fields, such as a
+// branch's OnMissingPreservedPaths field, that causes problems that are
+// otherwise only reported to be refused.
+const violationActionFail = "fail"
+
+// checkResourcePolicy returns the rendered resources that violate the target
+// branch's resource policy, if it has one. If the policy says to fail when it
+// is violated, a ResourcePolicyViolationError is returned instead. Apps are
+// checked in order by name so that the result is deterministic.
+func checkResourcePolicy(
+	rc requestContext,
+) ([]ResourcePolicyViolation, error) {
+	policy := rc.target.branchConfig.ResourcePolicy
+	if policy == nil {
+		return nil, nil
+	}
+	appNames := make([]string, 0, len(rc.target.renderedManifests))
+	for appName := range rc.target.renderedManifests {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	var violations []ResourcePolicyViolation
+	for _, appName := range appNames {
+		resources, err :=
+			manifests.SplitYAMLResources(rc.target.renderedManifests[appName])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error parsing rendered manifests for app %q: %w",
+				appName,
+				err,
+			)
+		}
+		for _, resource := range resources {
+			if policy.allows(resource) {
+				continue
+			}
+			violations = append(violations, ResourcePolicyViolation{
+				App:        appName,
+				APIVersion: resource.APIVersion,
+				Kind:       resource.Kind,
+				Namespace:  resource.Namespace,
+				Name:       resource.Name,
+			})
+		}
+	}
+	if len(violations) > 0 &&
+		policy.OnViolation != violationActionWarn {
+		return nil, &ResourcePolicyViolationError{
+			TargetBranch: rc.request.TargetBranch,
+			Violations:   violations,
+		}
+	}
+	return violations, nil
+}
+
+// String returns a string of the form <app>: <apiVersion>/<kind>
+// [<namespace>/]<name> that identifies the offending resource.
+func (r ResourcePolicyViolation) String() string {
+	name := r.Name
+	if r.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s: %s/%s %s", r.App, r.APIVersion, r.Kind, name)
+}
+
+// allows returns a bool indicating whether the policy permits the provided
+// resource to be rendered.
+func (r *resourcePolicyConfig) allows(resource manifests.Resource) bool {
+	apiGroup := apiGroupOf(resource.APIVersion)
+	for _, rule := range r.Deny {
+		if rule.matches(apiGroup, resource.Kind) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, rule := range r.Allow {
+		if rule.matches(apiGroup, resource.Kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiGroupOf returns the API group component of the provided apiVersion.
+// Resources in the core API group have an apiVersion with no group component,
+// e.g. v1, in which case the empty string is returned.
+func apiGroupOf(apiVersion string) string {
+	if group, _, ok := strings.Cut(apiVersion, "/"); ok {
+		return group
+	}
+	return ""
+}
@@ -0,0 +1,545 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/github"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+func TestCheckConfigManagementPolicy(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, file := range []string{"foo/Chart.yaml", "bar/kustomization.yaml"} {
+		path := filepath.Join(repoRoot, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+	}
+	appConfigs := map[string]appConfig{
+		"foo": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"},
+		},
+		"bar": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "bar"},
+		},
+	}
+	testCases := []struct {
+		name       string
+		allowed    []ConfigManagementTool
+		appConfigs map[string]appConfig
+		assertions func(*testing.T, error)
+	}{
+		{
+			name:       "no policy",
+			appConfigs: appConfigs,
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "all tools allowed",
+			allowed: []ConfigManagementTool{
+				ConfigManagementToolHelm,
+				ConfigManagementToolKustomize,
+			},
+			appConfigs: appConfigs,
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:       "inferred tool not allowed",
+			allowed:    []ConfigManagementTool{ConfigManagementToolKustomize},
+			appConfigs: appConfigs,
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				notAllowedErr := &ConfigManagementToolNotAllowedError{}
+				require.ErrorAs(t, err, &notAllowedErr)
+				require.Equal(t, "foo", notAllowedErr.App)
+				require.Equal(t, ConfigManagementToolHelm, notAllowedErr.Tool)
+			},
+		},
+		{
+			name:    "explicit tool not allowed",
+			allowed: []ConfigManagementTool{ConfigManagementToolKustomize},
+			appConfigs: map[string]appConfig{
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path:   "bar",
+						Plugin: &argoappv1.ApplicationSourcePlugin{Name: "evil"},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				notAllowedErr := &ConfigManagementToolNotAllowedError{}
+				require.ErrorAs(t, err, &notAllowedErr)
+				require.Equal(t, "bar", notAllowedErr.App)
+				require.Equal(t, ConfigManagementToolPlugin, notAllowedErr.Tool)
+			},
+		},
+		{
+			name:    "kustomize exec build option not allowed",
+			allowed: []ConfigManagementTool{ConfigManagementToolKustomize},
+			appConfigs: map[string]appConfig{
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path: "bar",
+						Kustomize: &argocd.ApplicationSourceKustomize{
+							BuildOptions: "--enable-helm --enable-alpha-plugins",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				notAllowedErr := &ConfigManagementToolNotAllowedError{}
+				require.ErrorAs(t, err, &notAllowedErr)
+				require.Equal(t, "bar", notAllowedErr.App)
+				require.Equal(t, ConfigManagementToolPlugin, notAllowedErr.Tool)
+				require.Equal(t, "--enable-alpha-plugins", notAllowedErr.BuildOption)
+				require.Contains(t, err.Error(), "--enable-alpha-plugins")
+			},
+		},
+		{
+			name: "last-mile exec build option not allowed",
+			allowed: []ConfigManagementTool{
+				ConfigManagementToolHelm,
+				ConfigManagementToolKustomize,
+			},
+			appConfigs: map[string]appConfig{
+				"foo": {
+					ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"},
+					LastMile:         &lastMileConfig{BuildOptions: "--helm-command=/bin/sh"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				notAllowedErr := &ConfigManagementToolNotAllowedError{}
+				require.ErrorAs(t, err, &notAllowedErr)
+				require.Equal(t, "foo", notAllowedErr.App)
+				require.Equal(t, "--helm-command", notAllowedErr.BuildOption)
+			},
+		},
+		{
+			name:    "kustomize exec build option disabled",
+			allowed: []ConfigManagementTool{ConfigManagementToolKustomize},
+			appConfigs: map[string]appConfig{
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path: "bar",
+						Kustomize: &argocd.ApplicationSourceKustomize{
+							BuildOptions: "--enable-exec=false",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "kustomize exec build option allowed by plugins",
+			allowed: []ConfigManagementTool{
+				ConfigManagementToolKustomize,
+				ConfigManagementToolPlugin,
+			},
+			appConfigs: map[string]appConfig{
+				"bar": {
+					ConfigManagement: argocd.ConfigManagementConfig{
+						Path: "bar",
+						Kustomize: &argocd.ApplicationSourceKustomize{
+							BuildOptions: "--enable-alpha-plugins --enable-exec",
+						},
+					},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := &service{allowedConfigManagement: testCase.allowed}
+			testCase.assertions(
+				t,
+				s.checkConfigManagementPolicy(
+					context.Background(),
+					repoRoot,
+					testCase.appConfigs,
+				),
+			)
+		})
+	}
+}
+
+// fakeSignedRepo is a git.Repo whose commits all bear the same signature.
+type fakeSignedRepo struct {
+	git.Repo
+	sig git.CommitSignature
+}
+
+func (f *fakeSignedRepo) CommitSignature(
+	context.Context,
+	string,
+	[]string,
+) (git.CommitSignature, error) {
+	return f.sig, nil
+}
+
+func TestCheckCommitSignaturePolicies(t *testing.T) {
+	policies := []CommitSignaturePolicy{
+		{
+			TargetBranchPattern: "^env/prod",
+			TrustedKeys:         []string{"fake-key"},
+		},
+	}
+	testCases := []struct {
+		name         string
+		policies     []CommitSignaturePolicy
+		targetBranch string
+		sig          git.CommitSignature
+		assertions   func(*testing.T, error)
+	}{
+		{
+			name:         "no policies",
+			targetBranch: "env/prod",
+			sig:          git.CommitSignature{Status: "N"},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "policy does not apply to branch",
+			policies:     policies,
+			targetBranch: "env/dev",
+			sig:          git.CommitSignature{Status: "N"},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "commit signed by trusted key",
+			policies:     policies,
+			targetBranch: "env/prod",
+			sig:          git.CommitSignature{Status: "G", Key: "fake-key"},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "commit not signed",
+			policies:     policies,
+			targetBranch: "env/prod",
+			sig:          git.CommitSignature{Status: "N"},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				unverifiedErr := &UnverifiedCommitError{}
+				require.ErrorAs(t, err, &unverifiedErr)
+				require.Equal(t, "env/prod", unverifiedErr.TargetBranch)
+				require.Contains(t, err.Error(), "it is not signed")
+			},
+		},
+		{
+			name: "commit signed by untrusted key",
+			policies: []CommitSignaturePolicy{
+				{TrustedKeys: []string{"fake-key"}},
+			},
+			targetBranch: "env/dev",
+			sig:          git.CommitSignature{Status: "U", Key: "other-key"},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `key "other-key", which is not trusted`)
+			},
+		},
+		{
+			name: "invalid pattern",
+			policies: []CommitSignaturePolicy{
+				{TargetBranchPattern: "("},
+			},
+			targetBranch: "env/prod",
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "error compiling regular expression")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := &service{commitSignaturePolicies: testCase.policies}
+			testCase.assertions(
+				t,
+				s.checkCommitSignaturePolicies(
+					context.Background(),
+					&fakeSignedRepo{sig: testCase.sig},
+					testCase.targetBranch,
+					"fake-commit",
+				),
+			)
+		})
+	}
+}
+
+func TestCheckRequiredChecksPolicies(t *testing.T) {
+	policies := []RequiredChecksPolicy{
+		{
+			TargetBranchPattern: "^env/prod",
+			Checks:              []string{"build", "test"},
+		},
+		{
+			Checks: []string{"lint", "build"},
+		},
+	}
+	testCases := []struct {
+		name         string
+		policies     []RequiredChecksPolicy
+		targetBranch string
+		offline      bool
+		states       map[string]github.CheckState
+		statesErr    error
+		assertions   func(*testing.T, bool, error)
+	}{
+		{
+			name:         "no policies",
+			targetBranch: "env/prod",
+			assertions: func(t *testing.T, queried bool, err error) {
+				require.NoError(t, err)
+				// The git provider shouldn't be queried unnecessarily
+				require.False(t, queried)
+			},
+		},
+		{
+			name:         "all required checks passed",
+			policies:     policies,
+			targetBranch: "env/prod",
+			states: map[string]github.CheckState{
+				"build": github.CheckStateSuccess,
+				"test":  github.CheckStateSuccess,
+				"lint":  github.CheckStateSuccess,
+			},
+			assertions: func(t *testing.T, queried bool, err error) {
+				require.NoError(t, err)
+				require.True(t, queried)
+			},
+		},
+		{
+			name:         "check only required by inapplicable policy failed",
+			policies:     policies,
+			targetBranch: "env/dev",
+			states: map[string]github.CheckState{
+				"build": github.CheckStateSuccess,
+				"test":  github.CheckStateFailure,
+				"lint":  github.CheckStateSuccess,
+			},
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "required checks not passed",
+			policies:     policies,
+			targetBranch: "env/prod",
+			states: map[string]github.CheckState{
+				"build": github.CheckStateFailure,
+				"lint":  github.CheckStatePending,
+			},
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.Error(t, err)
+				notPassedErr := &RequiredChecksNotPassedError{}
+				require.ErrorAs(t, err, &notPassedErr)
+				require.Equal(
+					t,
+					map[string]string{
+						"build": "failure",
+						"lint":  "pending",
+						"test":  "missing",
+					},
+					notPassedErr.Checks,
+				)
+				require.Contains(
+					t,
+					err.Error(),
+					"build (failure), lint (pending), test (missing)",
+				)
+			},
+		},
+		{
+			name:         "offline",
+			policies:     policies,
+			targetBranch: "env/prod",
+			offline:      true,
+			assertions: func(t *testing.T, queried bool, err error) {
+				offlineErr := &NetworkAccessRequiredError{}
+				require.ErrorAs(t, err, &offlineErr)
+				require.Equal(t, "env/prod", offlineErr.TargetBranch)
+				require.False(t, queried)
+			},
+		},
+		{
+			name:         "offline with no applicable policies",
+			policies:     policies[:1],
+			targetBranch: "env/dev",
+			offline:      true,
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "error getting check states",
+			policies:     policies,
+			targetBranch: "env/prod",
+			statesErr:    errors.New("something went wrong"),
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "something went wrong")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var queried bool
+			s := &service{
+				logger:                 log.New(),
+				requiredChecksPolicies: testCase.policies,
+				getCheckStatesFn: func(
+					context.Context,
+					string,
+					string,
+					git.RepoCredentials,
+					*github.ClientOptions,
+				) (map[string]github.CheckState, error) {
+					queried = true
+					return testCase.states, testCase.statesErr
+				},
+			}
+			err := s.checkRequiredChecksPolicies(
+				context.Background(),
+				&Request{
+					RepoURL:      "https://github.com/akuity/fake",
+					TargetBranch: testCase.targetBranch,
+					Offline:      testCase.offline,
+				},
+				"fake-commit",
+			)
+			testCase.assertions(t, queried, err)
+		})
+	}
+}
+
+func TestCheckResourcePolicy(t *testing.T) {
+	coreGroup := ""
+	renderedManifests := map[string][]byte{
+		"foo": []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: foo
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: foo
+`),
+		"bar": []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: bar
+`),
+	}
+	testCases := []struct {
+		name       string
+		policy     *resourcePolicyConfig
+		assertions func(*testing.T, []ResourcePolicyViolation, error)
+	}{
+		{
+			name: "no policy",
+			assertions: func(t *testing.T, violations []ResourcePolicyViolation, err error) {
+				require.NoError(t, err)
+				require.Empty(t, violations)
+			},
+		},
+		{
+			name: "nothing denied",
+			policy: &resourcePolicyConfig{
+				Deny: []resourceRule{{Kind: "Secret"}},
+			},
+			assertions: func(t *testing.T, violations []ResourcePolicyViolation, err error) {
+				require.NoError(t, err)
+				require.Empty(t, violations)
+			},
+		},
+		{
+			name: "denied kind",
+			policy: &resourcePolicyConfig{
+				Deny: []resourceRule{{Kind: "ClusterRoleBinding"}},
+			},
+			assertions: func(t *testing.T, violations []ResourcePolicyViolation, err error) {
+				require.Empty(t, violations)
+				var policyErr *ResourcePolicyViolationError
+				require.ErrorAs(t, err, &policyErr)
+				require.Equal(t, "env/prod", policyErr.TargetBranch)
+				require.Equal(
+					t,
+					[]ResourcePolicyViolation{{
+						App:        "foo",
+						APIVersion: "rbac.authorization.k8s.io/v1",
+						Kind:       "ClusterRoleBinding",
+						Name:       "foo",
+					}},
+					policyErr.Violations,
+				)
+			},
+		},
+		{
+			name: "only core API group allowed",
+			policy: &resourcePolicyConfig{
+				Allow: []resourceRule{{APIGroup: &coreGroup}},
+			},
+			assertions: func(t *testing.T, _ []ResourcePolicyViolation, err error) {
+				var policyErr *ResourcePolicyViolationError
+				require.ErrorAs(t, err, &policyErr)
+				require.Len(t, policyErr.Violations, 2)
+				// Violations are reported in order by app name
+				require.Equal(t, "bar", policyErr.Violations[0].App)
+				require.Equal(t, "foo", policyErr.Violations[1].App)
+			},
+		},
+		{
+			name: "deny takes precedence over allow",
+			policy: &resourcePolicyConfig{
+				Allow:       []resourceRule{{Kind: "ConfigMap"}},
+				Deny:        []resourceRule{{APIGroup: &coreGroup, Kind: "ConfigMap"}},
+				OnViolation: violationActionWarn,
+			},
+			assertions: func(t *testing.T, violations []ResourcePolicyViolation, err error) {
+				require.NoError(t, err)
+				require.Len(t, violations, 3)
+				require.Equal(
+					t,
+					"foo: v1/ConfigMap foo/foo",
+					violations[1].String(),
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				request: &Request{TargetBranch: "env/prod"},
+			}
+			rc.target.branchConfig.ResourcePolicy = testCase.policy
+			rc.target.renderedManifests = renderedManifests
+			violations, err := checkResourcePolicy(rc)
+			testCase.assertions(t, violations, err)
+		})
+	}
+}
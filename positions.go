@@ -0,0 +1,96 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// configProblems converts the provided schema validation errors, which refer to
+// fields of the JSON document converted from the provided configuration, into
+// ConfigProblems that refer to lines of the configuration itself.
+func configProblems(
+	configBytes []byte,
+	verrs []gojsonschema.ResultError,
+) []ConfigProblem {
+	// JSON is a subset of YAML, so this works for configuration in either
+	// format. If the configuration cannot be parsed, which should not happen
+	// since it was already converted to JSON successfully, problems are
+	// reported without positions.
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(configBytes, doc); err != nil {
+		doc = nil
+	}
+	lines := strings.Split(string(configBytes), "\n")
+	problems := make([]ConfigProblem, len(verrs))
+	for i, verr := range verrs {
+		path := strings.Split(verr.Context().String("\x00"), "\x00")[1:]
+		problem := ConfigProblem{Description: verr.Description()}
+		if len(path) > 0 {
+			problem.Field = strings.Join(path, ".")
+		}
+		// Point at an unexpected property itself rather than at the object
+		// containing it
+		if property, ok := verr.Details()["property"].(string); ok &&
+			verr.Type() == "additional_property_not_allowed" {
+			path = append(path, property)
+		}
+		if node := findNode(doc, path); node != nil && node.Line > 0 {
+			problem.Line = node.Line
+			problem.Column = node.Column
+			if node.Line <= len(lines) {
+				problem.Snippet = strings.TrimRight(lines[node.Line-1], " \t\r")
+			}
+		}
+		problems[i] = problem
+	}
+	return problems
+}
+
+// findNode returns the node of the provided YAML document found by following
+// the provided path of mapping keys and sequence indices. If the path cannot
+// be followed in its entirety, the deepest node that could be found is
+// returned. If the document is nil, nil is returned.
+func findNode(doc *yaml.Node, path []string) *yaml.Node {
+	if doc == nil {
+		return nil
+	}
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for i, segment := range path {
+		if node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value != segment {
+					continue
+				}
+				// A field is best identified by its key, but its value must be
+				// descended into to find any field within it
+				if i == len(path)-1 {
+					next = node.Content[j]
+				} else {
+					next = node.Content[j+1]
+				}
+				break
+			}
+		case yaml.SequenceNode:
+			if index, err := strconv.Atoi(segment); err == nil &&
+				index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node
+}
@@ -0,0 +1,69 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigProblems(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     string
+		assertions func(*testing.T, []ConfigProblem)
+	}{
+		{
+			name: "unexpected property",
+			config: `configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  bogus: true
+`,
+			assertions: func(t *testing.T, problems []ConfigProblem) {
+				require.Len(t, problems, 1)
+				require.Equal(t, "branchConfigs.0", problems[0].Field)
+				require.Equal(t, 4, problems[0].Line)
+				require.Equal(t, 3, problems[0].Column)
+				require.Equal(t, "  bogus: true", problems[0].Snippet)
+			},
+		},
+		{
+			name: "invalid value",
+			config: `configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  prs:
+    enabled: "yes"
+`,
+			assertions: func(t *testing.T, problems []ConfigProblem) {
+				require.Len(t, problems, 1)
+				require.Equal(t, "branchConfigs.0.prs.enabled", problems[0].Field)
+				require.Equal(t, 5, problems[0].Line)
+				require.Equal(t, `    enabled: "yes"`, problems[0].Snippet)
+			},
+		},
+		{
+			name:   "JSON",
+			config: "{\n  \"configVersion\": \"v1alpha1\",\n  \"bogus\": true\n}",
+			assertions: func(t *testing.T, problems []ConfigProblem) {
+				require.Len(t, problems, 1)
+				require.Empty(t, problems[0].Field)
+				require.Equal(t, 3, problems[0].Line)
+				require.Equal(t, `  "bogus": true`, problems[0].Snippet)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := normalizeAndValidate(
+				"kargo-render.yaml",
+				[]byte(testCase.config),
+			)
+			require.Error(t, err)
+			var invalidErr *InvalidConfigError
+			require.ErrorAs(t, err, &invalidErr)
+			require.Equal(t, "kargo-render.yaml", invalidErr.File)
+			testCase.assertions(t, invalidErr.Problems)
+		})
+	}
+}
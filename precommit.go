@@ -0,0 +1,79 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CommitSummary describes the changes that are about to be committed to the
+// commit branch in response to a request. It is passed to
+// ServiceOptions.PreCommitHook.
+type CommitSummary struct {
+	// RequestID is the ID of the request, if it specified one.
+	RequestID string
+	// RepoURL is the URL of the remote repository.
+	RepoURL string
+	// TargetBranch is the name of the target branch.
+	TargetBranch string
+	// CommitBranch is the name of the branch the changes are committed to. It
+	// differs from TargetBranch when the changes are proposed by a pull
+	// request.
+	CommitBranch string
+	// CommitMessage is the message of the commit.
+	CommitMessage string
+	// SourceCommit is the ID of the source commit that was rendered.
+	SourceCommit string
+	// Paths are the paths, relative to the root of the commit branch, of every
+	// file that is added, modified, or deleted by the commit, in order.
+	Paths []string
+	// BranchMetadata is Kargo Render's metadata for the branch, as it will be
+	// committed. It is nil if the repository stores branch metadata outside of
+	// the branch.
+	BranchMetadata []byte
+	// WorkingDir is the path to the working tree of the commit branch. Files
+	// written to it, or removed from it, by the hook are included in the
+	// commit.
+	WorkingDir string
+}
+
+// runPreCommitHook invokes the service's preCommitHook, if one was specified,
+// with a CommitSummary of the changes that are staged for commit, then stages
+// any changes the hook made to the working tree. If the hook returns an error,
+// a CommitVetoedError is returned.
+func (s *service) runPreCommitHook(ctx context.Context, rc requestContext) error {
+	if s.preCommitHook == nil {
+		return nil
+	}
+	paths, err := rc.repo.GetStagedDiffPaths(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for diffs: %w", err)
+	}
+	mdBytes, err := os.ReadFile(
+		filepath.Join(rc.repo.WorkingDir(), branchMetadataPath),
+	)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading branch metadata: %w", err)
+	}
+	if err = s.preCommitHook(ctx, CommitSummary{
+		RequestID:      rc.request.ID,
+		RepoURL:        rc.request.RepoURL,
+		TargetBranch:   rc.request.TargetBranch,
+		CommitBranch:   rc.target.commit.branch,
+		CommitMessage:  rc.target.commit.message,
+		SourceCommit:   rc.source.commit,
+		Paths:          paths,
+		BranchMetadata: mdBytes,
+		WorkingDir:     rc.repo.WorkingDir(),
+	}); err != nil {
+		return &CommitVetoedError{
+			TargetBranch: rc.request.TargetBranch,
+			Err:          err,
+		}
+	}
+	if err = rc.repo.AddAll(ctx); err != nil {
+		return fmt.Errorf("error staging changes made by pre-commit hook: %w", err)
+	}
+	return nil
+}
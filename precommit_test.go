@@ -0,0 +1,137 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestPreCommitHook(t *testing.T) {
+	errVetoed := errors.New("no deployment ticket")
+	testCases := []struct {
+		name       string
+		hook       func(context.Context, CommitSummary) error
+		assertions func(t *testing.T, originDir string, res Response, err error)
+	}{
+		{
+			name: "hook vetoes commit",
+			hook: func(context.Context, CommitSummary) error {
+				return errVetoed
+			},
+			assertions: func(t *testing.T, originDir string, _ Response, err error) {
+				vetoedErr := &CommitVetoedError{}
+				require.ErrorAs(t, err, &vetoedErr)
+				require.Equal(t, "env/dev", vetoedErr.TargetBranch)
+				require.ErrorIs(t, err, errVetoed)
+				// Nothing was pushed but the empty branch that was created
+				cmd := exec.Command("git", "log", "--format=%s", "env/dev")
+				cmd.Dir = originDir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+				require.NotContains(t, string(out), "Render env/dev")
+			},
+		},
+		{
+			name: "hook injects file",
+			hook: func(_ context.Context, summary CommitSummary) error {
+				if summary.TargetBranch != "env/dev" ||
+					summary.CommitBranch != "env/dev" ||
+					!strings.HasPrefix(summary.CommitMessage, "Render env/dev") ||
+					summary.SourceCommit == "" {
+					return errors.New("unexpected summary")
+				}
+				if !strings.Contains(string(summary.BranchMetadata), summary.SourceCommit) {
+					return errors.New("branch metadata does not describe source commit")
+				}
+				found := false
+				for _, path := range summary.Paths {
+					found = found || path == "foo/foo-configmap.yaml"
+				}
+				if !found {
+					return errors.New("rendered manifests are not among paths")
+				}
+				return os.WriteFile(
+					filepath.Join(summary.WorkingDir, "TICKET"),
+					[]byte("OPS-123"),
+					0600,
+				)
+			},
+			assertions: func(t *testing.T, originDir string, res Response, err error) {
+				require.NoError(t, err)
+				require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+				cmd := exec.Command("git", "show", res.CommitID+":TICKET")
+				cmd.Dir = originDir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+				require.Equal(t, "OPS-123", string(out))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			originDir := t.TempDir()
+			srcDir := t.TempDir()
+			git := func(dir string, arg ...string) {
+				cmd := exec.Command("git", arg...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				require.NoError(t, err, string(out))
+			}
+			git(originDir, "init", "-q", "--bare", "-b", "main")
+			git(srcDir, "init", "-q", "-b", "main")
+			git(srcDir, "config", "user.name", "Test")
+			git(srcDir, "config", "user.email", "test@example.com")
+			git(srcDir, "remote", "add", "origin", originDir)
+			require.NoError(
+				t,
+				os.WriteFile(
+					filepath.Join(srcDir, "kargo-render.yaml"),
+					[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+					0600,
+				),
+			)
+			git(srcDir, "add", ".")
+			git(srcDir, "commit", "-q", "-m", "initial commit")
+			git(srcDir, "push", "-q", "origin", "main")
+
+			s, ok := NewService(
+				&ServiceOptions{PreCommitHook: testCase.hook},
+			).(*service)
+			require.True(t, ok)
+			s.renderFn = func(
+				context.Context,
+				string,
+				argocd.ConfigManagementConfig,
+				*commandTrace,
+			) ([]byte, error) {
+				return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+			}
+			res, err := s.RenderManifests(
+				context.Background(),
+				&Request{
+					LocalInPath:   srcDir,
+					TargetBranch:  "env/dev",
+					CommitMessage: "Render env/dev",
+					// Last-mile rendering requires kustomize
+					Options: map[string]string{OptionSkipLastMile: "true"},
+				},
+			)
+			testCase.assertions(t, originDir, res, err)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+// preRenderCache holds the manifests pre-rendered for apps while handling a
+// single logical request that renders into more than one branch, so that apps
+// configured identically for several branches are pre-rendered only once. It
+// is safe for concurrent use. Concurrent lookups of the same key wait for a
+// single pre-render instead of each performing their own.
+type preRenderCache struct {
+	mu      sync.Mutex
+	entries map[string]*preRenderCacheEntry
+}
+
+// preRenderCacheEntry is the eventual result of pre-rendering an app. done is
+// closed once manifests and err are set.
+type preRenderCacheEntry struct {
+	done      chan struct{}
+	manifests []byte
+	err       error
+}
+
+func newPreRenderCache() *preRenderCache {
+	return &preRenderCache{
+		entries: map[string]*preRenderCacheEntry{},
+	}
+}
+
+// preRenderCacheKey returns a key identifying the manifests pre-rendered from
+// the specified source commit using the provided configuration. Input other
+// than the source commit, such as overlays, must not be present in the
+// workspace, or the key does not identify the manifests reliably.
+func preRenderCacheKey(
+	sourceCommit string,
+	cfg argocd.ConfigManagementConfig,
+) (string, error) {
+	cfgBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf(
+			"error marshaling configuration management config: %w",
+			err,
+		)
+	}
+	hash := sha256.New()
+	hash.Write([]byte(sourceCommit))
+	hash.Write([]byte{0})
+	hash.Write(cfgBytes)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// get returns the manifests cached under the specified key, calling the
+// provided function to pre-render them if they are not cached yet. It also
+// returns whether the manifests were pre-rendered by an earlier call. Errors
+// are not cached, so a later call for the same key tries again. Callers must
+// not modify the returned manifests, which are shared.
+func (c *preRenderCache) get(
+	key string,
+	preRender func() ([]byte, error),
+) ([]byte, bool, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		<-entry.done
+		return entry.manifests, true, entry.err
+	}
+	entry := &preRenderCacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	entry.manifests, entry.err = preRender()
+	if entry.err != nil {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+	}
+	close(entry.done)
+	return entry.manifests, false, entry.err
+}
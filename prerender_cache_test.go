@@ -0,0 +1,115 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestPreRenderCache(t *testing.T) {
+	cache := newPreRenderCache()
+	var calls atomic.Int32
+	preRender := func() ([]byte, error) {
+		calls.Add(1)
+		return []byte("kind: ConfigMap\n"), nil
+	}
+
+	// Concurrent lookups of the same key pre-render only once
+	wg := sync.WaitGroup{}
+	var hits atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			manifests, hit, err := cache.get("foo", preRender)
+			require.NoError(t, err)
+			require.Equal(t, "kind: ConfigMap\n", string(manifests))
+			if hit {
+				hits.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), calls.Load())
+	require.Equal(t, int32(9), hits.Load())
+
+	// Errors are not cached
+	_, hit, err := cache.get("bar", func() ([]byte, error) {
+		return nil, errors.New("something went wrong")
+	})
+	require.ErrorContains(t, err, "something went wrong")
+	require.False(t, hit)
+	_, hit, err = cache.get("bar", preRender)
+	require.NoError(t, err)
+	require.False(t, hit)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestPreRenderSharesCache(t *testing.T) {
+	var calls atomic.Int32
+	s := &service{
+		renderFn: func(
+			_ context.Context,
+			_ string,
+			cfg argocd.ConfigManagementConfig,
+			_ *commandTrace,
+		) ([]byte, error) {
+			calls.Add(1)
+			return []byte("path: " + cfg.Path + "\n"), nil
+		},
+	}
+	cache := newPreRenderCache()
+	newRC := func(appConfigs map[string]appConfig) requestContext {
+		rc := requestContext{
+			logger:  log.NewEntry(log.New()),
+			request: &Request{preRenderCache: cache},
+			timings: &timings{},
+		}
+		rc.source.commit = "abc123"
+		rc.target.branchConfig.AppConfigs = appConfigs
+		return rc
+	}
+
+	manifests, err := s.preRender(
+		context.Background(),
+		newRC(map[string]appConfig{
+			"foo": {ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"}},
+			"bar": {ConfigManagement: argocd.ConfigManagementConfig{Path: "bar/dev"}},
+		}),
+		t.TempDir(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "path: bar/dev\n", string(manifests["bar"]))
+	require.Equal(t, int32(2), calls.Load())
+
+	// Only the app configured differently for the second branch is
+	// pre-rendered again
+	manifests, err = s.preRender(
+		context.Background(),
+		newRC(map[string]appConfig{
+			"foo": {ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"}},
+			"bar": {ConfigManagement: argocd.ConfigManagementConfig{Path: "bar/prod"}},
+		}),
+		t.TempDir(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "path: foo\n", string(manifests["foo"]))
+	require.Equal(t, "path: bar/prod\n", string(manifests["bar"]))
+	require.Equal(t, int32(3), calls.Load())
+
+	// Nothing is shared by branches with overlays
+	rc := newRC(map[string]appConfig{
+		"foo": {ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"}},
+	})
+	rc.target.branchConfig.Overlays = []overlayConfig{{}}
+	_, err = s.preRender(context.Background(), rc, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, int32(4), calls.Load())
+}
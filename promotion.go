@@ -0,0 +1,99 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// checkPromotionOrder returns a PromotionOrderError if the provided repository
+// configuration specifies a promotion order in which the target branch is
+// preceded by a branch into which the source commit has not yet been rendered.
+// The source commit is considered to have been rendered into the preceding
+// branch if that branch was most recently rendered from the source commit or
+// from any of its descendants, so a commit may still be promoted after newer
+// commits have been rendered into the preceding branch.
+func checkPromotionOrder(
+	ctx context.Context,
+	rc requestContext,
+	cfg *repoConfig,
+) error {
+	if rc.request.SkipPromotionOrder {
+		return nil
+	}
+	predecessor := cfg.predecessor(rc.request.TargetBranch)
+	if predecessor == "" {
+		return nil
+	}
+	promotionErr := &PromotionOrderError{
+		Commit:       rc.source.commit,
+		TargetBranch: rc.request.TargetBranch,
+		Predecessor:  predecessor,
+	}
+	exists, err := rc.repo.RemoteBranchExists(ctx, predecessor)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return promotionErr
+	}
+	predecessorRev := fmt.Sprintf("%s/%s", git.RemoteOrigin, predecessor)
+	storedMD, err := readStoredBranchMetadata(
+		ctx,
+		rc.repo,
+		cfg.metadataStorage(),
+		predecessor,
+		predecessorRev,
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"error reading metadata of branch %q: %w",
+			predecessor,
+			err,
+		)
+	}
+	md := branchMetadata{}
+	if storedMD != nil {
+		md = *storedMD
+	} else {
+		mdBytes, err := rc.repo.ReadFileAtCommit(
+			ctx,
+			predecessorRev,
+			".kargo-render/metadata.yaml",
+		)
+		if errors.Is(err, fs.ErrNotExist) {
+			return promotionErr
+		}
+		if err != nil {
+			return fmt.Errorf(
+				"error reading metadata of branch %q: %w",
+				predecessor,
+				err,
+			)
+		}
+		if err = yaml.Unmarshal(mdBytes, &md); err != nil {
+			return fmt.Errorf(
+				"error unmarshaling metadata of branch %q: %w",
+				predecessor,
+				err,
+			)
+		}
+	}
+	if md.SourceCommit == "" {
+		return promotionErr
+	}
+	promotionErr.PredecessorCommit = md.SourceCommit
+	promoted, err := rc.repo.IsAncestor(ctx, rc.source.commit, md.SourceCommit)
+	if err != nil {
+		return err
+	}
+	if !promoted {
+		return promotionErr
+	}
+	return nil
+}
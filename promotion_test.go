@@ -0,0 +1,160 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// fakePromotionRepo is a git.Repo with a single remote branch whose metadata
+// records the specified source commit.
+type fakePromotionRepo struct {
+	git.Repo
+	branch       string
+	sourceCommit string
+	// ancestors maps commit IDs to the IDs of their ancestors.
+	ancestors map[string][]string
+}
+
+func (f *fakePromotionRepo) RemoteBranchExists(
+	_ context.Context,
+	branch string,
+) (bool, error) {
+	return branch == f.branch, nil
+}
+
+func (f *fakePromotionRepo) ReadFileAtCommit(
+	_ context.Context,
+	id string,
+	path string,
+) ([]byte, error) {
+	if id != "origin/"+f.branch || f.sourceCommit == "" {
+		return nil, fmt.Errorf("error reading %q: %w", path, fs.ErrNotExist)
+	}
+	return []byte(fmt.Sprintf("sourceCommit: %s\n", f.sourceCommit)), nil
+}
+
+func (f *fakePromotionRepo) IsAncestor(
+	_ context.Context,
+	ancestor string,
+	descendant string,
+) (bool, error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+	for _, id := range f.ancestors[descendant] {
+		if id == ancestor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestCheckPromotionOrder(t *testing.T) {
+	cfg := &repoConfig{
+		PromotionOrder: []string{"env/dev", "env/stage", "env/prod"},
+	}
+	testCases := []struct {
+		name         string
+		targetBranch string
+		skip         bool
+		repo         *fakePromotionRepo
+		assertions   func(*testing.T, error)
+	}{
+		{
+			name:         "first branch in promotion order",
+			targetBranch: "env/dev",
+			repo:         &fakePromotionRepo{},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "branch not in promotion order",
+			targetBranch: "env/test",
+			repo:         &fakePromotionRepo{},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "predecessor does not exist",
+			targetBranch: "env/stage",
+			repo:         &fakePromotionRepo{},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				promotionErr := &PromotionOrderError{}
+				require.ErrorAs(t, err, &promotionErr)
+				require.Equal(t, "env/dev", promotionErr.Predecessor)
+				require.Contains(t, err.Error(), "has not been rendered yet")
+			},
+		},
+		{
+			name:         "predecessor rendered from source commit",
+			targetBranch: "env/prod",
+			repo: &fakePromotionRepo{
+				branch:       "env/stage",
+				sourceCommit: "fake-commit",
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "predecessor rendered from newer commit",
+			targetBranch: "env/prod",
+			repo: &fakePromotionRepo{
+				branch:       "env/stage",
+				sourceCommit: "newer-commit",
+				ancestors: map[string][]string{
+					"newer-commit": {"fake-commit"},
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:         "predecessor rendered from unrelated commit",
+			targetBranch: "env/prod",
+			repo: &fakePromotionRepo{
+				branch:       "env/stage",
+				sourceCommit: "older-commit",
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				promotionErr := &PromotionOrderError{}
+				require.ErrorAs(t, err, &promotionErr)
+				require.Equal(t, "env/stage", promotionErr.Predecessor)
+				require.Equal(t, "older-commit", promotionErr.PredecessorCommit)
+			},
+		},
+		{
+			name:         "promotion order skipped",
+			targetBranch: "env/prod",
+			skip:         true,
+			repo:         &fakePromotionRepo{},
+			assertions: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rc := requestContext{
+				request: &Request{
+					TargetBranch:       testCase.targetBranch,
+					SkipPromotionOrder: testCase.skip,
+				},
+				repo: testCase.repo,
+			}
+			rc.source.commit = "fake-commit"
+			testCase.assertions(t, checkPromotionOrder(context.Background(), rc, cfg))
+		})
+	}
+}
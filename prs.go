@@ -1,15 +1,20 @@
 package render
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
+	"text/template"
 
 	"github.com/akuity/kargo-render/internal/github"
-	"github.com/akuity/kargo-render/pkg/git"
 )
 
-func openPR(ctx context.Context, rc requestContext) (string, error) {
+// defaultPRBody is the body of pull requests opened by Kargo Render when the
+// request does not specify a template for it.
+const defaultPRBody = "See individual commit messages for details."
+
+func (s *service) openPR(ctx context.Context, rc requestContext) (string, error) {
 	commitMsgParts := strings.SplitN(rc.target.commit.message, "\n", 2)
 	var title string
 	if rc.target.branchConfig.PRs.UseUniqueBranchNames {
@@ -20,6 +25,42 @@ func openPR(ctx context.Context, rc requestContext) (string, error) {
 		title =
 			fmt.Sprintf("%s <-- latest batched changes", rc.request.TargetBranch)
 	}
+	body := defaultPRBody
+	if trailers := sourceTrailers(rc.request.Source); len(trailers) > 0 {
+		body = fmt.Sprintf("%s\n\n%s", body, strings.Join(trailers, "  \n"))
+	}
+	prOpts := &github.PROptions{
+		Reviewers:     rc.target.branchConfig.PRs.Reviewers,
+		TeamReviewers: rc.target.branchConfig.PRs.TeamReviewers,
+	}
+
+	if prConfig := rc.request.PullRequest; prConfig != nil {
+		data := PullRequestTemplateData{
+			TargetBranch:  rc.request.TargetBranch,
+			CommitBranch:  rc.target.commit.branch,
+			SourceCommit:  rc.source.commit,
+			CommitMessage: rc.target.commit.message,
+			CommitSubject: commitMsgParts[0],
+		}
+		if rc.request.Source != nil {
+			data.Source = *rc.request.Source
+		}
+		var err error
+		if prConfig.TitleTemplate != "" {
+			if title, err = renderPRTemplate(prConfig.TitleTemplate, data); err != nil {
+				return "", fmt.Errorf("error rendering pull request title: %w", err)
+			}
+			// Titles are a single line
+			title = strings.Join(strings.Fields(title), " ")
+		}
+		if prConfig.BodyTemplate != "" {
+			if body, err = renderPRTemplate(prConfig.BodyTemplate, data); err != nil {
+				return "", fmt.Errorf("error rendering pull request body: %w", err)
+			}
+		}
+		prOpts.Labels = prConfig.Labels
+		prOpts.Draft = prConfig.Draft
+	}
 
 	// TODO: Support git providers other than GitHub.
 	//
@@ -32,21 +73,83 @@ func openPR(ctx context.Context, rc requestContext) (string, error) {
 	// * Other?
 	url, err := github.OpenPR(
 		ctx,
-		rc.request.RepoURL,
+		rc.request.pushURL(),
 		title,
-		"See individual commit messages for details.",
+		body,
 		rc.request.TargetBranch,
 		rc.target.commit.branch,
-		git.RepoCredentials{
-			Username: rc.request.RepoCreds.Username,
-			Password: rc.request.RepoCreds.Password,
-		},
+		rc.request.RepoCreds.gitCreds().ForWriting(),
+		prOpts,
+		s.githubClientOptions(rc.logger),
 	)
 	// TODO: Catch specific errors that have to do with an open PR already being
 	// associated with the target branch
+	if err != nil && url != "" {
+		// The PR was opened, but could not be labeled or have reviewers
+		// requested. Failing now would leave it behind without a response
+		// that points to it.
+		rc.logger.WithError(err).WithField("prURL", url).
+			Warn("error decorating pull request")
+		return url, nil
+	}
 	if err != nil {
 		return "",
 			fmt.Errorf("error opening pull request to the target branch: %w", err)
 	}
 	return url, nil
 }
+
+// prLimitActionUpdateOldest is the value of a branch's OnMaxOpen PR setting
+// that causes changes to be added to the oldest open PR when no more PRs may
+// be opened.
+const prLimitActionUpdateOldest = "updateOldest"
+
+// checkOpenPRLimit returns a TooManyOpenPRsError if opening another PR to the
+// target branch would exceed the limit in the branch's configuration, unless
+// the configuration says to update the oldest open PR instead, in which case
+// that PR is returned. If opening another PR is permitted, nil is returned.
+func (s *service) checkOpenPRLimit(
+	ctx context.Context,
+	rc requestContext,
+) (*github.PR, error) {
+	prs := rc.target.branchConfig.PRs
+	if !prs.Enabled || !prs.UseUniqueBranchNames || prs.MaxOpen <= 0 ||
+		!rc.request.writesToRemote() {
+		return nil, nil
+	}
+	open, err := s.listOpenPRsFn(
+		ctx,
+		rc.request.pushURL(),
+		rc.request.TargetBranch,
+		commitBranchPrefix(rc),
+		rc.request.RepoCreds.gitCreds().ForReading(),
+		s.githubClientOptions(rc.logger),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing open pull requests: %w", err)
+	}
+	if len(open) < prs.MaxOpen {
+		return nil, nil
+	}
+	if prs.OnMaxOpen == prLimitActionUpdateOldest {
+		return &open[0], nil
+	}
+	return nil, &TooManyOpenPRsError{
+		TargetBranch: rc.request.TargetBranch,
+		Open:         len(open),
+		Max:          prs.MaxOpen,
+	}
+}
+
+// renderPRTemplate executes the provided template using the provided data.
+func renderPRTemplate(tmpl string, data PullRequestTemplateData) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
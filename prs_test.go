@@ -0,0 +1,149 @@
+package render
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/github"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+func TestRenderPRTemplate(t *testing.T) {
+	data := PullRequestTemplateData{
+		TargetBranch:  "env/prod",
+		CommitBranch:  "kargo-render/env/prod",
+		SourceCommit:  "1234567",
+		CommitMessage: "render 1234567\n\nmore details",
+		CommitSubject: "render 1234567",
+		Source:        SourceContext{RunURL: "https://ci.example.com/runs/1"},
+	}
+	testCases := []struct {
+		name       string
+		tmpl       string
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name: "success",
+			tmpl: "{{ .TargetBranch }} <-- {{ .CommitSubject }}\n",
+			assertions: func(t *testing.T, rendered string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env/prod <-- render 1234567", rendered)
+			},
+		},
+		{
+			name: "source",
+			tmpl: "Promoted by {{ .Source.RunURL }}",
+			assertions: func(t *testing.T, rendered string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Promoted by https://ci.example.com/runs/1", rendered)
+			},
+		},
+		{
+			name: "unknown field",
+			tmpl: "{{ .Nope }}",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rendered, err := renderPRTemplate(testCase.tmpl, data)
+			testCase.assertions(t, rendered, err)
+		})
+	}
+}
+
+func TestCheckOpenPRLimit(t *testing.T) {
+	openPRs := []github.PR{
+		{Number: 1, HeadBranch: "prs/kargo-render/oldest"},
+		{Number: 2, HeadBranch: "prs/kargo-render/newest"},
+	}
+	testCases := []struct {
+		name       string
+		prs        pullRequestConfig
+		assertions func(*testing.T, *github.PR, error)
+	}{
+		{
+			name: "no limit",
+			prs:  pullRequestConfig{Enabled: true, UseUniqueBranchNames: true},
+			assertions: func(t *testing.T, pr *github.PR, err error) {
+				require.NoError(t, err)
+				require.Nil(t, pr)
+			},
+		},
+		{
+			name: "limit not reached",
+			prs: pullRequestConfig{
+				Enabled:              true,
+				UseUniqueBranchNames: true,
+				MaxOpen:              3,
+			},
+			assertions: func(t *testing.T, pr *github.PR, err error) {
+				require.NoError(t, err)
+				require.Nil(t, pr)
+			},
+		},
+		{
+			name: "limit reached",
+			prs: pullRequestConfig{
+				Enabled:              true,
+				UseUniqueBranchNames: true,
+				MaxOpen:              2,
+			},
+			assertions: func(t *testing.T, _ *github.PR, err error) {
+				tooManyErr := &TooManyOpenPRsError{}
+				require.ErrorAs(t, err, &tooManyErr)
+				require.Equal(
+					t,
+					&TooManyOpenPRsError{TargetBranch: "env/prod", Open: 2, Max: 2},
+					tooManyErr,
+				)
+			},
+		},
+		{
+			name: "limit reached with updating the oldest configured",
+			prs: pullRequestConfig{
+				Enabled:              true,
+				UseUniqueBranchNames: true,
+				MaxOpen:              2,
+				OnMaxOpen:            prLimitActionUpdateOldest,
+			},
+			assertions: func(t *testing.T, pr *github.PR, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &openPRs[0], pr)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := &service{
+				listOpenPRsFn: func(
+					_ context.Context,
+					_ string,
+					targetBranch string,
+					headBranchPrefix string,
+					_ git.RepoCredentials,
+					_ *github.ClientOptions,
+				) ([]github.PR, error) {
+					require.Equal(t, "env/prod", targetBranch)
+					require.Equal(t, "prs/kargo-render/", headBranchPrefix)
+					return openPRs, nil
+				},
+			}
+			rc := requestContext{
+				logger: log.NewEntry(log.New()),
+				request: &Request{
+					RepoURL:      "https://github.com/akuity/kargo-render-demo",
+					TargetBranch: "env/prod",
+				},
+			}
+			rc.target.branchConfig.PRs = testCase.prs
+			pr, err := s.checkOpenPRLimit(context.Background(), rc)
+			testCase.assertions(t, pr, err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akuity/kargo-render/internal/github"
+)
+
+// pushViaAPI recreates every commit to the commit branch that has not yet
+// been pushed to the remote repository using the git provider's API and
+// returns the ID of the last commit created.
+func (s *service) pushViaAPI(ctx context.Context, rc requestContext) (string, error) {
+	ids, err := rc.repo.UnpushedCommitIDs(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		// Nothing to push
+		return rc.repo.LastCommitID(ctx)
+	}
+	parent, err := rc.repo.ParentCommitID(ctx, ids[0])
+	if err != nil {
+		return "", err
+	}
+	commits := make([]github.Commit, len(ids))
+	for i, id := range ids {
+		commit := github.Commit{Files: map[string][]byte{}}
+		if commit.Message, err = rc.repo.FullCommitMessage(ctx, id); err != nil {
+			return "", err
+		}
+		if author := rc.request.CommitAuthor; author != nil {
+			commit.AuthorName = author.Name
+			commit.AuthorEmail = author.Email
+		}
+		changes, err := rc.repo.CommitChanges(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		for _, change := range changes {
+			if change.Deleted {
+				commit.Deleted = append(commit.Deleted, change.Path)
+				continue
+			}
+			if commit.Files[change.Path], err =
+				rc.repo.ReadFileAtCommit(ctx, id, change.Path); err != nil {
+				return "", err
+			}
+		}
+		commits[i] = commit
+	}
+	id, err := s.pushCommitsFn(
+		ctx,
+		rc.request.pushURL(),
+		rc.target.commit.branch,
+		parent,
+		commits,
+		rc.request.RepoCreds.gitCreds().ForWriting(),
+		s.githubClientOptions(rc.logger),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error creating commits via API: %w", err)
+	}
+	rc.logger.WithField("commits", len(commits)).
+		Debug("created commits via API")
+	return id, nil
+}
@@ -0,0 +1,145 @@
+package render
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/github"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// fakeUnpushedRepo is a git.Repo with the specified unpushed commits, each of
+// which is described by the files it added, modified, or deleted (nil
+// contents).
+type fakeUnpushedRepo struct {
+	git.Repo
+	parent  string
+	ids     []string
+	commits map[string]map[string][]byte
+}
+
+func (f *fakeUnpushedRepo) UnpushedCommitIDs(context.Context) ([]string, error) {
+	return f.ids, nil
+}
+
+func (f *fakeUnpushedRepo) ParentCommitID(context.Context, string) (string, error) {
+	return f.parent, nil
+}
+
+func (f *fakeUnpushedRepo) FullCommitMessage(
+	_ context.Context,
+	id string,
+) (string, error) {
+	return "message for " + id, nil
+}
+
+func (f *fakeUnpushedRepo) CommitChanges(
+	_ context.Context,
+	id string,
+) ([]git.FileChange, error) {
+	changes := []git.FileChange{}
+	for path, contents := range f.commits[id] {
+		changes = append(changes, git.FileChange{Path: path, Deleted: contents == nil})
+	}
+	return changes, nil
+}
+
+func (f *fakeUnpushedRepo) ReadFileAtCommit(
+	_ context.Context,
+	id string,
+	path string,
+) ([]byte, error) {
+	contents, ok := f.commits[id][path]
+	if !ok || contents == nil {
+		return nil, fs.ErrNotExist
+	}
+	return contents, nil
+}
+
+func TestPushViaAPI(t *testing.T) {
+	repo := &fakeUnpushedRepo{
+		parent: "abc",
+		ids:    []string{"def", "ghi"},
+		commits: map[string]map[string][]byte{
+			"def": {"foo/all.yaml": []byte("foo")},
+			"ghi": {"foo/all.yaml": nil, "bar/all.yaml": []byte("bar")},
+		},
+	}
+	var pushedRepoURL, pushedBranch, pushedParent string
+	var pushedCommits []github.Commit
+	var pushedCreds git.RepoCredentials
+	var pushedClientOpts *github.ClientOptions
+	s := &service{
+		userAgent:   "kargo-render/v1.2.3",
+		httpHeaders: map[string]string{"X-Audit-Source": "ci"},
+		pushCommitsFn: func(
+			_ context.Context,
+			repoURL string,
+			branch string,
+			parent string,
+			commits []github.Commit,
+			repoCreds git.RepoCredentials,
+			clientOpts *github.ClientOptions,
+		) (string, error) {
+			pushedRepoURL = repoURL
+			pushedBranch = branch
+			pushedParent = parent
+			pushedCommits = commits
+			pushedCreds = repoCreds
+			pushedClientOpts = clientOpts
+			return "jkl", nil
+		},
+	}
+	rc := requestContext{
+		logger: log.NewEntry(log.New()),
+		request: &Request{
+			RepoURL: "https://mirror.example.com/akuity/gitops",
+			PushURL: "https://github.com/akuity/gitops",
+			RepoCreds: RepoCredentials{
+				Password:   "read-token",
+				WriteCreds: &RepoCredentials{Password: "write-token"},
+			},
+			CommitAuthor: &CommitAuthor{Name: "Jane Doe", Email: "jane@example.com"},
+		},
+		repo: repo,
+	}
+	rc.target.commit.branch = "env/dev"
+
+	id, err := s.pushViaAPI(context.Background(), rc)
+	require.NoError(t, err)
+	require.Equal(t, "jkl", id)
+	// Commits are created in the repository that is pushed to
+	require.Equal(t, "https://github.com/akuity/gitops", pushedRepoURL)
+	require.Equal(t, "env/dev", pushedBranch)
+	require.Equal(t, "abc", pushedParent)
+	require.Equal(t, "write-token", pushedCreds.Password)
+	require.Equal(t, "kargo-render/v1.2.3", pushedClientOpts.UserAgent)
+	require.Equal(
+		t,
+		map[string]string{"X-Audit-Source": "ci"},
+		pushedClientOpts.Headers,
+	)
+	require.Equal(
+		t,
+		[]github.Commit{
+			{
+				Message:     "message for def",
+				AuthorName:  "Jane Doe",
+				AuthorEmail: "jane@example.com",
+				Files:       map[string][]byte{"foo/all.yaml": []byte("foo")},
+			},
+			{
+				Message:     "message for ghi",
+				AuthorName:  "Jane Doe",
+				AuthorEmail: "jane@example.com",
+				Files:       map[string][]byte{"bar/all.yaml": []byte("bar")},
+				Deleted:     []string{"foo/all.yaml"},
+			},
+		},
+		pushedCommits,
+	)
+}
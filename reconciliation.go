@@ -0,0 +1,117 @@
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReconciliationTarget identifies an environment-specific branch that should be
+// periodically re-rendered from its recorded source commit.
+type ReconciliationTarget struct {
+	// RepoURL is the URL of a remote GitOps repository.
+	RepoURL string `json:"repoURL"`
+	// RepoCreds encapsulates read/write credentials for the remote GitOps
+	// repository referenced by the RepoURL field.
+	RepoCreds RepoCredentials `json:"repoCreds,omitempty"`
+	// TargetBranch is the name of the environment-specific branch to reconcile.
+	TargetBranch string `json:"targetBranch"`
+	// Schedule is a standard, five field cron expression (or a descriptor such
+	// as "@hourly") indicating when the branch should be reconciled.
+	Schedule string `json:"schedule"`
+}
+
+// Reconciler periodically re-renders environment-specific branches from the
+// source commits recorded in their metadata. Any drift, such as manual edits
+// to a branch, is corrected by committing the re-rendered manifests using the
+// branch's normal configuration (i.e. directly or via PR). This is akin to
+// Argo CD's self-heal feature, but applied at the git layer.
+type Reconciler struct {
+	svc     Service
+	logger  *log.Logger
+	targets []ReconciliationTarget
+}
+
+// NewReconciler returns a Reconciler that uses the provided Service to
+// reconcile the specified targets.
+func NewReconciler(
+	svc Service,
+	targets []ReconciliationTarget,
+	opts *ServiceOptions,
+) *Reconciler {
+	if opts == nil {
+		opts = &ServiceOptions{}
+	}
+	if opts.LogLevel == 0 {
+		opts.LogLevel = LogLevelInfo
+	}
+	logger := log.New()
+	logger.SetLevel(log.Level(opts.LogLevel))
+	return &Reconciler{
+		svc:     svc,
+		logger:  logger,
+		targets: targets,
+	}
+}
+
+// Run reconciles each target on its schedule until the provided context is
+// canceled. An error is returned only if any target's schedule is invalid.
+func (r *Reconciler) Run(ctx context.Context) error {
+	c := cron.New()
+	for _, target := range r.targets {
+		target := target
+		if _, err := c.AddFunc(
+			target.Schedule,
+			func() { r.reconcile(ctx, target) },
+		); err != nil {
+			return fmt.Errorf(
+				"error scheduling reconciliation of branch %q of repo %q: %w",
+				target.TargetBranch,
+				target.RepoURL,
+				err,
+			)
+		}
+	}
+	c.Start()
+	<-ctx.Done()
+	<-c.Stop().Done()
+	return nil
+}
+
+// reconcile re-renders a single target from its recorded source commit.
+// Failures are logged, but are otherwise non-fatal so that the next scheduled
+// reconciliation can be attempted.
+func (r *Reconciler) reconcile(ctx context.Context, target ReconciliationTarget) {
+	logger := r.logger.WithFields(log.Fields{
+		"repo":         target.RepoURL,
+		"targetBranch": target.TargetBranch,
+	})
+	logger.Debug("reconciling branch")
+	res, err := r.svc.RenderManifests(
+		ctx,
+		&Request{
+			RepoURL:   target.RepoURL,
+			RepoCreds: target.RepoCreds,
+			// Rendering from the target branch itself causes the source commit
+			// recorded in the branch's metadata to be used as input.
+			Ref:          target.TargetBranch,
+			TargetBranch: target.TargetBranch,
+			CommitMessage: fmt.Sprintf(
+				"Kargo Render reconciled drift in branch %s",
+				target.TargetBranch,
+			),
+		},
+	)
+	if err != nil {
+		logger.WithError(err).Error("error reconciling branch")
+		return
+	}
+	if res.ActionTaken == ActionTakenNone {
+		logger.Debug("branch has not drifted")
+		return
+	}
+	logger.WithField("actionTaken", res.ActionTaken).
+		Info("corrected drift in branch")
+}
@@ -0,0 +1,54 @@
+package render
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconciler(t *testing.T) {
+	t.Run("invalid schedule", func(t *testing.T) {
+		r := NewReconciler(
+			&mockService{},
+			[]ReconciliationTarget{{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Schedule:     "bogus",
+			}},
+			nil,
+		)
+		err := r.Run(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error scheduling reconciliation")
+	})
+
+	t.Run("reconciles from the target branch", func(t *testing.T) {
+		var calls atomic.Int32
+		var lastReq atomic.Pointer[Request]
+		r := NewReconciler(
+			&mockService{
+				renderFn: func(_ context.Context, req *Request) (Response, error) {
+					calls.Add(1)
+					lastReq.Store(req)
+					return Response{ActionTaken: ActionTakenNone}, nil
+				},
+			},
+			[]ReconciliationTarget{{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Schedule:     "@every 1s",
+			}},
+			nil,
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+		defer cancel()
+		require.NoError(t, r.Run(ctx))
+		require.GreaterOrEqual(t, calls.Load(), int32(1))
+		req := lastReq.Load()
+		require.Equal(t, req.TargetBranch, req.Ref)
+		require.NotEmpty(t, req.CommitMessage)
+	})
+}
@@ -0,0 +1,334 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	libExec "github.com/akuity/kargo-render/internal/exec"
+)
+
+// kustomizationFileNames are the names Kustomize recognizes for kustomization
+// files, in the order it looks for them.
+var kustomizationFileNames = []string{
+	"kustomization.yaml",
+	"kustomization.yml",
+	"Kustomization",
+}
+
+// commitIDRegex matches full IDs (shas) of git commits, using either SHA-1 or
+// SHA-256.
+var commitIDRegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// remoteBaseHosts are hosts that Kustomize recognizes in remote bases that do
+// not specify a scheme, e.g. github.com/example/repo/path?ref=v1.0.0.
+var remoteBaseHosts = []string{
+	"github.com/",
+	"gitlab.com/",
+	"bitbucket.org/",
+}
+
+// kustomization is the subset of a kustomization file that references bases.
+type kustomization struct {
+	Resources  []string `json:"resources,omitempty"`
+	Bases      []string `json:"bases,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// resolveRemoteBases finds the remote bases referenced by the kustomizations
+// of every app in the provided repository that is rendered using Kustomize and resolves the
+// commits that any not pinned to one refer to. If the target branch's
+// configuration requires remote bases to be pinned, an
+// UnpinnedRemoteBaseError is returned for the first that is not, before
+// anything is resolved. Apps are examined in order by name so that the result
+// is deterministic.
+func (s *service) resolveRemoteBases(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+) ([]RemoteBase, error) {
+	appNames := make([]string, 0, len(rc.target.branchConfig.AppConfigs))
+	for appName := range rc.target.branchConfig.AppConfigs {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	var remoteBases []RemoteBase
+	for _, appName := range appNames {
+		cfg := rc.target.branchConfig.AppConfigs[appName].ConfigManagement
+		if cfg.Helm != nil || cfg.Plugin != nil {
+			continue // Not rendered using Kustomize
+		}
+		appRemoteBases, err := findRemoteBases(repoRoot, cfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error finding remote bases of app %q: %w",
+				appName,
+				err,
+			)
+		}
+		for i := range appRemoteBases {
+			appRemoteBases[i].App = appName
+		}
+		remoteBases = append(remoteBases, appRemoteBases...)
+	}
+
+	if kustomizeCfg := rc.target.branchConfig.Kustomize; kustomizeCfg != nil &&
+		kustomizeCfg.RequirePinnedRemoteBases {
+		for _, remoteBase := range remoteBases {
+			if !remoteBase.Pinned {
+				return nil, &UnpinnedRemoteBaseError{
+					TargetBranch: rc.request.TargetBranch,
+					RemoteBase:   remoteBase,
+				}
+			}
+		}
+	}
+
+	for i, remoteBase := range remoteBases {
+		if remoteBase.Pinned || remoteBase.RepoURL == "" {
+			continue
+		}
+		logger := rc.logger.WithField("app", remoteBase.App).
+			WithField("remoteBase", remoteBase.URL)
+		commit, err := s.resolveRemoteRefFn(
+			ctx,
+			remoteBase.RepoURL,
+			remoteBase.Ref,
+			rc.commands,
+		)
+		if err != nil {
+			// Kustomize will report the problem if it cannot fetch the base either
+			logger.WithError(err).Warn("error resolving ref of remote base")
+			continue
+		}
+		remoteBases[i].Commit = commit
+		logger.WithField("commit", commit).Debug("resolved ref of remote base")
+	}
+	return remoteBases, nil
+}
+
+// findRemoteBases returns the remote bases referenced by the kustomization in
+// the specified directory, relative to the root of the provided repository,
+// and by the kustomizations of any local bases it references, directly or
+// indirectly, within the repository. Remote bases are returned in order by
+// kustomization and then by URL.
+func findRemoteBases(repoRoot string, dir string) ([]RemoteBase, error) {
+	visited := map[string]struct{}{}
+	var remoteBases []RemoteBase
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		dir = filepath.Clean(dir)
+		if _, ok := visited[dir]; ok {
+			return nil
+		}
+		visited[dir] = struct{}{}
+		kustomizationPath, k, err := loadKustomization(repoRoot, dir)
+		if err != nil || k == nil {
+			return err
+		}
+		entries := append(append(k.Resources, k.Bases...), k.Components...)
+		for _, entry := range entries {
+			if remoteBase, ok := parseRemoteBase(entry); ok {
+				remoteBase.Kustomization = kustomizationPath
+				remoteBases = append(remoteBases, remoteBase)
+				continue
+			}
+			localDir := filepath.Join(dir, entry)
+			if !filepath.IsLocal(localDir) {
+				continue // Kustomize will refuse this itself
+			}
+			fi, err := os.Stat(filepath.Join(repoRoot, localDir))
+			if err != nil || !fi.IsDir() {
+				continue // A file or something Kustomize will complain about
+			}
+			if err = visit(localDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(dir); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(remoteBases, func(i, j int) bool {
+		if remoteBases[i].Kustomization != remoteBases[j].Kustomization {
+			return remoteBases[i].Kustomization < remoteBases[j].Kustomization
+		}
+		return remoteBases[i].URL < remoteBases[j].URL
+	})
+	return remoteBases, nil
+}
+
+// loadKustomization loads the kustomization file in the specified directory,
+// relative to the root of the provided repository. The path of the file,
+// relative to the root of the repository, is returned along with its content.
+// If the directory contains no kustomization file, a nil kustomization is
+// returned.
+func loadKustomization(
+	repoRoot string,
+	dir string,
+) (string, *kustomization, error) {
+	for _, name := range kustomizationFileNames {
+		path := filepath.Join(dir, name)
+		kustomizationBytes, err := os.ReadFile(filepath.Join(repoRoot, path))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		k := &kustomization{}
+		if err = yaml.Unmarshal(kustomizationBytes, k); err != nil {
+			return "", nil, fmt.Errorf("error unmarshaling %q: %w", path, err)
+		}
+		return filepath.ToSlash(path), k, nil
+	}
+	return "", nil, nil
+}
+
+// parseRemoteBase parses an entry of the resources, bases, or components of a
+// kustomization. If the entry refers to a remote base, or to a remote resource
+// that is a plain file, a RemoteBase describing it is returned along with
+// true. Otherwise, false is returned. The App and Kustomization fields of the
+// returned RemoteBase are not set.
+func parseRemoteBase(entry string) (RemoteBase, bool) {
+	remoteBase := RemoteBase{URL: entry}
+	rest := strings.TrimPrefix(entry, "git::")
+	scheme, hostPath, hasScheme := strings.Cut(rest, "://")
+	if !hasScheme {
+		isRemote := strings.HasPrefix(rest, "git@")
+		for _, host := range remoteBaseHosts {
+			isRemote = isRemote || strings.HasPrefix(rest, host)
+		}
+		if !isRemote {
+			return remoteBase, false
+		}
+		scheme, hostPath = "", rest
+	}
+	hostPath, rawQuery, _ := strings.Cut(hostPath, "?")
+	query, _ := url.ParseQuery(rawQuery)
+
+	// A plain file fetched over HTTP, e.g. from raw.githubusercontent.com, is
+	// pinned only if its path includes a commit ID
+	if (scheme == "http" || scheme == "https") &&
+		!strings.Contains(hostPath, "//") &&
+		!strings.Contains(hostPath, ".git/") &&
+		isManifestFile(hostPath) {
+		for _, part := range strings.Split(hostPath, "/") {
+			remoteBase.Pinned = remoteBase.Pinned || commitIDRegex.MatchString(part)
+		}
+		return remoteBase, true
+	}
+
+	repoPath := hostPath
+	if before, _, ok := strings.Cut(hostPath, "//"); ok {
+		repoPath = before
+	} else if i := strings.Index(hostPath, ".git/"); i >= 0 {
+		repoPath = hostPath[:i+len(".git")]
+	} else {
+		for _, host := range remoteBaseHosts {
+			if strings.HasPrefix(hostPath, host) {
+				// The host is followed by the owner and the name of the repository
+				parts := strings.SplitN(hostPath, "/", 4)
+				repoPath = strings.Join(parts[:min(len(parts), 3)], "/")
+				break
+			}
+		}
+	}
+	switch {
+	case scheme != "":
+		remoteBase.RepoURL = scheme + "://" + repoPath
+	case strings.HasPrefix(repoPath, "git@"):
+		remoteBase.RepoURL = repoPath
+	default:
+		remoteBase.RepoURL = "https://" + repoPath
+	}
+	remoteBase.Ref = query.Get("ref")
+	if remoteBase.Ref == "" {
+		remoteBase.Ref = query.Get("version")
+	}
+	remoteBase.Pinned = commitIDRegex.MatchString(remoteBase.Ref)
+	if remoteBase.Pinned {
+		remoteBase.Commit = remoteBase.Ref
+	}
+	return remoteBase, true
+}
+
+// isManifestFile returns true if the specified path is that of a YAML or JSON
+// file.
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// lsRemote returns the ID (sha) of the commit that the specified ref of the
+// specified remote repository refers to. If the ref is empty, the commit
+// HEAD refers to is returned. Annotated tags are peeled to the commits they
+// refer to. No credentials are used, just as Kustomize uses none to fetch
+// remote bases, and the command inherits only the environment Kustomize may.
+// The command is recorded by the provided commandTrace, if any.
+func lsRemote(
+	ctx context.Context,
+	repoURL string,
+	ref string,
+	toolEnv map[string][]string,
+	timeout time.Duration,
+	trace *commandTrace,
+) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	cmd := exec.Command( // nolint: gosec
+		"git",
+		"ls-remote",
+		"--",
+		repoURL,
+		ref,
+		ref+"^{}",
+	)
+	cmd.Env = append(toolEnviron(toolEnv, "kustomize"), "GIT_TERMINAL_PROMPT=0")
+	res, err := libExec.Exec(
+		ctx,
+		cmd,
+		&libExec.Options{
+			Timeout:  timeout,
+			Observer: trace.observeResult,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	var commit string
+	scanner := bufio.NewScanner(bytes.NewReader(res.Stdout))
+	for scanner.Scan() {
+		id, refName, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(refName, "^{}") {
+			return id, nil // The commit an annotated tag refers to
+		}
+		if commit == "" {
+			commit = id
+		}
+	}
+	if commit == "" {
+		return "", fmt.Errorf("ref %q was not found in repository %q", ref, repoURL)
+	}
+	return commit, nil
+}
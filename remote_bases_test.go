@@ -0,0 +1,177 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+const testCommitID = "0123456789abcdef0123456789abcdef01234567"
+
+func TestParseRemoteBase(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		isRemote bool
+		expected RemoteBase
+	}{
+		{
+			entry: "../base",
+		},
+		{
+			entry:    "https://github.com/example/repo//deploy/base?ref=v1.0.0",
+			isRemote: true,
+			expected: RemoteBase{
+				RepoURL: "https://github.com/example/repo",
+				Ref:     "v1.0.0",
+			},
+		},
+		{
+			entry:    "github.com/example/repo/deploy/base?ref=" + testCommitID,
+			isRemote: true,
+			expected: RemoteBase{
+				RepoURL: "https://github.com/example/repo",
+				Ref:     testCommitID,
+				Commit:  testCommitID,
+				Pinned:  true,
+			},
+		},
+		{
+			entry:    "git@github.com:example/repo.git/deploy?version=main",
+			isRemote: true,
+			expected: RemoteBase{
+				RepoURL: "git@github.com:example/repo.git",
+				Ref:     "main",
+			},
+		},
+		{
+			entry:    "git::https://git.example.com/repo.git//base",
+			isRemote: true,
+			expected: RemoteBase{
+				RepoURL: "https://git.example.com/repo.git",
+			},
+		},
+		{
+			entry: "https://raw.githubusercontent.com/example/repo/" +
+				testCommitID + "/deploy.yaml",
+			isRemote: true,
+			expected: RemoteBase{Pinned: true},
+		},
+		{
+			entry:    "https://example.com/deploy.yaml",
+			isRemote: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.entry, func(t *testing.T) {
+			remoteBase, isRemote := parseRemoteBase(testCase.entry)
+			require.Equal(t, testCase.isRemote, isRemote)
+			if !isRemote {
+				return
+			}
+			testCase.expected.URL = testCase.entry
+			require.Equal(t, testCase.expected, remoteBase)
+		})
+	}
+}
+
+func TestResolveRemoteBases(t *testing.T) {
+	repoRoot := t.TempDir()
+	writeKustomization := func(dir string, resources ...string) {
+		kustomization := "resources:\n"
+		for _, resource := range resources {
+			kustomization += "- " + resource + "\n"
+		}
+		require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, dir), 0755))
+		require.NoError(
+			t,
+			os.WriteFile(
+				filepath.Join(repoRoot, dir, "kustomization.yaml"),
+				[]byte(kustomization),
+				0600,
+			),
+		)
+	}
+	writeKustomization(
+		"base",
+		"https://github.com/example/repo//base?ref="+testCommitID,
+	)
+	writeKustomization(
+		"foo",
+		"../base",
+		"deployment.yaml",
+		"https://github.com/example/repo//overlay?ref=v1.0.0",
+	)
+	writeKustomization("bar", "../base")
+
+	var resolved []string
+	s := &service{
+		resolveRemoteRefFn: func(
+			_ context.Context,
+			repoURL string,
+			ref string,
+			_ *commandTrace,
+		) (string, error) {
+			resolved = append(resolved, repoURL+"@"+ref)
+			return "fedcba9876543210fedcba9876543210fedcba98", nil
+		},
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{TargetBranch: "env/prod"},
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"bar": {ConfigManagement: argocd.ConfigManagementConfig{Path: "bar"}},
+		"foo": {ConfigManagement: argocd.ConfigManagementConfig{Path: "foo"}},
+	}
+
+	remoteBases, err := s.resolveRemoteBases(context.Background(), rc, repoRoot)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]RemoteBase{
+			{
+				App:           "bar",
+				Kustomization: "base/kustomization.yaml",
+				URL:           "https://github.com/example/repo//base?ref=" + testCommitID,
+				RepoURL:       "https://github.com/example/repo",
+				Ref:           testCommitID,
+				Commit:        testCommitID,
+				Pinned:        true,
+			},
+			{
+				App:           "foo",
+				Kustomization: "base/kustomization.yaml",
+				URL:           "https://github.com/example/repo//base?ref=" + testCommitID,
+				RepoURL:       "https://github.com/example/repo",
+				Ref:           testCommitID,
+				Commit:        testCommitID,
+				Pinned:        true,
+			},
+			{
+				App:           "foo",
+				Kustomization: "foo/kustomization.yaml",
+				URL:           "https://github.com/example/repo//overlay?ref=v1.0.0",
+				RepoURL:       "https://github.com/example/repo",
+				Ref:           "v1.0.0",
+				Commit:        "fedcba9876543210fedcba9876543210fedcba98",
+			},
+		},
+		remoteBases,
+	)
+	// Only the unpinned remote base needed resolving
+	require.Equal(t, []string{"https://github.com/example/repo@v1.0.0"}, resolved)
+
+	rc.target.branchConfig.Kustomize =
+		&branchKustomizeConfig{RequirePinnedRemoteBases: true}
+	_, err = s.resolveRemoteBases(context.Background(), rc, repoRoot)
+	unpinnedErr := &UnpinnedRemoteBaseError{}
+	require.ErrorAs(t, err, &unpinnedErr)
+	require.Equal(t, "foo", unpinnedErr.RemoteBase.App)
+	require.Equal(t, "env/prod", unpinnedErr.TargetBranch)
+}
@@ -0,0 +1,427 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// WorkspaceRequest is a request to render manifests from a workspace that the
+// caller has already prepared. The caller is responsible for checking out the
+// source commit and the target branch and for committing and pushing whatever
+// is written to the target branch's working tree. Kargo Render performs no git
+// operations at all, so this is suitable for platforms, such as Kargo, that
+// manage repositories themselves.
+type WorkspaceRequest struct {
+	// SourcePath is the path to a working tree of the repository with the
+	// commit to render manifests from checked out. Nothing is written to it.
+	SourcePath string `json:"sourcePath"`
+	// SourceCommit optionally specifies the ID (sha) of the commit checked out
+	// at SourcePath. It is recorded in the target branch's metadata.
+	SourceCommit string `json:"sourceCommit,omitempty"`
+	// TargetPath is the path to a working tree of the environment-specific
+	// branch to render manifests into. This may be an empty directory if the
+	// branch does not exist yet. Its contents are updated in place.
+	TargetPath string `json:"targetPath"`
+	// TargetBranch is the name of the environment-specific branch checked out
+	// at TargetPath. It selects the configuration used for rendering.
+	TargetBranch string `json:"targetBranch"`
+	// RefPath has the same meaning as the RefPath field of a Request.
+	RefPath string `json:"refPath,omitempty"`
+	// Images has the same meaning as the Images field of a Request.
+	Images []string `json:"images,omitempty"`
+	// LastMile has the same meaning as the LastMile field of a Request.
+	LastMile *LastMileOptions `json:"lastMile,omitempty"`
+	// AllowEmpty has the same meaning as the AllowEmpty field of a Request.
+	AllowEmpty bool `json:"allowEmpty,omitempty"`
+	// RequireBranchConfig has the same meaning as the RequireBranchConfig field
+	// of a Request.
+	RequireBranchConfig bool `json:"requireBranchConfig,omitempty"`
+	// RequireImageMatches has the same meaning as the RequireImageMatches field
+	// of a Request.
+	RequireImageMatches bool `json:"requireImageMatches,omitempty"`
+	// Vars has the same meaning as the Vars field of a Request.
+	Vars map[string]string `json:"vars,omitempty"`
+	// Options has the same meaning as the Options field of a Request.
+	Options map[string]string `json:"options,omitempty"`
+	// Offline has the same meaning as the Offline field of a Request.
+	Offline bool `json:"offline,omitempty"`
+}
+
+// WorkspaceResponse describes what was written in response to a
+// WorkspaceRequest.
+type WorkspaceResponse struct {
+	// Changes describes every file that was written to or deleted from the
+	// working tree at the TargetPath of the request. If this is empty, the
+	// working tree was left unchanged.
+	Changes []FileChange `json:"changes,omitempty"`
+	// ImageSubstitutions has the same meaning as the ImageSubstitutions field
+	// of a Response.
+	ImageSubstitutions []ImageSubstitution `json:"imageSubstitutions,omitempty"`
+	// UnmatchedImages has the same meaning as the UnmatchedImages field of a
+	// Response.
+	UnmatchedImages []string `json:"unmatchedImages,omitempty"`
+	// PrunedApps has the same meaning as the PrunedApps field of a Response.
+	PrunedApps []PrunedApp `json:"prunedApps,omitempty"`
+	// ResourcePolicyViolations has the same meaning as the
+	// ResourcePolicyViolations field of a Response.
+	ResourcePolicyViolations []ResourcePolicyViolation `json:"resourcePolicyViolations,omitempty"`
+	// DuplicateResources has the same meaning as the DuplicateResources field
+	// of a Response.
+	DuplicateResources []DuplicateResource `json:"duplicateResources,omitempty"`
+	// LintFindings has the same meaning as the LintFindings field of a
+	// Response.
+	LintFindings []LintFinding `json:"lintFindings,omitempty"`
+	// NondeterministicApps has the same meaning as the NondeterministicApps
+	// field of a Response.
+	NondeterministicApps []string `json:"nondeterministicApps,omitempty"`
+	// RemoteBases has the same meaning as the RemoteBases field of a Response.
+	RemoteBases []RemoteBase `json:"remoteBases,omitempty"`
+	// Report has the same meaning as the Report field of a Response.
+	Report *RenderReport `json:"report,omitempty"`
+	// RenderTimings has the same meaning as the RenderTimings field of a
+	// Response, except that it is only recorded in the target branch's
+	// metadata if anything else in the working tree changed.
+	RenderTimings *RenderTimings `json:"renderTimings,omitempty"`
+	// Timings has the same meaning as the Timings field of a Response.
+	Timings []StageTiming `json:"timings,omitempty"`
+}
+
+// request returns a Request equivalent to the WorkspaceRequest, for the
+// purposes of validation and rendering.
+func (w *WorkspaceRequest) request() *Request {
+	return &Request{
+		LocalInPath:         w.SourcePath,
+		TargetBranch:        w.TargetBranch,
+		RefPath:             w.RefPath,
+		Images:              w.Images,
+		LastMile:            w.LastMile,
+		AllowEmpty:          w.AllowEmpty,
+		RequireBranchConfig: w.RequireBranchConfig,
+		RequireImageMatches: w.RequireImageMatches,
+		Vars:                w.Vars,
+		Options:             w.Options,
+		Offline:             w.Offline,
+	}
+}
+
+// validateTargetPath canonicalizes the TargetPath field and returns an error
+// if it does not refer to a directory that is distinct from, and does not
+// overlap, the directory referred to by the provided source path.
+func (w *WorkspaceRequest) validateTargetPath(sourcePath string) error {
+	if w.TargetPath = strings.TrimSpace(w.TargetPath); w.TargetPath == "" {
+		return errors.New("TargetPath is required")
+	}
+	var err error
+	if w.TargetPath, err = filepath.Abs(w.TargetPath); err != nil {
+		return fmt.Errorf("error canonicalizing path %s: %w", w.TargetPath, err)
+	}
+	fi, err := os.Stat(w.TargetPath)
+	if err != nil {
+		return fmt.Errorf("error checking path %s: %w", w.TargetPath, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("path %s is not a directory", w.TargetPath)
+	}
+	if isWithin(w.TargetPath, sourcePath) || isWithin(sourcePath, w.TargetPath) {
+		return errors.New("SourcePath and TargetPath must not overlap")
+	}
+	return nil
+}
+
+// isWithin returns a bool indicating whether the absolute path is, or lies
+// within, the absolute path dir.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+func (s *service) RenderWorkspace(
+	ctx context.Context,
+	wsReq *WorkspaceRequest,
+) (res WorkspaceResponse, err error) {
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer release()
+	req := wsReq.request()
+	req.id = uuid.NewString()
+	logger := s.logger.WithFields(log.Fields{
+		"request":      req.id,
+		"targetBranch": req.TargetBranch,
+	})
+	logger.Debug("handling workspace rendering request")
+
+	if err = req.canonicalizeAndValidate(); err != nil {
+		return res, err
+	}
+	if err = wsReq.validateTargetPath(req.LocalInPath); err != nil {
+		return res, err
+	}
+	if err = s.checkSourcePoliciesInapplicable(req.TargetBranch); err != nil {
+		return res, err
+	}
+
+	rc := requestContext{
+		logger:        logger,
+		request:       req,
+		timings:       newTimings(s.progressFn),
+		toolEnv:       s.toolEnv,
+		renderTimeout: s.renderTimeout,
+	}
+	rc.source.commit = strings.TrimSpace(wsReq.SourceCommit)
+	defer func() {
+		res.Timings = rc.timings.stages
+	}()
+
+	repoConfig, branchCfg, err := loadBranchConfig(rc, req.LocalInPath)
+	if err != nil {
+		return res, err
+	}
+	rc.target.branchConfig = branchCfg
+	rc.target.symlinks = repoConfig.symlinkPolicy()
+	if len(rc.target.branchConfig.Overlays) > 0 {
+		// Overlays are checked out from other refs, which requires git
+		return res, fmt.Errorf(
+			"configuration for branch %q specifies overlays, which are not "+
+				"supported when rendering a prepared workspace",
+			req.TargetBranch,
+		)
+	}
+	if rc.target.branchConfig.AppConfigs, err = s.resolveAppConfigs(
+		ctx,
+		rc,
+		repoConfig,
+		req.LocalInPath,
+	); err != nil {
+		return res, err
+	}
+	if err = checkOffline(rc, req.LocalInPath, false); err != nil {
+		return res, err
+	}
+
+	if res.LintFindings, err = lintApps(ctx, rc, req.LocalInPath); err != nil {
+		return res, err
+	}
+
+	if res.RemoteBases, err =
+		s.resolveRemoteBases(ctx, rc, req.LocalInPath); err != nil {
+		return res, err
+	}
+
+	if rc.target.prerenderedManifests, err =
+		s.preRender(ctx, rc, req.LocalInPath); err != nil {
+		return res, fmt.Errorf("error pre-rendering manifests: %w", err)
+	}
+	if res.NondeterministicApps, err = s.checkDeterminism(
+		ctx,
+		rc,
+		req.LocalInPath,
+	); err != nil {
+		return res, err
+	}
+
+	oldBranchMetadata, err := loadBranchMetadata(wsReq.TargetPath)
+	if err != nil {
+		return res, fmt.Errorf("error loading branch metadata: %w", err)
+	}
+	if oldBranchMetadata == nil {
+		// As when Kargo Render checks out the target branch itself, the working
+		// tree must be empty if it isn't already managed by Kargo Render
+		var empty bool
+		if empty, err = branchIsEmpty(wsReq.TargetPath); err != nil {
+			return res, err
+		}
+		if !empty {
+			return res, &UnmanagedBranchError{
+				TargetBranch: req.TargetBranch,
+				Path:         wsReq.TargetPath,
+			}
+		}
+		rc.target.oldBranchMetadata = branchMetadata{}
+	} else {
+		rc.target.oldBranchMetadata = *oldBranchMetadata
+	}
+
+	before, err := snapshotTree(wsReq.TargetPath)
+	if err != nil {
+		return res, err
+	}
+
+	rc.target.newBranchMetadata.SourceCommit = rc.source.commit
+	rc.target.newBranchMetadata.RemoteBases = res.RemoteBases
+	if rc.target.newBranchMetadata.ImageSubstitutions,
+		rc.target.renderedManifests,
+		err =
+		renderLastMile(ctx, rc); err != nil {
+		return res, fmt.Errorf("error in last-mile manifest rendering: %w", err)
+	}
+	if !req.boolOption(OptionSkipLastMile) {
+		if res.ImageSubstitutions, res.UnmatchedImages, err =
+			getImageSubstitutions(
+				rc,
+				rc.target.newBranchMetadata.ImageSubstitutions,
+			); err != nil {
+			return res, err
+		}
+		rc.target.newBranchMetadata.AppImageSubstitutions = res.ImageSubstitutions
+	}
+	if res.ResourcePolicyViolations, err = checkResourcePolicy(rc); err != nil {
+		return res, err
+	}
+	if res.DuplicateResources, err = checkDuplicateResources(rc); err != nil {
+		return res, err
+	}
+	if res.Report, err = buildReport(
+		rc,
+		res.ResourcePolicyViolations,
+		res.DuplicateResources,
+		res.UnmatchedImages,
+	); err != nil {
+		return res, fmt.Errorf("error building report: %w", err)
+	}
+
+	rc.target.newBranchMetadata.AppOutputPaths,
+		rc.target.newBranchMetadata.AppOutputLayouts =
+		appOutputMetadata(rc.target.branchConfig.AppConfigs)
+	if res.PrunedApps, err = pruneOrphanedApps(
+		wsReq.TargetPath,
+		rc.target.oldBranchMetadata,
+		rc.target.newBranchMetadata,
+		rc.target.branchConfig.ExternalPaths,
+	); err != nil {
+		return res, fmt.Errorf("error pruning orphaned apps: %w", err)
+	}
+	// How long rendering took is only recorded if anything else changes, so
+	// the previous timings are kept at first
+	res.RenderTimings = rc.timings.summary()
+	rc.target.newBranchMetadata.RenderTimings =
+		rc.target.oldBranchMetadata.RenderTimings
+	if err = writeBranchMetadata(
+		rc.target.newBranchMetadata,
+		wsReq.TargetPath,
+	); err != nil {
+		return res, fmt.Errorf("error writing branch metadata: %w", err)
+	}
+	if err = writeReport(res.Report, wsReq.TargetPath); err != nil {
+		return res, err
+	}
+	if err = writeAllManifests(rc, wsReq.TargetPath); err != nil {
+		return res, err
+	}
+
+	after, err := snapshotTree(wsReq.TargetPath)
+	if err != nil {
+		return res, err
+	}
+	if res.Changes = treeChanges(before, after); len(res.Changes) > 0 {
+		rc.target.newBranchMetadata.RenderTimings = res.RenderTimings
+		if err = writeBranchMetadata(
+			rc.target.newBranchMetadata,
+			wsReq.TargetPath,
+		); err != nil {
+			return res, fmt.Errorf("error writing branch metadata: %w", err)
+		}
+		if after, err = snapshotTree(wsReq.TargetPath); err != nil {
+			return res, err
+		}
+		res.Changes = treeChanges(before, after)
+	}
+
+	logger.WithField("changes", len(res.Changes)).
+		Debug("completed workspace rendering request")
+	return res, nil
+}
+
+// checkSourcePoliciesInapplicable returns an error if any of the Service's
+// commit signature or required checks policies applies to the specified
+// target branch. Satisfying those policies requires access to the repository
+// the source commit belongs to, which rendering a prepared workspace does not
+// have.
+func (s *service) checkSourcePoliciesInapplicable(targetBranch string) error {
+	patterns := make(
+		[]string,
+		0,
+		len(s.commitSignaturePolicies)+len(s.requiredChecksPolicies),
+	)
+	for _, policy := range s.commitSignaturePolicies {
+		patterns = append(patterns, policy.TargetBranchPattern)
+	}
+	for _, policy := range s.requiredChecksPolicies {
+		patterns = append(patterns, policy.TargetBranchPattern)
+	}
+	for _, pattern := range patterns {
+		applies, err := policyApplies(pattern, targetBranch)
+		if err != nil {
+			return err
+		}
+		if applies {
+			return fmt.Errorf(
+				"source commits rendered into branch %q are subject to policies "+
+					"that cannot be verified when rendering a prepared workspace",
+				targetBranch,
+			)
+		}
+	}
+	return nil
+}
+
+// snapshotTree returns the contents of every file beneath the specified
+// directory, other than those beneath its .git directory, indexed by path
+// relative to the directory.
+func snapshotTree(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if err := filepath.WalkDir(
+		dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" && path != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(relPath)], err = os.ReadFile(path)
+			return err
+		},
+	); err != nil {
+		return nil, fmt.Errorf("error reading contents of %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// treeChanges returns, in order by path, the changes that turn the files in
+// the before snapshot into the files in the after snapshot.
+func treeChanges(before, after map[string][]byte) []FileChange {
+	var changes []FileChange
+	for path, content := range after {
+		if oldContent, ok := before[path]; !ok || !bytes.Equal(oldContent, content) {
+			changes = append(changes, FileChange{Path: path, Content: content})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Deleted: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
@@ -0,0 +1,162 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+)
+
+func TestRenderWorkspace(t *testing.T) {
+	const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+`
+	newSourcePath := func(t *testing.T) string {
+		dir := t.TempDir()
+		require.NoError(
+			t,
+			os.WriteFile(
+				filepath.Join(dir, "kargo-render.yaml"),
+				[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+				0600,
+			),
+		)
+		return dir
+	}
+	testCases := []struct {
+		name          string
+		policies      []CommitSignaturePolicy
+		setup         func(t *testing.T, targetPath string)
+		omitTargetDir bool
+		assertions    func(*testing.T, string, WorkspaceResponse, error)
+	}{
+		{
+			name:          "target path does not exist",
+			omitTargetDir: true,
+			assertions: func(t *testing.T, _ string, _ WorkspaceResponse, err error) {
+				require.ErrorContains(t, err, "error checking path")
+			},
+		},
+		{
+			name:     "source policies apply",
+			policies: []CommitSignaturePolicy{{TargetBranchPattern: "env/*"}},
+			assertions: func(t *testing.T, _ string, _ WorkspaceResponse, err error) {
+				require.ErrorContains(t, err, "cannot be verified")
+			},
+		},
+		{
+			name: "target is not managed by Kargo Render",
+			setup: func(t *testing.T, targetPath string) {
+				require.NoError(
+					t,
+					os.WriteFile(filepath.Join(targetPath, "README.md"), nil, 0600),
+				)
+			},
+			assertions: func(t *testing.T, _ string, _ WorkspaceResponse, err error) {
+				require.ErrorContains(t, err, "does not appear to be managed")
+			},
+		},
+		{
+			name: "success",
+			assertions: func(
+				t *testing.T,
+				targetPath string,
+				res WorkspaceResponse,
+				err error,
+			) {
+				require.NoError(t, err)
+				paths := make([]string, len(res.Changes))
+				for i, change := range res.Changes {
+					paths[i] = change.Path
+				}
+				require.Equal(
+					t,
+					[]string{".kargo-render/metadata.yaml", "foo/foo-configmap.yaml"},
+					paths,
+				)
+				require.Equal(t, configMap, string(res.Changes[1].Content))
+				content, err :=
+					os.ReadFile(filepath.Join(targetPath, "foo", "foo-configmap.yaml"))
+				require.NoError(t, err)
+				require.Equal(t, configMap, string(content))
+				md, err := loadBranchMetadata(targetPath)
+				require.NoError(t, err)
+				require.Equal(t, "abc123", md.SourceCommit)
+				require.NotNil(t, res.RenderTimings)
+				require.Equal(t, res.RenderTimings, md.RenderTimings)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			targetPath := t.TempDir()
+			if testCase.omitTargetDir {
+				targetPath = filepath.Join(targetPath, "nonexistent")
+			}
+			if testCase.setup != nil {
+				testCase.setup(t, targetPath)
+			}
+			s := &service{
+				logger:                  log.New(),
+				commitSignaturePolicies: testCase.policies,
+				renderFn: func(
+					context.Context,
+					string,
+					argocd.ConfigManagementConfig,
+					*commandTrace,
+				) ([]byte, error) {
+					return []byte(configMap), nil
+				},
+			}
+			res, err := s.RenderWorkspace(
+				context.Background(),
+				&WorkspaceRequest{
+					SourcePath:   newSourcePath(t),
+					SourceCommit: "abc123",
+					TargetPath:   targetPath,
+					TargetBranch: "env/dev",
+					Options:      map[string]string{OptionSkipLastMile: "true"},
+				},
+			)
+			testCase.assertions(t, targetPath, res, err)
+		})
+	}
+}
+
+func TestTreeChanges(t *testing.T) {
+	changes := treeChanges(
+		map[string][]byte{
+			"a.yaml": []byte("a"),
+			"b.yaml": []byte("b"),
+			"c.yaml": []byte("c"),
+		},
+		map[string][]byte{
+			"a.yaml": []byte("a"),
+			"b.yaml": []byte("B"),
+			"d.yaml": []byte("d"),
+		},
+	)
+	require.Equal(
+		t,
+		[]FileChange{
+			{Path: "b.yaml", Content: []byte("B")},
+			{Path: "c.yaml", Deleted: true},
+			{Path: "d.yaml", Content: []byte("d")},
+		},
+		changes,
+	)
+}
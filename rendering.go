@@ -1,13 +1,22 @@
 package render
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/file"
 	"github.com/akuity/kargo-render/internal/kustomize"
+	libManifests "github.com/akuity/kargo-render/internal/manifests"
 	"github.com/akuity/kargo-render/internal/strings"
+	"github.com/akuity/kargo-render/pkg/git"
 )
 
 var lastMileKustomizationBytes = []byte(
@@ -19,6 +28,245 @@ resources:
 `,
 )
 
+// exportOverlays checks out the contents of each of the target branch's
+// overlay refs into the workspace at the path specified for it. It returns the
+// absolute paths of the resulting directories so that the caller may remove
+// them once they are no longer needed.
+func exportOverlays(ctx context.Context, rc requestContext) ([]string, error) {
+	repoRoot := rc.repo.WorkingDir()
+	dirs := make([]string, 0, len(rc.target.branchConfig.Overlays))
+	for _, overlay := range rc.target.branchConfig.Overlays {
+		if !filepath.IsLocal(overlay.Path) {
+			return dirs, fmt.Errorf(
+				"overlay path %q does not lie within the repository",
+				overlay.Path,
+			)
+		}
+		dir := filepath.Join(repoRoot, overlay.Path)
+		exists, err := file.Exists(dir)
+		if err != nil {
+			return dirs, fmt.Errorf("error checking overlay path %q: %w", dir, err)
+		}
+		if exists {
+			return dirs, fmt.Errorf(
+				"overlay path %q already exists in source commit %q",
+				overlay.Path,
+				rc.source.commit,
+			)
+		}
+		// Branches other than the one initially checked out exist only as
+		// remote-tracking branches.
+		ref := overlay.Ref
+		isBranch, err := rc.repo.RemoteBranchExists(ctx, ref)
+		if err != nil {
+			return dirs, fmt.Errorf(
+				"error checking for existence of remote branch %q: %w",
+				ref,
+				err,
+			)
+		}
+		if isBranch {
+			ref = fmt.Sprintf("%s/%s", git.RemoteOrigin, ref)
+		}
+		if err = rc.repo.ExportTree(ctx, ref, dir); err != nil {
+			return dirs, fmt.Errorf(
+				"error checking out overlay %q to %q: %w",
+				overlay.Ref,
+				overlay.Path,
+				err,
+			)
+		}
+		dirs = append(dirs, dir)
+		rc.logger.WithFields(log.Fields{
+			"ref":  overlay.Ref,
+			"path": overlay.Path,
+		}).Debug("checked out overlay")
+	}
+	return dirs, nil
+}
+
+// loadBranchConfig loads Kargo Render's configuration from the repository
+// whose working tree is at the specified path and returns it along with the
+// configuration for the request's target branch.
+func loadBranchConfig(
+	rc requestContext,
+	repoRoot string,
+) (*repoConfig, branchConfig, error) {
+	start := rc.timings.start(StageLoadConfig)
+	repoConfig, err := loadRepoConfig(repoRoot)
+	if err != nil {
+		return nil, branchConfig{},
+			fmt.Errorf("error loading Kargo Render configuration from repo: %w", err)
+	}
+	if rc.request.RequireBranchConfig && len(repoConfig.BranchConfigs) == 0 &&
+		repoConfig.Conventions == nil {
+		return nil, branchConfig{}, fmt.Errorf(
+			"error loading configuration for branch %q: %w",
+			rc.request.TargetBranch,
+			&NoBranchConfigError{Branch: rc.request.TargetBranch},
+		)
+	}
+	branchCfg, err := repoConfig.GetBranchConfig(
+		rc.request.TargetBranch,
+		rc.request.Vars,
+	)
+	if err != nil {
+		return nil, branchConfig{}, fmt.Errorf(
+			"error loading configuration for branch %q: %w",
+			rc.request.TargetBranch,
+			err,
+		)
+	}
+	rc.timings.record(StageLoadConfig, "", start)
+	return repoConfig, branchCfg, nil
+}
+
+// resolveAppConfigs returns the configurations of all apps to be rendered into
+// the request's target branch from the repository whose working tree is at the
+// specified path. These are the apps explicitly configured for the branch, any
+// auto-discovered ones, or, failing those, a single app implied by the
+// request's RefPath or the repository's conventions. The configurations are
+// checked against the Service's policies and completed with the branch's Helm
+// defaults.
+func (s *service) resolveAppConfigs(
+	ctx context.Context,
+	rc requestContext,
+	repoConfig *repoConfig,
+	repoRoot string,
+) (map[string]appConfig, error) {
+	discoveredAppConfigs, err := rc.target.branchConfig.discoverApps(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error auto-discovering apps: %w", err)
+	}
+	if len(discoveredAppConfigs) > 0 {
+		for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+			discoveredAppConfigs[appName] = appConfig
+		}
+		rc.target.branchConfig.AppConfigs = discoveredAppConfigs
+		rc.logger.WithField("apps", len(discoveredAppConfigs)).
+			Debug("auto-discovered apps")
+	}
+
+	if len(rc.target.branchConfig.AppConfigs) == 0 &&
+		rc.target.branchConfig.AutoDiscover != nil {
+		return nil, fmt.Errorf(
+			"auto-discovery glob %q did not match any apps",
+			rc.target.branchConfig.AutoDiscover.Glob,
+		)
+	}
+
+	if len(rc.target.branchConfig.AppConfigs) == 0 {
+		cfg := appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{
+				Path: rc.request.RefPath,
+			},
+		}
+		if rc.request.RefPath == "" {
+			if cfg, err = repoConfig.Conventions.appConfig(
+				rc.request.TargetBranch,
+				rc.request.Vars,
+			); err != nil {
+				return nil, fmt.Errorf(
+					"error applying conventions for branch %q: %w",
+					rc.request.TargetBranch,
+					err,
+				)
+			}
+		}
+		rc.target.branchConfig.AppConfigs = map[string]appConfig{"app": cfg}
+	} else if rc.request.RefPath != "" {
+		return nil, fmt.Errorf(
+			"RefPath cannot be used because configuration for branch %q "+
+				"explicitly defines apps",
+			rc.request.TargetBranch,
+		)
+	}
+
+	if err = checkAppOutputPaths(rc.target.branchConfig); err != nil {
+		return nil, err
+	}
+
+	if err = s.checkConfigManagementPolicy(
+		ctx,
+		repoRoot,
+		rc.target.branchConfig.AppConfigs,
+	); err != nil {
+		return nil, err
+	}
+
+	if err = s.applyHelmDefaults(rc); err != nil {
+		return nil, err
+	}
+
+	return rc.target.branchConfig.AppConfigs, nil
+}
+
+// applyHelmDefaults fills in the Kubernetes version and API versions of any
+// Helm-based app that does not specify them using the defaults from the
+// target branch's configuration. Where the branch configuration names a
+// kubeconfig context, the capabilities of the corresponding cluster are
+// discovered and used in place of any defaults that are not specified, unless
+// the request is to be handled offline, in which case a
+// NetworkAccessRequiredError is returned instead.
+func (s *service) applyHelmDefaults(rc requestContext) error {
+	defaults := rc.target.branchConfig.Helm
+	if defaults == nil {
+		return nil
+	}
+	k8sVersion := defaults.K8SVersion
+	apiVersions := defaults.APIVersions
+	var discovered bool
+	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+		if appConfig.ConfigManagement.Helm == nil {
+			continue
+		}
+		helm := *appConfig.ConfigManagement.Helm
+		if defaults.KubeContext != "" && !discovered &&
+			((helm.K8SVersion == "" && k8sVersion == "") ||
+				(len(helm.APIVersions) == 0 && len(apiVersions) == 0)) {
+			if rc.request.Offline {
+				return &NetworkAccessRequiredError{
+					TargetBranch: rc.request.TargetBranch,
+					Reasons: []string{
+						fmt.Sprintf(
+							"capabilities of the cluster for kubeconfig context %q "+
+								"must be discovered",
+							defaults.KubeContext,
+						),
+					},
+				}
+			}
+			rc.logger.WithField("kubeContext", defaults.KubeContext).
+				Debug("discovering cluster capabilities")
+			capabilities, err := s.discoverCapabilitiesFn(defaults.KubeContext)
+			if err != nil {
+				return fmt.Errorf(
+					"error discovering capabilities of cluster for kubeconfig "+
+						"context %q: %w",
+					defaults.KubeContext,
+					err,
+				)
+			}
+			if k8sVersion == "" {
+				k8sVersion = capabilities.K8SVersion
+			}
+			if len(apiVersions) == 0 {
+				apiVersions = capabilities.APIVersions
+			}
+			discovered = true
+		}
+		if helm.K8SVersion == "" {
+			helm.K8SVersion = k8sVersion
+		}
+		if len(helm.APIVersions) == 0 {
+			helm.APIVersions = apiVersions
+		}
+		appConfig.ConfigManagement.Helm = &helm
+		rc.target.branchConfig.AppConfigs[appName] = appConfig
+	}
+	return nil
+}
+
 func (s *service) preRender(
 	ctx context.Context,
 	rc requestContext,
@@ -27,16 +275,31 @@ func (s *service) preRender(
 	logger := rc.logger
 	manifests := map[string][]byte{}
 	var err error
+	// Pre-rendered manifests can only be shared with other branches if nothing
+	// but the source commit is in the workspace
+	cache := rc.request.preRenderCache
+	if rc.source.commit == "" || len(rc.target.branchConfig.Overlays) > 0 {
+		cache = nil
+	}
+	appCount := len(rc.target.branchConfig.AppConfigs)
+	appIndex := 0
 	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
 		appLogger := logger.WithField("app", appName)
-		manifests[appName], err = s.renderFn(
+		appIndex++
+		start :=
+			rc.timings.startApp(StagePreRender, appName, appIndex, appCount)
+		if manifests[appName], err = withAppTimeout(
 			ctx,
-			repoRoot,
-			appConfig.ConfigManagement,
-		)
-		if err != nil {
+			appName,
+			StagePreRender,
+			appConfig.renderTimeout(rc.renderTimeout),
+			func(ctx context.Context) ([]byte, error) {
+				return s.preRenderApp(ctx, rc, repoRoot, cache, appName, appConfig)
+			},
+		); err != nil {
 			return nil, err
 		}
+		rc.timings.record(StagePreRender, appName, start)
 		appLogger.Debug("completed manifest pre-rendering")
 	}
 
@@ -55,13 +318,107 @@ func (s *service) preRender(
 	return manifests, nil
 }
 
+// preRenderApp pre-renders the manifests of the named app, using the provided
+// cache, if any, and flattens any Argo CD Applications among them if the app's
+// configuration says to.
+func (s *service) preRenderApp(
+	ctx context.Context,
+	rc requestContext,
+	repoRoot string,
+	cache *preRenderCache,
+	appName string,
+	appConfig appConfig,
+) ([]byte, error) {
+	appPreRender := func() ([]byte, error) {
+		return s.renderFn(ctx, repoRoot, appConfig.ConfigManagement, rc.commands)
+	}
+	var manifests []byte
+	var err error
+	if cache == nil {
+		manifests, err = appPreRender()
+	} else {
+		key, keyErr :=
+			preRenderCacheKey(rc.source.commit, appConfig.ConfigManagement)
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		var cached []byte
+		var hit bool
+		cached, hit, err = cache.get(key, appPreRender)
+		manifests = bytes.Clone(cached)
+		if hit {
+			rc.logger.WithField("app", appName).
+				Debug("reused manifests pre-rendered for another branch")
+		}
+	}
+	if err != nil || !appConfig.FlattenApplications {
+		return manifests, err
+	}
+	return s.flattenApplications(ctx, rc, repoRoot, appName, manifests)
+}
+
+// withAppTimeout calls the provided function, which performs the specified
+// stage of rendering the named app, with a context that is canceled once the
+// provided timeout elapses. A timeout of zero means there is no limit. If the
+// function fails after the timeout has elapsed, an *AppRenderTimeoutError is
+// returned in place of the function's error, which seldom says as much.
+func withAppTimeout(
+	ctx context.Context,
+	appName string,
+	stage string,
+	timeout time.Duration,
+	fn func(context.Context) ([]byte, error),
+) ([]byte, error) {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	appCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	manifests, err := fn(appCtx)
+	if err != nil && ctx.Err() == nil &&
+		errors.Is(appCtx.Err(), context.DeadlineExceeded) {
+		return nil, &AppRenderTimeoutError{
+			App:     appName,
+			Stage:   stage,
+			Timeout: timeout,
+		}
+	}
+	return manifests, err
+}
+
 func renderLastMile(
 	ctx context.Context,
 	rc requestContext,
 ) ([]string, map[string][]byte, error) {
 	logger := rc.logger
 
-	tempDir, err := os.MkdirTemp("", "repo-scrap-")
+	if rc.request.boolOption(OptionSkipLastMile) {
+		logger.Debug("skipping last-mile manifest rendering")
+		manifests := make(
+			map[string][]byte,
+			len(rc.target.branchConfig.AppConfigs),
+		)
+		for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+			var err error
+			if manifests[appName], err = formatManifests(
+				appName,
+				appConfig,
+				rc.target.prerenderedManifests[appName],
+			); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, manifests, nil
+	}
+
+	// The scrap directory lives within the repository's home directory, if
+	// there is one, so that it is cleaned up (or preserved for inspection) along
+	// with everything else if rendering fails.
+	var scrapParentDir string
+	if rc.repo != nil {
+		scrapParentDir = rc.repo.HomeDir()
+	}
+	tempDir, err := os.MkdirTemp(scrapParentDir, "scrap-")
 	if err != nil {
 		return nil, nil, fmt.Errorf(
 			"error creating temporary directory %q for last mile rendering: %w",
@@ -69,7 +426,11 @@ func renderLastMile(
 			err,
 		)
 	}
-	defer os.RemoveAll(tempDir)
+	defer func() {
+		if err == nil || rc.repo == nil {
+			os.RemoveAll(tempDir)
+		}
+	}()
 
 	imageMap := map[string]string{}
 	for _, imageSub := range rc.target.oldBranchMetadata.ImageSubstitutions {
@@ -99,8 +460,23 @@ func renderLastMile(
 		i++
 	}
 
+	var kustomizeOpts kustomize.Options
+	if lastMile := rc.request.LastMile; lastMile != nil {
+		kustomizeOpts = kustomize.Options{
+			NameSuffix:        lastMile.NameSuffix,
+			Namespace:         lastMile.Namespace,
+			CommonLabels:      lastMile.CommonLabels,
+			CommonAnnotations: lastMile.CommonAnnotations,
+		}
+	}
+
 	manifests := map[string][]byte{}
-	for appName := range rc.target.branchConfig.AppConfigs {
+	appCount := len(rc.target.branchConfig.AppConfigs)
+	appIndex := 0
+	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
+		appIndex++
+		start :=
+			rc.timings.startApp(StageLastMile, appName, appIndex, appCount)
 		appDir := filepath.Join(tempDir, appName)
 		if err = os.MkdirAll(appDir, 0755); err != nil {
 			return nil, nil, fmt.Errorf(
@@ -137,17 +513,71 @@ func renderLastMile(
 				err,
 			)
 		}
-		if manifests[appName], err =
-			kustomize.Render(ctx, appDir, images); err != nil {
+		if manifests[appName], err = withAppTimeout(
+			ctx,
+			appName,
+			StageLastMile,
+			appConfig.renderTimeout(rc.renderTimeout),
+			func(ctx context.Context) ([]byte, error) {
+				appKustomizeOpts := kustomizeOpts
+				if appConfig.LastMile != nil {
+					appKustomizeOpts.BuildOptions = appConfig.LastMile.BuildOptions
+				}
+				return kustomize.Render(ctx, appDir, images, appKustomizeOpts)
+			},
+		); err != nil {
 			return nil, nil, fmt.Errorf(
 				"error rendering manifests from %q: %w",
 				appDir,
 				err,
 			)
 		}
+		if manifests[appName], err = substituteImageFields(
+			manifests[appName],
+			rc.target.branchConfig.ImageFields,
+			images,
+		); err != nil {
+			return nil, nil, fmt.Errorf(
+				"error substituting images into fields of app %q: %w",
+				appName,
+				err,
+			)
+		}
+		if manifests[appName], err =
+			formatManifests(appName, appConfig, manifests[appName]); err != nil {
+			return nil, nil, err
+		}
+		rc.timings.record(StageLastMile, appName, start)
 		logger.WithField("app", appName).
 			Debug("completed last-mile manifest rendering")
 	}
 
 	return images, manifests, nil
 }
+
+// formatManifests orders and formats the provided manifests for the named app
+// as specified by the app's configuration. If the configuration does not
+// specify any ordering or formatting, the manifests are returned unaltered.
+func formatManifests(
+	appName string,
+	appConfig appConfig,
+	manifests []byte,
+) ([]byte, error) {
+	var err error
+	if appConfig.SortBySyncWave {
+		if manifests, err = libManifests.SortBySyncOrder(manifests); err != nil {
+			return nil,
+				fmt.Errorf("error sorting manifests for app %q: %w", appName, err)
+		}
+	}
+	if appConfig.OutputFormat == nil {
+		return manifests, nil
+	}
+	formatted, err :=
+		libManifests.Format(manifests, appConfig.OutputFormat.formatOptions())
+	if err != nil {
+		return nil,
+			fmt.Errorf("error formatting manifests for app %q: %w", appName, err)
+	}
+	return formatted, nil
+}
@@ -0,0 +1,400 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/kubernetes"
+	libManifests "github.com/akuity/kargo-render/internal/manifests"
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+func TestApplyHelmDefaults(t *testing.T) {
+	testCases := []struct {
+		name        string
+		defaults    *branchHelmConfig
+		helm        *argocd.ApplicationSourceHelm
+		offline     bool
+		discoverErr error
+		assertions  func(*testing.T, *argocd.ApplicationSourceHelm, int, error)
+	}{
+		{
+			name: "no defaults",
+			helm: &argocd.ApplicationSourceHelm{},
+			assertions: func(
+				t *testing.T,
+				helm *argocd.ApplicationSourceHelm,
+				discoveries int,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Empty(t, helm.K8SVersion)
+				require.Empty(t, helm.APIVersions)
+				require.Zero(t, discoveries)
+			},
+		},
+		{
+			name: "not a helm app",
+			defaults: &branchHelmConfig{
+				K8SVersion:  "v1.28.0",
+				KubeContext: "prod",
+			},
+			assertions: func(
+				t *testing.T,
+				helm *argocd.ApplicationSourceHelm,
+				discoveries int,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Nil(t, helm)
+				require.Zero(t, discoveries)
+			},
+		},
+		{
+			name: "app settings take precedence",
+			defaults: &branchHelmConfig{
+				K8SVersion:  "v1.28.0",
+				APIVersions: []string{"bar/v1"},
+				KubeContext: "prod",
+			},
+			helm: &argocd.ApplicationSourceHelm{
+				K8SVersion:  "v1.27.0",
+				APIVersions: []string{"foo/v1"},
+			},
+			assertions: func(
+				t *testing.T,
+				helm *argocd.ApplicationSourceHelm,
+				discoveries int,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Equal(t, "v1.27.0", helm.K8SVersion)
+				require.Equal(t, []string{"foo/v1"}, helm.APIVersions)
+				require.Zero(t, discoveries)
+			},
+		},
+		{
+			name: "branch defaults take precedence over discovery",
+			defaults: &branchHelmConfig{
+				K8SVersion:  "v1.28.0",
+				KubeContext: "prod",
+			},
+			helm: &argocd.ApplicationSourceHelm{},
+			assertions: func(
+				t *testing.T,
+				helm *argocd.ApplicationSourceHelm,
+				discoveries int,
+				err error,
+			) {
+				require.NoError(t, err)
+				require.Equal(t, "v1.28.0", helm.K8SVersion)
+				require.Equal(t, []string{"apps/v1"}, helm.APIVersions)
+				require.Equal(t, 1, discoveries)
+			},
+		},
+		{
+			name: "offline",
+			defaults: &branchHelmConfig{
+				K8SVersion:  "v1.28.0",
+				KubeContext: "prod",
+			},
+			helm:    &argocd.ApplicationSourceHelm{},
+			offline: true,
+			assertions: func(
+				t *testing.T,
+				_ *argocd.ApplicationSourceHelm,
+				discoveries int,
+				err error,
+			) {
+				offlineErr := &NetworkAccessRequiredError{}
+				require.ErrorAs(t, err, &offlineErr)
+				require.Zero(t, discoveries)
+			},
+		},
+		{
+			name:        "discovery fails",
+			defaults:    &branchHelmConfig{KubeContext: "prod"},
+			helm:        &argocd.ApplicationSourceHelm{},
+			discoverErr: errors.New("something went wrong"),
+			assertions: func(
+				t *testing.T,
+				_ *argocd.ApplicationSourceHelm,
+				_ int,
+				err error,
+			) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "something went wrong")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var discoveries int
+			s := &service{
+				discoverCapabilitiesFn: func(
+					kubeContext string,
+				) (kubernetes.Capabilities, error) {
+					require.Equal(t, "prod", kubeContext)
+					discoveries++
+					return kubernetes.Capabilities{
+						K8SVersion:  "v1.29.0",
+						APIVersions: []string{"apps/v1"},
+					}, testCase.discoverErr
+				},
+			}
+			rc := requestContext{
+				logger:  log.NewEntry(log.New()),
+				request: &Request{Offline: testCase.offline},
+				target: targetContext{
+					branchConfig: branchConfig{
+						Helm: testCase.defaults,
+						AppConfigs: map[string]appConfig{
+							"foo": {
+								ConfigManagement: argocd.ConfigManagementConfig{
+									Path: "foo",
+									Helm: testCase.helm,
+								},
+							},
+						},
+					},
+				},
+			}
+			err := s.applyHelmDefaults(rc)
+			testCase.assertions(
+				t,
+				rc.target.branchConfig.AppConfigs["foo"].ConfigManagement.Helm,
+				discoveries,
+				err,
+			)
+		})
+	}
+}
+
+func TestRenderLastMileSkipped(t *testing.T) {
+	rc := requestContext{
+		logger: log.NewEntry(log.New()),
+		request: &Request{
+			Options: map[string]string{OptionSkipLastMile: "true"},
+		},
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"my-app": {},
+	}
+	rc.target.prerenderedManifests = map[string][]byte{
+		"my-app": []byte("kind: ConfigMap\n"),
+	}
+	images, manifests, err := renderLastMile(context.Background(), rc)
+	require.NoError(t, err)
+	require.Nil(t, images)
+	require.Equal(
+		t,
+		map[string][]byte{"my-app": []byte("kind: ConfigMap\n")},
+		manifests,
+	)
+}
+
+func TestRenderLastMileSortedBySyncWave(t *testing.T) {
+	rc := requestContext{
+		logger: log.NewEntry(log.New()),
+		request: &Request{
+			Options: map[string]string{OptionSkipLastMile: "true"},
+		},
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"my-app": {SortBySyncWave: true},
+	}
+	rc.target.prerenderedManifests = map[string][]byte{
+		"my-app": []byte(syncOrderTestManifests),
+	}
+	_, manifests, err := renderLastMile(context.Background(), rc)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"kind: Job\nmetadata:\n  name: migrate\n  annotations:\n"+
+			"    argocd.argoproj.io/hook: PreSync\n"+
+			"---\nkind: ConfigMap\nmetadata:\n  name: config\n  annotations:\n"+
+			"    argocd.argoproj.io/sync-wave: \"-1\"\n"+
+			"---\nkind: Deployment\nmetadata:\n  name: app\n",
+		string(manifests["my-app"]),
+	)
+}
+
+// fakeHomeDirRepo is a git.Repo whose home directory can be specified by
+// tests.
+type fakeHomeDirRepo struct {
+	git.Repo
+	homeDir string
+}
+
+func (f *fakeHomeDirRepo) HomeDir() string {
+	return f.homeDir
+}
+
+func TestRenderLastMilePreservesSyncAnnotations(t *testing.T) {
+	if _, err := exec.LookPath("kustomize"); err != nil {
+		t.Skip("kustomize is not installed")
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{},
+		repo:    &fakeHomeDirRepo{homeDir: t.TempDir()},
+		timings: &timings{},
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"my-app": {},
+	}
+	rc.target.prerenderedManifests = map[string][]byte{
+		"my-app": []byte(syncOrderTestManifests),
+	}
+	_, manifests, err := renderLastMile(context.Background(), rc)
+	require.NoError(t, err)
+	resources, err := libManifests.SplitYAMLResources(manifests["my-app"])
+	require.NoError(t, err)
+	annotations := map[string]map[string]string{}
+	for _, resource := range resources {
+		annotations[resource.Name] = resource.Annotations
+	}
+	require.Equal(
+		t,
+		"PreSync",
+		annotations["migrate"]["argocd.argoproj.io/hook"],
+	)
+	require.Equal(
+		t,
+		"-1",
+		annotations["config"]["argocd.argoproj.io/sync-wave"],
+	)
+}
+
+// syncOrderTestManifests are manifests whose documents are not in the order
+// Argo CD would sync them.
+const syncOrderTestManifests = `kind: Deployment
+metadata:
+  name: app
+---
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    argocd.argoproj.io/sync-wave: "-1"
+---
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    argocd.argoproj.io/hook: PreSync
+`
+
+func TestWithAppTimeout(t *testing.T) {
+	// A timeout of zero means there is no limit
+	manifests, err := withAppTimeout(
+		context.Background(),
+		"my-app",
+		StagePreRender,
+		0,
+		func(ctx context.Context) ([]byte, error) {
+			_, ok := ctx.Deadline()
+			require.False(t, ok)
+			return []byte("kind: ConfigMap\n"), nil
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "kind: ConfigMap\n", string(manifests))
+
+	// Failures unrelated to the timeout are returned as is
+	testErr := errors.New("something went wrong")
+	_, err = withAppTimeout(
+		context.Background(),
+		"my-app",
+		StagePreRender,
+		time.Minute,
+		func(context.Context) ([]byte, error) {
+			return nil, testErr
+		},
+	)
+	require.ErrorIs(t, err, testErr)
+
+	// Rendering that outlasts the timeout is reported as having timed out
+	_, err = withAppTimeout(
+		context.Background(),
+		"my-app",
+		StageLastMile,
+		10*time.Millisecond,
+		func(ctx context.Context) ([]byte, error) {
+			<-ctx.Done()
+			return nil, fmt.Errorf("error running kustomize: %w", ctx.Err())
+		},
+	)
+	timeoutErr := &AppRenderTimeoutError{}
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(
+		t,
+		AppRenderTimeoutError{
+			App:     "my-app",
+			Stage:   StageLastMile,
+			Timeout: 10 * time.Millisecond,
+		},
+		*timeoutErr,
+	)
+
+	// Cancellation of the request as a whole is not mistaken for a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = withAppTimeout(
+		ctx,
+		"my-app",
+		StagePreRender,
+		time.Minute,
+		func(ctx context.Context) ([]byte, error) {
+			return nil, ctx.Err()
+		},
+	)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPreRenderTimeout(t *testing.T) {
+	s := &service{
+		renderFn: func(
+			ctx context.Context,
+			_ string,
+			cfg argocd.ConfigManagementConfig,
+			_ *commandTrace,
+		) ([]byte, error) {
+			if cfg.Path == "hangs" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return []byte("kind: ConfigMap\n"), nil
+		},
+	}
+	rc := requestContext{
+		logger:  log.NewEntry(log.New()),
+		request: &Request{},
+		timings: &timings{},
+		// The default is overridden by the app that hangs
+		renderTimeout: time.Hour,
+	}
+	rc.target.branchConfig.AppConfigs = map[string]appConfig{
+		"fine": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "fine"},
+		},
+		"hangs": {
+			ConfigManagement: argocd.ConfigManagementConfig{Path: "hangs"},
+			RenderTimeout:    "10ms",
+		},
+	}
+	_, err := s.preRender(context.Background(), rc, t.TempDir())
+	timeoutErr := &AppRenderTimeoutError{}
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, "hangs", timeoutErr.App)
+	require.Equal(t, StagePreRender, timeoutErr.Stage)
+	require.ErrorContains(t, err, "render timeout of 10ms")
+}
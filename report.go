@@ -0,0 +1,81 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/akuity/kargo-render/internal/manifests"
+)
+
+// buildReport summarizes the manifests rendered into the target branch,
+// along with the provided findings about them. If the target branch's
+// configuration does not enable reports, nil is returned.
+func buildReport(
+	rc requestContext,
+	violations []ResourcePolicyViolation,
+	duplicates []DuplicateResource,
+	unmatchedImages []string,
+) (*RenderReport, error) {
+	if !rc.target.branchConfig.Report {
+		return nil, nil
+	}
+	report := &RenderReport{
+		Apps:                     len(rc.target.renderedManifests),
+		ResourcesByKind:          map[string]int{},
+		ImagesByApp:              map[string][]string{},
+		ResourcePolicyViolations: len(violations),
+		DuplicateResources:       len(duplicates),
+		UnmatchedImages:          len(unmatchedImages),
+	}
+	for appName, manifest := range rc.target.renderedManifests {
+		report.Size += len(manifest)
+		resources, err := manifests.SplitYAMLResources(manifest)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error parsing rendered manifests for app %q: %w",
+				appName,
+				err,
+			)
+		}
+		report.Resources += len(resources)
+		for _, resource := range resources {
+			report.ResourcesByKind[resource.Kind]++
+		}
+		images, err :=
+			imageReferences(manifest, rc.target.branchConfig.ImageFields)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error finding images referenced by app %q: %w",
+				appName,
+				err,
+			)
+		}
+		if len(images) > 0 {
+			report.ImagesByApp[appName] = images
+		}
+	}
+	return report, nil
+}
+
+// writeReport writes the provided report to a .kargo-render/report.json file
+// relative to the specified directory. If the report is nil, any such file is
+// removed instead, so that a report does not outlive its being enabled.
+func writeReport(report *RenderReport, repoPath string) error {
+	path := filepath.Join(repoPath, ".kargo-render", "report.json")
+	if report == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing report: %w", err)
+		}
+		return nil
+	}
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling report: %w", err)
+	}
+	if err = os.WriteFile(path, append(bytes, '\n'), 0644); err != nil { // nolint: gosec
+		return fmt.Errorf("error writing report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildReport(t *testing.T) {
+	const fooManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: nginx:1.25
+      - name: sidecar
+        image: envoy:1.28
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+`
+	const barManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bar
+`
+	testCases := []struct {
+		name       string
+		rc         requestContext
+		assertions func(*testing.T, *RenderReport, error)
+	}{
+		{
+			name: "reports not enabled",
+			assertions: func(t *testing.T, report *RenderReport, err error) {
+				require.NoError(t, err)
+				require.Nil(t, report)
+			},
+		},
+		{
+			name: "reports enabled",
+			rc: requestContext{
+				target: targetContext{
+					branchConfig: branchConfig{Report: true},
+					renderedManifests: map[string][]byte{
+						"foo": []byte(fooManifest),
+						"bar": []byte(barManifest),
+					},
+				},
+			},
+			assertions: func(t *testing.T, report *RenderReport, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					&RenderReport{
+						Apps:      2,
+						Resources: 3,
+						ResourcesByKind: map[string]int{
+							"ConfigMap":  1,
+							"Deployment": 1,
+							"Service":    1,
+						},
+						Size: len(fooManifest) + len(barManifest),
+						ImagesByApp: map[string][]string{
+							"foo": {"envoy:1.28", "nginx:1.25"},
+						},
+						ResourcePolicyViolations: 1,
+						UnmatchedImages:          2,
+					},
+					report,
+				)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			report, err := buildReport(
+				testCase.rc,
+				[]ResourcePolicyViolation{{App: "foo", Kind: "Service"}},
+				nil,
+				[]string{"redis:7", "memcached:1"},
+			)
+			testCase.assertions(t, report, err)
+		})
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeBranchMetadata(branchMetadata{}, dir))
+	path := filepath.Join(dir, ".kargo-render", "report.json")
+
+	require.NoError(t, writeReport(&RenderReport{Apps: 1, Resources: 2}, dir))
+	reportBytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+	report := RenderReport{}
+	require.NoError(t, json.Unmarshal(reportBytes, &report))
+	require.Equal(t, RenderReport{Apps: 1, Resources: 2}, report)
+
+	// A nil report removes any previously written one
+	require.NoError(t, writeReport(nil, dir))
+	require.NoFileExists(t, path)
+	require.NoError(t, writeReport(nil, dir))
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// defaultVirtualNodes is the number of points on a HashRing assigned to each
+// replica when no other number is specified.
+const defaultVirtualNodes = 100
+
+// HashRing uses consistent hashing to assign each branch of each repository to
+// one of a set of replicas. A server running many replicas can use a HashRing
+// to route every request for a given branch to the same replica, keeping that
+// replica's workspaces and caches for the repository warm. When a replica is
+// added or removed, only the branches assigned to it are reassigned.
+type HashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+// NewHashRing returns a HashRing that assigns branches to the specified
+// replicas, each of which is placed on the ring at the specified number of
+// points. More points result in a more even distribution of branches. If
+// virtualNodes is not specified, it defaults to 100.
+func NewHashRing(replicas []string, virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	h := &HashRing{
+		points: make([]uint64, 0, len(replicas)*virtualNodes),
+		owners: make(map[uint64]string, len(replicas)*virtualNodes),
+	}
+	for _, replica := range replicas {
+		for i := 0; i < virtualNodes; i++ {
+			point := hashRingPoint(fmt.Sprintf("%s#%d", replica, i))
+			if _, ok := h.owners[point]; ok {
+				// Collisions are vanishingly unlikely, but the first replica to
+				// claim a point keeps it so the result is deterministic
+				continue
+			}
+			h.owners[point] = replica
+			h.points = append(h.points, point)
+		}
+	}
+	sort.Slice(h.points, func(i, j int) bool {
+		return h.points[i] < h.points[j]
+	})
+	return h
+}
+
+// Owner returns the replica to which the specified branch of the specified
+// repository is assigned. If the HashRing has no replicas, an empty string is
+// returned.
+func (h *HashRing) Owner(repoURL, branch string) string {
+	if len(h.points) == 0 {
+		return ""
+	}
+	point := hashRingPoint(branchKey(repoURL, branch))
+	i := sort.Search(len(h.points), func(i int) bool {
+		return h.points[i] >= point
+	})
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.owners[h.points[i]]
+}
+
+// hashRingPoint returns the point on a HashRing corresponding to the provided
+// string.
+func hashRingPoint(s string) uint64 {
+	digest := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(digest[:8])
+}
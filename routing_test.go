@@ -0,0 +1,42 @@
+package render
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRing(t *testing.T) {
+	require.Empty(t, NewHashRing(nil, 0).Owner("https://github.com/akuity/foobar", "env/dev"))
+
+	replicas := []string{"replica-0", "replica-1", "replica-2"}
+	ring := NewHashRing(replicas, 0)
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 300; i++ {
+		branch := fmt.Sprintf("env/%d", i)
+		owner := ring.Owner("https://github.com/akuity/foobar", branch)
+		require.Contains(t, replicas, owner)
+		// Assignments are stable
+		require.Equal(t, owner, ring.Owner("https://github.com/akuity/foobar", branch))
+		// Branches are identified the same way regardless of how they're named
+		require.Equal(
+			t,
+			owner,
+			ring.Owner("https://github.com/akuity/foobar", "refs/heads/"+branch),
+		)
+		counts[owner]++
+		owners[branch] = owner
+	}
+	// Every replica is assigned some branches
+	require.Len(t, counts, len(replicas))
+
+	// Removing a replica only reassigns the branches that were assigned to it
+	ring = NewHashRing(replicas[:2], 0)
+	for branch, owner := range owners {
+		if owner != "replica-2" {
+			require.Equal(t, owner, ring.Owner("https://github.com/akuity/foobar", branch))
+		}
+	}
+}
@@ -2,37 +2,262 @@ package render
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
 
 	"github.com/akuity/kargo-render/internal/argocd"
+	"github.com/akuity/kargo-render/internal/github"
+	"github.com/akuity/kargo-render/internal/kubernetes"
 	"github.com/akuity/kargo-render/internal/manifests"
+	"github.com/akuity/kargo-render/internal/version"
 	"github.com/akuity/kargo-render/pkg/git"
 )
 
 type ServiceOptions struct {
 	LogLevel LogLevel
+	// RepoCredsFn is an optional function that, when specified, is invoked to
+	// obtain fresh credentials for the remote GitOps repository before any
+	// operation that writes to it. This is useful when credentials are
+	// short-lived tokens that might expire over the course of a long-running
+	// rendering request.
+	RepoCredsFn func(ctx context.Context, repoURL string) (RepoCredentials, error)
+	// OAuthRefreshTokenFn is an optional function that is invoked whenever a
+	// provider issues a new refresh token in exchange for the one in a
+	// request's RepoCredentials.OAuthRefresh, as GitLab does each time a
+	// refresh token is used. Providers that do so invalidate the old refresh
+	// token, so the new one should be stored for use in future requests.
+	OAuthRefreshTokenFn func(ctx context.Context, repoURL string, refreshToken string)
+	// GitCommandTimeout, if non-zero, is the maximum amount of time any single
+	// git command may run before it is killed.
+	GitCommandTimeout time.Duration
+	// KeepWorkspacesOnError specifies whether the temporary directories used in
+	// handling a rendering request should be preserved for inspection when the
+	// request fails. When this is true, the path to the preserved workspace is
+	// included in the returned error.
+	KeepWorkspacesOnError bool
+	// KeptWorkspaceTTL specifies how long workspaces preserved due to
+	// KeepWorkspacesOnError should be retained before they are automatically
+	// garbage collected. If not specified, this defaults to 24 hours.
+	KeptWorkspaceTTL time.Duration
+	// PlanSigningKey is an optional key used to sign the tokens of Plans
+	// created by the Service. When specified, Plans created by one Service can
+	// only be applied by a Service configured with the same key.
+	PlanSigningKey []byte
+	// AllowedConfigManagement optionally restricts which configuration
+	// management tools may be used to render manifests. Requests that would
+	// require any other tool, whether explicitly configured or inferred from
+	// the contents of an app's directory, are refused. This is useful for
+	// shared deployments that render manifests from repositories that are not
+	// fully trusted, for instance to forbid config management plugins, which
+	// execute arbitrary commands. If nil, all tools are allowed.
+	AllowedConfigManagement []ConfigManagementTool
+	// CommitSignaturePolicies optionally require that source commits rendered
+	// into particular target branches are signed by trusted keys. Every policy
+	// that applies to a request's target branch must be satisfied.
+	CommitSignaturePolicies []CommitSignaturePolicy
+	// RequiredChecksPolicies optionally require that status checks on source
+	// commits rendered into particular target branches have passed. Every
+	// policy that applies to a request's target branch must be satisfied. The
+	// request's repository credentials are used to query the git provider.
+	RequiredChecksPolicies []RequiredChecksPolicy
+	// Kubeconfig is an optional path to a kubeconfig file containing the
+	// contexts that branch configurations may reference in order to discover
+	// the capabilities of the clusters they are deployed to. If not specified,
+	// the KUBECONFIG environment variable is honored and ~/.kube/config is
+	// used as a fallback.
+	Kubeconfig string
+	// EventSink is an optional EventSink to which CloudEvents describing the
+	// progress and outcome of each rendering request and each applied Plan are
+	// emitted. This gives other platforms a push-based integration with Kargo
+	// Render instead of having to poll the repository. Creating a Plan emits no
+	// events. Events are delivered in the background, so a slow EventSink never
+	// delays requests. See AsyncEventSink.
+	EventSink EventSink
+	// CloneCacheDir is an optional path to a directory in which the Service
+	// keeps mirrors of remote repositories, populated using WarmUp. When a
+	// mirror of a repository exists, cloning the repository copies objects
+	// from the mirror instead of fetching them all from the remote repository.
+	CloneCacheDir string
+	// CloneStrategy determines how much of a remote repository is fetched when
+	// the Service clones it. If not specified, CloneStrategyFull is used.
+	CloneStrategy CloneStrategy
+	// CloneFilter is the filter spec (see git rev-list --filter) that
+	// determines which content CloneStrategyPartial defers fetching until it
+	// is needed. If not specified, the contents of all files are deferred.
+	CloneFilter string
+	// PartialCloneThreshold is the size, in bytes, of the objects of a full
+	// clone of a repository above which CloneStrategyAuto clones the
+	// repository partially thereafter. If not specified, this defaults to 256
+	// MiB.
+	PartialCloneThreshold int64
+	// ArtifactsDir is an optional path to a directory in which the Service
+	// persists the rendered manifests, and the diff they introduced, of every
+	// rendering request that results in a commit. The ArtifactsID field of the
+	// request's Response identifies them, and they can be retrieved, by the
+	// request's Tenant, using LoadArtifacts. Nothing is ever removed from the
+	// directory by the Service; use PruneArtifacts to remove old artifacts.
+	ArtifactsDir string
+	// UserAgent is sent as the User-Agent header of every HTTP(S) request made
+	// to a git provider, whether by git itself or to the provider's API. If not
+	// specified, this defaults to kargo-render/<version>.
+	UserAgent string
+	// HTTPHeaders are additional headers, indexed by name, that are sent with
+	// every HTTP(S) request made to a git provider. This permits enterprise
+	// proxies and audit systems to attribute traffic to Kargo Render.
+	HTTPHeaders map[string]string
+	// KustomizeBinaryPath is an optional path to the kustomize binary used to
+	// render Kustomize-based apps. If not specified, kustomize is found using
+	// the PATH environment variable. Unlike the environment variables
+	// consulted by Argo CD, this affects only this Service, so Services with
+	// different settings may render concurrently in one process.
+	KustomizeBinaryPath string
+	// RenderTimeout, if non-zero, is the maximum amount of time each stage of
+	// rendering the manifests of any single app, such as pre-rendering or
+	// last-mile rendering, may take. An app's configuration may specify its own
+	// renderTimeout, which takes precedence. When rendering an app times out,
+	// an *AppRenderTimeoutError is returned.
+	RenderTimeout time.Duration
+	// ProgressFn is an optional function that is invoked synchronously as each
+	// stage of handling a request begins. This is useful for giving humans
+	// feedback during long renders. If the Service handles requests
+	// concurrently, it must be safe for concurrent use.
+	ProgressFn func(Progress)
+	// SSHAgent specifies that SSH private keys in requests' RepoCredentials
+	// should be held in memory by an SSH agent that runs within the Service's
+	// process, instead of being written to the temporary home directories of
+	// the repositories they are used with, so that they are never written to
+	// disk.
+	SSHAgent bool
+	// ToolEnv maps the name of a tool (helm, kustomize, or ytt) to environment
+	// variables that processes running the tool may inherit from the Service's
+	// process. Child processes otherwise inherit only variables that locate
+	// executables and temporary files and configure locales and proxies, along
+	// with those that configure the tool itself, such as HELM_*, so that
+	// secrets in the environment are not exposed to templates. An entry ending
+	// in * matches every variable whose name begins with what precedes it.
+	ToolEnv map[string][]string
+	// MaxConcurrentRequests, if positive, is the maximum number of requests the
+	// Service handles at once. Further requests wait until one finishes, or
+	// until their context is done. Pipelines, whose stages callers may run at
+	// any time, are not counted. If not specified, the number is unlimited.
+	MaxConcurrentRequests int
+	// PreCommitHook is an optional function that is invoked with a summary of
+	// the changes rendered in response to a request right before they are
+	// committed, whether they are to be pushed directly to the target branch
+	// or proposed by a pull request. If it returns an error, nothing is
+	// committed and the request fails with a *CommitVetoedError wrapping the
+	// error. This permits embedders to enforce policies of their own. Files
+	// the hook writes to CommitSummary.WorkingDir, such as records of
+	// deployment tickets, are included in the commit. If the Service handles
+	// requests concurrently, it must be safe for concurrent use.
+	PreCommitHook func(ctx context.Context, summary CommitSummary) error
 }
 
 // Service is an interface for components that can handle rendering requests.
-// Implementations of this interface are transport-agnostic.
+// Implementations of this interface are transport-agnostic and safe for
+// concurrent use by multiple goroutines. Requests are handled independently of
+// one another, each in a workspace of its own. Since a request may be modified
+// while it is handled, the same *Request must not be passed to concurrent
+// calls.
 type Service interface {
 	// RenderManifests handles a rendering request.
 	RenderManifests(context.Context, *Request) (Response, error)
+	// Plan handles a rendering request without writing anything to the remote
+	// repository, instead returning a Plan describing exactly what handling the
+	// request would change.
+	Plan(context.Context, *Request) (Plan, error)
+	// Apply makes exactly the changes described by a previously created Plan.
+	Apply(context.Context, *ApplyRequest) (Response, error)
+	// WarmUp prepares the Service to quickly handle future rendering requests
+	// for a repository.
+	WarmUp(context.Context, *WarmUpRequest) (WarmUpResponse, error)
+	// RenderWorkspace renders manifests from a workspace prepared by the
+	// caller into a working tree of the target branch, also prepared by the
+	// caller, without performing any git operations.
+	RenderWorkspace(context.Context, *WorkspaceRequest) (WorkspaceResponse, error)
+	// NewPipeline returns a Pipeline for handling a rendering request in
+	// stages, so that callers can run only some of them.
+	NewPipeline(*Request) (*Pipeline, error)
 }
 
 type service struct {
-	logger   *log.Logger
+	logger                  *log.Logger
+	repoCredsFn             func(context.Context, string) (RepoCredentials, error)
+	oauthRefreshTokenFn     func(context.Context, string, string)
+	gitCommandTimeout       time.Duration
+	keepWorkspacesOnError   bool
+	keptWorkspaceTTL        time.Duration
+	planSigningKey          []byte
+	allowedConfigManagement []ConfigManagementTool
+	commitSignaturePolicies []CommitSignaturePolicy
+	requiredChecksPolicies  []RequiredChecksPolicy
+	discoverCapabilitiesFn  func(kubeContext string) (kubernetes.Capabilities, error)
+	eventSink               EventSink
+	cloneCacheDir           string
+	cloneStrategyOpt        CloneStrategy
+	cloneFilter             string
+	partialCloneThreshold   int64
+	artifactsDir            string
+	userAgent               string
+	httpHeaders             map[string]string
+	progressFn              func(Progress)
+	sshAgent                bool
+	toolEnv                 map[string][]string
+	renderTimeout           time.Duration
+	preCommitHook           func(context.Context, CommitSummary) error
+	getCheckStatesFn        func(
+		ctx context.Context,
+		repoURL string,
+		commit string,
+		repoCreds git.RepoCredentials,
+		clientOpts *github.ClientOptions,
+	) (map[string]github.CheckState, error)
+	listOpenPRsFn func(
+		ctx context.Context,
+		repoURL string,
+		targetBranch string,
+		headBranchPrefix string,
+		repoCreds git.RepoCredentials,
+		clientOpts *github.ClientOptions,
+	) ([]github.PR, error)
+	pushCommitsFn func(
+		ctx context.Context,
+		repoURL string,
+		branch string,
+		parent string,
+		commits []github.Commit,
+		repoCreds git.RepoCredentials,
+		clientOpts *github.ClientOptions,
+	) (string, error)
 	renderFn func(
 		ctx context.Context,
 		repoRoot string,
 		cfg argocd.ConfigManagementConfig,
+		trace *commandTrace,
 	) ([]byte, error)
+	resolveRemoteRefFn func(
+		ctx context.Context,
+		repoURL string,
+		ref string,
+		trace *commandTrace,
+	) (string, error)
+	// repoSizes maps the URLs of remote repositories to the size, in bytes, of
+	// the objects of their most recent full clone.
+	repoSizes sync.Map
+	// requestSlots holds a value for every request being handled, if the number
+	// of requests handled at once is limited. Otherwise, it is nil.
+	requestSlots chan struct{}
 }
 
 // NewService returns an implementation of the Service interface for
@@ -44,337 +269,451 @@ func NewService(opts *ServiceOptions) Service {
 	if opts.LogLevel == 0 {
 		opts.LogLevel = LogLevelInfo
 	}
+	if opts.KeptWorkspaceTTL == 0 {
+		opts.KeptWorkspaceTTL = 24 * time.Hour
+	}
+	if opts.PartialCloneThreshold == 0 {
+		opts.PartialCloneThreshold = defaultPartialCloneThreshold
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "kargo-render/" + version.GetVersion().Version
+	}
 	logger := log.New()
 	logger.SetLevel(log.Level(opts.LogLevel))
-	return &service{
-		logger:   logger,
-		renderFn: argocd.Render,
+	// Render timeouts are enforced per app, since apps may override them
+	renderOpts := &argocd.RenderOptions{
+		KustomizeBinaryPath: opts.KustomizeBinaryPath,
 	}
+	eventSink := opts.EventSink
+	if _, ok := eventSink.(*AsyncEventSink); !ok && eventSink != nil {
+		asyncSink := NewAsyncEventSink(eventSink, 0)
+		asyncSink.onError = func(event Event, err error) {
+			logger.WithField("eventType", event.Type).WithError(err).
+				Error("error emitting event")
+		}
+		eventSink = asyncSink
+	}
+	svc := &service{
+		logger:                  logger,
+		repoCredsFn:             opts.RepoCredsFn,
+		oauthRefreshTokenFn:     opts.OAuthRefreshTokenFn,
+		gitCommandTimeout:       opts.GitCommandTimeout,
+		keepWorkspacesOnError:   opts.KeepWorkspacesOnError,
+		keptWorkspaceTTL:        opts.KeptWorkspaceTTL,
+		planSigningKey:          opts.PlanSigningKey,
+		allowedConfigManagement: opts.AllowedConfigManagement,
+		commitSignaturePolicies: opts.CommitSignaturePolicies,
+		requiredChecksPolicies:  opts.RequiredChecksPolicies,
+		eventSink:               eventSink,
+		cloneCacheDir:           opts.CloneCacheDir,
+		cloneStrategyOpt:        opts.CloneStrategy,
+		cloneFilter:             opts.CloneFilter,
+		partialCloneThreshold:   opts.PartialCloneThreshold,
+		artifactsDir:            opts.ArtifactsDir,
+		userAgent:               opts.UserAgent,
+		httpHeaders:             opts.HTTPHeaders,
+		progressFn:              opts.ProgressFn,
+		sshAgent:                opts.SSHAgent,
+		toolEnv:                 opts.ToolEnv,
+		renderTimeout:           opts.RenderTimeout,
+		preCommitHook:           opts.PreCommitHook,
+		discoverCapabilitiesFn: func(
+			kubeContext string,
+		) (kubernetes.Capabilities, error) {
+			return kubernetes.DiscoverCapabilities(opts.Kubeconfig, kubeContext)
+		},
+		getCheckStatesFn: github.GetCheckStates,
+		listOpenPRsFn:    github.ListOpenPRs,
+		pushCommitsFn:    github.PushCommits,
+		renderFn: func(
+			ctx context.Context,
+			repoRoot string,
+			cfg argocd.ConfigManagementConfig,
+			trace *commandTrace,
+		) ([]byte, error) {
+			appRenderOpts := *renderOpts
+			appRenderOpts.Observer = trace.observeResult
+			return argocd.Render(ctx, repoRoot, cfg, &appRenderOpts)
+		},
+		resolveRemoteRefFn: func(
+			ctx context.Context,
+			repoURL string,
+			ref string,
+			trace *commandTrace,
+		) (string, error) {
+			return lsRemote(
+				ctx,
+				repoURL,
+				ref,
+				opts.ToolEnv,
+				opts.GitCommandTimeout,
+				trace,
+			)
+		},
+	}
+	if opts.MaxConcurrentRequests > 0 {
+		svc.requestSlots = make(chan struct{}, opts.MaxConcurrentRequests)
+	}
+	return svc
 }
 
-// nolint: gocyclo
 func (s *service) RenderManifests(
 	ctx context.Context,
 	req *Request,
 ) (Response, error) {
-	req.id = uuid.NewString()
-
-	logger := s.logger.WithField("request", req.id)
-	startEndLogger := logger.WithFields(log.Fields{
-		"repo":         req.RepoURL,
-		"targetBranch": req.TargetBranch,
-	})
-
-	startEndLogger.Debug("handling rendering request")
-
-	res := Response{}
-
-	var err error
-	if err = req.canonicalizeAndValidate(); err != nil {
-		return res, err
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return Response{}, err
 	}
-	startEndLogger.Debug("validated rendering request")
+	defer release()
+	return s.withEvents(
+		ctx,
+		req.RepoURL,
+		req.TargetBranch,
+		func() (Response, error) {
+			return s.renderManifests(ctx, req, nil)
+		},
+	)
+}
 
-	rc := requestContext{
-		logger:  logger,
-		request: req,
+// renderManifests handles a rendering request by running every stage of a
+// Pipeline in order. If plan is non-nil, nothing is written to the remote
+// repository and the changes that would have been written are recorded in plan
+// instead.
+func (s *service) renderManifests(
+	ctx context.Context,
+	req *Request,
+	plan *Plan,
+) (res Response, err error) {
+	p, err := s.newPipeline(req, plan)
+	if err != nil {
+		return res, err
 	}
-
-	if rc.request.LocalInPath != "" {
-
-		// We'll be taking our input from a local directory which is presumably
-		// a git repository with the desired source commit already checked out.
-		//
-		// This is mainly useful when Kargo proper wishes to handle the reading and
-		// writing to/from remote repositories itself, leaving Kargo Render to
-		// handle rendering only.
-
-		if rc.repo, err = git.CopyRepo(
-			rc.request.LocalInPath,
-			git.RepoCredentials(rc.request.RepoCreds),
-		); err != nil {
-			return res, fmt.Errorf("error copying local repository: %w", err)
-		}
-		// Check if the working tree is dirty
-		var isDirty bool
-		if isDirty, err = rc.repo.HasDiffs(); err != nil {
-			return res, fmt.Errorf("error checking for diffs: %w", err)
-		}
-		if isDirty {
-			return res, errors.New("working tree is dirty; refusing to proceed")
+	defer func() {
+		if closeErr := p.Close(); closeErr != nil {
+			err = closeErr
 		}
-		// Check that there is exactly one remote and it's named "origin"
-		var remotes []string
-		if remotes, err = rc.repo.Remotes(); err != nil {
-			return res, fmt.Errorf("error getting remotes: %w", err)
+		res = p.Response()
+	}()
+	for _, stage := range []func(context.Context) error{
+		p.PrepareWorkspace,
+		p.LoadConfig,
+		p.PreRenderApps,
+		p.LastMile,
+		p.WriteOutputs,
+	} {
+		if err = stage(ctx); err != nil {
+			return res, err
 		}
-		if len(remotes) != 1 || remotes[0] != git.RemoteOrigin {
-			return res, errors.New(
-				"local repository must have exactly one remote, which must be " +
-					"named \"origin\"; refusing to proceed",
-			)
-		}
-
-	} else {
+	}
+	_, err = p.Publish(ctx)
+	return res, err
+}
 
-		// Clone the remote repository ourselves
+// commitAndPublish commits all changes in the working tree of the commit
+// branch, separately for each app if the target branch is so configured,
+// pushes the commit branch to the remote repository, and, if applicable,
+// opens a PR to the target branch. The provided Response is updated
+// accordingly and returned.
+func (s *service) commitAndPublish(
+	ctx context.Context,
+	rc requestContext,
+	res Response,
+) (Response, error) {
+	if rc.request.ReadOnly {
+		return res, errors.New(
+			"refusing to write to the remote repository in response to a " +
+				"read-only request",
+		)
+	}
 
-		if rc.repo, err = git.Clone(
-			rc.request.RepoURL,
-			git.RepoCredentials{
-				SSHPrivateKey: rc.request.RepoCreds.SSHPrivateKey,
-				Username:      rc.request.RepoCreds.Username,
-				Password:      rc.request.RepoCreds.Password,
-			},
-		); err != nil {
-			return res, fmt.Errorf("error cloning remote repository: %w", err)
-		}
+	var err error
 
+	// Commit the changes
+	commitStart := rc.timings.start(StageCommit)
+	if err = rc.repo.AddAll(ctx); err != nil {
+		return res, fmt.Errorf("error committing manifests: %w", err)
 	}
-	defer rc.repo.Close()
-
-	// TODO: Add some logging to this block
-	if rc.request.LocalInPath != "" || rc.request.Ref == "" {
-		// For either of these mutually exclusive cases, we don't know the source
-		// commit yet
-		if rc.source.commit, err = rc.repo.LastCommitID(); err != nil {
-			return res, fmt.Errorf("error getting last commit ID: %w", err)
-		}
-	} else {
-		if err = rc.repo.Checkout(rc.request.Ref); err != nil {
-			return res, fmt.Errorf("error checking out %q: %w", rc.request.Ref, err)
-		}
-		if rc.intermediate.branchMetadata, err =
-			loadBranchMetadata(rc.repo.WorkingDir()); err != nil {
-			return res, fmt.Errorf("error loading branch metadata: %w", err)
+	if err = s.runPreCommitHook(ctx, rc); err != nil {
+		return res, err
+	}
+	commitRemaining := true
+	if rc.target.branchConfig.CommitPerApp {
+		if err = commitAppGroups(ctx, rc); err != nil {
+			return res, err
 		}
-		if rc.intermediate.branchMetadata == nil {
-			// We're not on a target branch. We're sitting on the source commit.
-			if rc.source.commit, err = rc.repo.LastCommitID(); err != nil {
-				return res, fmt.Errorf("error getting last commit ID: %w", err)
-			}
-		} else {
-			// Follow the branch metadata back to the real source commit
-			if err = rc.repo.Checkout(
-				rc.intermediate.branchMetadata.SourceCommit,
-			); err != nil {
-				return res, fmt.Errorf(
-					"error checking out %q: %w",
-					rc.intermediate.branchMetadata.SourceCommit,
-					err,
-				)
-			}
-			rc.source.commit = rc.intermediate.branchMetadata.SourceCommit
+		// Everything may already have been committed
+		var diffPaths []string
+		if diffPaths, err = rc.repo.GetStagedDiffPaths(ctx); err != nil {
+			return res, fmt.Errorf("error checking for diffs: %w", err)
 		}
+		commitRemaining = len(diffPaths) > 0
 	}
-
-	repoConfig, err := loadRepoConfig(rc.repo.WorkingDir())
-	if err != nil {
-		return res,
-			fmt.Errorf("error loading Kargo Render configuration from repo: %w", err)
+	if commitRemaining {
+		if err = rc.repo.Commit(
+			ctx,
+			rc.target.commit.message,
+			commitOptions(rc),
+		); err != nil {
+			return res, fmt.Errorf("error committing manifests: %w", err)
+		}
 	}
-	if rc.target.branchConfig, err =
-		repoConfig.GetBranchConfig(rc.request.TargetBranch); err != nil {
+	rc.timings.record(StageCommit, "", commitStart)
+	if rc.target.commit.id, err = rc.repo.LastCommitID(ctx); err != nil {
 		return res, fmt.Errorf(
-			"error loading configuration for branch %q: %w",
-			rc.request.TargetBranch,
+			"error getting last commit ID from the commit branch: %w",
 			err,
 		)
 	}
+	rc.logger.WithFields(log.Fields{
+		"commitBranch": rc.target.commit.branch,
+		"commitID":     rc.target.commit.id,
+	}).Debug("committed all changes")
 
-	if len(rc.target.branchConfig.AppConfigs) == 0 {
-		rc.target.branchConfig.AppConfigs = map[string]appConfig{
-			"app": {
-				ConfigManagement: argocd.ConfigManagementConfig{
-					Path: rc.request.TargetBranch,
-				},
-			},
-		}
-	}
+	return s.publish(ctx, rc, res)
+}
 
-	if rc.target.prerenderedManifests, err =
-		s.preRender(ctx, rc, rc.repo.WorkingDir()); err != nil {
-		return res, fmt.Errorf("error pre-rendering manifests: %w", err)
+// commitOptions returns options for making commits on behalf of the request.
+func commitOptions(rc requestContext) *git.CommitOptions {
+	commitOpts := &git.CommitOptions{}
+	if author := rc.request.CommitAuthor; author != nil {
+		commitOpts.Author = fmt.Sprintf("%s <%s>", author.Name, author.Email)
 	}
+	return commitOpts
+}
 
-	if err = switchToTargetBranch(rc); err != nil {
-		return res, fmt.Errorf("error switching to target branch: %w", err)
+// publish pushes the commit branch, including every commit made to it while
+// handling the request, to the remote repository, and, if applicable, opens a
+// PR to the target branch. The provided Response is updated accordingly and
+// returned.
+func (s *service) publish(
+	ctx context.Context,
+	rc requestContext,
+	res Response,
+) (Response, error) {
+	if rc.request.ReadOnly {
+		return res, errors.New(
+			"refusing to write to the remote repository in response to a " +
+				"read-only request",
+		)
 	}
 
-	oldTargetBranchMetadata, err := loadBranchMetadata(rc.repo.WorkingDir())
-	if err != nil {
-		return res, fmt.Errorf("error loading branch metadata: %w", err)
-	}
-	if oldTargetBranchMetadata == nil {
-		// The target branch doesn't appear to already be managed by Kargo Render.
-		// We'll let this slide if the branch is 100% empty, but we'll refuse to
-		// proceed otherwise.
-		var fileInfos []os.DirEntry
-		if fileInfos, err = os.ReadDir(rc.repo.WorkingDir()); err != nil {
-			return res, fmt.Errorf("error reading directory contents: %w", err)
+	var err error
+
+	// Push the commit branch to the remote
+	if err = s.refreshRepoCreds(ctx, rc); err != nil {
+		return res, err
+	}
+	pushStart := rc.timings.start(StagePush)
+	if rc.request.boolOption(OptionPushViaAPI) {
+		// The provider creates new commits, so the ID of the commit at the head
+		// of the commit branch changes
+		if rc.target.commit.id, err = s.pushViaAPI(ctx, rc); err != nil {
+			return res, fmt.Errorf(
+				"error pushing commit branch to remote via API: %w",
+				err,
+			)
 		}
-		if len(fileInfos) != 1 && fileInfos[0].Name() != ".git" {
+	} else if err = rc.repo.Push(ctx); err != nil {
+		prs := rc.target.branchConfig.PRs
+		if prs.Enabled || !prs.OpenOnRejectedPush ||
+			!errors.Is(err, git.ErrPushRejected) {
 			return res, fmt.Errorf(
-				"target branch %q already exists, but does not appear to be managed by "+
-					"Kargo Render; refusing to overwrite branch contents",
-				rc.request.TargetBranch,
+				"error pushing commit branch to remote: %w",
+				err,
 			)
 		}
-		rc.target.oldBranchMetadata = branchMetadata{}
-	} else {
-		rc.target.oldBranchMetadata = *oldTargetBranchMetadata
+		if rc.target.commit.branch, err = pushToPRBranch(ctx, rc); err != nil {
+			return res, err
+		}
+		res.Warnings = append(
+			res.Warnings,
+			fmt.Sprintf(
+				"direct push to target branch %q was rejected; opening a pull "+
+					"request from branch %q instead",
+				rc.request.TargetBranch,
+				rc.target.commit.branch,
+			),
+		)
+		rc.logger.WithField("commitBranch", rc.target.commit.branch).
+			Warn("direct push to target branch was rejected; falling back to PR")
 	}
+	rc.timings.record(StagePush, "", pushStart)
+	rc.logger.WithField("commitBranch", rc.target.commit.branch).
+		Debug("pushed commit branch to remote")
 
-	if rc.target.commit.branch, err = switchToCommitBranch(rc); err != nil {
-		return res, fmt.Errorf("error switching to commit branch: %w", err)
+	// Metadata stored outside of the target branch describes the commit that
+	// was pushed to it, so it can only be stored now
+	if rc.target.metadataStorage.external() &&
+		rc.target.commit.branch == rc.request.TargetBranch {
+		if err = storeBranchMetadata(ctx, rc); err != nil {
+			return res, fmt.Errorf("error storing branch metadata: %w", err)
+		}
+		rc.logger.WithField("metadataStorage", rc.target.metadataStorage).
+			Debug("stored branch metadata")
 	}
 
-	if rc.target.commit.branch != rc.request.TargetBranch {
-		// The commit branch isn't the target branch and we should take into account
-		// any metadata that already exists in the commit branch, in case that
-		// branch already existed.
-		if rc.target.commit.oldBranchMetadata, err =
-			loadBranchMetadata(rc.repo.WorkingDir()); err != nil {
-			return res, fmt.Errorf("error loading branch metadata: %w", err)
+	// Open a PR if requested or if falling back to one
+	if rc.target.branchConfig.PRs.Enabled ||
+		rc.target.commit.branch != rc.request.TargetBranch {
+		if err = s.refreshRepoCreds(ctx, rc); err != nil {
+			return res, err
+		}
+		prStart := rc.timings.start(StagePR)
+		if res.PullRequestURL, err = s.openPR(ctx, rc); err != nil {
+			return res,
+				fmt.Errorf("error opening pull request to the target branch: %w", err)
+		}
+		rc.timings.record(StagePR, "", prStart)
+		if res.PullRequestURL == "" {
+			res.ActionTaken = ActionTakenUpdatedPR
+			if pr := rc.target.commit.reusedPR; pr != nil {
+				res.PullRequestURL = pr.URL
+			}
+			rc.logger.Debug("updated existing PR")
+		} else {
+			res.ActionTaken = ActionTakenOpenedPR
+			rc.logger.WithField("prURL", res.PullRequestURL).Debug("opened PR")
 		}
+	} else {
+		res.ActionTaken = ActionTakenPushedDirectly
+		res.CommitID = rc.target.commit.id
 	}
+	return res, nil
+}
 
-	rc.target.newBranchMetadata.SourceCommit = rc.source.commit
-	if rc.target.newBranchMetadata.ImageSubstitutions,
-		rc.target.renderedManifests,
-		err =
-		renderLastMile(ctx, rc); err != nil {
-		return res, fmt.Errorf("error in last-mile manifest rendering: %w", err)
+// repoOptions returns options for cloning or copying a repository on behalf
+// of a single request.
+func (s *service) repoOptions(logger *log.Entry) *git.RepoOptions {
+	return &git.RepoOptions{
+		CommandTimeout: s.gitCommandTimeout,
+		Logger:         logger,
+		UserAgent:      s.userAgent,
+		HTTPHeaders:    s.httpHeaders,
+		SSHAgent:       s.sshAgent,
 	}
+}
 
-	// If we're writing to stdout, we're done
-	if rc.request.Stdout {
-		res.ActionTaken = ActionTakenNone
-		res.Manifests = rc.target.renderedManifests
-		return res, nil
+// githubClientOptions returns options for requests the service makes to the
+// GitHub API on behalf of a request, whose logger is provided.
+func (s *service) githubClientOptions(logger *log.Entry) *github.ClientOptions {
+	return &github.ClientOptions{
+		UserAgent: s.userAgent,
+		Headers:   s.httpHeaders,
+		Logger:    logger,
 	}
+}
 
-	// Figure out where we're writing to
-	outputDir := rc.repo.WorkingDir()
-	if rc.request.LocalOutPath != "" {
-		outputDir = rc.request.LocalOutPath
-		if err = copyBranchContents(rc.repo.WorkingDir(), outputDir); err != nil {
-			return res, fmt.Errorf(
-				"error copying branch contents to local output directory %q: %w",
-				outputDir,
-				err,
-			)
-		}
-		defer func() {
-			if err != nil {
-				if rmErr := os.RemoveAll(outputDir); rmErr != nil {
-					logger.WithError(err).Error(
-						"error cleaning up local output directory",
-					)
-				}
-			}
-		}()
-	}
+// cloneOptions returns the provided options, updated for cloning the
+// specified remote repository. If the service has a clone cache, the
+// repository's mirror in the cache, if any, is used as a reference. The
+// repository is cloned using the strategy returned by cloneStrategy.
+func (s *service) cloneOptions(
+	opts *git.RepoOptions,
+	repoURL string,
+) *git.RepoOptions {
+	opts.ReferenceDir = s.mirrorDir(repoURL)
+	opts.CloneStrategy = git.CloneStrategy(s.cloneStrategy(repoURL))
+	opts.CloneFilter = s.cloneFilter
+	return opts
+}
 
-	// Write branch metadata
-	if err = writeBranchMetadata(
-		rc.target.newBranchMetadata,
-		outputDir,
-	); err != nil {
-		return res, fmt.Errorf("error writing branch metadata: %w", err)
+// mirrorDir returns the path to the mirror of the specified remote repository
+// in the service's clone cache. If the service has no clone cache, an empty
+// string is returned.
+func (s *service) mirrorDir(repoURL string) string {
+	if s.cloneCacheDir == "" {
+		return ""
 	}
-	logger.WithField("sourceCommit", rc.source.commit).
-		Debug("wrote branch metadata")
+	urlDigest := sha256.Sum256([]byte(strings.TrimSpace(repoURL)))
+	return filepath.Join(
+		s.cloneCacheDir,
+		hex.EncodeToString(urlDigest[:16])+".git",
+	)
+}
 
-	// Write the fully-rendered manifests to the root of the repo
-	if err = writeAllManifests(rc, outputDir); err != nil {
-		return res, err
+// pushURL returns the URL of the remote repository that is pushed to in
+// response to the Request.
+func (r *Request) pushURL() string {
+	if r.PushURL != "" {
+		return r.PushURL
 	}
-	logger.Debug("wrote all manifests")
+	return r.RepoURL
+}
 
-	// If we're writing to a local directory, we're done
-	if rc.request.LocalOutPath != "" {
-		res.ActionTaken = ActionTakenWroteToLocalPath
-		res.LocalPath = outputDir
-		return res, nil
+// writesToRemote returns whether handling the Request may write to the
+// remote repository.
+func (r *Request) writesToRemote() bool {
+	if r.ReadOnly || r.InMemory {
+		return false
 	}
+	if len(r.Outputs) > 0 {
+		return r.hasOutput(OutputTypeBranch)
+	}
+	return r.LocalOutPath == "" && !r.Stdout
+}
 
-	// If we get to here, we're writing to the remote repository
-
-	// Before committing, check if we actually have any diffs from the head of
-	// this branch that are NOT just Kargo Render metadata. We'd have an error if
-	// we tried to commit with no diffs!
-	diffPaths, err := rc.repo.GetDiffPaths()
-	if err != nil {
-		return res, fmt.Errorf("error checking for diffs: %w", err)
+// gitCreds returns the credentials with which the remote repository is
+// accessed in response to the Request. For read-only and in-memory requests,
+// these are only ever the credentials for reading.
+func (r *Request) gitCreds() git.RepoCredentials {
+	if r.ReadOnly || r.InMemory {
+		return r.RepoCreds.gitCreds().ForReading()
 	}
-	if len(diffPaths) == 0 ||
-		(len(diffPaths) == 1 && diffPaths[0] == ".kargo-render/metadata.yaml") {
-		logger.WithField("commitBranch", rc.target.commit.branch).Debug(
-			"manifests do not differ from the head of the " +
-				"commit branch; no further action is required",
-		)
-		res.ActionTaken = ActionTakenNone
-		if res.CommitID, err = rc.repo.LastCommitID(); err != nil {
-			return res, fmt.Errorf(
-				"error getting last commit ID from the commit branch: %w",
-				err,
-			)
+	return r.RepoCreds.gitCreds()
+}
+
+// refreshRepoCreds obtains fresh credentials for the remote GitOps repository
+// using the service's repoCredsFn, if one was specified, and a fresh access
+// token using the credentials' OAuth refresh token, if they include one and the
+// previous access token is about to expire. Fresh credentials are applied to
+// both the request and the repository.
+func (s *service) refreshRepoCreds(ctx context.Context, rc requestContext) error {
+	repoCreds := rc.request.RepoCreds
+	var refreshed bool
+	if s.repoCredsFn != nil && !rc.request.ReadOnly &&
+		repoCreds.gitCreds().ForReading().SSHPrivateKey == "" {
+		var err error
+		if repoCreds, err = s.repoCredsFn(ctx, rc.repo.URL()); err != nil {
+			return fmt.Errorf("error refreshing repository credentials: %w", err)
 		}
-		return res, nil
+		refreshed = true
 	}
-
-	if rc.target.commit.message, err = buildCommitMessage(rc); err != nil {
-		return res, err
+	tokenRefreshed, err := s.refreshOAuthToken(ctx, rc.repo.URL(), &repoCreds)
+	if err != nil {
+		return err
 	}
-	logger.Debug("prepared commit message")
-
-	// Commit the changes
-	if err = rc.repo.AddAllAndCommit(rc.target.commit.message); err != nil {
-		return res, fmt.Errorf("error committing manifests: %w", err)
+	if !refreshed && !tokenRefreshed {
+		return nil
 	}
-	if rc.target.commit.id, err = rc.repo.LastCommitID(); err != nil {
-		return res, fmt.Errorf(
-			"error getting last commit ID from the commit branch: %w",
-			err,
-		)
+	if err = rc.repo.SetCredentials(repoCreds.gitCreds()); err != nil {
+		return fmt.Errorf("error refreshing repository credentials: %w", err)
 	}
-	logger.WithFields(log.Fields{
-		"commitBranch": rc.target.commit.branch,
-		"commitID":     rc.target.commit.id,
-	}).Debug("committed all changes")
+	rc.request.RepoCreds = repoCreds
+	rc.logger.Debug("refreshed repository credentials")
+	return nil
+}
 
-	// Push the commit branch to the remote
-	if err = rc.repo.Push(); err != nil {
-		return res, fmt.Errorf(
-			"error pushing commit branch to remote: %w",
-			err,
-		)
+// gitCreds returns the git.RepoCredentials equivalent to the credentials.
+func (c RepoCredentials) gitCreds() git.RepoCredentials {
+	creds := git.RepoCredentials{
+		SSHPrivateKey:     c.SSHPrivateKey,
+		Username:          c.Username,
+		Password:          c.Password,
+		ClientCertificate: c.ClientCertificate,
+		ClientKey:         c.ClientKey,
+		ExtraHTTPHeaders:  c.ExtraHTTPHeaders,
+		Netrc:             c.Netrc,
 	}
-	logger.WithField("commitBranch", rc.target.commit.branch).
-		Debug("pushed commit branch to remote")
-
-	// Open a PR if requested
-	if rc.target.branchConfig.PRs.Enabled {
-		if res.PullRequestURL, err = openPR(ctx, rc); err != nil {
-			return res,
-				fmt.Errorf("error opening pull request to the target branch: %w", err)
-		}
-		if res.PullRequestURL == "" {
-			res.ActionTaken = ActionTakenUpdatedPR
-			logger.Debug("updated existing PR")
-		} else {
-			res.ActionTaken = ActionTakenOpenedPR
-			logger.WithField("prURL", res.PullRequestURL).Debug("opened PR")
-		}
-	} else {
-		res.ActionTaken = ActionTakenPushedDirectly
-		res.CommitID = rc.target.commit.id
+	if c.ReadCreds != nil {
+		readCreds := c.ReadCreds.gitCreds()
+		creds.ReadCreds = &readCreds
 	}
-
-	startEndLogger.Debug("completed rendering request")
-
-	return res, nil
+	if c.WriteCreds != nil {
+		writeCreds := c.WriteCreds.gitCreds()
+		creds.WriteCreds = &writeCreds
+	}
+	return creds
 }
 
 // buildCommitMessage builds a commit message for rendered manifests being
@@ -382,14 +721,17 @@ func (s *service) RenderManifests(
 // a starting point. The message is then augmented with details about where
 // Kargo Render rendered it from (the source commit) and any image substitutions
 // Kargo Render made per the RenderRequest.
-func buildCommitMessage(rc requestContext) (string, error) {
+func buildCommitMessage(
+	ctx context.Context,
+	rc requestContext,
+) (string, error) {
 	var commitMsg string
 	if rc.request.CommitMessage != "" {
 		commitMsg = rc.request.CommitMessage
 	} else {
 		// Use the source commit's message as a starting point
 		var err error
-		if commitMsg, err = rc.repo.CommitMessage(rc.source.commit); err != nil {
+		if commitMsg, err = rc.repo.CommitMessage(ctx, rc.source.commit); err != nil {
 			return "", fmt.Errorf(
 				"error getting commit message for commit %q: %w",
 				rc.source.commit,
@@ -405,38 +747,27 @@ func buildCommitMessage(rc requestContext) (string, error) {
 		rc.source.commit,
 	)
 
-	// TODO: Tentatively removing the following because it simply results in too
-	// much noise in the repo history. Leaving it commented for now in case we
-	// decide to bring it back later.
-	//
-	// // Find all recent commits
-	// if rc.target.oldBranchMetadata.SourceCommit != "" {
-	// 	var memberCommitMsgs []string
-	// 	// Add info about member commits
-	// 	formattedCommitMsg = fmt.Sprintf(
-	// 		"%s\n\nThis includes the following changes (newest to oldest):",
-	// 		formattedCommitMsg,
-	// 	)
-	// 	var err error
-	// 	if memberCommitMsgs, err = rc.repo.CommitMessages(
-	// 		rc.target.oldBranchMetadata.SourceCommit,
-	// 		rc.source.commit,
-	// 	); err != nil {
-	// 		return "", errors.Wrapf(
-	// 			err,
-	// 			"error getting commit messages between commit %q and %q",
-	// 			rc.target.oldBranchMetadata.SourceCommit,
-	// 			rc.source.commit,
-	// 		)
-	// 	}
-	// 	for _, memberCommitMsg := range memberCommitMsgs {
-	// 		formattedCommitMsg = fmt.Sprintf(
-	// 			"%s\n  * %s",
-	// 			formattedCommitMsg,
-	// 			memberCommitMsg,
-	// 		)
-	// 	}
-	// }
+	if history := rc.target.sourceHistory; history != nil &&
+		len(history.Commits) > 0 {
+		formattedCommitMsg = fmt.Sprintf(
+			"%s\n\nThis includes the following changes (newest to oldest):\n",
+			formattedCommitMsg,
+		)
+		for _, memberCommit := range history.Commits {
+			formattedCommitMsg = fmt.Sprintf(
+				"%s\n  * %s",
+				formattedCommitMsg,
+				memberCommit,
+			)
+		}
+		if omitted := history.CommitCount - len(history.Commits); omitted > 0 {
+			formattedCommitMsg = fmt.Sprintf(
+				"%s\n  * ...and %d more",
+				formattedCommitMsg,
+				omitted,
+			)
+		}
+	}
 
 	if len(rc.target.newBranchMetadata.ImageSubstitutions) != 0 {
 		formattedCommitMsg = fmt.Sprintf(
@@ -453,41 +784,251 @@ func buildCommitMessage(rc requestContext) (string, error) {
 		}
 	}
 
+	if len(rc.target.prunedApps) != 0 {
+		formattedCommitMsg = fmt.Sprintf(
+			"%s\n\nKargo Render also pruned output for the following apps, which "+
+				"are no longer rendered into this branch:\n",
+			formattedCommitMsg,
+		)
+		for _, prunedApp := range rc.target.prunedApps {
+			formattedCommitMsg = fmt.Sprintf(
+				"%s\n  * %s (%s)",
+				formattedCommitMsg,
+				prunedApp.App,
+				prunedApp.Path,
+			)
+		}
+	}
+
+	// Trailers must form the last paragraph of the message
+	if trailers := sourceTrailers(rc.request.Source); len(trailers) > 0 {
+		formattedCommitMsg = fmt.Sprintf(
+			"%s\n\n%s",
+			formattedCommitMsg,
+			strings.Join(trailers, "\n"),
+		)
+	}
+
 	return formattedCommitMsg, nil
 }
 
+// sourceTrailers returns git trailers recording the provided source context,
+// which may be nil.
+func sourceTrailers(src *SourceContext) []string {
+	if src == nil {
+		return nil
+	}
+	var trailers []string
+	if src.Branch != "" {
+		trailers = append(trailers, "Source-Branch: "+src.Branch)
+	}
+	if src.Tag != "" {
+		trailers = append(trailers, "Source-Tag: "+src.Tag)
+	}
+	if src.RunURL != "" {
+		trailers = append(trailers, "Source-Run-URL: "+src.RunURL)
+	}
+	return trailers
+}
+
 func writeAllManifests(rc requestContext, outputDir string) error {
+	// Indices are rewritten from scratch so that none are left behind for apps
+	// that are no longer rendered, or no longer content-addressable
+	indexDir := filepath.Join(outputDir, ".kargo-render", "index")
+	if err := os.RemoveAll(indexDir); err != nil {
+		return fmt.Errorf("error removing directory %q: %w", indexDir, err)
+	}
 	for appName, appConfig := range rc.target.branchConfig.AppConfigs {
-		appLogger := rc.logger.WithField("app", appName)
-		var appOutputDir string
-		if appConfig.OutputPath != "" {
-			appOutputDir = filepath.Join(outputDir, appConfig.OutputPath)
-		} else {
-			appOutputDir = filepath.Join(outputDir, appName)
-		}
-		var err error
-		if appConfig.CombineManifests {
-			appLogger.Debug("manifests will be combined into a single file")
-			err =
-				writeCombinedManifests(appOutputDir, rc.target.renderedManifests[appName])
-		} else {
-			appLogger.Debug("manifests will NOT be combined into a single file")
-			err = writeManifests(appOutputDir, rc.target.renderedManifests[appName])
+		if err := writeAppManifests(
+			rc.logger.WithField("app", appName),
+			outputDir,
+			appName,
+			appConfig,
+			rc.target.renderedManifests[appName],
+			fileHeader(rc, appName),
+			rc.target.symlinks,
+		); err != nil {
+			return err
 		}
-		appLogger.Debug("wrote manifests")
+	}
+	return nil
+}
+
+// writeAppManifests writes the provided manifests for the named app to the
+// specified directory using the layout specified by the app's configuration.
+// The provided header, if any, is prepended to every file written, unless the
+// files are content-addressable. Symbolic links along the way are treated
+// according to the provided policy.
+func writeAppManifests(
+	appLogger *log.Entry,
+	outputDir string,
+	appName string,
+	appConfig appConfig,
+	appManifests []byte,
+	header []byte,
+	policy symlinkPolicy,
+) error {
+	if err := prepareWritePath(
+		outputDir,
+		appOutputPath(appName, appConfig),
+		policy,
+	); err != nil {
+		return err
+	}
+	appOutputDir := filepath.Join(outputDir, appOutputPath(appName, appConfig))
+	if kindOutputPaths := appConfig.kindOutputPaths(); len(kindOutputPaths) > 0 {
+		manifestsByDir, err := routeManifestsByKind(
+			appOutputDir,
+			kindOutputPaths,
+			appManifests,
+		)
 		if err != nil {
-			return fmt.Errorf(
-				"error writing manifests for app %q to %q: %w",
-				appName,
-				appOutputDir,
-				err,
-			)
+			return fmt.Errorf("error routing manifests for app %q: %w", appName, err)
 		}
+		dirs := make([]string, 0, len(manifestsByDir))
+		for dir := range manifestsByDir {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			relDir, err := filepath.Rel(outputDir, dir)
+			if err != nil {
+				return err
+			}
+			if err = prepareWritePath(outputDir, relDir, policy); err != nil {
+				return err
+			}
+			if err = writeLayoutManifests(
+				appLogger,
+				dir,
+				appConfig,
+				manifestsByDir[dir],
+				header,
+			); err != nil {
+				return fmt.Errorf(
+					"error writing manifests for app %q to %q: %w",
+					appName,
+					dir,
+					err,
+				)
+			}
+		}
+		appLogger.Debug("wrote manifests")
+		return nil
+	}
+	var err error
+	switch appOutputLayout(appConfig) {
+	case appOutputLayoutCombined:
+		appLogger.Debug("manifests will be combined into a single file")
+		err = writeCombinedManifests(appOutputDir, appManifests, header)
+	case appOutputLayoutContentAddressable:
+		appLogger.Debug("manifests will be written to content-addressable files")
+		err = writeContentAddressableManifests(
+			outputDir,
+			appOutputPath(appName, appConfig),
+			appIndexPath(outputDir, appName),
+			appManifests,
+		)
+	default:
+		appLogger.Debug("manifests will NOT be combined into a single file")
+		err = writeManifests(appOutputDir, appManifests, header)
+	}
+	appLogger.Debug("wrote manifests")
+	if err != nil {
+		return fmt.Errorf(
+			"error writing manifests for app %q to %q: %w",
+			appName,
+			appOutputDir,
+			err,
+		)
 	}
 	return nil
 }
 
-func writeManifests(dir string, yamlBytes []byte) error {
+// routeManifestsByKind splits the provided manifests between the specified
+// app output directory and those of its subdirectories that the provided
+// kindOutputPaths map kinds of resources to. The combined manifests destined
+// for each directory are returned, indexed by directory.
+func routeManifestsByKind(
+	appOutputDir string,
+	kindOutputPaths map[string]string,
+	appManifests []byte,
+) (map[string][]byte, error) {
+	resources, err := manifests.SplitYAMLResources(appManifests)
+	if err != nil {
+		return nil, err
+	}
+	docsByDir := map[string][][]byte{}
+	for _, resource := range resources {
+		dir := appOutputDir
+		if path, ok := kindOutputPaths[resource.Kind]; ok {
+			dir = filepath.Join(appOutputDir, path)
+		}
+		docsByDir[dir] = append(docsByDir[dir], resource.Manifest)
+	}
+	manifestsByDir := make(map[string][]byte, len(docsByDir))
+	for dir, docs := range docsByDir {
+		manifestsByDir[dir] = manifests.CombineYAML(docs)
+	}
+	return manifestsByDir, nil
+}
+
+// writeLayoutManifests writes the provided manifests to the specified
+// directory, either combined into a single file or in separate files, as
+// specified by the app's configuration, prepending the provided header, if
+// any, to every file.
+func writeLayoutManifests(
+	appLogger *log.Entry,
+	dir string,
+	appConfig appConfig,
+	manifestBytes []byte,
+	header []byte,
+) error {
+	if appOutputLayout(appConfig) == appOutputLayoutCombined {
+		appLogger.WithField("dir", dir).
+			Debug("manifests will be combined into a single file")
+		return writeCombinedManifests(dir, manifestBytes, header)
+	}
+	appLogger.WithField("dir", dir).
+		Debug("manifests will NOT be combined into a single file")
+	return writeManifests(dir, manifestBytes, header)
+}
+
+// appIndexPath returns the path, within the specified directory, of the
+// resource index of the named app.
+func appIndexPath(outputDir string, appName string) string {
+	return filepath.Join(
+		outputDir,
+		".kargo-render",
+		"index",
+		fmt.Sprintf("%s.yaml", appName),
+	)
+}
+
+// appOutputPath returns the path, relative to the root of the repository,
+// where rendered manifests for the specified app are stored.
+func appOutputPath(appName string, appConfig appConfig) string {
+	if appConfig.OutputPath != "" {
+		return appConfig.OutputPath
+	}
+	return appName
+}
+
+// appOutputMetadata returns the output path and the output layout of each of
+// the provided apps, indexed by app name, as recorded in branch metadata.
+func appOutputMetadata(
+	appConfigs map[string]appConfig,
+) (map[string]string, map[string]string) {
+	paths := make(map[string]string, len(appConfigs))
+	layouts := make(map[string]string, len(appConfigs))
+	for appName, appConfig := range appConfigs {
+		paths[appName] = appOutputPath(appName, appConfig)
+		layouts[appName] = recordedAppOutputLayout(appConfig)
+	}
+	return paths, layouts
+}
+
+func writeManifests(dir string, yamlBytes []byte, header []byte) error {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("error creating directory %q: %w", dir, err)
 	}
@@ -501,7 +1042,11 @@ func writeManifests(dir string, yamlBytes []byte) error {
 			fmt.Sprintf("%s.yaml", resourceTypeAndName),
 		)
 		// nolint: gosec
-		if err := os.WriteFile(fileName, manifest, 0644); err != nil {
+		if err := os.WriteFile(
+			fileName,
+			withHeader(header, manifest),
+			0644,
+		); err != nil {
 			return fmt.Errorf(
 				"error writing manifest to %q: %w",
 				fileName,
@@ -512,12 +1057,98 @@ func writeManifests(dir string, yamlBytes []byte) error {
 	return nil
 }
 
-func writeCombinedManifests(dir string, manifestBytes []byte) error {
+// resourceIndex maps each resource rendered for an app to the
+// content-addressable file it was written to.
+type resourceIndex struct {
+	Resources []indexedResource `json:"resources"`
+}
+
+// indexedResource describes a single resource in a resourceIndex.
+type indexedResource struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Path is the path, relative to the root of the repository, of the file
+	// the resource was written to.
+	Path string `json:"path"`
+	// SHA256 is the hex-encoded SHA-256 digest of the file's contents.
+	SHA256 string `json:"sha256"`
+}
+
+// writeContentAddressableManifests writes each manifest to a file, in the
+// directory at appOutputPath relative to repoRoot, whose name identifies the
+// resource it describes and includes a short hash of its contents. An index
+// of all such files is written to indexPath.
+func writeContentAddressableManifests(
+	repoRoot string,
+	appOutputPath string,
+	indexPath string,
+	yamlBytes []byte,
+) error {
+	dir := filepath.Join(repoRoot, appOutputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %q: %w", dir, err)
+	}
+	resources, err := manifests.SplitYAMLResources(yamlBytes)
+	if err != nil {
+		return err
+	}
+	index := resourceIndex{
+		Resources: make([]indexedResource, len(resources)),
+	}
+	for i, resource := range resources {
+		sum := sha256.Sum256(resource.Manifest)
+		digest := hex.EncodeToString(sum[:])
+		path := filepath.Join(
+			appOutputPath,
+			fmt.Sprintf("%s-%s.yaml", resource.TypeAndName(), digest[:10]),
+		)
+		fileName := filepath.Join(repoRoot, path)
+		// nolint: gosec
+		if err = os.WriteFile(fileName, resource.Manifest, 0644); err != nil {
+			return fmt.Errorf("error writing manifest to %q: %w", fileName, err)
+		}
+		index.Resources[i] = indexedResource{
+			APIVersion: resource.APIVersion,
+			Kind:       resource.Kind,
+			Namespace:  resource.Namespace,
+			Name:       resource.Name,
+			Path:       path,
+			SHA256:     digest,
+		}
+	}
+	sort.Slice(index.Resources, func(i, j int) bool {
+		return index.Resources[i].Path < index.Resources[j].Path
+	})
+	indexBytes, err := yaml.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("error marshaling resource index: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return fmt.Errorf(
+			"error creating directory %q: %w",
+			filepath.Dir(indexPath),
+			err,
+		)
+	}
+	// nolint: gosec
+	if err = os.WriteFile(indexPath, indexBytes, 0644); err != nil {
+		return fmt.Errorf("error writing resource index to %q: %w", indexPath, err)
+	}
+	return nil
+}
+
+func writeCombinedManifests(dir string, manifestBytes []byte, header []byte) error {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("error creating directory %q: %w", dir, err)
 	}
 	fileName := filepath.Join(dir, "all.yaml")
-	if err := os.WriteFile(fileName, manifestBytes, 0644); err != nil { // nolint: gosec
+	if err := os.WriteFile( // nolint: gosec
+		fileName,
+		withHeader(header, manifestBytes),
+		0644,
+	); err != nil {
 		return fmt.Errorf(
 			"error writing manifests to %q: %w",
 			fileName,
@@ -2,12 +2,20 @@ package render
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
 
+	"github.com/akuity/kargo-render/internal/argocd"
 	"github.com/akuity/kargo-render/internal/file"
 )
 
@@ -36,7 +44,7 @@ metadata:
 		[]byte("---\n"),
 	)
 	testDir := t.TempDir()
-	err := writeManifests(testDir, testYAMLBytes)
+	err := writeManifests(testDir, testYAMLBytes, nil)
 	require.NoError(t, err)
 	filename := filepath.Join(testDir, "foobar-deployment.yaml")
 	exists, err := file.Exists(filename)
@@ -52,4 +60,427 @@ metadata:
 	fileBytes, err = os.ReadFile(filename)
 	require.NoError(t, err)
 	require.Equal(t, testYAMLChunk2, fileBytes)
+
+	// A header is prepended to every file
+	header := []byte("# generated\n")
+	testDir = t.TempDir()
+	err = writeManifests(testDir, testYAMLBytes, header)
+	require.NoError(t, err)
+	fileBytes, err = os.ReadFile(filepath.Join(testDir, "foobar-service.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, append(header, testYAMLChunk2...), fileBytes)
+	testDir = t.TempDir()
+	err = writeCombinedManifests(testDir, testYAMLBytes, header)
+	require.NoError(t, err)
+	fileBytes, err = os.ReadFile(filepath.Join(testDir, "all.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, append(header, testYAMLBytes...), fileBytes)
+}
+
+func TestWriteAppManifestsWithKindOutputPaths(t *testing.T) {
+	testYAMLBytes := []byte(`kind: Rollout
+metadata:
+  name: foobar
+---
+kind: AnalysisTemplate
+metadata:
+  name: success-rate
+---
+kind: Service
+metadata:
+  name: foobar
+`)
+	kindOutputPaths := map[string]string{
+		"Rollout":          "rollouts",
+		"AnalysisTemplate": "rollouts",
+	}
+
+	t.Run("separate files", func(t *testing.T) {
+		testDir := t.TempDir()
+		err := writeAppManifests(
+			log.NewEntry(log.New()),
+			testDir,
+			"my-app",
+			appConfig{KindOutputPaths: kindOutputPaths},
+			testYAMLBytes,
+			nil,
+			symlinkPolicyPreserve,
+		)
+		require.NoError(t, err)
+		for _, path := range []string{
+			"my-app/foobar-service.yaml",
+			"my-app/rollouts/foobar-rollout.yaml",
+			"my-app/rollouts/success-rate-analysistemplate.yaml",
+		} {
+			exists, err := file.Exists(filepath.Join(testDir, path))
+			require.NoError(t, err)
+			require.True(t, exists, path)
+		}
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		testDir := t.TempDir()
+		err := writeAppManifests(
+			log.NewEntry(log.New()),
+			testDir,
+			"my-app",
+			appConfig{
+				CombineManifests: true,
+				KindOutputPaths:  kindOutputPaths,
+			},
+			testYAMLBytes,
+			nil,
+			symlinkPolicyPreserve,
+		)
+		require.NoError(t, err)
+		fileBytes, err := os.ReadFile(filepath.Join(testDir, "my-app", "all.yaml"))
+		require.NoError(t, err)
+		require.Equal(t, "kind: Service\nmetadata:\n  name: foobar\n", string(fileBytes))
+		fileBytes, err = os.ReadFile(
+			filepath.Join(testDir, "my-app", "rollouts", "all.yaml"),
+		)
+		require.NoError(t, err)
+		require.Contains(t, string(fileBytes), "kind: Rollout")
+		require.Contains(t, string(fileBytes), "kind: AnalysisTemplate")
+	})
+}
+
+func TestWriteAppManifestsWithSeparateCRDs(t *testing.T) {
+	testDir := t.TempDir()
+	err := writeAppManifests(
+		log.NewEntry(log.New()),
+		testDir,
+		"my-app",
+		appConfig{
+			ConfigManagement: argocd.ConfigManagementConfig{
+				Helm: &argocd.ApplicationSourceHelm{CRDs: argocd.CRDsSeparate},
+			},
+		},
+		[]byte(`kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+kind: Service
+metadata:
+  name: foobar
+`),
+		nil,
+		symlinkPolicyPreserve,
+	)
+	require.NoError(t, err)
+	for _, path := range []string{
+		"my-app/foobar-service.yaml",
+		"my-app/crds/widgets.example.com-customresourcedefinition.yaml",
+	} {
+		exists, err := file.Exists(filepath.Join(testDir, path))
+		require.NoError(t, err)
+		require.True(t, exists, path)
+	}
+}
+
+func TestWriteContentAddressableManifests(t *testing.T) {
+	testYAMLBytes := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foobar
+  namespace: foo
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foobar
+  namespace: foo
+`)
+	repoRoot := t.TempDir()
+	indexPath := filepath.Join(repoRoot, ".kargo-render", "index", "foo.yaml")
+	err := writeContentAddressableManifests(
+		repoRoot,
+		"foo",
+		indexPath,
+		testYAMLBytes,
+	)
+	require.NoError(t, err)
+
+	indexBytes, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+	index := resourceIndex{}
+	require.NoError(t, yaml.Unmarshal(indexBytes, &index))
+	require.Len(t, index.Resources, 2)
+	for _, resource := range index.Resources {
+		require.Equal(t, "foobar", resource.Name)
+		require.Equal(t, "foo", resource.Namespace)
+		require.Regexp(
+			t,
+			`^foo/foobar-`+strings.ToLower(resource.Kind)+`-[0-9a-f]{10}\.yaml$`,
+			resource.Path,
+		)
+		var fileBytes []byte
+		fileBytes, err = os.ReadFile(filepath.Join(repoRoot, resource.Path))
+		require.NoError(t, err)
+		sum := sha256.Sum256(fileBytes)
+		require.Equal(t, hex.EncodeToString(sum[:]), resource.SHA256)
+	}
+
+	// Identical content should always be written to the same file
+	otherRoot := t.TempDir()
+	err = writeContentAddressableManifests(
+		otherRoot,
+		"foo",
+		filepath.Join(otherRoot, "index.yaml"),
+		testYAMLBytes,
+	)
+	require.NoError(t, err)
+	for _, resource := range index.Resources {
+		var exists bool
+		exists, err = file.Exists(filepath.Join(otherRoot, resource.Path))
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+}
+
+func TestRenderManifestsReadOnly(t *testing.T) {
+	originDir := t.TempDir()
+	srcDir := t.TempDir()
+	git := func(dir string, arg ...string) {
+		cmd := exec.Command("git", arg...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git(originDir, "init", "-q", "--bare", "-b", "main")
+	git(srcDir, "init", "-q", "-b", "main")
+	git(srcDir, "config", "user.name", "Test")
+	git(srcDir, "config", "user.email", "test@example.com")
+	git(srcDir, "remote", "add", "origin", originDir)
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(srcDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+			0600,
+		),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "initial commit")
+	git(srcDir, "push", "-q", "origin", "main")
+
+	s, ok := NewService(&ServiceOptions{
+		RepoCredsFn: func(context.Context, string) (RepoCredentials, error) {
+			require.Fail(t, "credentials should not be refreshed")
+			return RepoCredentials{}, nil
+		},
+	}).(*service)
+	require.True(t, ok)
+	s.renderFn = func(
+		context.Context,
+		string,
+		argocd.ConfigManagementConfig,
+		*commandTrace,
+	) ([]byte, error) {
+		return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+	}
+
+	res, err := s.RenderManifests(
+		context.Background(),
+		&Request{
+			LocalInPath:   srcDir,
+			TargetBranch:  "env/dev",
+			CommitMessage: "Render env/dev",
+			ReadOnly:      true,
+			// Last-mile rendering requires kustomize
+			Options: map[string]string{OptionSkipLastMile: "true"},
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, ActionTakenNone, res.ActionTaken)
+	require.Contains(t, string(res.Manifests["foo"]), "name: foo")
+
+	// Nothing was pushed to the remote repository
+	cmd := exec.Command("git", "branch", "--list")
+	cmd.Dir = originDir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Equal(t, "* main\n", string(out))
+}
+
+func TestRenderManifestsInMemory(t *testing.T) {
+	originDir := t.TempDir()
+	srcDir := t.TempDir()
+	git := func(dir string, arg ...string) {
+		cmd := exec.Command("git", arg...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git(originDir, "init", "-q", "--bare", "-b", "main")
+	git(srcDir, "init", "-q", "-b", "main")
+	git(srcDir, "config", "user.name", "Test")
+	git(srcDir, "config", "user.email", "test@example.com")
+	git(srcDir, "remote", "add", "origin", originDir)
+	// The target branch isn't managed by Kargo Render, which would ordinarily
+	// prevent rendering into it
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(srcDir, "README.md"), []byte("# dev\n"), 0600),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "unmanaged content")
+	git(srcDir, "push", "-q", "origin", "main:env/dev")
+	git(srcDir, "rm", "-q", "README.md")
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(srcDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+      outputPath: apps/foo
+`),
+			0600,
+		),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "initial commit")
+	git(srcDir, "push", "-q", "origin", "main")
+
+	s, ok := NewService(&ServiceOptions{
+		RepoCredsFn: func(context.Context, string) (RepoCredentials, error) {
+			require.Fail(t, "credentials should not be refreshed")
+			return RepoCredentials{}, nil
+		},
+	}).(*service)
+	require.True(t, ok)
+	s.renderFn = func(
+		context.Context,
+		string,
+		argocd.ConfigManagementConfig,
+		*commandTrace,
+	) ([]byte, error) {
+		return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+	}
+
+	res, err := s.RenderManifests(
+		context.Background(),
+		&Request{
+			LocalInPath:  srcDir,
+			TargetBranch: "env/dev",
+			InMemory:     true,
+			// Last-mile rendering requires kustomize
+			Options: map[string]string{OptionSkipLastMile: "true"},
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, ActionTakenNone, res.ActionTaken)
+	require.Contains(t, string(res.Manifests["foo"]), "name: foo")
+	md := branchMetadata{}
+	require.NoError(t, yaml.Unmarshal(res.BranchMetadata, &md))
+	require.Equal(t, map[string]string{"foo": "apps/foo"}, md.AppOutputPaths)
+	require.NotEmpty(t, md.SourceCommit)
+
+	// Nothing was pushed to the remote repository
+	cmd := exec.Command("git", "rev-list", "--count", "env/dev")
+	cmd.Dir = originDir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Equal(t, "1\n", string(out))
+}
+
+func TestRenderManifestsSkipInitialCommit(t *testing.T) {
+	originDir := t.TempDir()
+	srcDir := t.TempDir()
+	git := func(dir string, arg ...string) string {
+		cmd := exec.Command("git", arg...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	git(originDir, "init", "-q", "--bare", "-b", "main")
+	git(srcDir, "init", "-q", "-b", "main")
+	git(srcDir, "config", "user.name", "Test")
+	git(srcDir, "config", "user.email", "test@example.com")
+	git(srcDir, "remote", "add", "origin", originDir)
+	require.NoError(
+		t,
+		os.WriteFile(
+			filepath.Join(srcDir, "kargo-render.yaml"),
+			[]byte(`configVersion: v1alpha1
+branchConfigs:
+- name: env/dev
+  appConfigs:
+    foo:
+      configManagement:
+        path: foo
+`),
+			0600,
+		),
+	)
+	git(srcDir, "add", ".")
+	git(srcDir, "commit", "-q", "-m", "initial commit")
+	git(srcDir, "push", "-q", "origin", "main")
+
+	s, ok := NewService(nil).(*service)
+	require.True(t, ok)
+	s.renderFn = func(
+		context.Context,
+		string,
+		argocd.ConfigManagementConfig,
+		*commandTrace,
+	) ([]byte, error) {
+		return []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n"), nil
+	}
+
+	res, err := s.RenderManifests(
+		context.Background(),
+		&Request{
+			LocalInPath:   srcDir,
+			TargetBranch:  "env/dev",
+			CommitMessage: "Render env/dev",
+			Options: map[string]string{
+				// Last-mile rendering requires kustomize
+				OptionSkipLastMile:      "true",
+				OptionSkipInitialCommit: "true",
+			},
+		},
+	)
+	require.NoError(t, err)
+	require.Equal(t, ActionTakenPushedDirectly, res.ActionTaken)
+
+	// The rendered manifests are the new branch's only commit
+	require.Equal(
+		t,
+		"Render env/dev\n",
+		git(originDir, "log", "--format=%s", "env/dev"),
+	)
+	require.Equal(
+		t,
+		res.CommitID+"\n",
+		git(originDir, "rev-parse", "env/dev"),
+	)
+}
+
+func TestSourceTrailers(t *testing.T) {
+	require.Empty(t, sourceTrailers(nil))
+	require.Equal(
+		t,
+		[]string{
+			"Source-Branch: main",
+			"Source-Run-URL: https://ci.example.com/runs/1",
+		},
+		sourceTrailers(&SourceContext{
+			Branch: "main",
+			RunURL: "https://ci.example.com/runs/1",
+		}),
+	)
 }
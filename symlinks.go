@@ -0,0 +1,133 @@
+package render
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symlinkPolicy determines how Kargo Render treats symbolic links it finds in
+// a target branch when cleaning the branch, copying its contents, and writing
+// manifests to it.
+type symlinkPolicy string
+
+const (
+	// symlinkPolicyPreserve treats links as files in their own right. Cleaning
+	// removes a link, but never what it points to, copying copies the link
+	// itself, and writing manifests to a path that passes through a link
+	// replaces the link with a regular directory or file. This is the default.
+	symlinkPolicyPreserve symlinkPolicy = "preserve"
+	// symlinkPolicyFollow treats links as what they point to, which must be
+	// within the branch. Cleaning removes a link, leaving what it points to to
+	// be cleaned or preserved in its own right, copying copies what links point
+	// to, and writing manifests to a path that passes through a link writes to
+	// what it points to.
+	symlinkPolicyFollow symlinkPolicy = "follow"
+	// symlinkPolicyReject refuses to clean, copy, or write through any link.
+	symlinkPolicyReject symlinkPolicy = "reject"
+)
+
+// symlinkPolicy returns the repository's symlink policy, or the default if it
+// does not specify one.
+func (r *repoConfig) symlinkPolicy() symlinkPolicy {
+	if r == nil || r.Symlinks == "" {
+		return symlinkPolicyPreserve
+	}
+	return symlinkPolicy(r.Symlinks)
+}
+
+// checkSymlinks returns a *SymlinkError if any symbolic link beneath the
+// specified directory, outside of its .git directory, is not permitted by the
+// provided policy to be copied. Only links that point outside the directory
+// are not permitted when following links, while no link at all is permitted
+// when links are rejected.
+func checkSymlinks(dir string, policy symlinkPolicy) error {
+	if policy != symlinkPolicyFollow && policy != symlinkPolicyReject {
+		return nil
+	}
+	return filepath.WalkDir(
+		dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			return checkSymlink(dir, path, policy)
+		},
+	)
+}
+
+// checkSymlink returns a *SymlinkError if the symbolic link at the specified
+// path, beneath the specified root directory, may not be followed under the
+// provided policy.
+func checkSymlink(root, path string, policy symlinkPolicy) error {
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	symlinkErr := &SymlinkError{
+		Path:   filepath.ToSlash(relPath),
+		Policy: string(policy),
+	}
+	if policy == symlinkPolicyReject {
+		symlinkErr.Reason = "no symbolic links are permitted"
+		return symlinkErr
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		symlinkErr.Reason = "it cannot be resolved: " + err.Error()
+		return symlinkErr
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	if relTarget, err := filepath.Rel(root, target); err != nil ||
+		!filepath.IsLocal(relTarget) {
+		symlinkErr.Reason = "it points outside the branch"
+		return symlinkErr
+	}
+	return nil
+}
+
+// prepareWritePath applies the provided policy to any symbolic links among
+// the existing components of the specified path, relative to the specified
+// root directory, before manifests are written to it. Links are removed when
+// they are preserved, so that regular directories and files are written in
+// their place. Otherwise, a *SymlinkError is returned for any link that may not
+// be written through.
+func prepareWritePath(root, relPath string, policy symlinkPolicy) error {
+	path := root
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/") {
+		if part == "." {
+			continue
+		}
+		path = filepath.Join(path, part)
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if policy == symlinkPolicyFollow || policy == symlinkPolicyReject {
+			if err = checkSymlink(root, path, policy); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// createSymlinkBranchDir creates a directory resembling a branch that contains
+// a link to a directory within the branch, named "internal", and a link to a
+// directory outside of it, named "external". It returns the branch directory
+// and the outside directory.
+func createSymlinkBranchDir(t *testing.T) (string, string) {
+	outsideDir := t.TempDir()
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(outsideDir, "outside.yaml"), []byte("{}"), 0600),
+	)
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shared"), 0755))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, "shared", "shared.yaml"), []byte("{}"), 0600),
+	)
+	require.NoError(t, os.Symlink("shared", filepath.Join(dir, "internal")))
+	require.NoError(t, os.Symlink(outsideDir, filepath.Join(dir, "external")))
+	return dir, outsideDir
+}
+
+func TestCleanCommitBranchSymlinks(t *testing.T) {
+	for _, policy := range []symlinkPolicy{
+		symlinkPolicyPreserve,
+		symlinkPolicyFollow,
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			dir, outsideDir := createSymlinkBranchDir(t)
+			require.NoError(t, cleanCommitBranch(dir, []string{"shared"}, policy))
+			// The links are gone...
+			_, err := os.Lstat(filepath.Join(dir, "internal"))
+			require.True(t, os.IsNotExist(err))
+			_, err = os.Lstat(filepath.Join(dir, "external"))
+			require.True(t, os.IsNotExist(err))
+			// ...but nothing they pointed to was touched
+			_, err = os.Stat(filepath.Join(dir, "shared", "shared.yaml"))
+			require.NoError(t, err)
+			_, err = os.Stat(filepath.Join(outsideDir, "outside.yaml"))
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run(string(symlinkPolicyReject), func(t *testing.T) {
+		dir, _ := createSymlinkBranchDir(t)
+		err := cleanCommitBranch(dir, []string{"shared"}, symlinkPolicyReject)
+		symlinkErr := &SymlinkError{}
+		require.ErrorAs(t, err, &symlinkErr)
+		require.Equal(t, string(symlinkPolicyReject), symlinkErr.Policy)
+		// Nothing was deleted
+		_, err = os.Lstat(filepath.Join(dir, "internal"))
+		require.NoError(t, err)
+	})
+}
+
+func TestCopyBranchContentsSymlinks(t *testing.T) {
+	t.Run(string(symlinkPolicyPreserve), func(t *testing.T) {
+		srcDir, _ := createSymlinkBranchDir(t)
+		dstDir := filepath.Join(t.TempDir(), "dst")
+		require.NoError(
+			t,
+			copyBranchContents(
+				context.Background(),
+				srcDir,
+				dstDir,
+				symlinkPolicyPreserve,
+				nil,
+			),
+		)
+		for _, name := range []string{"internal", "external"} {
+			fi, err := os.Lstat(filepath.Join(dstDir, name))
+			require.NoError(t, err)
+			require.NotZero(t, fi.Mode()&os.ModeSymlink, name)
+		}
+	})
+
+	t.Run(string(symlinkPolicyFollow), func(t *testing.T) {
+		srcDir, _ := createSymlinkBranchDir(t)
+		dstDir := filepath.Join(t.TempDir(), "dst")
+		err := copyBranchContents(
+			context.Background(),
+			srcDir,
+			dstDir,
+			symlinkPolicyFollow,
+			nil,
+		)
+		symlinkErr := &SymlinkError{}
+		require.ErrorAs(t, err, &symlinkErr)
+		require.Equal(t, "external", symlinkErr.Path)
+
+		require.NoError(t, os.Remove(filepath.Join(srcDir, "external")))
+		require.NoError(
+			t,
+			copyBranchContents(
+				context.Background(),
+				srcDir,
+				dstDir,
+				symlinkPolicyFollow,
+				nil,
+			),
+		)
+		fi, err := os.Lstat(filepath.Join(dstDir, "internal"))
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+		_, err = os.Stat(filepath.Join(dstDir, "internal", "shared.yaml"))
+		require.NoError(t, err)
+	})
+
+	t.Run(string(symlinkPolicyReject), func(t *testing.T) {
+		srcDir, _ := createSymlinkBranchDir(t)
+		require.NoError(t, os.Remove(filepath.Join(srcDir, "external")))
+		dstDir := filepath.Join(t.TempDir(), "dst")
+		err := copyBranchContents(
+			context.Background(),
+			srcDir,
+			dstDir,
+			symlinkPolicyReject,
+			nil,
+		)
+		symlinkErr := &SymlinkError{}
+		require.ErrorAs(t, err, &symlinkErr)
+		require.Equal(t, "internal", symlinkErr.Path)
+		_, err = os.Stat(dstDir)
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestWriteAppManifestsSymlinks(t *testing.T) {
+	manifests := []byte("kind: Service\nmetadata:\n  name: foobar\n")
+	writeTo := func(dir, appName string, policy symlinkPolicy) error {
+		return writeAppManifests(
+			log.NewEntry(log.New()),
+			dir,
+			appName,
+			appConfig{},
+			manifests,
+			nil,
+			policy,
+		)
+	}
+
+	t.Run(string(symlinkPolicyPreserve), func(t *testing.T) {
+		dir, outsideDir := createSymlinkBranchDir(t)
+		require.NoError(t, writeTo(dir, "external", symlinkPolicyPreserve))
+		// The link was replaced with a regular directory
+		fi, err := os.Lstat(filepath.Join(dir, "external"))
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+		_, err = os.Stat(filepath.Join(outsideDir, "foobar-service.yaml"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run(string(symlinkPolicyFollow), func(t *testing.T) {
+		dir, _ := createSymlinkBranchDir(t)
+		require.NoError(t, writeTo(dir, "internal", symlinkPolicyFollow))
+		_, err := os.Stat(filepath.Join(dir, "shared", "foobar-service.yaml"))
+		require.NoError(t, err)
+		err = writeTo(dir, "external", symlinkPolicyFollow)
+		symlinkErr := &SymlinkError{}
+		require.ErrorAs(t, err, &symlinkErr)
+		require.Equal(t, "external", symlinkErr.Path)
+	})
+
+	t.Run(string(symlinkPolicyReject), func(t *testing.T) {
+		dir, _ := createSymlinkBranchDir(t)
+		err := writeTo(dir, "internal", symlinkPolicyReject)
+		symlinkErr := &SymlinkError{}
+		require.ErrorAs(t, err, &symlinkErr)
+		_, err = os.Stat(filepath.Join(dir, "shared", "foobar-service.yaml"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,125 @@
+package render
+
+import "time"
+
+// Stages of handling a rendering request for which timings are recorded.
+const (
+	StageClone       = "clone"
+	StageCopy        = "copy"
+	StageLoadConfig  = "loadConfig"
+	StageLint        = "lint"
+	StagePreRender   = "preRender"
+	StageDeterminism = "determinism"
+	StageLastMile    = "lastMile"
+	StageCommit      = "commit"
+	StagePush        = "push"
+	StagePR          = "pr"
+)
+
+// StageTiming records how long a single stage of handling a rendering request
+// took.
+type StageTiming struct {
+	// Stage is the name of the stage.
+	Stage string `json:"stage"`
+	// App is the name of the app to which the stage applies. This is only set
+	// for stages that are executed once per app.
+	App string `json:"app,omitempty"`
+	// Duration is how long the stage took.
+	Duration time.Duration `json:"duration"`
+}
+
+// RenderTimings summarizes how long rendering manifests into an
+// environment-specific branch took.
+type RenderTimings struct {
+	// Duration is how long it took from when handling of the rendering request
+	// began until the rendered manifests were ready to be written.
+	Duration time.Duration `json:"duration"`
+	// Stages maps the name of every stage that had completed by then to how
+	// long it took. The durations of stages executed once per app are summed.
+	Stages map[string]time.Duration `json:"stages,omitempty"`
+}
+
+// Progress describes a stage of handling a rendering request that has just
+// begun.
+type Progress struct {
+	// Stage is the name of the stage.
+	Stage string
+	// App is the name of the app to which the stage applies. This is only set
+	// for stages that are executed once per app.
+	App string
+	// AppIndex is the one-based position of App among the apps the stage is
+	// executed for. This is only set when App is.
+	AppIndex int
+	// AppCount is the number of apps the stage is executed for. This is only
+	// set when App is.
+	AppCount int
+}
+
+// timings accumulates StageTimings over the course of handling a rendering
+// request.
+type timings struct {
+	stages []StageTiming
+	// progressFn, if non-nil, is invoked as each stage begins.
+	progressFn func(Progress)
+	// begun is when handling of the rendering request began.
+	begun time.Time
+}
+
+// newTimings returns timings for a rendering request whose handling begins
+// now. The provided function, which may be nil, is invoked as each stage
+// begins.
+func newTimings(progressFn func(Progress)) *timings {
+	return &timings{
+		progressFn: progressFn,
+		begun:      time.Now(),
+	}
+}
+
+// start reports that the specified stage has begun and returns the current
+// time, which should later be passed to record.
+func (t *timings) start(stage string) time.Time {
+	if t.progressFn != nil {
+		t.progressFn(Progress{Stage: stage})
+	}
+	return time.Now()
+}
+
+// startApp reports that the specified stage has begun for the specified app,
+// which is the index-th of count apps the stage is executed for, and returns
+// the current time, which should later be passed to record.
+func (t *timings) startApp(stage, app string, index, count int) time.Time {
+	if t.progressFn != nil {
+		t.progressFn(Progress{
+			Stage:    stage,
+			App:      app,
+			AppIndex: index,
+			AppCount: count,
+		})
+	}
+	return time.Now()
+}
+
+// record records the time elapsed since start as the duration of the
+// specified stage.
+func (t *timings) record(stage, app string, start time.Time) {
+	t.stages = append(
+		t.stages,
+		StageTiming{
+			Stage:    stage,
+			App:      app,
+			Duration: time.Since(start),
+		},
+	)
+}
+
+// summary returns a RenderTimings summarizing the stages recorded so far.
+func (t *timings) summary() *RenderTimings {
+	summary := &RenderTimings{
+		Duration: time.Since(t.begun),
+		Stages:   map[string]time.Duration{},
+	}
+	for _, stage := range t.stages {
+		summary.Stages[stage.Stage] += stage.Duration
+	}
+	return summary
+}
@@ -0,0 +1,60 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimingsRecord(t *testing.T) {
+	ts := &timings{}
+	ts.record(StageClone, "", time.Now().Add(-time.Second))
+	ts.record(StagePreRender, "foo", time.Now())
+	require.Len(t, ts.stages, 2)
+	require.Equal(t, StageClone, ts.stages[0].Stage)
+	require.Empty(t, ts.stages[0].App)
+	require.GreaterOrEqual(t, ts.stages[0].Duration, time.Second)
+	require.Equal(t, StagePreRender, ts.stages[1].Stage)
+	require.Equal(t, "foo", ts.stages[1].App)
+}
+
+func TestTimingsProgress(t *testing.T) {
+	var progress []Progress
+	ts := &timings{
+		progressFn: func(p Progress) {
+			progress = append(progress, p)
+		},
+	}
+	ts.start(StageClone)
+	ts.startApp(StagePreRender, "foo", 1, 2)
+	require.Equal(
+		t,
+		[]Progress{
+			{Stage: StageClone},
+			{Stage: StagePreRender, App: "foo", AppIndex: 1, AppCount: 2},
+		},
+		progress,
+	)
+	// Without a progressFn, nothing is reported
+	(&timings{}).start(StageClone)
+}
+
+func TestTimingsSummary(t *testing.T) {
+	ts := newTimings(nil)
+	ts.stages = []StageTiming{
+		{Stage: StageClone, Duration: time.Second},
+		{Stage: StagePreRender, App: "foo", Duration: 2 * time.Second},
+		{Stage: StagePreRender, App: "bar", Duration: 3 * time.Second},
+	}
+	summary := ts.summary()
+	require.Equal(
+		t,
+		map[string]time.Duration{
+			StageClone:     time.Second,
+			StagePreRender: 5 * time.Second,
+		},
+		summary.Stages,
+	)
+	require.Greater(t, summary.Duration, time.Duration(0))
+}
@@ -1,5 +1,7 @@
 package render
 
+import "golang.org/x/oauth2"
+
 // ActionTaken indicates what action, if any was taken in response to a
 // RenderRequest.
 type ActionTaken string
@@ -26,14 +28,46 @@ const (
 	ActionTakenWroteToLocalPath ActionTaken = "WROTE_TO_LOCAL_PATH"
 )
 
+// Priority indicates how urgently a Request should be handled relative to
+// other requests when a server receives more requests than it can handle at
+// once.
+type Priority string
+
+const (
+	// PriorityLow represents requests that should only be handled once no
+	// requests of higher priority are waiting.
+	PriorityLow Priority = "low"
+	// PriorityNormal represents requests of ordinary urgency. Requests that do
+	// not specify a priority are handled with this priority.
+	PriorityNormal Priority = "normal"
+	// PriorityHigh represents requests, such as promotions to production, that
+	// should be handled ahead of any other waiting requests.
+	PriorityHigh Priority = "high"
+)
+
 // Request is a request for Kargo Render to render environment-specific
 // manifests from input in the  default branch of the repository specified by
 // RepoURL.
 type Request struct {
 	id string
+	// preRenderCache, if non-nil, is shared with other requests that render
+	// the same source commit into other branches.
+	preRenderCache *preRenderCache
+	// APIVersion optionally specifies the version of the Request schema the
+	// request conforms to. If specified, it must be a supported version.
+	APIVersion string `json:"apiVersion,omitempty"`
 	// RepoURL is the URL of a remote GitOps repository. This field is mutually
 	// exclusive with the LocalInPath field.
 	RepoURL string `json:"repoURL,omitempty"`
+	// PushURL optionally specifies the URL of the remote GitOps repository that
+	// Kargo Render pushes to and opens pull requests in. When it is specified,
+	// the repository specified by the RepoURL field, or the remote of the
+	// repository at LocalInPath, is only read from. This permits a nearby,
+	// read-only mirror to be read from while changes are pushed to the
+	// canonical repository. The mirror must be kept up to date, since a push
+	// is rejected if the target branch has moved on in the canonical
+	// repository.
+	PushURL string `json:"pushURL,omitempty"`
 	// RepoCreds encapsulates read/write credentials for the remote GitOps
 	// repository referenced by the RepoURL field.
 	RepoCreds RepoCredentials `json:"repoCreds,omitempty"`
@@ -41,6 +75,11 @@ type Request struct {
 	// When this is omitted, the request is assumed to be one to render from the
 	// head of the default branch.
 	Ref string `json:"ref,omitempty"`
+	// RefPath optionally specifies a path, relative to the root of the
+	// repository, from which to render manifests when the configuration for the
+	// target branch does not explicitly define any apps. When this is omitted,
+	// manifests are rendered from a path matching the name of the target branch.
+	RefPath string `json:"refPath,omitempty"`
 	// TargetBranch is the name of an environment-specific branch in the GitOps
 	// repository referenced by the RepoURL field into which plain YAML should be
 	// rendered.
@@ -48,18 +87,108 @@ type Request struct {
 	// Images specifies images to incorporate into environment-specific
 	// manifests.
 	Images []string `json:"images,omitempty"`
+	// LastMile optionally specifies transformations, in addition to the
+	// substitution of Images, applied to the manifests of every app during
+	// last-mile rendering. This permits, for instance, a promotion pipeline to
+	// stamp the manifests of a release with a label identifying it without any
+	// change to the repository's configuration. Unlike Images, these apply only
+	// to the manifests rendered in response to this request.
+	LastMile *LastMileOptions `json:"lastMile,omitempty"`
 	// CommitMessage offers the opportunity to, optionally, override the first
 	// line of the commit message that Kargo Render would normally generate.
 	CommitMessage string `json:"commitMessage,omitempty"`
+	// CommitAuthor optionally specifies the author of the commit Kargo Render
+	// creates. When this is omitted, commits are authored by Kargo Render
+	// itself. Commits are always committed by Kargo Render.
+	CommitAuthor *CommitAuthor `json:"commitAuthor,omitempty"`
+	// Source optionally describes where the source commit came from and what
+	// triggered the request, e.g. the CI run promoting it. This is recorded in
+	// trailers of the commit Kargo Render creates, in the body of any pull
+	// request it opens, and in the target branch's metadata, so that the
+	// branch's history links back to it.
+	Source *SourceContext `json:"source,omitempty"`
+	// PullRequest optionally customizes any pull request Kargo Render opens to
+	// the target branch.
+	PullRequest *PullRequestOptions `json:"pullRequest,omitempty"`
 	// AllowEmpty indicates whether or not Kargo Render should allow the rendered
 	// manifests to be empty. If this is false (the default), Kargo Render will
 	// return an error if the rendered manifests are empty. This is a safeguard
 	// against scenarios where a bug of any kind might otherwise cause Kargo
 	// Render to wipe out the contents of the target branch in error.
 	AllowEmpty bool `json:"allowEmpty,omitempty"`
+	// RequireBranchConfig indicates whether Kargo Render should refuse to render
+	// into a target branch for which the repository's configuration does not
+	// explicitly provide any branch configuration or conventions. If this is
+	// false (the default), and the repository defines no branch configuration
+	// at all, Kargo Render falls back to rendering from a path named after the
+	// target branch.
+	RequireBranchConfig bool `json:"requireBranchConfig,omitempty"`
+	// RequireImageMatches indicates whether Kargo Render should refuse to
+	// render if any of the images specified by the Images field does not match
+	// any image referenced by the manifests of any app. If this is false (the
+	// default), such images are only reported in the UnmatchedImages field of
+	// the Response. This catches typos in promotion automation.
+	RequireImageMatches bool `json:"requireImageMatches,omitempty"`
+	// SkipPromotionOrder indicates whether Kargo Render should render into the
+	// target branch even if the repository's configuration specifies a
+	// promotion order and the source commit has not yet been rendered into the
+	// branch preceding the target branch. This is useful for hotfixes.
+	SkipPromotionOrder bool `json:"skipPromotionOrder,omitempty"`
+	// AdoptBranch indicates whether Kargo Render should take ownership of the
+	// target branch if it already exists, but does not appear to be managed by
+	// Kargo Render, as it would if the branch's configuration enabled
+	// adoptExisting. The files that are deleted when the branch is cleaned are
+	// listed in the AdoptionDeletedPaths field of the Response. Combining this
+	// with ReadOnly reports what would be deleted without deleting anything.
+	AdoptBranch bool `json:"adoptBranch,omitempty"`
+	// Vars optionally specifies values for variables that may be referenced,
+	// using placeholders of the form ${var:name}, anywhere that the
+	// configuration for the target branch permits placeholders, including paths
+	// and Helm values. This permits a single branch configuration to serve
+	// renders that are parameterized by the caller.
+	Vars map[string]string `json:"vars,omitempty"`
+	// Options optionally specifies values, indexed by name, for options that
+	// toggle experimental behaviors. The names of all supported options are
+	// defined by constants prefixed with Option. Options permit such behaviors
+	// to be toggled per request without any change to the Request type itself.
+	// Unsupported options are rejected.
+	Options map[string]string `json:"options,omitempty"`
+	// IdempotencyKey optionally specifies a unique, client-generated key for
+	// the request. When a Service decorated using NewIdempotentService receives
+	// a request bearing a key for which it has already returned a Response, it
+	// returns that Response again instead of handling the request again. This
+	// permits clients to safely retry requests that have timed out. Keys are
+	// scoped to the request's Tenant.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// Priority optionally specifies how urgently the request should be handled
+	// by a server that has more requests than it can handle at once. Waiting
+	// requests of higher priority are handled before those of lower priority.
+	// When this is omitted, PriorityNormal is assumed. It has no effect on
+	// requests that are handled immediately.
+	Priority Priority `json:"priority,omitempty"`
+	// ID optionally specifies a client-generated ID for the request, which
+	// should be the same for every attempt at handling the same request. It
+	// is used in place of a random ID in logs and in the names of any branches
+	// created for pull requests, and it determines the location of the
+	// request's workspace, so that a retry can reuse the workspace of an
+	// earlier attempt that was interrupted, or of a pinned workspace (see
+	// PinWorkspace), instead of cloning the repository again. It may consist
+	// of at most 128 letters, digits, underscores, and hyphens, and must begin
+	// with a letter or digit.
+	ID string `json:"id,omitempty"`
+	// Tenant optionally identifies the client on whose behalf the request is
+	// made. Any artifacts persisted for the request (see
+	// ServiceOptions.ArtifactsDir) are scoped to it, so that they can only be
+	// loaded by specifying the same tenant. It is subject to the same
+	// constraints as ID. Since it must be established by whoever authenticated
+	// the client, it is never read from or written to JSON.
+	Tenant string `json:"-"`
 	// LocalInPath specifies a path to the repository's working tree with the
 	// desired source commit already checked out. The contents at this path will
-	// not be modified. This field is mutually exclusive with the Ref field.
+	// not be modified. Only committed content is rendered, so the working tree
+	// must be clean. Its objects are borrowed rather than copied, so they must
+	// not be pruned while the request is handled. This field is mutually
+	// exclusive with the Ref field.
 	LocalInPath string `json:"localInPath,omitempty"`
 	// LocalOutPath specifies a path where the rendered manifests should be
 	// written. The specified path must NOT exist already. When specified, the
@@ -67,10 +196,145 @@ type Request struct {
 	// repository specified by the RepoURL field. This field is mutually exclusive
 	// with the Stdout field.
 	LocalOutPath string `json:"localOutPath,omitempty"`
+	// LocalOut optionally customizes what is written to LocalOutPath. By
+	// default, LocalOutPath receives a copy of the target branch's contents,
+	// minus its .git directory, as they would be after rendering. This field
+	// may only be specified along with the LocalOutPath field.
+	LocalOut *LocalOutOptions `json:"localOut,omitempty"`
 	// Stdout specifies whether rendered manifests should be written to stdout
 	// instead of to the target branch of the repository specified by the RepoURL
 	// field. This field is mutually exclusive with the LocalOutPath field.
 	Stdout bool `json:"stdout,omitempty"`
+	// InMemory specifies that the target branch should not be checked out,
+	// cleaned, or written to at all, and that the rendered manifests, along
+	// with the metadata that would have been written to the target branch,
+	// should instead be returned in the Response. Anything that depends upon
+	// the target branch's existing contents, such as images substituted by
+	// earlier requests or pruning of apps that are no longer rendered, is
+	// skipped. This is the least expensive way to render manifests for callers,
+	// such as Kargo, that handle all writing to the repository themselves. This
+	// field is mutually exclusive with the LocalOutPath and Stdout fields.
+	InMemory bool `json:"inMemory,omitempty"`
+	// Outputs optionally specifies several destinations to which the rendered
+	// manifests are written at once, for instance to push them to the target
+	// branch and also write a copy to a local path for CI to upload. Each
+	// output's result is reported in the Outputs field of the Response. This
+	// field is mutually exclusive with the LocalOutPath, LocalOut, Stdout, and
+	// InMemory fields, which each specify a single destination.
+	Outputs []Output `json:"outputs,omitempty"`
+	// ReadOnly specifies that handling the request must not write anything to
+	// the remote repository, regardless of any other field. Nothing is
+	// committed or pushed and no pull request is opened. Credentials for
+	// writing are never configured and ServiceOptions.RepoCredsFn is never
+	// invoked. Unless LocalOutPath is specified, rendered manifests are
+	// returned in the Response as they would be if Stdout were specified. This
+	// is useful for previewing renders requested by untrusted parties.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Offline specifies that handling the request must not require network
+	// access beyond that to the remote repository, for use in air-gapped
+	// environments to which all dependencies have been mirrored. Instead of
+	// attempting to reach anything else, Kargo Render fails fast with a
+	// NetworkAccessRequiredError if any app references remote Kustomize bases,
+	// Helm values files by URL, or chart dependencies that are not vendored
+	// into the chart's charts/ directory, if cluster capabilities would have
+	// to be discovered, or if the git provider's API would have to be used to
+	// check required status checks, push commits, or open pull requests.
+	// Config management plugins are not checked.
+	Offline bool `json:"offline,omitempty"`
+}
+
+// LastMileOptions are transformations applied to the manifests of every app
+// during last-mile rendering.
+type LastMileOptions struct {
+	// NameSuffix is appended to the names of all resources.
+	NameSuffix string `json:"nameSuffix,omitempty"`
+	// Namespace is set as the namespace of all namespaced resources.
+	Namespace string `json:"namespace,omitempty"`
+	// CommonLabels are added to all resources and, as with Kustomize's
+	// commonLabels, to their selectors.
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	// CommonAnnotations are added to all resources.
+	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
+}
+
+// LocalOutFormat is the form in which rendered manifests are written to a
+// Request's LocalOutPath.
+type LocalOutFormat string
+
+const (
+	// LocalOutFormatDirectory represents rendered manifests written to a
+	// directory. This is the default.
+	LocalOutFormatDirectory LocalOutFormat = "directory"
+	// LocalOutFormatTar represents rendered manifests written to a tar archive.
+	LocalOutFormatTar LocalOutFormat = "tar"
+)
+
+// LocalOutOptions customizes what is written to a Request's LocalOutPath.
+type LocalOutOptions struct {
+	// ExcludeMetadata specifies whether the .kargo-render directory, which
+	// contains the target branch's metadata, should be omitted. The metadata
+	// is then returned in the BranchMetadata field of the Response instead.
+	ExcludeMetadata bool `json:"excludeMetadata,omitempty"`
+	// ManifestsOnly specifies whether only rendered manifests, and not any
+	// other files preserved in the target branch, should be written.
+	ManifestsOnly bool `json:"manifestsOnly,omitempty"`
+	// Format is the form in which rendered manifests are written. If it is
+	// LocalOutFormatTar, LocalOutPath is the path of an uncompressed tar
+	// archive. If it is omitted, LocalOutFormatDirectory is assumed.
+	Format LocalOutFormat `json:"format,omitempty"`
+}
+
+// OutputType is a kind of destination to which rendered manifests are
+// written.
+type OutputType string
+
+const (
+	// OutputTypeBranch represents the target branch. Rendered manifests are
+	// committed to it, or proposed by a pull request, just as they are when a
+	// Request specifies no other destination.
+	OutputTypeBranch OutputType = "branch"
+	// OutputTypeLocal represents a local path, to which rendered manifests are
+	// written just as they are to a Request's LocalOutPath.
+	OutputTypeLocal OutputType = "local"
+	// OutputTypeStdout represents the Manifests field of the Response, in which
+	// rendered manifests are returned just as they are when a Request
+	// specifies Stdout.
+	OutputTypeStdout OutputType = "stdout"
+)
+
+// Output is one of several destinations to which rendered manifests are
+// written.
+type Output struct {
+	// Type is the kind of destination.
+	Type OutputType `json:"type"`
+	// Path specifies, for outputs of type OutputTypeLocal, where the rendered
+	// manifests are written. As with a Request's LocalOutPath, it must NOT
+	// exist already.
+	Path string `json:"path,omitempty"`
+	// LocalOut optionally customizes what is written to Path. It may only be
+	// specified for outputs of type OutputTypeLocal.
+	LocalOut *LocalOutOptions `json:"localOut,omitempty"`
+}
+
+// OutputResult describes the outcome of writing rendered manifests to one of
+// the Outputs of a Request.
+type OutputResult struct {
+	// Type is the kind of destination.
+	Type OutputType `json:"type"`
+	// ActionTaken indicates what action, if any, was taken in order to write
+	// to the destination.
+	ActionTaken ActionTaken `json:"actionTaken,omitempty"`
+	// CommitID is, for the target branch, the ID of the commit that was pushed
+	// directly to it.
+	CommitID string `json:"commitID,omitempty"`
+	// PullRequestURL is, for the target branch, the URL of the pull request
+	// that was opened or updated.
+	PullRequestURL string `json:"pullRequestURL,omitempty"`
+	// Path is, for a local path, where the rendered manifests were written.
+	Path string `json:"path,omitempty"`
+	// BranchMetadata is, for a local path whose LocalOut options specified
+	// ExcludeMetadata, the content of the metadata file that was omitted.
+	BranchMetadata []byte `json:"branchMetadata,omitempty"`
 }
 
 // RepoCredentials represents the credentials for connecting to a private git
@@ -87,11 +351,293 @@ type RepoCredentials struct {
 	// field, can be used for both reading from and writing to some remote
 	// repository.
 	Password string `json:"password,omitempty"`
+	// ClientCertificate is a PEM-encoded TLS client certificate presented to
+	// remote repositories accessed over HTTPS that require mutual TLS. It must
+	// be accompanied by ClientKey.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	// ClientKey is the PEM-encoded private key for ClientCertificate.
+	ClientKey string `json:"clientKey,omitempty"`
+	// ExtraHTTPHeaders are additional headers, indexed by name, that are sent
+	// with every request made by git to a remote repository accessed over
+	// HTTP(S) using these credentials. This permits authentication to servers
+	// that expect a token in a header, such as GitLab's PRIVATE-TOKEN, instead
+	// of basic auth. Their values are redacted from logs.
+	ExtraHTTPHeaders map[string]string `json:"extraHTTPHeaders,omitempty"`
+	// Netrc specifies that Username and Password should be supplied to git
+	// using a .netrc file in the isolated home directory of the request's
+	// workspace instead of using git's credential store. This is useful with
+	// servers and proxies that are set up to be used with .netrc. It cannot be
+	// combined with ReadCreds or WriteCreds.
+	Netrc bool `json:"netrc,omitempty"`
+	// OAuthRefresh, if non-nil, describes how to obtain short-lived access
+	// tokens that are used in place of Password. A new access token is obtained
+	// whenever the previous one is about to expire, including immediately
+	// before pushing and before opening pull requests, so that long-running or
+	// queued requests do not fail once a token expires. It cannot be combined
+	// with SSHPrivateKey and must not be specified by ReadCreds or WriteCreds.
+	OAuthRefresh *OAuthRefreshCredentials `json:"oauthRefresh,omitempty"`
+	// ReadCreds, if non-nil, are used in place of all other fields for reading
+	// from the remote repository. This permits, for instance, a read-only
+	// deploy key to be used for cloning. They must not themselves specify
+	// ReadCreds or WriteCreds.
+	ReadCreds *RepoCredentials `json:"readCreds,omitempty"`
+	// WriteCreds, if non-nil, are used in place of all other fields for writing
+	// to the remote repository, which includes pushing and opening pull
+	// requests. They must not themselves specify ReadCreds or WriteCreds.
+	WriteCreds *RepoCredentials `json:"writeCreds,omitempty"`
+	// oauthToken is the access token most recently obtained using
+	// OAuthRefresh, if any.
+	oauthToken *oauth2.Token
+}
+
+// OAuthRefreshCredentials describe how to obtain short-lived access tokens for
+// a remote repository accessed over HTTPS using the OAuth 2.0 refresh token
+// flow, as supported by providers such as GitLab and Azure DevOps.
+type OAuthRefreshCredentials struct {
+	// TokenURL is the URL of the provider's OAuth 2.0 token endpoint.
+	TokenURL string `json:"tokenURL,omitempty"`
+	// ClientID identifies the OAuth application the refresh token was issued
+	// to.
+	ClientID string `json:"clientID,omitempty"`
+	// ClientSecret is the secret of the OAuth application the refresh token was
+	// issued to, if it has one.
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// RefreshToken is exchanged for access tokens.
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// Username accompanies each access token, which is used as a password. If
+	// not specified, this defaults to "oauth2".
+	Username string `json:"username,omitempty"`
+}
+
+// CommitAuthor identifies the author of a commit.
+type CommitAuthor struct {
+	// Name is the author's name.
+	Name string `json:"name"`
+	// Email is the author's email address.
+	Email string `json:"email"`
+}
+
+// SourceContext describes where a source commit came from and what triggered
+// its rendering. Every field is optional.
+type SourceContext struct {
+	// Branch is the name of the branch the source commit was taken from.
+	Branch string `json:"branch,omitempty"`
+	// Tag is the name of a tag pointing to the source commit.
+	Tag string `json:"tag,omitempty"`
+	// RunURL is the absolute http or https URL of the CI run or pipeline that
+	// triggered the request.
+	RunURL string `json:"runURL,omitempty"`
+}
+
+// PullRequestOptions customizes pull requests opened by Kargo Render.
+type PullRequestOptions struct {
+	// TitleTemplate is an optional Go template for the title of the pull
+	// request. The template may reference the fields of PullRequestTemplateData.
+	TitleTemplate string `json:"titleTemplate,omitempty"`
+	// BodyTemplate is an optional Go template for the body of the pull request.
+	// The template may reference the fields of PullRequestTemplateData.
+	BodyTemplate string `json:"bodyTemplate,omitempty"`
+	// Labels are labels to apply to the pull request.
+	Labels []string `json:"labels,omitempty"`
+	// Draft specifies whether the pull request should be opened as a draft.
+	Draft bool `json:"draft,omitempty"`
+}
+
+// PullRequestTemplateData is the data available to the templates specified by
+// PullRequestOptions.
+type PullRequestTemplateData struct {
+	// TargetBranch is the branch the pull request is opened to.
+	TargetBranch string
+	// CommitBranch is the branch the pull request is opened from.
+	CommitBranch string
+	// SourceCommit is the ID (sha) of the commit manifests were rendered from.
+	SourceCommit string
+	// CommitMessage is the complete message of the commit Kargo Render created.
+	CommitMessage string
+	// CommitSubject is the first line of CommitMessage.
+	CommitSubject string
+	// Source describes where the source commit came from, as specified by the
+	// request. Its fields are empty if the request specified none.
+	Source SourceContext
+}
+
+// PrunedApp describes the previously rendered output of an app that was
+// removed from an environment-specific branch.
+type PrunedApp struct {
+	// App is the name of the app.
+	App string `json:"app"`
+	// Path is the path, relative to the root of the branch, that was removed.
+	Path string `json:"path"`
+}
+
+// ImageSubstitution describes an image that was substituted into the manifests
+// of an app during last-mile rendering.
+type ImageSubstitution struct {
+	// App is the name of the app.
+	App string `json:"app"`
+	// Old is the image reference found in the app's pre-rendered manifests.
+	Old string `json:"old"`
+	// New is the image reference that was substituted for it.
+	New string `json:"new"`
+}
+
+// RemoteBase describes a remote base or resource referenced by the
+// kustomization of an app, which Kustomize fetches over the network when
+// rendering the app.
+type RemoteBase struct {
+	// App is the name of the app.
+	App string `json:"app"`
+	// Kustomization is the path, relative to the root of the repository, of the
+	// kustomization file that references the remote base.
+	Kustomization string `json:"kustomization"`
+	// URL is the remote base exactly as the kustomization references it.
+	URL string `json:"url"`
+	// RepoURL is the URL of the git repository the remote base is fetched from.
+	// This is not set for remote resources that are plain files.
+	RepoURL string `json:"repoURL,omitempty"`
+	// Ref is the branch, tag, or commit the remote base is fetched at, if the
+	// kustomization specifies one.
+	Ref string `json:"ref,omitempty"`
+	// Commit is the ID (sha) of the commit Ref referred to when the app was
+	// rendered. This is not set if the commit could not be determined.
+	Commit string `json:"commit,omitempty"`
+	// Pinned indicates whether the kustomization pins the remote base to a
+	// specific commit, such that its content cannot change without a change to
+	// the kustomization.
+	Pinned bool `json:"pinned"`
+}
+
+// CloneStats describes a clone of a remote repository made while handling a
+// request.
+type CloneStats struct {
+	// Strategy is the strategy the repository was cloned with.
+	Strategy CloneStrategy `json:"strategy"`
+	// ObjectBytes is the total size, in bytes, of the objects stored in the
+	// clone by the time the request was handled, including any fetched on
+	// demand because of a partial clone. It approximates how much was
+	// transferred from the remote repository, except that objects copied from
+	// a mirror in a clone cache are included too.
+	ObjectBytes int64 `json:"objectBytes"`
+}
+
+// RenderReport summarizes the manifests rendered into an
+// environment-specific branch, along with what was found to be wrong with
+// them, so that the complexity of an environment can be tracked over time.
+type RenderReport struct {
+	// Apps is the number of apps rendered into the branch.
+	Apps int `json:"apps"`
+	// Resources is the number of resources rendered into the branch.
+	Resources int `json:"resources"`
+	// ResourcesByKind is the number of resources of each kind rendered into
+	// the branch.
+	ResourcesByKind map[string]int `json:"resourcesByKind,omitempty"`
+	// Size is the total size, in bytes, of the rendered manifests.
+	Size int `json:"size"`
+	// ImagesByApp lists, for every app, the distinct images its rendered
+	// manifests reference.
+	ImagesByApp map[string][]string `json:"imagesByApp,omitempty"`
+	// ResourcePolicyViolations is the number of rendered resources that
+	// violate the branch's resource policy.
+	ResourcePolicyViolations int `json:"resourcePolicyViolations"`
+	// DuplicateResources is the number of namespaced resources that more than
+	// one app renders into the branch.
+	DuplicateResources int `json:"duplicateResources"`
+	// UnmatchedImages is the number of images specified by the request that
+	// did not match any image referenced by any app.
+	UnmatchedImages int `json:"unmatchedImages"`
+}
+
+// RelocatedApp describes an app whose previously rendered output was moved to
+// a new path or layout, in a commit of its own, before newly rendered
+// manifests were written.
+type RelocatedApp struct {
+	// App is the name of the app.
+	App string `json:"app"`
+	// OldPath is the path, relative to the root of the branch, the app's
+	// output was moved from.
+	OldPath string `json:"oldPath"`
+	// OldLayout is the layout the app's output was moved from: split,
+	// combined, or contentAddressable, followed by the subdirectories, if any,
+	// to which resources of particular kinds were routed, e.g. "split,
+	// CustomResourceDefinition in crds". It is empty if the layout was not
+	// recorded when the branch was previously rendered.
+	OldLayout string `json:"oldLayout,omitempty"`
+	// NewPath is the path, relative to the root of the branch, the app's
+	// output was moved to.
+	NewPath string `json:"newPath"`
+	// NewLayout is the layout the app's output was moved to.
+	NewLayout string `json:"newLayout"`
+}
+
+// ResourcePolicyViolation describes a rendered resource that violates the
+// resource policy of an environment-specific branch.
+type ResourcePolicyViolation struct {
+	// App is the name of the app the resource was rendered for.
+	App string `json:"app"`
+	// APIVersion is the resource's API version.
+	APIVersion string `json:"apiVersion"`
+	// Kind is the resource's kind.
+	Kind string `json:"kind"`
+	// Namespace is the resource's namespace. It is empty for cluster-scoped
+	// resources and for resources that do not specify a namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the resource's name.
+	Name string `json:"name"`
+}
+
+// DuplicateResource describes a namespaced resource that more than one app
+// renders into the same environment-specific branch.
+type DuplicateResource struct {
+	// APIGroup is the resource's API group. It is empty for resources in the
+	// core API group.
+	APIGroup string `json:"apiGroup,omitempty"`
+	// Kind is the resource's kind.
+	Kind string `json:"kind"`
+	// Namespace is the resource's namespace.
+	Namespace string `json:"namespace"`
+	// Name is the resource's name.
+	Name string `json:"name"`
+	// Apps lists, in order by name, the apps that render the resource.
+	Apps []string `json:"apps"`
+}
+
+// LintFinding describes problems a linter found with the input of an app.
+type LintFinding struct {
+	// App is the name of the app.
+	App string `json:"app"`
+	// Linter is the name of the linter: helm, kustomize, or ytt.
+	Linter string `json:"linter"`
+	// Output is the linter's output describing the problems.
+	Output string `json:"output"`
+}
+
+// SourceHistory describes the commits to the source branch since an
+// environment-specific branch was previously rendered. It indicates how far
+// behind the source branch the environment-specific branch was.
+type SourceHistory struct {
+	// PreviousSourceCommit is the ID (sha) of the commit the
+	// environment-specific branch was previously rendered from.
+	PreviousSourceCommit string `json:"previousSourceCommit"`
+	// CommitCount is the number of commits after PreviousSourceCommit, up to and
+	// including the commit rendered by the corresponding Request. This is zero
+	// if the environment-specific branch was previously rendered from the same
+	// commit or from a newer one.
+	CommitCount int `json:"commitCount"`
+	// Commits lists those commits, newest first, each as its ID (sha) followed
+	// by its subject. This is only set when the branch's configuration enables
+	// listing member commits and is limited to the number of commits the
+	// configuration permits.
+	Commits []string `json:"commits,omitempty"`
 }
 
 // Response encapsulates details of a successful rendering of some
 // environment-specific manifests into an environment-specific branch.
 type Response struct {
+	// APIVersion is the version of the Response schema the response conforms
+	// to.
+	APIVersion string `json:"apiVersion,omitempty"`
+	// ActionTaken indicates what action, if any, was taken in response to the
+	// corresponding Request.
 	ActionTaken ActionTaken `json:"actionTaken,omitempty"`
 	// CommitID is the ID (sha) of the commit to the environment-specific branch
 	// containing the rendered manifests. This is only set when the OpenPR field
@@ -101,11 +647,110 @@ type Response struct {
 	// manifests. This is only set when the OpenPR field of the corresponding
 	// RenderRequest was true.
 	PullRequestURL string `json:"pullRequestURL,omitempty"`
-	// LocalPath is the path to the directory where the rendered manifests
-	// were written. This is only set when the LocalOutPath field of the
+	// LocalPath is the path to the directory or tar archive where the rendered
+	// manifests were written. This is only set when the LocalOutPath field of the
 	// corresponding RenderRequest was non-empty.
 	LocalPath string `json:"localPath,omitempty"`
+	// Outputs describes, in the same order, the outcome of writing to each of
+	// the Outputs of the corresponding Request. The other fields of the
+	// Response describe the target branch, if it was among them, or else the
+	// first local path. This is only set when the Request specified Outputs.
+	Outputs []OutputResult `json:"outputs,omitempty"`
 	// Manifests is the rendered environment-specific manifests. This is only set
-	// when the Stdout field of the corresponding RenderRequest was true.
+	// when the Stdout or InMemory field of the corresponding RenderRequest was
+	// true.
 	Manifests map[string][]byte `json:"manifests,omitempty"`
+	// BranchMetadata is the content of the .kargo-render/metadata.yaml file
+	// that was omitted from the directory or tar archive at LocalPath. This is
+	// only set when the LocalOut field of the corresponding Request specified
+	// ExcludeMetadata, so that the metadata remains available to callers that
+	// keep it separately from the rendered manifests, or when the InMemory
+	// field of the corresponding Request was true, in which case it is the
+	// content that would have been written to the target branch.
+	BranchMetadata []byte `json:"branchMetadata,omitempty"`
+	// PrunedApps lists apps whose previously rendered output was removed from
+	// the environment-specific branch because the apps are no longer
+	// configured for that branch or their output paths have changed.
+	PrunedApps []PrunedApp `json:"prunedApps,omitempty"`
+	// RelocatedApps lists apps whose previously rendered output was moved to a
+	// new path or layout in a commit preceding the one containing the newly
+	// rendered manifests. This is only set when the corresponding Request
+	// enabled the OptionMigrateLayout option.
+	RelocatedApps []RelocatedApp `json:"relocatedApps,omitempty"`
+	// SourceHistory describes the commits to the source branch since the
+	// environment-specific branch was previously rendered. It is not set if
+	// the branch has never been rendered.
+	SourceHistory *SourceHistory `json:"sourceHistory,omitempty"`
+	// Timings is a breakdown, in order, of how long each stage of handling the
+	// corresponding RenderRequest took.
+	Timings []StageTiming `json:"timings,omitempty"`
+	// RenderTimings summarizes how long rendering took, up until the rendered
+	// manifests were ready to be written. The same summary is recorded in the
+	// environment-specific branch's metadata, so that rendering performance
+	// can be tracked over time. It is not set if rendering did not get that
+	// far.
+	RenderTimings *RenderTimings `json:"renderTimings,omitempty"`
+	// ResourcePolicyViolations lists rendered resources that violate the
+	// resource policy of the environment-specific branch. This is only set
+	// when the policy says to warn about, rather than fail on, violations.
+	ResourcePolicyViolations []ResourcePolicyViolation `json:"resourcePolicyViolations,omitempty"`
+	// DuplicateResources lists namespaced resources that more than one app
+	// renders into the environment-specific branch. This is only set when the
+	// branch's configuration says to warn about, rather than fail on,
+	// duplicates.
+	DuplicateResources []DuplicateResource `json:"duplicateResources,omitempty"`
+	// LintFindings lists problems that linters found with the input of apps.
+	// This is only set for apps whose lint configuration says to warn about,
+	// rather than fail on, problems.
+	LintFindings []LintFinding `json:"lintFindings,omitempty"`
+	// NondeterministicApps lists, in order, apps whose configuration enables
+	// checking determinism and whose manifests differed when pre-rendered a
+	// second time from the same input.
+	NondeterministicApps []string `json:"nondeterministicApps,omitempty"`
+	// RemoteBases lists the remote bases referenced by the kustomizations of
+	// Kustomize-based apps, in order by app and then by kustomization and URL.
+	RemoteBases []RemoteBase `json:"remoteBases,omitempty"`
+	// AdoptionDeletedPaths lists, in order, the paths, relative to the root of
+	// the environment-specific branch, of the files that were deleted when
+	// Kargo Render took ownership of the branch. If the corresponding Request
+	// did not write to the branch, these are the files that would have been
+	// deleted. This is only set when the branch was adopted.
+	AdoptionDeletedPaths []string `json:"adoptionDeletedPaths,omitempty"`
+	// MissingPreservedPaths lists, in the order they are configured, the paths
+	// the environment-specific branch's configuration says to preserve that
+	// did not exist in the branch, and were therefore not protected by
+	// anything.
+	MissingPreservedPaths []string `json:"missingPreservedPaths,omitempty"`
+	// Report summarizes the rendered manifests. This is only set when the
+	// configuration of the environment-specific branch enables reports, in
+	// which case the report is also written to .kargo-render/report.json in
+	// the branch.
+	Report *RenderReport `json:"report,omitempty"`
+	// Clone describes the clone of the remote repository made while handling
+	// the corresponding Request. It is not set if the Request specified a
+	// LocalInPath.
+	Clone *CloneStats `json:"clone,omitempty"`
+	// Diagnostics optionally describes details of how the corresponding Request
+	// was handled that are useful for diagnosing problems. This is only set
+	// when the corresponding Request enabled the OptionTraceCommands option,
+	// and is set even when handling the Request fails.
+	Diagnostics *Diagnostics `json:"diagnostics,omitempty"`
+	// Warnings describes anything noteworthy that happened while handling the
+	// corresponding Request that did not prevent it from being handled, such as
+	// a pull request being opened because a direct push was rejected.
+	Warnings []string `json:"warnings,omitempty"`
+	// ArtifactsID identifies the rendered manifests, and the diff they
+	// introduced, persisted by a Service configured with an ArtifactsDir. They
+	// can be retrieved using LoadArtifacts. This is only set when artifacts
+	// were persisted.
+	ArtifactsID string `json:"artifactsID,omitempty"`
+	// ImageSubstitutions lists, for every app, the image references in its
+	// pre-rendered manifests for which the images specified by the Images
+	// field of the corresponding Request, or by earlier requests, were
+	// substituted during last-mile rendering.
+	ImageSubstitutions []ImageSubstitution `json:"imageSubstitutions,omitempty"`
+	// UnmatchedImages lists any images specified by the Images field of the
+	// corresponding Request that did not match any image referenced by the
+	// manifests of any app and were therefore not substituted into anything.
+	UnmatchedImages []string `json:"unmatchedImages,omitempty"`
 }
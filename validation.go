@@ -1,34 +1,71 @@
 package render
 
 import (
-	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
 )
 
 var (
 	repoURLRegex      = regexp.MustCompile(`^(?:(?:(?:https?://)|(?:git@))[\w:/\-\.\?=@&%]+)$`)
+	refPathRegex      = regexp.MustCompile(`^(?:\w|\.)(?:\w|\.|/|-)*$`)
 	targetBranchRegex = regexp.MustCompile(`^(?:[\w\.-]+\/?)*\w$`)
+	varNameRegex      = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+	requestIDRegex    = regexp.MustCompile(`^[A-Za-z0-9][\w-]{0,127}$`)
+	matrixValueRegex  = regexp.MustCompile(`^[A-Za-z0-9][\w.-]*$`)
+	namespaceRegex    = regexp.MustCompile(`^[a-z0-9](?:[-a-z0-9]{0,61}[a-z0-9])?$`)
 )
 
+// ValidateRequest canonicalizes the provided Request, for instance by trimming
+// whitespace from its fields, exactly as handling it would, and then validates
+// it, so that frontends can refuse invalid requests without handling them. If
+// the Request is invalid, an *InvalidRequestError is returned whose
+// FieldErrors describe every problem with it.
+func ValidateRequest(req *Request) error {
+	return req.canonicalizeAndValidate()
+}
+
+// invalidField returns a FieldError for the field at the specified path whose
+// reason is formatted according to the provided format specifier.
+func invalidField(path string, format string, a ...any) FieldError {
+	return FieldError{Field: path, Reason: fmt.Sprintf(format, a...)}
+}
+
 func (r *Request) canonicalizeAndValidate() error {
-	var errs []error
+	var errs []FieldError
 
 	// First, canonicalize the input...
 
+	r.APIVersion = strings.TrimSpace(r.APIVersion)
 	r.RepoURL = strings.TrimSpace(r.RepoURL)
-	r.RepoCreds.Username = strings.TrimSpace(r.RepoCreds.Username)
-	r.RepoCreds.Password = strings.TrimSpace(r.RepoCreds.Password)
+	r.PushURL = strings.TrimSpace(r.PushURL)
+	r.RepoCreds.canonicalize()
 	r.Ref = strings.TrimSpace(r.Ref)
+	r.RefPath = strings.TrimSpace(r.RefPath)
+	r.RefPath = strings.TrimPrefix(r.RefPath, "./")
+	r.RefPath = strings.TrimSuffix(r.RefPath, "/")
 	r.TargetBranch = strings.TrimSpace(r.TargetBranch)
 	r.TargetBranch = strings.TrimPrefix(r.TargetBranch, "refs/heads/")
 	for i := range r.Images {
 		r.Images[i] = strings.TrimSpace(r.Images[i])
 	}
 	r.CommitMessage = strings.TrimSpace(r.CommitMessage)
+	if r.Source != nil {
+		r.Source.canonicalize()
+	}
+	if r.LastMile != nil {
+		r.LastMile.canonicalize()
+	}
+	r.ID = strings.TrimSpace(r.ID)
+	r.IdempotencyKey = strings.TrimSpace(r.IdempotencyKey)
+	r.Priority = Priority(strings.ToLower(strings.TrimSpace(string(r.Priority))))
+	for name, value := range r.Options {
+		r.Options[name] = strings.TrimSpace(value)
+	}
 	r.LocalInPath = strings.TrimSpace(r.LocalInPath)
 	if r.LocalInPath != "" {
 		r.LocalInPath = strings.TrimSuffix(r.LocalInPath, "/")
@@ -36,7 +73,12 @@ func (r *Request) canonicalizeAndValidate() error {
 		if r.LocalInPath, err = filepath.Abs(r.LocalInPath); err != nil {
 			errs = append(
 				errs,
-				fmt.Errorf("error canonicalizing path %s: %w", r.LocalInPath, err),
+				invalidField(
+					"localInPath",
+					"error canonicalizing path %s: %s",
+					r.LocalInPath,
+					err,
+				),
 			)
 		}
 	}
@@ -48,10 +90,24 @@ func (r *Request) canonicalizeAndValidate() error {
 		if r.LocalOutPath, err = filepath.Abs(r.LocalOutPath); err != nil {
 			errs = append(
 				errs,
-				fmt.Errorf("error canonicalizing path %s: %w", r.LocalOutPath, err),
+				invalidField(
+					"localOutPath",
+					"error canonicalizing path %s: %s",
+					r.LocalOutPath,
+					err,
+				),
 			)
 		}
 	}
+	if r.LocalOut != nil {
+		r.LocalOut.canonicalize()
+	}
+	for i := range r.Outputs {
+		errs = append(
+			errs,
+			r.Outputs[i].canonicalize(fmt.Sprintf("outputs[%d]", i))...,
+		)
+	}
 
 	// Check for invalid combinations of input...
 
@@ -59,7 +115,8 @@ func (r *Request) canonicalizeAndValidate() error {
 	if r.RepoURL == "" && r.LocalInPath == "" {
 		errs = append(
 			errs,
-			errors.New(
+			invalidField(
+				"repoURL",
 				"no input source specified: at least one of RepoURL or LocalInPath is required ",
 			),
 		)
@@ -67,13 +124,17 @@ func (r *Request) canonicalizeAndValidate() error {
 	if r.RepoURL != "" && r.LocalInPath != "" {
 		errs = append(
 			errs,
-			errors.New(
+			invalidField(
+				"localInPath",
 				"input source is ambiguous: RepoURL and LocalInPath are mutually exclusive",
 			),
 		)
 	}
 	if r.LocalInPath != "" && r.Ref != "" {
-		errs = append(errs, errors.New("LocalInPath and Ref are mutually exclusive"))
+		errs = append(
+			errs,
+			invalidField("ref", "LocalInPath and Ref are mutually exclusive"),
+		)
 	}
 
 	var count int
@@ -86,35 +147,126 @@ func (r *Request) canonicalizeAndValidate() error {
 	if r.Stdout {
 		count++
 	}
+	if r.InMemory {
+		count++
+	}
 	if count > 1 {
 		errs = append(
 			errs,
-			errors.New(
-				"output destination is ambiguous: CommitMessage, LocalOutPath, and "+
-					"Stdout are mutually exclusive",
+			invalidField(
+				"commitMessage",
+				"output destination is ambiguous: CommitMessage, LocalOutPath, "+
+					"Stdout, and InMemory are mutually exclusive",
+			),
+		)
+	}
+	if len(r.Outputs) > 0 &&
+		(r.LocalOutPath != "" || r.LocalOut != nil || r.Stdout || r.InMemory) {
+		errs = append(
+			errs,
+			invalidField(
+				"outputs",
+				"Outputs is mutually exclusive with LocalOutPath, LocalOut, Stdout, "+
+					"and InMemory",
 			),
 		)
 	}
 
 	// Now validate individual fields...
 
+	if r.APIVersion != "" && r.APIVersion != APIVersion {
+		errs = append(
+			errs,
+			invalidField(
+				"apiVersion",
+				"APIVersion %q is unsupported; supported version is %q",
+				r.APIVersion,
+				APIVersion,
+			),
+		)
+	}
+
+	if r.ID != "" && !requestIDRegex.MatchString(r.ID) {
+		errs = append(
+			errs,
+			invalidField(
+				"id",
+				"ID %q is invalid; it must consist of at most 128 letters, digits, "+
+					"underscores, and hyphens, and must begin with a letter or digit",
+				r.ID,
+			),
+		)
+	}
+
+	if r.Tenant != "" && !requestIDRegex.MatchString(r.Tenant) {
+		errs = append(
+			errs,
+			invalidField(
+				"tenant",
+				"Tenant %q is invalid; it must consist of at most 128 letters, digits, "+
+					"underscores, and hyphens, and must begin with a letter or digit",
+				r.Tenant,
+			),
+		)
+	}
+
 	if r.RepoURL != "" && !repoURLRegex.MatchString(r.RepoURL) {
 		errs = append(
 			errs,
-			fmt.Errorf(
+			invalidField(
+				"repoURL",
 				"RepoURL %q does not appear to be a valid git repository URL",
 				r.RepoURL,
 			),
 		)
 	}
 
+	if r.PushURL != "" && !repoURLRegex.MatchString(r.PushURL) {
+		errs = append(
+			errs,
+			invalidField(
+				"pushURL",
+				"PushURL %q does not appear to be a valid git repository URL",
+				r.PushURL,
+			),
+		)
+	}
+
+	errs = append(errs, r.RepoCreds.validate("RepoCreds", "repoCreds", false)...)
+
+	if r.RefPath != "" {
+		if !refPathRegex.MatchString(r.RefPath) {
+			errs = append(
+				errs,
+				invalidField("refPath", "RefPath %q is an invalid relative path", r.RefPath),
+			)
+		} else if cleanPath := filepath.Clean(r.RefPath); cleanPath == ".." ||
+			strings.HasPrefix(cleanPath, "../") {
+			errs = append(
+				errs,
+				invalidField(
+					"refPath",
+					"RefPath %q must not refer to a path outside the repository",
+					r.RefPath,
+				),
+			)
+		}
+	}
+
 	if r.TargetBranch == "" {
-		errs = append(errs, errors.New("TargetBranch is a required field"))
+		errs = append(
+			errs,
+			invalidField("targetBranch", "TargetBranch is a required field"),
+		)
 	}
 	if !targetBranchRegex.MatchString(r.TargetBranch) {
 		errs = append(
 			errs,
-			fmt.Errorf("TargetBranch %q is an invalid branch name", r.TargetBranch),
+			invalidField(
+				"targetBranch",
+				"TargetBranch %q is an invalid branch name",
+				r.TargetBranch,
+			),
 		)
 	}
 
@@ -122,44 +274,442 @@ func (r *Request) canonicalizeAndValidate() error {
 		for i := range r.Images {
 			r.Images[i] = strings.TrimSpace(r.Images[i])
 			if r.Images[i] == "" {
-				errs = append(errs, errors.New("Images must not contain any empty strings"))
+				errs = append(
+					errs,
+					invalidField("images", "Images must not contain any empty strings"),
+				)
 				break
 			}
 		}
 	}
 
+	if r.CommitAuthor != nil {
+		r.CommitAuthor.Name = strings.TrimSpace(r.CommitAuthor.Name)
+		r.CommitAuthor.Email = strings.TrimSpace(r.CommitAuthor.Email)
+		if r.CommitAuthor.Name == "" || r.CommitAuthor.Email == "" {
+			errs = append(
+				errs,
+				invalidField(
+					"commitAuthor",
+					"CommitAuthor must specify both a name and an email address",
+				),
+			)
+		}
+	}
+
+	if r.Source != nil {
+		errs = append(errs, r.Source.validate()...)
+	}
+
+	if r.LocalOut != nil {
+		if r.LocalOutPath == "" {
+			errs = append(
+				errs,
+				invalidField("localOut", "LocalOut may only be specified with LocalOutPath"),
+			)
+		}
+		errs = append(errs, r.LocalOut.validate("localOut")...)
+	}
+	errs = append(errs, r.validateOutputs()...)
+
+	if r.PullRequest != nil {
+		if _, err := template.New("").Parse(r.PullRequest.TitleTemplate); err != nil {
+			errs = append(
+				errs,
+				invalidField(
+					"pullRequest.titleTemplate",
+					"PullRequest TitleTemplate is invalid: %s",
+					err,
+				),
+			)
+		}
+		if _, err := template.New("").Parse(r.PullRequest.BodyTemplate); err != nil {
+			errs = append(
+				errs,
+				invalidField(
+					"pullRequest.bodyTemplate",
+					"PullRequest BodyTemplate is invalid: %s",
+					err,
+				),
+			)
+		}
+		for i := range r.PullRequest.Labels {
+			r.PullRequest.Labels[i] = strings.TrimSpace(r.PullRequest.Labels[i])
+			if r.PullRequest.Labels[i] == "" {
+				errs = append(
+					errs,
+					invalidField(
+						"pullRequest.labels",
+						"PullRequest Labels must not contain any empty strings",
+					),
+				)
+				break
+			}
+		}
+	}
+
+	for name := range r.Vars {
+		if !varNameRegex.MatchString(name) {
+			errs = append(
+				errs,
+				invalidField("vars", "Vars key %q is an invalid variable name", name),
+			)
+		}
+	}
+
+	switch r.Priority {
+	case "", PriorityLow, PriorityNormal, PriorityHigh:
+	default:
+		errs = append(
+			errs,
+			invalidField("priority", "Priority %q is not supported", r.Priority),
+		)
+	}
+
+	errs = append(errs, validateOptions(r.Options)...)
+	if r.boolOption(OptionSkipLastMile) && len(r.Images) > 0 {
+		errs = append(
+			errs,
+			invalidField(
+				"images",
+				"Images cannot be specified when the %q option is enabled",
+				OptionSkipLastMile,
+			),
+		)
+	}
+	if r.LastMile != nil {
+		if r.boolOption(OptionSkipLastMile) {
+			errs = append(
+				errs,
+				invalidField(
+					"lastMile",
+					"LastMile cannot be specified when the %q option is enabled",
+					OptionSkipLastMile,
+				),
+			)
+		}
+		errs = append(errs, r.LastMile.validate()...)
+	}
+
 	if r.LocalInPath != "" {
 		if fi, err := os.Stat(r.LocalInPath); err != nil {
 			if os.IsNotExist(err) {
 				errs = append(
 					errs,
-					fmt.Errorf("path %s does not exist", r.LocalInPath),
+					invalidField("localInPath", "path %s does not exist", r.LocalInPath),
 				)
 			} else {
 				errs = append(
 					errs,
-					fmt.Errorf("error checking if path %s exists: %w", r.LocalInPath, err),
+					invalidField(
+						"localInPath",
+						"error checking if path %s exists: %s",
+						r.LocalInPath,
+						err,
+					),
 				)
 			}
 		} else if !fi.IsDir() {
-			errs = append(errs, fmt.Errorf("path %s is not a directory", r.LocalInPath))
+			errs = append(
+				errs,
+				invalidField("localInPath", "path %s is not a directory", r.LocalInPath),
+			)
 		}
 	}
 
 	if r.LocalOutPath != "" {
-		if _, err := os.Stat(r.LocalOutPath); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, checkLocalOutPath("localOutPath", r.LocalOutPath)...)
+	}
+	for i, output := range r.Outputs {
+		if output.Type == OutputTypeLocal && output.Path != "" {
+			errs = append(
+				errs,
+				checkLocalOutPath(fmt.Sprintf("outputs[%d].path", i), output.Path)...,
+			)
+		}
+	}
+
+	if len(errs) > 0 {
+		return newInvalidRequestError(errs)
+	}
+	return nil
+}
+
+// checkLocalOutPath returns errors describing any problems with the specified
+// path, identified by the specified field path, to which rendered manifests
+// are to be written. Existing paths are never overwritten.
+func checkLocalOutPath(field string, path string) []FieldError {
+	if _, err := os.Stat(path); err != nil && !os.IsNotExist(err) {
+		return []FieldError{
+			invalidField(field, "error checking if path %s exists: %s", path, err),
+		}
+	} else if err == nil {
+		// path exists
+		return []FieldError{
+			invalidField(field, "path %q already exists; refusing to overwrite", path),
+		}
+	}
+	return nil
+}
+
+// canonicalize trims whitespace from the options.
+func (o *LocalOutOptions) canonicalize() {
+	o.Format = LocalOutFormat(strings.TrimSpace(string(o.Format)))
+}
+
+// validate returns errors describing any problems with the options, which are
+// identified by the specified field path.
+func (o *LocalOutOptions) validate(path string) []FieldError {
+	switch o.Format {
+	case "", LocalOutFormatDirectory, LocalOutFormatTar:
+		return nil
+	default:
+		return []FieldError{
+			invalidField(
+				path+".format",
+				"LocalOut Format %q is unsupported; supported formats are %q and %q",
+				o.Format,
+				LocalOutFormatDirectory,
+				LocalOutFormatTar,
+			),
+		}
+	}
+}
+
+// canonicalize trims whitespace from the source context.
+func (s *SourceContext) canonicalize() {
+	s.Branch = strings.TrimSpace(s.Branch)
+	s.Branch = strings.TrimPrefix(s.Branch, "refs/heads/")
+	s.Tag = strings.TrimSpace(s.Tag)
+	s.Tag = strings.TrimPrefix(s.Tag, "refs/tags/")
+	s.RunURL = strings.TrimSpace(s.RunURL)
+}
+
+// validate returns errors describing any problems with the source context.
+// Since its fields are recorded in commit trailers, none may span lines.
+func (s *SourceContext) validate() []FieldError {
+	var errs []FieldError
+	for _, field := range []struct {
+		name  string
+		path  string
+		value string
+	}{
+		{name: "Branch", path: "source.branch", value: s.Branch},
+		{name: "Tag", path: "source.tag", value: s.Tag},
+		{name: "RunURL", path: "source.runURL", value: s.RunURL},
+	} {
+		if strings.ContainsAny(field.value, "\r\n") {
 			errs = append(
 				errs,
-				fmt.Errorf("error checking if path %s exists: %w", r.LocalOutPath, err),
+				invalidField(
+					field.path,
+					"Source %s must not contain line breaks",
+					field.name,
+				),
 			)
-		} else if err == nil {
-			// path exists
+		}
+	}
+	if s.RunURL != "" {
+		if u, err := url.Parse(s.RunURL); err != nil ||
+			(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
 			errs = append(
 				errs,
-				fmt.Errorf("path %q already exists; refusing to overwrite", r.LocalOutPath),
+				invalidField(
+					"source.runURL",
+					"Source RunURL %q must be an absolute http or https URL",
+					s.RunURL,
+				),
 			)
 		}
 	}
+	return errs
+}
 
-	return errors.Join(errs...)
+// canonicalize trims whitespace from the options.
+func (o *LastMileOptions) canonicalize() {
+	o.NameSuffix = strings.TrimSpace(o.NameSuffix)
+	o.Namespace = strings.TrimSpace(o.Namespace)
+}
+
+// validate returns errors describing any problems with the options.
+func (o *LastMileOptions) validate() []FieldError {
+	var errs []FieldError
+	if o.Namespace != "" && !namespaceRegex.MatchString(o.Namespace) {
+		errs = append(
+			errs,
+			invalidField(
+				"lastMile.namespace",
+				"LastMile Namespace %q is an invalid namespace",
+				o.Namespace,
+			),
+		)
+	}
+	for _, field := range []struct {
+		name   string
+		path   string
+		values map[string]string
+	}{
+		{
+			name:   "CommonLabels",
+			path:   "lastMile.commonLabels",
+			values: o.CommonLabels,
+		},
+		{
+			name:   "CommonAnnotations",
+			path:   "lastMile.commonAnnotations",
+			values: o.CommonAnnotations,
+		},
+	} {
+		for key := range field.values {
+			if strings.TrimSpace(key) == "" {
+				errs = append(
+					errs,
+					invalidField(
+						field.path,
+						"LastMile %s must not contain any empty keys",
+						field.name,
+					),
+				)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// canonicalize canonicalizes the credentials, including any separate
+// credentials for reading or writing.
+func (c *RepoCredentials) canonicalize() {
+	c.Username = strings.TrimSpace(c.Username)
+	c.Password = strings.TrimSpace(c.Password)
+	if c.ReadCreds != nil {
+		c.ReadCreds.canonicalize()
+	}
+	if c.WriteCreds != nil {
+		c.WriteCreds.canonicalize()
+	}
+}
+
+// validate validates the credentials, including any separate credentials for
+// reading or writing, which must not themselves be nested, as indicated by the
+// nested argument. The specified field name is used in error messages, and the
+// specified path identifies the credentials in the errors' Field.
+func (c *RepoCredentials) validate(
+	field string,
+	path string,
+	nested bool,
+) []FieldError {
+	var errs []FieldError
+	if (c.ClientCertificate == "") != (c.ClientKey == "") {
+		errs = append(
+			errs,
+			invalidField(
+				path+".clientKey",
+				"%s ClientCertificate and ClientKey must be specified together",
+				field,
+			),
+		)
+	}
+	for name, value := range c.ExtraHTTPHeaders {
+		if name == "" || strings.ContainsAny(name, ": \t\r\n") ||
+			strings.ContainsAny(value, "\r\n") {
+			errs = append(
+				errs,
+				invalidField(
+					path+".extraHTTPHeaders",
+					"%s ExtraHTTPHeaders contains an invalid header",
+					field,
+				),
+			)
+			break
+		}
+	}
+	if c.Netrc {
+		if c.ReadCreds != nil || c.WriteCreds != nil || nested {
+			errs = append(
+				errs,
+				invalidField(
+					path+".netrc",
+					"%s Netrc cannot be combined with ReadCreds or WriteCreds",
+					field,
+				),
+			)
+		}
+		if strings.ContainsAny(c.Username+c.Password, " \t\r\n") {
+			errs = append(
+				errs,
+				invalidField(
+					path+".netrc",
+					"%s Username and Password must not contain whitespace when "+
+						"Netrc is specified",
+					field,
+				),
+			)
+		}
+	}
+	if refresh := c.OAuthRefresh; refresh != nil {
+		if nested {
+			errs = append(
+				errs,
+				invalidField(
+					path+".oauthRefresh",
+					"%s must not specify OAuthRefresh",
+					field,
+				),
+			)
+		}
+		if c.SSHPrivateKey != "" {
+			errs = append(
+				errs,
+				invalidField(
+					path+".oauthRefresh",
+					"%s OAuthRefresh cannot be combined with SSHPrivateKey",
+					field,
+				),
+			)
+		}
+		if refresh.TokenURL == "" || refresh.RefreshToken == "" {
+			errs = append(
+				errs,
+				invalidField(
+					path+".oauthRefresh",
+					"%s OAuthRefresh must specify TokenURL and RefreshToken",
+					field,
+				),
+			)
+		}
+	}
+	for _, nestedCreds := range []struct {
+		name  string
+		path  string
+		creds *RepoCredentials
+	}{
+		{name: "ReadCreds", path: "readCreds", creds: c.ReadCreds},
+		{name: "WriteCreds", path: "writeCreds", creds: c.WriteCreds},
+	} {
+		if nestedCreds.creds == nil {
+			continue
+		}
+		if nested {
+			errs = append(
+				errs,
+				invalidField(
+					path+"."+nestedCreds.path,
+					"%s must not specify %s",
+					field,
+					nestedCreds.name,
+				),
+			)
+			continue
+		}
+		errs = append(
+			errs,
+			nestedCreds.creds.validate(
+				field+" "+nestedCreds.name,
+				path+"."+nestedCreds.path,
+				true,
+			)...,
+		)
+	}
+	return errs
 }
@@ -6,6 +6,49 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestValidateRequest(t *testing.T) {
+	err := ValidateRequest(&Request{
+		RepoURL:      " https://github.com/akuity/foobar ",
+		TargetBranch: "env/dev",
+		RepoCreds: RepoCredentials{
+			WriteCreds: &RepoCredentials{ClientCertificate: "cert"},
+		},
+		Options: map[string]string{"bogus": "true"},
+	})
+	var invalidErr *InvalidRequestError
+	require.ErrorAs(t, err, &invalidErr)
+	require.Equal(
+		t,
+		[]FieldError{
+			{
+				Field: "repoCreds.writeCreds.clientKey",
+				Reason: "RepoCreds WriteCreds ClientCertificate and ClientKey must " +
+					"be specified together",
+			},
+			{
+				Field:  "options.bogus",
+				Reason: `Options key "bogus" is unsupported`,
+			},
+		},
+		invalidErr.FieldErrors,
+	)
+	require.Equal(
+		t,
+		"RepoCreds WriteCreds ClientCertificate and ClientKey must be specified "+
+			"together\nOptions key \"bogus\" is unsupported",
+		err.Error(),
+	)
+
+	req := &Request{
+		RepoURL:      " https://github.com/akuity/foobar ",
+		TargetBranch: "refs/heads/env/dev",
+	}
+	require.NoError(t, ValidateRequest(req))
+	// The request was canonicalized
+	require.Equal(t, "https://github.com/akuity/foobar", req.RepoURL)
+	require.Equal(t, "env/dev", req.TargetBranch)
+}
+
 func TestValidateAndCanonicalizeRequest(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -17,6 +60,8 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 			req:  Request{},
 			assertions: func(t *testing.T, _ Request, err error) {
 				require.Error(t, err)
+				var invalidErr *InvalidRequestError
+				require.ErrorAs(t, err, &invalidErr)
 				require.Contains(t, err.Error(), "no input source specified")
 			},
 		},
@@ -57,6 +102,49 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 				require.Contains(t, err.Error(), "output destination is ambiguous")
 			},
 		},
+		{
+			name: "in-memory output destination is ambiguous",
+			req: Request{
+				Stdout:   true,
+				InMemory: true,
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "output destination is ambiguous")
+			},
+		},
+		{
+			name: "unsupported APIVersion",
+			req: Request{
+				APIVersion:   "v0",
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is unsupported")
+			},
+		},
+		{
+			name: "invalid ID",
+			req: Request{
+				ID: "../foo",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `ID "../foo" is invalid`)
+			},
+		},
+		{
+			name: "invalid Tenant",
+			req: Request{
+				Tenant: "../foo",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `Tenant "../foo" is invalid`)
+			},
+		},
 		{
 			name: "invalid RepoURL",
 			req: Request{
@@ -71,6 +159,22 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 				)
 			},
 		},
+		{
+			name: "invalid PushURL",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				PushURL:      "fake-url",
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					`PushURL "fake-url" does not appear to be a valid git repository URL`,
+				)
+			},
+		},
 		{
 			name: "missing TargetBranch",
 			req: Request{
@@ -100,6 +204,108 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 				require.Contains(t, err.Error(), "is an invalid branch name")
 			},
 		},
+		{
+			name: "client certificate without key",
+			req: Request{
+				RepoURL: "https://github.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					ClientCertificate: "cert",
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					"ClientCertificate and ClientKey must be specified together",
+				)
+			},
+		},
+		{
+			name: "invalid extra HTTP header",
+			req: Request{
+				RepoURL: "https://github.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					ExtraHTTPHeaders: map[string]string{"PRIVATE-TOKEN": "foo\nbar"},
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"ExtraHTTPHeaders contains an invalid header",
+				)
+			},
+		},
+		{
+			name: "netrc with separate credentials for writing",
+			req: Request{
+				RepoURL: "https://github.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					Username:   "reader",
+					Password:   "read-token",
+					Netrc:      true,
+					WriteCreds: &RepoCredentials{Password: "write-token"},
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"Netrc cannot be combined with ReadCreds or WriteCreds",
+				)
+			},
+		},
+		{
+			name: "OAuth refresh without refresh token",
+			req: Request{
+				RepoURL: "https://gitlab.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					OAuthRefresh: &OAuthRefreshCredentials{
+						TokenURL: "https://gitlab.com/oauth/token",
+					},
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"OAuthRefresh must specify TokenURL and RefreshToken",
+				)
+			},
+		},
+		{
+			name: "invalid RefPath",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				RefPath:      "/absolute/path",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is an invalid relative path")
+			},
+		},
+		{
+			name: "RefPath outside the repository",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				RefPath:      "env/../../foo",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					"must not refer to a path outside the repository",
+				)
+			},
+		},
 		{
 			name: "empty string image",
 			req: Request{
@@ -120,6 +326,203 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 				)
 			},
 		},
+		{
+			name: "invalid Vars key",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Vars:         map[string]string{"not a name": "foo"},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is an invalid variable name")
+			},
+		},
+		{
+			name: "unsupported option",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Options:      map[string]string{"bogus": "true"},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `Options key "bogus" is unsupported`)
+			},
+		},
+		{
+			name: "invalid option value",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Options:      map[string]string{OptionDiffAlgorithm: "bogus"},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is invalid")
+			},
+		},
+		{
+			name: "invalid last-mile options",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				LastMile: &LastMileOptions{
+					Namespace:    " Not_A_Namespace ",
+					CommonLabels: map[string]string{" ": "foo"},
+				},
+				Options: map[string]string{OptionSkipLastMile: "true"},
+			},
+			assertions: func(t *testing.T, req Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "LastMile cannot be specified")
+				require.Contains(t, err.Error(), `"Not_A_Namespace" is an invalid namespace`)
+				require.Contains(t, err.Error(), "CommonLabels must not contain any empty keys")
+				require.Equal(t, "Not_A_Namespace", req.LastMile.Namespace)
+			},
+		},
+		{
+			name: "valid last-mile options",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				LastMile: &LastMileOptions{
+					NameSuffix:   "-v2",
+					Namespace:    "my-namespace",
+					CommonLabels: map[string]string{"release-id": "42"},
+				},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unsupported priority",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Priority:     "urgent",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `Priority "urgent" is not supported`)
+			},
+		},
+		{
+			name: "priority is canonicalized",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Priority:     " High ",
+			},
+			assertions: func(t *testing.T, req Request, err error) {
+				require.NoError(t, err)
+				require.Equal(t, PriorityHigh, req.Priority)
+			},
+		},
+		{
+			name: "images with last-mile rendering skipped",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Images:       []string{"akuity/some-image"},
+				Options:      map[string]string{OptionSkipLastMile: " true "},
+			},
+			assertions: func(t *testing.T, req Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "Images cannot be specified")
+				require.Equal(t, "true", req.Options[OptionSkipLastMile])
+			},
+		},
+		{
+			name: "incomplete CommitAuthor",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				CommitAuthor: &CommitAuthor{Name: "Kargo Bot"},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					"CommitAuthor must specify both a name and an email address",
+				)
+			},
+		},
+		{
+			name: "invalid PullRequest template",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				PullRequest: &PullRequestOptions{
+					TitleTemplate: "{{ .TargetBranch",
+				},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "PullRequest TitleTemplate is invalid")
+			},
+		},
+		{
+			name: "empty string PullRequest label",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				PullRequest: &PullRequestOptions{
+					Labels: []string{"promotion", " "},
+				},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(
+					t,
+					err.Error(),
+					"PullRequest Labels must not contain any empty strings",
+				)
+			},
+		},
+		{
+			name: "invalid Source",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Source: &SourceContext{
+					Branch: "main\nSource-Tag: v1.0.0",
+					RunURL: "/actions/runs/1",
+				},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "Source Branch must not contain line breaks")
+				require.Contains(t, err.Error(), "must be an absolute http or https URL")
+			},
+		},
+		{
+			name: "LocalOut without LocalOutPath",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				LocalOut:     &LocalOutOptions{ManifestsOnly: true},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "LocalOut may only be specified with LocalOutPath")
+			},
+		},
+		{
+			name: "unsupported LocalOut format",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				LocalOutPath: "/some/path/that/does/not/exist",
+				LocalOut:     &LocalOutOptions{Format: "zip"},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), `LocalOut Format "zip" is unsupported`)
+			},
+		},
 		{
 			name: "LocalInPath does not exist",
 			req: Request{
@@ -140,24 +543,125 @@ func TestValidateAndCanonicalizeRequest(t *testing.T) {
 				require.Contains(t, err.Error(), "already exists; refusing to overwrite")
 			},
 		},
+		{
+			name: "Outputs with Stdout",
+			req: Request{
+				RepoURL:      "https://github.com/akuity/foobar",
+				TargetBranch: "env/dev",
+				Stdout:       true,
+				Outputs:      []Output{{Type: OutputTypeBranch}},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "Outputs is mutually exclusive")
+			},
+		},
+		{
+			name: "invalid Outputs",
+			req: Request{
+				RepoURL:       "https://github.com/akuity/foobar",
+				TargetBranch:  "env/dev",
+				CommitMessage: "Render",
+				Outputs: []Output{
+					{Type: OutputTypeStdout},
+					{Type: OutputTypeStdout, Path: "/some/path"},
+					{Type: OutputTypeLocal},
+					{Type: OutputTypeLocal, Path: "/some/path/that/does/not/exist"},
+					{Type: OutputTypeLocal, Path: "/some/path/that/does/not/exist/"},
+					{Type: OutputTypeLocal, Path: t.TempDir()},
+					{Type: "artifact"},
+				},
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				invalidErr := &InvalidRequestError{}
+				require.ErrorAs(t, err, &invalidErr)
+				fields := map[string]string{}
+				for _, fieldErr := range invalidErr.FieldErrors {
+					fields[fieldErr.Field] = fieldErr.Reason
+				}
+				require.Contains(t, fields["outputs[1].type"], "only one output")
+				require.Contains(t, fields["outputs[1]"], "Path and LocalOut may only")
+				require.Contains(t, fields["outputs[2].path"], "Path is required")
+				require.Contains(t, fields["outputs[4].path"], "more than one output")
+				require.Contains(t, fields["outputs[5].path"], "already exists")
+				require.Contains(t, fields["outputs[6].type"], `Type "artifact" is unsupported`)
+				require.Contains(t, fields["commitMessage"], "output of type")
+				require.NotContains(t, fields, "outputs[3].path")
+			},
+		},
+		{
+			name: "nested credentials for writing",
+			req: Request{
+				RepoURL: "https://github.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					WriteCreds: &RepoCredentials{
+						ReadCreds: &RepoCredentials{Password: "foobar"},
+					},
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"RepoCreds WriteCreds must not specify ReadCreds",
+				)
+			},
+		},
+		{
+			name: "client certificate without key for reading",
+			req: Request{
+				RepoURL: "https://github.com/akuity/foobar",
+				RepoCreds: RepoCredentials{
+					ReadCreds: &RepoCredentials{ClientCertificate: "cert"},
+				},
+				TargetBranch: "env/dev",
+			},
+			assertions: func(t *testing.T, _ Request, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"RepoCreds ReadCreds ClientCertificate and ClientKey must be "+
+						"specified together",
+				)
+			},
+		},
 		{
 			name: "validation succeeds",
 			req: Request{
 				RepoURL: "  https://github.com/akuity/foobar  ",
 				RepoCreds: RepoCredentials{
-					Password: "  foobar  ",
+					Password:   "  foobar  ",
+					WriteCreds: &RepoCredentials{Password: " bar "},
 				},
 				Ref:          "  1abcdef2 ",
+				RefPath:      " ./env/dev/ ",
 				TargetBranch: "  refs/heads/env/dev  ",
 				Images:       []string{" akuity/some-image "}, // no good
+				Source: &SourceContext{
+					Branch: " refs/heads/main ",
+					Tag:    " refs/tags/v1.0.0 ",
+					RunURL: " https://ci.example.com/runs/1 ",
+				},
 			},
 			assertions: func(t *testing.T, req Request, err error) {
 				require.NoError(t, err)
 				require.Equal(t, "https://github.com/akuity/foobar", req.RepoURL)
 				require.Equal(t, "foobar", req.RepoCreds.Password)
+				require.Equal(t, "bar", req.RepoCreds.WriteCreds.Password)
 				require.Equal(t, "1abcdef2", req.Ref)
+				require.Equal(t, "env/dev", req.RefPath)
 				require.Equal(t, "env/dev", req.TargetBranch)
 				require.Equal(t, []string{"akuity/some-image"}, req.Images)
+				require.Equal(
+					t,
+					&SourceContext{
+						Branch: "main",
+						Tag:    "v1.0.0",
+						RunURL: "https://ci.example.com/runs/1",
+					},
+					req.Source,
+				)
 			},
 		},
 	}
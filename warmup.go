@@ -0,0 +1,126 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/akuity/kargo-render/pkg/git"
+)
+
+// WarmUpRequest is a request to prepare the Service to quickly handle future
+// rendering requests for a repository.
+type WarmUpRequest struct {
+	// RepoURL is the URL of a remote GitOps repository.
+	RepoURL string `json:"repoURL"`
+	// RepoCreds encapsulates read credentials for the remote GitOps repository
+	// referenced by the RepoURL field.
+	RepoCreds RepoCredentials `json:"repoCreds,omitempty"`
+	// PreRender specifies whether, in addition to cloning the repository, the
+	// Service should render manifests for every branch explicitly named in the
+	// repository's Kargo Render configuration. Nothing is written to those
+	// branches. This warms any caches used by configuration management tools,
+	// such as Helm's chart cache.
+	PreRender bool `json:"preRender,omitempty"`
+}
+
+// WarmUpResponse describes what was done in response to a WarmUpRequest.
+type WarmUpResponse struct {
+	// Mirrored indicates whether the repository was mirrored into the
+	// Service's clone cache.
+	Mirrored bool `json:"mirrored,omitempty"`
+	// PreRenderedBranches are the names of the branches for which manifests
+	// were rendered.
+	PreRenderedBranches []string `json:"preRenderedBranches,omitempty"`
+}
+
+func (s *service) WarmUp(
+	ctx context.Context,
+	req *WarmUpRequest,
+) (res WarmUpResponse, err error) {
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer release()
+	logger := s.logger.WithFields(log.Fields{
+		"request": uuid.NewString(),
+		"repo":    req.RepoURL,
+	})
+	logger.Debug("handling warm-up request")
+
+	if req.RepoURL == "" {
+		return res, errors.New("repoURL is required")
+	}
+	if s.cloneCacheDir == "" && !req.PreRender {
+		return res, errors.New(
+			"the service has no clone cache and pre-rendering was not requested; " +
+				"there is nothing to warm up",
+		)
+	}
+	// Every branch pre-rendered below shares the access token obtained here
+	repoCreds := req.RepoCreds
+	if _, err = s.refreshOAuthToken(ctx, req.RepoURL, &repoCreds); err != nil {
+		return res, err
+	}
+
+	if s.cloneCacheDir != "" {
+		if err = git.Mirror(
+			ctx,
+			req.RepoURL,
+			repoCreds.gitCreds(),
+			s.mirrorDir(req.RepoURL),
+			s.repoOptions(logger),
+		); err != nil {
+			return res, err
+		}
+		res.Mirrored = true
+		logger.Debug("mirrored repository into clone cache")
+	}
+
+	if !req.PreRender {
+		return res, nil
+	}
+
+	repo, err := git.Clone(
+		ctx,
+		req.RepoURL,
+		repoCreds.gitCreds(),
+		s.cloneOptions(s.repoOptions(logger), req.RepoURL),
+	)
+	if err != nil {
+		return res, fmt.Errorf("error cloning remote repository: %w", err)
+	}
+	branches, err := ConfiguredBranchNames(repo.WorkingDir())
+	repo.Close()
+	if err != nil {
+		return res, err
+	}
+	// Branches whose apps are configured identically share pre-rendered
+	// manifests, since all are rendered from the same source commit
+	cache := newPreRenderCache()
+	for _, branch := range branches {
+		if _, err = s.renderManifests(
+			ctx,
+			&Request{
+				RepoURL:      req.RepoURL,
+				RepoCreds:    repoCreds,
+				TargetBranch: branch,
+				// Writes nothing to the remote repository
+				Stdout:         true,
+				preRenderCache: cache,
+			},
+			nil,
+		); err != nil {
+			return res, fmt.Errorf("error pre-rendering branch %q: %w", branch, err)
+		}
+		res.PreRenderedBranches = append(res.PreRenderedBranches, branch)
+		logger.WithField("targetBranch", branch).Debug("pre-rendered branch")
+	}
+
+	logger.Debug("completed warm-up request")
+	return res, nil
+}
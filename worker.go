@@ -0,0 +1,177 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// QueueMessage is a message, received from a message queue, containing a
+// JSON-encoded rendering request.
+type QueueMessage interface {
+	// Body returns the contents of the message.
+	Body() []byte
+	// Ack acknowledges that the message has been handled and should not be
+	// delivered again.
+	Ack(context.Context) error
+	// Nack indicates that the message could not be handled and should be
+	// delivered again.
+	Nack(context.Context) error
+}
+
+// RequestQueue is an interface for components that can receive rendering
+// requests from, and publish their results to, a message queue such as a NATS
+// JetStream stream or a Kafka topic.
+type RequestQueue interface {
+	// Receive blocks until a message is available or the provided context is
+	// canceled.
+	Receive(context.Context) (QueueMessage, error)
+	// Publish publishes the result of handling a rendering request.
+	Publish(context.Context, WorkerResult) error
+}
+
+// WorkerResult is the result of a Worker handling a rendering request received
+// from a RequestQueue.
+type WorkerResult struct {
+	// IdempotencyKey is the IdempotencyKey of the request, if any. Producers can
+	// use this to correlate results with the requests they enqueued.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// RepoURL is the URL of the repository the request pertained to.
+	RepoURL string `json:"repoURL,omitempty"`
+	// TargetBranch is the branch the request pertained to.
+	TargetBranch string `json:"targetBranch,omitempty"`
+	// Response is the Response to the request. It is nil if the request could
+	// not be handled.
+	Response *Response `json:"response,omitempty"`
+	// Error describes why the request could not be handled, if it could not.
+	Error string `json:"error,omitempty"`
+}
+
+// WorkerOptions encapsulates optional Worker configuration.
+type WorkerOptions struct {
+	LogLevel LogLevel
+	// Concurrency is the maximum number of rendering requests the Worker will
+	// handle at once. If not specified, this defaults to 1.
+	Concurrency int
+}
+
+// Worker is an interface for components that handle rendering requests
+// received from a message queue.
+type Worker interface {
+	// Run receives and handles rendering requests until the provided context
+	// is canceled, at which point it stops receiving requests, waits for those
+	// already in progress to be handled, and returns nil. An error is returned
+	// if receiving a request fails for any other reason.
+	Run(context.Context) error
+}
+
+// worker is an implementation of the Worker interface.
+type worker struct {
+	logger      *log.Logger
+	svc         Service
+	queue       RequestQueue
+	concurrency int
+}
+
+// NewWorker returns an implementation of the Worker interface that handles
+// rendering requests received from the provided RequestQueue using the
+// provided Service, and publishes their results to the same queue. Running
+// many Workers against a shared queue allows rendering to be scaled
+// horizontally. Decorating the Service using NewIdempotentService is
+// recommended, since messages may be delivered more than once.
+//
+// Requests that are not valid according to the published Request schema, or
+// that fail, are acknowledged and an error is published as their result, since
+// delivering them again would be unlikely to produce a different outcome. A
+// message is only delivered again if its result cannot be published.
+func NewWorker(svc Service, queue RequestQueue, opts *WorkerOptions) Worker {
+	if opts == nil {
+		opts = &WorkerOptions{}
+	}
+	if opts.LogLevel == 0 {
+		opts.LogLevel = LogLevelInfo
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	logger := log.New()
+	logger.SetLevel(log.Level(opts.LogLevel))
+	return &worker{
+		logger:      logger,
+		svc:         svc,
+		queue:       queue,
+		concurrency: opts.Concurrency,
+	}
+}
+
+func (w *worker) Run(ctx context.Context) error {
+	// Requests already in progress when ctx is canceled are allowed to finish
+	handleCtx := context.WithoutCancel(ctx)
+	slots := make(chan struct{}, w.concurrency)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		msg, err := w.queue.Receive(ctx)
+		if err != nil {
+			<-slots
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				return nil
+			}
+			return fmt.Errorf("error receiving message: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			w.handle(handleCtx, msg)
+		}()
+	}
+}
+
+// handle handles a single message and publishes its result.
+func (w *worker) handle(ctx context.Context, msg QueueMessage) {
+	result := WorkerResult{}
+	req, err := UnmarshalRequest(msg.Body())
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.IdempotencyKey = req.IdempotencyKey
+		result.RepoURL = req.RepoURL
+		result.TargetBranch = req.TargetBranch
+		var res Response
+		if res, err = w.svc.RenderManifests(ctx, req); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Response = &res
+		}
+	}
+	logger := w.logger.WithFields(log.Fields{
+		"repo":         result.RepoURL,
+		"targetBranch": result.TargetBranch,
+	})
+	if result.Error != "" {
+		logger.WithField("error", result.Error).Error("error handling request")
+	}
+	if err = w.queue.Publish(ctx, result); err != nil {
+		logger.WithError(err).Error("error publishing result")
+		if err = msg.Nack(ctx); err != nil {
+			logger.WithError(err).Error("error rejecting message")
+		}
+		return
+	}
+	if err = msg.Ack(ctx); err != nil {
+		logger.WithError(err).Error("error acknowledging message")
+		return
+	}
+	logger.Debug("handled request")
+}
@@ -0,0 +1,253 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisRequestField is the field of the entries of the requests stream that
+	// contains a JSON-encoded rendering request.
+	redisRequestField = "request"
+	// redisResultField is the field of the entries of the results stream that
+	// contains a JSON-encoded WorkerResult.
+	redisResultField = "result"
+	// redisReceiveBlock is the longest Receive waits for a new message before
+	// checking again for messages to redeliver.
+	redisReceiveBlock = 5 * time.Second
+)
+
+// RedisRequestQueueOptions encapsulates optional configuration of a
+// RequestQueue backed by Redis streams.
+type RedisRequestQueueOptions struct {
+	// RequestsStream is the name of the stream from which rendering requests
+	// are received. Producers add JSON-encoded requests to it in the request
+	// field of new entries, e.g. XADD kargo-render:requests * request <JSON>.
+	// If not specified, this defaults to kargo-render:requests.
+	RequestsStream string
+	// ResultsStream is the name of the stream to which results are published,
+	// in the result field of new entries. If not specified, this defaults to
+	// kargo-render:results.
+	ResultsStream string
+	// ResultsMaxLen is roughly the number of results the results stream keeps.
+	// If not specified, this defaults to 10000.
+	ResultsMaxLen int64
+	// Group is the name of the consumer group that Workers sharing the
+	// requests stream belong to. Each request is received by only one member
+	// of the group. If not specified, this defaults to kargo-render.
+	Group string
+	// Consumer is the name, unique within the group, of this consumer. If not
+	// specified, this defaults to the hostname.
+	Consumer string
+	// RedeliveryTimeout is how long a received request may go unacknowledged
+	// before it is delivered again, possibly to another consumer. This is how
+	// requests received by consumers that died are recovered, so it must
+	// exceed the time rendering any request may take. If not specified, this
+	// defaults to 10 minutes.
+	RedeliveryTimeout time.Duration
+}
+
+// redisRequestQueue is a RequestQueue implementation backed by Redis streams.
+type redisRequestQueue struct {
+	client            redis.UniversalClient
+	requestsStream    string
+	resultsStream     string
+	resultsMaxLen     int64
+	group             string
+	consumer          string
+	redeliveryTimeout time.Duration
+	block             time.Duration
+	groupMu           sync.Mutex
+	groupCreated      bool
+}
+
+// NewRedisRequestQueue returns a RequestQueue that receives rendering requests
+// from, and publishes their results to, Redis streams using the provided
+// client. Requests are received as a member of a consumer group, so that any
+// number of Workers can share the requests stream.
+//
+// Redis streams have no way of rejecting a message, so Nack adds the request
+// to the end of the requests stream again, then acknowledges the original.
+func NewRedisRequestQueue(
+	client redis.UniversalClient,
+	opts *RedisRequestQueueOptions,
+) (RequestQueue, error) {
+	if opts == nil {
+		opts = &RedisRequestQueueOptions{}
+	}
+	q := &redisRequestQueue{
+		client:            client,
+		requestsStream:    opts.RequestsStream,
+		resultsStream:     opts.ResultsStream,
+		resultsMaxLen:     opts.ResultsMaxLen,
+		group:             opts.Group,
+		consumer:          opts.Consumer,
+		redeliveryTimeout: opts.RedeliveryTimeout,
+		block:             redisReceiveBlock,
+	}
+	if q.requestsStream == "" {
+		q.requestsStream = "kargo-render:requests"
+	}
+	if q.resultsStream == "" {
+		q.resultsStream = "kargo-render:results"
+	}
+	if q.resultsMaxLen <= 0 {
+		q.resultsMaxLen = 10000
+	}
+	if q.group == "" {
+		q.group = "kargo-render"
+	}
+	if q.consumer == "" {
+		var err error
+		if q.consumer, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("error determining name of consumer: %w", err)
+		}
+	}
+	if q.redeliveryTimeout <= 0 {
+		q.redeliveryTimeout = 10 * time.Minute
+	}
+	return q, nil
+}
+
+func (r *redisRequestQueue) Receive(ctx context.Context) (QueueMessage, error) {
+	if err := r.createGroup(ctx); err != nil {
+		return nil, err
+	}
+	for {
+		// Requests received by consumers that never acknowledged them are
+		// delivered again before any new ones
+		msgs, _, err := r.client.XAutoClaim(
+			ctx,
+			&redis.XAutoClaimArgs{
+				Stream:   r.requestsStream,
+				Group:    r.group,
+				MinIdle:  r.redeliveryTimeout,
+				Start:    "0-0",
+				Count:    1,
+				Consumer: r.consumer,
+			},
+		).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error claiming unacknowledged request: %w", err)
+		}
+		if len(msgs) > 0 {
+			return r.newMessage(msgs[0]), nil
+		}
+		streams, err := r.client.XReadGroup(
+			ctx,
+			&redis.XReadGroupArgs{
+				Group:    r.group,
+				Consumer: r.consumer,
+				Streams:  []string{r.requestsStream, ">"},
+				Count:    1,
+				Block:    r.block,
+			},
+		).Result()
+		if errors.Is(err, redis.Nil) {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading request: %w", err)
+		}
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			return r.newMessage(streams[0].Messages[0]), nil
+		}
+	}
+}
+
+func (r *redisRequestQueue) Publish(ctx context.Context, result WorkerResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling result: %w", err)
+	}
+	if err = r.client.XAdd(
+		ctx,
+		&redis.XAddArgs{
+			Stream: r.resultsStream,
+			MaxLen: r.resultsMaxLen,
+			Approx: true,
+			Values: []any{redisResultField, data},
+		},
+	).Err(); err != nil {
+		return fmt.Errorf("error adding result to stream %q: %w", r.resultsStream, err)
+	}
+	return nil
+}
+
+// createGroup creates the consumer group, and the requests stream, unless they
+// already exist. The group starts from the beginning of the stream, so that
+// requests added before any Worker ran are not missed.
+func (r *redisRequestQueue) createGroup(ctx context.Context) error {
+	r.groupMu.Lock()
+	defer r.groupMu.Unlock()
+	if r.groupCreated {
+		return nil
+	}
+	err := r.client.XGroupCreateMkStream(ctx, r.requestsStream, r.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("error creating consumer group %q: %w", r.group, err)
+	}
+	r.groupCreated = true
+	return nil
+}
+
+func (r *redisRequestQueue) newMessage(msg redis.XMessage) QueueMessage {
+	body, _ := msg.Values[redisRequestField].(string)
+	return &redisQueueMessage{
+		queue: r,
+		id:    msg.ID,
+		body:  []byte(body),
+	}
+}
+
+// redisQueueMessage is a QueueMessage received from a Redis stream.
+type redisQueueMessage struct {
+	queue *redisRequestQueue
+	id    string
+	body  []byte
+}
+
+func (r *redisQueueMessage) Body() []byte {
+	return r.body
+}
+
+func (r *redisQueueMessage) Ack(ctx context.Context) error {
+	// Acknowledged entries are deleted so that the stream does not grow
+	// without bound
+	_, err := r.queue.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, r.queue.requestsStream, r.queue.group, r.id)
+		pipe.XDel(ctx, r.queue.requestsStream, r.id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error acknowledging request %q: %w", r.id, err)
+	}
+	return nil
+}
+
+func (r *redisQueueMessage) Nack(ctx context.Context) error {
+	_, err := r.queue.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: r.queue.requestsStream,
+			Values: []any{redisRequestField, r.body},
+		})
+		pipe.XAck(ctx, r.queue.requestsStream, r.queue.group, r.id)
+		pipe.XDel(ctx, r.queue.requestsStream, r.id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error requeuing request %q: %w", r.id, err)
+	}
+	return nil
+}
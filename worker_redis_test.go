@@ -0,0 +1,167 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisRequestQueue(
+	t *testing.T,
+	client redis.UniversalClient,
+	consumer string,
+	redeliveryTimeout time.Duration,
+) *redisRequestQueue {
+	q, err := NewRedisRequestQueue(
+		client,
+		&RedisRequestQueueOptions{
+			Consumer:          consumer,
+			RedeliveryTimeout: redeliveryTimeout,
+		},
+	)
+	require.NoError(t, err)
+	redisQ := q.(*redisRequestQueue) // nolint: forcetypeassert
+	redisQ.block = 10 * time.Millisecond
+	return redisQ
+}
+
+func addTestRequest(t *testing.T, client redis.UniversalClient, body string) {
+	require.NoError(
+		t,
+		client.XAdd(
+			context.Background(),
+			&redis.XAddArgs{
+				Stream: "kargo-render:requests",
+				Values: []any{redisRequestField, body},
+			},
+		).Err(),
+	)
+}
+
+func TestRedisRequestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("receive and acknowledge", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		// Requests added before the consumer group exists are not missed
+		addTestRequest(t, client, `{"repoURL":"fake-url"}`)
+		q := newTestRedisRequestQueue(t, client, "a", time.Minute)
+		msg, err := q.Receive(ctx)
+		require.NoError(t, err)
+		require.Equal(t, `{"repoURL":"fake-url"}`, string(msg.Body()))
+		require.NoError(t, msg.Ack(ctx))
+		length, err := client.XLen(ctx, q.requestsStream).Result()
+		require.NoError(t, err)
+		require.Zero(t, length)
+	})
+
+	t.Run("nack delivers again", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		q := newTestRedisRequestQueue(t, client, "a", time.Minute)
+		addTestRequest(t, client, `{"repoURL":"fake-url"}`)
+		msg, err := q.Receive(ctx)
+		require.NoError(t, err)
+		require.NoError(t, msg.Nack(ctx))
+		msg, err = q.Receive(ctx)
+		require.NoError(t, err)
+		require.Equal(t, `{"repoURL":"fake-url"}`, string(msg.Body()))
+		require.NoError(t, msg.Ack(ctx))
+	})
+
+	t.Run("unacknowledged requests are delivered again", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		a := newTestRedisRequestQueue(t, client, "a", 50*time.Millisecond)
+		b := newTestRedisRequestQueue(t, client, "b", 50*time.Millisecond)
+		addTestRequest(t, client, `{"repoURL":"fake-url"}`)
+		_, err := a.Receive(ctx)
+		require.NoError(t, err)
+		// Consumer a dies without acknowledging the request
+		time.Sleep(100 * time.Millisecond)
+		msg, err := b.Receive(ctx)
+		require.NoError(t, err)
+		require.Equal(t, `{"repoURL":"fake-url"}`, string(msg.Body()))
+	})
+
+	t.Run("receive is canceled", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		q := newTestRedisRequestQueue(t, client, "a", time.Minute)
+		cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := q.Receive(cancelCtx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		q := newTestRedisRequestQueue(t, client, "a", time.Minute)
+		require.NoError(
+			t,
+			q.Publish(ctx, WorkerResult{IdempotencyKey: "fake-key", Error: "boom"}),
+		)
+		entries, err := client.XRange(ctx, q.resultsStream, "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		result := WorkerResult{}
+		require.NoError(
+			t,
+			json.Unmarshal(
+				[]byte(entries[0].Values[redisResultField].(string)), // nolint: forcetypeassert
+				&result,
+			),
+		)
+		require.Equal(t, "fake-key", result.IdempotencyKey)
+		require.Equal(t, "boom", result.Error)
+	})
+}
+
+func TestWorkerWithRedisRequestQueue(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	q := newTestRedisRequestQueue(t, client, "a", time.Minute)
+	w := NewWorker(
+		&mockService{
+			renderFn: func(_ context.Context, req *Request) (Response, error) {
+				return Response{CommitID: req.Ref}, nil
+			},
+		},
+		q,
+		nil,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	addTestRequest(
+		t,
+		client,
+		`{
+			"repoURL": "https://github.com/akuity/foobar",
+			"targetBranch": "env/dev",
+			"ref": "abc",
+			"idempotencyKey": "fake-key"
+		}`,
+	)
+	require.Eventually(
+		t,
+		func() bool {
+			length, err := client.XLen(context.Background(), q.resultsStream).Result()
+			return err == nil && length == 1
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+	cancel()
+	require.NoError(t, <-done)
+	entries, err := client.XRange(context.Background(), q.resultsStream, "-", "+").Result()
+	require.NoError(t, err)
+	require.Contains(t, entries[0].Values[redisResultField], `"commitID":"abc"`)
+	require.Contains(t, entries[0].Values[redisResultField], `"idempotencyKey":"fake-key"`)
+	length, err := client.XLen(context.Background(), q.requestsStream).Result()
+	require.NoError(t, err)
+	require.Zero(t, length)
+}
@@ -0,0 +1,153 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQueueMessage struct {
+	body   []byte
+	acked  atomic.Bool
+	nacked atomic.Bool
+}
+
+func (f *fakeQueueMessage) Body() []byte {
+	return f.body
+}
+
+func (f *fakeQueueMessage) Ack(context.Context) error {
+	f.acked.Store(true)
+	return nil
+}
+
+func (f *fakeQueueMessage) Nack(context.Context) error {
+	f.nacked.Store(true)
+	return nil
+}
+
+type fakeRequestQueue struct {
+	messages   chan QueueMessage
+	publishErr error
+	mu         sync.Mutex
+	results    []WorkerResult
+}
+
+func (f *fakeRequestQueue) Receive(ctx context.Context) (QueueMessage, error) {
+	select {
+	case msg := <-f.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fakeRequestQueue) Publish(_ context.Context, result WorkerResult) error {
+	if f.publishErr != nil {
+		return f.publishErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, result)
+	return nil
+}
+
+func (f *fakeRequestQueue) resultsByKey() map[string]WorkerResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := make(map[string]WorkerResult, len(f.results))
+	for _, result := range f.results {
+		results[result.IdempotencyKey] = result
+	}
+	return results
+}
+
+func TestWorker(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	svc := &mockService{
+		renderFn: func(_ context.Context, req *Request) (Response, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				if m := maxInFlight.Load(); n <= m ||
+					maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			if req.Ref == "bad" {
+				return Response{}, errors.New("something went wrong")
+			}
+			return Response{CommitID: req.Ref}, nil
+		},
+	}
+
+	t.Run("handles requests with bounded concurrency", func(t *testing.T) {
+		queue := &fakeRequestQueue{messages: make(chan QueueMessage, 10)}
+		msgs := []*fakeQueueMessage{
+			{body: []byte(`{"targetBranch": "env/dev", "ref": "abc", "idempotencyKey": "1"}`)},
+			{body: []byte(`{"targetBranch": "env/dev", "ref": "def", "idempotencyKey": "2"}`)},
+			{body: []byte(`{"targetBranch": "env/dev", "ref": "bad", "idempotencyKey": "3"}`)},
+			{body: []byte(`{"targetBranch": "env/dev", "ref": "ghi", "idempotencyKey": "4"}`)},
+			{body: []byte(`bogus`)},
+		}
+		for _, msg := range msgs {
+			queue.messages <- msg
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- NewWorker(svc, queue, &WorkerOptions{Concurrency: 2}).Run(ctx)
+		}()
+		require.Eventually(
+			t,
+			func() bool {
+				for _, msg := range msgs {
+					if !msg.acked.Load() {
+						return false
+					}
+				}
+				return true
+			},
+			5*time.Second,
+			10*time.Millisecond,
+		)
+		cancel()
+		require.NoError(t, <-done)
+		require.LessOrEqual(t, maxInFlight.Load(), int32(2))
+		results := queue.resultsByKey()
+		require.Len(t, results, 5)
+		require.Equal(t, "abc", results["1"].Response.CommitID)
+		require.Equal(t, "env/dev", results["1"].TargetBranch)
+		require.Equal(t, "def", results["2"].Response.CommitID)
+		require.Nil(t, results["3"].Response)
+		require.Equal(t, "something went wrong", results["3"].Error)
+		require.Equal(t, "ghi", results["4"].Response.CommitID)
+		require.Contains(t, results[""].Error, "error validating request")
+	})
+
+	t.Run("messages are redelivered if results cannot be published", func(t *testing.T) {
+		queue := &fakeRequestQueue{
+			messages:   make(chan QueueMessage, 1),
+			publishErr: errors.New("something went wrong"),
+		}
+		msg := &fakeQueueMessage{
+			body: []byte(`{"targetBranch": "env/dev", "ref": "abc"}`),
+		}
+		queue.messages <- msg
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- NewWorker(svc, queue, nil).Run(ctx)
+		}()
+		require.Eventually(t, msg.nacked.Load, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		require.NoError(t, <-done)
+		require.False(t, msg.acked.Load())
+	})
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package render
+
+import (
+	"errors"
+	"os"
+)
+
+// acquireWorkspaceLock creates the lock file at the specified path and returns
+// it open. The file's existence is the lock, which is held until the file is
+// passed to releaseWorkspaceLock. If the file already exists, because another
+// process, or another request in this process, holds the lock, a nil file is
+// returned. On platforms without flock, a process that crashes leaves its lock
+// file behind, and it must be removed by hand.
+func acquireWorkspaceLock(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, nil
+	}
+	return file, err
+}
+
+// releaseWorkspaceLock closes the provided file and removes it, releasing the
+// lock.
+func releaseWorkspaceLock(file *os.File) error {
+	closeErr := file.Close()
+	return errors.Join(closeErr, os.Remove(file.Name()))
+}
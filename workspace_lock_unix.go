@@ -0,0 +1,53 @@
+//go:build unix
+
+package render
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// acquireWorkspaceLock takes an exclusive lock on the lock file at the
+// specified path, creating the file if necessary, and returns the open file,
+// which holds the lock until it is passed to releaseWorkspaceLock. If another
+// process, or another request in this process, holds the lock, a nil file is
+// returned. Locks are released by the operating system when the process that
+// holds them exits, so a crashed process never leaves one behind.
+func acquireWorkspaceLock(path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = file.Close()
+			return nil, nil
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		// The previous holder of the lock removes the file before releasing the
+		// lock, so a lock taken on a file that has since been removed excludes
+		// no one. Try again with the file now at the path, if any.
+		lockedInfo, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		if pathInfo, statErr := os.Stat(path); statErr == nil &&
+			os.SameFile(lockedInfo, pathInfo) {
+			return file, nil
+		}
+		_ = file.Close()
+	}
+}
+
+// releaseWorkspaceLock removes the lock file held open by the provided file
+// and releases the lock on it.
+func releaseWorkspaceLock(file *os.File) error {
+	removeErr := os.Remove(file.Name())
+	return errors.Join(removeErr, file.Close())
+}
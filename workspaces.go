@@ -0,0 +1,189 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// keptWorkspaceMarker is the name of a file written to the root of any
+// workspace that has been preserved for inspection following a failed
+// rendering request. Its presence is what makes a workspace eligible for
+// garbage collection.
+const keptWorkspaceMarker = ".kargo-render-kept"
+
+// requestWorkspaceMarker is the name of a file written to the root of any
+// workspace whose location is determined by the ID of a request. It contains
+// the request's ID and is what makes the workspace eligible for reuse by a
+// retry of the same request.
+const requestWorkspaceMarker = ".kargo-render-request"
+
+// pinnedWorkspaceMarker is the name of a file written to the root of any
+// workspace that has been pinned using PinWorkspace. Pinned workspaces are
+// never removed by Kargo Render.
+const pinnedWorkspaceMarker = ".kargo-render-pinned"
+
+// requestWorkspaceDir returns the location of the workspace of requests with
+// the specified ID.
+func requestWorkspaceDir(requestID string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("repo-request-%s", requestID))
+}
+
+// requestWorkspaceLockPath returns the location of the file that is locked
+// while the workspace of requests with the specified ID is in use. It is kept
+// beside the workspace, rather than in it, because workspaces that can't be
+// reused are removed.
+func requestWorkspaceLockPath(requestID string) string {
+	return requestWorkspaceDir(requestID) + ".lock"
+}
+
+// lockRequestWorkspace takes an exclusive lock on the workspace of requests
+// with the specified ID and returns a function that releases it. If the
+// workspace is already locked, because another attempt at handling the same
+// request is in progress, a *RequestInProgressError is returned.
+func lockRequestWorkspace(requestID string) (func() error, error) {
+	path := requestWorkspaceLockPath(requestID)
+	file, err := acquireWorkspaceLock(path)
+	if err != nil {
+		return nil, fmt.Errorf("error locking workspace %q: %w", path, err)
+	}
+	if file == nil {
+		return nil, &RequestInProgressError{RequestID: requestID}
+	}
+	return func() error {
+		if err := releaseWorkspaceLock(file); err != nil {
+			return fmt.Errorf("error unlocking workspace %q: %w", path, err)
+		}
+		return nil
+	}, nil
+}
+
+// prepareRequestWorkspace ensures the existence of the workspace of requests
+// with the specified ID and returns its location, along with a bool indicating
+// whether the workspace was left behind by an earlier attempt at handling the
+// same request and may therefore be reused. Anything found at the workspace's
+// location that was not left there by such an attempt is removed. The caller
+// must hold the workspace's lock. See lockRequestWorkspace.
+func prepareRequestWorkspace(requestID string) (string, bool, error) {
+	dir := requestWorkspaceDir(requestID)
+	markerPath := filepath.Join(dir, requestWorkspaceMarker)
+	marker, err := os.ReadFile(markerPath)
+	reused := err == nil && string(marker) == requestID
+	if !reused {
+		if err = os.RemoveAll(dir); err != nil {
+			return "", false, fmt.Errorf("error removing %q: %w", dir, err)
+		}
+	}
+	// A workspace that is being reused is no longer merely preserved for
+	// inspection, so it must not be garbage collected
+	if err = os.Remove(filepath.Join(dir, keptWorkspaceMarker)); err != nil &&
+		!errors.Is(err, os.ErrNotExist) {
+		return "", false, fmt.Errorf("error unmarking workspace %q: %w", dir, err)
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", false, fmt.Errorf("error creating workspace %q: %w", dir, err)
+	}
+	if err = os.WriteFile(markerPath, []byte(requestID), 0600); err != nil {
+		return "", false, fmt.Errorf("error marking workspace %q: %w", dir, err)
+	}
+	return dir, reused, nil
+}
+
+// PinWorkspace pins the workspace of requests with the specified ID, creating
+// it if necessary, and returns its location. Requests bearing the ID reuse the
+// pinned workspace, and it is retained after each request completes, whether
+// it succeeds or fails, so that a specific request can be debugged by
+// inspecting, or even modifying, its workspace. Pinned workspaces are retained
+// until they are unpinned using UnpinWorkspace.
+func PinWorkspace(requestID string) (string, error) {
+	if !requestIDRegex.MatchString(requestID) {
+		return "", fmt.Errorf("request ID %q is invalid", requestID)
+	}
+	unlock, err := lockRequestWorkspace(requestID)
+	if err != nil {
+		return "", err
+	}
+	dir, _, err := prepareRequestWorkspace(requestID)
+	if err == nil {
+		markerPath := filepath.Join(dir, pinnedWorkspaceMarker)
+		if err = os.WriteFile(markerPath, nil, 0600); err != nil {
+			err = fmt.Errorf("error pinning workspace %q: %w", dir, err)
+		}
+	}
+	if err = errors.Join(err, unlock()); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// UnpinWorkspace removes the pinned workspace of requests with the specified
+// ID. It is not an error if no such workspace exists. If a request bearing the
+// ID is being handled, a *RequestInProgressError is returned.
+func UnpinWorkspace(requestID string) error {
+	if !requestIDRegex.MatchString(requestID) {
+		return fmt.Errorf("request ID %q is invalid", requestID)
+	}
+	unlock, err := lockRequestWorkspace(requestID)
+	if err != nil {
+		return err
+	}
+	dir := requestWorkspaceDir(requestID)
+	if err = os.RemoveAll(dir); err != nil {
+		err = fmt.Errorf("error removing workspace %q: %w", dir, err)
+	}
+	return errors.Join(err, unlock())
+}
+
+// isWorkspacePinned returns a bool indicating whether the workspace at the
+// specified path has been pinned using PinWorkspace.
+func isWorkspacePinned(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, pinnedWorkspaceMarker))
+	return err == nil
+}
+
+// keepWorkspace marks the workspace at the specified path as preserved, logs
+// its location, and returns the provided error, augmented with the workspace's
+// location.
+func keepWorkspace(logger *log.Entry, dir string, err error) error {
+	markerPath := filepath.Join(dir, keptWorkspaceMarker)
+	if markErr := os.WriteFile(markerPath, nil, 0600); markErr != nil {
+		logger.WithError(markErr).Error("error marking workspace as preserved")
+	}
+	logger.WithField("workspace", dir).
+		Error("preserved workspace of failed request for inspection")
+	return fmt.Errorf("%w (workspace preserved at %s)", err, dir)
+}
+
+// gcKeptWorkspaces removes any workspaces in the system's temporary directory
+// that were preserved for inspection longer ago than the specified TTL.
+// Failures are logged, but are otherwise non-fatal.
+func gcKeptWorkspaces(logger *log.Entry, ttl time.Duration) {
+	tempDir := os.TempDir()
+	items, err := os.ReadDir(tempDir)
+	if err != nil {
+		logger.WithError(err).Warn("error listing temporary directory contents")
+		return
+	}
+	for _, item := range items {
+		if !item.IsDir() || !strings.HasPrefix(item.Name(), "repo-") {
+			continue
+		}
+		dir := filepath.Join(tempDir, item.Name())
+		fi, statErr := os.Stat(filepath.Join(dir, keptWorkspaceMarker))
+		if statErr != nil || time.Since(fi.ModTime()) < ttl ||
+			isWorkspacePinned(dir) {
+			continue
+		}
+		if rmErr := os.RemoveAll(dir); rmErr != nil {
+			logger.WithError(rmErr).WithField("workspace", dir).
+				Warn("error removing expired workspace")
+			continue
+		}
+		logger.WithField("workspace", dir).Debug("removed expired workspace")
+	}
+}
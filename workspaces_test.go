@@ -0,0 +1,157 @@
+package render
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/akuity/kargo-render/internal/file"
+)
+
+func TestKeepWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	err := keepWorkspace(
+		log.NewEntry(log.New()),
+		dir,
+		errors.New("something went wrong"),
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "something went wrong")
+	require.Contains(t, err.Error(), dir)
+	exists, err := file.Exists(filepath.Join(dir, keptWorkspaceMarker))
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestGCKeptWorkspaces(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	// An expired workspace
+	expiredDir := filepath.Join(tempDir, "repo-expired")
+	require.NoError(t, os.Mkdir(expiredDir, 0755))
+	expiredMarker := filepath.Join(expiredDir, keptWorkspaceMarker)
+	require.NoError(t, os.WriteFile(expiredMarker, nil, 0600))
+	longAgo := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(expiredMarker, longAgo, longAgo))
+
+	// A workspace that hasn't expired yet
+	freshDir := filepath.Join(tempDir, "repo-fresh")
+	require.NoError(t, os.Mkdir(freshDir, 0755))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(freshDir, keptWorkspaceMarker), nil, 0600),
+	)
+
+	// A workspace that was never marked as kept (possibly in use)
+	unmarkedDir := filepath.Join(tempDir, "repo-unmarked")
+	require.NoError(t, os.Mkdir(unmarkedDir, 0755))
+
+	gcKeptWorkspaces(log.NewEntry(log.New()), 24*time.Hour)
+
+	exists, err := file.Exists(expiredDir)
+	require.NoError(t, err)
+	require.False(t, exists)
+	exists, err = file.Exists(freshDir)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = file.Exists(unmarkedDir)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestPrepareRequestWorkspace(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	// A new workspace
+	dir, reused, err := prepareRequestWorkspace("foo")
+	require.NoError(t, err)
+	require.False(t, reused)
+	require.Equal(t, filepath.Join(tempDir, "repo-request-foo"), dir)
+	require.DirExists(t, dir)
+
+	// The workspace of an earlier attempt, which had been kept
+	leftover := filepath.Join(dir, "leftover")
+	require.NoError(t, os.WriteFile(leftover, nil, 0600))
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, keptWorkspaceMarker), nil, 0600),
+	)
+	dir, reused, err = prepareRequestWorkspace("foo")
+	require.NoError(t, err)
+	require.True(t, reused)
+	require.FileExists(t, leftover)
+	require.NoFileExists(t, filepath.Join(dir, keptWorkspaceMarker))
+
+	// Something else entirely
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(dir, requestWorkspaceMarker), []byte("bar"), 0600),
+	)
+	_, reused, err = prepareRequestWorkspace("foo")
+	require.NoError(t, err)
+	require.False(t, reused)
+	require.NoFileExists(t, leftover)
+}
+
+func TestLockRequestWorkspace(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	unlock, err := lockRequestWorkspace("foo")
+	require.NoError(t, err)
+
+	// Concurrent attempts at handling the same request are rejected
+	_, err = lockRequestWorkspace("foo")
+	inProgressErr := &RequestInProgressError{}
+	require.ErrorAs(t, err, &inProgressErr)
+	require.Equal(t, "foo", inProgressErr.RequestID)
+	err = UnpinWorkspace("foo")
+	require.ErrorAs(t, err, &inProgressErr)
+
+	// Requests with other IDs are unaffected
+	unlockBar, err := lockRequestWorkspace("bar")
+	require.NoError(t, err)
+	require.NoError(t, unlockBar())
+
+	// Once released, the lock can be taken again
+	require.NoError(t, unlock())
+	require.NoFileExists(t, requestWorkspaceLockPath("foo"))
+	unlock, err = lockRequestWorkspace("foo")
+	require.NoError(t, err)
+	require.NoError(t, unlock())
+}
+
+func TestPinWorkspace(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	_, err := PinWorkspace("../foo")
+	require.Error(t, err)
+
+	dir, err := PinWorkspace("foo")
+	require.NoError(t, err)
+	require.True(t, isWorkspacePinned(dir))
+
+	// Pinned workspaces are reused and never garbage collected, even if they
+	// were also kept following a failure
+	_, reused, err := prepareRequestWorkspace("foo")
+	require.NoError(t, err)
+	require.True(t, reused)
+	marker := filepath.Join(dir, keptWorkspaceMarker)
+	require.NoError(t, os.WriteFile(marker, nil, 0600))
+	longAgo := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(marker, longAgo, longAgo))
+	gcKeptWorkspaces(log.NewEntry(log.New()), 24*time.Hour)
+	require.DirExists(t, dir)
+
+	require.NoError(t, UnpinWorkspace("foo"))
+	require.NoDirExists(t, dir)
+	// Unpinning again is not an error
+	require.NoError(t, UnpinWorkspace("foo"))
+}